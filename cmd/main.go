@@ -20,10 +20,14 @@ import (
 	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +39,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
 	k8s_runtime "k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -42,6 +47,8 @@ import (
 	"kdex.dev/crds/configuration"
 	kdexlog "kdex.dev/crds/log"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/config"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -53,7 +60,12 @@ import (
 	"github.com/kdex-tech/host-manager/internal/cache"
 	"github.com/kdex-tech/host-manager/internal/controller"
 	"github.com/kdex-tech/host-manager/internal/host"
+	"github.com/kdex-tech/host-manager/internal/sniffer"
+	"github.com/kdex-tech/host-manager/internal/startup"
+	"github.com/kdex-tech/host-manager/internal/tracing"
+	"github.com/kdex-tech/host-manager/internal/web/middleware"
 	"github.com/kdex-tech/host-manager/internal/web/server"
+	webhookv1alpha1 "github.com/kdex-tech/host-manager/internal/webhook/v1alpha1"
 
 	_ "net/http/pprof"
 	// +kubebuilder:scaffold:imports
@@ -76,16 +88,29 @@ func init() {
 
 // nolint:gocyclo
 func main() {
+	var accessLogExclude string
+	var accessLogFormat string
+	var accessLogSampleRate float64
 	var cacheAddr string
 	var configFile string
 	var focalHost string
+	var graphQL bool
+	var middlewarePluginDir string
+	var mockFunctions bool
 	namedLogLevels := make(kdexlog.NamedLogLevelPairs)
+	var otlpEndpoint string
 	var pprofAddr string
 	var requeueDelaySeconds int
 	var serviceName string
+	var snifferHistorySize int
+	var snifferSchemaConflictStrategy string
+	var snifferUpstream string
+	var snifferWriteWindow time.Duration
+	var validateOnly bool
 	var webserverAddr string
 
 	var enableHTTP2 bool
+	var enableWebhooks bool
 	var metricsAddr string
 	var metricsCertKey, metricsCertName, metricsCertPath string
 	var probeAddr string
@@ -93,18 +118,54 @@ func main() {
 	var tlsOpts []func(*tls.Config)
 	var webhookCertKey, webhookCertName, webhookCertPath string
 
+	flag.StringVar(&accessLogExclude, "access-log-exclude", os.Getenv("ACCESS_LOG_EXCLUDE"), "The comma separated "+
+		"path prefixes of the requests not written to the access log, e.g. /-/healthz. "+
+		"Or set ACCESS_LOG_EXCLUDE env var.")
+	flag.StringVar(&accessLogFormat, "access-log-format", os.Getenv("ACCESS_LOG_FORMAT"), "The format of the access "+
+		"log of the web server written to stdout: json, common, combined or off (default). "+
+		"Or set ACCESS_LOG_FORMAT env var.")
+	flag.Float64Var(&accessLogSampleRate, "access-log-sample-rate", envFloat("ACCESS_LOG_SAMPLE_RATE", 1), "The "+
+		"share of the requests written to the access log, from 0 to 1. Server errors are always written. "+
+		"Or set ACCESS_LOG_SAMPLE_RATE env var.")
 	flag.StringVar(&cacheAddr, "cache-address", os.Getenv("CACHE_ADDRESS"), "The address of the Redis/Valkey cache. "+
 		"Or set CACHE_ADDRESS env var.")
 	flag.StringVar(&configFile, "config-file", "/config.yaml", "The path to a configuration yaml file.")
 	flag.StringVar(&focalHost, "focal-host", "", "The name of a KDexHost resource to focus the controller instance's "+
 		"attention on.")
+	flag.BoolVar(&graphQL, "graphql", envBool("GRAPHQL", false), "If set, the operations of the functions are "+
+		"exposed as a GraphQL schema at /-/graphql. Or set GRAPHQL env var.")
+	flag.StringVar(&middlewarePluginDir, "middleware-plugin-dir", os.Getenv("MIDDLEWARE_PLUGIN_DIR"), "The "+
+		"directory of the Go plugins of the middlewares the hosts declare in their kdex.dev/middlewares annotation. "+
+		"Empty disables the plugins. Or set MIDDLEWARE_PLUGIN_DIR env var.")
+	flag.BoolVar(&mockFunctions, "mock-functions", envBool("MOCK_FUNCTIONS", false), "If set, the operations of "+
+		"functions which are not ready yet are answered with responses generated from the examples and schemas of "+
+		"their spec. Or set MOCK_FUNCTIONS env var.")
 	flag.Var(&namedLogLevels, "named-log-level", "Specify a named log level pair (format: NAME=LEVEL) (can be used "+
 		"multiple times). Or set NAMED_LOG_LEVELS env var with space delimited pairs with the same format.")
-	flag.StringVar(&pprofAddr, "pprof-bind-address", os.Getenv("PPROF_BIND_ADDRESS"), "The address the pprof endpoint "+
-		"binds to. If not set, the pprof endpoint is disabled. Or set PPROF_BIND_ADDRESS env var.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", tracing.Endpoint(), "The OTLP/gRPC endpoint the traces are "+
+		"exported to, e.g. http://otel-collector:4317. If not set, no traces are exported. "+
+		"Or set OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT env var.")
+	flag.StringVar(&pprofAddr, "pprof-bind-address", os.Getenv("PPROF_BIND_ADDRESS"), "Deprecated: annotate the host "+
+		"with kdex.dev/profiling=true to serve the profiles under /-/admin/pprof/ instead. The address the "+
+		"unauthenticated pprof endpoint binds to. If not set, the pprof endpoint is disabled. Or set PPROF_BIND_ADDRESS env var.")
 	flag.IntVar(&requeueDelaySeconds, "requeue-delay-seconds", 15, "Set the delay for requeuing reconciliation loops")
 	flag.StringVar(&serviceName, "service-name", "", "The name of the controller service so it can self configure an "+
 		"ingress/httproute with itself as backend.")
+	flag.IntVar(&snifferHistorySize, "sniffer-history-size", envInt("SNIFFER_HISTORY_SIZE", host.DefaultSnifferHistorySize),
+		"The number of sniffer analysis results kept across restarts, 0 disables the history. "+
+			"Or set SNIFFER_HISTORY_SIZE env var.")
+	flag.StringVar(&snifferSchemaConflictStrategy, "sniffer-schema-conflict-strategy",
+		os.Getenv("SNIFFER_SCHEMA_CONFLICT_STRATEGY"), "How the sniffer resolves inferred schemas that conflict with "+
+			"existing ones: prefer-newest (default), prefer-existing, merge, keep or fail. "+
+			"Or set SNIFFER_SCHEMA_CONFLICT_STRATEGY env var.")
+	flag.StringVar(&snifferUpstream, "sniffer-upstream", os.Getenv("SNIFFER_UPSTREAM"), "The origin unmatched "+
+		"requests are forwarded to so the sniffer can learn from real responses. Only used by hosts in dev mode. "+
+		"Or set SNIFFER_UPSTREAM env var.")
+	flag.DurationVar(&snifferWriteWindow, "sniffer-write-window",
+		envDuration("SNIFFER_WRITE_WINDOW", sniffer.DefaultWriteWindow), "How long the sniffer coalesces "+
+			"observations of a function before writing it, 0 writes synchronously. Or set SNIFFER_WRITE_WINDOW env var.")
+	flag.BoolVar(&validateOnly, "validate-only", false, "If set, the flags, the environment and the configuration "+
+		"file are validated and the manager exits without starting, with a non-zero status on problems.")
 	flag.StringVar(&webserverAddr, "webserver-bind-address", ":8090", "The address the webserver binds to.")
 
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
@@ -118,6 +179,8 @@ func main() {
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
 	flag.StringVar(&metricsCertPath, "metrics-cert-path", "",
 		"The directory that contains the metrics server certificate.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", envBool("ENABLE_WEBHOOKS", false), "If set, the admission "+
+		"webhooks validating the resources are served by the webhook server. Or set ENABLE_WEBHOOKS env var.")
 	flag.StringVar(&webhookCertKey, "webhook-cert-key", "tls.key", "The name of the webhook key file.")
 	flag.StringVar(&webhookCertName, "webhook-cert-name", "tls.crt", "The name of the webhook certificate file.")
 	flag.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
@@ -132,6 +195,47 @@ func main() {
 		panic(err)
 	}
 
+	// Every problem of the configuration is reported at once, before anything
+	// starts.
+	controllerNamespace := controller.ControllerNamespace()
+	startupConfig := startup.Config{
+		AccessLogFormat:               accessLogFormat,
+		AccessLogSampleRate:           accessLogSampleRate,
+		CacheAddr:                     cacheAddr,
+		ConfigFile:                    configFile,
+		ControllerNamespace:           controllerNamespace,
+		FocalHost:                     focalHost,
+		MetricsAddr:                   metricsAddr,
+		MetricsCertKey:                metricsCertKey,
+		MetricsCertName:               metricsCertName,
+		MetricsCertPath:               metricsCertPath,
+		MiddlewarePluginDir:           middlewarePluginDir,
+		OTLPEndpoint:                  otlpEndpoint,
+		PprofAddr:                     pprofAddr,
+		ProbeAddr:                     probeAddr,
+		RequeueDelaySeconds:           requeueDelaySeconds,
+		SnifferHistorySize:            snifferHistorySize,
+		SnifferSchemaConflictStrategy: snifferSchemaConflictStrategy,
+		SnifferUpstream:               snifferUpstream,
+		SnifferWriteWindow:            snifferWriteWindow,
+		WebhookCertKey:                webhookCertKey,
+		WebhookCertName:               webhookCertName,
+		WebhookCertPath:               webhookCertPath,
+		WebserverAddr:                 webserverAddr,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		startupConfig.ConfigFileSet = startupConfig.ConfigFileSet || f.Name == "config-file"
+	})
+	conf, err := startupConfig.Validate(scheme)
+	if err != nil {
+		fmt.Fprint(os.Stderr, startup.Report(err))
+		os.Exit(1)
+	}
+	if validateOnly {
+		fmt.Println("the configuration is valid")
+		os.Exit(0)
+	}
+
 	if zapEncoderEnv := os.Getenv("ZAP_ENCODER"); zapEncoderEnv != "" {
 		enc := flag.CommandLine.Lookup("zap-encoder")
 		if enc != nil {
@@ -176,6 +280,15 @@ func main() {
 
 	setupLog.Info("named log levels", "levels", namedLogLevels)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), otlpEndpoint)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	if otlpEndpoint != "" {
+		setupLog.Info("Exporting traces", "otlp-endpoint", otlpEndpoint)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -191,23 +304,37 @@ func main() {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
+	// The webhook and metrics certificates are reloaded by their watchers when
+	// they rotate, and their expiry is reported on the host.
+	certificates := controller.NewCertificates()
+	var metricsCertWatcher, webhookCertWatcher *certwatcher.CertWatcher
+
 	// Initial webhook TLS options
-	webhookTLSOpts := tlsOpts
-	webhookServerOptions := webhook.Options{
-		TLSOpts: webhookTLSOpts,
-	}
+	webhookTLSOpts := slices.Clone(tlsOpts)
 
 	if len(webhookCertPath) > 0 {
 		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
 			"webhook-cert-path", webhookCertPath, "webhook-cert-name", webhookCertName,
 			"webhook-cert-key", webhookCertKey)
 
-		webhookServerOptions.CertDir = webhookCertPath
-		webhookServerOptions.CertName = webhookCertName
-		webhookServerOptions.KeyName = webhookCertKey
+		webhookCertWatcher, err = certificates.Watch(
+			"webhook",
+			filepath.Join(webhookCertPath, webhookCertName),
+			filepath.Join(webhookCertPath, webhookCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize webhook certificate watcher")
+			os.Exit(1)
+		}
+
+		webhookTLSOpts = append(webhookTLSOpts, func(c *tls.Config) {
+			c.GetCertificate = webhookCertWatcher.GetCertificate
+		})
 	}
 
-	webhookServer := webhook.NewServer(webhookServerOptions)
+	webhookServer := webhook.NewServer(webhook.Options{
+		TLSOpts: webhookTLSOpts,
+	})
 
 	// Metrics endpoint is enabled in 'config/default/kustomization.yaml'. The Metrics options configure the server.
 	// More info:
@@ -240,12 +367,20 @@ func main() {
 			"metrics-cert-path", metricsCertPath, "metrics-cert-name", metricsCertName,
 			"metrics-cert-key", metricsCertKey)
 
-		metricsServerOptions.CertDir = metricsCertPath
-		metricsServerOptions.CertName = metricsCertName
-		metricsServerOptions.KeyName = metricsCertKey
-	}
+		metricsCertWatcher, err = certificates.Watch(
+			"metrics",
+			filepath.Join(metricsCertPath, metricsCertName),
+			filepath.Join(metricsCertPath, metricsCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize metrics certificate watcher")
+			os.Exit(1)
+		}
 
-	controllerNamespace := controller.ControllerNamespace()
+		metricsServerOptions.TLSOpts = append(slices.Clone(tlsOpts), func(c *tls.Config) {
+			c.GetCertificate = metricsCertWatcher.GetCertificate
+		})
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Controller: config.Controller{
@@ -257,13 +392,34 @@ func main() {
 		Metrics:                metricsServerOptions,
 		Scheme:                 scheme,
 		WebhookServer:          webhookServer,
+		// The events are only listed for the support bundles, they are not
+		// worth a cache.
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				DisableFor: []client.Object{&eventsv1.Event{}},
+			},
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	conf := configuration.LoadConfiguration(configFile, scheme)
+	if metricsCertWatcher != nil {
+		setupLog.Info("Adding metrics certificate watcher to manager")
+		if err := mgr.Add(metricsCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add metrics certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	if webhookCertWatcher != nil {
+		setupLog.Info("Adding webhook certificate watcher to manager")
+		if err := mgr.Add(webhookCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add webhook certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
 
 	var cacheManager cache.CacheManager
 	if cacheAddr != "" {
@@ -279,15 +435,42 @@ func main() {
 	}
 
 	hostHandler := host.NewHostHandler(mgr.GetClient(), focalHost, controllerNamespace, logger.WithName("host"), cacheManager)
+	strategy, err := sniffer.ParseSchemaConflictStrategy(snifferSchemaConflictStrategy)
+	if err != nil {
+		setupLog.Error(err, "invalid sniffer schema conflict strategy")
+		os.Exit(1)
+	}
+	hostHandler.GraphQL = graphQL
+	hostHandler.MiddlewarePluginDir = middlewarePluginDir
+	hostHandler.MockFunctions = mockFunctions
+	hostHandler.SnifferHistorySize = snifferHistorySize
+	hostHandler.SnifferSchemaConflictStrategy = strategy
+	hostHandler.SnifferWriteWindow = snifferWriteWindow
+
+	if snifferUpstream != "" {
+		upstream, err := url.Parse(snifferUpstream)
+		if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+			setupLog.Error(err, "invalid sniffer upstream", "sniffer-upstream", snifferUpstream)
+			os.Exit(1)
+		}
+		hostHandler.SnifferUpstream = upstream
+		setupLog.Info("Forwarding unmatched requests", "sniffer-upstream", snifferUpstream)
+	}
+	if accessLogFormat, err = middleware.ParseAccessLogFormat(accessLogFormat); err != nil {
+		setupLog.Error(err, "invalid access log format")
+		os.Exit(1)
+	}
 	requeueDelay := time.Duration(requeueDelaySeconds) * time.Second
 
 	if err := (&controller.KDexInternalHostReconciler{
+		Certificates:        certificates,
 		Client:              mgr.GetClient(),
 		ControllerNamespace: controllerNamespace,
 		Configuration:       conf,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
 		Port:                webserverPort(webserverAddr),
+		Recorder:            mgr.GetEventRecorder("kdexinternalhost"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              mgr.GetScheme(),
 		ServiceName:         serviceName,
@@ -300,6 +483,7 @@ func main() {
 		Configuration:       conf,
 		ControllerNamespace: controllerNamespace,
 		FocalHost:           focalHost,
+		Recorder:            mgr.GetEventRecorder("kdexinternalpackagereferences"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
@@ -311,6 +495,7 @@ func main() {
 		ControllerNamespace: controllerNamespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            mgr.GetEventRecorder("kdexinternaltranslation"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
@@ -323,6 +508,7 @@ func main() {
 		ControllerNamespace: controllerNamespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            mgr.GetEventRecorder("kdexinternalutilitypage"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
@@ -335,6 +521,7 @@ func main() {
 		ControllerNamespace: controllerNamespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            mgr.GetEventRecorder("kdexpagebinding"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
@@ -345,12 +532,31 @@ func main() {
 		Client:        mgr.GetClient(),
 		Configuration: conf,
 		HostHandler:   hostHandler,
+		Recorder:      mgr.GetEventRecorder("kdexfunction"),
 		RequeueDelay:  requeueDelay,
 		Scheme:        mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KDexFunction")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err := webhookv1alpha1.SetupKDexFunctionWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KDexFunction")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupBackendWebhooksWithManager(mgr, conf.BackendDefault); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Backend")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupKDexInternalHostWebhookWithManager(mgr, conf.BackendDefault); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KDexInternalHost")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupKDexPageBindingWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KDexPageBinding")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -363,7 +569,7 @@ func main() {
 	}
 
 	if pprofAddr != "" && strings.Contains(pprofAddr, ":") {
-		setupLog.Info("starting pprof server", "address", pprofAddr)
+		setupLog.Info("starting pprof server, deprecated in favor of the kdex.dev/profiling annotation of the host", "address", pprofAddr)
 		go func() {
 			runtime.SetBlockProfileRate(1)
 			log.Println(http.ListenAndServe(pprofAddr, nil))
@@ -372,7 +578,12 @@ func main() {
 
 	ctx := ctrl.SetupSignalHandler()
 
-	srv := server.New(webserverAddr, hostHandler)
+	srv := server.New(webserverAddr, hostHandler, &middleware.AccessLog{
+		Exclude:    middleware.ParseAccessLogExclude(accessLogExclude),
+		Format:     accessLogFormat,
+		SampleRate: accessLogSampleRate,
+		Writer:     os.Stdout,
+	})
 
 	go func() {
 		setupLog.Info("starting web server")
@@ -396,6 +607,12 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		setupLog.Error(err, "problem flushing traces")
+	}
 }
 
 func loadLogLevelsFromEnv(namedLogLevelPairs *kdexlog.NamedLogLevelPairs) error {
@@ -425,3 +642,39 @@ func webserverPort(address string) int32 {
 
 	return int32(i)
 }
+
+func envBool(name string, fallback bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+
+	return b
+}
+
+func envInt(name string, fallback int) int {
+	i, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+
+	return i
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+
+	return d
+}
+
+func envFloat(name string, fallback float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return fallback
+	}
+
+	return f
+}
@@ -0,0 +1,249 @@
+// Package a11y audits rendered pages for accessibility issues. It is a pure
+// Go heuristic pass over the HTML after the rules of axe-core, which does not
+// see what scripts add to the page.
+package a11y
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Impact is the severity of a violation, after axe-core.
+type Impact string
+
+const (
+	ImpactCritical Impact = "critical"
+	ImpactSerious  Impact = "serious"
+	ImpactModerate Impact = "moderate"
+	ImpactMinor    Impact = "minor"
+)
+
+// Violation is an element of a page breaking a rule.
+type Violation struct {
+	Impact  Impact `json:"impact"`
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
+	Target  string `json:"target"`
+}
+
+// Blocking reports whether one of the violations is critical or serious.
+func Blocking(violations []Violation) bool {
+	return slices.ContainsFunc(violations, func(v Violation) bool {
+		return v.Impact == ImpactCritical || v.Impact == ImpactSerious
+	})
+}
+
+// Summary returns the rules of the violations with their count, e.g.
+// "image-alt:2,label:1".
+func Summary(violations []Violation) string {
+	counts := map[string]int{}
+	rules := []string{}
+	for _, v := range violations {
+		if counts[v.Rule] == 0 {
+			rules = append(rules, v.Rule)
+		}
+		counts[v.Rule]++
+	}
+	slices.Sort(rules)
+	pairs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", rule, counts[rule]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Audit returns the violations of the document.
+func Audit(document string) ([]Violation, error) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+
+	a := &auditor{
+		ids:    map[string]int{},
+		labels: map[string]bool{},
+	}
+	a.collect(root)
+	a.walk(root, false)
+
+	if !a.title {
+		a.report(ImpactSerious, "document-title", "html", "The document has no title")
+	}
+	for _, id := range slices.Sorted(maps.Keys(a.ids)) {
+		if count := a.ids[id]; count > 1 {
+			a.report(ImpactMinor, "duplicate-id", "#"+id, fmt.Sprintf("The id is used by %d elements", count))
+		}
+	}
+
+	slices.SortStableFunc(a.violations, func(x, y Violation) int {
+		return strings.Compare(x.Rule, y.Rule)
+	})
+	return a.violations, nil
+}
+
+type auditor struct {
+	heading    int
+	ids        map[string]int
+	labels     map[string]bool
+	title      bool
+	violations []Violation
+}
+
+// collect gathers the ids of the document and the controls labelled by a
+// <label for>.
+func (a *auditor) collect(n *html.Node) {
+	if n.Type == html.ElementNode {
+		if id := attr(n, "id"); id != "" {
+			a.ids[id]++
+		}
+		if n.DataAtom == atom.Label && attr(n, "for") != "" {
+			a.labels[attr(n, "for")] = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		a.collect(c)
+	}
+}
+
+func (a *auditor) walk(n *html.Node, inLabel bool) {
+	if n.Type == html.ElementNode {
+		if attr(n, "aria-hidden") == "true" {
+			return
+		}
+		a.check(n, inLabel)
+		if n.DataAtom == atom.Label {
+			inLabel = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		a.walk(c, inLabel)
+	}
+}
+
+func (a *auditor) check(n *html.Node, inLabel bool) {
+	switch n.DataAtom {
+	case atom.Html:
+		if strings.TrimSpace(attr(n, "lang")) == "" {
+			a.report(ImpactSerious, "html-has-lang", target(n), "The html element has no lang attribute")
+		}
+	case atom.Title:
+		if strings.TrimSpace(text(n)) != "" {
+			a.title = true
+		}
+	case atom.Img:
+		if !hasAttr(n, "alt") && !labelled(n) && !presentational(n) {
+			a.report(ImpactCritical, "image-alt", target(n), "The image has no alt text")
+		}
+	case atom.Input, atom.Select, atom.Textarea:
+		if n.DataAtom == atom.Input {
+			switch strings.ToLower(attr(n, "type")) {
+			case "hidden", "submit", "reset", "button", "image":
+				return
+			}
+		}
+		if !inLabel && !labelled(n) && !a.labels[attr(n, "id")] {
+			a.report(ImpactCritical, "label", target(n), "The form control has no label")
+		}
+	case atom.Button:
+		if !labelled(n) && strings.TrimSpace(text(n)) == "" {
+			a.report(ImpactCritical, "button-name", target(n), "The button has no discernible text")
+		}
+	case atom.A:
+		if hasAttr(n, "href") && !labelled(n) && strings.TrimSpace(text(n)) == "" {
+			a.report(ImpactSerious, "link-name", target(n), "The link has no discernible text")
+		}
+	case atom.Iframe:
+		if strings.TrimSpace(attr(n, "title")) == "" && !labelled(n) {
+			a.report(ImpactSerious, "frame-title", target(n), "The frame has no title")
+		}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if a.heading > 0 && level > a.heading+1 {
+			a.report(ImpactModerate, "heading-order", target(n), fmt.Sprintf("The heading skips from level %d to %d", a.heading, level))
+		}
+		a.heading = level
+		if !labelled(n) && strings.TrimSpace(text(n)) == "" {
+			a.report(ImpactMinor, "empty-heading", target(n), "The heading has no text")
+		}
+	}
+}
+
+func (a *auditor) report(impact Impact, rule string, target string, message string) {
+	a.violations = append(a.violations, Violation{Impact: impact, Message: message, Rule: rule, Target: target})
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	return slices.ContainsFunc(n.Attr, func(a html.Attribute) bool { return a.Key == key })
+}
+
+// labelled reports whether the element is named by an aria attribute or a
+// title.
+func labelled(n *html.Node) bool {
+	for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+		if strings.TrimSpace(attr(n, key)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func presentational(n *html.Node) bool {
+	role := attr(n, "role")
+	return role == "presentation" || role == "none"
+}
+
+// text returns the text of the element as read by assistive technologies,
+// including the alt text of its images.
+func text(n *html.Node) string {
+	var b strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && attr(n, "aria-hidden") == "true":
+			return
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			b.WriteString(attr(n, "alt"))
+		case n.Type == html.ElementNode && labelled(n) && n.DataAtom != atom.Title:
+			b.WriteString(attr(n, "aria-label") + attr(n, "title"))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+// target returns a selector of the element.
+func target(n *html.Node) string {
+	selector := n.Data
+	switch {
+	case attr(n, "id") != "":
+		selector += "#" + attr(n, "id")
+	case attr(n, "name") != "":
+		selector += fmt.Sprintf("[name=%q]", attr(n, "name"))
+	case attr(n, "src") != "":
+		selector += fmt.Sprintf("[src=%q]", attr(n, "src"))
+	case attr(n, "href") != "":
+		selector += fmt.Sprintf("[href=%q]", attr(n, "href"))
+	case strings.TrimSpace(attr(n, "class")) != "":
+		selector += "." + strings.Fields(attr(n, "class"))[0]
+	}
+	return selector
+}
@@ -0,0 +1,94 @@
+package a11y
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{
+			name: "accessible page",
+			document: `<!DOCTYPE html><html lang="en"><head><title>Shop</title></head><body>
+<h1>Shop</h1><h2>Cart</h2>
+<img src="/logo.png" alt="Acme">
+<img src="/divider.png" alt="">
+<img src="/spacer.gif" role="presentation">
+<label for="q">Search</label><input id="q" type="search">
+<label>Email <input type="email" name="email"></label>
+<input type="hidden" name="csrf">
+<select aria-label="Currency"></select>
+<button><img src="/cart.svg" alt="Cart"></button>
+<a href="/">Home</a>
+<a href="/account" aria-label="Account"><svg></svg></a>
+<iframe src="/map" title="Store map"></iframe>
+<div aria-hidden="true"><img src="/deco.png"></div>
+</body></html>`,
+		},
+		{
+			name:     "missing lang and title",
+			document: `<html><head></head><body><p>Hello</p></body></html>`,
+			want:     []string{"document-title", "html-has-lang"},
+		},
+		{
+			name: "unnamed elements",
+			document: `<html lang="en"><head><title>Shop</title></head><body>
+<img src="/logo.png">
+<input type="text" name="q">
+<textarea id="comment"></textarea>
+<button class="icon close"></button>
+<a href="/cart"><i class="icon-cart"></i></a>
+<iframe src="/map"></iframe>
+</body></html>`,
+			want: []string{"button-name", "frame-title", "image-alt", "label", "label", "link-name"},
+		},
+		{
+			name: "headings and ids",
+			document: `<html lang="en"><head><title>Shop</title></head><body>
+<h1 id="top">Shop</h1><h3>Deals</h3><h2></h2><p id="top">Again</p>
+</body></html>`,
+			want: []string{"duplicate-id", "empty-heading", "heading-order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := Audit(tt.document)
+			require.NoError(t, err)
+
+			rules := []string{}
+			for _, v := range violations {
+				rules = append(rules, v.Rule)
+			}
+			if tt.want == nil {
+				tt.want = []string{}
+			}
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestAuditTargets(t *testing.T) {
+	violations, err := Audit(`<html lang="en"><head><title>Shop</title></head><body><img src="/logo.png"><input name="q"></body></html>`)
+	require.NoError(t, err)
+	require.Len(t, violations, 2)
+	assert.Equal(t, Violation{Impact: ImpactCritical, Message: "The image has no alt text", Rule: "image-alt", Target: `img[src="/logo.png"]`}, violations[0])
+	assert.Equal(t, `input[name="q"]`, violations[1].Target)
+}
+
+func TestBlockingAndSummary(t *testing.T) {
+	minor := []Violation{{Impact: ImpactMinor, Rule: "duplicate-id"}, {Impact: ImpactModerate, Rule: "heading-order"}}
+	assert.False(t, Blocking(minor))
+	assert.False(t, Blocking(nil))
+
+	serious := append(minor, Violation{Impact: ImpactSerious, Rule: "link-name"}, Violation{Impact: ImpactSerious, Rule: "link-name"})
+	assert.True(t, Blocking(serious))
+	assert.Equal(t, "duplicate-id:1,heading-order:1,link-name:2", Summary(serious))
+	assert.Equal(t, "", Summary(nil))
+}
@@ -0,0 +1,265 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// RetentionCompliance locks the objects until their retention ends, for
+	// every user of the bucket.
+	RetentionCompliance = "COMPLIANCE"
+	// RetentionGovernance locks the objects until their retention ends, but
+	// for the users allowed to bypass the governance retention.
+	RetentionGovernance = "GOVERNANCE"
+
+	maxObjectSize = 32 << 20
+)
+
+// ErrNotFound is returned for the objects which are not in the bucket.
+var ErrNotFound = errors.New("object not found")
+
+// Store is a bucket, with object lock enabled, of an S3 compatible storage.
+// Its objects are addressed by path, e.g. https://s3.example.com/bucket/key.
+type Store struct {
+	AccessKeyID     string
+	Bucket          string
+	Client          *http.Client
+	Endpoint        *url.URL
+	Region          string
+	SecretAccessKey string
+}
+
+// Lock is the write once read many protection of an object: its retention
+// until a time, in a mode, and its legal hold, which protects it until it is
+// released regardless of its retention.
+type Lock struct {
+	LegalHold bool
+	Mode      string
+	Until     time.Time
+}
+
+// Object is an object of the bucket as listed.
+type Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+// Put writes the object, locked, with the user metadata.
+func (s *Store) Put(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string, lock Lock) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	for name, value := range metadata {
+		header.Set("X-Amz-Meta-"+name, value)
+	}
+	if lock.Mode != "" {
+		header.Set("X-Amz-Object-Lock-Mode", lock.Mode)
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", lock.Until.UTC().Format(time.RFC3339))
+	}
+	if lock.LegalHold {
+		header.Set("X-Amz-Object-Lock-Legal-Hold", "ON")
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return expectStatus(resp, http.StatusOK)
+}
+
+// Exists returns whether the object is in the bucket.
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return true, expectStatus(resp, http.StatusOK)
+}
+
+// Get reads the object and its content type.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// List returns the objects whose key starts with the prefix.
+func (s *Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		page := struct {
+			Contents              []Object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}{}
+		err = expectStatus(resp, http.StatusOK)
+		if err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&page)
+		}
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects of %s: %w", prefix, err)
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// LegalHold returns whether the object is under a legal hold.
+func (s *Store) LegalHold(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, url.Values{"legal-hold": {""}}, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		// The objects which never had a legal hold have no legal hold
+		// configuration, unless they are missing.
+		exists, err := s.Exists(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, ErrNotFound
+		}
+		return false, nil
+	}
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return false, err
+	}
+	hold := legalHold{}
+	if err := xml.NewDecoder(resp.Body).Decode(&hold); err != nil {
+		return false, fmt.Errorf("failed to read legal hold of %s: %w", key, err)
+	}
+	return hold.Status == "ON", nil
+}
+
+// SetLegalHold places the object under a legal hold, or releases it.
+func (s *Store) SetLegalHold(ctx context.Context, key string, on bool) error {
+	hold := legalHold{Status: "OFF"}
+	if on {
+		hold.Status = "ON"
+	}
+	body, err := xml.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	resp, err := s.do(ctx, http.MethodPut, key, url.Values{"legal-hold": {""}}, header, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return expectStatus(resp, http.StatusOK)
+}
+
+type legalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Status  string   `xml:"Status"`
+}
+
+// do sends the signed request for the object of the key, or for the bucket
+// when the key is empty. The writes carry the Content-MD5 the object lock
+// requires.
+func (s *Store) do(ctx context.Context, method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	u.RawPath = ""
+	u.RawQuery = encodeQuery(query)
+
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if body != nil {
+		sum := md5.Sum(body)
+		r.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	signV4(r, hashHex(body), s.AccessKeyID, s.SecretAccessKey, s.Region, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", method, u.Redacted(), err)
+	}
+	return resp, nil
+}
+
+// encodeQuery encodes the query, the parameters without value, the
+// subresources e.g. legal-hold, by their name only.
+func encodeQuery(query url.Values) string {
+	params := []string{}
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		for _, value := range query[key] {
+			if value == "" {
+				params = append(params, url.QueryEscape(key))
+			} else {
+				params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+			}
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func expectStatus(resp *http.Response, status int) error {
+	if resp.StatusCode == status {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	detail := struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}{}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&detail)
+	return fmt.Errorf("%s %s: %s %s %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, detail.Code, detail.Message)
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBucket is an S3 bucket with object lock enabled holding its objects in
+// memory.
+type fakeBucket struct {
+	holds   map[string]string
+	locks   map[string]http.Header
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/records/")
+	_, holdRequest := r.URL.Query()["legal-hold"]
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []Object `xml:"Contents"`
+		}{}
+		for k, body := range b.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, Object{Key: k, LastModified: time.Now().UTC(), Size: int64(len(body))})
+			}
+		}
+		slices.SortFunc(result.Contents, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if holdRequest {
+			if _, ok := b.objects[key]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			hold := legalHold{}
+			_ = xml.Unmarshal(body, &hold)
+			b.holds[key] = hold.Status
+			return
+		}
+		if _, ok := b.objects[key]; ok && b.locks[key].Get("X-Amz-Object-Lock-Mode") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b.objects[key] = body
+		b.types[key] = r.Header.Get("Content-Type")
+		b.locks[key] = r.Header.Clone()
+		if hold := r.Header.Get("X-Amz-Object-Lock-Legal-Hold"); hold != "" {
+			b.holds[key] = hold
+		}
+	case r.Method == http.MethodGet && holdRequest:
+		hold, ok := b.holds[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = xml.NewEncoder(w).Encode(legalHold{Status: hold})
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		body, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", b.types[key])
+		_, _ = w.Write(body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeStore(t *testing.T) (*Store, *fakeBucket) {
+	bucket := &fakeBucket{
+		holds:   map[string]string{},
+		locks:   map[string]http.Header{},
+		objects: map[string][]byte{},
+		types:   map[string]string{},
+	}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+	endpoint, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return &Store{
+		AccessKeyID:     "key",
+		Bucket:          "records",
+		Endpoint:        endpoint,
+		Region:          "eu-west-1",
+		SecretAccessKey: "secret",
+	}, bucket
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store, bucket := newFakeStore(t)
+
+	exists, err := store.Exists(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	until := time.Date(2033, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Put(ctx, "shop/home/en/a.html", []byte("<html></html>"), "text/html", map[string]string{"Page": "home"}, Lock{
+		Mode:  RetentionCompliance,
+		Until: until,
+	}))
+	lock := bucket.locks["shop/home/en/a.html"]
+	assert.Equal(t, RetentionCompliance, lock.Get("X-Amz-Object-Lock-Mode"))
+	assert.Equal(t, "2033-01-01T00:00:00Z", lock.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	assert.Equal(t, "home", lock.Get("X-Amz-Meta-Page"))
+
+	assert.Error(t, store.Put(ctx, "shop/home/en/a.html", []byte("altered"), "text/html", nil, Lock{}), "the object is locked")
+
+	exists, err = store.Exists(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	body, contentType, err := store.Get(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<html></html>", string(body))
+	assert.Equal(t, "text/html", contentType)
+
+	_, _, err = store.Get(ctx, "shop/home/en/b.html")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Put(ctx, "shop/about/en/b.html", []byte("<html></html>"), "text/html", nil, Lock{LegalHold: true}))
+	objects, err := store.List(ctx, "shop/home/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "shop/home/en/a.html", objects[0].Key)
+	assert.Equal(t, int64(13), objects[0].Size)
+
+	held, err := store.LegalHold(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.False(t, held, "no legal hold configuration")
+	held, err = store.LegalHold(ctx, "shop/about/en/b.html")
+	require.NoError(t, err)
+	assert.True(t, held)
+	_, err = store.LegalHold(ctx, "shop/home/en/b.html")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.SetLegalHold(ctx, "shop/home/en/a.html", true))
+	held, err = store.LegalHold(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.True(t, held)
+	require.NoError(t, store.SetLegalHold(ctx, "shop/home/en/a.html", false))
+	held, err = store.LegalHold(ctx, "shop/home/en/a.html")
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	store.SecretAccessKey = ""
+	store.AccessKeyID = "other"
+	_, err = store.Exists(ctx, "shop/home/en/a.html")
+	assert.ErrorContains(t, err, "403")
+}
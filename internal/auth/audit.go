@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// AuditAnnotation holds, on a host, the JSON encoded configuration of its
+	// security audit log, e.g. {"categories": ["access", "login"],
+	// "sink": "webhook", "webhook": "https://siem.example.com/hooks/audit"}.
+	// The sink is one of AuditSinkStdout, the default, AuditSinkWebhook and
+	// AuditSinkEvents. Every category is audited when none is listed.
+	AuditAnnotation = "kdex.dev/audit"
+
+	// AuditSinkEvents records the audit events as Kubernetes Events of the
+	// host.
+	AuditSinkEvents = "events"
+	// AuditSinkStdout writes the audit events to stdout, one JSON object per
+	// line.
+	AuditSinkStdout = "stdout"
+	// AuditSinkWebhook posts each audit event, JSON encoded, to the webhook of
+	// the configuration.
+	AuditSinkWebhook = "webhook"
+
+	// AuditOutcomeFailure is the outcome of the denied or failed operations.
+	AuditOutcomeFailure = "failure"
+	// AuditOutcomeSuccess is the outcome of the operations that succeeded.
+	AuditOutcomeSuccess = "success"
+
+	// auditEventNoteMaxLength is the longest note of a Kubernetes Event.
+	auditEventNoteMaxLength = 1024
+	// auditWebhookConcurrency bounds the events posted to a webhook at once,
+	// the events beyond it are dropped rather than slowing the requests down,
+	// logged and counted by kdex_host_audit_events_dropped_total.
+	auditWebhookConcurrency = 16
+	auditWebhookTimeout     = 10 * time.Second
+)
+
+// AuditCategory is a class of audit events a host audits or not.
+type AuditCategory string
+
+const (
+	// AuditCategoryAccess are the requests denied by an authorization check.
+	AuditCategoryAccess AuditCategory = "access"
+	// AuditCategoryImpersonation are the impersonations and the requests made
+	// with their tokens.
+	AuditCategoryImpersonation AuditCategory = "impersonation"
+	// AuditCategoryLogin are the successful, failed and locked out logins.
+	AuditCategoryLogin AuditCategory = "login"
+	// AuditCategoryRevocation are the revocations of tokens and sessions,
+	// back-channel logouts included.
+	AuditCategoryRevocation AuditCategory = "revocation"
+	// AuditCategoryToken are the tokens issued, exchanged and refreshed at the
+	// token endpoint, and the requests it rejected.
+	AuditCategoryToken AuditCategory = "token"
+)
+
+var auditCategories = []AuditCategory{
+	AuditCategoryAccess,
+	AuditCategoryImpersonation,
+	AuditCategoryLogin,
+	AuditCategoryRevocation,
+	AuditCategoryToken,
+}
+
+// Audit is the configuration of the security audit log of a host.
+type Audit struct {
+	Categories []AuditCategory `json:"categories,omitempty"`
+	Sink       string          `json:"sink,omitempty"`
+	Webhook    string          `json:"webhook,omitempty"`
+}
+
+// ParseAudit returns the configuration of AuditAnnotation, with its
+// defaults, nil when it is not set.
+func ParseAudit(annotations map[string]string) (*Audit, error) {
+	value := annotations[AuditAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	audit := &Audit{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(audit); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", AuditAnnotation, err)
+	}
+
+	for _, category := range audit.Categories {
+		if !slices.Contains(auditCategories, category) {
+			return nil, fmt.Errorf("invalid %s annotation: unknown category %q, expected one of %v", AuditAnnotation, category, auditCategories)
+		}
+	}
+
+	if audit.Sink == "" {
+		audit.Sink = AuditSinkStdout
+	}
+	switch audit.Sink {
+	case AuditSinkEvents, AuditSinkStdout:
+		if audit.Webhook != "" {
+			return nil, fmt.Errorf("invalid %s annotation: webhook is only set with the %s sink", AuditAnnotation, AuditSinkWebhook)
+		}
+	case AuditSinkWebhook:
+		if target, err := url.Parse(audit.Webhook); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("invalid %s annotation: webhook must be an http(s) URL, got %q", AuditAnnotation, audit.Webhook)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s annotation: unknown sink %q, expected one of %s, %s or %s", AuditAnnotation, audit.Sink, AuditSinkEvents, AuditSinkStdout, AuditSinkWebhook)
+	}
+	return audit, nil
+}
+
+// NewSink returns the sink of the configuration. The events of
+// AuditSinkEvents are recorded by recorder on object, the host.
+func (a *Audit) NewSink(recorder events.EventRecorder, object runtime.Object) AuditSink {
+	switch a.Sink {
+	case AuditSinkEvents:
+		return &EventsAuditSink{Object: object, Recorder: recorder}
+	case AuditSinkWebhook:
+		return NewWebhookAuditSink(a.Webhook)
+	default:
+		return stdoutAuditSink
+	}
+}
+
+// AuditEvent is an entry of the security audit log of a host.
+type AuditEvent struct {
+	// Actor is the subject acting on behalf of Subject, e.g. the support
+	// staff impersonating it or the admin revoking its sessions.
+	Actor    string            `json:"actor,omitempty"`
+	Category AuditCategory     `json:"category"`
+	Details  map[string]string `json:"details,omitempty"`
+	// Event names what happened, e.g. login_failed.
+	Event   string    `json:"event"`
+	Host    string    `json:"host"`
+	IP      string    `json:"ip,omitempty"`
+	Outcome string    `json:"outcome"`
+	Subject string    `json:"subject,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// AuditSink is where the audit events of a host go.
+type AuditSink interface {
+	Emit(ctx context.Context, event AuditEvent) error
+}
+
+// Auditor records the audit events of the categories audited by a host to
+// its sink. A nil Auditor records nothing.
+type Auditor struct {
+	categories []AuditCategory
+	host       string
+	sink       AuditSink
+}
+
+// NewAuditor returns the auditor of the host recording the events of the
+// categories, of every category when there are none, to the sink.
+func NewAuditor(host string, categories []AuditCategory, sink AuditSink) *Auditor {
+	if len(categories) == 0 {
+		categories = auditCategories
+	}
+	return &Auditor{
+		categories: categories,
+		host:       host,
+		sink:       sink,
+	}
+}
+
+// Audits returns whether the events of the category are recorded.
+func (a *Auditor) Audits(category AuditCategory) bool {
+	return a != nil && slices.Contains(a.categories, category)
+}
+
+// Record emits the event when its category is audited, stamped with the host,
+// the time and the client IP of the context when it has none. The failures of
+// the sink are logged, never returned to the audited operation.
+func (a *Auditor) Record(ctx context.Context, event AuditEvent) {
+	if !a.Audits(event.Category) {
+		return
+	}
+
+	event.Host = a.host
+	if event.IP == "" {
+		event.IP = clientIP(ctx)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if err := a.sink.Emit(ctx, event); err != nil {
+		logf.FromContext(ctx).Error(err, "failed to emit audit event", "category", event.Category, "event", event.Event)
+	}
+}
+
+// auditDetails returns the details of an audit event of the key and value
+// pairs of a log entry, leaving out the nil and empty values.
+func auditDetails(keysAndValues ...any) map[string]string {
+	details := map[string]string{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i+1] == nil {
+			continue
+		}
+		if value := fmt.Sprint(keysAndValues[i+1]); value != "" {
+			details[fmt.Sprint(keysAndValues[i])] = value
+		}
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return details
+}
+
+// auditOutcome returns the outcome of an operation failing with err.
+func auditOutcome(err error) string {
+	if err != nil {
+		return AuditOutcomeFailure
+	}
+	return AuditOutcomeSuccess
+}
+
+var stdoutAuditSink = NewStdoutAuditSink(os.Stdout)
+
+// StdoutAuditSink writes the audit events to a writer, one JSON object per
+// line.
+type StdoutAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutAuditSink returns the sink writing to w.
+func NewStdoutAuditSink(w io.Writer) *StdoutAuditSink {
+	return &StdoutAuditSink{w: w}
+}
+
+func (s *StdoutAuditSink) Emit(ctx context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(s.w).Encode(event)
+}
+
+// WebhookAuditSink posts the audit events to a webhook, in the background so
+// that the audited requests do not wait for it.
+type WebhookAuditSink struct {
+	Client *http.Client
+	URL    string
+
+	inFlight chan struct{}
+}
+
+// NewWebhookAuditSink returns the sink posting to the webhook.
+func NewWebhookAuditSink(webhook string) *WebhookAuditSink {
+	return &WebhookAuditSink{
+		Client:   http.DefaultClient,
+		URL:      webhook,
+		inFlight: make(chan struct{}, auditWebhookConcurrency),
+	}
+}
+
+func (s *WebhookAuditSink) Emit(ctx context.Context, event AuditEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		auditEventsDroppedCounter.WithLabelValues(event.Host, auditDroppedOverflow).Inc()
+		return fmt.Errorf("%d audit events in flight to the webhook, dropped", cap(s.inFlight))
+	}
+
+	// The event outlives the request it was recorded by
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-s.inFlight }()
+		if err := s.post(ctx, body); err != nil {
+			auditEventsDroppedCounter.WithLabelValues(event.Host, auditDroppedFailed).Inc()
+			logf.FromContext(ctx).Error(err, "failed to post audit event", "category", event.Category, "event", event.Event)
+		}
+	}()
+	return nil
+}
+
+func (s *WebhookAuditSink) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, auditWebhookTimeout)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(r)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("the webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// EventsAuditSink records the audit events as Kubernetes Events of Object,
+// warnings for the failures.
+type EventsAuditSink struct {
+	Object   runtime.Object
+	Recorder events.EventRecorder
+}
+
+func (s *EventsAuditSink) Emit(ctx context.Context, event AuditEvent) error {
+	eventType := corev1.EventTypeNormal
+	if event.Outcome == AuditOutcomeFailure {
+		eventType = corev1.EventTypeWarning
+	}
+
+	note := []string{}
+	for _, kv := range [][2]string{{"subject", event.Subject}, {"actor", event.Actor}, {"ip", event.IP}} {
+		if kv[1] != "" {
+			note = append(note, kv[0]+"="+kv[1])
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(event.Details)) {
+		note = append(note, key+"="+event.Details[key])
+	}
+
+	message := strings.Join(note, " ")
+	if len(message) > auditEventNoteMaxLength {
+		message = message[:auditEventNoteMaxLength]
+	}
+	s.Recorder.Eventf(s.Object, nil, eventType, auditEventReason(event.Category), event.Event, "%s", message)
+	return nil
+}
+
+// auditEventReason returns the reason of the Kubernetes Events of the
+// category, e.g. AuditLogin.
+func auditEventReason(category AuditCategory) string {
+	name := string(category)
+	if name == "" {
+		return "Audit"
+	}
+	return "Audit" + strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/sign"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/events"
+	"kdex.dev/crds/api/v1alpha1"
+)
+
+// recordingAuditSink keeps the audit events emitted to it.
+type recordingAuditSink struct {
+	events []AuditEvent
+	mu     sync.Mutex
+}
+
+func (s *recordingAuditSink) Emit(ctx context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingAuditSink) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for _, event := range s.events {
+		names = append(names, string(event.Category)+"/"+event.Event+"/"+event.Outcome)
+	}
+	return names
+}
+
+func TestParseAudit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *Audit
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "defaults", value: `{}`, want: &Audit{Sink: AuditSinkStdout}},
+		{
+			name:  "categories",
+			value: `{"categories": ["access", "login"], "sink": "events"}`,
+			want:  &Audit{Categories: []AuditCategory{AuditCategoryAccess, AuditCategoryLogin}, Sink: AuditSinkEvents},
+		},
+		{
+			name:  "webhook",
+			value: `{"sink": "webhook", "webhook": "https://siem.example.com/hooks/audit"}`,
+			want:  &Audit{Sink: AuditSinkWebhook, Webhook: "https://siem.example.com/hooks/audit"},
+		},
+		{name: "invalid json", value: `{`, wantErr: "invalid kdex.dev/audit annotation"},
+		{name: "unknown field", value: `{"level": "debug"}`, wantErr: "unknown field"},
+		{name: "unknown category", value: `{"categories": ["pages"]}`, wantErr: "unknown category"},
+		{name: "unknown sink", value: `{"sink": "syslog"}`, wantErr: "unknown sink"},
+		{name: "webhook without url", value: `{"sink": "webhook"}`, wantErr: "must be an http(s) URL"},
+		{name: "url without webhook", value: `{"webhook": "https://siem.example.com"}`, wantErr: "only set with the webhook sink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAudit(map[string]string{AuditAnnotation: tt.value})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuditor_Record(t *testing.T) {
+	sink := &recordingAuditSink{}
+	auditor := NewAuditor("shop", []AuditCategory{AuditCategoryLogin}, sink)
+
+	r := httptest.NewRequest(http.MethodPost, "/-/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	auditor.Record(withClientIP(r, nil), AuditEvent{Category: AuditCategoryLogin, Event: "login_failed", Outcome: AuditOutcomeFailure, Subject: "alice"})
+	auditor.Record(context.Background(), AuditEvent{Category: AuditCategoryToken, Event: "token_issued", Outcome: AuditOutcomeSuccess})
+
+	require.Len(t, sink.events, 1, "the categories not audited are left out")
+	event := sink.events[0]
+	assert.Equal(t, "shop", event.Host)
+	assert.Equal(t, "192.0.2.1", event.IP)
+	assert.WithinDuration(t, time.Now(), event.Time, time.Minute)
+
+	assert.True(t, NewAuditor("shop", nil, sink).Audits(AuditCategoryToken), "every category by default")
+
+	var nilAuditor *Auditor
+	assert.False(t, nilAuditor.Audits(AuditCategoryLogin))
+	nilAuditor.Record(context.Background(), event)
+
+	assert.Equal(t, map[string]string{"client_id": "app"}, auditDetails("client_id", "app", "error", nil, "scope", ""))
+	assert.Nil(t, auditDetails("error", nil))
+}
+
+func TestAuditSinks(t *testing.T) {
+	ctx := context.Background()
+	event := AuditEvent{
+		Category: AuditCategoryLogin,
+		Details:  map[string]string{"provider": "google", "error": "invalid"},
+		Event:    "login_failed",
+		Host:     "shop",
+		IP:       "192.0.2.1",
+		Outcome:  AuditOutcomeFailure,
+		Subject:  "alice",
+		Time:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, NewStdoutAuditSink(&out).Emit(ctx, event))
+	var written AuditEvent
+	require.NoError(t, json.Unmarshal(out.Bytes(), &written))
+	assert.Equal(t, event, written)
+	assert.Equal(t, byte('\n'), out.Bytes()[out.Len()-1], "one event per line")
+
+	received := make(chan AuditEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var posted AuditEvent
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+		received <- posted
+	}))
+	defer webhook.Close()
+	require.NoError(t, NewWebhookAuditSink(webhook.URL).Emit(ctx, event))
+	select {
+	case posted := <-received:
+		assert.Equal(t, event, posted)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not posted")
+	}
+
+	full := NewWebhookAuditSink(webhook.URL)
+	for range auditWebhookConcurrency {
+		full.inFlight <- struct{}{}
+	}
+	assert.ErrorContains(t, full.Emit(ctx, event), "dropped", "the events beyond the concurrency are dropped")
+	assert.Equal(t, 1.0, testutil.ToFloat64(auditEventsDroppedCounter.WithLabelValues(event.Host, auditDroppedOverflow)))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	require.NoError(t, NewWebhookAuditSink(failing.URL).Emit(ctx, event))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(auditEventsDroppedCounter.WithLabelValues(event.Host, auditDroppedFailed)) == 1
+	}, 5*time.Second, 10*time.Millisecond, "the events the webhook failed to receive are counted")
+
+	recorder := events.NewFakeRecorder(1)
+	require.NoError(t, (&EventsAuditSink{Recorder: recorder}).Emit(ctx, event))
+	assert.Equal(t, "Warning AuditLogin subject=alice ip=192.0.2.1 error=invalid provider=google", <-recorder.Events)
+
+	event.Outcome = AuditOutcomeSuccess
+	require.NoError(t, (&EventsAuditSink{Recorder: recorder}).Emit(ctx, event))
+	assert.Contains(t, <-recorder.Events, "Normal AuditLogin ")
+}
+
+func TestExchanger_Audit(t *testing.T) {
+	sink := &recordingAuditSink{}
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	cfg.Auditor = NewAuditor("shop", nil, sink)
+	cfg.Impersonation = &Impersonation{Entitlement: "support:impersonate", TTL: time.Minute}
+
+	ex, err := NewExchanger(context.Background(), *cfg, cacheManager, &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			if password != "password" {
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			return jwt.MapClaims{"sub": subject}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = ex.LoginLocal(ctx, "alice", "wrong", "", "", AuthMethodLocal)
+	require.Error(t, err)
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err)
+	_, err = ex.Impersonate(ctx, AuthContext{"sub": "carol", "entitlements": []any{"support:impersonate"}}, "alice", "ticket 42")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"login/login_failed/failure",
+		"login/login_succeeded/success",
+		"impersonation/impersonation_started/success",
+	}, sink.names())
+	assert.Equal(t, "carol", sink.events[2].Actor)
+	assert.Equal(t, "ticket 42", sink.events[2].Details["reason"])
+
+	// The requests made with the token of the impersonation are audited
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	cfg.Auditor.AuditImpersonatedRequest(cfg.WithClientIP(r), r, AuthContext{"sub": "alice"})
+	cfg.Auditor.AuditImpersonatedRequest(cfg.WithClientIP(r), r, AuthContext{"sub": "alice", "act": map[string]any{"sub": "carol"}, "grant_type": GrantTypeImpersonation})
+	require.Len(t, sink.events, 4)
+	assert.Equal(t, "impersonated_request", sink.events[3].Event)
+	assert.Equal(t, "/orders", sink.events[3].Details["path"])
+}
+
+func TestOAuth2_Audit(t *testing.T) {
+	keyPairs := keys.GenerateECDSAKeyPair()
+	signer, _ := sign.NewSigner("aud", time.Hour, "iss", &keyPairs.ActiveKey().Private, keyPairs.ActiveKey().KeyId, nil)
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	sink := &recordingAuditSink{}
+	cfg := Config{
+		ActivePair: keyPairs.ActiveKey(),
+		Auditor:    NewAuditor("shop", []AuditCategory{AuditCategoryRevocation, AuditCategoryToken}, sink),
+		CookieName: "auth_token",
+		KeyPairs:   keyPairs,
+		Clients: map[string]AuthClient{
+			"m2m":    {ClientID: "m2m", ClientSecret: "m2m-secret"},
+			"public": {ClientID: "public", Public: true},
+		},
+		Revocations: NewRevocationList(cacheManager, time.Hour),
+		Signer:      *signer,
+		TokenTTL:    time.Hour,
+	}
+	ex, _ := NewExchanger(context.Background(), cfg, cacheManager, &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": subject}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	})
+	o := &OAuth2{AuthConfig: &cfg, AuthExchanger: ex}
+
+	post := func(handler http.HandlerFunc, form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, "/-/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	user, err := ex.LoginLocal(context.Background(), "joe", "secret", "", "public", AuthMethodOAuth2)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, post(o.OAuth2TokenHandler, url.Values{"grant_type": {"client_credentials"}, "client_id": {"m2m"}, "client_secret": {"m2m-secret"}}))
+	assert.Equal(t, http.StatusBadRequest, post(o.OAuth2TokenHandler, url.Values{"grant_type": {"client_credentials"}, "client_id": {"m2m"}, "client_secret": {"wrong"}}))
+	assert.Equal(t, http.StatusOK, post(o.OAuth2TokenHandler, url.Values{"grant_type": {"refresh_token"}, "client_id": {"public"}, "refresh_token": {user.RefreshToken}}))
+	assert.Equal(t, http.StatusUnauthorized, post(o.OAuth2TokenHandler, url.Values{"grant_type": {"refresh_token"}, "client_id": {"public"}, "refresh_token": {user.RefreshToken}}))
+	assert.Equal(t, http.StatusOK, post(o.RevokeHandler, url.Values{"client_id": {"public"}, "token": {user.AccessToken}}))
+	assert.Equal(t, http.StatusOK, post(o.RevokeHandler, url.Values{"client_id": {"public"}, "token": {"opaque"}}))
+
+	assert.Equal(t, []string{
+		"token/token_issued/success",
+		"token/token_issued/failure",
+		"token/refresh_token_redeemed/success",
+		"token/refresh_token_redeemed/failure",
+		"revocation/token_revoked/success",
+	}, sink.names(), "unknown tokens are not revoked, nor audited")
+	assert.Equal(t, "m2m", sink.events[1].Details["client_id"])
+	assert.Equal(t, "invalid client_secret", sink.events[1].Details["error"])
+	assert.Equal(t, "joe", sink.events[2].Subject)
+}
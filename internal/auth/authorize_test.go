@@ -115,6 +115,7 @@ func TestHostHandler_AuthorizeHandler(t *testing.T) {
 					ProviderURL  string
 					RedirectURL  string
 					Scopes       []string
+					Providers    []OIDCProvider
 				}{
 					BlockKey: "01234567890123456789012345678901", // 32 bytes
 				},
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// BackChannelLogoutEvent is the event of the logout tokens of the OIDC
+	// Back-Channel Logout 1.0.
+	BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// providerSessionMaxTokens is the number of tokens kept by the session
+	// index of a provider session, the latest ones.
+	providerSessionMaxTokens = 64
+)
+
+// logoutTokenClaims are the claims of a logout token checked beyond those of
+// an ID token.
+type logoutTokenClaims struct {
+	Events map[string]json.RawMessage `json:"events"`
+	JTI    string                     `json:"jti"`
+	Nonce  string                     `json:"nonce"`
+	SID    string                     `json:"sid"`
+}
+
+// recordProviderSession indexes the jti of the token minted for the login with
+// the provider, or later minted for the same login, by the sid of the session
+// at the provider and by the subject, for BackChannelLogout to revoke it. The
+// sid of the token is kept for the tokens exchanged for it, see
+// providerSessionID. The tokens of no provider are not indexed.
+func (e *Exchanger) recordProviderSession(ctx context.Context, provider string, subject string, sid string, token string) error {
+	if e.providerSessionCache == nil || provider == "" {
+		return nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return fmt.Errorf("failed to parse minted token: %w", err)
+	}
+	jti, _ := claims["jti"].(string)
+	if err := e.providerSessionCache.Set(ctx, providerSessionKey(provider, "jti", jti), sid); err != nil {
+		return fmt.Errorf("failed to store provider session: %w", err)
+	}
+
+	keys := []string{providerSessionKey(provider, "sub", subject)}
+	if sid != "" {
+		keys = append(keys, providerSessionKey(provider, "sid", sid))
+	}
+	for _, key := range keys {
+		jtis, err := e.providerSessionTokens(ctx, key)
+		if err != nil {
+			return err
+		}
+		jtis = append(jtis, jti)
+		if len(jtis) > providerSessionMaxTokens {
+			jtis = jtis[len(jtis)-providerSessionMaxTokens:]
+		}
+		payload, err := json.Marshal(jtis)
+		if err != nil {
+			return fmt.Errorf("failed to marshal provider session: %w", err)
+		}
+		if err := e.providerSessionCache.Set(ctx, key, string(payload)); err != nil {
+			return fmt.Errorf("failed to store provider session: %w", err)
+		}
+	}
+	return nil
+}
+
+// BackChannelLogout implements the OIDC Back-Channel Logout 1.0: the logout
+// token of the named provider ends the sessions of the host logged in with
+// it, those of its sid when it has one and else every session of its subject.
+// Each logout token is accepted once. The tokens of the sessions are revoked, as are the refresh tokens of the
+// subject issued until then, which are not bound to a session.
+func (e *Exchanger) BackChannelLogout(ctx context.Context, provider string, rawLogoutToken string) error {
+	client, ok := e.oidcClient(provider)
+	if !ok {
+		return fmt.Errorf("OIDC is not configured")
+	}
+
+	// The signature, issuer, audience and expiry are those of an ID token
+	token, err := client.verifier.Verify(ctx, rawLogoutToken)
+	if err != nil {
+		return fmt.Errorf("invalid logout_token: %w", err)
+	}
+
+	var claims logoutTokenClaims
+	if err := token.Claims(&claims); err != nil {
+		return fmt.Errorf("invalid logout_token: %w", err)
+	}
+	if _, ok := claims.Events[BackChannelLogoutEvent]; !ok {
+		return fmt.Errorf("invalid logout_token: no %s event", BackChannelLogoutEvent)
+	}
+	if claims.Nonce != "" {
+		return fmt.Errorf("invalid logout_token: nonce is not allowed")
+	}
+	if token.Subject == "" && claims.SID == "" {
+		return fmt.Errorf("invalid logout_token: sub or sid is required")
+	}
+	if claims.JTI == "" {
+		return fmt.Errorf("invalid logout_token: jti is required")
+	}
+
+	// A logout token is used once, it is kept for the lifetime of the tokens
+	// it would revoke.
+	if e.providerSessionCache != nil {
+		logoutKey := providerSessionKey(provider, "logout", claims.JTI)
+		_, replayed, _, err := e.providerSessionCache.Get(ctx, logoutKey)
+		if err != nil {
+			return fmt.Errorf("failed to read logout token: %w", err)
+		}
+		if replayed {
+			return fmt.Errorf("invalid logout_token: jti already used")
+		}
+		if err := e.providerSessionCache.Set(ctx, logoutKey, claims.SID); err != nil {
+			return fmt.Errorf("failed to store logout token: %w", err)
+		}
+	}
+
+	key := providerSessionKey(provider, "sub", token.Subject)
+	if claims.SID != "" {
+		key = providerSessionKey(provider, "sid", claims.SID)
+	}
+
+	revoked := 0
+	if e.providerSessionCache != nil {
+		jtis, err := e.providerSessionTokens(ctx, key)
+		if err != nil {
+			return err
+		}
+		for _, jti := range jtis {
+			if err := e.config.Revocations.Revoke(ctx, jti); err != nil {
+				return fmt.Errorf("failed to revoke session token: %w", err)
+			}
+		}
+		if err := e.providerSessionCache.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to end provider session: %w", err)
+		}
+		revoked = len(jtis)
+	}
+
+	if token.Subject != "" && e.loggedOutCache != nil {
+		if err := e.loggedOutCache.Set(ctx, providerSessionKey(provider, "sub", token.Subject), strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+			return fmt.Errorf("failed to record the logout of '%s': %w", token.Subject, err)
+		}
+	}
+
+	logf.FromContext(ctx).Info(
+		"OIDC back-channel logout",
+		"provider", provider,
+		"revoked", revoked,
+		"sid", claims.SID,
+		"subject", token.Subject,
+	)
+	e.config.Auditor.Record(ctx, AuditEvent{
+		Category: AuditCategoryRevocation,
+		Details:  auditDetails("provider", provider, "revoked", revoked, "sid", claims.SID),
+		Event:    "backchannel_logout",
+		Outcome:  AuditOutcomeSuccess,
+		Subject:  token.Subject,
+	})
+	return nil
+}
+
+// isLoggedOut returns whether the refresh token was issued to its subject
+// before a back-channel logout of the subject at the provider the subject
+// logged in with. The subjects of the providers, and of the host, are distinct.
+func (e *Exchanger) isLoggedOut(ctx context.Context, claims RefreshTokenClaims) (bool, error) {
+	if e.loggedOutCache == nil || claims.Provider == "" {
+		return false, nil
+	}
+	raw, found, _, err := e.loggedOutCache.Get(ctx, providerSessionKey(claims.Provider, "sub", claims.Subject))
+	if err != nil {
+		return false, fmt.Errorf("failed to read the logout of '%s': %w", claims.Subject, err)
+	}
+	if !found {
+		return false, nil
+	}
+	loggedOutAt, _ := strconv.ParseInt(raw, 10, 64)
+	return claims.IssuedAt <= loggedOutAt, nil
+}
+
+// providerSessionID returns the sid of the session at the provider the token
+// of jti was minted for, empty when it is unknown.
+func (e *Exchanger) providerSessionID(ctx context.Context, provider string, jti string) (string, error) {
+	if e.providerSessionCache == nil {
+		return "", nil
+	}
+	sid, _, _, err := e.providerSessionCache.Get(ctx, providerSessionKey(provider, "jti", jti))
+	if err != nil {
+		return "", fmt.Errorf("failed to read provider session: %w", err)
+	}
+	return sid, nil
+}
+
+func (e *Exchanger) providerSessionTokens(ctx context.Context, key string) ([]string, error) {
+	raw, found, _, err := e.providerSessionCache.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider session: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	var jtis []string
+	if err := json.Unmarshal([]byte(raw), &jtis); err != nil {
+		return nil, fmt.Errorf("failed to parse provider session: %w", err)
+	}
+	return jtis, nil
+}
+
+// idpProvider returns the OIDC provider of the idp claim of a token of the
+// host, "" for the tokens of the other identity providers.
+func idpProvider(idp string) string {
+	if idp == "oidc" {
+		return DefaultOIDCProvider
+	}
+	if name, found := strings.CutPrefix(idp, "oidc:"); found {
+		return name
+	}
+	return ""
+}
+
+func providerSessionKey(provider string, kind string, value string) string {
+	return provider + "/" + kind + "/" + value
+}
+
+func newProviderSessionCaches(cacheManager cache.CacheManager, tokenTTL time.Duration, refreshTokenTTL time.Duration) (cache.Cache, cache.Cache) {
+	return cacheManager.GetCache("oidc-sessions", cache.CacheOptions{
+			TTL:      new(cmp.Or(tokenTTL, time.Hour)),
+			Uncycled: true,
+		}), cacheManager.GetCache("logged-out-subjects", cache.CacheOptions{
+			TTL:      new(refreshTokenTTL),
+			Uncycled: true,
+		})
+}
+
+// BackChannelLogoutPost is the back-channel logout endpoint of the OIDC
+// provider named by the provider path value, or else of the provider of the
+// host, registered at the provider as the backchannel_logout_uri of the host.
+func (o *OAuth2) BackChannelLogoutPost(w http.ResponseWriter, r *http.Request) {
+	log := logf.FromContext(r.Context())
+
+	provider := cmp.Or(r.PathValue("provider"), DefaultOIDCProvider)
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeBackChannelLogoutError(w, "invalid_request", "failed to parse form")
+		return
+	}
+	logoutToken := r.PostFormValue("logout_token")
+	if logoutToken == "" {
+		writeBackChannelLogoutError(w, "invalid_request", "logout_token is required")
+		return
+	}
+
+	if err := o.AuthExchanger.BackChannelLogout(r.Context(), provider, logoutToken); err != nil {
+		log.Error(err, "OIDC back-channel logout failed", "provider", provider)
+		o.AuthConfig.auditor().Record(o.AuthConfig.WithClientIP(r), AuditEvent{
+			Category: AuditCategoryRevocation,
+			Details:  map[string]string{"error": err.Error(), "provider": provider},
+			Event:    "backchannel_logout",
+			Outcome:  AuditOutcomeFailure,
+		})
+		writeBackChannelLogoutError(w, "invalid_request", "invalid logout_token")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeBackChannelLogoutError(w http.ResponseWriter, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/sign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kdex.dev/crds/api/v1alpha1"
+)
+
+func TestExchanger_BackChannelLogout(t *testing.T) {
+	ih := &IH{}
+	server := MockRunningServer(ih)
+	defer server.Close()
+
+	ctx := context.Background()
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{
+			OIDCProvider: &v1alpha1.OIDCProvider{
+				OIDCProviderURL: server.URL,
+			},
+		},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{"app": {ClientID: "app"}}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "foo", "bar", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"foo",
+		server.URL,
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	ih.Handler = MockOIDCProvider(*cfg)
+
+	ex, err := NewExchanger(ctx, *cfg, cacheManager, &mockScopeProvider{
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	})
+	require.NoError(t, err)
+
+	// The tokens of the provider are signed by the keys of the mock provider
+	signed := func(claims jwt.MapClaims) string {
+		claims["aud"] = "foo"
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		claims["iat"] = time.Now().Unix()
+		claims["iss"] = server.URL
+		if _, ok := claims["jti"]; !ok {
+			claims["jti"] = rand.Text()
+		}
+		token, err := sign.SignClaims(cfg.KeyPairs.ActiveKey().Private, cfg.KeyPairs.ActiveKey().KeyId, claims)
+		require.NoError(t, err)
+		return token
+	}
+	login := func(sid string) string {
+		token, err := ex.ExchangeToken(ctx, signed(jwt.MapClaims{"sid": sid, "sub": "joe"}))
+		require.NoError(t, err)
+		claims := jwt.MapClaims{}
+		_, _, err = new(jwt.Parser).ParseUnverified(token, claims)
+		require.NoError(t, err)
+		return claims["jti"].(string)
+	}
+	isRevoked := func(jti string) bool {
+		revoked, err := cfg.Revocations.IsRevoked(ctx, jti)
+		require.NoError(t, err)
+		return revoked
+	}
+	logoutEvent := map[string]any{BackChannelLogoutEvent: map[string]any{}}
+
+	laptop := login("s1")
+	phone := login("s2")
+	refreshToken, err := ex.createRefreshToken(ctx, RefreshTokenClaims{ClientID: "app", Provider: DefaultOIDCProvider, Subject: "joe"}, "")
+	require.NoError(t, err)
+	otherProviderRefreshToken, err := ex.createRefreshToken(ctx, RefreshTokenClaims{ClientID: "app", Provider: "partner", Subject: "joe"}, "")
+	require.NoError(t, err)
+	localRefreshToken, err := ex.createRefreshToken(ctx, RefreshTokenClaims{ClientID: "app", Subject: "joe"}, "")
+	require.NoError(t, err)
+
+	// The sid of the logout token ends its session only
+	require.NoError(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, signed(jwt.MapClaims{"events": logoutEvent, "sid": "s1", "sub": "joe"})))
+	assert.True(t, isRevoked(laptop))
+	assert.False(t, isRevoked(phone))
+
+	// The refresh tokens of the subject are not bound to a session
+	_, found, err := ex.LookupRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, err = ex.RedeemRefreshToken(ctx, refreshToken, "app")
+	assert.ErrorContains(t, err, "refresh token revoked by logout")
+
+	// The subject of the provider is not that of another provider, nor a
+	// local user of the host
+	for _, token := range []string{otherProviderRefreshToken, localRefreshToken} {
+		_, found, err := ex.LookupRefreshToken(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+	}
+
+	// The tokens exchanged for the token of a session end with it
+	tablet, err := ex.ExchangeToken(ctx, signed(jwt.MapClaims{"sid": "s4", "sub": "joe"}))
+	require.NoError(t, err)
+	exchangedClaims, err := cfg.VerifyLocalToken(mustExchangeToken(t, ex, "app", tablet))
+	require.NoError(t, err)
+	require.NoError(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, signed(jwt.MapClaims{"events": logoutEvent, "sid": "s4", "sub": "joe"})))
+	assert.True(t, isRevoked(exchangedClaims["jti"].(string)))
+
+	// The tokens minted later for the login end with its session
+	for _, sid := range []string{"s5", "s6"} {
+		ts, err := ex.mintTokensFromCode(ctx, AuthorizationCodeClaims{ClientID: "app", Provider: DefaultOIDCProvider, ProviderSessionID: sid, Scope: "openid", Subject: "ann"})
+		require.NoError(t, err)
+		codeClaims, err := cfg.VerifyLocalToken(ts.AccessToken)
+		require.NoError(t, err)
+		refreshed, err := ex.RedeemRefreshToken(ctx, ts.RefreshToken, "app")
+		require.NoError(t, err)
+		refreshedClaims, err := cfg.VerifyLocalToken(refreshed.AccessToken)
+		require.NoError(t, err)
+
+		require.NoError(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, signed(jwt.MapClaims{"events": logoutEvent, "sid": sid})))
+		assert.True(t, isRevoked(codeClaims["jti"].(string)), sid)
+		assert.True(t, isRevoked(refreshedClaims["jti"].(string)), sid)
+	}
+
+	// A logout token is used once
+	replayed := signed(jwt.MapClaims{"events": logoutEvent, "sid": "s7"})
+	require.NoError(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, replayed))
+	assert.ErrorContains(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, replayed), "jti already used")
+
+	// A logout token without sid ends every session of its subject
+	require.NoError(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, signed(jwt.MapClaims{"events": logoutEvent, "sub": "joe"})))
+	assert.True(t, isRevoked(phone))
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"no event":       {"sub": "joe"},
+		"nonce":          {"events": logoutEvent, "nonce": "n", "sub": "joe"},
+		"no sub nor sid": {"events": logoutEvent},
+		"no jti":         {"events": logoutEvent, "jti": "", "sub": "joe"},
+	} {
+		assert.ErrorContains(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, signed(claims)), "invalid logout_token", name)
+	}
+	assert.Error(t, ex.BackChannelLogout(ctx, DefaultOIDCProvider, "not-a-token"))
+	assert.Error(t, ex.BackChannelLogout(ctx, "unknown", signed(jwt.MapClaims{"events": logoutEvent, "sub": "joe"})))
+
+	// The endpoint answers the provider
+	o := &OAuth2{AuthConfig: cfg, AuthExchanger: ex}
+	post := func(logoutToken string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/-/oauth/backchannel-logout", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		o.BackChannelLogoutPost(w, r)
+		return w
+	}
+
+	w := post(signed(jwt.MapClaims{"events": logoutEvent, "sid": "s3"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = post("not-a-token")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid_request","error_description":"invalid logout_token"}`, w.Body.String())
+}
+
+func TestIdpProvider(t *testing.T) {
+	assert.Equal(t, DefaultOIDCProvider, idpProvider("oidc"))
+	assert.Equal(t, "partner", idpProvider("oidc:partner"))
+	assert.Empty(t, idpProvider("local"))
+	assert.Empty(t, idpProvider(""))
+}
@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"crypto"
 	"crypto/rand"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/kdex-tech/dmapper"
 	"github.com/kdex-tech/host-manager/internal/auth/idtoken"
 	"github.com/kdex-tech/host-manager/internal/cache"
@@ -14,6 +18,10 @@ import (
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 )
 
+// DefaultOIDCProvider is the name of the OIDC provider of the host, the one
+// called back at /-/oauth/callback, among its named providers.
+const DefaultOIDCProvider = "default"
+
 type AuthClient struct {
 	AllowedGrantTypes []string
 	AllowedScopes     []string
@@ -26,11 +34,26 @@ type AuthClient struct {
 	RequirePKCE       bool
 }
 
+// OIDCProvider is an OIDC provider users of the host log in with.
+type OIDCProvider struct {
+	ClientID     string
+	ClientSecret string
+	// DisplayName labels the provider on the login page.
+	DisplayName string
+	Name        string
+	ProviderURL string
+	RedirectURL string
+	Scopes      []string
+}
+
 type Config struct {
 	ActivePair            *keys.KeyPair
 	AnonymousEntitlements []string
+	Auditor               *Auditor
 	Clients               map[string]AuthClient
+	CookieDomain          string
 	CookieName            string
+	Impersonation         *Impersonation
 	KeyPairs              *keys.KeyPairs
 	OIDC                  struct {
 		BlockKey     string
@@ -40,9 +63,19 @@ type Config struct {
 		ProviderURL  string
 		RedirectURL  string
 		Scopes       []string
+		// Providers are the named providers offered next to the provider of
+		// the host on the login page, each called back at
+		// /-/oauth/callback/{name}.
+		Providers []OIDCProvider
 	}
-	Signer   sign.Signer
-	TokenTTL time.Duration
+	Revocations     *RevocationList
+	ServiceAccounts *ServiceAccountAuthenticator
+	Signer          sign.Signer
+	TokenTTL        time.Duration
+	TrustedIssuers  *TrustedIssuers
+	// TrustedProxies are the proxies whose X-Forwarded-For header gives the
+	// IP of the requests, see ClientIP.
+	TrustedProxies []netip.Prefix
 }
 
 func NewConfig(
@@ -50,6 +83,7 @@ func NewConfig(
 	authClientLoader func() (map[string]AuthClient, error),
 	keyLoader func() (*keys.KeyPairs, error),
 	oidcConfigLoader func() (string, string, string, error),
+	oidcProvidersLoader func() ([]OIDCProvider, string, error),
 	audience string,
 	issuer string,
 	devMode bool,
@@ -112,6 +146,10 @@ func NewConfig(
 		}
 		cfg.Clients = clients
 
+		if cacheManager != nil {
+			cfg.Revocations = NewRevocationList(cacheManager, cfg.TokenTTL)
+		}
+
 		if auth.OIDCProvider != nil && auth.OIDCProvider.OIDCProviderURL != "" {
 			clientID, clientSecret, blockKey, err := oidcConfigLoader()
 			if err != nil {
@@ -126,6 +164,25 @@ func NewConfig(
 			cfg.OIDC.Scopes = auth.OIDCProvider.Scopes
 			cfg.OIDC.IDTokenStore = idtoken.NewCacheIDTokenStore(cacheManager, cfg.TokenTTL)
 		}
+
+		providers, blockKey, err := oidcProvidersLoader()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(providers) > 0 {
+			for i := range providers {
+				providers[i].RedirectURL = "/-/oauth/callback/" + providers[i].Name
+			}
+			cfg.OIDC.Providers = providers
+
+			if cfg.OIDC.BlockKey == "" {
+				cfg.OIDC.BlockKey = getOrGenerate(blockKey)
+			}
+			if cfg.OIDC.IDTokenStore == nil {
+				cfg.OIDC.IDTokenStore = idtoken.NewCacheIDTokenStore(cacheManager, cfg.TokenTTL)
+			}
+		}
 	}
 
 	return cfg, nil
@@ -135,7 +192,15 @@ func (c *Config) AddAuthentication(mux http.Handler) http.Handler {
 	if !c.IsAuthEnabled() {
 		return mux
 	}
-	return WithAuthentication(c.ActivePair.Private.Public(), c.CookieName)(mux)
+	return WithAuthentication(c.LocalKey, c.Signer.Audience(), c.CookieName, c.CookieDomain, c.ServiceAccounts, c.TrustedIssuers, c.Revocations, c.Auditor, c.TrustedProxies)(mux)
+}
+
+// auditor returns the auditor of the config, nil when there is none.
+func (c *Config) auditor() *Auditor {
+	if c == nil {
+		return nil
+	}
+	return c.Auditor
 }
 
 func (c *Config) IsAuthEnabled() bool {
@@ -146,12 +211,38 @@ func (c *Config) IsAuthEnabled() bool {
 }
 
 func (c *Config) IsOIDCEnabled() bool {
-	if c == nil || c.OIDC.ProviderURL == "" {
+	if c == nil || (c.OIDC.ProviderURL == "" && len(c.OIDC.Providers) == 0) {
 		return false
 	}
 	return true
 }
 
+// OIDCProviders returns the OIDC providers of the host, its own provider,
+// named DefaultOIDCProvider, first.
+func (c *Config) OIDCProviders() []OIDCProvider {
+	if !c.IsOIDCEnabled() {
+		return nil
+	}
+
+	providers := []OIDCProvider{}
+	if c.OIDC.ProviderURL != "" {
+		displayName := c.OIDC.ProviderURL
+		if u, err := url.Parse(c.OIDC.ProviderURL); err == nil && u.Host != "" {
+			displayName = u.Host
+		}
+		providers = append(providers, OIDCProvider{
+			ClientID:     c.OIDC.ClientID,
+			ClientSecret: c.OIDC.ClientSecret,
+			DisplayName:  displayName,
+			Name:         DefaultOIDCProvider,
+			ProviderURL:  c.OIDC.ProviderURL,
+			RedirectURL:  c.OIDC.RedirectURL,
+			Scopes:       c.OIDC.Scopes,
+		})
+	}
+	return append(providers, c.OIDC.Providers...)
+}
+
 func (c *Config) IsM2MEnabled() bool {
 	if c == nil || c.ActivePair == nil || len(c.Clients) == 0 {
 		return false
@@ -159,6 +250,41 @@ func (c *Config) IsM2MEnabled() bool {
 	return true
 }
 
+// VerifyLocalToken returns the claims of a token minted by the host, verified
+// with the key pair named by its kid header, see LocalKey.
+func (c *Config) VerifyLocalToken(tokenString string) (jwt.MapClaims, error) {
+	if !c.IsAuthEnabled() {
+		return nil, fmt.Errorf("auth not configured")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.LocalKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// LocalKey returns the public key of the key pair of the host named by kid,
+// so that the tokens signed before a key rotation remain valid until they
+// expire or their retired key is removed.
+func (c *Config) LocalKey(kid string) (crypto.PublicKey, error) {
+	if c.KeyPairs != nil {
+		for _, pair := range *c.KeyPairs {
+			if pair.KeyId == kid {
+				return pair.Private.Public(), nil
+			}
+		}
+	}
+	if c.ActivePair != nil && c.ActivePair.KeyId == kid {
+		return c.ActivePair.Private.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
 func getOrGenerate(blockKey string) string {
 	if blockKey == "" {
 		return rand.Text()
@@ -13,6 +13,7 @@ import (
 	"github.com/kdex-tech/host-manager/internal/cache"
 	"github.com/kdex-tech/host-manager/internal/keys"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"kdex.dev/crds/api/v1alpha1"
@@ -499,6 +500,155 @@ L51w6mkJ5U6GWpH1eZsXgKm0ZZJKEPsN9wYKe2LXT/WPpa5AwGzo7BLm
 				assert.Equal(t, "bar", got.OIDC.ClientSecret)
 			},
 		},
+		{
+			name: "OIDC - constructor, named providers",
+			args: testargs{
+				auth: &v1alpha1.Auth{
+					OIDCProvider: &v1alpha1.OIDCProvider{
+						OIDCProviderURL: "http://bad",
+					},
+				},
+				namespace: "foo",
+				devMode:   true,
+				secrets: kdexv1alpha1.ServiceAccountSecrets{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "keycloak",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client_id":     []byte("corp"),
+							"client_secret": []byte("corp-secret"),
+							"display_name":  []byte("Corporate"),
+							"provider_url":  []byte("http://keycloak"),
+							"scopes":        []byte("groups, offline_access"),
+						},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "foo",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client_secret": []byte("bar"),
+							"client_id":     []byte("foo"),
+						},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "google-client",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client-id":     []byte("google"),
+							"client-secret": []byte("google-secret"),
+							"name":          []byte("google"),
+							"provider-url":  []byte("https://accounts.google.com"),
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, got *Config, gotErr error) {
+				assert.Nil(t, gotErr)
+				assert.Equal(t, "bar", got.OIDC.ClientSecret)
+				assert.Equal(t, []OIDCProvider{
+					{
+						ClientID:     "google",
+						ClientSecret: "google-secret",
+						DisplayName:  "google",
+						Name:         "google",
+						ProviderURL:  "https://accounts.google.com",
+						RedirectURL:  "/-/oauth/callback/google",
+						Scopes:       []string{},
+					},
+					{
+						ClientID:     "corp",
+						ClientSecret: "corp-secret",
+						DisplayName:  "Corporate",
+						Name:         "keycloak",
+						ProviderURL:  "http://keycloak",
+						RedirectURL:  "/-/oauth/callback/keycloak",
+						Scopes:       []string{"groups", "offline_access"},
+					},
+				}, got.OIDC.Providers)
+				providers := got.OIDCProviders()
+				assert.Len(t, providers, 3)
+				assert.Equal(t, DefaultOIDCProvider, providers[0].Name)
+				assert.Equal(t, "bad", providers[0].DisplayName)
+			},
+		},
+		{
+			name: "OIDC - constructor, named providers without the provider of the host",
+			args: testargs{
+				auth:      &v1alpha1.Auth{},
+				namespace: "foo",
+				devMode:   true,
+				secrets: kdexv1alpha1.ServiceAccountSecrets{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "azure",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client_id":     []byte("azure"),
+							"client_secret": []byte("azure-secret"),
+							"provider_url":  []byte("https://login.microsoftonline.com/tenant/v2.0"),
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, got *Config, gotErr error) {
+				assert.Nil(t, gotErr)
+				assert.True(t, got.IsOIDCEnabled())
+				assert.NotEmpty(t, got.OIDC.BlockKey)
+				assert.NotNil(t, got.OIDC.IDTokenStore)
+				assert.Len(t, got.OIDCProviders(), 1)
+				assert.Equal(t, "azure", got.OIDCProviders()[0].Name)
+			},
+		},
+		{
+			name: "OIDC - constructor, named providers with the same name",
+			args: testargs{
+				auth:      &v1alpha1.Auth{},
+				namespace: "foo",
+				devMode:   true,
+				secrets: kdexv1alpha1.ServiceAccountSecrets{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "azure",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client_id":     []byte("azure"),
+							"client_secret": []byte("azure-secret"),
+							"provider_url":  []byte("https://login.microsoftonline.com/tenant/v2.0"),
+						},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "azure-2",
+							Namespace:   "foo",
+							Annotations: map[string]string{"kdex.dev/secret-type": "oidc-client"},
+						},
+						Data: map[string][]byte{
+							"client_id":     []byte("azure"),
+							"client_secret": []byte("azure-secret"),
+							"name":          []byte("azure"),
+							"provider_url":  []byte("https://login.microsoftonline.com/other/v2.0"),
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, got *Config, gotErr error) {
+				assert.NotNil(t, gotErr)
+				assert.Contains(t, gotErr.Error(), "is not unique")
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -516,6 +666,9 @@ L51w6mkJ5U6GWpH1eZsXgKm0ZZJKEPsN9wYKe2LXT/WPpa5AwGzo7BLm
 				func() (string, string, string, error) {
 					return OIDCConfigLoader(tt.args.secrets, tt.args.devMode)
 				},
+				func() ([]OIDCProvider, string, error) {
+					return OIDCProvidersLoader(tt.args.secrets, tt.args.devMode)
+				},
 				"audience",
 				"issuer",
 				tt.args.devMode,
@@ -709,7 +862,7 @@ func TestConfig_AddAuthentication(t *testing.T) {
 					"sub":   "foo",
 					"email": "foo@foo.bar",
 					"iss":   "issuer",
-					"aud":   got.OIDC.ClientID,
+					"aud":   "audience",
 				})
 
 				assert.Nil(t, err)
@@ -719,6 +872,68 @@ func TestConfig_AddAuthentication(t *testing.T) {
 				assert.Equal(t, 200, w.Code)
 			},
 		},
+		{
+			name: "authentication - token of another audience",
+			args: testargs{
+				c:         nil,
+				auth:      &kdexv1alpha1.Auth{},
+				namespace: "foo",
+				devMode:   true,
+			},
+			assertions: func(t *testing.T, got *Config, gotErr error) {
+				mux := http.NewServeMux()
+				mux.Handle("GET /foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(200)
+				}))
+				handler := got.AddAuthentication(mux)
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "/foo", http.NoBody)
+
+				token, err := got.Signer.Sign(jwt.MapClaims{"sub": "foo", "iss": "issuer", "aud": "payments"})
+				require.NoError(t, err)
+
+				r.Header.Set("Authorization", "Bearer "+token)
+				handler.ServeHTTP(w, r)
+				assert.Equal(t, 401, w.Code)
+			},
+		},
+		{
+			name: "authentication - token signed by a retired key",
+			args: testargs{
+				c:         nil,
+				auth:      &kdexv1alpha1.Auth{},
+				namespace: "foo",
+				devMode:   true,
+			},
+			assertions: func(t *testing.T, got *Config, gotErr error) {
+				mux := http.NewServeMux()
+				mux.Handle("GET /foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(200)
+				}))
+
+				token, err := got.Signer.Sign(jwt.MapClaims{"sub": "foo", "iss": "issuer", "aud": "audience"})
+				require.NoError(t, err)
+
+				// The key is rotated, the retired pair is kept for the grace period
+				retired := got.ActivePair
+				active := ecdsaKeyPair(t, "rotated")
+				got.KeyPairs = &keys.KeyPairs{active, retired}
+				got.ActivePair = active
+				handler := got.AddAuthentication(mux)
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "/foo", http.NoBody)
+				r.Header.Set("Authorization", "Bearer "+token)
+				handler.ServeHTTP(w, r)
+				assert.Equal(t, 200, w.Code)
+
+				// Once the retired pair is removed its tokens are rejected
+				got.KeyPairs = &keys.KeyPairs{active}
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				assert.Equal(t, 401, w.Code)
+			},
+		},
 		{
 			name: "authentication - Cookie token expired",
 			args: testargs{
@@ -776,6 +991,9 @@ func TestConfig_AddAuthentication(t *testing.T) {
 				func() (string, string, string, error) {
 					return OIDCConfigLoader(tt.args.secrets, tt.args.devMode)
 				},
+				func() ([]OIDCProvider, string, error) {
+					return OIDCProvidersLoader(tt.args.secrets, tt.args.devMode)
+				},
 				"audience",
 				"issuer",
 				tt.args.devMode,
@@ -840,6 +1058,9 @@ func TestConfig_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "", "", "", fmt.Errorf("OIDC secret does not contain 'client_id' or 'client-id'")
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"audience",
 					"issuer",
 					true,
@@ -869,6 +1090,9 @@ func TestConfig_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "", "", "", fmt.Errorf("missing secret of type 'oidc-client' required for OIDC provider")
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"audience",
 					"issuer",
 					true,
@@ -898,6 +1122,9 @@ func TestConfig_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "", "", "", fmt.Errorf("OIDC secret does not contain 'client_secret' or 'client-secret'")
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"audience",
 					"issuer",
 					true,
@@ -927,6 +1154,9 @@ func TestConfig_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "bar", "foo", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"audience",
 					"issuer",
 					true,
@@ -962,6 +1192,9 @@ func TestConfig_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "bar", "foo", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"audience",
 					"issuer",
 					true,
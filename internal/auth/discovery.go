@@ -11,9 +11,11 @@ type OpenIDConfiguration struct {
 	ClaimsSupported                  []string `json:"claims_supported,omitempty"`
 	GrantTypesSupported              []string `json:"grant_types_supported,omitempty"`
 	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`
 	Issuer                           string   `json:"issuer"`
 	JwksURI                          string   `json:"jwks_uri"`
 	ResponseTypesSupported           []string `json:"response_types_supported"`
+	RevocationEndpoint               string   `json:"revocation_endpoint,omitempty"`
 	ScopesSupported                  []string `json:"scopes_supported,omitempty"`
 	SubjectTypesSupported            []string `json:"subject_types_supported"`
 	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
@@ -24,6 +26,7 @@ func DiscoveryHandler(issuer string) http.HandlerFunc {
 	config := OpenIDConfiguration{
 		AuthorizationEndpoint: issuer + "/-/oauth/authorize",
 		ClaimsSupported: []string{
+			"act",
 			"aud",
 			"birthdate",
 			"email",
@@ -52,11 +55,14 @@ func DiscoveryHandler(issuer string) http.HandlerFunc {
 			"authorization_code",
 			"client_credentials",
 			"password",
+			GrantTypeTokenExchange,
 		},
 		IDTokenSigningAlgValuesSupported: []string{"RS256", "ES256"},
+		IntrospectionEndpoint:            issuer + "/-/oauth/introspect",
 		Issuer:                           issuer,
 		JwksURI:                          issuer + "/.well-known/jwks.json",
 		ResponseTypesSupported:           []string{"code", "id_token"},
+		RevocationEndpoint:               issuer + "/-/oauth/revoke",
 		ScopesSupported: []string{
 			"email",
 			"entitlements",
@@ -29,19 +29,39 @@ const (
 	AuthMethodOAuth2 AuthMethod = "oauth2"
 )
 
+// The grant and token types of the token exchange of RFC 8693.
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
 type CompiledMappingRule struct {
 	dmapper.MappingRule
 	Program cel.Program
 }
 
 type Exchanger struct {
-	config            Config
-	oauth2Config      *oauth2.Config
-	oidcProvider      *oidc.Provider
-	oidcVerifier      *oidc.IDTokenVerifier
-	refreshTokenCache cache.Cache
-	refreshTokenTTL   time.Duration
-	sp                InternalIdentityProvider
+	config               Config
+	loggedOutCache       cache.Cache
+	loginFailureCache    cache.Cache
+	mfaChallengeCache    cache.Cache
+	mfaFailureCache      cache.Cache
+	mfaStepCache         cache.Cache
+	oidcClients          map[string]*oidcClient
+	providerSessionCache cache.Cache
+	refreshTokenCache    cache.Cache
+	refreshTokenTTL      time.Duration
+	sessionIndexCache    cache.Cache
+	sp                   InternalIdentityProvider
+}
+
+// oidcClient is the client of the host with an OIDC provider, by the name of
+// the provider.
+type oidcClient struct {
+	oauth2Config *oauth2.Config
+	provider     *oidc.Provider
+	verifier     *oidc.IDTokenVerifier
 }
 
 // RefreshTokenClaims holds the data stored inside a refresh token entry in the cache.
@@ -50,8 +70,14 @@ type RefreshTokenClaims struct {
 	ClientID   string     `json:"cid"`
 	ExpiresAt  int64      `json:"exp"`
 	IssuedAt   int64      `json:"iat"`
-	Scope      string     `json:"scp"`
-	Subject    string     `json:"sub"`
+	// Provider is the OIDC provider the subject logged in with, if any.
+	Provider string `json:"idp,omitempty"`
+	// ProviderSessionID is the sid of the session at the provider, if any.
+	ProviderSessionID string `json:"psid,omitempty"`
+	Scope             string `json:"scp"`
+	// SessionID is kept by the refresh tokens rotated from one another.
+	SessionID string `json:"sid,omitempty"`
+	Subject   string `json:"sub"`
 }
 
 // TokenSet is the result of any successful token minting operation.
@@ -80,29 +106,41 @@ func NewExchanger(
 			TTL:      new(refreshTokenTTL),
 			Uncycled: true,
 		})
+		ex.loginFailureCache = newLoginFailureCache(cacheManager)
+		ex.mfaChallengeCache, ex.mfaStepCache, ex.mfaFailureCache = newMFACaches(cacheManager)
+		ex.providerSessionCache, ex.loggedOutCache = newProviderSessionCaches(cacheManager, cfg.TokenTTL, refreshTokenTTL)
+		ex.sessionIndexCache = newSessionIndexCache(cacheManager, refreshTokenTTL)
 	}
 
-	if cfg.IsOIDCEnabled() {
-		provider, err := oidc.NewProvider(ctx, cfg.OIDC.ProviderURL)
-		if err != nil {
+	for _, p := range cfg.OIDCProviders() {
+		provider, err := oidc.NewProvider(ctx, p.ProviderURL)
+		if err != nil && p.Name == DefaultOIDCProvider {
 			return nil, fmt.Errorf("failed to initialize OIDC provider: %w", err)
 		}
-		ex.oidcProvider = provider
-		ex.oidcVerifier = provider.Verifier(&oidc.Config{ClientID: cfg.OIDC.ClientID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize OIDC provider %s: %w", p.Name, err)
+		}
 
 		scopes := []string{oidc.ScopeOpenID, "profile", "email"}
-		for _, newScope := range cfg.OIDC.Scopes {
+		for _, newScope := range p.Scopes {
 			if !slices.Contains(scopes, newScope) {
 				scopes = append(scopes, newScope)
 			}
 		}
 
-		ex.oauth2Config = &oauth2.Config{
-			ClientID:     cfg.OIDC.ClientID,
-			ClientSecret: cfg.OIDC.ClientSecret,
-			Endpoint:     provider.Endpoint(),
-			RedirectURL:  cfg.OIDC.RedirectURL,
-			Scopes:       scopes,
+		if ex.oidcClients == nil {
+			ex.oidcClients = map[string]*oidcClient{}
+		}
+		ex.oidcClients[p.Name] = &oidcClient{
+			oauth2Config: &oauth2.Config{
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				Endpoint:     provider.Endpoint(),
+				RedirectURL:  p.RedirectURL,
+				Scopes:       scopes,
+			},
+			provider: provider,
+			verifier: provider.Verifier(&oidc.Config{ClientID: p.ClientID}),
 		}
 	}
 
@@ -110,29 +148,188 @@ func NewExchanger(
 }
 
 func (e *Exchanger) AuthCodeURL(state string) string {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	return e.ProviderAuthCodeURL(DefaultOIDCProvider, state)
+}
+
+// ProviderAuthCodeURL returns the URL logging in with the named OIDC provider,
+// empty when the host has no such provider.
+func (e *Exchanger) ProviderAuthCodeURL(provider string, state string) string {
+	client, ok := e.oidcClient(provider)
+	if !ok {
 		return ""
 	}
-	return e.oauth2Config.AuthCodeURL(state)
+	return client.oauth2Config.AuthCodeURL(state)
 }
 
 func (e *Exchanger) EndSessionURL() (string, error) {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	return e.ProviderEndSessionURL(DefaultOIDCProvider)
+}
+
+// ProviderEndSessionURL returns the URL logging out of the named OIDC
+// provider, empty when the host has no such provider.
+func (e *Exchanger) ProviderEndSessionURL(provider string) (string, error) {
+	client, ok := e.oidcClient(provider)
+	if !ok {
 		return "", nil
 	}
 	var claims OIDCProviderClaims
-	if err := e.oidcProvider.Claims(&claims); err != nil {
+	if err := client.provider.Claims(&claims); err != nil {
 		return "", err
 	}
 	return claims.EndSessionURL, nil
 }
 
+// ExchangeAccessToken implements the token exchange of RFC 8693: the client
+// acting on behalf of the subject of an access token minted by the host gets a
+// token for the audiences, the audience of the host when there are none. The
+// scopes of the token are those of the subject token, narrowed to scope when it
+// is not empty and to the scopes allowed to the client. The claims of the
+// scopes left out, the roles and entitlements among them, are dropped. The
+// client is the actor of the token, nesting the actors of the subject token.
+// The token expires no later than the subject token, and is revoked with the
+// session of the subject token.
+func (e *Exchanger) ExchangeAccessToken(ctx context.Context, clientID, subjectToken string, audiences []string, scope string) (TokenSet, error) {
+	if e == nil || !e.config.IsAuthEnabled() {
+		return TokenSet{}, fmt.Errorf("auth not configured")
+	}
+
+	client, ok := e.GetClient(clientID)
+	if !ok {
+		return TokenSet{}, fmt.Errorf("invalid client_id")
+	}
+
+	claims, err := e.config.VerifyLocalToken(subjectToken)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("invalid subject_token: %w", err)
+	}
+
+	jti, _ := claims["jti"].(string)
+	revoked, err := e.config.Revocations.IsRevoked(ctx, jti)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("failed to check the revocation of the subject_token: %w", err)
+	}
+	if revoked {
+		return TokenSet{}, fmt.Errorf("subject_token is revoked")
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return TokenSet{}, fmt.Errorf("no sub in subject_token")
+	}
+
+	// The tokens of an impersonation are not extended nor relayed
+	if grantType, _ := claims["grant_type"].(string); grantType == GrantTypeImpersonation {
+		return TokenSet{}, fmt.Errorf("subject_token of an impersonation cannot be exchanged")
+	}
+
+	subjectScope, _ := claims["scope"].(string)
+	subjectScopes := strings.Fields(subjectScope)
+	requestedScopes := subjectScopes
+	if scope != "" {
+		requestedScopes = strings.Fields(scope)
+	}
+
+	grantedScopes := []string{}
+	for _, s := range requestedScopes {
+		if slices.Contains(grantedScopes, s) {
+			continue
+		}
+		if !slices.Contains(subjectScopes, s) {
+			return TokenSet{}, fmt.Errorf("scope %s not granted to the subject_token", s)
+		}
+		if len(client.AllowedScopes) > 0 && !slices.Contains(client.AllowedScopes, s) {
+			if scope != "" {
+				return TokenSet{}, fmt.Errorf("scope %s not allowed for this client", s)
+			}
+			continue
+		}
+		grantedScopes = append(grantedScopes, s)
+	}
+
+	signingContext := jwt.MapClaims{}
+	for claim, value := range claims {
+		switch claim {
+		case "act", "aud", "exp", "grant_type", "iat", "iss", "jti", "nbf", "scope":
+		default:
+			signingContext[claim] = value
+		}
+	}
+
+	// The claims of an unscoped subject token are carried as they are.
+	if subjectScope != "" {
+		hasScope := func(s string) bool {
+			return slices.Contains(grantedScopes, s)
+		}
+		if !hasScope("email") {
+			delete(signingContext, "email")
+		}
+		if !hasScope("profile") {
+			delete(signingContext, "family_name")
+			delete(signingContext, "given_name")
+			delete(signingContext, "middle_name")
+			delete(signingContext, "name")
+			delete(signingContext, "nickname")
+			delete(signingContext, "picture")
+			delete(signingContext, "updated_at")
+		}
+		if !hasScope("entitlements") {
+			delete(signingContext, "entitlements")
+		}
+		if !hasScope("roles") {
+			delete(signingContext, "roles")
+		}
+	}
+
+	actor := map[string]any{"sub": clientID}
+	if previous, ok := claims["act"]; ok {
+		actor["act"] = previous
+	}
+	signingContext["act"] = actor
+	signingContext["grant_type"] = GrantTypeTokenExchange
+	if len(audiences) > 0 {
+		signingContext["aud"] = audiences
+	}
+
+	grantedScopeStr := strings.Join(grantedScopes, " ")
+	if grantedScopeStr != "" {
+		signingContext["scope"] = grantedScopeStr
+	}
+
+	// The token expires with the subject token at the latest, and is revoked
+	// along with it.
+	ttl := e.config.TokenTTL
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		ttl = min(ttl, time.Until(exp.Time))
+	}
+	accessToken, err := e.config.Signer.SignFor(signingContext, ttl)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	if err := e.indexExchangedToken(ctx, claims, accessToken); err != nil {
+		return TokenSet{}, err
+	}
+
+	// The client exchanges the subject token again instead of refreshing.
+	return TokenSet{
+		AccessToken: accessToken,
+		Scope:       grantedScopeStr,
+		Subject:     subject,
+	}, nil
+}
+
 func (e *Exchanger) ExchangeCode(ctx context.Context, code string) (string, error) {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	return e.ExchangeProviderCode(ctx, DefaultOIDCProvider, code)
+}
+
+// ExchangeProviderCode exchanges the authorization code of the named OIDC
+// provider for its ID token.
+func (e *Exchanger) ExchangeProviderCode(ctx context.Context, provider string, code string) (string, error) {
+	client, ok := e.oidcClient(provider)
+	if !ok {
 		return "", fmt.Errorf("OIDC is not configured")
 	}
 
-	oauthToken, err := e.oauth2Config.Exchange(ctx, code)
+	oauthToken, err := client.oauth2Config.Exchange(ctx, code)
 	if err != nil {
 		return "", fmt.Errorf("failed to exchange oauth code %w", err)
 	}
@@ -147,12 +344,19 @@ func (e *Exchanger) ExchangeCode(ctx context.Context, code string) (string, erro
 }
 
 func (e *Exchanger) ExchangeToken(ctx context.Context, rawIDToken string) (string, error) {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	return e.ExchangeProviderToken(ctx, DefaultOIDCProvider, rawIDToken)
+}
+
+// ExchangeProviderToken exchanges the ID token of the named OIDC provider for
+// a token of the host. The idp claim of the token is "oidc" for the provider
+// of the host and "oidc:{name}" for a named provider.
+func (e *Exchanger) ExchangeProviderToken(ctx context.Context, provider string, rawIDToken string) (string, error) {
+	if _, ok := e.oidcClient(provider); !ok {
 		return "", fmt.Errorf("OIDC is not configured")
 	}
 
 	// 1. Verify OIDC Token
-	idToken, err := e.verifyIDToken(ctx, rawIDToken)
+	idToken, err := e.verifyProviderIDToken(ctx, provider, rawIDToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to verify ID token: %w", err)
 	}
@@ -163,6 +367,9 @@ func (e *Exchanger) ExchangeToken(ctx context.Context, rawIDToken string) (strin
 	}
 
 	signingContext["idp"] = "oidc"
+	if provider != DefaultOIDCProvider {
+		signingContext["idp"] = "oidc:" + provider
+	}
 
 	sub, err := signingContext.GetSubject()
 	if err != nil {
@@ -197,7 +404,25 @@ func (e *Exchanger) ExchangeToken(ctx context.Context, rawIDToken string) (strin
 	signingContext["entitlements"] = oidcEntitlements
 
 	// 3. Mint Primary Access Token
-	return e.config.Signer.Sign(signingContext)
+	token, err := e.config.Signer.Sign(signingContext)
+	if err != nil {
+		return "", err
+	}
+
+	// 4. Index the session for the back-channel logouts of the provider
+	sid, _ := signingContext["sid"].(string)
+	if err := e.recordProviderSession(ctx, provider, sub, sid, token); err != nil {
+		return "", err
+	}
+
+	e.config.Auditor.Record(ctx, AuditEvent{
+		Category: AuditCategoryLogin,
+		Details:  map[string]string{"provider": provider},
+		Event:    "login_succeeded",
+		Outcome:  AuditOutcomeSuccess,
+		Subject:  sub,
+	})
+	return token, nil
 }
 
 func (e *Exchanger) GetClient(clientID string) (AuthClient, bool) {
@@ -217,11 +442,12 @@ func (e *Exchanger) GetOIDCClientID() string {
 }
 
 func (e *Exchanger) GetScopesSupported() ([]string, error) {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	client, ok := e.oidcClient(DefaultOIDCProvider)
+	if !ok {
 		return nil, nil
 	}
 	var claims OIDCProviderClaims
-	if err := e.oidcProvider.Claims(&claims); err != nil {
+	if err := client.provider.Claims(&claims); err != nil {
 		return nil, err
 	}
 	return claims.ScopesSupported, nil
@@ -235,11 +461,16 @@ func (e *Exchanger) IsRefreshTokenEnabled() bool {
 	return e != nil && e.refreshTokenCache != nil
 }
 
-// createRefreshToken is the internal helper that stores a refresh token in the cache.
-func (e *Exchanger) createRefreshToken(ctx context.Context, claims RefreshTokenClaims) (string, error) {
+// createRefreshToken is the internal helper that stores a refresh token in the cache,
+// in the session of the access token minted with it.
+func (e *Exchanger) createRefreshToken(ctx context.Context, claims RefreshTokenClaims, accessToken string) (string, error) {
 	now := time.Now()
 	claims.IssuedAt = now.Unix()
 	claims.ExpiresAt = now.Add(e.refreshTokenTTL).Unix()
+	created := claims.SessionID == ""
+	if created {
+		claims.SessionID = rand.Text()
+	}
 
 	payload, err := json.Marshal(claims)
 	if err != nil {
@@ -250,6 +481,9 @@ func (e *Exchanger) createRefreshToken(ctx context.Context, claims RefreshTokenC
 	if err := e.refreshTokenCache.Set(ctx, tokenID, string(payload)); err != nil {
 		return "", fmt.Errorf("failed to store refresh token: %w", err)
 	}
+	if err := e.indexSession(ctx, claims.Subject, claims.SessionID, tokenID, accessToken, created); err != nil {
+		return "", err
+	}
 
 	return tokenID, nil
 }
@@ -314,8 +548,15 @@ func (e *Exchanger) LoginLocal(ctx context.Context, username, password, scope, c
 		return TokenSet{}, fmt.Errorf("local auth not configured")
 	}
 
+	if err := e.checkLoginLockout(ctx, username); err != nil {
+		return TokenSet{}, err
+	}
+
 	signingContext, err := e.sp.FindInternal(username, password)
 	if err != nil {
+		if recordErr := e.recordLoginFailure(ctx, username, err); recordErr != nil {
+			return TokenSet{}, recordErr
+		}
 		return TokenSet{}, err
 	}
 
@@ -328,6 +569,35 @@ func (e *Exchanger) LoginLocal(ctx context.Context, username, password, scope, c
 		return TokenSet{}, fmt.Errorf("unsupported local login auth method: %s", authMethod)
 	}
 
+	mfa, err := e.sp.FindInternalMFA(username, signingContext)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("failed to resolve the second factor of '%s': %w", username, err)
+	}
+	if (mfa.Required || mfa.Secret != "") && authMethod == AuthMethodOAuth2 {
+		return TokenSet{}, fmt.Errorf("second factor required for '%s', log in on the login page", username)
+	}
+	if mfa.Required || mfa.Secret != "" {
+		// The failed logins are reset by the second factor, not the password
+		return TokenSet{}, e.challengeMFA(ctx, mfaChallengeClaims{
+			AuthMethod: authMethod,
+			ClientID:   clientID,
+			Enrolled:   mfa.Secret != "",
+			Identity:   signingContext,
+			Scope:      scope,
+			Subject:    username,
+		})
+	}
+
+	if err := e.resetLoginFailures(ctx, username); err != nil {
+		return TokenSet{}, err
+	}
+
+	return e.mintLocal(ctx, signingContext, username, scope, clientID, authMethod)
+}
+
+// mintLocal mints the tokens of the local subject authenticated with the
+// identity, granted the requested scopes.
+func (e *Exchanger) mintLocal(ctx context.Context, signingContext jwt.MapClaims, username, scope, clientID string, authMethod AuthMethod) (TokenSet, error) {
 	// Determine granted scopes and filter claims
 	requestedScopes := strings.Split(scope, " ")
 	if scope == "" {
@@ -421,7 +691,7 @@ func (e *Exchanger) LoginLocal(ctx context.Context, username, password, scope, c
 			ClientID:   clientID,
 			Scope:      grantedScopeStr,
 			Subject:    username,
-		})
+		}, accessToken)
 		if err != nil {
 			return TokenSet{}, fmt.Errorf("failed to create refresh token: %w", err)
 		}
@@ -430,6 +700,53 @@ func (e *Exchanger) LoginLocal(ctx context.Context, username, password, scope, c
 	return ts, nil
 }
 
+// LookupRefreshToken returns the claims of a refresh token that has not expired
+// or been redeemed, without consuming it.
+func (e *Exchanger) LookupRefreshToken(ctx context.Context, tokenID string) (RefreshTokenClaims, bool, error) {
+	if !e.IsRefreshTokenEnabled() {
+		return RefreshTokenClaims{}, false, fmt.Errorf("refresh token storage not configured")
+	}
+
+	raw, found, _, err := e.refreshTokenCache.Get(ctx, tokenID)
+	if err != nil {
+		return RefreshTokenClaims{}, false, fmt.Errorf("failed to read refresh token: %w", err)
+	}
+	if !found {
+		return RefreshTokenClaims{}, false, nil
+	}
+
+	var claims RefreshTokenClaims
+	if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+		return RefreshTokenClaims{}, false, fmt.Errorf("failed to parse refresh token: %w", err)
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return RefreshTokenClaims{}, false, nil
+	}
+	if loggedOut, err := e.isLoggedOut(ctx, claims); err != nil || loggedOut {
+		return RefreshTokenClaims{}, false, err
+	}
+
+	return claims, true, nil
+}
+
+// RevokeRefreshToken deletes a refresh token issued to clientID, and returns
+// whether the token was a stored refresh token.
+func (e *Exchanger) RevokeRefreshToken(ctx context.Context, tokenID, clientID string) (bool, error) {
+	claims, found, err := e.LookupRefreshToken(ctx, tokenID)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if claims.ClientID != clientID {
+		return true, fmt.Errorf("refresh token was not issued to this client")
+	}
+
+	if err := e.refreshTokenCache.Delete(ctx, tokenID); err != nil {
+		return true, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return true, nil
+}
+
 // RedeemAuthorizationCode validates and exchanges an authorization code for a TokenSet.
 func (e *Exchanger) RedeemAuthorizationCode(ctx context.Context, code, clientID, redirectURI, codeVerifier string) (TokenSet, error) {
 	if e == nil {
@@ -535,6 +852,16 @@ func (e *Exchanger) RedeemRefreshToken(ctx context.Context, tokenID, clientID st
 		return TokenSet{}, fmt.Errorf("refresh token was not issued to this client")
 	}
 
+	// The subject logged out at its OIDC provider since.
+	loggedOut, err := e.isLoggedOut(ctx, claims)
+	if err != nil {
+		return TokenSet{}, err
+	}
+	if loggedOut {
+		_ = e.refreshTokenCache.Delete(ctx, tokenID)
+		return TokenSet{}, fmt.Errorf("refresh token revoked by logout")
+	}
+
 	// Consume the token (one-time use).
 	if err := e.refreshTokenCache.Delete(ctx, tokenID); err != nil {
 		return TokenSet{}, fmt.Errorf("failed to consume refresh token: %w", err)
@@ -546,13 +873,21 @@ func (e *Exchanger) RedeemRefreshToken(ctx context.Context, tokenID, clientID st
 		return TokenSet{}, fmt.Errorf("failed to mint tokens from refresh: %w", err)
 	}
 
+	// Index the token for the back-channel logouts of the provider
+	if err := e.recordProviderSession(ctx, claims.Provider, claims.Subject, claims.ProviderSessionID, ts.AccessToken); err != nil {
+		return TokenSet{}, err
+	}
+
 	// Rotate: issue a new refresh token.
 	ts.RefreshToken, err = e.createRefreshToken(ctx, RefreshTokenClaims{
-		AuthMethod: claims.AuthMethod,
-		ClientID:   claims.ClientID,
-		Scope:      claims.Scope,
-		Subject:    claims.Subject,
-	})
+		AuthMethod:        claims.AuthMethod,
+		ClientID:          claims.ClientID,
+		Provider:          claims.Provider,
+		ProviderSessionID: claims.ProviderSessionID,
+		Scope:             claims.Scope,
+		SessionID:         claims.SessionID,
+		Subject:           claims.Subject,
+	}, ts.AccessToken)
 	if err != nil {
 		return TokenSet{}, fmt.Errorf("failed to rotate refresh token: %w", err)
 	}
@@ -561,10 +896,24 @@ func (e *Exchanger) RedeemRefreshToken(ctx context.Context, tokenID, clientID st
 }
 
 func (e *Exchanger) verifyIDToken(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
-	if e == nil || !e.config.IsOIDCEnabled() {
+	return e.verifyProviderIDToken(ctx, DefaultOIDCProvider, rawIDToken)
+}
+
+func (e *Exchanger) verifyProviderIDToken(ctx context.Context, provider string, rawIDToken string) (*oidc.IDToken, error) {
+	client, ok := e.oidcClient(provider)
+	if !ok {
 		return nil, fmt.Errorf("OIDC is not configured")
 	}
-	return e.oidcVerifier.Verify(ctx, rawIDToken)
+	return client.verifier.Verify(ctx, rawIDToken)
+}
+
+// oidcClient returns the client of the host with the named OIDC provider.
+func (e *Exchanger) oidcClient(provider string) (*oidcClient, bool) {
+	if e == nil || !e.config.IsOIDCEnabled() {
+		return nil, false
+	}
+	client, ok := e.oidcClients[provider]
+	return client, ok
 }
 
 type OIDCProviderClaims struct {
@@ -578,9 +927,13 @@ type AuthorizationCodeClaims struct {
 	CodeChallenge       string     `json:"challenge,omitempty"`
 	CodeChallengeMethod string     `json:"challenge_method,omitempty"`
 	Exp                 int64      `json:"exp"`
-	RedirectURI         string     `json:"uri"`
-	Scope               string     `json:"scp"`
-	Subject             string     `json:"sub"`
+	// Provider is the OIDC provider the subject logged in with, if any.
+	Provider string `json:"idp,omitempty"`
+	// ProviderSessionID is the sid of the session at the provider, if any.
+	ProviderSessionID string `json:"psid,omitempty"`
+	RedirectURI       string `json:"uri"`
+	Scope             string `json:"scp"`
+	Subject           string `json:"sub"`
 }
 
 func (e *Exchanger) CreateAuthorizationCode(ctx context.Context, claims AuthorizationCodeClaims) (string, error) {
@@ -671,6 +1024,11 @@ func (e *Exchanger) mintTokensFromCode(ctx context.Context, claims Authorization
 		return TokenSet{}, fmt.Errorf("failed to sign access token: %w", err)
 	}
 
+	// Index the token for the back-channel logouts of the provider
+	if err := e.recordProviderSession(ctx, claims.Provider, claims.Subject, claims.ProviderSessionID, accessToken); err != nil {
+		return TokenSet{}, err
+	}
+
 	var idToken string
 	if slices.Contains(grantedScopes, "openid") {
 		idTokenContext := make(jwt.MapClaims, len(signingContext))
@@ -692,11 +1050,13 @@ func (e *Exchanger) mintTokensFromCode(ctx context.Context, claims Authorization
 
 	if e.IsRefreshTokenEnabled() {
 		ts.RefreshToken, err = e.createRefreshToken(ctx, RefreshTokenClaims{
-			AuthMethod: claims.AuthMethod,
-			ClientID:   claims.ClientID,
-			Scope:      grantedScopeStr,
-			Subject:    claims.Subject,
-		})
+			AuthMethod:        claims.AuthMethod,
+			ClientID:          claims.ClientID,
+			Provider:          claims.Provider,
+			ProviderSessionID: claims.ProviderSessionID,
+			Scope:             grantedScopeStr,
+			Subject:           claims.Subject,
+		}, accessToken)
 		if err != nil {
 			return TokenSet{}, fmt.Errorf("failed to create refresh token: %w", err)
 		}
@@ -324,6 +324,9 @@ func TestNewExchanger(t *testing.T) {
 				func() (string, string, string, error) {
 					return "", "", "", nil
 				},
+				func() ([]OIDCProvider, string, error) {
+					return nil, "", nil
+				},
 				"audience",
 				"issuer",
 				tt.devMode,
@@ -400,6 +403,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					"http://bad",
 					true,
@@ -435,6 +441,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -469,6 +478,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -506,6 +518,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -542,6 +557,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -586,6 +604,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -623,6 +644,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -660,6 +684,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -700,6 +727,9 @@ func TestNewExchanger_OIDC(t *testing.T) {
 					func() (string, string, string, error) {
 						return "foo", "bar", "", nil
 					},
+					func() ([]OIDCProvider, string, error) {
+						return nil, "", nil
+					},
 					"foo",
 					serverURL,
 					true,
@@ -731,6 +761,80 @@ func TestNewExchanger_OIDC(t *testing.T) {
 				assert.Equal(t, []string{"page:read"}, entitlements)
 			},
 		},
+		{
+			name: "OIDC - named providers",
+			sp:   scopeProvider,
+			assertions: func(t *testing.T, serverURL string, innerHandler *IH) {
+				ctx := context.Background()
+				cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+				cfg, gotErr := NewConfig(
+					&v1alpha1.Auth{
+						OIDCProvider: &v1alpha1.OIDCProvider{
+							OIDCProviderURL: serverURL,
+						},
+					},
+					func() (map[string]AuthClient, error) {
+						return map[string]AuthClient{}, nil
+					},
+					func() (*keys.KeyPairs, error) {
+						return keys.GenerateECDSAKeyPair(), nil
+					},
+					func() (string, string, string, error) {
+						return "foo", "bar", "", nil
+					},
+					func() ([]OIDCProvider, string, error) {
+						return []OIDCProvider{
+							{
+								ClientID:     "corp-client",
+								ClientSecret: "corp-secret",
+								DisplayName:  "Corporate",
+								Name:         "corp",
+								ProviderURL:  serverURL,
+								Scopes:       []string{"groups"},
+							},
+						}, "", nil
+					},
+					"foo",
+					serverURL,
+					true,
+					cacheManager,
+				)
+				assert.Nil(t, gotErr)
+
+				names := []string{}
+				for _, p := range cfg.OIDCProviders() {
+					names = append(names, p.Name)
+				}
+				assert.Equal(t, []string{DefaultOIDCProvider, "corp"}, names)
+				assert.Equal(t, "/-/oauth/callback/corp", cfg.OIDC.Providers[0].RedirectURL)
+
+				innerHandler.Handler = MockOIDCProvider(*cfg)
+				ex, gotErr := NewExchanger(ctx, *cfg, cacheManager, scopeProvider)
+				assert.Nil(t, gotErr)
+
+				url := ex.ProviderAuthCodeURL("corp", "foo")
+				assert.Contains(t, url, "client_id=corp-client")
+				assert.Contains(t, url, "redirect_uri=%2F-%2Foauth%2Fcallback%2Fcorp")
+				assert.Contains(t, url, "scope=openid+profile+email+groups")
+				assert.Contains(t, ex.AuthCodeURL("foo"), "client_id=foo")
+				assert.Empty(t, ex.ProviderAuthCodeURL("unknown", "foo"))
+
+				rawIDToken, err := ex.ExchangeProviderCode(ctx, "corp", "foo")
+				assert.Nil(t, err)
+				localToken, err := ex.ExchangeProviderToken(ctx, "corp", rawIDToken)
+				assert.Nil(t, err)
+				claims := jwt.MapClaims{}
+				_, _, err = new(jwt.Parser).ParseUnverified(localToken, claims)
+				assert.Nil(t, err)
+				assert.Equal(t, "oidc:corp", claims["idp"])
+
+				// The ID tokens of a provider are not accepted for another
+				_, err = ex.ExchangeToken(ctx, rawIDToken)
+				assert.NotNil(t, err)
+				_, err = ex.ExchangeProviderCode(ctx, "unknown", "foo")
+				assert.NotNil(t, err)
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -817,13 +921,29 @@ func TokenHandler(cfg Config) http.HandlerFunc {
 
 type mockScopeProvider struct {
 	resolveIdentity             func(subject string, password string) (jwt.MapClaims, error)
+	resolveMFA                  func(subject string, identity jwt.MapClaims) (MFA, error)
 	resolveRolesAndEntitlements func(subject string) ([]string, []string, error)
+	enrollMFA                   func(subject string, secret string) error
 }
 
 func (m *mockScopeProvider) FindInternal(subject string, password string) (jwt.MapClaims, error) {
 	return m.resolveIdentity(subject, password)
 }
 
+func (m *mockScopeProvider) FindInternalMFA(subject string, identity jwt.MapClaims) (MFA, error) {
+	if m.resolveMFA == nil {
+		return MFA{}, nil
+	}
+	return m.resolveMFA(subject, identity)
+}
+
 func (m *mockScopeProvider) FindInternalRolesAndEntitlements(subject string) ([]string, []string, error) {
 	return m.resolveRolesAndEntitlements(subject)
 }
+
+func (m *mockScopeProvider) SetInternalMFA(subject string, secret string) error {
+	if m.enrollMFA == nil {
+		return nil
+	}
+	return m.enrollMFA(subject, secret)
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ImpersonationEntitlementAnnotation names, on a host, the entitlement
+	// allowing its holders, support staff, to act as another subject with a
+	// time-boxed token, e.g. "support:impersonate". Impersonation is disabled
+	// when it is not set.
+	ImpersonationEntitlementAnnotation = "kdex.dev/impersonation-entitlement"
+	// ImpersonationTTLAnnotation sets, on a host, how long the tokens of an
+	// impersonation live, e.g. "10m". They never outlive the tokens of the
+	// host.
+	ImpersonationTTLAnnotation = "kdex.dev/impersonation-ttl"
+
+	// GrantTypeImpersonation is the grant_type of the tokens minted by
+	// Impersonate, marking the activity of their actor in the audit log.
+	GrantTypeImpersonation = "urn:kdex:params:oauth:grant-type:impersonation"
+
+	defaultImpersonationTTL = 15 * time.Minute
+)
+
+// ErrImpersonationForbidden is returned by Impersonate when the actor is not
+// allowed to act as the subject.
+var ErrImpersonationForbidden = errors.New("impersonation forbidden")
+
+// Impersonation lets the holders of Entitlement act as other subjects.
+type Impersonation struct {
+	Entitlement string
+	TTL         time.Duration
+}
+
+// ParseImpersonation returns the impersonation of
+// ImpersonationEntitlementAnnotation and ImpersonationTTLAnnotation, nil when
+// it is not set.
+func ParseImpersonation(annotations map[string]string) (*Impersonation, error) {
+	entitlement := strings.TrimSpace(annotations[ImpersonationEntitlementAnnotation])
+	ttl := annotations[ImpersonationTTLAnnotation]
+	if entitlement == "" {
+		if ttl != "" {
+			return nil, fmt.Errorf("invalid %s annotation %q, %s is not set", ImpersonationTTLAnnotation, ttl, ImpersonationEntitlementAnnotation)
+		}
+		return nil, nil
+	}
+	if strings.ContainsAny(entitlement, " ,") {
+		return nil, fmt.Errorf("invalid %s annotation %q, expected a single entitlement", ImpersonationEntitlementAnnotation, entitlement)
+	}
+
+	impersonation := &Impersonation{
+		Entitlement: entitlement,
+		TTL:         defaultImpersonationTTL,
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation %q, expected a positive duration", ImpersonationTTLAnnotation, ttl)
+		}
+		impersonation.TTL = d
+	}
+	return impersonation, nil
+}
+
+// ImpersonationTTL returns how long the tokens of an impersonation live, zero
+// when impersonation is disabled.
+func (c *Config) ImpersonationTTL() time.Duration {
+	if c == nil || c.Impersonation == nil {
+		return 0
+	}
+	if c.TokenTTL > 0 && c.TokenTTL < c.Impersonation.TTL {
+		return c.TokenTTL
+	}
+	return c.Impersonation.TTL
+}
+
+// Impersonate mints a token for the subject acting on behalf of the actor,
+// who must hold the impersonation entitlement and act as themselves. The token
+// carries the roles and entitlements of the subject, the actor in its act
+// claim, and lives for the impersonation TTL; it is neither refreshed nor
+// exchanged. Subjects holding the impersonation entitlement are not
+// impersonated. The impersonation and the reason given for it are recorded
+// in the audit log.
+func (e *Exchanger) Impersonate(ctx context.Context, actor AuthContext, subject string, reason string) (TokenSet, error) {
+	if e == nil || !e.config.IsAuthEnabled() || e.config.Impersonation == nil {
+		return TokenSet{}, fmt.Errorf("impersonation not configured")
+	}
+	entitlement := e.config.Impersonation.Entitlement
+
+	actorSubject, _ := actor.GetSubject()
+	if actorSubject == "" {
+		return TokenSet{}, fmt.Errorf("%w: not authenticated", ErrImpersonationForbidden)
+	}
+	if _, ok := actor["act"]; ok {
+		return TokenSet{}, fmt.Errorf("%w: '%s' is not acting as themselves", ErrImpersonationForbidden, actorSubject)
+	}
+	actorEntitlements, _ := actor.GetEntitlements()
+	if !slices.Contains(actorEntitlements, entitlement) {
+		e.config.Auditor.auditImpersonation(ctx, "impersonation_denied", AuditOutcomeFailure, actorSubject, subject, "reason", reason)
+		return TokenSet{}, fmt.Errorf("%w: '%s' is not entitled to %s", ErrImpersonationForbidden, actorSubject, entitlement)
+	}
+
+	if subject == "" {
+		return TokenSet{}, fmt.Errorf("subject is required")
+	}
+	if subject == actorSubject {
+		return TokenSet{}, fmt.Errorf("'%s' cannot impersonate themselves", actorSubject)
+	}
+
+	roles, entitlements, err := e.sp.FindInternalRolesAndEntitlements(subject)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("failed to resolve roles: %w", err)
+	}
+	if slices.Contains(entitlements, entitlement) {
+		e.config.Auditor.auditImpersonation(ctx, "impersonation_denied", AuditOutcomeFailure, actorSubject, subject, "reason", reason)
+		return TokenSet{}, fmt.Errorf("%w: '%s' is entitled to %s", ErrImpersonationForbidden, subject, entitlement)
+	}
+
+	scope := "entitlements roles"
+	signingContext := jwt.MapClaims{
+		"act":          map[string]any{"sub": actorSubject},
+		"entitlements": entitlements,
+		"grant_type":   GrantTypeImpersonation,
+		"roles":        roles,
+		"scope":        scope,
+		"sub":          subject,
+	}
+
+	ttl := e.config.ImpersonationTTL()
+	accessToken, err := e.config.Signer.SignFor(signingContext, ttl)
+	if err != nil {
+		return TokenSet{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		return TokenSet{}, fmt.Errorf("failed to parse minted token: %w", err)
+	}
+	jti, _ := claims["jti"].(string)
+	e.config.Auditor.auditImpersonation(ctx, "impersonation_started", AuditOutcomeSuccess, actorSubject, subject, "reason", reason, "jti", jti, "ttl", ttl.String())
+
+	return TokenSet{
+		AccessToken: accessToken,
+		Scope:       scope,
+		Subject:     subject,
+	}, nil
+}
+
+// AuditImpersonatedRequest records, in the audit log, the request made with
+// the token of authContext when it was minted by Impersonate. The context
+// holds the IP of the request.
+func (a *Auditor) AuditImpersonatedRequest(ctx context.Context, r *http.Request, authContext AuthContext) {
+	if grantType, _ := authContext["grant_type"].(string); grantType != GrantTypeImpersonation {
+		return
+	}
+	subject, _ := authContext.GetSubject()
+	actor, _ := authContext["act"].(map[string]any)
+	actorSubject, _ := actor["sub"].(string)
+	jti, _ := authContext["jti"].(string)
+	a.auditImpersonation(ctx, "impersonated_request", AuditOutcomeSuccess, actorSubject, subject, "jti", jti, "method", r.Method, "path", r.URL.Path)
+}
+
+// auditImpersonation logs the audit event of an impersonation of the subject
+// by the actor, and records it in the audit log of the host.
+func (a *Auditor) auditImpersonation(ctx context.Context, event string, outcome string, actor string, subject string, keysAndValues ...any) {
+	logf.FromContext(ctx).Info(
+		"impersonation audit",
+		append([]any{"event", event, "actor", actor, "subject", subject, "ip", clientIP(ctx)}, keysAndValues...)...,
+	)
+	a.Record(ctx, AuditEvent{
+		Actor:    actor,
+		Category: AuditCategoryImpersonation,
+		Details:  auditDetails(keysAndValues...),
+		Event:    event,
+		Outcome:  outcome,
+		Subject:  subject,
+	})
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseImpersonation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Impersonation
+		wantErr     string
+	}{
+		{name: "not set"},
+		{
+			name:        "entitlement",
+			annotations: map[string]string{ImpersonationEntitlementAnnotation: "support:impersonate"},
+			want:        &Impersonation{Entitlement: "support:impersonate", TTL: defaultImpersonationTTL},
+		},
+		{
+			name: "ttl",
+			annotations: map[string]string{
+				ImpersonationEntitlementAnnotation: "support:impersonate",
+				ImpersonationTTLAnnotation:         "5m",
+			},
+			want: &Impersonation{Entitlement: "support:impersonate", TTL: 5 * time.Minute},
+		},
+		{
+			name:        "ttl without entitlement",
+			annotations: map[string]string{ImpersonationTTLAnnotation: "5m"},
+			wantErr:     "is not set",
+		},
+		{
+			name:        "several entitlements",
+			annotations: map[string]string{ImpersonationEntitlementAnnotation: "support:impersonate,admin"},
+			wantErr:     "expected a single entitlement",
+		},
+		{
+			name: "invalid ttl",
+			annotations: map[string]string{
+				ImpersonationEntitlementAnnotation: "support:impersonate",
+				ImpersonationTTLAnnotation:         "-5m",
+			},
+			wantErr: "expected a positive duration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImpersonation(tt.annotations)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExchanger_Impersonate(t *testing.T) {
+	ctx := context.Background()
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) {
+			return map[string]AuthClient{"app": {ClientID: "app", Public: true}}, nil
+		},
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	cfg.Impersonation = &Impersonation{Entitlement: "support:impersonate", TTL: 5 * time.Minute}
+
+	ex, err := NewExchanger(ctx, *cfg, cacheManager, &mockScopeProvider{
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			if subject == "carol" {
+				return []string{"support"}, []string{"support:impersonate"}, nil
+			}
+			return []string{"customer"}, []string{"orders:read"}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	staff := AuthContext{"sub": "carol", "entitlements": []any{"support:impersonate"}}
+
+	ts, err := ex.Impersonate(ctx, staff, "alice", "ticket 42")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", ts.Subject)
+	assert.Empty(t, ts.RefreshToken)
+
+	claims, err := cfg.VerifyLocalToken(ts.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, map[string]any{"sub": "carol"}, claims["act"])
+	assert.Equal(t, GrantTypeImpersonation, claims["grant_type"])
+	assert.Equal(t, []any{"orders:read"}, claims["entitlements"])
+	assert.Equal(t, []any{"customer"}, claims["roles"])
+	exp, err := claims.GetExpirationTime()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), exp.Time, 5*time.Second, "the token is time-boxed")
+
+	// The token of an impersonation is not relayed
+	_, err = ex.ExchangeAccessToken(ctx, "app", ts.AccessToken, nil, "")
+	assert.ErrorContains(t, err, "cannot be exchanged")
+
+	for name, tc := range map[string]struct {
+		actor   AuthContext
+		subject string
+	}{
+		"anonymous":        {actor: AuthContext{}, subject: "alice"},
+		"not entitled":     {actor: AuthContext{"sub": "bob", "entitlements": []any{"orders:read"}}, subject: "alice"},
+		"impersonating":    {actor: AuthContext{"sub": "alice", "act": map[string]any{"sub": "carol"}, "entitlements": []any{"support:impersonate"}}, subject: "bob"},
+		"entitled subject": {actor: AuthContext{"sub": "dave", "entitlements": []any{"support:impersonate"}}, subject: "carol"},
+	} {
+		_, err := ex.Impersonate(ctx, tc.actor, tc.subject, "")
+		assert.True(t, errors.Is(err, ErrImpersonationForbidden), name)
+	}
+
+	_, err = ex.Impersonate(ctx, staff, "", "")
+	assert.ErrorContains(t, err, "subject is required")
+	_, err = ex.Impersonate(ctx, staff, "carol", "")
+	assert.Error(t, err)
+
+	// The tokens of the impersonation never outlive those of the host
+	cfg.TokenTTL = time.Minute
+	assert.Equal(t, time.Minute, cfg.ImpersonationTTL())
+	cfg.Impersonation = nil
+	assert.Zero(t, cfg.ImpersonationTTL())
+}
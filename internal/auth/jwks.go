@@ -9,27 +9,14 @@ import (
 	"net/http"
 
 	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/pkg/jwtverify"
 )
 
 // JWK represents a JSON Web Key.
-type JWK struct {
-	Alg string `json:"alg"`
-	Kid string `json:"kid"`
-	Kty string `json:"kty"`
-	Use string `json:"use"`
-	// RSA fields
-	E string `json:"e,omitempty"`
-	N string `json:"n,omitempty"`
-	// ECDSA fields
-	Crv string `json:"crv,omitempty"`
-	X   string `json:"x,omitempty"`
-	Y   string `json:"y,omitempty"`
-}
+type JWK = jwtverify.JWK
 
 // JWKSet represents a JSON Web Key Set.
-type JWKSet struct {
-	Keys []JWK `json:"keys"`
-}
+type JWKSet = jwtverify.JWKSet
 
 // JWKSHandler creates an HTTP handler that serves the JWKS endpoint.
 // This endpoint exposes the public key(s) used to verify JWT signatures.
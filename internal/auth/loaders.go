@@ -2,9 +2,11 @@ package auth
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 )
 
@@ -88,7 +90,10 @@ func AuthClientLoader(secrets kdexv1alpha1.ServiceAccountSecrets) (map[string]Au
 }
 
 func OIDCConfigLoader(secrets kdexv1alpha1.ServiceAccountSecrets, devMode bool) (string, string, string, error) {
-	oidcSecrets := secrets.Filter(func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] == "oidc-client" })
+	// The secrets carrying a provider URL configure the named providers
+	oidcSecrets := secrets.Filter(func(s corev1.Secret) bool {
+		return s.Annotations["kdex.dev/secret-type"] == "oidc-client" && !isOIDCProviderSecret(s)
+	})
 	if len(oidcSecrets) == 0 {
 		return "", "", "", fmt.Errorf("missing secret of type 'oidc-client' required for OIDC provider")
 	}
@@ -125,3 +130,102 @@ func OIDCConfigLoader(secrets kdexv1alpha1.ServiceAccountSecrets, devMode bool)
 
 	return clientID, clientSecret, blockKey, nil
 }
+
+// OIDCProvidersLoader loads the named OIDC providers of the host, offered next
+// to its OIDC provider on the login page, from the secrets of type
+// 'oidc-client' carrying a 'provider_url'. The providers are sorted by name and
+// returned with the block key of the first of them.
+func OIDCProvidersLoader(secrets kdexv1alpha1.ServiceAccountSecrets, devMode bool) ([]OIDCProvider, string, error) {
+	providerSecrets := secrets.Filter(func(s corev1.Secret) bool {
+		return s.Annotations["kdex.dev/secret-type"] == "oidc-client" && isOIDCProviderSecret(s)
+	})
+
+	providers := []OIDCProvider{}
+	blockKey := ""
+	for _, secret := range providerSecrets {
+		name := string(secret.Data["name"])
+		if name == "" {
+			name = secret.Name
+		}
+
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, "", fmt.Errorf("OIDC provider name %q of secret %s is invalid: %s", name, secret.Name, strings.Join(errs, ", "))
+		}
+
+		if name == DefaultOIDCProvider {
+			return nil, "", fmt.Errorf("OIDC provider name %q of secret %s is reserved for the OIDC provider of the host", name, secret.Name)
+		}
+
+		if slices.ContainsFunc(providers, func(p OIDCProvider) bool { return p.Name == name }) {
+			return nil, "", fmt.Errorf("OIDC provider name %q of secret %s is not unique", name, secret.Name)
+		}
+
+		providerURL := string(secret.Data["provider_url"])
+		if providerURL == "" {
+			providerURL = string(secret.Data["provider-url"])
+		}
+
+		clientID := string(secret.Data["client_id"])
+		if clientID == "" {
+			clientID = string(secret.Data["client-id"])
+		}
+
+		if clientID == "" {
+			return nil, "", fmt.Errorf("OIDC secret %s does not contain 'client_id' or 'client-id'", secret.Name)
+		}
+
+		clientSecret := string(secret.Data["client_secret"])
+		if clientSecret == "" {
+			clientSecret = string(secret.Data["client-secret"])
+		}
+
+		if clientSecret == "" {
+			return nil, "", fmt.Errorf("OIDC secret %s does not contain 'client_secret' or 'client-secret'", secret.Name)
+		}
+
+		key := string(secret.Data["block_key"])
+		if key == "" {
+			key = string(secret.Data["block-key"])
+		}
+
+		if key == "" && !devMode {
+			return nil, "", fmt.Errorf("a 'block_key' or 'block-key' was not found in the OIDC secret %s, generating a new one is not supported in production", secret.Name)
+		}
+
+		if blockKey == "" {
+			blockKey = key
+		}
+
+		displayName := string(secret.Data["display_name"])
+		if displayName == "" {
+			displayName = string(secret.Data["display-name"])
+		}
+		if displayName == "" {
+			displayName = name
+		}
+
+		scopes := []string{}
+		for scope := range strings.SplitSeq(string(secret.Data["scopes"]), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		providers = append(providers, OIDCProvider{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			DisplayName:  displayName,
+			Name:         name,
+			ProviderURL:  providerURL,
+			Scopes:       scopes,
+		})
+	}
+
+	slices.SortFunc(providers, func(a, b OIDCProvider) int { return strings.Compare(a.Name, b.Name) })
+
+	return providers, blockKey, nil
+}
+
+func isOIDCProviderSecret(secret corev1.Secret) bool {
+	return len(secret.Data["provider_url"]) > 0 || len(secret.Data["provider-url"]) > 0
+}
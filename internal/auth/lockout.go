@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/cache"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// TrustedProxiesAnnotation lists, on a host, the comma separated networks
+	// or IPs of the proxies in front of it, e.g. "10.0.0.0/8,192.0.2.7", whose
+	// X-Forwarded-For header gives the IP the requests come from. The private
+	// and loopback networks, where the Ingress or Gateway of the host runs, are
+	// trusted when it is not set.
+	TrustedProxiesAnnotation = "kdex.dev/trusted-proxies"
+
+	clientIPContextKey ContextKey = "client-ip"
+
+	// loginFailureTTL is how long the failed logins of a subject or of an IP
+	// are counted after the latest one.
+	loginFailureTTL = time.Hour
+	// loginLockoutBase is the lockout following the first failure over the
+	// free attempts, doubled by each further failure up to loginLockoutMax.
+	loginLockoutBase = 30 * time.Second
+	loginLockoutMax  = 15 * time.Minute
+	// loginSubjectFreeAttempts is the number of failed logins of a subject
+	// before it is locked out.
+	loginSubjectFreeAttempts = 5
+	// loginIPFreeAttempts is the number of failed logins from an IP before it
+	// is locked out, higher than that of a subject as an IP may be shared by
+	// several users, e.g. behind a NAT.
+	loginIPFreeAttempts = 20
+)
+
+// LoginLockedError is returned by LoginLocal and VerifyMFA when the subject,
+// or the IP the login comes from, is locked out after too many failed logins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry in %s", e.RetryAfter)
+}
+
+// loginFailures counts the failed logins of a subject or of an IP.
+type loginFailures struct {
+	Count int `json:"count"`
+	// LockedUntil is the end of the lockout, in Unix milliseconds.
+	LockedUntil int64 `json:"locked_until"`
+}
+
+// defaultTrustedProxies are the proxies trusted when TrustedProxiesAnnotation
+// is not set.
+var defaultTrustedProxies = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// ParseTrustedProxies returns the networks of TrustedProxiesAnnotation,
+// those of the private and loopback networks when it is not set.
+func ParseTrustedProxies(annotations map[string]string) ([]netip.Prefix, error) {
+	value := annotations[TrustedProxiesAnnotation]
+	if value == "" {
+		return defaultTrustedProxies, nil
+	}
+
+	proxies := []netip.Prefix{}
+	for proxy := range strings.SplitSeq(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid %s annotation %q, %q is neither a network nor an IP", TrustedProxiesAnnotation, value, proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// WithClientIP returns the context of the request with the IP it comes from,
+// locked out after too many failed logins along with their subject, see
+// ClientIP.
+func (c *Config) WithClientIP(r *http.Request) context.Context {
+	var trustedProxies []netip.Prefix
+	if c != nil {
+		trustedProxies = c.TrustedProxies
+	}
+	return withClientIP(r, trustedProxies)
+}
+
+func withClientIP(r *http.Request, trustedProxies []netip.Prefix) context.Context {
+	return context.WithValue(r.Context(), clientIPContextKey, ClientIP(r, trustedProxies))
+}
+
+// ClientIP returns the IP the request comes from: the peer, or, when the peer
+// is one of the trusted proxies, the nearest hop of X-Forwarded-For which is
+// not, the hops before it being set by anyone. It is empty when a trusted
+// proxy forwards no hop, its own IP being that of every visitor.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+	if !isTrustedProxy(peer, trustedProxies) {
+		return peer
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for hop := range strings.SplitSeq(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrustedProxy(hops[i], trustedProxies) {
+			return hops[i]
+		}
+	}
+	return ""
+}
+
+// isTrustedProxy reports whether ip is within one of the trusted proxies.
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey).(string)
+	return ip
+}
+
+// loginLockoutKeys returns the keys of the failed logins of the subject and of
+// the IP of the context, with their free attempts.
+func loginLockoutKeys(ctx context.Context, subject string) map[string]int {
+	keys := map[string]int{"subject:" + subject: loginSubjectFreeAttempts}
+	if ip := clientIP(ctx); ip != "" {
+		keys["ip:"+ip] = loginIPFreeAttempts
+	}
+	return keys
+}
+
+// checkLoginLockout returns a LoginLockedError when the subject or the IP of
+// the context is locked out.
+func (e *Exchanger) checkLoginLockout(ctx context.Context, subject string) error {
+	if e.loginFailureCache == nil {
+		return nil
+	}
+
+	now := time.Now()
+	retryAfter := time.Duration(0)
+	for key := range loginLockoutKeys(ctx, subject) {
+		failures, err := e.getLoginFailures(ctx, key)
+		if err != nil {
+			return err
+		}
+		if until := time.UnixMilli(failures.LockedUntil); until.After(now) {
+			// Retry-After is in whole seconds
+			retryAfter = max(retryAfter, (until.Sub(now) + time.Second - 1).Truncate(time.Second))
+		}
+	}
+	if retryAfter == 0 {
+		return nil
+	}
+
+	e.auditLogin(ctx, "login_locked", AuditOutcomeFailure, subject, "retryAfter", retryAfter.String())
+	return &LoginLockedError{RetryAfter: retryAfter}
+}
+
+// recordLoginFailure counts a failed login of the subject and of the IP of the
+// context, locking them out with an exponential backoff once their free
+// attempts are spent.
+func (e *Exchanger) recordLoginFailure(ctx context.Context, subject string, cause error) error {
+	if e.loginFailureCache == nil {
+		return nil
+	}
+
+	lockedFor := time.Duration(0)
+	for key, free := range loginLockoutKeys(ctx, subject) {
+		failures, err := e.getLoginFailures(ctx, key)
+		if err != nil {
+			return err
+		}
+		failures.Count++
+		if over := failures.Count - free; over > 0 {
+			lockout := loginLockoutMax
+			if over <= 16 {
+				lockout = min(loginLockoutBase<<(over-1), loginLockoutMax)
+			}
+			failures.LockedUntil = time.Now().Add(lockout).UnixMilli()
+			lockedFor = max(lockedFor, lockout)
+		}
+		payload, err := json.Marshal(failures)
+		if err != nil {
+			return fmt.Errorf("failed to marshal login failures: %w", err)
+		}
+		if err := e.loginFailureCache.Set(ctx, key, string(payload)); err != nil {
+			return fmt.Errorf("failed to store login failures: %w", err)
+		}
+	}
+
+	if lockedFor > 0 {
+		e.auditLogin(ctx, "login_failed", AuditOutcomeFailure, subject, "error", cause.Error(), "lockedFor", lockedFor.String())
+	} else {
+		e.auditLogin(ctx, "login_failed", AuditOutcomeFailure, subject, "error", cause.Error())
+	}
+	return nil
+}
+
+// resetLoginFailures forgets the failed logins of the subject once it logs
+// in, with its second factor when it has one. Those of the IP are kept, a
+// subject of the attacker would reset them otherwise.
+func (e *Exchanger) resetLoginFailures(ctx context.Context, subject string) error {
+	e.auditLogin(ctx, "login_succeeded", AuditOutcomeSuccess, subject)
+	if e.loginFailureCache == nil {
+		return nil
+	}
+	if err := e.loginFailureCache.Delete(ctx, "subject:"+subject); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+func (e *Exchanger) getLoginFailures(ctx context.Context, key string) (loginFailures, error) {
+	var failures loginFailures
+	raw, found, _, err := e.loginFailureCache.Get(ctx, key)
+	if err != nil {
+		return failures, fmt.Errorf("failed to read login failures: %w", err)
+	}
+	if !found {
+		return failures, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &failures); err != nil {
+		return failures, fmt.Errorf("failed to parse login failures: %w", err)
+	}
+	return failures, nil
+}
+
+// auditLogin logs the audit event of a local login of the subject, and records
+// it in the audit log of the host.
+func (e *Exchanger) auditLogin(ctx context.Context, event string, outcome string, subject string, keysAndValues ...any) {
+	logf.FromContext(ctx).Info(
+		"login audit",
+		append([]any{"event", event, "subject", subject, "ip", clientIP(ctx)}, keysAndValues...)...,
+	)
+	e.config.Auditor.Record(ctx, AuditEvent{
+		Category: AuditCategoryLogin,
+		Details:  auditDetails(keysAndValues...),
+		Event:    event,
+		Outcome:  outcome,
+		Subject:  subject,
+	})
+}
+
+func newLoginFailureCache(cacheManager cache.CacheManager) cache.Cache {
+	return cacheManager.GetCache("login-failures", cache.CacheOptions{
+		TTL:      new(loginFailureTTL),
+		Uncycled: true,
+	})
+}
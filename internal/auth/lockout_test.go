@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kdex.dev/crds/api/v1alpha1"
+)
+
+func TestExchanger_LoginLockout(t *testing.T) {
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			if password != "password" {
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			return jwt.MapClaims{"sub": subject}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	}
+
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	ex, err := NewExchanger(context.Background(), *cfg, cacheManager, sp)
+	require.NoError(t, err)
+
+	fromIP := func(ip string) context.Context {
+		r := httptest.NewRequest("POST", "/-/login", nil)
+		r.RemoteAddr = ip + ":1234"
+		return cfg.WithClientIP(r)
+	}
+	ctx := fromIP("192.0.2.1")
+	var locked *LoginLockedError
+
+	// A login resets the failures of the subject
+	for range loginSubjectFreeAttempts - 1 {
+		_, err = ex.LoginLocal(ctx, "alice", "wrong", "", "", AuthMethodLocal)
+		assert.ErrorContains(t, err, "invalid credentials")
+	}
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err)
+
+	for range loginSubjectFreeAttempts {
+		_, err = ex.LoginLocal(ctx, "alice", "wrong", "", "", AuthMethodLocal)
+		assert.ErrorContains(t, err, "invalid credentials")
+	}
+	_, err = ex.LoginLocal(ctx, "alice", "wrong", "", "", AuthMethodLocal)
+	assert.ErrorContains(t, err, "invalid credentials", "the failure spending the free attempts is reported")
+
+	// The subject is locked out from every IP, even with its password
+	_, err = ex.LoginLocal(fromIP("192.0.2.2"), "alice", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &locked))
+	assert.Equal(t, loginLockoutBase, locked.RetryAfter)
+
+	failures, err := ex.getLoginFailures(ctx, "subject:alice")
+	require.NoError(t, err)
+	assert.Equal(t, loginSubjectFreeAttempts+1, failures.Count)
+
+	// Further failures double the lockout
+	require.NoError(t, ex.recordLoginFailure(ctx, "alice", fmt.Errorf("invalid credentials")))
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &locked))
+	assert.Equal(t, 2*loginLockoutBase, locked.RetryAfter)
+
+	// Other subjects log in, until their IP is locked out too
+	ctx = fromIP("198.51.100.1")
+	_, err = ex.LoginLocal(ctx, "bob", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err)
+	for i := range loginIPFreeAttempts + 1 {
+		_, err = ex.LoginLocal(ctx, fmt.Sprintf("user%d", i), "wrong", "", "", AuthMethodLocal)
+		assert.ErrorContains(t, err, "invalid credentials")
+	}
+	_, err = ex.LoginLocal(ctx, "bob", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &locked), "the IP is locked out")
+	_, err = ex.LoginLocal(fromIP("192.0.2.2"), "bob", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err)
+
+	// The clients behind the ingress are told apart by X-Forwarded-For
+	cfg.TrustedProxies = defaultTrustedProxies
+	viaIngress := func(forwardedFor string) context.Context {
+		r := httptest.NewRequest("POST", "/-/login", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		return cfg.WithClientIP(r)
+	}
+	for i := range loginIPFreeAttempts + 1 {
+		_, err = ex.LoginLocal(viaIngress("203.0.113.1"), fmt.Sprintf("other%d", i), "wrong", "", "", AuthMethodLocal)
+		assert.ErrorContains(t, err, "invalid credentials")
+	}
+	_, err = ex.LoginLocal(viaIngress("203.0.113.9, 203.0.113.1"), "bob", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &locked), "the client is locked out whatever hops it forwards")
+	_, err = ex.LoginLocal(viaIngress("203.0.113.2"), "bob", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err, "the other clients of the ingress log in")
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultTrustedProxies, proxies)
+
+	proxies, err = ParseTrustedProxies(map[string]string{TrustedProxiesAnnotation: "10.1.2.3/16, 192.0.2.7,2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.1.0.0/16", "192.0.2.7/32", "2001:db8::1/128"}, []string{proxies[0].String(), proxies[1].String(), proxies[2].String()})
+
+	_, err = ParseTrustedProxies(map[string]string{TrustedProxiesAnnotation: "ingress"})
+	assert.ErrorContains(t, err, "neither a network nor an IP")
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{name: "peer", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "forwarded by an untrusted peer", remoteAddr: "192.0.2.1:1234", forwardedFor: []string{"203.0.113.1"}, want: "192.0.2.1"},
+		{name: "forwarded by a trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"203.0.113.1"}, want: "203.0.113.1"},
+		{name: "nearest untrusted hop", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1, 203.0.113.1", "10.0.0.2"}, want: "203.0.113.1"},
+		{name: "trusted proxy forwarding no hop", remoteAddr: "10.0.0.1:1234", want: ""},
+		{name: "IPv4 mapped peer", remoteAddr: "[::ffff:10.0.0.1]:1234", forwardedFor: []string{"203.0.113.1"}, want: "203.0.113.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, forwardedFor := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", forwardedFor)
+			}
+			assert.Equal(t, tt.want, ClientIP(r, defaultTrustedProxies))
+		})
+	}
+}
+
+func TestExchanger_LoginLockoutMFA(t *testing.T) {
+	secret := NewTOTPSecret()
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			if password != "password" {
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			return jwt.MapClaims{"sub": subject}, nil
+		},
+		resolveMFA: func(subject string, identity jwt.MapClaims) (MFA, error) {
+			return MFA{Required: true, Secret: secret}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	}
+
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	ex, err := NewExchanger(context.Background(), *cfg, cacheManager, sp)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/-/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	ctx := cfg.WithClientIP(r)
+	var challenge *MFAChallenge
+	var locked *LoginLockedError
+
+	// The password alone does not reset the failed logins
+	_, err = ex.LoginLocal(ctx, "alice", "wrong", "", "", AuthMethodLocal)
+	assert.ErrorContains(t, err, "invalid credentials")
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &challenge))
+	failures, err := ex.getLoginFailures(ctx, "subject:alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures.Count)
+
+	// Wrong codes are failed logins, even across new challenges
+	for range loginSubjectFreeAttempts {
+		_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+		_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+		if errors.As(err, &locked) {
+			break
+		}
+		require.True(t, errors.As(err, &challenge))
+	}
+	require.NotNil(t, locked, "the subject is locked out by its wrong codes")
+	assert.Equal(t, loginLockoutBase, locked.RetryAfter)
+
+	failures, err = ex.getLoginFailures(ctx, "ip:192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, loginSubjectFreeAttempts+1, failures.Count, "the wrong codes count for the IP")
+
+	// The code completing the login resets the failed logins of the subject
+	require.NoError(t, ex.loginFailureCache.Delete(ctx, "subject:alice"))
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &challenge))
+	_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	code, err := TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	_, err = ex.VerifyMFA(ctx, challenge.ID, code)
+	require.NoError(t, err)
+	failures, err = ex.getLoginFailures(ctx, "subject:alice")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// auditDroppedFailed is the reason of the audit events the webhook failed
+	// to receive.
+	auditDroppedFailed = "failed"
+	// auditDroppedOverflow is the reason of the audit events dropped because
+	// too many were in flight.
+	auditDroppedOverflow = "overflow"
+)
+
+var auditEventsDroppedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kdex_host_audit_events_dropped_total",
+		Help: "Number of audit events of the host not delivered to its webhook, by reason (overflow or failed).",
+	},
+	[]string{"host", "reason"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(auditEventsDroppedCounter)
+}
@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// MFAClaim flags, in the identity of a local subject, e.g. a key of its
+	// subject secret or an LDAP attribute mapped to it, that the subject must
+	// log in with a second factor.
+	MFAClaim = "mfa"
+
+	// mfaChallengeTTL is how long the second factor of a login may be
+	// completed after its password.
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is the number of wrong codes ending a challenge.
+	mfaMaxAttempts = 5
+	// mfaFailureTTL is how long the wrong codes of a subject are counted,
+	// across its challenges, after the latest one.
+	mfaFailureTTL = time.Hour
+	// mfaLockout is how long the second factor of a subject is locked out
+	// once it entered mfaSubjectMaxFailures wrong codes.
+	mfaLockout = 15 * time.Minute
+	// mfaSubjectMaxFailures is the number of wrong codes of a subject, across
+	// its challenges, locking its second factor out. A new login with the
+	// password starts a new challenge, not a new count.
+	mfaSubjectMaxFailures = 10
+)
+
+// ErrInvalidMFACode is returned by VerifyMFA for a wrong code.
+var ErrInvalidMFACode = errors.New("invalid second factor code")
+
+// MFA is the second factor of a local subject.
+type MFA struct {
+	// Required is true when the subject must log in with a second factor,
+	// enrolling one when it has none.
+	Required bool
+	// Secret is the TOTP secret the subject enrolled, empty when none.
+	Secret string
+}
+
+// MFAChallenge is returned by LoginLocal when the subject must complete the
+// login with a second factor, verified by VerifyMFA, before its tokens are
+// minted.
+type MFAChallenge struct {
+	// Enroll is the TOTP secret the subject is enrolling, verified by the
+	// code completing the challenge. It is empty when the subject is enrolled.
+	Enroll  string
+	ID      string
+	Subject string
+}
+
+func (c *MFAChallenge) Error() string {
+	return fmt.Sprintf("second factor required for '%s'", c.Subject)
+}
+
+// mfaChallengeClaims holds the login of a challenge stored in the cache,
+// completed by its second factor.
+type mfaChallengeClaims struct {
+	Attempts   int           `json:"attempts"`
+	AuthMethod AuthMethod    `json:"auth_method"`
+	ClientID   string        `json:"cid"`
+	Enroll     string        `json:"enroll,omitempty"`
+	Enrolled   bool          `json:"enrolled"`
+	Identity   jwt.MapClaims `json:"identity"`
+	Scope      string        `json:"scp"`
+	Subject    string        `json:"sub"`
+}
+
+// IsMFAEnabled reports whether the logins may be completed with a second
+// factor.
+func (e *Exchanger) IsMFAEnabled() bool {
+	return e != nil && e.mfaChallengeCache != nil
+}
+
+// challengeMFA stores the login of the challenge, a new TOTP secret to enroll
+// when the subject has none, and returns the challenge.
+func (e *Exchanger) challengeMFA(ctx context.Context, claims mfaChallengeClaims) error {
+	if !e.IsMFAEnabled() {
+		return fmt.Errorf("second factor required for '%s' but MFA is not configured", claims.Subject)
+	}
+
+	if err := e.checkMFALockout(ctx, claims.Subject); err != nil {
+		return err
+	}
+
+	if !claims.Enrolled {
+		claims.Enroll = NewTOTPSecret()
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MFA challenge: %w", err)
+	}
+
+	id := rand.Text()
+	if err := e.mfaChallengeCache.Set(ctx, id, string(payload)); err != nil {
+		return fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+
+	return &MFAChallenge{Enroll: claims.Enroll, ID: id, Subject: claims.Subject}
+}
+
+// LookupMFAChallenge returns the challenge of the id, false when it expired or
+// was completed.
+func (e *Exchanger) LookupMFAChallenge(ctx context.Context, id string) (MFAChallenge, bool, error) {
+	claims, found, err := e.lookupMFAChallenge(ctx, id)
+	if err != nil || !found {
+		return MFAChallenge{}, false, err
+	}
+	return MFAChallenge{Enroll: claims.Enroll, ID: id, Subject: claims.Subject}, true, nil
+}
+
+func (e *Exchanger) lookupMFAChallenge(ctx context.Context, id string) (mfaChallengeClaims, bool, error) {
+	if !e.IsMFAEnabled() {
+		return mfaChallengeClaims{}, false, fmt.Errorf("MFA not configured")
+	}
+
+	raw, found, _, err := e.mfaChallengeCache.Get(ctx, id)
+	if err != nil {
+		return mfaChallengeClaims{}, false, fmt.Errorf("failed to read MFA challenge: %w", err)
+	}
+	if !found {
+		return mfaChallengeClaims{}, false, nil
+	}
+
+	var claims mfaChallengeClaims
+	if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+		return mfaChallengeClaims{}, false, fmt.Errorf("failed to parse MFA challenge: %w", err)
+	}
+	return claims, true, nil
+}
+
+// VerifyMFA completes the login of the challenge with the TOTP code of the
+// subject, enrolling the secret of the challenge when the subject is
+// enrolling, and mints its tokens. The challenge ends with the login, or after
+// mfaMaxAttempts wrong codes. A code is not accepted twice. The wrong codes of
+// the subject are also counted across its challenges, and as failed logins of
+// the subject and of the IP of the context, a LoginLockedError is returned
+// once either locks the login out. The failed logins are reset by the code
+// completing the login.
+func (e *Exchanger) VerifyMFA(ctx context.Context, id string, code string) (TokenSet, error) {
+	claims, found, err := e.lookupMFAChallenge(ctx, id)
+	if err != nil {
+		return TokenSet{}, err
+	}
+	if !found {
+		return TokenSet{}, fmt.Errorf("MFA challenge expired")
+	}
+
+	lockoutErr := e.checkLoginLockout(ctx, claims.Subject)
+	if lockoutErr == nil {
+		lockoutErr = e.checkMFALockout(ctx, claims.Subject)
+	}
+	if lockoutErr != nil {
+		if err := e.mfaChallengeCache.Delete(ctx, id); err != nil {
+			return TokenSet{}, fmt.Errorf("failed to end MFA challenge: %w", err)
+		}
+		return TokenSet{}, lockoutErr
+	}
+
+	secret := claims.Enroll
+	if secret == "" {
+		mfa, err := e.sp.FindInternalMFA(claims.Subject, jwt.MapClaims{})
+		if err != nil {
+			return TokenSet{}, fmt.Errorf("failed to resolve the second factor of '%s': %w", claims.Subject, err)
+		}
+		if mfa.Secret == "" {
+			return TokenSet{}, fmt.Errorf("second factor of '%s' is no longer enrolled", claims.Subject)
+		}
+		secret = mfa.Secret
+	}
+
+	lastStep := int64(0)
+	if raw, found, _, err := e.mfaStepCache.Get(ctx, claims.Subject); err == nil && found {
+		lastStep, _ = strconv.ParseInt(raw, 10, 64)
+	}
+
+	step, ok := verifyTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		if err := e.recordMFAFailure(ctx, claims.Subject); err != nil {
+			return TokenSet{}, err
+		}
+		if err := e.recordLoginFailure(ctx, claims.Subject, ErrInvalidMFACode); err != nil {
+			return TokenSet{}, err
+		}
+		claims.Attempts++
+		if claims.Attempts >= mfaMaxAttempts {
+			if err := e.mfaChallengeCache.Delete(ctx, id); err != nil {
+				return TokenSet{}, fmt.Errorf("failed to end MFA challenge: %w", err)
+			}
+			return TokenSet{}, ErrInvalidMFACode
+		}
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			return TokenSet{}, fmt.Errorf("failed to marshal MFA challenge: %w", err)
+		}
+		if err := e.mfaChallengeCache.Set(ctx, id, string(payload)); err != nil {
+			return TokenSet{}, fmt.Errorf("failed to store MFA challenge: %w", err)
+		}
+		return TokenSet{}, ErrInvalidMFACode
+	}
+
+	if err := e.mfaChallengeCache.Delete(ctx, id); err != nil {
+		return TokenSet{}, fmt.Errorf("failed to end MFA challenge: %w", err)
+	}
+	if err := e.mfaStepCache.Set(ctx, claims.Subject, strconv.FormatInt(step, 10)); err != nil {
+		return TokenSet{}, fmt.Errorf("failed to record the second factor code: %w", err)
+	}
+	if err := e.mfaFailureCache.Delete(ctx, claims.Subject); err != nil {
+		return TokenSet{}, fmt.Errorf("failed to reset the second factor failures: %w", err)
+	}
+	if err := e.resetLoginFailures(ctx, claims.Subject); err != nil {
+		return TokenSet{}, err
+	}
+
+	if claims.Enroll != "" {
+		if err := e.sp.SetInternalMFA(claims.Subject, claims.Enroll); err != nil {
+			return TokenSet{}, fmt.Errorf("failed to enroll the second factor of '%s': %w", claims.Subject, err)
+		}
+	}
+
+	// The authentication methods of RFC 8176
+	claims.Identity["amr"] = []string{"pwd", "otp"}
+
+	return e.mintLocal(ctx, claims.Identity, claims.Subject, claims.Scope, claims.ClientID, claims.AuthMethod)
+}
+
+// checkMFALockout returns a LoginLockedError when the second factor of the
+// subject is locked out.
+func (e *Exchanger) checkMFALockout(ctx context.Context, subject string) error {
+	failures, err := e.getMFAFailures(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	until := time.UnixMilli(failures.LockedUntil)
+	if !until.After(now) {
+		return nil
+	}
+
+	// Retry-After is in whole seconds
+	retryAfter := (until.Sub(now) + time.Second - 1).Truncate(time.Second)
+	e.auditLogin(ctx, "mfa_locked", AuditOutcomeFailure, subject, "retryAfter", retryAfter.String())
+	return &LoginLockedError{RetryAfter: retryAfter}
+}
+
+// recordMFAFailure counts a wrong code of the subject, whatever its challenge,
+// locking its second factor out for mfaLockout once it entered
+// mfaSubjectMaxFailures of them.
+func (e *Exchanger) recordMFAFailure(ctx context.Context, subject string) error {
+	failures, err := e.getMFAFailures(ctx, subject)
+	if err != nil {
+		return err
+	}
+	failures.Count++
+	if failures.Count >= mfaSubjectMaxFailures {
+		failures.LockedUntil = time.Now().Add(mfaLockout).UnixMilli()
+		e.auditLogin(ctx, "mfa_failed", AuditOutcomeFailure, subject, "lockedFor", mfaLockout.String())
+	} else {
+		e.auditLogin(ctx, "mfa_failed", AuditOutcomeFailure, subject)
+	}
+
+	payload, err := json.Marshal(failures)
+	if err != nil {
+		return fmt.Errorf("failed to marshal second factor failures: %w", err)
+	}
+	if err := e.mfaFailureCache.Set(ctx, subject, string(payload)); err != nil {
+		return fmt.Errorf("failed to store second factor failures: %w", err)
+	}
+	return nil
+}
+
+func (e *Exchanger) getMFAFailures(ctx context.Context, subject string) (loginFailures, error) {
+	var failures loginFailures
+	raw, found, _, err := e.mfaFailureCache.Get(ctx, subject)
+	if err != nil {
+		return failures, fmt.Errorf("failed to read second factor failures: %w", err)
+	}
+	if !found {
+		return failures, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &failures); err != nil {
+		return failures, fmt.Errorf("failed to parse second factor failures: %w", err)
+	}
+	return failures, nil
+}
+
+func newMFACaches(cacheManager cache.CacheManager) (cache.Cache, cache.Cache, cache.Cache) {
+	return cacheManager.GetCache("mfa-challenges", cache.CacheOptions{
+			TTL:      new(mfaChallengeTTL),
+			Uncycled: true,
+		}), cacheManager.GetCache("mfa-steps", cache.CacheOptions{
+			TTL:      new((2*totpSkew + 1) * totpPeriod),
+			Uncycled: true,
+		}), cacheManager.GetCache("mfa-failures", cache.CacheOptions{
+			TTL:      new(mfaFailureTTL),
+			Uncycled: true,
+		})
+}
+
+// FindInternalMFA returns the second factor of the subject: required when its
+// identity is flagged with MFAClaim, and the TOTP secret it enrolled in the
+// MFA secret of the host.
+func (rp *scopeProvider) FindInternalMFA(subject string, identity jwt.MapClaims) (MFA, error) {
+	mfa := MFA{}
+	switch flag := identity[MFAClaim].(type) {
+	case bool:
+		mfa.Required = flag
+	case string:
+		mfa.Required = flag == TRUE || flag == "required"
+	}
+	delete(identity, MFAClaim)
+
+	var secret corev1.Secret
+	if err := rp.Client.Get(rp.Context, client.ObjectKey{Namespace: rp.ControllerNamespace, Name: rp.mfaSecretName()}, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return mfa, nil
+		}
+		return MFA{}, err
+	}
+	mfa.Secret = string(secret.Data[mfaSecretKey(subject)])
+
+	return mfa, nil
+}
+
+// SetInternalMFA stores the TOTP secret of the subject in the MFA secret of
+// the host, created when missing.
+func (rp *scopeProvider) SetInternalMFA(subject string, totpSecret string) error {
+	var secret corev1.Secret
+	err := rp.Client.Get(rp.Context, client.ObjectKey{Namespace: rp.ControllerNamespace, Name: rp.mfaSecretName()}, &secret)
+	if apierrors.IsNotFound(err) {
+		secret = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{"kdex.dev/secret-type": "mfa"},
+				Name:        rp.mfaSecretName(),
+				Namespace:   rp.ControllerNamespace,
+			},
+			Data: map[string][]byte{mfaSecretKey(subject): []byte(totpSecret)},
+		}
+		return rp.Client.Create(rp.Context, &secret)
+	}
+	if err != nil {
+		return err
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[mfaSecretKey(subject)] = []byte(totpSecret)
+	return rp.Client.Update(rp.Context, &secret)
+}
+
+// mfaSecretName is the name of the secret holding the TOTP secrets enrolled
+// by the local subjects of the host.
+func (rp *scopeProvider) mfaSecretName() string {
+	return rp.FocalHost + "-mfa"
+}
+
+// mfaSecretKey is the key of the TOTP secret of the subject in the MFA secret,
+// the subjects not all being valid keys, e.g. LDAP distinguished names.
+func mfaSecretKey(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExchanger_VerifyMFA(t *testing.T) {
+	enrolled := map[string]string{"bob": NewTOTPSecret()}
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"email": subject + "@example.com", "mfa": subject == "alice", "sub": subject}, nil
+		},
+		resolveMFA: func(subject string, identity jwt.MapClaims) (MFA, error) {
+			required, _ := identity["mfa"].(bool)
+			delete(identity, "mfa")
+			return MFA{Required: required, Secret: enrolled[subject]}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+		enrollMFA: func(subject string, secret string) error {
+			enrolled[subject] = secret
+			return nil
+		},
+	}
+
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	ex, err := NewExchanger(context.Background(), *cfg, cacheManager, sp)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	ts, err := ex.LoginLocal(ctx, "joe", "password", "", "", AuthMethodLocal)
+	require.NoError(t, err, "subjects without a second factor log in with their password")
+	assert.NotEmpty(t, ts.AccessToken)
+
+	// A required second factor is enrolled by the code completing the login
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	var challenge *MFAChallenge
+	require.True(t, errors.As(err, &challenge))
+	assert.Equal(t, "alice", challenge.Subject)
+	require.NotEmpty(t, challenge.Enroll)
+
+	looked, found, err := ex.LookupMFAChallenge(ctx, challenge.ID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, challenge.Enroll, looked.Enroll)
+
+	_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	code, err := TOTPCode(challenge.Enroll, time.Now())
+	require.NoError(t, err)
+	ts, err = ex.VerifyMFA(ctx, challenge.ID, code)
+	require.NoError(t, err)
+	assert.Equal(t, challenge.Enroll, enrolled["alice"])
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(ts.AccessToken, claims)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"pwd", "otp"}, claims["amr"])
+	assert.NotContains(t, claims, "mfa")
+
+	_, err = ex.VerifyMFA(ctx, challenge.ID, code)
+	assert.ErrorContains(t, err, "MFA challenge expired", "a challenge is completed once")
+
+	// An enrolled subject is challenged, and its code is not accepted twice
+	_, err = ex.LoginLocal(ctx, "alice", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &challenge))
+	assert.Empty(t, challenge.Enroll)
+	_, err = ex.VerifyMFA(ctx, challenge.ID, code)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	// Wrong codes end the challenge
+	_, err = ex.LoginLocal(ctx, "bob", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &challenge))
+	for range mfaMaxAttempts {
+		_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, found, err = ex.LookupMFAChallenge(ctx, challenge.ID)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// New challenges do not reset the wrong codes of the subject
+	for i := mfaMaxAttempts; i < mfaSubjectMaxFailures; i++ {
+		// Outlasting the lockouts of the failed logins
+		require.NoError(t, ex.loginFailureCache.Delete(ctx, "subject:bob"))
+		_, err = ex.LoginLocal(ctx, "bob", "password", "", "", AuthMethodLocal)
+		require.True(t, errors.As(err, &challenge))
+		_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	var locked *LoginLockedError
+	_, err = ex.VerifyMFA(ctx, challenge.ID, "000000")
+	require.True(t, errors.As(err, &locked), "the second factor is locked out")
+	assert.Greater(t, locked.RetryAfter, 14*time.Minute)
+	_, err = ex.LoginLocal(ctx, "bob", "password", "", "", AuthMethodLocal)
+	require.True(t, errors.As(err, &locked), "no new challenge while locked out")
+
+	// The password grant cannot complete a second factor
+	_, err = ex.LoginLocal(ctx, "bob", "password", "", "client", AuthMethodOAuth2)
+	assert.ErrorContains(t, err, "second factor required")
+}
+
+func TestScopeProvider_MFA(t *testing.T) {
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	c := fake.NewClientBuilder().WithScheme(s).Build()
+	rp := &scopeProvider{Client: c, Context: context.Background(), ControllerNamespace: "kdex", FocalHost: "shop"}
+
+	identity := jwt.MapClaims{"mfa": "true", "sub": "cn=alice,dc=example,dc=com"}
+	mfa, err := rp.FindInternalMFA("cn=alice,dc=example,dc=com", identity)
+	require.NoError(t, err)
+	assert.Equal(t, MFA{Required: true}, mfa)
+	assert.NotContains(t, identity, "mfa", "the flag is not a claim of the tokens")
+
+	require.NoError(t, rp.SetInternalMFA("cn=alice,dc=example,dc=com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, rp.SetInternalMFA("bob", "KRSXG5CTMVRXEZLU"))
+
+	mfa, err = rp.FindInternalMFA("cn=alice,dc=example,dc=com", jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, MFA{Secret: "JBSWY3DPEHPK3PXP"}, mfa)
+
+	var secret corev1.Secret
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "kdex", Name: "shop-mfa"}, &secret))
+	assert.Len(t, secret.Data, 2)
+	assert.Equal(t, "mfa", secret.Annotations["kdex.dev/secret-type"])
+
+	mfa, err = (&scopeProvider{Client: c, Context: context.Background(), ControllerNamespace: "kdex", FocalHost: "other"}).FindInternalMFA("bob", jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, MFA{}, mfa, "the enrollments are those of the host")
+}
@@ -2,18 +2,39 @@ package auth
 
 import (
 	"crypto"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/pkg/jwtverify"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // WithAuthentication creates a middleware that validates JWT tokens from the Authorization header.
+// The tokens of the host are verified with the key localKey returns for their kid.
 // It injects the claims into the request context if the token is valid.
 // If the Header is present but invalid, it returns 401 Unauthorized.
 // If the Header is missing, it proceeds without claims (anonymous access).
-func WithAuthentication(publicKey crypto.PublicKey, cookieName string) func(http.Handler) http.Handler {
+// Projected service account tokens in the header are authenticated by
+// serviceAccounts when it is not nil. Tokens of the other hosts sharing their
+// sessions, in the header or in the cookie of cookieDomain, are verified by
+// trustedIssuers when it is not nil. The tokens of the host, like those of the
+// trusted issuers, must be minted for audience when it is not empty. Tokens whose jti is in revocations are rejected like invalid ones.
+// The requests made with the tokens of an impersonation are recorded in the
+// audit log of auditor, from the IP given by trustedProxies.
+func WithAuthentication(
+	localKey func(kid string) (crypto.PublicKey, error),
+	audience string,
+	cookieName string,
+	cookieDomain string,
+	serviceAccounts *ServiceAccountAuthenticator,
+	trustedIssuers *TrustedIssuers,
+	revocations *RevocationList,
+	auditor *Auditor,
+	trustedProxies []netip.Prefix,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logf.FromContext(r.Context())
@@ -54,9 +75,41 @@ func WithAuthentication(publicKey crypto.PublicKey, cookieName string) func(http
 				return
 			}
 
+			if authSource == "header" && serviceAccounts != nil && IsServiceAccountToken(tokenString) {
+				authContext, err := serviceAccounts.Authenticate(r.Context(), tokenString)
+				if err != nil {
+					log.Error(err, "Failed to authenticate service account token")
+					http.Error(w, "Invalid token", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(SetAuthContext(r.Context(), authContext)))
+				return
+			}
+
+			parserOptions := []jwt.ParserOption{jwt.WithValidMethods(jwtverify.ValidMethods)}
+			if audience != "" {
+				parserOptions = append(parserOptions, jwt.WithAudience(audience))
+			}
 			token, err := jwt.ParseWithClaims(tokenString, &authContext, func(token *jwt.Token) (any, error) {
-				return publicKey, nil
-			})
+				if issuer, _ := token.Claims.GetIssuer(); trustedIssuers.Trusts(issuer) {
+					return trustedIssuers.Key(r.Context(), token)
+				}
+				kid, _ := token.Header["kid"].(string)
+				return localKey(kid)
+			}, parserOptions...)
+
+			if err == nil && token.Valid {
+				jti, _ := authContext["jti"].(string)
+				revoked, revokedErr := revocations.IsRevoked(r.Context(), jti)
+				if revokedErr != nil {
+					log.Error(revokedErr, "Failed to check the revocation of the JWT")
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				if revoked {
+					err = fmt.Errorf("token %s is revoked", jti)
+				}
+			}
 
 			if err != nil || !token.Valid {
 				log.Error(err, "Failed to parse JWT")
@@ -64,6 +117,7 @@ func WithAuthentication(publicKey crypto.PublicKey, cookieName string) func(http
 				if authSource == "cookie" {
 					// Clear the cookie
 					http.SetCookie(w, &http.Cookie{
+						Domain: cookieDomain,
 						Name:   cookieName,
 						Value:  "",
 						Path:   "/",
@@ -78,6 +132,8 @@ func WithAuthentication(publicKey crypto.PublicKey, cookieName string) func(http
 				return
 			}
 
+			auditor.AuditImpersonatedRequest(withClientIP(r, trustedProxies), r, authContext)
+
 			// Inject authContext into context
 			ctx := SetAuthContext(r.Context(), authContext)
 			next.ServeHTTP(w, r.WithContext(ctx))
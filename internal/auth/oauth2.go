@@ -1,13 +1,19 @@
 package auth
 
 import (
+	"cmp"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/golang-jwt/jwt/v5"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -126,12 +132,18 @@ func (o *OAuth2) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The subject logged in with an OIDC provider, if any, in its session sid
+	idp, _ := authCtx["idp"].(string)
+	sid, _ := authCtx["sid"].(string)
+
 	// 4. Generate Authorization Code
 	claims := AuthorizationCodeClaims{
 		AuthMethod:          AuthMethodOAuth2,
 		ClientID:            clientId,
 		CodeChallenge:       codeChallenge,
 		CodeChallengeMethod: codeChallengeMethod,
+		Provider:            idpProvider(idp),
+		ProviderSessionID:   sid,
 		RedirectURI:         redirectURI,
 		Scope:               scope,
 		Subject:             subject,
@@ -154,9 +166,12 @@ func (o *OAuth2) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, callbackURL.String(), http.StatusFound)
 }
 
+// OAuthGet completes the login with an OIDC provider, the one named by the
+// provider path value of the callback or else the provider of the host.
 func (o *OAuth2) OAuthGet(w http.ResponseWriter, r *http.Request) {
 	log := logf.FromContext(r.Context())
 
+	provider := cmp.Or(r.PathValue("provider"), DefaultOIDCProvider)
 	code := r.URL.Query().Get("code")
 	state := r.URL.Query().Get("state")
 
@@ -165,18 +180,30 @@ func (o *OAuth2) OAuthGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := o.AuthConfig.WithClientIP(r)
+	auditFailure := func(err error) {
+		o.AuthConfig.auditor().Record(ctx, AuditEvent{
+			Category: AuditCategoryLogin,
+			Details:  map[string]string{"error": err.Error(), "provider": provider},
+			Event:    "login_failed",
+			Outcome:  AuditOutcomeFailure,
+		})
+	}
+
 	// Exchange code for ID Token
-	rawIDToken, err := o.AuthExchanger.ExchangeCode(r.Context(), code)
+	rawIDToken, err := o.AuthExchanger.ExchangeProviderCode(ctx, provider, code)
 	if err != nil {
-		log.Error(err, "failed to exchange oauth code")
+		log.Error(err, "failed to exchange oauth code", "provider", provider)
+		auditFailure(err)
 		http.Error(w, "Failed to exchange token", http.StatusUnauthorized)
 		return
 	}
 
 	// Exchange ID Token for Local Token
-	localToken, err := o.AuthExchanger.ExchangeToken(r.Context(), rawIDToken)
+	localToken, err := o.AuthExchanger.ExchangeProviderToken(ctx, provider, rawIDToken)
 	if err != nil {
-		log.Error(err, "failed to exchange for local token")
+		log.Error(err, "failed to exchange for local token", "provider", provider)
+		auditFailure(err)
 		http.Error(w, "Failed to exchange for local token", http.StatusUnauthorized)
 		return
 	}
@@ -194,6 +221,7 @@ func (o *OAuth2) OAuthGet(w http.ResponseWriter, r *http.Request) {
 		Name:     o.AuthConfig.CookieName,
 		Value:    localToken,
 		Path:     "/",
+		Domain:   o.AuthConfig.CookieDomain,
 		HttpOnly: true,
 		Secure:   r.URL.Scheme == "https",
 		SameSite: http.SameSiteLaxMode,
@@ -209,7 +237,7 @@ func (o *OAuth2) OAuthGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
-	var clientId, clientSecret, code, codeVerifier, grantType, password, redirectURI, scope, username string
+	var clientId, clientSecret, code, codeVerifier, grantType, issuedTokenType, password, redirectURI, scope, username string
 	var ts TokenSet
 	var err error
 
@@ -230,6 +258,23 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 			"subject", ts.Subject,
 			"username", username)
 	}()
+	defer func() {
+		// The unknown grants and the rejected clients are audited too
+		event := "token_issued"
+		switch grantType {
+		case "refresh_token":
+			event = "refresh_token_redeemed"
+		case GrantTypeTokenExchange:
+			event = "token_exchanged"
+		}
+		o.AuthConfig.auditor().Record(o.AuthConfig.WithClientIP(r), AuditEvent{
+			Category: AuditCategoryToken,
+			Details:  auditDetails("client_id", clientId, "error", err, "grant_type", grantType, "scope", ts.Scope),
+			Event:    event,
+			Outcome:  auditOutcome(err),
+			Subject:  ts.Subject,
+		})
+	}()
 
 	if r.Method != http.MethodPost {
 		err = fmt.Errorf("method not allowed")
@@ -256,6 +301,8 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 							|Public      |username, password, client_id                      |scope
 		refresh_token       |Private     |refresh_token, client_id, client_secret            |scope
 							|Public      |refresh_token, client_id                           |scope
+		token-exchange      |Private     |subject_token, subject_token_type, client_id,      |audience, resource, scope,
+							|            |client_secret                                      |requested_token_type
 	*/
 
 	if clientId == "" {
@@ -326,7 +373,12 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 	case "password":
 		username = r.FormValue("username")
 		password = r.FormValue("password")
-		ts, err = o.AuthExchanger.LoginLocal(r.Context(), username, password, scope, clientId, AuthMethodOAuth2)
+		ts, err = o.AuthExchanger.LoginLocal(o.AuthConfig.WithClientIP(r), username, password, scope, clientId, AuthMethodOAuth2)
+		if locked := (*LoginLockedError)(nil); errors.As(err, &locked) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())))
+			http.Error(w, "Too many failed logins", http.StatusTooManyRequests)
+			return
+		}
 	case "refresh_token":
 		tokenID := r.FormValue("refresh_token")
 		if tokenID == "" {
@@ -335,6 +387,37 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		ts, err = o.AuthExchanger.RedeemRefreshToken(r.Context(), tokenID, clientId)
+	case GrantTypeTokenExchange:
+		if client.Public {
+			err = fmt.Errorf("token-exchange grant_type is not supported for public clients")
+			http.Error(w, "token-exchange grant_type is not supported for public clients", http.StatusBadRequest)
+			return
+		}
+		subjectToken := r.FormValue("subject_token")
+		if subjectToken == "" {
+			err = fmt.Errorf("subject_token is required")
+			http.Error(w, "subject_token is required", http.StatusBadRequest)
+			return
+		}
+		if subjectTokenType := r.FormValue("subject_token_type"); subjectTokenType != TokenTypeAccessToken && subjectTokenType != TokenTypeJWT {
+			err = fmt.Errorf("unsupported subject_token_type %q", subjectTokenType)
+			http.Error(w, "Unsupported subject_token_type", http.StatusBadRequest)
+			return
+		}
+		issuedTokenType = cmp.Or(r.FormValue("requested_token_type"), TokenTypeAccessToken)
+		if issuedTokenType != TokenTypeAccessToken && issuedTokenType != TokenTypeJWT {
+			err = fmt.Errorf("unsupported requested_token_type %q", issuedTokenType)
+			http.Error(w, "Unsupported requested_token_type", http.StatusBadRequest)
+			return
+		}
+		// The client authenticating the request is the actor.
+		if r.FormValue("actor_token") != "" {
+			err = fmt.Errorf("actor_token is not supported")
+			http.Error(w, "actor_token is not supported", http.StatusBadRequest)
+			return
+		}
+		audiences := slices.Concat(r.Form["audience"], r.Form["resource"])
+		ts, err = o.AuthExchanger.ExchangeAccessToken(r.Context(), clientId, subjectToken, audiences, scope)
 	default:
 		err = fmt.Errorf("unsupported grant_type")
 		http.Error(w, "Unsupported grant_type", http.StatusBadRequest)
@@ -348,12 +431,13 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := TokenResponse{
-		AccessToken:  ts.AccessToken,
-		ExpiresIn:    int(o.AuthExchanger.GetTokenTTL().Seconds()),
-		IDToken:      ts.IDToken,
-		RefreshToken: ts.RefreshToken,
-		Scope:        ts.Scope,
-		TokenType:    "Bearer",
+		AccessToken:     ts.AccessToken,
+		ExpiresIn:       int(o.AuthExchanger.GetTokenTTL().Seconds()),
+		IDToken:         ts.IDToken,
+		IssuedTokenType: issuedTokenType,
+		RefreshToken:    ts.RefreshToken,
+		Scope:           ts.Scope,
+		TokenType:       "Bearer",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -364,12 +448,274 @@ func (o *OAuth2) OAuth2TokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// IntrospectHandler implements the token introspection of RFC 7662 for the
+// confidential clients of the host. Access tokens minted by the host are
+// active while their signature and expiry are valid and they are not revoked,
+// and refresh tokens while
+// they are stored and were issued to the introspecting client. Any other token
+// is reported as inactive.
+func (o *OAuth2) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	var active bool
+	var clientId, tokenTypeHint string
+	var err error
+
+	log := logf.FromContext(r.Context())
+	defer func() {
+		log.Info(
+			"OAuth2 token introspection",
+			"active", active,
+			"client_id", clientId,
+			"error", err,
+			"token_type_hint", tokenTypeHint)
+	}()
+
+	if r.Method != http.MethodPost {
+		err = fmt.Errorf("method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("failed to parse form: %w", err)
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var client AuthClient
+	client, err = o.authenticateClient(r)
+	clientId = client.ClientID
+	if err == nil && client.Public {
+		err = fmt.Errorf("public clients cannot introspect tokens")
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		http.Error(w, "Invalid client credentials", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		err = fmt.Errorf("token is required")
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	tokenTypeHint = r.FormValue("token_type_hint")
+
+	lookups := []func() (map[string]any, error){
+		func() (map[string]any, error) { return o.introspectAccessToken(r, token) },
+		func() (map[string]any, error) { return o.introspectRefreshToken(r, token, clientId) },
+	}
+	if tokenTypeHint == "refresh_token" {
+		slices.Reverse(lookups)
+	}
+
+	resp := map[string]any{"active": false}
+	for _, lookup := range lookups {
+		var claims map[string]any
+		if claims, err = lookup(); claims != nil {
+			resp = claims
+			active = true
+			break
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		err = fmt.Errorf("failed to encode introspection response: %w", err)
+		http.Error(w, "Failed to encode introspection response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RevokeHandler implements the token revocation of RFC 7009. Refresh tokens
+// are deleted when they were issued to the requesting client, and the jti of
+// access tokens minted by the host is added to the revocation list checked by
+// the authentication middleware until the token expires. Unknown or invalid
+// tokens are ignored, as the specification requires.
+func (o *OAuth2) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	var clientId, jti, tokenTypeHint string
+	var revoked bool
+	var err error
+
+	log := logf.FromContext(r.Context())
+	defer func() {
+		log.Info(
+			"OAuth2 token revocation",
+			"client_id", clientId,
+			"error", err,
+			"jti", jti,
+			"revoked", revoked,
+			"token_type_hint", tokenTypeHint)
+	}()
+	defer func() {
+		// A token that is unknown or not valid is not revoked, nor audited
+		if !revoked && err == nil {
+			return
+		}
+		o.AuthConfig.auditor().Record(o.AuthConfig.WithClientIP(r), AuditEvent{
+			Category: AuditCategoryRevocation,
+			Details:  auditDetails("client_id", clientId, "error", err, "jti", jti, "token_type_hint", tokenTypeHint),
+			Event:    "token_revoked",
+			Outcome:  auditOutcome(err),
+		})
+	}()
+
+	if r.Method != http.MethodPost {
+		err = fmt.Errorf("method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("failed to parse form: %w", err)
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var client AuthClient
+	if client, err = o.authenticateClient(r); err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="revoke"`)
+		http.Error(w, "Invalid client credentials", http.StatusUnauthorized)
+		return
+	}
+	clientId = client.ClientID
+
+	token := r.FormValue("token")
+	if token == "" {
+		err = fmt.Errorf("token is required")
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	tokenTypeHint = r.FormValue("token_type_hint")
+
+	if o.AuthExchanger.IsRefreshTokenEnabled() {
+		if revoked, err = o.AuthExchanger.RevokeRefreshToken(r.Context(), token, clientId); err != nil {
+			http.Error(w, "Failed to revoke token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !revoked {
+		claims, verifyErr := o.AuthConfig.VerifyLocalToken(token)
+		if verifyErr == nil {
+			if o.AuthConfig.Revocations == nil {
+				err = fmt.Errorf("access token revocation not configured")
+				http.Error(w, "Unsupported token type", http.StatusBadRequest)
+				return
+			}
+			if issuedTo := tokenClientID(claims); issuedTo != "" && issuedTo != clientId {
+				err = fmt.Errorf("access token was not issued to this client")
+				http.Error(w, "Failed to revoke token", http.StatusBadRequest)
+				return
+			}
+			jti, _ = claims["jti"].(string)
+			if err = o.AuthConfig.Revocations.Revoke(r.Context(), jti); err != nil {
+				err = fmt.Errorf("failed to revoke access token: %w", err)
+				http.Error(w, "Failed to revoke token", http.StatusServiceUnavailable)
+				return
+			}
+			revoked = true
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateClient returns the client of the credentials of a request, in
+// its basic auth or in its form. Public clients only present their client_id.
+func (o *OAuth2) authenticateClient(r *http.Request) (AuthClient, error) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID == "" {
+		clientID = r.FormValue("client_id")
+		clientSecret = r.FormValue("client_secret")
+	}
+
+	client, ok := o.AuthExchanger.GetClient(clientID)
+	if !ok {
+		return AuthClient{ClientID: clientID}, fmt.Errorf("invalid client_id")
+	}
+	if !client.Public && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(client.ClientSecret)) != 1 {
+		return AuthClient{ClientID: clientID}, fmt.Errorf("invalid client_secret")
+	}
+	return client, nil
+}
+
+// introspectAccessToken returns the claims of an active access token minted by
+// the host, or nil.
+func (o *OAuth2) introspectAccessToken(r *http.Request, token string) (map[string]any, error) {
+	claims, err := o.AuthConfig.VerifyLocalToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	jti, _ := claims["jti"].(string)
+	if revoked, err := o.AuthConfig.Revocations.IsRevoked(r.Context(), jti); err != nil || revoked {
+		return nil, err
+	}
+
+	resp := map[string]any{}
+	maps.Copy(resp, claims)
+	resp["active"] = true
+	resp["token_type"] = "access_token"
+	if clientID := tokenClientID(claims); clientID != "" {
+		resp["client_id"] = clientID
+	}
+	return resp, nil
+}
+
+// tokenClientID returns the client an access token was minted for, when it is
+// known: the authorized party, the actor of an exchanged token, or the subject
+// of a client_credentials grant.
+func tokenClientID(claims jwt.MapClaims) string {
+	if azp, ok := claims["azp"].(string); ok {
+		return azp
+	}
+	if act, ok := claims["act"].(map[string]any); ok {
+		sub, _ := act["sub"].(string)
+		return sub
+	}
+	if grantType, _ := claims["grant_type"].(string); grantType == "client_credentials" {
+		sub, _ := claims.GetSubject()
+		return sub
+	}
+	return ""
+}
+
+// introspectRefreshToken returns the claims of an active refresh token issued
+// to clientID, or nil.
+func (o *OAuth2) introspectRefreshToken(r *http.Request, token string, clientID string) (map[string]any, error) {
+	if !o.AuthExchanger.IsRefreshTokenEnabled() {
+		return nil, nil
+	}
+
+	claims, found, err := o.AuthExchanger.LookupRefreshToken(r.Context(), token)
+	if err != nil || !found || claims.ClientID != clientID {
+		return nil, err
+	}
+
+	resp := map[string]any{
+		"active":     true,
+		"client_id":  claims.ClientID,
+		"exp":        claims.ExpiresAt,
+		"iat":        claims.IssuedAt,
+		"sub":        claims.Subject,
+		"token_type": "refresh_token",
+	}
+	if claims.Scope != "" {
+		resp["scope"] = claims.Scope
+	}
+	return resp, nil
+}
+
 // TokenResponse represents the OAuth2 token response.
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	IDToken      string `json:"id_token,omitempty"`
-	RefreshToken string `json:"refresh_token,omitempty"`
-	Scope        string `json:"scope,omitempty"`
-	TokenType    string `json:"token_type"`
+	AccessToken     string `json:"access_token"`
+	ExpiresIn       int    `json:"expires_in"`
+	IDToken         string `json:"id_token,omitempty"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	TokenType       string `json:"token_type"`
 }
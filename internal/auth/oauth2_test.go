@@ -2,6 +2,9 @@ package auth
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +15,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
 	"github.com/kdex-tech/host-manager/internal/keys"
 	"github.com/kdex-tech/host-manager/internal/sign"
 	"github.com/stretchr/testify/assert"
@@ -176,3 +180,294 @@ func TestOAuth2TokenHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestOAuth2IntrospectHandler(t *testing.T) {
+	keyPairs := keys.GenerateECDSAKeyPair()
+	signer, _ := sign.NewSigner("aud", time.Hour, "iss", &keyPairs.ActiveKey().Private, keyPairs.ActiveKey().KeyId, nil)
+	cfg := Config{
+		ActivePair: keyPairs.ActiveKey(),
+		KeyPairs:   keyPairs,
+		Clients: map[string]AuthClient{
+			"api":    {ClientID: "api", ClientSecret: "api-secret"},
+			"other":  {ClientID: "other", ClientSecret: "other-secret"},
+			"public": {ClientID: "public", Public: true},
+		},
+		Signer:   *signer,
+		TokenTTL: time.Hour,
+	}
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": subject, "entitlements": []string{"orders:read"}}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	}
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	ex, _ := NewExchanger(context.Background(), cfg, cacheManager, sp)
+	ts, err := ex.LoginLocal(context.Background(), "joe", "secret", "entitlements", "api", AuthMethodOAuth2)
+	assert.NoError(t, err)
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := sign.SignClaims(otherKey, keyPairs.ActiveKey().KeyId, jwt.MapClaims{"sub": "joe", "exp": time.Now().Add(time.Hour).Unix()})
+	expired, _ := sign.SignClaims(keyPairs.ActiveKey().Private, keyPairs.ActiveKey().KeyId, jwt.MapClaims{"sub": "joe", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	introspect := func(clientID, clientSecret string, form url.Values) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/-/oauth/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if clientID != "" {
+			req.SetBasicAuth(clientID, clientSecret)
+		}
+		w := httptest.NewRecorder()
+		(&OAuth2{AuthConfig: &cfg, AuthExchanger: ex}).IntrospectHandler(w, req)
+		resp := map[string]any{}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	w, _ := introspect("", "", url.Values{"token": {ts.AccessToken}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "no client credentials")
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	w, _ = introspect("api", "wrong", url.Values{"token": {ts.AccessToken}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = introspect("public", "", url.Values{"token": {ts.AccessToken}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "public clients cannot introspect")
+	w, _ = introspect("api", "api-secret", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, resp := introspect("other", "other-secret", url.Values{"token": {ts.AccessToken}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, true, resp["active"])
+	assert.Equal(t, "access_token", resp["token_type"])
+	assert.Equal(t, "joe", resp["sub"])
+	assert.Equal(t, "entitlements", resp["scope"])
+	assert.NotEmpty(t, resp["exp"])
+	assert.NotEmpty(t, resp["jti"])
+
+	for name, token := range map[string]string{"forged": forged, "expired": expired, "unknown": "opaque"} {
+		_, resp = introspect("api", "api-secret", url.Values{"token": {token}})
+		assert.Equal(t, map[string]any{"active": false}, resp, name)
+	}
+
+	_, resp = introspect("api", "api-secret", url.Values{"token": {ts.RefreshToken}, "token_type_hint": {"refresh_token"}})
+	assert.Equal(t, true, resp["active"])
+	assert.Equal(t, "refresh_token", resp["token_type"])
+	assert.Equal(t, "api", resp["client_id"])
+	assert.Equal(t, "joe", resp["sub"])
+	assert.NotEmpty(t, resp["exp"])
+
+	_, resp = introspect("other", "other-secret", url.Values{"token": {ts.RefreshToken}})
+	assert.Equal(t, map[string]any{"active": false}, resp, "issued to another client")
+
+	_, err = ex.RedeemRefreshToken(context.Background(), ts.RefreshToken, "api")
+	assert.NoError(t, err)
+	_, resp = introspect("api", "api-secret", url.Values{"token": {ts.RefreshToken}})
+	assert.Equal(t, map[string]any{"active": false}, resp, "redeemed")
+}
+
+func TestOAuth2RevokeHandler(t *testing.T) {
+	keyPairs := keys.GenerateECDSAKeyPair()
+	signer, _ := sign.NewSigner("aud", time.Hour, "iss", &keyPairs.ActiveKey().Private, keyPairs.ActiveKey().KeyId, nil)
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg := Config{
+		ActivePair: keyPairs.ActiveKey(),
+		CookieName: "auth_token",
+		KeyPairs:   keyPairs,
+		Clients: map[string]AuthClient{
+			"api":    {ClientID: "api", ClientSecret: "api-secret"},
+			"m2m":    {ClientID: "m2m", ClientSecret: "m2m-secret"},
+			"public": {ClientID: "public", Public: true},
+		},
+		Revocations: NewRevocationList(cacheManager, time.Hour),
+		Signer:      *signer,
+		TokenTTL:    time.Hour,
+	}
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": subject}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	}
+	ex, _ := NewExchanger(context.Background(), cfg, cacheManager, sp)
+	o := &OAuth2{AuthConfig: &cfg, AuthExchanger: ex}
+
+	revoke := func(clientID, clientSecret string, form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, "/-/oauth/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientSecret)
+		w := httptest.NewRecorder()
+		o.RevokeHandler(w, req)
+		return w.Code
+	}
+	authenticated := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		cfg.AddAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	user, err := ex.LoginLocal(context.Background(), "joe", "secret", "", "public", AuthMethodOAuth2)
+	assert.NoError(t, err)
+	m2m, err := ex.LoginClient(context.Background(), "m2m", "m2m-secret", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, revoke("api", "wrong", url.Values{"token": {user.AccessToken}}))
+	assert.Equal(t, http.StatusUnauthorized, revoke("unknown", "", url.Values{"token": {user.AccessToken}}))
+	assert.Equal(t, http.StatusBadRequest, revoke("api", "api-secret", url.Values{}))
+	assert.Equal(t, http.StatusOK, revoke("api", "api-secret", url.Values{"token": {"opaque"}}), "unknown tokens are ignored")
+
+	// Refresh tokens are only revoked by the client they were issued to.
+	assert.Equal(t, http.StatusBadRequest, revoke("api", "api-secret", url.Values{"token": {user.RefreshToken}}))
+	assert.Equal(t, http.StatusOK, revoke("public", "", url.Values{"token": {user.RefreshToken}, "token_type_hint": {"refresh_token"}}))
+	_, err = ex.RedeemRefreshToken(context.Background(), user.RefreshToken, "public")
+	assert.Error(t, err, "the refresh token is revoked")
+
+	// Access tokens are rejected by the middleware once revoked.
+	assert.Equal(t, http.StatusOK, authenticated(user.AccessToken))
+	assert.Equal(t, http.StatusOK, revoke("public", "", url.Values{"token": {user.AccessToken}}))
+	assert.Equal(t, http.StatusUnauthorized, authenticated(user.AccessToken))
+
+	assert.Equal(t, http.StatusBadRequest, revoke("api", "api-secret", url.Values{"token": {m2m.AccessToken}}), "issued to another client")
+	assert.Equal(t, http.StatusOK, authenticated(m2m.AccessToken))
+	assert.Equal(t, http.StatusOK, revoke("m2m", "m2m-secret", url.Values{"token": {m2m.AccessToken}}))
+	assert.Equal(t, http.StatusUnauthorized, authenticated(m2m.AccessToken))
+
+	req := httptest.NewRequest(http.MethodPost, "/-/oauth/introspect", strings.NewReader(url.Values{"token": {m2m.AccessToken}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("api", "api-secret")
+	w := httptest.NewRecorder()
+	o.IntrospectHandler(w, req)
+	assert.JSONEq(t, `{"active": false}`, w.Body.String(), "revoked tokens are not active")
+}
+
+func TestOAuth2TokenHandler_TokenExchange(t *testing.T) {
+	keyPairs := keys.GenerateECDSAKeyPair()
+	signer, _ := sign.NewSigner("aud", time.Hour, "iss", &keyPairs.ActiveKey().Private, keyPairs.ActiveKey().KeyId, nil)
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg := Config{
+		ActivePair: keyPairs.ActiveKey(),
+		KeyPairs:   keyPairs,
+		Clients: map[string]AuthClient{
+			"orders":   {ClientID: "orders", ClientSecret: "orders-secret"},
+			"payments": {ClientID: "payments", ClientSecret: "payments-secret", AllowedScopes: []string{"email", "entitlements", "openid"}},
+			"public":   {ClientID: "public", Public: true},
+		},
+		Revocations: NewRevocationList(cacheManager, time.Hour),
+		Signer:      *signer,
+		TokenTTL:    time.Hour,
+	}
+	sp := &mockScopeProvider{
+		resolveIdentity: func(subject string, password string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": subject, "email": subject + "@example.com", "roles": []string{"buyer"}, "entitlements": []string{"orders:read"}}, nil
+		},
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	}
+	ex, _ := NewExchanger(context.Background(), cfg, cacheManager, sp)
+	o := &OAuth2{AuthConfig: &cfg, AuthExchanger: ex}
+
+	exchange := func(clientID, clientSecret string, form url.Values) (int, map[string]any, jwt.MapClaims) {
+		form.Set("grant_type", GrantTypeTokenExchange)
+		req := httptest.NewRequest(http.MethodPost, "/-/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientSecret)
+		w := httptest.NewRecorder()
+		o.OAuth2TokenHandler(w, req)
+		if w.Code != http.StatusOK {
+			return w.Code, nil, nil
+		}
+		resp := map[string]any{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		claims, err := cfg.VerifyLocalToken(resp["access_token"].(string))
+		assert.NoError(t, err)
+		return w.Code, resp, claims
+	}
+
+	user, err := ex.LoginLocal(context.Background(), "joe", "secret", "", "public", AuthMethodOAuth2)
+	assert.NoError(t, err)
+
+	code, resp, claims := exchange("orders", "orders-secret", url.Values{
+		"audience":           {"payments"},
+		"scope":              {"email entitlements"},
+		"subject_token":      {user.AccessToken},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, TokenTypeAccessToken, resp["issued_token_type"])
+	assert.Equal(t, "email entitlements", resp["scope"])
+	assert.Nil(t, resp["refresh_token"], "exchanged tokens are not refreshed")
+	assert.Equal(t, "joe", claims["sub"])
+	assert.Equal(t, []any{"payments"}, claims["aud"])
+	assert.Equal(t, map[string]any{"sub": "orders"}, claims["act"])
+	assert.Equal(t, "joe@example.com", claims["email"])
+	assert.Equal(t, []any{"orders:read"}, claims["entitlements"])
+	assert.Nil(t, claims["roles"], "the roles are out of scope")
+
+	// The token is exchanged again down the chain of calls, the scopes not
+	// allowed to the client are dropped.
+	code, resp, nested := exchange("payments", "payments-secret", url.Values{
+		"resource":           {"https://ledger.example.com"},
+		"subject_token":      {user.AccessToken},
+		"subject_token_type": {TokenTypeJWT},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "openid email entitlements", resp["scope"])
+	assert.Nil(t, nested["roles"])
+	assert.Nil(t, nested["name"])
+
+	code, _, nested = exchange("payments", "payments-secret", url.Values{
+		"requested_token_type": {TokenTypeJWT},
+		"subject_token":        {mustExchangeToken(t, ex, "orders", user.AccessToken)},
+		"subject_token_type":   {TokenTypeAccessToken},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"sub": "payments", "act": map[string]any{"sub": "orders"}}, nested["act"])
+	assert.Equal(t, "payments", tokenClientID(nested))
+
+	code, _, _ = exchange("orders", "orders-secret", url.Values{
+		"scope":              {"email admin"},
+		"subject_token":      {user.AccessToken},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code, "the scopes are only narrowed")
+
+	code, _, _ = exchange("payments", "payments-secret", url.Values{
+		"scope":              {"roles"},
+		"subject_token":      {user.AccessToken},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code, "the scope is not allowed to the client")
+
+	code, _, _ = exchange("public", "", url.Values{"subject_token": {user.AccessToken}, "subject_token_type": {TokenTypeAccessToken}})
+	assert.Equal(t, http.StatusBadRequest, code, "public clients do not exchange tokens")
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token_type": {TokenTypeAccessToken}})
+	assert.Equal(t, http.StatusBadRequest, code, "subject_token is required")
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token": {user.AccessToken}, "subject_token_type": {"urn:ietf:params:oauth:token-type:id_token"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token": {user.AccessToken}, "subject_token_type": {TokenTypeAccessToken}, "requested_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token": {user.AccessToken}, "subject_token_type": {TokenTypeAccessToken}, "actor_token": {user.AccessToken}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token": {"forged"}, "subject_token_type": {TokenTypeAccessToken}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	claims, err = cfg.VerifyLocalToken(user.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Revocations.Revoke(context.Background(), claims["jti"].(string)))
+	code, _, _ = exchange("orders", "orders-secret", url.Values{"subject_token": {user.AccessToken}, "subject_token_type": {TokenTypeAccessToken}})
+	assert.Equal(t, http.StatusUnauthorized, code, "revoked tokens are not exchanged")
+}
+
+func mustExchangeToken(t *testing.T, ex *Exchanger, clientID, subjectToken string) string {
+	t.Helper()
+	ts, err := ex.ExchangeAccessToken(context.Background(), clientID, subjectToken, nil, "")
+	assert.NoError(t, err)
+	return ts.AccessToken
+}
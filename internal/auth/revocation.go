@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/cache"
+)
+
+// RevocationList records the jti of the revoked access tokens of a host. An
+// entry is kept for the lifetime of the tokens of the host, after which the
+// token it revokes has expired anyway.
+type RevocationList struct {
+	cache cache.Cache
+}
+
+// NewRevocationList returns the revocation list of the tokens living for ttl.
+func NewRevocationList(cacheManager cache.CacheManager, ttl time.Duration) *RevocationList {
+	return &RevocationList{
+		cache: cacheManager.GetCache("revoked-tokens", cache.CacheOptions{
+			TTL:      &ttl,
+			Uncycled: true,
+		}),
+	}
+}
+
+// IsRevoked returns whether the token with the jti was revoked. Nothing is
+// revoked by a nil list.
+func (l *RevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if l == nil || jti == "" {
+		return false, nil
+	}
+	_, found, _, err := l.cache.Get(ctx, jti)
+	return found, err
+}
+
+// Revoke records the revocation of the token with the jti.
+func (l *RevocationList) Revoke(ctx context.Context, jti string) error {
+	if l == nil || jti == "" {
+		return nil
+	}
+	return l.cache.Set(ctx, jti, time.Now().UTC().Format(time.RFC3339))
+}
@@ -24,7 +24,12 @@ type Lookup interface {
 
 type InternalIdentityProvider interface {
 	FindInternal(subject string, password string) (jwt.MapClaims, error)
+	// FindInternalMFA returns the second factor of the subject authenticated
+	// with the identity, removing the MFA requirement flag from the identity.
+	FindInternalMFA(subject string, identity jwt.MapClaims) (MFA, error)
 	FindInternalRolesAndEntitlements(subject string) ([]string, []string, error)
+	// SetInternalMFA enrolls the TOTP secret of the subject.
+	SetInternalMFA(subject string, secret string) error
 }
 
 type scopeProvider struct {
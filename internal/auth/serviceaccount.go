@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AuthMethodServiceAccount is the auth method of the workloads calling
+	// the host with a projected service account token.
+	AuthMethodServiceAccount AuthMethod = "serviceaccount"
+
+	// ServiceAccountEntitlementsAnnotation maps, on a host, the service
+	// accounts allowed to call it with a projected token to the entitlements
+	// they are granted, e.g. {"shop/orders":["orders:write"]}. Service
+	// accounts are named namespace/name. Tokens of other service accounts are
+	// rejected.
+	ServiceAccountEntitlementsAnnotation = "kdex.dev/service-account-entitlements"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+
+	// serviceAccountReviewTTL bounds how long a reviewed token is trusted
+	// without a new TokenReview, which also bounds how long a revoked token
+	// is still accepted.
+	serviceAccountReviewTTL = time.Minute
+)
+
+// ParseServiceAccountEntitlements returns the entitlements of the service
+// accounts of ServiceAccountEntitlementsAnnotation, nil when it is not set.
+func ParseServiceAccountEntitlements(annotations map[string]string) (map[string][]string, error) {
+	value := annotations[ServiceAccountEntitlementsAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	entitlements := map[string][]string{}
+	if err := json.Unmarshal([]byte(value), &entitlements); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q, expected a JSON object of entitlements by namespace/name: %w", ServiceAccountEntitlementsAnnotation, value, err)
+	}
+	for serviceAccount := range entitlements {
+		if namespace, name, ok := strings.Cut(serviceAccount, "/"); !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("invalid %s annotation %q, expected service accounts named namespace/name, got %q", ServiceAccountEntitlementsAnnotation, value, serviceAccount)
+		}
+	}
+	return entitlements, nil
+}
+
+// ServiceAccountAuthenticator authenticates the projected service account
+// tokens of the workloads calling the host, functions in particular, with a
+// TokenReview. A token is accepted when it was issued for the audience of the
+// host to one of the service accounts of Entitlements.
+type ServiceAccountAuthenticator struct {
+	Audience     string
+	Client       client.Client
+	Entitlements map[string][]string
+
+	mu      sync.Mutex
+	reviews map[[sha256.Size]byte]serviceAccountReview
+}
+
+type serviceAccountReview struct {
+	authContext AuthContext
+	expires     time.Time
+}
+
+// NewServiceAccountAuthenticator returns an authenticator of the tokens
+// issued for the audience to the service accounts of entitlements.
+func NewServiceAccountAuthenticator(c client.Client, audience string, entitlements map[string][]string) *ServiceAccountAuthenticator {
+	return &ServiceAccountAuthenticator{
+		Audience:     audience,
+		Client:       c,
+		Entitlements: entitlements,
+		reviews:      map[[sha256.Size]byte]serviceAccountReview{},
+	}
+}
+
+// IsServiceAccountToken reports whether the token was issued by the
+// Kubernetes API server to a service account, without verifying it.
+func IsServiceAccountToken(tokenString string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return false
+	}
+	_, ok := claims["kubernetes.io"]
+	return ok
+}
+
+// Authenticate reviews the token and returns the auth context of the
+// internal service identity of its service account: its subject is the
+// service account and its entitlements those granted to it.
+func (a *ServiceAccountAuthenticator) Authenticate(ctx context.Context, tokenString string) (AuthContext, error) {
+	key := sha256.Sum256([]byte(tokenString))
+
+	a.mu.Lock()
+	review, ok := a.reviews[key]
+	a.mu.Unlock()
+	if ok && time.Now().Before(review.expires) {
+		return review.authContext, nil
+	}
+
+	tokenReview := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Audiences: []string{a.Audience},
+			Token:     tokenString,
+		},
+	}
+	if err := a.Client.Create(ctx, tokenReview); err != nil {
+		return nil, fmt.Errorf("failed to review service account token: %w", err)
+	}
+	status := tokenReview.Status
+	if !status.Authenticated {
+		return nil, fmt.Errorf("service account token not authenticated: %s", status.Error)
+	}
+	if !slices.Contains(status.Audiences, a.Audience) {
+		return nil, fmt.Errorf("service account token not issued for audience %s", a.Audience)
+	}
+
+	serviceAccount, ok := strings.CutPrefix(status.User.Username, serviceAccountPrefix)
+	if !ok {
+		return nil, fmt.Errorf("token of %s is not a service account token", status.User.Username)
+	}
+	serviceAccount = strings.Replace(serviceAccount, ":", "/", 1)
+	entitlements, ok := a.Entitlements[serviceAccount]
+	if !ok {
+		return nil, fmt.Errorf("service account %s is not allowed to call the host", serviceAccount)
+	}
+
+	expires := time.Now().Add(serviceAccountReviewTTL)
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err == nil {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+			expires = exp.Time
+		}
+	}
+
+	authContext := AuthContext{
+		"auth_method":  string(AuthMethodServiceAccount),
+		"entitlements": slices.Clone(entitlements),
+		"exp":          expires.Unix(),
+		"sub":          serviceAccount,
+	}
+
+	a.mu.Lock()
+	for k, r := range a.reviews {
+		if time.Now().After(r.expires) {
+			delete(a.reviews, k)
+		}
+	}
+	a.reviews[key] = serviceAccountReview{authContext: authContext, expires: expires}
+	a.mu.Unlock()
+
+	return authContext, nil
+}
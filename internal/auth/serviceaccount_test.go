@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// serviceAccountToken returns an unsigned token shaped like a projected
+// service account token, the fake TokenReview does not verify it.
+func serviceAccountToken(t *testing.T, serviceAccount string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"aud":           []string{"https://shop.example.com"},
+		"exp":           time.Now().Add(time.Hour).Unix(),
+		"kubernetes.io": map[string]any{"serviceaccount": map[string]any{"name": serviceAccount}},
+		"sub":           "system:serviceaccount:shop:" + serviceAccount,
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	return token
+}
+
+// tokenReviewClient authenticates every token of the form of
+// serviceAccountToken, counting the reviews.
+func tokenReviewClient(t *testing.T, reviews *int) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authenticationv1.TokenReview)
+			if !ok {
+				return c.Create(ctx, obj, opts...)
+			}
+			*reviews++
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(review.Spec.Token, claims); err != nil {
+				return nil
+			}
+			sub, _ := claims.GetSubject()
+			review.Status = authenticationv1.TokenReviewStatus{
+				Audiences:     review.Spec.Audiences,
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: sub},
+			}
+			return nil
+		},
+	}).Build()
+}
+
+func TestParseServiceAccountEntitlements(t *testing.T) {
+	entitlements, err := ParseServiceAccountEntitlements(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, entitlements)
+
+	entitlements, err = ParseServiceAccountEntitlements(map[string]string{
+		ServiceAccountEntitlementsAnnotation: `{"shop/orders":["orders:write"]}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"shop/orders": {"orders:write"}}, entitlements)
+
+	for _, value := range []string{`["orders"]`, `{"orders":["orders:write"]}`, `{"shop/":[]}`} {
+		_, err = ParseServiceAccountEntitlements(map[string]string{ServiceAccountEntitlementsAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestIsServiceAccountToken(t *testing.T) {
+	assert.True(t, IsServiceAccountToken(serviceAccountToken(t, "orders")))
+	assert.False(t, IsServiceAccountToken("not-a-token"))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "user"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	assert.False(t, IsServiceAccountToken(token))
+}
+
+func TestServiceAccountAuthenticator_Authenticate(t *testing.T) {
+	reviews := 0
+	authenticator := NewServiceAccountAuthenticator(
+		tokenReviewClient(t, &reviews),
+		"https://shop.example.com",
+		map[string][]string{"shop/orders": {"orders:write"}},
+	)
+
+	token := serviceAccountToken(t, "orders")
+	authContext, err := authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "shop/orders", authContext["sub"])
+	method, _ := authContext.GetAuthMethod()
+	assert.Equal(t, AuthMethodServiceAccount, method)
+	entitlements, _ := authContext.GetEntitlements()
+	assert.Equal(t, []string{"orders:write"}, entitlements)
+
+	_, err = authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reviews, "reviews are cached")
+
+	_, err = authenticator.Authenticate(context.Background(), serviceAccountToken(t, "catalog"))
+	assert.ErrorContains(t, err, "service account shop/catalog is not allowed to call the host")
+}
+
+func TestWithAuthentication_ServiceAccount(t *testing.T) {
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+	reviews := 0
+	authenticator := NewServiceAccountAuthenticator(
+		tokenReviewClient(t, &reviews),
+		"https://shop.example.com",
+		map[string][]string{"shop/orders": {"orders:write"}},
+	)
+
+	var got AuthContext
+	handler := WithAuthentication((&Config{ActivePair: pair}).LocalKey, "", "auth_token", "", authenticator, nil, nil, nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetAuthContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+serviceAccountToken(t, "orders"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "shop/orders", got["sub"])
+
+	req.Header.Set("Authorization", "Bearer "+serviceAccountToken(t, "catalog"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Without an authenticator service account tokens are not trusted.
+	handler = WithAuthentication((&Config{ActivePair: pair}).LocalKey, "", "auth_token", "", nil, nil, nil, nil, nil)(http.NotFoundHandler())
+	req.Header.Set("Authorization", "Bearer "+serviceAccountToken(t, "orders"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
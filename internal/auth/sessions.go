@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+)
+
+// The sessions are indexed, in their cache, by a key per session holding its
+// current refresh token, a set per session of the jti of the access tokens it
+// minted, a key per access token holding its session, a set of the sessions of
+// each subject and a set of the subjects with sessions. Each is kept for the
+// lifetime of the refresh tokens after its latest update, and updated key by
+// key so that the replicas of a host sharing the cache do not overwrite each
+// other's sessions.
+const (
+	sessionKeyPrefix        = "session:"
+	sessionTokenKeyPrefix   = "token:"
+	sessionTokensKeyPrefix  = "tokens:"
+	sessionSubjectKeyPrefix = "subject:"
+	sessionSubjectsKey      = "subjects"
+)
+
+// Session is a refresh token session: the refresh tokens rotated from one
+// another since a login.
+type Session struct {
+	AuthMethod AuthMethod `json:"authMethod"`
+	ClientID   string     `json:"clientId"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	ID         string     `json:"id"`
+	// IssuedAt is the issue time of the current refresh token of the session.
+	IssuedAt time.Time `json:"issuedAt"`
+	Scope    string    `json:"scope"`
+	Subject  string    `json:"subject"`
+}
+
+// indexSession records the current refresh token of the session of the
+// subject, created by the login of the token or not, and the access token
+// minted with it.
+func (e *Exchanger) indexSession(ctx context.Context, subject string, sessionID string, tokenID string, accessToken string, created bool) error {
+	if e.sessionIndexCache == nil {
+		return nil
+	}
+
+	if err := e.sessionIndexCache.Set(ctx, sessionKeyPrefix+sessionID, tokenID); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	if accessToken != "" {
+		if err := e.indexSessionToken(ctx, sessionID, accessToken); err != nil {
+			return err
+		}
+	}
+	if err := e.sessionIndexCache.AddMember(ctx, sessionSubjectKeyPrefix+subject, sessionID); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	if created {
+		if err := e.sessionIndexCache.AddMember(ctx, sessionSubjectsKey, subject); err != nil {
+			return fmt.Errorf("failed to index session: %w", err)
+		}
+	}
+	return nil
+}
+
+// indexSessionToken records the access token minted by the session.
+func (e *Exchanger) indexSessionToken(ctx context.Context, sessionID string, accessToken string) error {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		return fmt.Errorf("failed to parse minted token: %w", err)
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+	if err := e.sessionIndexCache.AddMember(ctx, sessionTokensKeyPrefix+sessionID, jti); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	if err := e.sessionIndexCache.Set(ctx, sessionTokenKeyPrefix+jti, sessionID); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	return nil
+}
+
+// indexExchangedToken records the access token exchanged for the subject
+// token under the session, and under the session at the OIDC provider, of the
+// subject token, so that they are revoked along with the subject token.
+func (e *Exchanger) indexExchangedToken(ctx context.Context, subjectClaims jwt.MapClaims, accessToken string) error {
+	subject, _ := subjectClaims.GetSubject()
+	subjectJTI, _ := subjectClaims["jti"].(string)
+	if subjectJTI == "" {
+		return nil
+	}
+
+	if e.sessionIndexCache != nil {
+		sessionID, found, _, err := e.sessionIndexCache.Get(ctx, sessionTokenKeyPrefix+subjectJTI)
+		if err != nil {
+			return fmt.Errorf("failed to read session index: %w", err)
+		}
+		if found {
+			if err := e.indexSessionToken(ctx, sessionID, accessToken); err != nil {
+				return err
+			}
+		}
+	}
+
+	idp, _ := subjectClaims["idp"].(string)
+	if provider := idpProvider(idp); provider != "" {
+		sid, err := e.providerSessionID(ctx, provider, subjectJTI)
+		if err != nil {
+			return err
+		}
+		if err := e.recordProviderSession(ctx, provider, subject, sid, accessToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the active sessions, those of the subject when it is
+// not empty, the latest issued first. The sessions found expired, revoked or
+// ended by a logout are pruned from the index.
+func (e *Exchanger) ListSessions(ctx context.Context, subject string) ([]Session, error) {
+	if !e.IsRefreshTokenEnabled() || e.sessionIndexCache == nil {
+		return nil, fmt.Errorf("refresh token storage not configured")
+	}
+
+	subjects := []string{subject}
+	if subject == "" {
+		var err error
+		if subjects, err = e.sessionIndexCache.Members(ctx, sessionSubjectsKey); err != nil {
+			return nil, fmt.Errorf("failed to read session index: %w", err)
+		}
+	}
+
+	sessions := []Session{}
+	for _, subject := range subjects {
+		sessionIDs, err := e.sessionIndexCache.Members(ctx, sessionSubjectKeyPrefix+subject)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session index: %w", err)
+		}
+		if len(sessionIDs) == 0 {
+			if err := e.sessionIndexCache.RemoveMember(ctx, sessionSubjectsKey, subject); err != nil {
+				return nil, fmt.Errorf("failed to prune session index: %w", err)
+			}
+			continue
+		}
+
+		for _, sessionID := range sessionIDs {
+			claims, found, err := e.lookupSession(ctx, sessionID)
+			if err != nil {
+				return nil, err
+			}
+			if !found || claims.Subject != subject {
+				// The session expired, was revoked or ended by a logout
+				if err := e.sessionIndexCache.RemoveMember(ctx, sessionSubjectKeyPrefix+subject, sessionID); err != nil {
+					return nil, fmt.Errorf("failed to prune session index: %w", err)
+				}
+				continue
+			}
+			sessions = append(sessions, Session{
+				AuthMethod: claims.AuthMethod,
+				ClientID:   claims.ClientID,
+				ExpiresAt:  time.Unix(claims.ExpiresAt, 0).UTC(),
+				ID:         sessionID,
+				IssuedAt:   time.Unix(claims.IssuedAt, 0).UTC(),
+				Scope:      claims.Scope,
+				Subject:    claims.Subject,
+			})
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return cmp.Or(b.IssuedAt.Compare(a.IssuedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return sessions, nil
+}
+
+// RevokeSession deletes the current refresh token of the session and revokes
+// the access tokens minted by the session, and returns whether the session was
+// active.
+func (e *Exchanger) RevokeSession(ctx context.Context, sessionID string) (bool, error) {
+	if !e.IsRefreshTokenEnabled() || e.sessionIndexCache == nil {
+		return false, fmt.Errorf("refresh token storage not configured")
+	}
+
+	tokenID, indexed, _, err := e.sessionIndexCache.Get(ctx, sessionKeyPrefix+sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read session index: %w", err)
+	}
+	if !indexed {
+		return false, nil
+	}
+
+	claims, found, err := e.LookupRefreshToken(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+	if err := e.refreshTokenCache.Delete(ctx, tokenID); err != nil {
+		return false, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	jtis, err := e.sessionIndexCache.Members(ctx, sessionTokensKeyPrefix+sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read session index: %w", err)
+	}
+	for _, jti := range jtis {
+		if err := e.config.Revocations.Revoke(ctx, jti); err != nil {
+			return false, fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	for _, key := range []string{sessionKeyPrefix + sessionID, sessionTokensKeyPrefix + sessionID} {
+		if err := e.sessionIndexCache.Delete(ctx, key); err != nil {
+			return false, fmt.Errorf("failed to unindex session: %w", err)
+		}
+	}
+	if found {
+		if err := e.sessionIndexCache.RemoveMember(ctx, sessionSubjectKeyPrefix+claims.Subject, sessionID); err != nil {
+			return false, fmt.Errorf("failed to unindex session: %w", err)
+		}
+	}
+	return found, nil
+}
+
+// RevokeSubjectSessions revokes the sessions of the subject, and returns the
+// number of sessions revoked.
+func (e *Exchanger) RevokeSubjectSessions(ctx context.Context, subject string) (int, error) {
+	sessions, err := e.ListSessions(ctx, subject)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		found, err := e.RevokeSession(ctx, session.ID)
+		if err != nil {
+			return revoked, err
+		}
+		if found {
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// lookupSession returns the claims of the current refresh token of the
+// session, false when it is no longer active.
+func (e *Exchanger) lookupSession(ctx context.Context, sessionID string) (RefreshTokenClaims, bool, error) {
+	tokenID, found, _, err := e.sessionIndexCache.Get(ctx, sessionKeyPrefix+sessionID)
+	if err != nil {
+		return RefreshTokenClaims{}, false, fmt.Errorf("failed to read session index: %w", err)
+	}
+	if !found {
+		return RefreshTokenClaims{}, false, nil
+	}
+	return e.LookupRefreshToken(ctx, tokenID)
+}
+
+func newSessionIndexCache(cacheManager cache.CacheManager, refreshTokenTTL time.Duration) cache.Cache {
+	return cacheManager.GetCache("refresh-sessions", cache.CacheOptions{
+		TTL:      new(refreshTokenTTL),
+		Uncycled: true,
+	})
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kdex.dev/crds/api/v1alpha1"
+)
+
+func TestExchanger_Sessions(t *testing.T) {
+	ctx := context.Background()
+	cacheManager, _ := cache.NewCacheManager("", "foo", new(1*time.Hour))
+	cfg, err := NewConfig(
+		&v1alpha1.Auth{},
+		func() (map[string]AuthClient, error) { return map[string]AuthClient{"app": {ClientID: "app"}}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]OIDCProvider, string, error) { return nil, "", nil },
+		"audience",
+		"issuer",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	ex, err := NewExchanger(ctx, *cfg, cacheManager, &mockScopeProvider{
+		resolveRolesAndEntitlements: func(subject string) ([]string, []string, error) {
+			return nil, nil, nil
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, ex.IsRefreshTokenEnabled())
+
+	login := func(subject string) string {
+		refreshToken, err := ex.createRefreshToken(ctx, RefreshTokenClaims{AuthMethod: AuthMethodLocal, ClientID: "app", Subject: subject}, "")
+		require.NoError(t, err)
+		return refreshToken
+	}
+	sessionIDs := func(subject string) []string {
+		sessions, err := ex.ListSessions(ctx, subject)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, session := range sessions {
+			ids = append(ids, session.ID)
+		}
+		return ids
+	}
+
+	aliceLaptop := login("alice")
+	login("alice")
+	login("bob")
+
+	sessions, err := ex.ListSessions(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 3)
+	assert.Len(t, sessionIDs("alice"), 2)
+	assert.Len(t, sessionIDs("bob"), 1)
+	assert.Empty(t, sessionIDs("carol"))
+
+	aliceSessions, err := ex.ListSessions(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, AuthMethodLocal, aliceSessions[0].AuthMethod)
+	assert.Equal(t, "app", aliceSessions[0].ClientID)
+	assert.True(t, aliceSessions[0].ExpiresAt.After(aliceSessions[0].IssuedAt))
+
+	// The rotation of a refresh token keeps its session
+	claims, found, err := ex.LookupRefreshToken(ctx, aliceLaptop)
+	require.NoError(t, err)
+	require.True(t, found)
+	ts, err := ex.RedeemRefreshToken(ctx, aliceLaptop, "app")
+	require.NoError(t, err)
+	rotated, found, err := ex.LookupRefreshToken(ctx, ts.RefreshToken)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, claims.SessionID, rotated.SessionID)
+	assert.Len(t, sessionIDs("alice"), 2)
+
+	// Revoking the session revokes its current refresh token, and the access
+	// tokens it minted
+	accessClaims, err := cfg.VerifyLocalToken(ts.AccessToken)
+	require.NoError(t, err)
+	jti, _ := accessClaims["jti"].(string)
+	require.NotEmpty(t, jti)
+	revoked, err := cfg.Revocations.IsRevoked(ctx, jti)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// The tokens exchanged for them, however many times, expire with them and
+	// are revoked along
+	exchangedJTIs := []string{}
+	subjectToken := ts.AccessToken
+	for range 2 {
+		subjectToken = mustExchangeToken(t, ex, "app", subjectToken)
+		exchangedClaims, err := cfg.VerifyLocalToken(subjectToken)
+		require.NoError(t, err)
+		exp, _ := exchangedClaims.GetExpirationTime()
+		accessExp, _ := accessClaims.GetExpirationTime()
+		assert.False(t, exp.After(accessExp.Time))
+		exchangedJTIs = append(exchangedJTIs, exchangedClaims["jti"].(string))
+	}
+
+	shortLived, err := cfg.Signer.SignFor(jwt.MapClaims{"sub": "alice"}, time.Minute)
+	require.NoError(t, err)
+	exchangedClaims, err := cfg.VerifyLocalToken(mustExchangeToken(t, ex, "app", shortLived))
+	require.NoError(t, err)
+	exp, _ := exchangedClaims.GetExpirationTime()
+	assert.WithinDuration(t, time.Now().Add(time.Minute), exp.Time, 2*time.Second, "not the TTL of the host")
+
+	found, err = ex.RevokeSession(ctx, claims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, found, err = ex.LookupRefreshToken(ctx, ts.RefreshToken)
+	require.NoError(t, err)
+	assert.False(t, found)
+	for _, jti := range append(exchangedJTIs, jti) {
+		revoked, err = cfg.Revocations.IsRevoked(ctx, jti)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	}
+	assert.NotContains(t, sessionIDs("alice"), claims.SessionID)
+
+	found, err = ex.RevokeSession(ctx, claims.SessionID)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Revoking the sessions of a subject leaves those of the others
+	revokedSessions, err := ex.RevokeSubjectSessions(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, revokedSessions)
+	assert.Empty(t, sessionIDs("alice"))
+	assert.Len(t, sessionIDs("bob"), 1)
+
+	// Each session has its own key, and the subjects left without a session
+	// are pruned from the index
+	bobSessions := sessionIDs("bob")
+	tokenID, found, _, err := ex.sessionIndexCache.Get(ctx, sessionKeyPrefix+bobSessions[0])
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.NotEmpty(t, tokenID)
+	assert.Len(t, sessionIDs(""), 1)
+	subjects, err := ex.sessionIndexCache.Members(ctx, sessionSubjectsKey)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, subjects)
+}
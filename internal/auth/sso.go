@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/pkg/jwtverify"
+)
+
+const (
+	// CookieDomainAnnotation sets, on a host, the domain of its auth cookie,
+	// e.g. "example.com", so that browsers send the session to the other hosts
+	// of the domain. Every domain of the host must be within it.
+	CookieDomainAnnotation = "kdex.dev/cookie-domain"
+	// TrustedIssuersAnnotation lists, on a host, the comma separated issuers
+	// whose tokens it honors besides its own, e.g.
+	// "https://shop.example.com,https://support.example.com". The keys of an
+	// issuer are fetched from its /.well-known/jwks.json. The tokens of the
+	// host are minted for the audiences of the issuers too, so the hosts
+	// sharing their sessions list one another.
+	TrustedIssuersAnnotation = "kdex.dev/trusted-issuers"
+
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// ParseCookieDomain returns the cookie domain of CookieDomainAnnotation,
+// empty when it is not set.
+func ParseCookieDomain(annotations map[string]string, domains []string) (string, error) {
+	value := annotations[CookieDomainAnnotation]
+	if value == "" {
+		return "", nil
+	}
+
+	domain := strings.ToLower(strings.TrimPrefix(value, "."))
+	if !strings.Contains(domain, ".") {
+		return "", fmt.Errorf("invalid %s annotation %q, expected a domain of at least two labels", CookieDomainAnnotation, value)
+	}
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if d != domain && !strings.HasSuffix(d, "."+domain) {
+			return "", fmt.Errorf("invalid %s annotation %q, domain %s of the host is not within it", CookieDomainAnnotation, value, d)
+		}
+	}
+	return domain, nil
+}
+
+// ParseTrustedIssuers returns the issuers of TrustedIssuersAnnotation, nil
+// when it is not set.
+func ParseTrustedIssuers(annotations map[string]string) ([]string, error) {
+	value := annotations[TrustedIssuersAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	issuers := []string{}
+	for issuer := range strings.SplitSeq(value, ",") {
+		if issuer = strings.TrimSpace(issuer); issuer == "" {
+			continue
+		}
+		u, err := url.Parse(issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s annotation %q, issuer %q is not an http(s) URL", TrustedIssuersAnnotation, value, issuer)
+		}
+		issuers = append(issuers, strings.TrimSuffix(issuer, "/"))
+	}
+	return issuers, nil
+}
+
+// TrustedIssuers verifies the tokens of the other hosts a host shares its
+// sessions with, against the keys the hosts publish in their JWKS. The tokens
+// must be minted for the audience of the host. The keys are cached, and
+// fetched again when a token is signed by an unknown key so that the rotations
+// of the keys of the issuers are followed.
+type TrustedIssuers struct {
+	Audience string
+	Client   *http.Client
+	Issuers  []string
+
+	mu   sync.Mutex
+	jwks map[string]*jwtverify.KeySet
+}
+
+// NewTrustedIssuers returns the verifier of the tokens of the issuers minted
+// for the audience.
+func NewTrustedIssuers(audience string, issuers []string) *TrustedIssuers {
+	return &TrustedIssuers{
+		Audience: audience,
+		Client:   &http.Client{Timeout: jwksFetchTimeout},
+		Issuers:  issuers,
+		jwks:     map[string]*jwtverify.KeySet{},
+	}
+}
+
+// Trusts reports whether the tokens of the issuer are honored.
+func (t *TrustedIssuers) Trusts(issuer string) bool {
+	return t != nil && slices.Contains(t.Issuers, strings.TrimSuffix(issuer, "/"))
+}
+
+// Key returns the key of the issuer verifying the token, once the token is
+// found minted for the audience of the host.
+func (t *TrustedIssuers) Key(ctx context.Context, token *jwt.Token) (crypto.PublicKey, error) {
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return nil, err
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+	if !t.Trusts(issuer) {
+		return nil, fmt.Errorf("issuer %s is not trusted", issuer)
+	}
+	audience, err := token.Claims.GetAudience()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(audience, t.Audience) {
+		return nil, fmt.Errorf("token of issuer %s is not for audience %s", issuer, t.Audience)
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	t.mu.Lock()
+	keySet := t.jwks[issuer]
+	if keySet == nil {
+		keySet = jwtverify.NewKeySet(issuer + "/.well-known/jwks.json")
+		keySet.Client = t.Client
+		t.jwks[issuer] = keySet
+	}
+	t.mu.Unlock()
+
+	return keySet.Key(ctx, kid)
+}
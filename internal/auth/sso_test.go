@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keyPair(t *testing.T, kid string, generate func() (crypto.Signer, error)) *keys.KeyPair {
+	private, err := generate()
+	require.NoError(t, err)
+	return &keys.KeyPair{ActiveKey: true, KeyId: kid, Private: private}
+}
+
+func ecdsaKeyPair(t *testing.T, kid string) *keys.KeyPair {
+	return keyPair(t, kid, func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) })
+}
+
+// issuerToken returns a token of the issuer for the audience signed by the
+// ECDSA pair.
+func issuerToken(t *testing.T, pair *keys.KeyPair, issuer string, audience string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": audience,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iss": issuer,
+		"sub": "jane",
+	})
+	token.Header["kid"] = pair.KeyId
+	signed, err := token.SignedString(pair.Private)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestParseCookieDomain(t *testing.T) {
+	domain, err := ParseCookieDomain(map[string]string{}, []string{"shop.example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, domain)
+
+	domain, err = ParseCookieDomain(map[string]string{CookieDomainAnnotation: ".Example.com"}, []string{"shop.example.com", "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", domain)
+
+	_, err = ParseCookieDomain(map[string]string{CookieDomainAnnotation: "example.com"}, []string{"shop.example.org"})
+	assert.ErrorContains(t, err, "domain shop.example.org of the host is not within it")
+
+	_, err = ParseCookieDomain(map[string]string{CookieDomainAnnotation: "com"}, []string{"example.com"})
+	assert.Error(t, err)
+}
+
+func TestParseTrustedIssuers(t *testing.T) {
+	issuers, err := ParseTrustedIssuers(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, issuers)
+
+	issuers, err = ParseTrustedIssuers(map[string]string{TrustedIssuersAnnotation: "https://shop.example.com/, https://support.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://shop.example.com", "https://support.example.com"}, issuers)
+
+	_, err = ParseTrustedIssuers(map[string]string{TrustedIssuersAnnotation: "shop.example.com"})
+	assert.Error(t, err)
+}
+
+func TestTrustedIssuers_Key(t *testing.T) {
+	for _, pair := range []*keys.KeyPair{
+		ecdsaKeyPair(t, "p256"),
+		keyPair(t, "p384", func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) }),
+		keyPair(t, "rsa", func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) }),
+	} {
+		pairs := &keys.KeyPairs{pair}
+		server := httptest.NewServer(JWKSHandler(pairs))
+
+		issuers := NewTrustedIssuers("https://support.example.com", []string{server.URL})
+		token := func(issuer string, audience string) *jwt.Token {
+			return &jwt.Token{
+				Claims: jwt.MapClaims{"aud": audience, "iss": issuer},
+				Header: map[string]any{"kid": pair.KeyId},
+			}
+		}
+
+		key, err := issuers.Key(t.Context(), token(server.URL+"/", "https://support.example.com"))
+		require.NoError(t, err, pair.KeyId)
+		assert.True(t, pair.Private.Public().(interface{ Equal(x crypto.PublicKey) bool }).Equal(key), pair.KeyId)
+
+		_, err = issuers.Key(t.Context(), token(server.URL, "https://shop.example.com"))
+		assert.ErrorContains(t, err, "is not for audience", pair.KeyId)
+
+		_, err = issuers.Key(t.Context(), token("https://evil.example.com", "https://support.example.com"))
+		assert.ErrorContains(t, err, "is not trusted", pair.KeyId)
+		server.Close()
+	}
+}
+
+func TestWithAuthentication_TrustedIssuers(t *testing.T) {
+	shopPair := ecdsaKeyPair(t, "shop")
+	shopPairs := &keys.KeyPairs{shopPair}
+	fetches := 0
+	shop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		JWKSHandler(shopPairs)(w, r)
+	}))
+	defer shop.Close()
+
+	supportPair := ecdsaKeyPair(t, "support")
+	var got AuthContext
+	handler := WithAuthentication(
+		(&Config{ActivePair: supportPair}).LocalKey,
+		"https://support.example.com",
+		"auth_token",
+		"example.com",
+		nil,
+		NewTrustedIssuers("https://support.example.com", []string{shop.URL}),
+		nil,
+		nil,
+		nil,
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetAuthContext(r.Context())
+	}))
+
+	// A session of the shop is honored by the support host.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: issuerToken(t, shopPair, shop.URL, "https://support.example.com")})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "jane", got["sub"])
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issuerToken(t, shopPair, shop.URL, "https://support.example.com"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, fetches, "keys are cached")
+
+	// Its own sessions are still verified with its own key.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issuerToken(t, supportPair, "https://support.example.com", "https://support.example.com"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// A token of the shop key claiming another issuer is not trusted.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issuerToken(t, shopPair, "https://evil.example.com", "https://support.example.com"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// A token of the shop for another host is not honored.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issuerToken(t, shopPair, shop.URL, "https://shop.example.com"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Nor is a token signed by another method than those of the keys.
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix(), "sub": "jane"})
+	signed, err := hmac.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// An invalid shared session is cleared for the whole domain.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: issuerToken(t, supportPair, shop.URL, "https://support.example.com")})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "example.com", cookies[0].Domain)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "at %d", tt.unix)
+	}
+
+	_, err := TOTPCode("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := NewTOTPSecret()
+	now := time.Unix(1_800_000_000, 0)
+	step := totpStep(now)
+
+	code, err := TOTPCode(secret, now.Add(-totpPeriod))
+	require.NoError(t, err)
+	got, ok := verifyTOTP(secret, code, now, 0)
+	assert.True(t, ok, "the code of the previous period is accepted")
+	assert.Equal(t, step-1, got)
+
+	_, ok = verifyTOTP(secret, code, now, step-1)
+	assert.False(t, ok, "a code is not accepted twice")
+
+	code, err = TOTPCode(secret, now.Add(-2*totpPeriod))
+	require.NoError(t, err)
+	_, ok = verifyTOTP(secret, code, now, 0)
+	assert.False(t, ok, "codes of older periods are rejected")
+
+	_, ok = verifyTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(TOTPURI("Shop", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Shop:alice@example.com", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "Shop", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+	assert.Equal(t, "30", u.Query().Get("period"))
+}
@@ -0,0 +1,241 @@
+package breaker
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   State = "closed"
+	StateHalfOpen State = "half-open"
+	StateOpen     State = "open"
+)
+
+// ErrOpen is returned by Allow while the breaker rejects requests.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State string
+
+type Options struct {
+	// FailureRatio is the ratio of failed requests within a window above
+	// which the breaker opens.
+	FailureRatio float64
+	// HalfOpenProbes is the number of requests let through while half-open.
+	// That many consecutive successes close the breaker again.
+	HalfOpenProbes int
+	// MinRequests is the number of requests required within a window before
+	// the failure ratio is evaluated.
+	MinRequests int
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// Window is the period over which requests and failures are counted.
+	Window time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		FailureRatio:   0.5,
+		HalfOpenProbes: 3,
+		MinRequests:    20,
+		OpenTimeout:    30 * time.Second,
+		Window:         10 * time.Second,
+	}
+}
+
+type Breaker struct {
+	failures    int
+	generation  uint64
+	mu          sync.Mutex
+	name        string
+	now         func() time.Time
+	openedAt    time.Time
+	opts        Options
+	probes      int
+	requests    int
+	state       State
+	successes   int
+	windowStart time.Time
+}
+
+type Snapshot struct {
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"openedAt,omitzero"`
+	Requests int       `json:"requests"`
+	State    State     `json:"state"`
+}
+
+func New(name string, opts Options) *Breaker {
+	b := &Breaker{
+		name:  name,
+		now:   time.Now,
+		opts:  opts,
+		state: StateClosed,
+	}
+	b.windowStart = b.now()
+	stateGauge.WithLabelValues(name).Set(stateValue(StateClosed))
+	return b
+}
+
+// Allow reports whether a request may proceed. When it may, the returned
+// function must be called exactly once with the outcome of the request.
+func (b *Breaker) Allow() (func(success bool), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.opts.OpenTimeout {
+			rejectedTotal.WithLabelValues(b.name).Inc()
+			return nil, ErrOpen
+		}
+		b.setStateLocked(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= max(b.opts.HalfOpenProbes, 1) {
+			rejectedTotal.WithLabelValues(b.name).Inc()
+			return nil, ErrOpen
+		}
+		b.probes++
+	default:
+		if now.Sub(b.windowStart) >= b.opts.Window {
+			b.failures = 0
+			b.requests = 0
+			b.windowStart = now
+		}
+	}
+
+	generation := b.generation
+	return func(success bool) {
+		b.done(generation, success)
+	}, nil
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Snapshot{
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+		Requests: b.requests,
+		State:    b.state,
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) SetOptions(opts Options) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opts = opts
+}
+
+func (b *Breaker) done(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Outcomes of requests admitted before the last state change are stale.
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		if !success {
+			b.openLocked()
+			return
+		}
+		b.successes++
+		if b.successes >= max(b.opts.HalfOpenProbes, 1) {
+			b.setStateLocked(StateClosed)
+		}
+	case StateClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.opts.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.opts.FailureRatio {
+			b.openLocked()
+		}
+	}
+}
+
+func (b *Breaker) openLocked() {
+	b.openedAt = b.now()
+	b.setStateLocked(StateOpen)
+}
+
+func (b *Breaker) setStateLocked(state State) {
+	b.failures = 0
+	b.generation++
+	b.probes = 0
+	b.requests = 0
+	b.state = state
+	b.successes = 0
+	b.windowStart = b.now()
+	if state == StateClosed {
+		b.openedAt = time.Time{}
+	}
+	stateGauge.WithLabelValues(b.name).Set(stateValue(state))
+}
+
+// Registry holds breakers by name so that they survive handler rebuilds.
+type Registry struct {
+	breakers sync.Map
+}
+
+// Get returns the breaker with the given name, creating it when necessary.
+// The options of an existing breaker are updated.
+func (r *Registry) Get(name string, opts Options) *Breaker {
+	if b, ok := r.breakers.Load(name); ok {
+		b.(*Breaker).SetOptions(opts)
+		return b.(*Breaker)
+	}
+	b, _ := r.breakers.LoadOrStore(name, New(name, opts))
+	return b.(*Breaker)
+}
+
+// Retain drops every breaker whose name is not in names.
+func (r *Registry) Retain(names ...string) {
+	r.breakers.Range(func(key, value any) bool {
+		if !slices.Contains(names, key.(string)) {
+			r.breakers.Delete(key)
+			stateGauge.DeleteLabelValues(key.(string))
+		}
+		return true
+	})
+}
+
+// Snapshots returns the current state of every breaker by name.
+func (r *Registry) Snapshots() map[string]Snapshot {
+	out := map[string]Snapshot{}
+	r.breakers.Range(func(key, value any) bool {
+		out[key.(string)] = value.(*Breaker).Snapshot()
+		return true
+	})
+	return out
+}
+
+func stateValue(state State) float64 {
+	switch state {
+	case StateHalfOpen:
+		return 1
+	case StateOpen:
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Now()
+	b := New("test-transitions", Options{
+		FailureRatio:   0.5,
+		HalfOpenProbes: 2,
+		MinRequests:    4,
+		OpenTimeout:    time.Minute,
+		Window:         time.Hour,
+	})
+	b.now = func() time.Time { return now }
+
+	record := func(success bool) {
+		done, err := b.Allow()
+		require.NoError(t, err)
+		done(success)
+	}
+
+	// Below the minimum number of requests the breaker stays closed.
+	record(false)
+	record(false)
+	record(true)
+	assert.Equal(t, StateClosed, b.State())
+
+	// Reaching the failure ratio opens it.
+	record(true)
+	assert.Equal(t, StateOpen, b.State())
+
+	_, err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	// After the open timeout a limited number of probes get through.
+	now = now.Add(time.Minute)
+	probe1, err := b.Allow()
+	require.NoError(t, err)
+	assert.Equal(t, StateHalfOpen, b.State())
+	probe2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	// A failed probe opens it again.
+	probe1(false)
+	assert.Equal(t, StateOpen, b.State())
+
+	// The outcome of a probe admitted before re-opening is ignored.
+	probe2(true)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Enough successful probes close it.
+	now = now.Add(time.Minute)
+	record(true)
+	assert.Equal(t, StateHalfOpen, b.State())
+	record(true)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_WindowReset(t *testing.T) {
+	now := time.Now()
+	b := New("test-window", Options{
+		FailureRatio:   0.5,
+		HalfOpenProbes: 1,
+		MinRequests:    2,
+		OpenTimeout:    time.Minute,
+		Window:         time.Second,
+	})
+	b.now = func() time.Time { return now }
+
+	done, err := b.Allow()
+	require.NoError(t, err)
+	done(false)
+
+	now = now.Add(2 * time.Second)
+
+	done, err = b.Allow()
+	require.NoError(t, err)
+	done(true)
+
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, 1, b.Snapshot().Requests)
+}
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+
+	a := r.Get("a", DefaultOptions())
+	assert.Same(t, a, r.Get("a", DefaultOptions()))
+	r.Get("b", DefaultOptions())
+	assert.Len(t, r.Snapshots(), 2)
+
+	r.Retain("a")
+	snapshots := r.Snapshots()
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, StateClosed, snapshots["a"].State)
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Now()
+	b := NewRetryBudget(0.5, 1)
+	b.now = func() time.Time { return now }
+
+	// The per second allowance is available without any deposits.
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	// Two requests at a ratio of 0.5 fund one retry.
+	b.Deposit()
+	b.Deposit()
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	// The allowance is replenished every second.
+	now = now.Add(time.Second)
+	assert.True(t, b.Withdraw())
+}
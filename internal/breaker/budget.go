@@ -0,0 +1,59 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryBudget limits retries to a ratio of the requests seen, plus a small
+// fixed allowance per second so that low traffic functions can still retry.
+type RetryBudget struct {
+	minPerSecond int
+	minRemaining int
+	minReset     time.Time
+	mu           sync.Mutex
+	now          func() time.Time
+	ratio        float64
+	tokens       float64
+}
+
+func NewRetryBudget(ratio float64, minPerSecond int) *RetryBudget {
+	return &RetryBudget{
+		minPerSecond: minPerSecond,
+		now:          time.Now,
+		ratio:        ratio,
+	}
+}
+
+// Deposit credits the budget for one request.
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Cap the balance so a long quiet period can't fund a retry storm.
+	b.tokens = min(b.tokens+b.ratio, max(b.ratio*100, 1))
+}
+
+// Withdraw reports whether a retry is allowed and debits the budget if so.
+func (b *RetryBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !now.Before(b.minReset) {
+		b.minRemaining = b.minPerSecond
+		b.minReset = now.Add(time.Second)
+	}
+
+	if b.minRemaining > 0 {
+		b.minRemaining--
+		return true
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,43 @@
+package breaker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	rejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_circuit_breaker_rejected_total",
+			Help: "Number of requests rejected by an open circuit breaker.",
+		},
+		[]string{"name"},
+	)
+	retriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_proxy_retries_total",
+			Help: "Number of proxy retries by outcome (attempted or budget_exhausted).",
+		},
+		[]string{"name", "outcome"},
+	)
+	stateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_circuit_breaker_state",
+			Help: "Current circuit breaker state (0 closed, 1 half-open, 2 open).",
+		},
+		[]string{"name"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(rejectedTotal, retriesTotal, stateGauge)
+}
+
+// ObserveRetry records a retry decision for the named breaker.
+func ObserveRetry(name string, allowed bool) {
+	outcome := "attempted"
+	if !allowed {
+		outcome = "budget_exhausted"
+	}
+	retriesTotal.WithLabelValues(name, outcome).Inc()
+}
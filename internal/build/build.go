@@ -3,6 +3,7 @@ package build
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/kdex-tech/host-manager/internal"
 	v1 "k8s.io/api/core/v1"
@@ -14,14 +15,166 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// Engine is the build system creating the images of functions.
+type Engine string
+
+const (
+	EngineBuildah Engine = "buildah"
+	EngineKaniko  Engine = "kaniko"
+	EngineKPack   Engine = "kpack"
+	EngineTekton  Engine = "tekton"
+)
+
+const (
+	// EngineAnnotation selects, on a FaaS adaptor, the engine building the
+	// images of its functions. KPack is used when it is not set.
+	EngineAnnotation = "kdex.dev/build-engine"
+	// ExecutorImageAnnotation overrides, on a FaaS adaptor, the image of the
+	// kaniko or buildah job building the images of its functions.
+	ExecutorImageAnnotation = "kdex.dev/build-executor-image"
+
+	// SourceCommitAttribute is the function status attribute of the commit
+	// last pushed to the revision of its source, which it is built at.
+	SourceCommitAttribute = "source.commit"
+)
+
+// ParseEngine returns the engine named by the value of EngineAnnotation.
+func ParseEngine(value string) (Engine, error) {
+	switch Engine(value) {
+	case "", EngineKPack:
+		return EngineKPack, nil
+	case EngineBuildah, EngineKaniko, EngineTekton:
+		return Engine(value), nil
+	default:
+		return "", fmt.Errorf(
+			"unknown build engine %q, expected one of %s, %s, %s or %s",
+			value, EngineBuildah, EngineKaniko, EngineKPack, EngineTekton,
+		)
+	}
+}
+
+// Build is the progress of the build of a function image.
+type Build struct {
+	// Failure is the reason the build failed, empty unless it did.
+	Failure string
+	// Image is the reference of the built image, empty until the build
+	// succeeds.
+	Image string
+	// Object is the build resource of the engine.
+	Object client.Object
+	// Tags are the tags the image is pushed with.
+	Tags []string
+}
+
+// ImageBuilder creates the build of the image of a function and reports its
+// progress.
+type ImageBuilder interface {
+	GetOrCreateBuild(ctx context.Context, function *kdexv1alpha1.KDexFunction) (controllerutil.OperationResult, *Build, error)
+}
+
 type Builder struct {
 	client.Client
-	ImageRegistry  kdexv1alpha1.Registry
+	// Commit pins the build to a commit of the revision of the source, the
+	// builds of a generation are told apart by it.
+	Commit string
+	Engine Engine
+	// ExecutorImage overrides the image of the kaniko or buildah job.
+	ExecutorImage string
+	// GitSecret holds the username and password the job clones the source
+	// with, if any.
+	GitSecret     *v1.LocalObjectReference
+	ImageRegistry kdexv1alpha1.Registry
+	// RegistrySecret is the docker config the job pushes the image with, if
+	// any.
+	RegistrySecret *v1.LocalObjectReference
 	Scheme         *runtime.Scheme
 	ServiceAccount string
 	Source         kdexv1alpha1.Source
 }
 
+// ImageBuilder returns the ImageBuilder of the engine of b.
+func (b *Builder) ImageBuilder() ImageBuilder {
+	switch b.Engine {
+	case EngineBuildah, EngineKaniko:
+		return &jobBuilder{b}
+	case EngineTekton:
+		return &tektonBuilder{b}
+	default:
+		return &kpackBuilder{b}
+	}
+}
+
+// buildName suffixes the name of the build of a generation with the commit
+// it is pinned to, if any.
+func (b *Builder) buildName(name string) string {
+	if b.Commit == "" {
+		return name
+	}
+	commit := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') {
+			return r
+		}
+		return -1
+	}, strings.ToLower(b.Commit))
+	return name + "-" + commit[:min(len(commit), 7)]
+}
+
+// revision returns the git revision the source is built at.
+func (b *Builder) revision() string {
+	if b.Commit != "" {
+		return b.Commit
+	}
+	return b.Source.Revision
+}
+
+type kpackBuilder struct {
+	*Builder
+}
+
+func (b *kpackBuilder) GetOrCreateBuild(
+	ctx context.Context,
+	function *kdexv1alpha1.KDexFunction,
+) (controllerutil.OperationResult, *Build, error) {
+	op, image, err := b.GetOrCreateKPackImage(ctx, function)
+	if err != nil {
+		return op, &Build{Object: image}, err
+	}
+	return op, kpackImageBuild(image), nil
+}
+
+// kpackImageBuild reads the progress of the build from the status of the
+// KPack image.
+func kpackImageBuild(image *unstructured.Unstructured) *Build {
+	build := &Build{Object: image}
+
+	observedGeneration, found, _ := unstructured.NestedInt64(image.Object, "status", "observedGeneration")
+	if !found || observedGeneration < image.GetGeneration() {
+		return build
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(image.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok || cond["status"] != "True" {
+			continue
+		}
+		switch cond["type"] {
+		case "Ready":
+			build.Image, _, _ = unstructured.NestedString(image.Object, "status", "latestImage")
+		case "Failed":
+			build.Failure = fmt.Sprintf("%v", cond["message"])
+		}
+	}
+
+	if tag, ok, _ := unstructured.NestedString(image.Object, "spec", "tag"); ok {
+		build.Tags = append(build.Tags, tag)
+	}
+	additionalTags, _, _ := unstructured.NestedStringSlice(image.Object, "spec", "additionalTags")
+	build.Tags = append(build.Tags, additionalTags...)
+
+	return build
+}
+
 func (b *Builder) GetOrCreateKPackImage(
 	ctx context.Context,
 	function *kdexv1alpha1.KDexFunction,
@@ -45,7 +198,7 @@ func (b *Builder) GetOrCreateKPackImage(
 			"source": map[string]any{
 				"git": map[string]any{
 					"url":      b.Source.Repository,
-					"revision": b.Source.Revision,
+					"revision": b.revision(),
 				},
 				"subPath": b.Source.Path,
 			},
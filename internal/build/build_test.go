@@ -0,0 +1,248 @@
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseEngine(t *testing.T) {
+	engine, err := ParseEngine("")
+	require.NoError(t, err)
+	assert.Equal(t, EngineKPack, engine)
+
+	engine, err = ParseEngine("tekton")
+	require.NoError(t, err)
+	assert.Equal(t, EngineTekton, engine)
+
+	engine, err = ParseEngine("kaniko")
+	require.NoError(t, err)
+	assert.Equal(t, EngineKaniko, engine)
+
+	_, err = ParseEngine("jenkins")
+	assert.Error(t, err)
+}
+
+func TestKPackImageBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      map[string]any
+		wantImage   string
+		wantFailure string
+	}{
+		{
+			name: "ready",
+			status: map[string]any{
+				"observedGeneration": int64(2),
+				"latestImage":        "registry/host/fn@sha256:abc",
+				"conditions":         []any{map[string]any{"type": "Ready", "status": "True"}},
+			},
+			wantImage: "registry/host/fn@sha256:abc",
+		},
+		{
+			name: "failed",
+			status: map[string]any{
+				"observedGeneration": int64(2),
+				"conditions":         []any{map[string]any{"type": "Failed", "status": "True", "message": "boom"}},
+			},
+			wantFailure: "boom",
+		},
+		{
+			name: "stale",
+			status: map[string]any{
+				"observedGeneration": int64(1),
+				"latestImage":        "registry/host/fn@sha256:old",
+				"conditions":         []any{map[string]any{"type": "Ready", "status": "True"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := &unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"tag":            "registry/host/fn:latest",
+					"additionalTags": []any{"registry/host/fn:2"},
+				},
+				"status": tt.status,
+			}}
+			image.SetGeneration(2)
+
+			build := kpackImageBuild(image)
+			assert.Equal(t, tt.wantImage, build.Image)
+			assert.Equal(t, tt.wantFailure, build.Failure)
+			if tt.wantImage != "" {
+				assert.Equal(t, []string{"registry/host/fn:latest", "registry/host/fn:2"}, build.Tags)
+			}
+		})
+	}
+}
+
+func TestTektonPipelineRunBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      map[string]any
+		wantImage   string
+		wantFailure string
+	}{
+		{
+			name: "running",
+			status: map[string]any{
+				"conditions": []any{map[string]any{"type": "Succeeded", "status": "Unknown"}},
+			},
+		},
+		{
+			name: "succeeded with digest",
+			status: map[string]any{
+				"conditions": []any{map[string]any{"type": "Succeeded", "status": "True"}},
+				"results": []any{
+					map[string]any{"name": "IMAGE_URL", "value": "registry/host/fn:3"},
+					map[string]any{"name": "IMAGE_DIGEST", "value": "sha256:abc"},
+				},
+			},
+			wantImage: "registry/host/fn:3@sha256:abc",
+		},
+		{
+			name: "succeeded without results",
+			status: map[string]any{
+				"conditions": []any{map[string]any{"type": "Succeeded", "status": "True"}},
+			},
+			wantImage: "registry/host/fn:3",
+		},
+		{
+			name: "failed",
+			status: map[string]any{
+				"conditions": []any{map[string]any{"type": "Succeeded", "status": "False", "message": "task build failed"}},
+			},
+			wantFailure: "task build failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"params": []any{
+						map[string]any{"name": TektonParamImage, "value": "registry/host/fn:3"},
+					},
+				},
+				"status": tt.status,
+			}}
+
+			build := tektonPipelineRunBuild(run)
+			assert.Equal(t, tt.wantImage, build.Image)
+			assert.Equal(t, tt.wantFailure, build.Failure)
+			assert.Equal(t, []string{"registry/host/fn:3"}, build.Tags)
+		})
+	}
+}
+
+func TestTektonPipelineRef(t *testing.T) {
+	assert.Equal(t,
+		map[string]any{"name": "buildpacks"},
+		tektonPipelineRef(kdexv1alpha1.KDexObjectReference{Kind: "Builder", Name: "buildpacks"}),
+	)
+	assert.Equal(t,
+		map[string]any{
+			"resolver": "cluster",
+			"params": []any{
+				map[string]any{"name": "kind", "value": "pipeline"},
+				map[string]any{"name": "name", "value": "buildpacks"},
+				map[string]any{"name": "namespace", "value": "tekton-pipelines"},
+			},
+		},
+		tektonPipelineRef(kdexv1alpha1.KDexObjectReference{Kind: "ClusterBuilder", Name: "buildpacks", Namespace: "tekton-pipelines"}),
+	)
+	assert.Equal(t,
+		[]any{"BP_GO_VERSION=1.26"},
+		tektonEnv([]corev1.EnvVar{{Name: "BP_GO_VERSION", Value: "1.26"}}),
+	)
+}
+
+func TestJobBuilder(t *testing.T) {
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "fn"
+	function.Namespace = "ns"
+	function.Generation = 4
+	function.Spec.HostRef.Name = "host"
+
+	builder := func(engine Engine) *jobBuilder {
+		return &jobBuilder{&Builder{
+			Engine:         engine,
+			GitSecret:      &corev1.LocalObjectReference{Name: "git"},
+			ImageRegistry:  kdexv1alpha1.Registry{Host: "registry"},
+			RegistrySecret: &corev1.LocalObjectReference{Name: "docker"},
+			Source: kdexv1alpha1.Source{
+				Builder:    &kdexv1alpha1.Builder{Env: []corev1.EnvVar{{Name: "GO_VERSION", Value: "1.26"}}},
+				Path:       "functions/fn",
+				Repository: "https://git.example.com/org/repo.git",
+				Revision:   "abc123",
+			},
+		}}
+	}
+
+	t.Run("kaniko", func(t *testing.T) {
+		job := builder(EngineKaniko).buildJob(function, "fn-imagebuild-4")
+
+		container := job.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, DefaultKanikoImage, container.Image)
+		assert.Equal(t, []string{
+			"--context=dir:///workspace/source/functions/fn",
+			"--digest-file=/dev/termination-log",
+			"--destination=registry/host/fn:4",
+			"--destination=registry/host/fn:latest",
+			"--build-arg=GO_VERSION=1.26",
+		}, container.Args)
+		assert.Equal(t, []string{"registry/host/fn:4", "registry/host/fn:latest"}, jobTagsOf(job))
+		assert.Len(t, job.Spec.Template.Spec.Volumes, 2)
+		assert.Len(t, job.Spec.Template.Spec.InitContainers[0].Env, 5)
+	})
+
+	t.Run("buildah", func(t *testing.T) {
+		b := builder(EngineBuildah)
+		b.ExecutorImage = "buildah:custom"
+		job := b.buildJob(function, "fn-imagebuild-4")
+
+		container := job.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, "buildah:custom", container.Image)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "BUILD_ARGS", Value: "--build-arg=GO_VERSION=1.26"})
+		assert.Equal(t, []string{"registry/host/fn:4", "registry/host/fn:latest"}, jobTagsOf(job))
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		b := builder(EngineKaniko)
+		job := b.buildJob(function, "fn-imagebuild-4")
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+
+		pod := &corev1.Pod{}
+		pod.Name = "fn-imagebuild-4-x"
+		pod.Namespace = "ns"
+		pod.Labels = map[string]string{"job-name": job.Name}
+		pod.Annotations = map[string]string{"kdex.dev/generation": "4"}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  jobBuildContainer,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "sha256:def\n"}},
+		}}
+		b.Client = fake.NewClientBuilder().WithObjects(pod).Build()
+
+		build := b.jobBuild(context.Background(), job)
+		assert.Empty(t, build.Failure)
+		assert.Equal(t, "registry/host/fn:4@sha256:def", build.Image)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		job := builder(EngineKaniko).buildJob(function, "fn-imagebuild-4")
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+
+		build := builder(EngineKaniko).jobBuild(context.Background(), job)
+		assert.Equal(t, "BackoffLimitExceeded", build.Failure)
+		assert.Empty(t, build.Image)
+	})
+}
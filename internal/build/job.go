@@ -0,0 +1,312 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	kjob "github.com/kdex-tech/host-manager/internal/job"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// JobApp is the app label of the jobs building images.
+	JobApp = "imagebuild"
+
+	DefaultBuildahImage = "quay.io/buildah/stable:v1.38"
+	DefaultGitImage     = "alpine/git:2.47.2"
+	DefaultKanikoImage  = "gcr.io/kaniko-project/executor:v1.23.2"
+
+	jobBuildContainer = "build"
+	jobDockerConfig   = "/kdex/docker"
+	jobRegistryVolume = "registry-config"
+	jobSourceDir      = "/workspace/source"
+	jobSourceVolume   = "source"
+)
+
+// gitCheckoutScript clones the source, with the credentials of the git
+// secret when they are set, and checks out the revision.
+const gitCheckoutScript = `set -e
+if [ -n "$GIT_USERNAME" ]; then
+  git config --global credential.helper '!f() { echo "username=$GIT_USERNAME"; echo "password=$GIT_PASSWORD"; }; f'
+fi
+git clone "$SOURCE_REPOSITORY" "$SOURCE_DIR"
+cd "$SOURCE_DIR"
+if [ -n "$SOURCE_REVISION" ]; then
+  git checkout "$SOURCE_REVISION"
+fi
+`
+
+// buildahScript builds the Dockerfile of the context and pushes it with each
+// tag, recording the digest in the termination message.
+const buildahScript = `set -e
+buildah build --storage-driver=vfs $BUILD_ARGS -t "$IMAGE" "$CONTEXT"
+buildah push --storage-driver=vfs --digestfile /dev/termination-log "$IMAGE"
+for tag in $ADDITIONAL_TAGS; do
+  buildah tag --storage-driver=vfs "$IMAGE" "$tag"
+  buildah push --storage-driver=vfs "$tag"
+done
+`
+
+type jobBuilder struct {
+	*Builder
+}
+
+// GetOrCreateBuild runs a job building the Dockerfile of the source with
+// kaniko or buildah, once per generation of the function and pushed commit.
+// The env of the builder is passed as build args.
+func (b *jobBuilder) GetOrCreateBuild(
+	ctx context.Context,
+	function *kdexv1alpha1.KDexFunction,
+) (controllerutil.OperationResult, *Build, error) {
+	job := &batchv1.Job{}
+	name := b.buildName(fmt.Sprintf("%s-imagebuild-%d", function.Name, function.Generation))
+	err := b.Get(ctx, client.ObjectKey{Namespace: function.Namespace, Name: name}, job)
+	if err == nil {
+		return controllerutil.OperationResultNone, b.jobBuild(ctx, job), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("failed to get image builder: %w", err)
+	}
+
+	job = b.buildJob(function, name)
+	if err := ctrl.SetControllerReference(function, job, b.Scheme); err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	if err := b.Create(ctx, job); err != nil {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("failed to create image builder: %w", err)
+	}
+
+	return controllerutil.OperationResultCreated, b.jobBuild(ctx, job), nil
+}
+
+// buildJob returns the job building the image of the function.
+func (b *jobBuilder) buildJob(function *kdexv1alpha1.KDexFunction, name string) *batchv1.Job {
+	generation := fmt.Sprintf("%d", function.Generation)
+	tags := jobTags(b.ImageRegistry, function)
+	buildContext := path.Join(jobSourceDir, b.Source.Path)
+
+	buildArgs := []string{}
+	if b.Source.Builder != nil {
+		for _, env := range b.Source.Builder.Env {
+			buildArgs = append(buildArgs, fmt.Sprintf("%s=%s", env.Name, env.Value))
+		}
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name:         jobSourceVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+	}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      jobSourceVolume,
+			MountPath: jobSourceDir,
+		},
+	}
+	env := []corev1.EnvVar{}
+	if b.RegistrySecret != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: jobRegistryVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: b.RegistrySecret.Name,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.DockerConfigJsonKey, Path: "config.json"},
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      jobRegistryVolume,
+			MountPath: jobDockerConfig,
+			ReadOnly:  true,
+		})
+		env = append(env,
+			corev1.EnvVar{Name: "DOCKER_CONFIG", Value: jobDockerConfig},
+			corev1.EnvVar{Name: "REGISTRY_AUTH_FILE", Value: path.Join(jobDockerConfig, "config.json")},
+		)
+	}
+
+	build := corev1.Container{
+		Name: jobBuildContainer,
+
+		Env:          env,
+		Image:        b.ExecutorImage,
+		VolumeMounts: volumeMounts,
+	}
+	if b.Engine == EngineBuildah {
+		if build.Image == "" {
+			build.Image = DefaultBuildahImage
+		}
+		args := make([]string, 0, len(buildArgs))
+		for _, arg := range buildArgs {
+			args = append(args, "--build-arg="+arg)
+		}
+		build.Command = []string{"sh", "-c", buildahScript}
+		build.Env = append(build.Env,
+			corev1.EnvVar{Name: "ADDITIONAL_TAGS", Value: strings.Join(tags[1:], " ")},
+			corev1.EnvVar{Name: "BUILD_ARGS", Value: strings.Join(args, " ")},
+			corev1.EnvVar{Name: "CONTEXT", Value: buildContext},
+			corev1.EnvVar{Name: "IMAGE", Value: tags[0]},
+		)
+		// buildah needs to create the mounts of the build.
+		build.SecurityContext = &corev1.SecurityContext{Privileged: new(true)}
+	} else {
+		if build.Image == "" {
+			build.Image = DefaultKanikoImage
+		}
+		build.Args = []string{
+			"--context=dir://" + buildContext,
+			"--digest-file=/dev/termination-log",
+		}
+		for _, tag := range tags {
+			build.Args = append(build.Args, "--destination="+tag)
+		}
+		for _, arg := range buildArgs {
+			build.Args = append(build.Args, "--build-arg="+arg)
+		}
+	}
+
+	checkoutEnv := []corev1.EnvVar{
+		{Name: "SOURCE_DIR", Value: jobSourceDir},
+		{Name: "SOURCE_REPOSITORY", Value: b.Source.Repository},
+		{Name: "SOURCE_REVISION", Value: b.revision()},
+	}
+	if b.GitSecret != nil {
+		for _, key := range []string{"password", "username"} {
+			checkoutEnv = append(checkoutEnv, corev1.EnvVar{
+				Name: "GIT_" + strings.ToUpper(key),
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						Key:                  key,
+						LocalObjectReference: *b.GitSecret,
+					},
+				},
+			})
+		}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: function.Namespace,
+			Labels: map[string]string{
+				"app":                 JobApp,
+				"function":            function.Name,
+				"kdex.dev/generation": generation,
+				"kdex.dev/host":       function.Spec.HostRef.Name,
+			},
+			Annotations: map[string]string{
+				"kdex.dev/generation": generation,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: new(int32(1)),
+			Completions:  new(int32(1)),
+			Parallelism:  new(int32(1)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"kdex.dev/generation": generation,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{build},
+					InitContainers: []corev1.Container{
+						{
+							Name: "git-checkout",
+
+							Command:      []string{"sh", "-c", gitCheckoutScript},
+							Env:          checkoutEnv,
+							Image:        DefaultGitImage,
+							VolumeMounts: volumeMounts[:1],
+						},
+					},
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: b.ServiceAccount,
+					Volumes:            volumes,
+				},
+			},
+		},
+	}
+}
+
+// jobBuild reads the progress of the build from the status of the job. The
+// built image is pinned to the digest the build container terminated with.
+func (b *jobBuilder) jobBuild(ctx context.Context, job *batchv1.Job) *Build {
+	build := &Build{Object: job, Tags: jobTagsOf(job)}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobFailed:
+			build.Failure = cond.Message
+		case batchv1.JobComplete:
+			if len(build.Tags) == 0 {
+				build.Failure = fmt.Sprintf("job %s/%s pushed no image", job.Namespace, job.Name)
+				break
+			}
+			build.Image = build.Tags[0]
+			pod, err := kjob.GetPodForJob(ctx, b.Client, job)
+			if err != nil {
+				break
+			}
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.Name == jobBuildContainer && status.State.Terminated != nil {
+					if digest := strings.TrimSpace(status.State.Terminated.Message); strings.HasPrefix(digest, "sha256:") {
+						build.Image = fmt.Sprintf("%s@%s", build.Image, digest)
+					}
+				}
+			}
+		}
+	}
+
+	return build
+}
+
+// jobTags returns the tags the image of the function is pushed with, the
+// one of the generation first.
+func jobTags(registry kdexv1alpha1.Registry, function *kdexv1alpha1.KDexFunction) []string {
+	repository := fmt.Sprintf("%s/%s/%s", registry.Host, function.Spec.HostRef.Name, function.Name)
+	return []string{
+		fmt.Sprintf("%s:%d", repository, function.Generation),
+		repository + ":latest",
+	}
+}
+
+// jobTagsOf reads the tags back from the build container of the job.
+func jobTagsOf(job *batchv1.Job) []string {
+	tags := []string{}
+	for _, container := range job.Spec.Template.Spec.Containers {
+		if container.Name != jobBuildContainer {
+			continue
+		}
+		for _, arg := range container.Args {
+			if tag, ok := strings.CutPrefix(arg, "--destination="); ok {
+				tags = append(tags, tag)
+			}
+		}
+		for _, env := range container.Env {
+			switch env.Name {
+			case "IMAGE":
+				tags = append([]string{env.Value}, tags...)
+			case "ADDITIONAL_TAGS":
+				tags = append(tags, strings.Fields(env.Value)...)
+			}
+		}
+	}
+	return tags
+}
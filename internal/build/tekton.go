@@ -0,0 +1,196 @@
+package build
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kdex-tech/host-manager/internal"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Parameters and workspace the Tekton pipelines building functions are run
+// with. The pipeline is expected to publish the IMAGE_URL and IMAGE_DIGEST
+// results of the image it pushed.
+const (
+	TektonParamContextPath = "context-path"
+	TektonParamEnv         = "env"
+	TektonParamGitRevision = "git-revision"
+	TektonParamGitURL      = "git-url"
+	TektonParamImage       = "image"
+	TektonWorkspaceSource  = "source"
+
+	tektonResultImageDigest = "IMAGE_DIGEST"
+	tektonResultImageURL    = "IMAGE_URL"
+)
+
+var tektonWorkspaceSize = resource.MustParse("1Gi")
+
+type tektonBuilder struct {
+	*Builder
+}
+
+// GetOrCreateBuild runs the pipeline referenced by the builder once per
+// generation of the function and pushed commit. The builderRef of a Builder
+// kind names a Pipeline in the namespace of the function, a ClusterBuilder
+// kind names a Pipeline resolved by the cluster resolver from the referenced
+// namespace.
+func (b *tektonBuilder) GetOrCreateBuild(
+	ctx context.Context,
+	function *kdexv1alpha1.KDexFunction,
+) (controllerutil.OperationResult, *Build, error) {
+	run := &unstructured.Unstructured{}
+	run.SetGroupVersionKind(internal.TektonPipelineRunGVK)
+
+	name := b.buildName(fmt.Sprintf("%s-%s-%d", function.Spec.HostRef.Name, function.Name, function.GetGeneration()))
+	err := b.Get(ctx, types.NamespacedName{Name: name, Namespace: function.Namespace}, run)
+	if err == nil {
+		return controllerutil.OperationResultNone, tektonPipelineRunBuild(run), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("failed to get image builder: %w", err)
+	}
+
+	if b.Source.Builder == nil {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("source of function %s/%s has no builder", function.Namespace, function.Name)
+	}
+
+	image := fmt.Sprintf("%s/%s/%s:%d", b.ImageRegistry.Host, function.Spec.HostRef.Name, function.Name, function.GetGeneration())
+
+	run = &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"params": []any{
+				map[string]any{"name": TektonParamContextPath, "value": b.Source.Path},
+				map[string]any{"name": TektonParamEnv, "value": tektonEnv(b.Source.Builder.Env)},
+				map[string]any{"name": TektonParamGitRevision, "value": b.revision()},
+				map[string]any{"name": TektonParamGitURL, "value": b.Source.Repository},
+				map[string]any{"name": TektonParamImage, "value": image},
+			},
+			"pipelineRef": tektonPipelineRef(b.Source.Builder.BuilderRef),
+			"taskRunTemplate": map[string]any{
+				"serviceAccountName": b.ServiceAccount,
+			},
+			"workspaces": []any{
+				map[string]any{
+					"name": TektonWorkspaceSource,
+					"volumeClaimTemplate": map[string]any{
+						"spec": map[string]any{
+							"accessModes": []any{"ReadWriteOnce"},
+							"resources": map[string]any{
+								"requests": map[string]any{"storage": tektonWorkspaceSize.String()},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	run.SetGroupVersionKind(internal.TektonPipelineRunGVK)
+	run.SetNamespace(function.Namespace)
+	run.SetName(name)
+	run.SetLabels(map[string]string{
+		"app":           "builder",
+		"function":      function.Name,
+		"kdex.dev/host": function.Spec.HostRef.Name,
+	})
+
+	if err := ctrl.SetControllerReference(function, run, b.Scheme); err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	if err := b.Create(ctx, run); err != nil {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("failed to create image builder: %w", err)
+	}
+
+	return controllerutil.OperationResultCreated, tektonPipelineRunBuild(run), nil
+}
+
+// tektonPipelineRef references the pipeline named by the builder.
+func tektonPipelineRef(ref kdexv1alpha1.KDexObjectReference) map[string]any {
+	if ref.Kind != "ClusterBuilder" {
+		return map[string]any{"name": ref.Name}
+	}
+
+	return map[string]any{
+		"resolver": "cluster",
+		"params": []any{
+			map[string]any{"name": "kind", "value": "pipeline"},
+			map[string]any{"name": "name", "value": ref.Name},
+			map[string]any{"name": "namespace", "value": ref.Namespace},
+		},
+	}
+}
+
+// tektonEnv passes the env of the builder as NAME=value strings.
+func tektonEnv(envVars []corev1.EnvVar) []any {
+	env := make([]any, 0, len(envVars))
+	for _, e := range envVars {
+		env = append(env, fmt.Sprintf("%s=%s", e.Name, e.Value))
+	}
+	return env
+}
+
+// tektonPipelineRunBuild reads the progress of the build from the status of
+// the PipelineRun.
+func tektonPipelineRunBuild(run *unstructured.Unstructured) *Build {
+	build := &Build{Object: run}
+
+	for _, p := range nestedSlice(run, "spec", "params") {
+		param, ok := p.(map[string]any)
+		if ok && param["name"] == TektonParamImage {
+			if tag, ok := param["value"].(string); ok {
+				build.Tags = append(build.Tags, tag)
+			}
+		}
+	}
+
+	for _, c := range nestedSlice(run, "status", "conditions") {
+		cond, ok := c.(map[string]any)
+		if !ok || cond["type"] != "Succeeded" {
+			continue
+		}
+		switch cond["status"] {
+		case "True":
+			build.Image = tektonImage(run, build.Tags)
+		case "False":
+			build.Failure = fmt.Sprintf("%v", cond["message"])
+		}
+	}
+
+	return build
+}
+
+// tektonImage returns the image published in the results of the run, pinned
+// to its digest when the pipeline reports it.
+func tektonImage(run *unstructured.Unstructured, tags []string) string {
+	results := map[string]string{}
+	for _, r := range nestedSlice(run, "status", "results") {
+		result, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		if name, ok := result["name"].(string); ok {
+			results[name], _ = result["value"].(string)
+		}
+	}
+
+	image := results[tektonResultImageURL]
+	if image == "" && len(tags) > 0 {
+		image = tags[0]
+	}
+	if digest := results[tektonResultImageDigest]; digest != "" && image != "" {
+		return fmt.Sprintf("%s@%s", image, digest)
+	}
+	return image
+}
+
+func nestedSlice(obj *unstructured.Unstructured, fields ...string) []any {
+	s, _, _ := unstructured.NestedSlice(obj.Object, fields...)
+	return s
+}
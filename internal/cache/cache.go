@@ -9,11 +9,17 @@ import (
 )
 
 type Cache interface {
+	// AddMember adds the member to the set of the key, whose TTL restarts.
+	AddMember(ctx context.Context, key string, member string) error
 	Class() string
 	Delete(ctx context.Context, key string) error
 	Generation() int64
 	Get(ctx context.Context, key string) (string, bool, bool, error)
 	Host() string
+	// Members returns the members of the set of the key, sorted.
+	Members(ctx context.Context, key string) ([]string, error)
+	// RemoveMember removes the member from the set of the key.
+	RemoveMember(ctx context.Context, key string, member string) error
 	Set(ctx context.Context, key string, value string) error
 	TTL() time.Duration
 	Uncycled() bool
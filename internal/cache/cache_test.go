@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewCacheManager(t *testing.T) {
@@ -102,3 +104,43 @@ func TestNewCacheManager(t *testing.T) {
 		})
 	}
 }
+
+func TestCache_Members(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	for name, addr := range map[string]string{"memory": "", "valkey": s.Addr()} {
+		t.Run(name, func(t *testing.T) {
+			ttl := time.Hour
+			mgr, err := NewCacheManager(addr, "foo", &ttl)
+			require.NoError(t, err)
+			c := mgr.GetCache("sets", CacheOptions{})
+			ctx := context.Background()
+
+			members, err := c.Members(ctx, "set")
+			require.NoError(t, err)
+			assert.Empty(t, members)
+
+			require.NoError(t, c.AddMember(ctx, "set", "b"))
+			require.NoError(t, c.AddMember(ctx, "set", "a"))
+			require.NoError(t, c.AddMember(ctx, "set", "b"))
+			members, err = c.Members(ctx, "set")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, members)
+
+			// The members of the previous generation are still members
+			require.NoError(t, mgr.Cycle(1, false))
+			require.NoError(t, c.AddMember(ctx, "set", "c"))
+			members, err = c.Members(ctx, "set")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b", "c"}, members)
+
+			require.NoError(t, c.RemoveMember(ctx, "set", "a"))
+			require.NoError(t, c.RemoveMember(ctx, "set", "c"))
+			members, err = c.Members(ctx, "set")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"b"}, members)
+		})
+	}
+}
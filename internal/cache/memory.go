@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 )
@@ -19,6 +21,27 @@ type InMemoryCache struct {
 
 var _ Cache = (*InMemoryCache)(nil)
 
+func (c *InMemoryCache) AddMember(ctx context.Context, key string, member string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.segments[c.currentGeneration] == nil {
+		c.segments[c.currentGeneration] = make(map[string]memoryCacheEntry)
+	}
+
+	entry := c.segments[c.currentGeneration][key]
+	members := map[string]struct{}{}
+	if time.Now().Before(entry.expiry) {
+		maps.Copy(members, entry.members)
+	}
+	members[member] = struct{}{}
+	c.segments[c.currentGeneration][key] = memoryCacheEntry{
+		expiry:  time.Now().Add(c.ttl),
+		members: members,
+	}
+	return nil
+}
+
 func (c *InMemoryCache) Class() string {
 	return c.class
 }
@@ -86,6 +109,44 @@ func (c *InMemoryCache) Get(ctx context.Context, key string) (string, bool, bool
 	return "", false, true, nil // Not found in either version
 }
 
+func (c *InMemoryCache) Members(ctx context.Context, key string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	members := []string{}
+	for _, seg := range c.segments {
+		if entry, found := seg[key]; found && now.Before(entry.expiry) {
+			for member := range entry.members {
+				members = append(members, member)
+			}
+		}
+	}
+	slices.Sort(members)
+	return slices.Compact(members), nil
+}
+
+func (c *InMemoryCache) RemoveMember(ctx context.Context, key string, member string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, seg := range c.segments {
+		entry, found := seg[key]
+		if !found {
+			continue
+		}
+		members := maps.Clone(entry.members)
+		delete(members, member)
+		if len(members) == 0 {
+			delete(seg, key)
+			continue
+		}
+		entry.members = members
+		seg[key] = entry
+	}
+	return nil
+}
+
 // Set stores a rendered page in the cache.
 func (c *InMemoryCache) Set(ctx context.Context, key string, value string) error {
 	c.mu.Lock()
@@ -234,6 +295,7 @@ func (m *InMemoryCacheManager) GetCache(class string, opts CacheOptions) Cache {
 }
 
 type memoryCacheEntry struct {
-	expiry time.Time
-	value  string
+	expiry  time.Time
+	members map[string]struct{}
+	value   string
 }
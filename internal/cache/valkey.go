@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -23,6 +24,23 @@ type ValkeyCache struct {
 
 var _ Cache = (*ValkeyCache)(nil)
 
+func (s *ValkeyCache) AddMember(ctx context.Context, key string, member string) error {
+	s.mu.RLock()
+	prefix := s.prefix
+	s.mu.RUnlock()
+
+	for _, resp := range s.client.DoMulti(
+		ctx,
+		s.client.B().Sadd().Key(prefix+key).Member(member).Build(),
+		s.client.B().Pexpire().Key(prefix+key).Milliseconds(s.ttl.Milliseconds()).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *ValkeyCache) Class() string {
 	return s.class
 }
@@ -83,6 +101,48 @@ func (s *ValkeyCache) Get(ctx context.Context, key string) (string, bool, bool,
 	return "", false, true, nil // Not found in either version
 }
 
+func (s *ValkeyCache) Members(ctx context.Context, key string) ([]string, error) {
+	s.mu.RLock()
+	curr := s.prefix
+	prev := s.prevPrefix
+	s.mu.RUnlock()
+
+	fullKeys := []string{curr + key}
+	if prev != "" {
+		fullKeys = append(fullKeys, prev+key)
+	}
+
+	members := []string{}
+	for _, fullKey := range fullKeys {
+		cmd := s.client.B().Smembers().Key(fullKey).Build()
+		values, err := s.client.Do(ctx, cmd).AsStrSlice()
+		if err != nil && !valkey.IsValkeyNil(err) {
+			return nil, err
+		}
+		members = append(members, values...)
+	}
+	slices.Sort(members)
+	return slices.Compact(members), nil
+}
+
+func (s *ValkeyCache) RemoveMember(ctx context.Context, key string, member string) error {
+	s.mu.RLock()
+	curr := s.prefix
+	prev := s.prevPrefix
+	s.mu.RUnlock()
+
+	cmds := valkey.Commands{s.client.B().Srem().Key(curr + key).Member(member).Build()}
+	if prev != "" {
+		cmds = append(cmds, s.client.B().Srem().Key(prev+key).Member(member).Build())
+	}
+	for _, resp := range s.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *ValkeyCache) Set(ctx context.Context, key string, value string) error {
 	s.mu.RLock()
 	prefix := s.prefix
@@ -0,0 +1,134 @@
+// Package child holds the mutations the reconcilers apply to the workloads
+// they create for a host so that every child gets the same env, labels and
+// volumes.
+package child
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/kdex-tech/host-manager/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+)
+
+// CORSDomainsEnv is the env var holding the pattern matching the domains of
+// the host.
+const CORSDomainsEnv = "CORS_DOMAINS"
+
+// CORSDomains returns the CORS_DOMAINS env var of a host serving the domains.
+func CORSDomains(domains []string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name:  CORSDomainsEnv,
+		Value: utils.DomainsToMatcher(domains),
+	}
+}
+
+// SetEnv returns a copy of env where each of vars replaces the variable of
+// the same name, or is appended when there is none. The order of env is
+// kept.
+func SetEnv(env []corev1.EnvVar, vars ...corev1.EnvVar) []corev1.EnvVar {
+	out := slices.Clone(env)
+	for _, v := range vars {
+		idx := slices.IndexFunc(out, func(e corev1.EnvVar) bool { return e.Name == v.Name })
+		if idx == -1 {
+			out = append(out, v)
+			continue
+		}
+		out[idx] = v
+	}
+	return out
+}
+
+// UnsetEnv returns a copy of env without the named variables.
+func UnsetEnv(env []corev1.EnvVar, names ...string) []corev1.EnvVar {
+	return slices.DeleteFunc(slices.Clone(env), func(e corev1.EnvVar) bool { return slices.Contains(names, e.Name) })
+}
+
+// EnvDrift returns the names of the expected variables which env is missing
+// or holds a different value for.
+func EnvDrift(env []corev1.EnvVar, expected ...corev1.EnvVar) []string {
+	drift := []string{}
+	for _, want := range expected {
+		idx := slices.IndexFunc(env, func(e corev1.EnvVar) bool { return e.Name == want.Name })
+		if idx == -1 || env[idx].Value != want.Value || env[idx].ValueFrom != nil {
+			drift = append(drift, want.Name)
+		}
+	}
+	return drift
+}
+
+// StampLabels copies the stamp onto labels, allocating labels when nil.
+func StampLabels(labels map[string]string, stamp map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(stamp))
+	}
+	maps.Copy(labels, stamp)
+	return labels
+}
+
+// SetImageVolume mounts the OCI image read only at mountPath of the
+// container, adding or updating the volume of the given name.
+func SetImageVolume(
+	spec *corev1.PodSpec,
+	container *corev1.Container,
+	name string,
+	reference string,
+	pullPolicy corev1.PullPolicy,
+	mountPath string,
+) {
+	volume := corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			Image: &corev1.ImageVolumeSource{
+				Reference:  reference,
+				PullPolicy: pullPolicy,
+			},
+		},
+	}
+	if idx := slices.IndexFunc(spec.Volumes, func(v corev1.Volume) bool { return v.Name == name }); idx != -1 {
+		spec.Volumes[idx] = volume
+	} else {
+		spec.Volumes = append(spec.Volumes, volume)
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      name,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+	if idx := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == name }); idx != -1 {
+		container.VolumeMounts[idx] = mount
+	} else {
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+	}
+}
+
+// AddImagePullSecrets references the secrets from the pod spec unless it
+// already does.
+func AddImagePullSecrets(spec *corev1.PodSpec, secrets ...corev1.Secret) {
+	for _, secret := range secrets {
+		ref := corev1.LocalObjectReference{Name: secret.Name}
+		if !slices.Contains(spec.ImagePullSecrets, ref) {
+			spec.ImagePullSecrets = append(spec.ImagePullSecrets, ref)
+		}
+	}
+}
+
+// DefaultBackend sets the fields of the backend left unset to the defaults
+// of the configuration: the pull policy of the server image, and the
+// replicas and the resources of the default backend deployment. The server
+// image is not defaulted so that backends follow the default image when the
+// configuration changes.
+func DefaultBackend(backend *kdexv1alpha1.Backend, defaults *configuration.BackendDefault) {
+	if backend.ServerImagePullPolicy == "" {
+		backend.ServerImagePullPolicy = defaults.ServerImagePullPolicy
+	}
+	if backend.Replicas == nil && defaults.Deployment.Replicas != nil {
+		backend.Replicas = new(*defaults.Deployment.Replicas)
+	}
+	if backend.Resources.Size() == 0 && len(defaults.Deployment.Template.Spec.Containers) > 0 {
+		backend.Resources = *defaults.Deployment.Template.Spec.Containers[0].Resources.DeepCopy()
+	}
+}
@@ -0,0 +1,223 @@
+package child
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+)
+
+func TestCORSDomains(t *testing.T) {
+	assert.Equal(t, corev1.EnvVar{
+		Name:  "CORS_DOMAINS",
+		Value: "foo\\.bar|.*\\.fiz\\.bum",
+	}, CORSDomains([]string{"foo.bar", "*.fiz.bum"}))
+}
+
+func TestSetEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []corev1.EnvVar
+		vars []corev1.EnvVar
+		want []corev1.EnvVar
+	}{
+		{
+			name: "append to empty",
+			vars: []corev1.EnvVar{{Name: "A", Value: "1"}},
+			want: []corev1.EnvVar{{Name: "A", Value: "1"}},
+		},
+		{
+			name: "replace in place",
+			env:  []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}},
+			vars: []corev1.EnvVar{{Name: "A", Value: "3"}, {Name: "C", Value: "4"}},
+			want: []corev1.EnvVar{{Name: "A", Value: "3"}, {Name: "B", Value: "2"}, {Name: "C", Value: "4"}},
+		},
+		{
+			name: "value replaces value from",
+			env: []corev1.EnvVar{{Name: "A", ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			}}},
+			vars: []corev1.EnvVar{{Name: "A", Value: "1"}},
+			want: []corev1.EnvVar{{Name: "A", Value: "1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SetEnv(tt.env, tt.vars...))
+		})
+	}
+}
+
+func TestSetEnv_doesNotAlias(t *testing.T) {
+	base := make([]corev1.EnvVar, 1, 4)
+	base[0] = corev1.EnvVar{Name: "A", Value: "1"}
+
+	first := SetEnv(base, corev1.EnvVar{Name: "A", Value: "2"}, corev1.EnvVar{Name: "B", Value: "1"})
+	second := SetEnv(base, corev1.EnvVar{Name: "C", Value: "1"})
+
+	assert.Equal(t, []corev1.EnvVar{{Name: "A", Value: "1"}}, base)
+	assert.Equal(t, []corev1.EnvVar{{Name: "A", Value: "2"}, {Name: "B", Value: "1"}}, first)
+	assert.Equal(t, []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "C", Value: "1"}}, second)
+}
+
+func TestEnvDrift(t *testing.T) {
+	env := []corev1.EnvVar{
+		{Name: "A", Value: "1"},
+		{Name: "B", Value: "2"},
+		{Name: "C", ValueFrom: &corev1.EnvVarSource{}},
+	}
+
+	assert.Empty(t, EnvDrift(env, corev1.EnvVar{Name: "A", Value: "1"}))
+	assert.Equal(t, []string{"B", "C", "D"}, EnvDrift(
+		env,
+		corev1.EnvVar{Name: "A", Value: "1"},
+		corev1.EnvVar{Name: "B", Value: "3"},
+		corev1.EnvVar{Name: "C", Value: "4"},
+		corev1.EnvVar{Name: "D", Value: "5"},
+	))
+}
+
+func TestStampLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{"a": "1"}, StampLabels(nil, map[string]string{"a": "1"}))
+	assert.Equal(t,
+		map[string]string{"a": "2", "b": "1"},
+		StampLabels(map[string]string{"a": "1", "b": "1"}, map[string]string{"a": "2"}),
+	)
+}
+
+func TestSetImageVolume(t *testing.T) {
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "backend"}}}
+
+	SetImageVolume(spec, &spec.Containers[0], "oci-image", "static:1", corev1.PullIfNotPresent, "/public")
+	SetImageVolume(spec, &spec.Containers[0], "oci-image", "static:2", corev1.PullAlways, "/public")
+
+	assert.Equal(t, []corev1.Volume{{
+		Name: "oci-image",
+		VolumeSource: corev1.VolumeSource{
+			Image: &corev1.ImageVolumeSource{Reference: "static:2", PullPolicy: corev1.PullAlways},
+		},
+	}}, spec.Volumes)
+	assert.Equal(t, []corev1.VolumeMount{{
+		Name:      "oci-image",
+		MountPath: "/public",
+		ReadOnly:  true,
+	}}, spec.Containers[0].VolumeMounts)
+}
+
+func TestAddImagePullSecrets(t *testing.T) {
+	spec := &corev1.PodSpec{}
+	secret := corev1.Secret{}
+	secret.Name = "registry"
+
+	AddImagePullSecrets(spec, secret)
+	AddImagePullSecrets(spec, secret)
+
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, spec.ImagePullSecrets)
+}
+
+func TestUnsetEnv(t *testing.T) {
+	env := []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}, {Name: "C", Value: "3"}}
+
+	assert.Equal(t, []corev1.EnvVar{{Name: "B", Value: "2"}}, UnsetEnv(env, "A", "C", "D"))
+	assert.Len(t, env, 3)
+}
+
+func TestRuntimeConfigData(t *testing.T) {
+	host := &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "fr",
+		Routing: kdexv1alpha1.Routing{
+			Domains: []string{"foo.bar", "*.fiz.bum"},
+			Scheme:  "https",
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		RuntimeAuthIssuerKey:  "https://foo.bar",
+		RuntimeDefaultLangKey: "fr",
+		RuntimeDomainsKey:     "foo.bar,*.fiz.bum",
+	}, RuntimeConfigData(host))
+
+	assert.Equal(t, "", RuntimeConfigData(&kdexv1alpha1.KDexHostSpec{})[RuntimeAuthIssuerKey])
+}
+
+func TestRuntimeConfigVersion(t *testing.T) {
+	data := map[string]string{"a": "1", "b": "2"}
+
+	assert.Equal(t, RuntimeConfigVersion(data), RuntimeConfigVersion(map[string]string{"b": "2", "a": "1"}))
+	assert.NotEqual(t, RuntimeConfigVersion(data), RuntimeConfigVersion(map[string]string{"a": "1", "b": "3"}))
+	assert.NotEqual(t, RuntimeConfigVersion(map[string]string{"a": "1=b"}), RuntimeConfigVersion(map[string]string{"a": "1", "b": ""}))
+}
+
+func TestSetRuntimeConfig(t *testing.T) {
+	configMap := &corev1.ConfigMap{Data: map[string]string{RuntimeDomainsKey: "foo.bar"}}
+	configMap.Name = "host-runtime-config"
+
+	template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "backend",
+		Env:  []corev1.EnvVar{{Name: "A", Value: "1"}},
+	}}}}
+	container := &template.Spec.Containers[0]
+
+	SetRuntimeConfig(template, container, configMap, true)
+	SetRuntimeConfig(template, container, configMap, true)
+
+	assert.Len(t, template.Spec.Volumes, 1)
+	assert.Equal(t, "host-runtime-config", template.Spec.Volumes[0].ConfigMap.Name)
+	assert.Equal(t, []corev1.VolumeMount{{
+		Name:      "runtime-config",
+		MountPath: RuntimeConfigMountPath,
+		ReadOnly:  true,
+	}}, container.VolumeMounts)
+	assert.Equal(t, RuntimeConfigVersion(configMap.Data), template.Annotations[RuntimeConfigVersionAnnotation])
+
+	names := []string{}
+	for _, e := range container.Env {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"A", "KDEX_AUTH_ISSUER", "KDEX_DEFAULT_LANG", "KDEX_DOMAINS"}, names)
+	assert.Equal(t, RuntimeDomainsKey, container.Env[3].ValueFrom.ConfigMapKeyRef.Key)
+
+	configMap.Data[RuntimeDomainsKey] = "baz.bar"
+	previous := template.Annotations[RuntimeConfigVersionAnnotation]
+	SetRuntimeConfig(template, container, configMap, false)
+
+	assert.NotEqual(t, previous, template.Annotations[RuntimeConfigVersionAnnotation])
+	assert.Equal(t, []corev1.EnvVar{{Name: "A", Value: "1"}}, container.Env)
+}
+
+func TestDefaultBackend(t *testing.T) {
+	defaults := &configuration.BackendDefault{ServerImagePullPolicy: corev1.PullIfNotPresent}
+	defaults.Deployment.Replicas = new(int32(2))
+	defaults.Deployment.Template.Spec.Containers = []corev1.Container{{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		},
+	}}
+
+	backend := &kdexv1alpha1.Backend{StaticImage: "shop/static:1"}
+	DefaultBackend(backend, defaults)
+	assert.Equal(t, corev1.PullIfNotPresent, backend.ServerImagePullPolicy)
+	assert.Equal(t, int32(2), *backend.Replicas)
+	assert.Equal(t, defaults.Deployment.Template.Spec.Containers[0].Resources, backend.Resources)
+	assert.Empty(t, backend.ServerImage)
+
+	*backend.Replicas = 3
+	assert.Equal(t, int32(2), *defaults.Deployment.Replicas, "defaults are copied")
+
+	backend = &kdexv1alpha1.Backend{
+		Runtime: kdexv1alpha1.Runtime{
+			Replicas: new(int32(1)),
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		},
+		ServerImagePullPolicy: corev1.PullAlways,
+	}
+	DefaultBackend(backend, defaults)
+	assert.Equal(t, corev1.PullAlways, backend.ServerImagePullPolicy)
+	assert.Equal(t, int32(1), *backend.Replicas)
+	assert.Empty(t, backend.Resources.Requests)
+}
@@ -0,0 +1,129 @@
+package child
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// Keys of the runtime settings projected for the children of a host.
+const (
+	RuntimeAuthIssuerKey  = "auth-issuer"
+	RuntimeDefaultLangKey = "default-lang"
+	RuntimeDomainsKey     = "domains"
+)
+
+const (
+	// RuntimeConfigMountPath is where the runtime settings are mounted, one
+	// file per key.
+	RuntimeConfigMountPath = "/etc/kdex/runtime"
+	// RuntimeConfigVersionAnnotation records the version of the runtime
+	// settings on the pod template so that changing them rolls the pods.
+	RuntimeConfigVersionAnnotation = "kdex.dev/runtime-config-version"
+
+	runtimeConfigVolume = "runtime-config"
+)
+
+// runtimeEnv maps the env vars optionally injected into a container to the
+// runtime settings they reference.
+var runtimeEnv = map[string]string{
+	"KDEX_AUTH_ISSUER":  RuntimeAuthIssuerKey,
+	"KDEX_DEFAULT_LANG": RuntimeDefaultLangKey,
+	"KDEX_DOMAINS":      RuntimeDomainsKey,
+}
+
+// RuntimeConfigName returns the name of the ConfigMap projecting the runtime
+// settings of the host.
+func RuntimeConfigName(hostName string) string {
+	return fmt.Sprintf("%s-runtime-config", hostName)
+}
+
+// RuntimeConfigData returns the runtime settings of the host. Domains are
+// comma separated, the first one being the one the issuer is derived from.
+func RuntimeConfigData(host *kdexv1alpha1.KDexHostSpec) map[string]string {
+	data := map[string]string{
+		RuntimeAuthIssuerKey:  "",
+		RuntimeDefaultLangKey: host.DefaultLang,
+		RuntimeDomainsKey:     strings.Join(host.Routing.Domains, ","),
+	}
+	if len(host.Routing.Domains) > 0 {
+		data[RuntimeAuthIssuerKey] = fmt.Sprintf("%s://%s", host.Routing.Scheme, host.Routing.Domains[0])
+	}
+	return data
+}
+
+// RuntimeConfigVersion hashes the runtime settings. It only changes when a
+// setting does.
+func RuntimeConfigVersion(data map[string]string) string {
+	hash := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		fmt.Fprintf(hash, "%s=%q\n", key, data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// SetRuntimeConfig mounts the runtime settings of the ConfigMap into the
+// container and records their version on the template. When injectEnv is
+// set the settings are also exposed as KDEX_* env vars, otherwise those vars
+// are removed.
+func SetRuntimeConfig(
+	template *corev1.PodTemplateSpec,
+	container *corev1.Container,
+	configMap *corev1.ConfigMap,
+	injectEnv bool,
+) {
+	volume := corev1.Volume{
+		Name: runtimeConfigVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+			},
+		},
+	}
+	spec := &template.Spec
+	if idx := slices.IndexFunc(spec.Volumes, func(v corev1.Volume) bool { return v.Name == runtimeConfigVolume }); idx != -1 {
+		spec.Volumes[idx] = volume
+	} else {
+		spec.Volumes = append(spec.Volumes, volume)
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      runtimeConfigVolume,
+		MountPath: RuntimeConfigMountPath,
+		ReadOnly:  true,
+	}
+	if idx := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == runtimeConfigVolume }); idx != -1 {
+		container.VolumeMounts[idx] = mount
+	} else {
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+	}
+
+	if injectEnv {
+		vars := make([]corev1.EnvVar, 0, len(runtimeEnv))
+		for _, name := range slices.Sorted(maps.Keys(runtimeEnv)) {
+			vars = append(vars, corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+						Key:                  runtimeEnv[name],
+					},
+				},
+			})
+		}
+		container.Env = SetEnv(container.Env, vars...)
+	} else {
+		container.Env = UnsetEnv(container.Env, slices.Collect(maps.Keys(runtimeEnv))...)
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[RuntimeConfigVersionAnnotation] = RuntimeConfigVersion(configMap.Data)
+}
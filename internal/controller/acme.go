@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/host"
+	networkingv1 "k8s.io/api/networking/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// acmeSolverLabel marks the ingresses cert-manager creates to route the HTTP-01
+// challenges to their solvers.
+const acmeSolverLabel = "acme.cert-manager.io/http01-solver"
+
+// acmeChallengePaths returns the paths of the rules routing HTTP-01 challenges
+// to a service other than the host manager, by the host of their rule. These
+// are the paths cert-manager adds to the ingress of the host when it edits it
+// in place.
+func (r *KDexInternalHostReconciler) acmeChallengePaths(rules []networkingv1.IngressRule) map[string][]networkingv1.HTTPIngressPath {
+	paths := map[string][]networkingv1.HTTPIngressPath{}
+	for _, rule := range rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if !strings.HasPrefix(p.Path, host.ACMEChallengePrefix) || p.Backend.Service == nil || p.Backend.Service.Name == r.ServiceName {
+				continue
+			}
+			paths[rule.Host] = append(paths[rule.Host], p)
+		}
+	}
+	return paths
+}
+
+// acmeSolvers returns the solvers of the HTTP-01 challenges of the domains of
+// the host, routed by its own ingress or by the solver ingresses of its
+// namespace.
+func (r *KDexInternalHostReconciler) acmeSolvers(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost) ([]host.ACMESolver, error) {
+	var list networkingv1.IngressList
+	if err := r.List(ctx, &list, client.InNamespace(internalHost.Namespace)); err != nil {
+		return nil, err
+	}
+
+	solvers := []host.ACMESolver{}
+	for _, ingress := range list.Items {
+		if ingress.Name != internalHost.Name && ingress.Labels[acmeSolverLabel] != "true" {
+			continue
+		}
+		for domain, paths := range r.acmeChallengePaths(ingress.Spec.Rules) {
+			if domain != "" && !slices.Contains(internalHost.Spec.Routing.Domains, domain) {
+				continue
+			}
+			for _, p := range paths {
+				port := p.Backend.Service.Port.Number
+				if port == 0 {
+					continue
+				}
+				solvers = append(solvers, host.ACMESolver{
+					Domain: domain,
+					Path:   p.Path,
+					URL: &url.URL{
+						Scheme: "http",
+						Host:   fmt.Sprintf("%s.%s.svc:%d", p.Backend.Service.Name, ingress.Namespace, port),
+					},
+				})
+			}
+		}
+	}
+
+	return solvers, nil
+}
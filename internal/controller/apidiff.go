@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// apiCompatibilityAnnotation sets, on a host, the policy of the changes
+	// of the APIs of its functions.
+	apiCompatibilityAnnotation = "kdex.dev/api-compatibility"
+	// noBreakingChanges blocks the reconcile of functions whose API changed
+	// in a way breaking its clients.
+	noBreakingChanges = "no-breaking-changes"
+	// acceptBreakingChangesAnnotation accepts, on a function, the breaking
+	// changes of its API at the generation it is set to.
+	acceptBreakingChangesAnnotation = "kdex.dev/accept-breaking-changes"
+
+	// observedAPIAttribute is the API, as JSON, of the last generation of the
+	// function whose changes were accepted.
+	observedAPIAttribute = "api.observed"
+	// observedAPIGenerationAttribute is that generation.
+	observedAPIGenerationAttribute = "api.observed.generation"
+
+	// breakingChangesCondition is True when the last change of the API of the
+	// function broke its clients.
+	breakingChangesCondition = "BreakingChanges"
+
+	reasonBreakingChanges   = "BreakingChanges"
+	reasonNoBreakingChanges = "NoBreakingChanges"
+)
+
+// parseAPICompatibility reports whether the annotations of a host block
+// breaking changes.
+func parseAPICompatibility(annotations map[string]string) (bool, error) {
+	switch policy := annotations[apiCompatibilityAnnotation]; policy {
+	case "":
+		return false, nil
+	case noBreakingChanges:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid %s annotation %q, expected %s", apiCompatibilityAnnotation, policy, noBreakingChanges)
+	}
+}
+
+// handleAPIChanges diffs the API of the function against the API of the
+// last observed generation and records its breaking changes in the
+// BreakingChanges condition. It reports whether the reconcile should return
+// with the result.
+func (r *KDexFunctionReconciler) handleAPIChanges(hc handlerContext) (bool, ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
+	fail := func(err error) (bool, ctrl.Result, error) {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return true, ctrl.Result{}, err
+	}
+
+	block, err := parseAPICompatibility(hc.host.Annotations)
+	if err != nil {
+		return fail(err)
+	}
+
+	current, err := json.Marshal(hc.function.Spec.API)
+	if err != nil {
+		return fail(fmt.Errorf("failed to marshal API of function %s/%s: %w", hc.function.Namespace, hc.function.Name, err))
+	}
+
+	observed := hc.function.Status.Attributes[observedAPIAttribute]
+	if observed == string(current) {
+		return false, ctrl.Result{}, nil
+	}
+
+	observe := func() {
+		hc.function.Status.Attributes[observedAPIAttribute] = string(current)
+		hc.function.Status.Attributes[observedAPIGenerationAttribute] = fmt.Sprintf("%d", hc.function.Generation)
+	}
+
+	previous := kdexv1alpha1.API{}
+	if observed == "" {
+		observe()
+		return false, ctrl.Result{}, nil
+	}
+	if err := json.Unmarshal([]byte(observed), &previous); err != nil {
+		log.Error(err, "dropping unreadable observed API")
+		observe()
+		return false, ctrl.Result{}, nil
+	}
+
+	changes := ko.Diff(ko.FromKDexAPI(&previous), ko.FromKDexAPI(&hc.function.Spec.API))
+	breaking := ko.Breaking(changes)
+	since := hc.function.Status.Attributes[observedAPIGenerationAttribute]
+
+	if len(breaking) == 0 {
+		meta.SetStatusCondition(&hc.function.Status.Conditions, metav1.Condition{
+			Message: fmt.Sprintf("%d compatible changes since generation %s", len(changes), since),
+			Reason:  reasonNoBreakingChanges,
+			Status:  metav1.ConditionFalse,
+			Type:    breakingChangesCondition,
+		})
+		observe()
+		return false, ctrl.Result{}, nil
+	}
+
+	meta.SetStatusCondition(&hc.function.Status.Conditions, metav1.Condition{
+		Message: fmt.Sprintf("%d breaking changes since generation %s: %s", len(breaking), since, ko.Summary(breaking)),
+		Reason:  reasonBreakingChanges,
+		Status:  metav1.ConditionTrue,
+		Type:    breakingChangesCondition,
+	})
+
+	accepted := hc.function.Annotations[acceptBreakingChangesAnnotation] == strconv.FormatInt(hc.function.Generation, 10)
+	if block && !accepted {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf(
+				"API has breaking changes since generation %s, blocked by the %s policy of the host, set %s to %d to accept them",
+				since, noBreakingChanges, acceptBreakingChangesAnnotation, hc.function.Generation,
+			),
+		)
+		return true, ctrl.Result{}, nil
+	}
+
+	log.Info("API has breaking changes", "since", since, "changes", ko.Summary(breaking))
+	observe()
+	return false, ctrl.Result{}, nil
+}
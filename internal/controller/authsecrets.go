@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// authSecretTypes are the kdex.dev/secret-type annotations of the secrets the
+// authentication of a host is built from.
+var authSecretTypes = []string{"auth-client", "jwt-keys", "oidc-client"}
+
+// requestsForAuthSecret enqueues the focal host when a secret of its service
+// account holding its signing keys or its client credentials changes. The
+// reconcile rebuilds the auth.Config and the auth.Exchanger and swaps them in
+// the HostHandler, which keeps serving with the previous ones until then, or
+// when the new secret is invalid.
+func (r *KDexInternalHostReconciler) requestsForAuthSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	if !slices.Contains(authSecretTypes, obj.GetAnnotations()["kdex.dev/secret-type"]) {
+		return nil
+	}
+
+	var internalHost kdexv1alpha1.KDexInternalHost
+	if err := r.Get(ctx, types.NamespacedName{Name: r.FocalHost, Namespace: obj.GetNamespace()}, &internalHost); err != nil {
+		return nil
+	}
+
+	var serviceAccount corev1.ServiceAccount
+	if err := r.Get(ctx, types.NamespacedName{Name: internalHost.Spec.ServiceAccountRef.Name, Namespace: obj.GetNamespace()}, &serviceAccount); err != nil {
+		return nil
+	}
+	if !slices.ContainsFunc(serviceAccount.Secrets, func(ref corev1.ObjectReference) bool { return ref.Name == obj.GetName() }) {
+		return nil
+	}
+
+	logf.FromContext(ctx).V(1).Info("reloading the authentication of the host", "secret", obj.GetName())
+
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name:      internalHost.Name,
+				Namespace: internalHost.Namespace,
+			},
+		},
+	}
+}
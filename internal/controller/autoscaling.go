@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/child"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// backendAutoscalingAnnotation holds, on the object declaring a backend,
+	// the JSON encoded backendAutoscaling of its deployment, e.g.
+	// {"minReplicas": 2, "maxReplicas": 10, "targetCPUUtilization": 70}.
+	backendAutoscalingAnnotation = "kdex.dev/backend-autoscaling"
+	// packagesAutoscalingAnnotation holds, on a host, the backendAutoscaling
+	// of the deployment serving its packages.
+	packagesAutoscalingAnnotation = "kdex.dev/packages-autoscaling"
+
+	defaultRequestsPerSecondMetric = "http_requests_per_second"
+)
+
+// backendAutoscaling scales a backend deployment with a HorizontalPodAutoscaler
+// on the CPU utilization of its pods, their requests per second, or both.
+type backendAutoscaling struct {
+	MaxReplicas int32  `json:"maxReplicas"`
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// RequestsPerSecondMetric is the pods metric counting the requests per
+	// second, http_requests_per_second when unset. It must be served by a
+	// custom metrics adapter.
+	RequestsPerSecondMetric string `json:"requestsPerSecondMetric,omitempty"`
+	// TargetCPUUtilization is the average CPU utilization of the pods, as a
+	// percentage of their CPU requests.
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+	// TargetRequestsPerSecond is the average requests per second of the pods,
+	// e.g. "100" or "500m".
+	TargetRequestsPerSecond *resource.Quantity `json:"targetRequestsPerSecond,omitempty"`
+}
+
+// parseBackendAutoscaling returns the autoscaling of the annotations of the
+// object declaring a backend, nil when backendAutoscalingAnnotation is not
+// set.
+func parseBackendAutoscaling(annotations map[string]string) (*backendAutoscaling, error) {
+	value := annotations[backendAutoscalingAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	autoscaling := &backendAutoscaling{}
+	if err := json.Unmarshal([]byte(value), autoscaling); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", backendAutoscalingAnnotation, err)
+	}
+
+	minReplicas := int32(1)
+	if autoscaling.MinReplicas != nil {
+		minReplicas = *autoscaling.MinReplicas
+	}
+	if minReplicas < 1 || autoscaling.MaxReplicas < minReplicas {
+		return nil, fmt.Errorf(
+			"invalid %s annotation: expected 1 <= minReplicas <= maxReplicas, got %d and %d",
+			backendAutoscalingAnnotation, minReplicas, autoscaling.MaxReplicas,
+		)
+	}
+	if autoscaling.TargetCPUUtilization == nil && autoscaling.TargetRequestsPerSecond == nil {
+		return nil, fmt.Errorf(
+			"invalid %s annotation: at least one of targetCPUUtilization or targetRequestsPerSecond is required",
+			backendAutoscalingAnnotation,
+		)
+	}
+	if autoscaling.TargetCPUUtilization != nil && *autoscaling.TargetCPUUtilization < 1 {
+		return nil, fmt.Errorf("invalid %s annotation: targetCPUUtilization must be positive", backendAutoscalingAnnotation)
+	}
+	if autoscaling.TargetRequestsPerSecond != nil && autoscaling.TargetRequestsPerSecond.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid %s annotation: targetRequestsPerSecond must be positive", backendAutoscalingAnnotation)
+	}
+	if autoscaling.RequestsPerSecondMetric == "" {
+		autoscaling.RequestsPerSecondMetric = defaultRequestsPerSecondMetric
+	}
+
+	return autoscaling, nil
+}
+
+// metrics returns the metrics of the HorizontalPodAutoscaler of the
+// autoscaling.
+func (a *backendAutoscaling) metrics() []autoscalingv2.MetricSpec {
+	metrics := []autoscalingv2.MetricSpec{}
+	if a.TargetCPUUtilization != nil {
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: a.TargetCPUUtilization,
+				},
+			},
+		})
+	}
+	if a.TargetRequestsPerSecond != nil {
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: a.RequestsPerSecondMetric},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: a.TargetRequestsPerSecond,
+				},
+			},
+		})
+	}
+	return metrics
+}
+
+// createOrUpdateBackendAutoscaler maintains the HorizontalPodAutoscaler of the
+// backend workload, or deletes it when the backend is not autoscaled or runs
+// in a CronJob.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendAutoscaler(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	workload client.Object,
+	resolvedBackend resolvedBackend,
+	autoscaling *backendAutoscaling,
+) (controllerutil.OperationResult, error) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.GetName(),
+			Namespace: workload.GetNamespace(),
+		},
+	}
+
+	if autoscaling == nil || !workloadServes(workload) {
+		if err := r.Delete(ctx, hpa); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		hpa,
+		func() error {
+			hpa.Labels = child.StampLabels(hpa.Labels, map[string]string{
+				"kdex.dev/backend": resolvedBackend.Name,
+				"kdex.dev/host":    internalHost.Name,
+				"kdex.dev/kind":    resolvedBackend.Kind,
+				"kdex.dev/type":    internal.BACKEND,
+			})
+			hpa.Spec.ScaleTargetRef = autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       workloadKind(workload),
+				Name:       workload.GetName(),
+			}
+			hpa.Spec.MinReplicas = autoscaling.MinReplicas
+			hpa.Spec.MaxReplicas = autoscaling.MaxReplicas
+			hpa.Spec.Metrics = autoscaling.metrics()
+
+			return ctrl.SetControllerReference(internalHost, hpa, r.Scheme)
+		},
+	)
+}
+
+// cleanupObsoleteAutoscalers deletes the HorizontalPodAutoscalers of the
+// backends no longer required by the host.
+func (r *KDexInternalHostReconciler) cleanupObsoleteAutoscalers(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backendNames map[string]bool,
+	labelSelector client.MatchingLabels,
+) error {
+	hpaList := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := r.List(ctx, hpaList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
+		return err
+	}
+
+	for _, hpa := range hpaList.Items {
+		if !backendNames[hpa.Name] {
+			if err := r.Delete(ctx, &hpa); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
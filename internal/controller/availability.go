@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/child"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// backendAvailabilityAnnotation holds, on the object declaring a backend,
+	// the JSON encoded backendAvailability of its deployment, e.g.
+	// {"minAvailable": 1, "topologySpreadConstraints": [{"maxSkew": 1,
+	// "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable":
+	// "ScheduleAnyway"}]}. Set on the pod template of the deployment of the
+	// backend defaults, it is the availability of the backends without one.
+	backendAvailabilityAnnotation = "kdex.dev/backend-availability"
+	// packagesAvailabilityAnnotation holds, on a host, the backendAvailability
+	// of the deployment serving its packages.
+	packagesAvailabilityAnnotation = "kdex.dev/packages-availability"
+)
+
+// backendAvailability keeps a backend deployment available through voluntary
+// disruptions, e.g. node drains, with a PodDisruptionBudget, and through the
+// loss of a node or a zone by spreading its pods.
+type backendAvailability struct {
+	// Affinity replaces the affinity of the pods of the deployment.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// MaxUnavailable and MinAvailable, exclusive, are those of the
+	// PodDisruptionBudget of the deployment, e.g. 1 or "50%". The deployment
+	// has no PodDisruptionBudget when neither is set.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// TopologySpreadConstraints replace those of the pods of the deployment.
+	// The constraints without a label selector select the pods of the
+	// deployment.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// parseBackendAvailability returns the availability of the annotations of the
+// object declaring a backend, nil when backendAvailabilityAnnotation is not
+// set.
+func parseBackendAvailability(annotations map[string]string) (*backendAvailability, error) {
+	value := annotations[backendAvailabilityAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	availability := &backendAvailability{}
+	if err := json.Unmarshal([]byte(value), availability); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", backendAvailabilityAnnotation, err)
+	}
+
+	if availability.MaxUnavailable != nil && availability.MinAvailable != nil {
+		return nil, fmt.Errorf("invalid %s annotation: maxUnavailable and minAvailable are exclusive", backendAvailabilityAnnotation)
+	}
+	for _, constraint := range availability.TopologySpreadConstraints {
+		if constraint.TopologyKey == "" || constraint.MaxSkew < 1 {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: topology spread constraints require a topologyKey and a positive maxSkew",
+				backendAvailabilityAnnotation,
+			)
+		}
+	}
+
+	return availability, nil
+}
+
+// backendAvailability returns the availability of the backend, else that of
+// the backend defaults.
+func (r *KDexInternalHostReconciler) backendAvailability(resolvedBackend resolvedBackend) (*backendAvailability, error) {
+	availability, err := parseBackendAvailability(resolvedBackend.Annotations)
+	if availability != nil || err != nil {
+		return availability, err
+	}
+	return parseBackendAvailability(r.getMemoizedBackendDeployment().Template.Annotations)
+}
+
+// applyBackendAvailability sets the affinity and the topology spread
+// constraints of the pods of the deployment, those of the backend defaults
+// when the availability does not set them.
+func applyBackendAvailability(
+	podSpec *corev1.PodSpec,
+	defaults *corev1.PodSpec,
+	availability *backendAvailability,
+	podLabels map[string]string,
+) {
+	podSpec.Affinity = defaults.Affinity.DeepCopy()
+	podSpec.TopologySpreadConstraints = nil
+	for _, constraint := range defaults.TopologySpreadConstraints {
+		podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, *constraint.DeepCopy())
+	}
+
+	if availability == nil {
+		return
+	}
+
+	if availability.Affinity != nil {
+		podSpec.Affinity = availability.Affinity.DeepCopy()
+	}
+	if len(availability.TopologySpreadConstraints) > 0 {
+		podSpec.TopologySpreadConstraints = make([]corev1.TopologySpreadConstraint, 0, len(availability.TopologySpreadConstraints))
+		for _, constraint := range availability.TopologySpreadConstraints {
+			constraint := *constraint.DeepCopy()
+			if constraint.LabelSelector == nil {
+				constraint.LabelSelector = &metav1.LabelSelector{MatchLabels: podLabels}
+			}
+			if constraint.WhenUnsatisfiable == "" {
+				constraint.WhenUnsatisfiable = corev1.ScheduleAnyway
+			}
+			podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, constraint)
+		}
+	}
+}
+
+// createOrUpdateBackendDisruptionBudget maintains the PodDisruptionBudget of
+// the backend workload, or deletes it when the availability of the backend
+// does not bound its disruptions or the backend runs in a CronJob.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendDisruptionBudget(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	workload client.Object,
+	resolvedBackend resolvedBackend,
+	availability *backendAvailability,
+) (controllerutil.OperationResult, error) {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.GetName(),
+			Namespace: workload.GetNamespace(),
+		},
+	}
+
+	if availability == nil || (availability.MaxUnavailable == nil && availability.MinAvailable == nil) ||
+		!workloadServes(workload) {
+		if err := r.Delete(ctx, pdb); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		pdb,
+		func() error {
+			pdb.Labels = child.StampLabels(pdb.Labels, map[string]string{
+				"kdex.dev/backend": resolvedBackend.Name,
+				"kdex.dev/host":    internalHost.Name,
+				"kdex.dev/kind":    resolvedBackend.Kind,
+				"kdex.dev/type":    internal.BACKEND,
+			})
+			pdb.Spec.Selector = workloadSelector(workload).DeepCopy()
+			pdb.Spec.MaxUnavailable = availability.MaxUnavailable
+			pdb.Spec.MinAvailable = availability.MinAvailable
+
+			return ctrl.SetControllerReference(internalHost, pdb, r.Scheme)
+		},
+	)
+}
+
+// cleanupObsoleteDisruptionBudgets deletes the PodDisruptionBudgets of the
+// backends no longer required by the host.
+func (r *KDexInternalHostReconciler) cleanupObsoleteDisruptionBudgets(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backendNames map[string]bool,
+	labelSelector client.MatchingLabels,
+) error {
+	pdbList := &policyv1.PodDisruptionBudgetList{}
+	if err := r.List(ctx, pdbList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
+		return err
+	}
+
+	for _, pdb := range pdbList.Items {
+		if !backendNames[pdb.Name] {
+			if err := r.Delete(ctx, &pdb); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
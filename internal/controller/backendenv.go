@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// backendEnvFromAnnotation holds, on the object declaring a backend, the JSON
+// encoded core/v1 EnvFromSources of its container, e.g. [{"secretRef":
+// {"name": "orders-db"}}, {"configMapRef": {"name": "orders"}, "prefix":
+// "ORDERS_"}].
+const backendEnvFromAnnotation = "kdex.dev/backend-env-from"
+
+// parseBackendEnvFrom returns the env sources of the annotations of the
+// object declaring a backend, nil when backendEnvFromAnnotation is not set.
+func parseBackendEnvFrom(annotations map[string]string) ([]corev1.EnvFromSource, error) {
+	value := annotations[backendEnvFromAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	sources := []corev1.EnvFromSource{}
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", backendEnvFromAnnotation, err)
+	}
+
+	for _, source := range sources {
+		configMap := source.ConfigMapRef != nil && source.ConfigMapRef.Name != ""
+		secret := source.SecretRef != nil && source.SecretRef.Name != ""
+		if configMap == secret {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: each source requires the name of either a configMapRef or a secretRef",
+				backendEnvFromAnnotation,
+			)
+		}
+	}
+
+	return sources, nil
+}
+
+// applyBackendEnv sets the env of the backend container: that of the default
+// deployment, overridden by the env of the backend, followed by its env
+// sources. The variables and the sources removed from the backend are removed
+// from the container.
+func applyBackendEnv(
+	container *corev1.Container,
+	defaults *corev1.Container,
+	env []corev1.EnvVar,
+	envFrom []corev1.EnvFromSource,
+) {
+	container.Env = child.SetEnv(defaults.Env, env...)
+	container.EnvFrom = append(slices.Clone(defaults.EnvFrom), envFrom...)
+}
+
+// checkEnvReferences returns an error naming the first ConfigMap or Secret
+// required by the env of a backend which does not exist, rather than leaving
+// its pods failing to start.
+func (r *KDexInternalHostReconciler) checkEnvReferences(
+	ctx context.Context,
+	namespace string,
+	env []corev1.EnvVar,
+	envFrom []corev1.EnvFromSource,
+) error {
+	check := func(obj client.Object, kind string, name string, optional *bool) error {
+		if optional != nil && *optional {
+			return nil
+		}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("the env of the backend refers to the missing %s %s", kind, name)
+			}
+			return err
+		}
+		return nil
+	}
+
+	for _, source := range envFrom {
+		var err error
+		switch {
+		case source.ConfigMapRef != nil:
+			err = check(&corev1.ConfigMap{}, "ConfigMap", source.ConfigMapRef.Name, source.ConfigMapRef.Optional)
+		case source.SecretRef != nil:
+			err = check(&corev1.Secret{}, "Secret", source.SecretRef.Name, source.SecretRef.Optional)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, v := range env {
+		if v.ValueFrom == nil {
+			continue
+		}
+		var err error
+		switch {
+		case v.ValueFrom.ConfigMapKeyRef != nil:
+			err = check(&corev1.ConfigMap{}, "ConfigMap", v.ValueFrom.ConfigMapKeyRef.Name, v.ValueFrom.ConfigMapKeyRef.Optional)
+		case v.ValueFrom.SecretKeyRef != nil:
+			err = check(&corev1.Secret{}, "Secret", v.ValueFrom.SecretKeyRef.Name, v.ValueFrom.SecretKeyRef.Optional)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// canaryAbortedAttribute is the image of the last aborted canary. It is
+	// not deployed again while the function has a canary policy.
+	canaryAbortedAttribute = "canary.aborted"
+	// canaryPromotedAttribute is the image of the last promoted canary, it is
+	// deployed as the stable image.
+	canaryPromotedAttribute = "canary.promoted"
+)
+
+// canaryApplies reports whether the executable of the function is deployed
+// as a canary: the function has a canary policy, is not rolled back and runs
+// another image.
+func canaryApplies(function *kdexv1alpha1.KDexFunction, canary *deploy.Canary) bool {
+	if canary == nil || function.Status.URL == "" || function.Status.Executable == nil {
+		return false
+	}
+	if function.Annotations[rollbackImageAnnotation] != "" {
+		return false
+	}
+
+	image := function.Status.Executable.Image
+	history := imageHistory(function)
+	return len(history) > 0 && history[0] != image && function.Status.Attributes[canaryPromotedAttribute] != image
+}
+
+// canaryHandled reports whether the image is the current or the aborted
+// canary of the function, which builds must not deploy again.
+func canaryHandled(function *kdexv1alpha1.KDexFunction, image string) bool {
+	return image == function.Status.Attributes[deploy.CanaryImageAttribute] ||
+		image == function.Status.Attributes[canaryAbortedAttribute]
+}
+
+// restoreStableExecutable points the executable of the function back to the
+// image of its stable deployment.
+func restoreStableExecutable(function *kdexv1alpha1.KDexFunction) {
+	history := imageHistory(function)
+	if len(history) == 0 {
+		return
+	}
+	executable := &kdexv1alpha1.Executable{Image: history[0]}
+	if function.Status.Executable != nil {
+		executable.Scaling = function.Status.Executable.Scaling
+	}
+	function.Status.Executable = executable
+}
+
+// evaluateCanary promotes or aborts the canary of the function from the
+// requests the host proxied to it.
+func (r *KDexFunctionReconciler) evaluateCanary(hc handlerContext) (ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
+	image := hc.function.Status.Attributes[deploy.CanaryImageAttribute]
+
+	canary, err := deploy.ParseCanary(hc.function.Annotations)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionTrue,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	// Without a canary policy the image is deployed as usual.
+	if canary == nil {
+		return r.endCanary(hc, true, fmt.Sprintf("canary policy removed, promoting canary %s", image))
+	}
+
+	// The shadow traffic replayed against the canary counts with the live
+	// traffic it served.
+	var requests, failures int64
+	if r.HostHandler != nil {
+		requests, failures = r.HostHandler.CanaryStats(hc.function.Name, image)
+		shadowRequests, shadowFailures := r.HostHandler.ShadowStats(hc.function.Name, image)
+		requests += shadowRequests
+		failures += shadowFailures
+	}
+
+	promote, abort := canary.Verdict(requests, failures)
+	switch {
+	case abort:
+		return r.endCanary(hc, false, fmt.Sprintf("canary %s aborted: %d of %d requests failed", image, failures, requests))
+	case promote:
+		return r.endCanary(hc, true, fmt.Sprintf("canary %s promoted: %d of %d requests failed", image, failures, requests))
+	}
+
+	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
+	hc.function.Status.Detail = fmt.Sprintf(
+		"%v: canary %s receives %d%% of the requests, %d of %d served, %d failed",
+		kdexv1alpha1.KDexFunctionStateReady, image, canary.Weight, requests, canary.MinRequests, failures,
+	)
+
+	kdexv1alpha1.SetConditions(
+		&hc.function.Status.Conditions,
+		kdexv1alpha1.ConditionStatuses{
+			Degraded:    metav1.ConditionFalse,
+			Progressing: metav1.ConditionTrue,
+			Ready:       metav1.ConditionTrue,
+		},
+		kdexv1alpha1.ConditionReasonReconciling,
+		hc.function.Status.Detail,
+	)
+
+	log.V(2).Info(hc.function.Status.Detail)
+
+	return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+}
+
+// endCanary removes the canary of the function. A promoted canary is
+// deployed as the stable image, an aborted one leaves the stable image in
+// place.
+func (r *KDexFunctionReconciler) endCanary(hc handlerContext, promote bool, message string) (ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
+	image := hc.function.Status.Attributes[deploy.CanaryImageAttribute]
+
+	if err := r.removeCanary(hc); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if promote {
+		log.Info(message)
+
+		hc.function.Status.Attributes[canaryPromotedAttribute] = image
+		executable := &kdexv1alpha1.Executable{Image: image}
+		if hc.function.Status.Executable != nil {
+			executable.Scaling = hc.function.Status.Executable.Scaling
+		}
+		hc.function.Status.Executable = executable
+		hc.function.Status.State = kdexv1alpha1.KDexFunctionStateExecutableAvailable
+		hc.function.Status.Detail = fmt.Sprintf("%v: %s", kdexv1alpha1.KDexFunctionStateExecutableAvailable, message)
+
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			hc.function.Status.Detail,
+		)
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	log.Info(message)
+
+	hc.function.Status.Attributes[canaryAbortedAttribute] = image
+	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
+	hc.function.Status.Detail = fmt.Sprintf("%v: %s", kdexv1alpha1.KDexFunctionStateReady, message)
+
+	kdexv1alpha1.SetConditions(
+		&hc.function.Status.Conditions,
+		kdexv1alpha1.ConditionStatuses{
+			Degraded:    metav1.ConditionTrue,
+			Progressing: metav1.ConditionFalse,
+			Ready:       metav1.ConditionTrue,
+		},
+		kdexv1alpha1.ConditionReasonReconcileError,
+		hc.function.Status.Detail,
+	)
+
+	return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+}
+
+// removeCanary stops routing requests to the canary of the function and
+// deletes it.
+func (r *KDexFunctionReconciler) removeCanary(hc handlerContext) error {
+	if hc.function.Status.Attributes[deploy.CanaryImageAttribute] == "" {
+		return nil
+	}
+
+	deployer := deploy.Deployer{
+		Client:      r.Client,
+		FaaSAdaptor: hc.faasAdaptorSpec,
+		Scheme:      r.Scheme,
+	}
+	if err := deployer.RemoveCanary(hc.ctx, hc.function); err != nil {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return err
+	}
+
+	delete(hc.function.Status.Attributes, deploy.CanaryImageAttribute)
+	delete(hc.function.Status.Attributes, deploy.CanaryURLAttribute)
+	return nil
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	certificatesValidCondition = "CertificatesValid"
+
+	reasonCertificateExpired  = "CertificateExpired"
+	reasonCertificateExpiring = "CertificateExpiring"
+	reasonCertificatesValid   = "CertificatesValid"
+
+	// certificateExpiryWarning is how long before its expiry a certificate of
+	// the manager is reported as expiring. cert-manager renews certificates
+	// well before that, so a certificate this close to its expiry was not
+	// renewed or its renewal was not mounted.
+	certificateExpiryWarning = 7 * 24 * time.Hour
+)
+
+// Certificates tracks the certificates served by the manager, the webhook and
+// metrics certificates, which are reloaded by their watchers when they rotate
+// instead of when the pod restarts.
+type Certificates struct {
+	mu       sync.RWMutex
+	notAfter map[string]time.Time
+	rotated  chan event.TypedGenericEvent[string]
+}
+
+// NewCertificates returns the tracker of the certificates of the manager.
+func NewCertificates() *Certificates {
+	return &Certificates{
+		notAfter: map[string]time.Time{},
+		rotated:  make(chan event.TypedGenericEvent[string], 1),
+	}
+}
+
+// Watch returns the watcher of the certificate named name, reloading the
+// certificate and its key when their files change. The watcher must be added
+// to the manager to run.
+func (c *Certificates) Watch(name string, certPath string, keyPath string) (*certwatcher.CertWatcher, error) {
+	watcher, err := certwatcher.New(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the %s certificate: %w", name, err)
+	}
+	watcher.RegisterCallback(func(cert tls.Certificate) {
+		c.observe(name, cert)
+	})
+	return watcher, nil
+}
+
+// observe records the expiry of the certificate named name and requests a
+// reconcile of the host to report it.
+func (c *Certificates) observe(name string, cert tls.Certificate) {
+	leaf := cert.Leaf
+	if leaf == nil && len(cert.Certificate) > 0 {
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if leaf == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.notAfter[name] = leaf.NotAfter
+	c.mu.Unlock()
+
+	certificateExpiryGauge.WithLabelValues(name).Set(float64(leaf.NotAfter.Unix()))
+
+	// A pending request already reconciles the host with this certificate.
+	select {
+	case c.rotated <- event.TypedGenericEvent[string]{Object: name}:
+	default:
+	}
+}
+
+// Rotated returns the channel of the names of the certificates which were
+// loaded or reloaded.
+func (c *Certificates) Rotated() <-chan event.TypedGenericEvent[string] {
+	return c.rotated
+}
+
+// setCertificatesValid sets the CertificatesValid condition of the host,
+// false while a certificate is expiring or expired. It returns the time left
+// until the condition changes, zero when it does not. The condition is removed
+// when no certificate is tracked.
+func (c *Certificates) setCertificatesValid(internalHost *kdexv1alpha1.KDexInternalHost, now time.Time) time.Duration {
+	if c == nil {
+		meta.RemoveStatusCondition(&internalHost.Status.Conditions, certificatesValidCondition)
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.notAfter) == 0 {
+		meta.RemoveStatusCondition(&internalHost.Status.Conditions, certificatesValidCondition)
+		return 0
+	}
+
+	expired := []string{}
+	expiring := []string{}
+	next := time.Duration(0)
+	for _, name := range slices.Sorted(maps.Keys(c.notAfter)) {
+		notAfter := c.notAfter[name]
+		left := notAfter.Sub(now)
+		switch {
+		case left <= 0:
+			expired = append(expired, fmt.Sprintf("%s certificate expired at %s", name, notAfter.UTC().Format(time.RFC3339)))
+		case left <= certificateExpiryWarning:
+			expiring = append(expiring, fmt.Sprintf("%s certificate expires at %s", name, notAfter.UTC().Format(time.RFC3339)))
+			next = nextRetirement(next, left)
+		default:
+			next = nextRetirement(next, left-certificateExpiryWarning)
+		}
+	}
+
+	condition := metav1.Condition{
+		Message: fmt.Sprintf("%d certificates valid", len(c.notAfter)),
+		Reason:  reasonCertificatesValid,
+		Status:  metav1.ConditionTrue,
+		Type:    certificatesValidCondition,
+	}
+	switch {
+	case len(expired) > 0:
+		condition.Message = strings.Join(append(expired, expiring...), "; ")
+		condition.Reason = reasonCertificateExpired
+		condition.Status = metav1.ConditionFalse
+	case len(expiring) > 0:
+		condition.Message = strings.Join(expiring, "; ")
+		condition.Reason = reasonCertificateExpiring
+		condition.Status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(&internalHost.Status.Conditions, condition)
+
+	return next
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	kjob "github.com/kdex-tech/host-manager/internal/job"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// handleContractTest holds a deployed function back from Ready until its
+// image passed the contract test of deploy.ContractTestAnnotation. It
+// reports whether the reconcile should return with the result.
+func (r *KDexFunctionReconciler) handleContractTest(hc handlerContext, deployer deploy.Deployer) (bool, ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
+	fail := func(err error) (bool, ctrl.Result, error) {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return true, ctrl.Result{}, err
+	}
+
+	test, err := deploy.ParseContractTest(hc.function.Annotations)
+	if err != nil {
+		return fail(err)
+	}
+
+	image := hc.function.Status.Executable.Image
+	if test == nil || hc.function.Status.Attributes[deploy.ContractTestAttribute] == image {
+		return false, ctrl.Result{}, nil
+	}
+
+	job, err := deployer.ContractTest(hc.ctx, hc.function, test)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := r.cleanupJobs(hc.ctx, hc.function, deploy.ContractTestContainer); err != nil {
+		return true, ctrl.Result{}, err
+	}
+
+	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+		message := fmt.Sprintf("Waiting on contract test job %s/%s to complete", job.Namespace, job.Name)
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			message,
+		)
+
+		log.V(2).Info(message)
+
+		return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	if job.Status.Failed > 0 {
+		// The job is kept, the image is not tested again until it changes.
+		report := ""
+		if pod, err := kjob.GetPodForJob(hc.ctx, r.Client, job); err == nil {
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				if containerStatus.Name == deploy.ContractTestContainer && containerStatus.State.Terminated != nil {
+					report = strings.TrimSpace(containerStatus.State.Terminated.Message)
+					break
+				}
+			}
+		}
+
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf("Image %s violates the contract of the function (%s job %s/%s): %s", image, test.Tool, job.Namespace, job.Name, report),
+		)
+
+		log.Info("contract test failed", "image", image, "job", job.Name)
+
+		return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	log.V(1).Info("contract test passed", "image", image, "job", job.Name)
+
+	hc.function.Status.Attributes[deploy.ContractTestAttribute] = image
+
+	return false, ctrl.Result{}, nil
+}
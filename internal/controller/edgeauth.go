@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/host"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// edgeAuthAnnotation lists, on a host, the comma separated ingress paths
+	// of its backends whose requests are authorized at the edge, by the
+	// ingress controller or the gateway asking the host at host.AuthzPath,
+	// before they reach the backends, or "*" for every backend.
+	edgeAuthAnnotation = "kdex.dev/edge-auth"
+
+	edgeAuthAll = "*"
+)
+
+// edgeAuth is the set of the ingress paths of the backends authorized at the
+// edge.
+type edgeAuth map[string]bool
+
+// parseEdgeAuth returns the ingress paths of edgeAuthAnnotation, nil when it
+// is not set.
+func parseEdgeAuth(annotations map[string]string) (edgeAuth, error) {
+	value := annotations[edgeAuthAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	paths := edgeAuth{}
+	for path := range strings.SplitSeq(value, ",") {
+		path = strings.TrimSpace(path)
+		if path != edgeAuthAll && !strings.HasPrefix(path, "/-/") {
+			return nil, fmt.Errorf("invalid %s annotation %q, expected * or the ingress paths of backends, e.g. /-/orders", edgeAuthAnnotation, value)
+		}
+		paths[path] = true
+	}
+	return paths, nil
+}
+
+// protects reports whether the requests of the backend at the ingress path
+// are authorized at the edge.
+func (e edgeAuth) protects(ingressPath string) bool {
+	return e[edgeAuthAll] || e[ingressPath]
+}
+
+// edgeAuthURL returns the URL of host.AuthzPath on the service of the host.
+func (r *KDexInternalHostReconciler) edgeAuthURL(internalHost *kdexv1alpha1.KDexInternalHost) string {
+	return fmt.Sprintf("http://%s.%s.svc.cluster.local:%d%s", r.ServiceName, internalHost.Namespace, r.Port, host.AuthzPath)
+}
+
+// edgeAuthFilter returns the HTTP ExternalAuth filter of the HTTPRoute rules
+// of the backends authorized at the edge.
+func (r *KDexInternalHostReconciler) edgeAuthFilter() gatewayv1.HTTPRouteFilter {
+	return gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterExternalAuth,
+		ExternalAuth: &gatewayv1.HTTPExternalAuthFilter{
+			ExternalAuthProtocol: gatewayv1.HTTPRouteExternalAuthHTTPProtocol,
+			BackendRef: gatewayv1.BackendObjectReference{
+				Name: gatewayv1.ObjectName(r.ServiceName),
+				Port: new(gatewayv1.PortNumber(r.Port)),
+			},
+			HTTPAuthConfig: &gatewayv1.HTTPAuthConfig{
+				Path:                   host.AuthzPath,
+				AllowedRequestHeaders:  []string{"Cookie"},
+				AllowedResponseHeaders: host.AuthzIdentityHeaders,
+			},
+		},
+	}
+}
+
+// createOrUpdateEdgeAuthIngress maintains the Ingress routing the paths of the
+// backends authorized at the edge, next to the Ingress of the host since the
+// auth_request of nginx and the forwardAuth middleware of Traefik apply to
+// every path of an Ingress. It is deleted when no backend is authorized at the
+// edge.
+func (r *KDexInternalHostReconciler) createOrUpdateEdgeAuthIngress(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	hostIngress *networkingv1.Ingress,
+	paths []networkingv1.HTTPIngressPath,
+	profile string,
+	options ingressOptions,
+) (controllerutil.OperationResult, error) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      internalHost.Name + "-edge-auth",
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	middleware := &unstructured.Unstructured{}
+	middleware.SetGroupVersionKind(internal.TraefikMiddlewareGVK)
+	middleware.SetNamespace(internalHost.Namespace)
+	middleware.SetName(ingress.Name)
+
+	if len(paths) == 0 || profile != "traefik" {
+		if err := r.Delete(ctx, middleware); err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+	if len(paths) == 0 {
+		if err := r.Delete(ctx, ingress); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
+	routing, err := parseRoutingAnnotations(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	var edgeAnnotations map[string]string
+	switch profile {
+	case "nginx":
+		edgeAnnotations = map[string]string{
+			"nginx.ingress.kubernetes.io/auth-url":              r.edgeAuthURL(internalHost),
+			"nginx.ingress.kubernetes.io/auth-response-headers": strings.Join(host.AuthzIdentityHeaders, ","),
+		}
+	case "traefik":
+		if _, err := r.createOrUpdateForwardAuthMiddleware(ctx, internalHost, middleware); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		edgeAnnotations = map[string]string{
+			"traefik.ingress.kubernetes.io/router.middlewares": fmt.Sprintf("%s-%s@kubernetescrd", middleware.GetNamespace(), middleware.GetName()),
+		}
+	default:
+		return controllerutil.OperationResultNone, fmt.Errorf(
+			"the %s annotation requires the nginx or traefik ingress profile, or the HTTPRoute routing strategy, the ingress profile is %q",
+			edgeAuthAnnotation, profile,
+		)
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		ingress,
+		func() error {
+			if ingress.CreationTimestamp.IsZero() {
+				ingress.Annotations = make(map[string]string)
+				maps.Copy(ingress.Annotations, internalHost.Annotations)
+				ingress.Labels = make(map[string]string)
+				maps.Copy(ingress.Labels, internalHost.Labels)
+
+				ingress.Labels["kdex.dev/ingress"] = ingress.Name
+			}
+
+			ingress.Spec.IngressClassName = hostIngress.Spec.IngressClassName
+			ingress.Spec.TLS = hostIngress.Spec.TLS
+			ingress.Spec.Rules = make([]networkingv1.IngressRule, 0, len(internalHost.Spec.Routing.Domains))
+			for _, domain := range internalHost.Spec.Routing.Domains {
+				ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+					Host: domain,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+					},
+				})
+			}
+
+			applyIngressProfile(ingress, internalHost, profile, options)
+			applyRoutingAnnotations(ingress, routing)
+			maps.Copy(ingress.Annotations, edgeAnnotations)
+
+			return ctrl.SetControllerReference(internalHost, ingress, r.Scheme)
+		},
+	)
+}
+
+// createOrUpdateForwardAuthMiddleware maintains the forwardAuth Middleware of
+// Traefik asking the host at host.AuthzPath.
+func (r *KDexInternalHostReconciler) createOrUpdateForwardAuthMiddleware(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	middleware *unstructured.Unstructured,
+) (controllerutil.OperationResult, error) {
+	return ctrl.CreateOrUpdate(ctx, r.Client, middleware, func() error {
+		labels := middleware.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["kdex.dev/host"] = internalHost.Name
+		middleware.SetLabels(labels)
+
+		responseHeaders := make([]any, 0, len(host.AuthzIdentityHeaders))
+		for _, header := range host.AuthzIdentityHeaders {
+			responseHeaders = append(responseHeaders, header)
+		}
+		middleware.Object["spec"] = map[string]any{
+			"forwardAuth": map[string]any{
+				"address":             r.edgeAuthURL(internalHost),
+				"authResponseHeaders": responseHeaders,
+			},
+		}
+
+		return ctrl.SetControllerReference(internalHost, middleware, r.Scheme)
+	})
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const envDriftAttribute = "env.drift"
+
+// auditChildEnv reports the children of the host whose backend container env
+// diverges from what the host propagates. The workloads just written are
+// audited as written rather than as cached.
+func (r *KDexInternalHostReconciler) auditChildEnv(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	written []client.Object,
+) ([]string, error) {
+	var deployments appsv1.DeploymentList
+	if err := r.List(
+		ctx,
+		&deployments,
+		client.InNamespace(internalHost.Namespace),
+		client.MatchingLabels{"kdex.dev/host": internalHost.Name},
+	); err != nil {
+		return nil, err
+	}
+	var statefulSets appsv1.StatefulSetList
+	if err := r.List(
+		ctx,
+		&statefulSets,
+		client.InNamespace(internalHost.Namespace),
+		client.MatchingLabels{"kdex.dev/host": internalHost.Name},
+	); err != nil {
+		return nil, err
+	}
+
+	var cronJobs batchv1.CronJobList
+	if err := r.List(
+		ctx,
+		&cronJobs,
+		client.InNamespace(internalHost.Namespace),
+		client.MatchingLabels{"kdex.dev/host": internalHost.Name},
+	); err != nil {
+		return nil, err
+	}
+
+	children := make([]client.Object, 0, len(deployments.Items)+len(statefulSets.Items)+len(cronJobs.Items))
+	for i := range deployments.Items {
+		children = append(children, &deployments.Items[i])
+	}
+	for i := range statefulSets.Items {
+		children = append(children, &statefulSets.Items[i])
+	}
+	for i := range cronJobs.Items {
+		children = append(children, &cronJobs.Items[i])
+	}
+
+	expected := child.CORSDomains(internalHost.Spec.Routing.Domains)
+
+	drift := []string{}
+	for _, workload := range children {
+		kind := workloadKind(workload)
+		if idx := slices.IndexFunc(written, func(w client.Object) bool {
+			return w.GetName() == workload.GetName() && workloadKind(w) == kind
+		}); idx != -1 {
+			workload = written[idx]
+		}
+
+		for _, container := range workloadPodTemplate(workload).Spec.Containers {
+			if container.Name != "backend" {
+				continue
+			}
+			if names := child.EnvDrift(container.Env, expected); len(names) > 0 {
+				drift = append(drift, fmt.Sprintf("%s/%s(%s)", strings.ToLower(kind), workload.GetName(), strings.Join(names, ",")))
+			}
+		}
+	}
+
+	slices.Sort(drift)
+	return drift, nil
+}
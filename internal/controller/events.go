@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"cmp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// The reasons of the events recorded on the state transitions of the
+// resources, shown by kubectl describe.
+const (
+	EventReasonBackendDeleted  = "BackendDeleted"
+	EventReasonBackendObsolete = "BackendObsolete"
+	EventReasonBackendUpdated  = "BackendUpdated"
+	EventReasonBuildFailed     = "BuildFailed"
+	EventReasonDeployFailed    = "DeployFailed"
+	EventReasonImageBuilt      = "ImageBuilt"
+	EventReasonIngressUpdated  = "IngressUpdated"
+	EventReasonKeyRotated      = "KeyRotated"
+	EventReasonPathConflict    = "PathConflict"
+	EventReasonReady           = "Ready"
+	EventReasonReconcileFailed = "ReconcileFailed"
+)
+
+// readyCondition returns a copy of the Ready condition of the conditions, the
+// zero condition when it is not set.
+func readyCondition(conditions []metav1.Condition) metav1.Condition {
+	if c := meta.FindStatusCondition(conditions, string(kdexv1alpha1.ConditionTypeReady)); c != nil {
+		return *c
+	}
+	return metav1.Condition{}
+}
+
+// recordReadyTransition records an event when the resource became ready, or
+// when it failed with a message other than that of its previous failure, so
+// that a failure retried by every reconcile is recorded once. Failures are
+// recorded with failureReason, EventReasonReconcileFailed when empty.
+func recordReadyTransition(recorder events.EventRecorder, obj runtime.Object, previous metav1.Condition, conditions []metav1.Condition, failureReason string) {
+	current := readyCondition(conditions)
+
+	switch {
+	case current.Status == metav1.ConditionTrue && previous.Status != metav1.ConditionTrue:
+		recorder.Eventf(obj, nil, corev1.EventTypeNormal, EventReasonReady, "Reconcile", "%s", current.Message)
+	case isNewFailure(previous, conditions):
+		recorder.Eventf(obj, nil, corev1.EventTypeWarning, cmp.Or(failureReason, EventReasonReconcileFailed), "Reconcile", "%s", current.Message)
+	}
+}
+
+// isNewFailure reports whether the conditions hold a failure with a message
+// other than that of the previous Ready condition.
+func isNewFailure(previous metav1.Condition, conditions []metav1.Condition) bool {
+	current := readyCondition(conditions)
+	return current.Reason == string(kdexv1alpha1.ConditionReasonReconcileError) &&
+		(previous.Reason != current.Reason || previous.Message != current.Message)
+}
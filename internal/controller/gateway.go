@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// gatewayAnnotation sets, on a host routed by an HTTPRoute, the shared
+	// Gateway its HTTPRoute attaches to, as "[namespace/]name". The parentRefs
+	// of the default HTTPRoute of the configuration are used otherwise.
+	gatewayAnnotation = "kdex.dev/gateway"
+	// gatewayClassAnnotation sets, on a host routed by an HTTPRoute, the
+	// GatewayClass of a Gateway owned by the host, with a listener for each of
+	// its domains, which its HTTPRoute attaches to.
+	gatewayClassAnnotation = "kdex.dev/gateway-class"
+
+	// gatewayAcceptedCondition and gatewayProgrammedCondition mirror the
+	// Accepted and Programmed conditions of the Gateways the HTTPRoute of the
+	// host attaches to.
+	gatewayAcceptedCondition   = "GatewayAccepted"
+	gatewayProgrammedCondition = "GatewayProgrammed"
+
+	reasonGatewayNotFound = "GatewayNotFound"
+	reasonGatewayPending  = "Pending"
+)
+
+// gatewayOptions are the options of the Gateway the HTTPRoute of a host
+// attaches to: a Gateway of className owned by the host, or the shared
+// Gateway parent.
+type gatewayOptions struct {
+	className string
+	parent    *gatewayv1.ParentReference
+}
+
+func (o gatewayOptions) owned() bool {
+	return o.className != ""
+}
+
+// parseGatewayOptions returns the gateway options set in the annotations of a
+// host.
+func parseGatewayOptions(annotations map[string]string) (gatewayOptions, error) {
+	options := gatewayOptions{className: annotations[gatewayClassAnnotation]}
+
+	value := annotations[gatewayAnnotation]
+	if value == "" {
+		return options, nil
+	}
+	if options.owned() {
+		return options, fmt.Errorf("invalid %s annotation %q, the host owns its Gateway of the %s class", gatewayAnnotation, value, options.className)
+	}
+
+	namespace, name, found := strings.Cut(value, "/")
+	if !found {
+		namespace, name = "", value
+	}
+	if name == "" || strings.Contains(name, "/") || (found && namespace == "") {
+		return options, fmt.Errorf("invalid %s annotation %q, expected [namespace/]name", gatewayAnnotation, value)
+	}
+
+	options.parent = &gatewayv1.ParentReference{Name: gatewayv1.ObjectName(name)}
+	if namespace != "" {
+		options.parent.Namespace = new(gatewayv1.Namespace(namespace))
+	}
+	return options, nil
+}
+
+// servicePort returns the port of the service port named name, fallback when
+// there is none.
+func servicePort(ports []corev1.ServicePort, name string, fallback int32) int32 {
+	for _, p := range ports {
+		if p.Name == name {
+			return p.Port
+		}
+	}
+	return fallback
+}
+
+// gatewayListeners returns an HTTP listener for each domain of the host and,
+// when it is served over https with a TLS secret, an HTTPS listener
+// terminating TLS with the secret.
+func gatewayListeners(internalHost *kdexv1alpha1.KDexInternalHost) []gatewayv1.Listener {
+	tlsSecret := ""
+	if internalHost.Spec.Routing.Scheme == "https" {
+		tlsSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeTLS })
+		if len(tlsSecrets) > 0 {
+			tlsSecret = tlsSecrets[0].Name
+		}
+	}
+
+	listeners := []gatewayv1.Listener{}
+	for i, domain := range internalHost.Spec.Routing.Domains {
+		hostname := gatewayv1.Hostname(domain)
+		listeners = append(listeners, gatewayv1.Listener{
+			Hostname: &hostname,
+			Name:     gatewayv1.SectionName(fmt.Sprintf("http-%d", i)),
+			Port:     80,
+			Protocol: gatewayv1.HTTPProtocolType,
+		})
+		if tlsSecret == "" {
+			continue
+		}
+		listeners = append(listeners, gatewayv1.Listener{
+			Hostname: &hostname,
+			Name:     gatewayv1.SectionName(fmt.Sprintf("https-%d", i)),
+			Port:     443,
+			Protocol: gatewayv1.HTTPSProtocolType,
+			TLS: &gatewayv1.ListenerTLSConfig{
+				CertificateRefs: []gatewayv1.SecretObjectReference{{Name: gatewayv1.ObjectName(tlsSecret)}},
+				Mode:            new(gatewayv1.TLSModeTerminate),
+			},
+		})
+	}
+	return listeners
+}
+
+// createOrUpdateGateway writes the Gateway owned by the host.
+func (r *KDexInternalHostReconciler) createOrUpdateGateway(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	options gatewayOptions,
+) (controllerutil.OperationResult, error) {
+	gateway := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      internalHost.Name,
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		gateway,
+		func() error {
+			if gateway.CreationTimestamp.IsZero() {
+				gateway.Annotations = make(map[string]string)
+				maps.Copy(gateway.Annotations, internalHost.Annotations)
+				gateway.Labels = make(map[string]string)
+				maps.Copy(gateway.Labels, internalHost.Labels)
+
+				gateway.Labels["kdex.dev/gateway"] = gateway.Name
+			}
+
+			gateway.Spec.GatewayClassName = gatewayv1.ObjectName(options.className)
+			gateway.Spec.Listeners = gatewayListeners(internalHost)
+
+			return ctrl.SetControllerReference(internalHost, gateway, r.Scheme)
+		},
+	)
+}
+
+// deleteOwnedGateway deletes the Gateway the host owned before attaching to a
+// shared Gateway.
+func (r *KDexInternalHostReconciler) deleteOwnedGateway(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost) error {
+	gateway := &gatewayv1.Gateway{}
+	if err := r.Get(ctx, types.NamespacedName{Name: internalHost.Name, Namespace: internalHost.Namespace}, gateway); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(gateway, internalHost) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, gateway))
+}
+
+// httpRouteParents returns the Gateways the HTTPRoute of the host attaches to.
+func (r *KDexInternalHostReconciler) httpRouteParents(internalHost *kdexv1alpha1.KDexInternalHost, options gatewayOptions) ([]gatewayv1.ParentReference, error) {
+	switch {
+	case options.owned():
+		return []gatewayv1.ParentReference{{Name: gatewayv1.ObjectName(internalHost.Name)}}, nil
+	case options.parent != nil:
+		return []gatewayv1.ParentReference{*options.parent}, nil
+	case len(r.Configuration.BackendDefault.HttpRoute.ParentRefs) > 0:
+		return r.Configuration.BackendDefault.HttpRoute.ParentRefs, nil
+	}
+	return nil, fmt.Errorf("no Gateway to attach the HTTPRoute of host %s to, set the %s or the %s annotation", internalHost.Name, gatewayAnnotation, gatewayClassAnnotation)
+}
+
+// setGatewayConditions mirrors the Accepted and Programmed conditions of the
+// gateways in the status of the host. A condition is True when it is True on
+// every gateway.
+func setGatewayConditions(internalHost *kdexv1alpha1.KDexInternalHost, gateways []*gatewayv1.Gateway, missing []string) {
+	for conditionType, gatewayConditionType := range map[string]gatewayv1.GatewayConditionType{
+		gatewayAcceptedCondition:   gatewayv1.GatewayConditionAccepted,
+		gatewayProgrammedCondition: gatewayv1.GatewayConditionProgrammed,
+	} {
+		condition := metav1.Condition{
+			Message: fmt.Sprintf("%d Gateways %s", len(gateways), strings.ToLower(string(gatewayConditionType))),
+			Reason:  string(gatewayConditionType),
+			Status:  metav1.ConditionTrue,
+			Type:    conditionType,
+		}
+
+		if len(missing) > 0 {
+			condition.Message = fmt.Sprintf("Gateway %s not found", strings.Join(missing, ","))
+			condition.Reason = reasonGatewayNotFound
+			condition.Status = metav1.ConditionFalse
+		}
+
+		for _, gateway := range gateways {
+			if condition.Status != metav1.ConditionTrue {
+				break
+			}
+			current := meta.FindStatusCondition(gateway.Status.Conditions, string(gatewayConditionType))
+			switch {
+			case current == nil || current.ObservedGeneration < gateway.Generation:
+				condition.Message = fmt.Sprintf("Gateway %s/%s is not %s yet", gateway.Namespace, gateway.Name, strings.ToLower(string(gatewayConditionType)))
+				condition.Reason = reasonGatewayPending
+				condition.Status = metav1.ConditionUnknown
+			case current.Status != metav1.ConditionTrue:
+				condition.Message = fmt.Sprintf("Gateway %s/%s: %s", gateway.Namespace, gateway.Name, current.Message)
+				condition.Reason = current.Reason
+				condition.Status = current.Status
+			}
+		}
+
+		meta.SetStatusCondition(&internalHost.Status.Conditions, condition)
+	}
+}
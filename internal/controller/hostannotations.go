@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/host"
+	"github.com/kdex-tech/host-manager/internal/mime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// hostAnnotations is the configuration of a host held by its annotations.
+type hostAnnotations struct {
+	a11yMode                   string
+	archive                    *host.Archive
+	audit                      *auth.Audit
+	backendGracePeriod         time.Duration
+	brands                     map[string]*host.Brand
+	budgetMode                 string
+	changePassword             string
+	cookieDomain               string
+	faultInjection             bool
+	federation                 *host.Federation
+	impersonation              *auth.Impersonation
+	integrityMode              string
+	jwtKeyRotation             *jwtKeyRotation
+	linkCheckInterval          time.Duration
+	mediaTypes                 *mime.Registry
+	middlewares                []host.MiddlewareDeclaration
+	networkPolicy              *backendNetworkPolicy
+	personalization            *host.Personalization
+	profiling                  bool
+	securityTxt                *host.SecurityTxt
+	serviceAccountEntitlements map[string][]string
+	slos                       *host.SLOs
+	themeExperiment            *host.ThemeExperiment
+	trustedIssuers             []string
+	trustedProxies             []netip.Prefix
+}
+
+// parseHostAnnotations returns the configuration of the annotations of the
+// host, whose service account secrets are resolved, or the error of the first
+// invalid annotation.
+func parseHostAnnotations(internalHost *kdexv1alpha1.KDexInternalHost) (*hostAnnotations, error) {
+	annotations := internalHost.Annotations
+	domains := internalHost.Spec.Routing.Domains
+
+	var (
+		config hostAnnotations
+		err    error
+	)
+	if config.a11yMode, err = host.ParseA11yAudit(annotations); err != nil {
+		return nil, err
+	}
+	if config.archive, err = host.ParseArchive(annotations, internalHost.Spec.ServiceAccountSecrets); err != nil {
+		return nil, err
+	}
+	if config.audit, err = auth.ParseAudit(annotations); err != nil {
+		return nil, err
+	}
+	if config.backendGracePeriod, err = parseBackendGracePeriod(annotations); err != nil {
+		return nil, err
+	}
+	if config.brands, err = host.ParseBrands(annotations, domains); err != nil {
+		return nil, err
+	}
+	if config.budgetMode, err = host.ParsePerformanceBudgetMode(annotations); err != nil {
+		return nil, err
+	}
+	if config.changePassword, err = host.ParseChangePassword(annotations); err != nil {
+		return nil, err
+	}
+	if config.cookieDomain, err = auth.ParseCookieDomain(annotations, domains); err != nil {
+		return nil, err
+	}
+	if config.faultInjection, err = host.ParseFaultInjection(annotations); err != nil {
+		return nil, err
+	}
+	if config.federation, err = host.ParseFederation(annotations, internalHost.Spec.ServiceAccountSecrets); err != nil {
+		return nil, err
+	}
+	if config.impersonation, err = auth.ParseImpersonation(annotations); err != nil {
+		return nil, err
+	}
+	if config.integrityMode, err = host.ParseIntegrity(annotations); err != nil {
+		return nil, err
+	}
+	if config.jwtKeyRotation, err = parseJWTKeyRotation(annotations); err != nil {
+		return nil, err
+	}
+	if config.linkCheckInterval, err = host.ParseLinkCheck(annotations); err != nil {
+		return nil, err
+	}
+	if config.mediaTypes, err = host.ParseMediaTypes(annotations); err != nil {
+		return nil, err
+	}
+	if config.middlewares, err = host.ParseMiddlewares(annotations); err != nil {
+		return nil, err
+	}
+	if config.networkPolicy, err = parseNetworkPolicy(annotations); err != nil {
+		return nil, err
+	}
+	if config.personalization, err = host.ParsePersonalization(annotations); err != nil {
+		return nil, err
+	}
+	if config.profiling, err = host.ParseProfiling(annotations); err != nil {
+		return nil, err
+	}
+	if config.securityTxt, err = host.ParseSecurityTxt(annotations); err != nil {
+		return nil, err
+	}
+	if config.serviceAccountEntitlements, err = auth.ParseServiceAccountEntitlements(annotations); err != nil {
+		return nil, err
+	}
+	if config.slos, err = host.ParseSLOs(annotations); err != nil {
+		return nil, err
+	}
+	if config.themeExperiment, err = host.ParseThemeExperiment(annotations); err != nil {
+		return nil, err
+	}
+	if config.trustedIssuers, err = auth.ParseTrustedIssuers(annotations); err != nil {
+		return nil, err
+	}
+	if config.trustedProxies, err = auth.ParseTrustedProxies(annotations); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// ingressProfileAnnotation selects, on a host, the profile of the
+	// annotations of its Ingress, one of the ingressProfiles or "none". The
+	// profile is otherwise detected from the controller of its IngressClass.
+	ingressProfileAnnotation = "kdex.dev/ingress-profile"
+	// ingressMaxBodySizeAnnotation sets, on a host, the largest request body
+	// its Ingress accepts, e.g. "16Mi".
+	ingressMaxBodySizeAnnotation = "kdex.dev/ingress-max-body-size"
+	// ingressTimeoutAnnotation sets, on a host, how long its Ingress waits
+	// for the responses of the host, e.g. "2m".
+	ingressTimeoutAnnotation = "kdex.dev/ingress-timeout"
+
+	ingressProfileNone = "none"
+
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// ingressOptions are the options of the Ingress of a host which each ingress
+// controller sets with its own annotations.
+type ingressOptions struct {
+	// https redirects the plain HTTP requests to HTTPS.
+	https       bool
+	maxBodySize int64
+	timeout     time.Duration
+}
+
+// ingressProfile translates the ingressOptions into the annotations of an
+// ingress controller.
+type ingressProfile struct {
+	// controllers are the spec.controller of the IngressClasses of the
+	// ingress controller.
+	controllers []string
+	// keys are all the annotations the profile may set.
+	keys        []string
+	annotations func(options ingressOptions) map[string]string
+}
+
+var ingressProfiles = map[string]ingressProfile{
+	"alb": {
+		controllers: []string{"ingress.k8s.aws/alb"},
+		keys: []string{
+			"alb.ingress.kubernetes.io/listen-ports",
+			"alb.ingress.kubernetes.io/load-balancer-attributes",
+			"alb.ingress.kubernetes.io/ssl-redirect",
+			"alb.ingress.kubernetes.io/target-type",
+		},
+		annotations: func(options ingressOptions) map[string]string {
+			// The services of the hosts are ClusterIPs, reachable by pod IP
+			// only.
+			annotations := map[string]string{"alb.ingress.kubernetes.io/target-type": "ip"}
+			if options.https {
+				annotations["alb.ingress.kubernetes.io/listen-ports"] = `[{"HTTP": 80}, {"HTTPS": 443}]`
+				annotations["alb.ingress.kubernetes.io/ssl-redirect"] = "443"
+			}
+			if options.timeout > 0 {
+				annotations["alb.ingress.kubernetes.io/load-balancer-attributes"] = fmt.Sprintf("idle_timeout.timeout_seconds=%d", seconds(options.timeout))
+			}
+			return annotations
+		},
+	},
+	"haproxy": {
+		controllers: []string{"haproxy.org/ingress-controller", "haproxy.org/ingress-controller/haproxy"},
+		keys: []string{
+			"haproxy.org/ssl-redirect",
+			"haproxy.org/timeout-server",
+		},
+		annotations: func(options ingressOptions) map[string]string {
+			annotations := map[string]string{}
+			if options.https {
+				annotations["haproxy.org/ssl-redirect"] = "true"
+			}
+			if options.timeout > 0 {
+				annotations["haproxy.org/timeout-server"] = fmt.Sprintf("%ds", seconds(options.timeout))
+			}
+			return annotations
+		},
+	},
+	"nginx": {
+		controllers: []string{"k8s.io/ingress-nginx"},
+		keys: []string{
+			"nginx.ingress.kubernetes.io/proxy-body-size",
+			"nginx.ingress.kubernetes.io/proxy-read-timeout",
+			"nginx.ingress.kubernetes.io/proxy-send-timeout",
+			"nginx.ingress.kubernetes.io/ssl-redirect",
+		},
+		annotations: func(options ingressOptions) map[string]string {
+			annotations := map[string]string{}
+			if options.https {
+				annotations["nginx.ingress.kubernetes.io/ssl-redirect"] = "true"
+			}
+			if options.maxBodySize > 0 {
+				annotations["nginx.ingress.kubernetes.io/proxy-body-size"] = strconv.FormatInt(options.maxBodySize, 10)
+			}
+			if options.timeout > 0 {
+				annotations["nginx.ingress.kubernetes.io/proxy-read-timeout"] = strconv.FormatInt(seconds(options.timeout), 10)
+				annotations["nginx.ingress.kubernetes.io/proxy-send-timeout"] = strconv.FormatInt(seconds(options.timeout), 10)
+			}
+			return annotations
+		},
+	},
+	"traefik": {
+		controllers: []string{"traefik.io/ingress-controller"},
+		keys: []string{
+			"traefik.ingress.kubernetes.io/router.entrypoints",
+			"traefik.ingress.kubernetes.io/router.tls",
+		},
+		annotations: func(options ingressOptions) map[string]string {
+			annotations := map[string]string{}
+			if options.https {
+				annotations["traefik.ingress.kubernetes.io/router.entrypoints"] = "websecure"
+				annotations["traefik.ingress.kubernetes.io/router.tls"] = "true"
+			}
+			return annotations
+		},
+	},
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// parseIngressProfile returns the ingress profile and the ingress options set
+// in the annotations of a host. The profile is empty when it is to be
+// detected.
+func parseIngressProfile(annotations map[string]string) (string, ingressOptions, error) {
+	options := ingressOptions{}
+
+	profile := annotations[ingressProfileAnnotation]
+	if _, ok := ingressProfiles[profile]; !ok && profile != "" && profile != ingressProfileNone {
+		return "", options, fmt.Errorf("invalid %s annotation %q, expected alb, haproxy, nginx, traefik or none", ingressProfileAnnotation, profile)
+	}
+
+	if value := annotations[ingressMaxBodySizeAnnotation]; value != "" {
+		size, err := resource.ParseQuantity(value)
+		if err != nil || size.Sign() <= 0 {
+			return "", options, fmt.Errorf("invalid %s annotation %q, expected a positive quantity, e.g. 16Mi", ingressMaxBodySizeAnnotation, value)
+		}
+		options.maxBodySize = size.Value()
+	}
+
+	if value := annotations[ingressTimeoutAnnotation]; value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return "", options, fmt.Errorf("invalid %s annotation %q, expected a positive duration, e.g. 2m", ingressTimeoutAnnotation, value)
+		}
+		options.timeout = timeout
+	}
+
+	return profile, options, nil
+}
+
+// detectIngressProfile returns the profile of the controller of the
+// IngressClass, the default IngressClass when className is nil. It is empty
+// when the controller has no profile.
+func (r *KDexInternalHostReconciler) detectIngressProfile(ctx context.Context, className *string) (string, error) {
+	var ingressClass *networkingv1.IngressClass
+	if className != nil && *className != "" {
+		ingressClass = &networkingv1.IngressClass{}
+		if err := r.Get(ctx, types.NamespacedName{Name: *className}, ingressClass); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+	} else {
+		var list networkingv1.IngressClassList
+		if err := r.List(ctx, &list); err != nil {
+			return "", err
+		}
+		for i := range list.Items {
+			if list.Items[i].Annotations[defaultIngressClassAnnotation] == "true" {
+				ingressClass = &list.Items[i]
+				break
+			}
+		}
+		if ingressClass == nil {
+			return "", nil
+		}
+	}
+
+	for name, profile := range ingressProfiles {
+		if slices.Contains(profile.controllers, ingressClass.Spec.Controller) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// applyIngressProfile sets the annotations of the profile on the ingress and
+// drops those of the other profiles. The annotations set on the host are
+// never changed.
+func applyIngressProfile(ingress *networkingv1.Ingress, internalHost *kdexv1alpha1.KDexInternalHost, profile string, options ingressOptions) {
+	if ingress.Annotations == nil {
+		ingress.Annotations = map[string]string{}
+	}
+
+	for _, p := range ingressProfiles {
+		for _, key := range p.keys {
+			if _, ok := internalHost.Annotations[key]; !ok {
+				delete(ingress.Annotations, key)
+			}
+		}
+	}
+
+	p, ok := ingressProfiles[profile]
+	if !ok {
+		return
+	}
+	for key, value := range p.annotations(options) {
+		if _, ok := internalHost.Annotations[key]; !ok {
+			ingress.Annotations[key] = value
+		}
+	}
+}
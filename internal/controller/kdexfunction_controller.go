@@ -31,12 +31,16 @@ import (
 	"github.com/kdex-tech/host-manager/internal/generate"
 	"github.com/kdex-tech/host-manager/internal/host"
 	kjob "github.com/kdex-tech/host-manager/internal/job"
+	"go.opentelemetry.io/otel/attribute"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	"kdex.dev/crds/configuration"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -51,25 +55,36 @@ type KDexFunctionReconciler struct {
 	client.Client
 	Configuration configuration.NexusConfiguration
 	HostHandler   *host.HostHandler
+	Recorder      events.EventRecorder
 	RequeueDelay  time.Duration
 	Scheme        *runtime.Scheme
 }
 
 type handlerContext struct {
-	ctx              context.Context
-	faasAdaptorSpec  kdexv1alpha1.KDexFaaSAdaptorSpec
-	function         *kdexv1alpha1.KDexFunction
-	host             kdexv1alpha1.KDexInternalHost
-	imagePullSecrets []corev1.LocalObjectReference
-	req              ctrl.Request
+	buildEngine        build.Engine
+	buildExecutorImage string
+	ctx                context.Context
+	deployPackageType  deploy.PackageType
+	failureReason      *string
+	faasAdaptorSpec    kdexv1alpha1.KDexFaaSAdaptorSpec
+	function           *kdexv1alpha1.KDexFunction
+	host               kdexv1alpha1.KDexInternalHost
+	imagePullSecrets   []corev1.LocalObjectReference
+	req                ctrl.Request
 }
 
 //nolint:gocyclo
 func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexFunction", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	var function kdexv1alpha1.KDexFunction
 	if err := r.Get(ctx, req.NamespacedName, &function); err != nil {
+		if apierrors.IsNotFound(err) {
+			forgetFunctionMetrics(req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -77,13 +92,25 @@ func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		function.Status.Attributes = make(map[string]string)
 	}
 
+	previousReady := readyCondition(function.Status.Conditions)
+	previousState := function.Status.State
+	failureReason := ""
+
 	// Defer status update
 	defer func() {
 		function.Status.ObservedGeneration = function.Generation
+		spent := enterFunctionState(&function, previousState, time.Now())
 		if updateErr := r.Status().Update(ctx, &function); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			if failureReason == EventReasonBuildFailed && isNewFailure(previousReady, function.Status.Conditions) {
+				observeFunctionBuild(&function, functionBuildFailure)
+			}
+			recordReadyTransition(r.Recorder, &function, previousReady, function.Status.Conditions, failureReason)
+			observeFunctionReconcile(&function, previousState, spent, res, err)
 		}
+		span.SetAttributes(attribute.String("kdex.function.state", string(function.Status.State)))
 
 		log.V(3).Info("status", "status", function.Status, "err", err, "res", res)
 	}()
@@ -108,6 +135,20 @@ func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return r1, err
 	}
 
+	if _, err := host.ParseProbes(function.Annotations, function.Spec.API.BasePath); err != nil {
+		kdexv1alpha1.SetConditions(
+			&function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
 	secrets, err := ResolveServiceAccountSecrets(ctx, r.Client, internalHost.Namespace, internalHost.Spec.ServiceAccountRef.Name)
 	if err != nil {
 		kdexv1alpha1.SetConditions(
@@ -172,6 +213,36 @@ func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		faasAdaptorSpec = &v.Spec
 	}
 
+	buildEngine, err := build.ParseEngine(faasAdaptorObj.GetAnnotations()[build.EngineAnnotation])
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	deployPackageType, err := deploy.ParsePackageType(faasAdaptorObj.GetAnnotations()[deploy.PackageTypeAnnotation])
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
 	currentGen := fmt.Sprintf("%d", faasAdaptorObj.GetGeneration())
 	if function.Status.Attributes["faasAdaptor.generation"] != "" && function.Status.Attributes["faasAdaptor.generation"] != currentGen {
 		log.Info("FaaS Adaptor updated, re-reconciling", "oldGen", function.Status.Attributes["faasAdaptor.generation"], "newGen", currentGen)
@@ -180,22 +251,38 @@ func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	function.Status.Attributes["faasAdaptor.generation"] = currentGen
 
 	hc := handlerContext{
-		ctx:              ctx,
-		faasAdaptorSpec:  *faasAdaptorSpec,
-		function:         &function,
-		host:             *internalHost,
-		imagePullSecrets: imagePullSecretRefs,
-		req:              req,
+		buildEngine:        buildEngine,
+		buildExecutorImage: faasAdaptorObj.GetAnnotations()[build.ExecutorImageAnnotation],
+		ctx:                ctx,
+		deployPackageType:  deployPackageType,
+		failureReason:      &failureReason,
+		faasAdaptorSpec:    *faasAdaptorSpec,
+		function:           &function,
+		host:               *internalHost,
+		imagePullSecrets:   imagePullSecretRefs,
+		req:                req,
 	}
 
-	// Pick up asynchronous builder updates (e.g. from KPack git polling)
-	if function.Spec.Origin.Executable == nil && function.Status.Source != nil {
+	if shouldReturn, r1, err := r.handleAPIChanges(hc); shouldReturn {
+		return r1, err
+	}
+
+	if function.Status.State != kdexv1alpha1.KDexFunctionStatePending {
+		if shouldReturn, r1, err := r.handleRollback(hc); shouldReturn {
+			return r1, err
+		}
+	}
+
+	// Pick up asynchronous builder updates (e.g. from KPack git polling),
+	// unless the function is rolled back to a previous image
+	if function.Spec.Origin.Executable == nil && function.Status.Source != nil && buildEngine == build.EngineKPack &&
+		function.Annotations[rollbackImageAnnotation] == "" {
 		kImageName := fmt.Sprintf("%s-%s", hc.host.Name, function.Name)
 		image := &unstructured.Unstructured{}
 		image.SetGroupVersionKind(internal.KPackImageGVK)
 		if err := r.Get(ctx, types.NamespacedName{Name: kImageName, Namespace: function.Namespace}, image); err == nil {
 			latestImage, found, _ := unstructured.NestedString(image.Object, "status", "latestImage")
-			if found && latestImage != "" {
+			if found && latestImage != "" && !canaryHandled(&function, latestImage) {
 				if function.Status.State == kdexv1alpha1.KDexFunctionStateReady && function.Status.Executable.Image != latestImage {
 					log.Info("New image detected from KPack, re-reconciling from source available", "latestImage", latestImage)
 					function.Status.State = kdexv1alpha1.KDexFunctionStateSourceAvailable
@@ -241,11 +328,23 @@ func (r *KDexFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 func (r *KDexFunctionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	kPackUn := &unstructured.Unstructured{}
 	kPackUn.SetGroupVersionKind(internal.KPackImageGVK)
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&kdexv1alpha1.KDexFunction{}).
 		Owns(&batchv1.Job{}).
 		Owns(&batchv1.CronJob{}).
-		Owns(kPackUn).
+		Owns(kPackUn)
+
+	// Tekton and OpenFaaS are optional, without them pipeline runs and
+	// OpenFaaS functions are only polled.
+	for _, gvk := range []schema.GroupVersionKind{internal.TektonPipelineRunGVK, internal.OpenFaaSFunctionGVK} {
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			un := &unstructured.Unstructured{}
+			un.SetGroupVersionKind(gvk)
+			b = b.Owns(un)
+		}
+	}
+
+	return b.
 		Watches(
 			&kdexv1alpha1.KDexInternalHost{},
 			MakeHandlerByReferencePath(r.Client, r.Scheme, &kdexv1alpha1.KDexFunction{}, &kdexv1alpha1.KDexFunctionList{}, "{.Spec.HostRef}")).
@@ -363,6 +462,9 @@ func (r *KDexFunctionReconciler) handleBuildValid(hc handlerContext) (ctrl.Resul
 		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
 	}
 
+	// Commits pushed to the previous source are not built.
+	delete(hc.function.Status.Attributes, build.SourceCommitAttribute)
+
 	if hc.function.Spec.Origin.Source != nil {
 		hc.function.Status.Source = hc.function.Spec.Origin.Source
 	} else {
@@ -470,6 +572,7 @@ func (r *KDexFunctionReconciler) handleBuildValid(hc handlerContext) (ctrl.Resul
 
 			if job.Status.Failed == 1 {
 				err := fmt.Errorf("code generation job %s/%s failed: %s", job.Namespace, job.Name, terminationMessage)
+				*hc.failureReason = EventReasonBuildFailed
 				kdexv1alpha1.SetConditions(
 					&hc.function.Status.Conditions,
 					kdexv1alpha1.ConditionStatuses{
@@ -569,18 +672,32 @@ func (r *KDexFunctionReconciler) handleSourceAvailable(hc handlerContext) (ctrl.
 	} else {
 		builder := build.Builder{
 			Client:         r.Client,
+			Commit:         hc.function.Status.Attributes[build.SourceCommitAttribute],
+			Engine:         hc.buildEngine,
+			ExecutorImage:  hc.buildExecutorImage,
 			ImageRegistry:  hc.host.Spec.Registries.ImageRegistry,
 			Scheme:         r.Scheme,
 			ServiceAccount: hc.host.Spec.ServiceAccountRef.Name,
 			Source:         *hc.function.Status.Source,
 		}
+		if len(hc.imagePullSecrets) > 0 {
+			builder.RegistrySecret = &hc.imagePullSecrets[0]
+		}
+		gitSecrets := hc.host.Spec.ServiceAccountSecrets.Filter(
+			func(s corev1.Secret) bool {
+				return s.Annotations["kdex.dev/secret-type"] == "git"
+			},
+		)
+		if len(gitSecrets) > 0 {
+			builder.GitSecret = &corev1.LocalObjectReference{Name: gitSecrets[0].Name}
+		}
 
-		op, imgUnstruct, err := builder.GetOrCreateKPackImage(hc.ctx, hc.function)
+		op, imageBuild, err := builder.ImageBuilder().GetOrCreateBuild(hc.ctx, hc.function)
 		if err != nil {
-			if strings.Contains(err.Error(), "Immutable field changed") {
-				log.V(2).Info("Immutable field changed, deleting image builder", "image builder", imgUnstruct)
+			if strings.Contains(err.Error(), "Immutable field changed") && imageBuild != nil && imageBuild.Object != nil {
+				log.V(2).Info("Immutable field changed, deleting image builder", "image builder", imageBuild.Object)
 
-				if err := r.Delete(hc.ctx, imgUnstruct); err != nil {
+				if err := r.Delete(hc.ctx, imageBuild.Object); err != nil {
 					return ctrl.Result{}, err
 				}
 
@@ -602,45 +719,31 @@ func (r *KDexFunctionReconciler) handleSourceAvailable(hc handlerContext) (ctrl.
 		}
 
 		log.V(2).Info(
-			"GetOrCreateKPackImage",
+			"GetOrCreateBuild",
+			"engine", hc.buildEngine,
 			"op", op,
 			"generation", hc.function.GetGeneration(),
 			"source", hc.function.Status.Source,
-			"KPackImage", imgUnstruct,
+			"build", imageBuild.Object,
 		)
 
-		success := false
-		if imgUnstruct != nil && imgUnstruct.Object != nil {
-			status, ok := imgUnstruct.Object["status"].(map[string]any)
-			if ok {
-				observedGeneration, found, _ := unstructured.NestedInt64(imgUnstruct.Object, "status", "observedGeneration")
-				if found && observedGeneration >= imgUnstruct.GetGeneration() {
-					conditions, ok := status["conditions"].([]any)
-					if ok {
-						for _, cond := range conditions {
-							if cond.(map[string]any)["type"] == "Ready" && cond.(map[string]any)["status"] == "True" {
-								success = true
-							} else if cond.(map[string]any)["type"] == "Failed" && cond.(map[string]any)["status"] == "True" {
-								err := fmt.Errorf("image builder job %s/%s failed: %s", imgUnstruct.GetNamespace(), imgUnstruct.GetName(), cond.(map[string]any)["message"])
-								kdexv1alpha1.SetConditions(
-									&hc.function.Status.Conditions,
-									kdexv1alpha1.ConditionStatuses{
-										Degraded:    metav1.ConditionTrue,
-										Progressing: metav1.ConditionFalse,
-										Ready:       metav1.ConditionFalse,
-									},
-									kdexv1alpha1.ConditionReasonReconcileError,
-									err.Error(),
-								)
-								return ctrl.Result{}, err
-							}
-						}
-					}
-				}
-			}
+		if imageBuild.Failure != "" {
+			err := fmt.Errorf("image builder job %s/%s failed: %s", imageBuild.Object.GetNamespace(), imageBuild.Object.GetName(), imageBuild.Failure)
+			*hc.failureReason = EventReasonBuildFailed
+			kdexv1alpha1.SetConditions(
+				&hc.function.Status.Conditions,
+				kdexv1alpha1.ConditionStatuses{
+					Degraded:    metav1.ConditionTrue,
+					Progressing: metav1.ConditionFalse,
+					Ready:       metav1.ConditionFalse,
+				},
+				kdexv1alpha1.ConditionReasonReconcileError,
+				err.Error(),
+			)
+			return ctrl.Result{}, err
 		}
 
-		if !success {
+		if imageBuild.Image == "" {
 			kdexv1alpha1.SetConditions(
 				&hc.function.Status.Conditions,
 				kdexv1alpha1.ConditionStatuses{
@@ -649,31 +752,25 @@ func (r *KDexFunctionReconciler) handleSourceAvailable(hc handlerContext) (ctrl.
 					Ready:       metav1.ConditionFalse,
 				},
 				kdexv1alpha1.ConditionReasonReconciling,
-				fmt.Sprintf("Waiting on image builder job %s/%s to complete", imgUnstruct.GetNamespace(), imgUnstruct.GetName()),
+				fmt.Sprintf("Waiting on image builder job %s/%s to complete", imageBuild.Object.GetNamespace(), imageBuild.Object.GetName()),
 			)
 
-			log.V(2).Info(fmt.Sprintf("Waiting on image builder job %s/%s to complete", imgUnstruct.GetNamespace(), imgUnstruct.GetName()))
+			log.V(2).Info(fmt.Sprintf("Waiting on image builder job %s/%s to complete", imageBuild.Object.GetNamespace(), imageBuild.Object.GetName()))
+
+			if err := r.cleanupJobs(hc.ctx, hc.function, build.JobApp); err != nil {
+				return ctrl.Result{}, err
+			}
 
 			return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
-		} else {
-			status, _ := imgUnstruct.Object["status"].(map[string]any)
+		}
 
-			hc.function.Status.Executable = &kdexv1alpha1.Executable{
-				Image: status["latestImage"].(string),
-			}
-			tags := []string{}
-			tag, ok, _ := unstructured.NestedString(imgUnstruct.Object, "spec", "tag")
-			if ok {
-				tags = append(tags, tag)
-			}
-			additionalTags, ok, _ := unstructured.NestedSlice(imgUnstruct.Object, "spec", "additionalTags")
-			if ok {
-				for _, t := range additionalTags {
-					tags = append(tags, t.(string))
-				}
-			}
-			hc.function.Status.Attributes["image.tags"] = strings.Join(tags, ",")
+		hc.function.Status.Executable = &kdexv1alpha1.Executable{
+			Image: imageBuild.Image,
 		}
+		hc.function.Status.Attributes["image.tags"] = strings.Join(imageBuild.Tags, ",")
+
+		r.Recorder.Eventf(hc.function, imageBuild.Object, corev1.EventTypeNormal, EventReasonImageBuilt, "Build", "Built image %s", imageBuild.Image)
+		observeFunctionBuild(hc.function, functionBuildSuccess)
 	}
 
 	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateExecutableAvailable
@@ -698,15 +795,99 @@ func (r *KDexFunctionReconciler) handleSourceAvailable(hc handlerContext) (ctrl.
 func (r *KDexFunctionReconciler) handleExecutableAvailable(hc handlerContext) (ctrl.Result, error) {
 	log := logf.FromContext(hc.ctx)
 
+	canary, err := deploy.ParseCanary(hc.function.Annotations)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	// The image is already the canary, or was aborted as one, the stable
+	// deployment keeps serving.
+	if canary != nil && hc.function.Status.Executable != nil && canaryHandled(hc.function, hc.function.Status.Executable.Image) {
+		restoreStableExecutable(hc.function)
+		hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
 	deployer := deploy.Deployer{
+		Canary:           canaryApplies(hc.function, canary),
 		Client:           r.Client,
 		FaaSAdaptor:      hc.faasAdaptorSpec,
 		Host:             hc.host,
 		ImagePullSecrets: hc.imagePullSecrets,
+		PackageType:      hc.deployPackageType,
 		Scheme:           r.Scheme,
 		ServiceAccount:   hc.host.Spec.ServiceAccountRef.Name,
 	}
 
+	var result ctrl.Result
+	if hc.faasAdaptorSpec.Provider == deploy.ProviderOpenFaaS {
+		result, err = r.deployToOpenFaaS(hc, deployer)
+	} else {
+		result, err = r.deployWithJob(hc, deployer)
+	}
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// The stable deployment keeps serving beside the canary until it is
+	// promoted or aborted.
+	if deployer.Canary {
+		image := hc.function.Status.Executable.Image
+		hc.function.Status.Attributes[deploy.CanaryImageAttribute] = image
+		restoreStableExecutable(hc.function)
+		hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
+		hc.function.Status.Detail = fmt.Sprintf("%v: canary %s deployed at %s", kdexv1alpha1.KDexFunctionStateReady, image, hc.function.Status.Attributes[deploy.CanaryURLAttribute])
+
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionTrue,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			hc.function.Status.Detail,
+		)
+
+		log.V(2).Info(hc.function.Status.Detail)
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateFunctionDeployed
+	hc.function.Status.Detail = fmt.Sprintf("%v: %s", kdexv1alpha1.KDexFunctionStateFunctionDeployed, hc.function.Status.URL)
+
+	kdexv1alpha1.SetConditions(
+		&hc.function.Status.Conditions,
+		kdexv1alpha1.ConditionStatuses{
+			Degraded:    metav1.ConditionFalse,
+			Progressing: metav1.ConditionTrue,
+			Ready:       metav1.ConditionFalse,
+		},
+		kdexv1alpha1.ConditionReasonReconciling,
+		hc.function.Status.Detail,
+	)
+
+	log.V(2).Info(hc.function.Status.Detail)
+
+	return ctrl.Result{}, nil
+}
+
+// deployWithJob runs the deployer job of the adaptor and reads the URL of the
+// function from its termination message. A zero result means deployed.
+func (r *KDexFunctionReconciler) deployWithJob(hc handlerContext, deployer deploy.Deployer) (ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
 	job, err := deployer.Deploy(hc.ctx, hc.function)
 	if err != nil {
 		kdexv1alpha1.SetConditions(
@@ -772,6 +953,7 @@ func (r *KDexFunctionReconciler) handleExecutableAvailable(hc handlerContext) (c
 
 		if job.Status.Failed == 1 {
 			err := fmt.Errorf("function deployment job %s/%s failed: %s", job.Namespace, job.Name, terminationMessage)
+			*hc.failureReason = EventReasonDeployFailed
 			kdexv1alpha1.SetConditions(
 				&hc.function.Status.Conditions,
 				kdexv1alpha1.ConditionStatuses{
@@ -790,11 +972,8 @@ func (r *KDexFunctionReconciler) handleExecutableAvailable(hc handlerContext) (c
 			return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
 		}
 
-		type results struct {
-			URL string `json:"url"`
-		}
-		var res results
-		if err := json.Unmarshal([]byte(terminationMessage), &res); err != nil {
+		res, err := deploy.ParseResult(hc.faasAdaptorSpec.Provider, terminationMessage)
+		if err != nil {
 			kdexv1alpha1.SetConditions(
 				&hc.function.Status.Conditions,
 				kdexv1alpha1.ConditionStatuses{
@@ -813,24 +992,75 @@ func (r *KDexFunctionReconciler) handleExecutableAvailable(hc handlerContext) (c
 			return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
 		}
 
-		hc.function.Status.URL = res.URL
+		if deployer.Canary {
+			hc.function.Status.Attributes[deploy.CanaryURLAttribute] = res.URL
+		} else {
+			hc.function.Status.URL = res.URL
+		}
+		hc.function.Status.Attributes["function.provider"] = hc.faasAdaptorSpec.Provider
 	}
 
-	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateFunctionDeployed
-	hc.function.Status.Detail = fmt.Sprintf("%v: %s", kdexv1alpha1.KDexFunctionStateFunctionDeployed, hc.function.Status.URL)
+	return ctrl.Result{}, nil
+}
 
-	kdexv1alpha1.SetConditions(
-		&hc.function.Status.Conditions,
-		kdexv1alpha1.ConditionStatuses{
-			Degraded:    metav1.ConditionFalse,
-			Progressing: metav1.ConditionTrue,
-			Ready:       metav1.ConditionFalse,
-		},
-		kdexv1alpha1.ConditionReasonReconciling,
-		hc.function.Status.Detail,
-	)
+// deployToOpenFaaS creates or updates the OpenFaaS Function of the function
+// and waits for the gateway to serve it. A zero result means deployed.
+func (r *KDexFunctionReconciler) deployToOpenFaaS(hc handlerContext, deployer deploy.Deployer) (ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
 
-	log.V(2).Info(hc.function.Status.Detail)
+	_, deployment, err := deployer.DeployOpenFaaS(hc.ctx, hc.function)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	if deployment.Failure != "" {
+		*hc.failureReason = EventReasonDeployFailed
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf("OpenFaaS function %s/%s failed: %s", deployment.Object.GetNamespace(), deployment.Object.GetName(), deployment.Failure),
+		)
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	if deployment.URL == "" {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			fmt.Sprintf("Waiting on OpenFaaS function %s/%s to be available", deployment.Object.GetNamespace(), deployment.Object.GetName()),
+		)
+
+		log.V(2).Info(fmt.Sprintf("Waiting on OpenFaaS function %s/%s to be available", deployment.Object.GetNamespace(), deployment.Object.GetName()))
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	if deployer.Canary {
+		hc.function.Status.Attributes[deploy.CanaryURLAttribute] = deployment.URL
+	} else {
+		hc.function.Status.URL = deployment.URL
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -862,6 +1092,12 @@ func (r *KDexFunctionReconciler) handleFunctionDeployed(hc handlerContext) (ctrl
 		return ctrl.Result{}, err
 	}
 
+	if shouldReturn, r1, err := r.handleContractTest(hc, deployer); shouldReturn {
+		return r1, err
+	}
+
+	recordDeployedImage(hc.function)
+
 	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
 	hc.function.Status.Detail = fmt.Sprintf("%v: %s%s", kdexv1alpha1.KDexFunctionStateReady, hc.function.Status.URL, hc.function.Spec.API.BasePath)
 
@@ -914,6 +1150,10 @@ func (r *KDexFunctionReconciler) handleReady(hc handlerContext) (ctrl.Result, er
 		return ctrl.Result{}, err
 	}
 
+	if hc.function.Status.Attributes[deploy.CanaryImageAttribute] != "" {
+		return r.evaluateCanary(hc)
+	}
+
 	// Stay In Ready State
 	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateReady
 	hc.function.Status.Detail = fmt.Sprintf("%v: %s%s", kdexv1alpha1.KDexFunctionStateReady, hc.function.Status.URL, hc.function.Spec.API.BasePath)
@@ -2,14 +2,19 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/kdex-tech/host-manager/internal/deploy"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -682,3 +687,161 @@ var _ = Describe("KDexFunction Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("Function rollback", func() {
+	function := func(image string, history string) *kdexv1alpha1.KDexFunction {
+		return &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "shop"},
+			Status: kdexv1alpha1.KDexFunctionStatus{
+				KDexObjectStatus: kdexv1alpha1.KDexObjectStatus{
+					Attributes: map[string]string{imageHistoryAttribute: history},
+				},
+				Executable: &kdexv1alpha1.Executable{Image: image},
+			},
+		}
+	}
+
+	It("records deployed images most recent first", func() {
+		fn := function("registry/checkout:3", "")
+		recordDeployedImage(fn)
+		Expect(imageHistory(fn)).To(Equal([]string{"registry/checkout:3"}))
+
+		fn = function("registry/checkout:1", "registry/checkout:3,registry/checkout:2,registry/checkout:1")
+		recordDeployedImage(fn)
+		Expect(imageHistory(fn)).To(Equal([]string{"registry/checkout:1", "registry/checkout:3", "registry/checkout:2"}))
+	})
+
+	It("keeps at most maxImageHistory images", func() {
+		fn := function("", "")
+		for i := range maxImageHistory + 2 {
+			fn.Status.Executable.Image = fmt.Sprintf("registry/checkout:%d", i)
+			recordDeployedImage(fn)
+		}
+		Expect(imageHistory(fn)).To(HaveLen(maxImageHistory))
+		Expect(imageHistory(fn)[0]).To(Equal(fmt.Sprintf("registry/checkout:%d", maxImageHistory+1)))
+	})
+
+	It("only rolls back to previously deployed images", func() {
+		fn := function("registry/checkout:3", "registry/checkout:3,registry/checkout:2")
+		image, err := rollbackImage(fn)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image).To(BeEmpty())
+
+		fn.Annotations = map[string]string{rollbackImageAnnotation: "registry/checkout:2"}
+		image, err = rollbackImage(fn)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image).To(Equal("registry/checkout:2"))
+
+		fn.Annotations[rollbackImageAnnotation] = "registry/checkout:1"
+		_, err = rollbackImage(fn)
+		Expect(err).To(MatchError(ContainSubstring("is not one of its previously deployed images")))
+	})
+})
+
+var _ = Describe("Function canary", func() {
+	function := func(image string, history string) *kdexv1alpha1.KDexFunction {
+		return &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "shop"},
+			Status: kdexv1alpha1.KDexFunctionStatus{
+				KDexObjectStatus: kdexv1alpha1.KDexObjectStatus{
+					Attributes: map[string]string{imageHistoryAttribute: history},
+				},
+				Executable: &kdexv1alpha1.Executable{Image: image},
+				URL:        "http://checkout.shop.svc.cluster.local",
+			},
+		}
+	}
+	canary := &deploy.Canary{MaxErrorRatio: 0.05, MinRequests: 100, Weight: 10}
+
+	It("deploys new images of deployed functions as canaries", func() {
+		Expect(canaryApplies(function("registry/checkout:2", "registry/checkout:1"), canary)).To(BeTrue())
+		Expect(canaryApplies(function("registry/checkout:2", "registry/checkout:1"), nil)).To(BeFalse())
+		Expect(canaryApplies(function("registry/checkout:1", "registry/checkout:1"), canary)).To(BeFalse())
+		Expect(canaryApplies(function("registry/checkout:1", ""), canary)).To(BeFalse())
+
+		fn := function("registry/checkout:2", "registry/checkout:1")
+		fn.Status.Attributes[canaryPromotedAttribute] = "registry/checkout:2"
+		Expect(canaryApplies(fn, canary)).To(BeFalse())
+
+		fn = function("registry/checkout:2", "registry/checkout:1")
+		fn.Annotations = map[string]string{rollbackImageAnnotation: "registry/checkout:1"}
+		Expect(canaryApplies(fn, canary)).To(BeFalse())
+	})
+
+	It("does not deploy current or aborted canaries again", func() {
+		fn := function("registry/checkout:1", "registry/checkout:1")
+		fn.Status.Attributes[deploy.CanaryImageAttribute] = "registry/checkout:2"
+		fn.Status.Attributes[canaryAbortedAttribute] = "registry/checkout:3"
+		Expect(canaryHandled(fn, "registry/checkout:2")).To(BeTrue())
+		Expect(canaryHandled(fn, "registry/checkout:3")).To(BeTrue())
+		Expect(canaryHandled(fn, "registry/checkout:4")).To(BeFalse())
+	})
+
+	It("restores the stable executable", func() {
+		fn := function("registry/checkout:2", "registry/checkout:1")
+		restoreStableExecutable(fn)
+		Expect(fn.Status.Executable.Image).To(Equal("registry/checkout:1"))
+	})
+})
+
+var _ = Describe("Function metrics", func() {
+	function := func(state kdexv1alpha1.KDexFunctionState, since string) *kdexv1alpha1.KDexFunction {
+		return &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "metrics"},
+			Spec: kdexv1alpha1.KDexFunctionSpec{
+				HostRef: corev1.LocalObjectReference{Name: "shop"},
+			},
+			Status: kdexv1alpha1.KDexFunctionStatus{
+				KDexObjectStatus: kdexv1alpha1.KDexObjectStatus{
+					Attributes: map[string]string{functionStateSinceAttribute: since},
+				},
+				State: state,
+			},
+		}
+	}
+	entered := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	AfterEach(func() {
+		forgetFunctionMetrics("metrics", "checkout")
+	})
+
+	It("measures the time spent in each state", func() {
+		fn := function(kdexv1alpha1.KDexFunctionStateFunctionDeployed, entered.Format(time.RFC3339))
+		spent := enterFunctionState(fn, kdexv1alpha1.KDexFunctionStateExecutableAvailable, entered.Add(90*time.Second))
+		Expect(spent).To(Equal(90 * time.Second))
+		Expect(fn.Status.Attributes[functionStateSinceAttribute]).To(Equal("2026-01-01T12:01:30Z"))
+
+		observeFunctionReconcile(fn, kdexv1alpha1.KDexFunctionStateExecutableAvailable, spent, ctrl.Result{RequeueAfter: time.Second}, nil)
+		Expect(testutil.CollectAndCount(functionStateDurationHistogram)).To(Equal(1))
+		Expect(testutil.CollectAndCount(functionDeployDurationHistogram)).To(Equal(1))
+		Expect(testutil.ToFloat64(functionStateEnteredGauge.WithLabelValues("metrics", "shop", "checkout", "FunctionDeployed"))).
+			To(Equal(float64(entered.Add(90 * time.Second).Unix())))
+		Expect(testutil.ToFloat64(functionRequeuesCounter.WithLabelValues("metrics", "shop", "checkout", "FunctionDeployed"))).To(Equal(1.0))
+
+		fn.Status.State = kdexv1alpha1.KDexFunctionStateReady
+		spent = enterFunctionState(fn, kdexv1alpha1.KDexFunctionStateFunctionDeployed, entered.Add(100*time.Second))
+		Expect(spent).To(Equal(10 * time.Second))
+		observeFunctionReconcile(fn, kdexv1alpha1.KDexFunctionStateFunctionDeployed, spent, ctrl.Result{}, nil)
+		Expect(testutil.CollectAndCount(functionStateEnteredGauge)).To(Equal(1), "only the current state is reported")
+		Expect(testutil.CollectAndCount(functionStateDurationHistogram)).To(Equal(2))
+		Expect(testutil.CollectAndCount(functionRequeuesCounter)).To(Equal(1))
+	})
+
+	It("stamps functions in the same state without measuring", func() {
+		fn := function(kdexv1alpha1.KDexFunctionStateReady, "")
+		Expect(enterFunctionState(fn, kdexv1alpha1.KDexFunctionStateReady, entered)).To(BeZero())
+		Expect(fn.Status.Attributes[functionStateSinceAttribute]).To(Equal("2026-01-01T12:00:00Z"))
+
+		Expect(enterFunctionState(fn, kdexv1alpha1.KDexFunctionStateReady, entered.Add(time.Minute))).To(BeZero())
+		Expect(fn.Status.Attributes[functionStateSinceAttribute]).To(Equal("2026-01-01T12:00:00Z"))
+	})
+
+	It("counts builds by result", func() {
+		fn := function(kdexv1alpha1.KDexFunctionStateSourceAvailable, "")
+		observeFunctionBuild(fn, functionBuildFailure)
+		observeFunctionBuild(fn, functionBuildSuccess)
+		observeFunctionBuild(fn, functionBuildSuccess)
+		Expect(testutil.ToFloat64(functionBuildsCounter.WithLabelValues("metrics", "shop", "checkout", "success"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(functionBuildsCounter.WithLabelValues("metrics", "shop", "checkout", "failure"))).To(Equal(1.0))
+	})
+})
@@ -18,8 +18,10 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -27,16 +29,23 @@ import (
 	openapi "github.com/getkin/kin-openapi/openapi3"
 	"github.com/kdex-tech/host-manager/internal"
 	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/child"
 	"github.com/kdex-tech/host-manager/internal/host"
 	"github.com/kdex-tech/host-manager/internal/keys"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	"kdex.dev/crds/configuration"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -48,17 +57,30 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
+const (
+	// Probe annotations of the objects declaring a backend. The value is
+	// either a path or a JSON encoded core/v1 Probe.
+	backendLivenessProbeAnnotation  = "kdex.dev/backend-liveness-probe"
+	backendReadinessProbeAnnotation = "kdex.dev/backend-readiness-probe"
+	backendStartupProbeAnnotation   = "kdex.dev/backend-startup-probe"
+
+	configChecksumAnnotation = "kdex.dev/config-checksum"
+)
+
 // KDexInternalHostReconciler reconciles a KDexInternalHost object
 type KDexInternalHostReconciler struct {
 	client.Client
+	Certificates        *Certificates
 	Configuration       configuration.NexusConfiguration
 	ControllerNamespace string
 	FocalHost           string
 	HostHandler         *host.HostHandler
 	Port                int32
+	Recorder            events.EventRecorder
 	RequeueDelay        time.Duration
 	Scheme              *runtime.Scheme
 	ServiceName         string
@@ -71,6 +93,9 @@ type KDexInternalHostReconciler struct {
 
 // nolint:gocyclo
 func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexInternalHost", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	if req.Namespace != r.ControllerNamespace {
@@ -92,12 +117,17 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		internalHost.Status.Attributes = make(map[string]string)
 	}
 
+	previousReady := readyCondition(internalHost.Status.Conditions)
+	failureReason := ""
+
 	// Defer status update
 	defer func() {
 		internalHost.Status.ObservedGeneration = internalHost.Generation
 		if updateErr := r.Status().Update(ctx, &internalHost); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			recordReadyTransition(r.Recorder, &internalHost, previousReady, internalHost.Status.Conditions, failureReason)
 		}
 
 		log.V(3).Info("status", "status", internalHost.Status, "err", err, "res", res)
@@ -124,21 +154,34 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	secrets, err := ResolveServiceAccountSecrets(ctx, r.Client, internalHost.Namespace, internalHost.Spec.ServiceAccountRef.Name)
 	if err != nil {
-		kdexv1alpha1.SetConditions(
-			&internalHost.Status.Conditions,
-			kdexv1alpha1.ConditionStatuses{
-				Degraded:    metav1.ConditionTrue,
-				Progressing: metav1.ConditionFalse,
-				Ready:       metav1.ConditionFalse,
-			},
-			kdexv1alpha1.ConditionReasonReconcileError,
-			err.Error(),
-		)
+		return r.degraded(ctx, &internalHost, err)
+	}
+	internalHost.Spec.ServiceAccountSecrets = secrets
 
-		return ctrl.Result{}, err
+	config, err := parseHostAnnotations(&internalHost)
+	if err != nil {
+		return r.degraded(ctx, &internalHost, err)
 	}
 
-	internalHost.Spec.ServiceAccountSecrets = secrets
+	// The secrets are resolved again once the keys are rotated, so that a new
+	// key signs the tokens right away.
+	rotateAfter := time.Duration(0)
+	if config.jwtKeyRotation != nil {
+		rotateAfter, err = r.rotateJWTKeys(ctx, &internalHost, config.jwtKeyRotation, time.Now())
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+
+		secrets, err = ResolveServiceAccountSecrets(ctx, r.Client, internalHost.Namespace, internalHost.Spec.ServiceAccountRef.Name)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		internalHost.Spec.ServiceAccountSecrets = secrets
+	}
+
+	// An expiring certificate of the manager is a warning, the host is still
+	// served until it expires.
+	certificatesAfter := r.Certificates.setCertificatesValid(&internalHost, time.Now())
 
 	themeObj, shouldReturn, r1, err := ResolveKDexObjectReference(ctx, r.Client, &internalHost, &internalHost.Status.Conditions, internalHost.Spec.ThemeRef, r.RequeueDelay)
 	if shouldReturn {
@@ -146,6 +189,12 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	if themeObj != nil {
+		shouldReturn, r1, err := r.buildTheme(ctx, &internalHost, themeObj)
+		if shouldReturn {
+			return r1, err
+		}
+		applyThemeBuild(themeObj)
+
 		CollectBackend(defaultBackendServerImage, &backendRefs, themeObj)
 
 		internalHost.Status.Attributes["theme.generation"] = fmt.Sprintf("%d", themeObj.GetGeneration())
@@ -209,6 +258,36 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		scriptDefs = append(scriptDefs, scriptLibrary.Scripts...)
 	}
 
+	maps.DeleteFunc(internalHost.Status.Attributes, func(k string, _ string) bool {
+		return strings.HasPrefix(k, "theme.experiment.")
+	})
+	themeVariantAssets := map[string][]kdexv1alpha1.Asset{}
+	if config.themeExperiment != nil {
+		for _, variant := range config.themeExperiment.Variants {
+			variantThemeObj, shouldReturn, r1, err := ResolveKDexObjectReference(ctx, r.Client, &internalHost, &internalHost.Status.Conditions, &variant.ThemeRef, r.RequeueDelay)
+			if shouldReturn {
+				return r1, err
+			}
+
+			shouldReturn, r1, err = r.buildTheme(ctx, &internalHost, variantThemeObj)
+			if shouldReturn {
+				return r1, err
+			}
+			applyThemeBuild(variantThemeObj)
+
+			CollectBackend(defaultBackendServerImage, &backendRefs, variantThemeObj)
+
+			internalHost.Status.Attributes["theme.experiment."+variant.Name+".generation"] = fmt.Sprintf("%d", variantThemeObj.GetGeneration())
+
+			switch v := variantThemeObj.(type) {
+			case *kdexv1alpha1.KDexTheme:
+				themeVariantAssets[variant.Name] = v.Spec.Assets
+			case *kdexv1alpha1.KDexClusterTheme:
+				themeVariantAssets[variant.Name] = v.Spec.Assets
+			}
+		}
+	}
+
 	var utilityPages kdexv1alpha1.KDexInternalUtilityPageList
 	if err := r.List(ctx, &utilityPages, client.InNamespace(r.ControllerNamespace), client.MatchingFields{internal.HOST_INDEX_KEY: r.FocalHost}); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to list utility pages: %w", err)
@@ -218,13 +297,15 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		kdexv1alpha1.AnnouncementUtilityPageType,
 		kdexv1alpha1.ErrorUtilityPageType,
 		kdexv1alpha1.LoginUtilityPageType,
+		host.ConsoleUtilityPageType,
+		host.MFAUtilityPageType,
 	} {
 		pageHandler := r.HostHandler.GetUtilityPageHandler(utilityPageType)
 		if pageHandler.Name == "" {
 			// check if it's supposed to be there
 			expected := false
 			for _, up := range utilityPages.Items {
-				if up.Spec.Type == utilityPageType {
+				if t, _ := host.ParseUtilityPageType(up.Annotations, up.Spec.Type); t == utilityPageType {
 					expected = true
 					break
 				}
@@ -243,10 +324,11 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	if internalHost.Spec.IsConfigured(defaultBackendServerImage) {
 		seenPaths[internalHost.Spec.IngressPath] = true
 		requiredBackends = append(requiredBackends, resolvedBackend{
-			Backend:   internalHost.Spec.Backend,
-			Kind:      "KDexHost",
-			Name:      internalHost.Name,
-			Namespace: internalHost.Namespace,
+			Annotations: internalHost.Annotations,
+			Backend:     internalHost.Spec.Backend,
+			Kind:        "KDexHost",
+			Name:        internalHost.Name,
+			Namespace:   internalHost.Namespace,
 		})
 	}
 
@@ -268,18 +350,9 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 				pageHandler.Page.BasePath, r.ControllerNamespace, pageHandler.Name, "KDexPageBinding",
 			)
 
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
+			failureReason = EventReasonPathConflict
 
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
 		}
 		seenPaths[pageHandler.Page.BasePath] = true
 
@@ -290,18 +363,9 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 					pageHandler.Page.PatternPath, r.ControllerNamespace, pageHandler.Name, "KDexPageBinding",
 				)
 
-				kdexv1alpha1.SetConditions(
-					&internalHost.Status.Conditions,
-					kdexv1alpha1.ConditionStatuses{
-						Degraded:    metav1.ConditionTrue,
-						Progressing: metav1.ConditionFalse,
-						Ready:       metav1.ConditionFalse,
-					},
-					kdexv1alpha1.ConditionReasonReconcileError,
-					err.Error(),
-				)
+				failureReason = EventReasonPathConflict
 
-				return ctrl.Result{}, err
+				return r.degraded(ctx, &internalHost, err)
 			}
 			seenPaths[pageHandler.Page.PatternPath] = true
 		}
@@ -338,6 +402,8 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			continue
 		}
 
+		applyThemeBuild(obj)
+
 		switch v := obj.(type) {
 		case *kdexv1alpha1.KDexClusterApp:
 			backend = v.Spec.Backend
@@ -355,32 +421,33 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			continue
 		}
 
-		if seenPaths[backend.IngressPath] {
+		workload, err := parseBackendWorkload(obj.GetAnnotations())
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		switch {
+		case workload.scheduled():
+			// A scheduled backend serves no requests, so it has no path.
+			backend.IngressPath = ""
+		case seenPaths[backend.IngressPath]:
 			err = fmt.Errorf(
 				"duplicated path %s, paths must be unique across backends and pages, obj: %s/%s, kind: %s",
 				backend.IngressPath, ref.Namespace, ref.Name, ref.Kind,
 			)
 
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
+			failureReason = EventReasonPathConflict
 
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
+		default:
+			seenPaths[backend.IngressPath] = true
 		}
-		seenPaths[backend.IngressPath] = true
 
 		requiredBackends = append(requiredBackends, resolvedBackend{
-			Backend:   backend,
-			Kind:      ref.Kind,
-			Name:      ref.Name,
-			Namespace: ref.Namespace,
+			Annotations: obj.GetAnnotations(),
+			Backend:     backend,
+			Kind:        ref.Kind,
+			Name:        ref.Name,
+			Namespace:   ref.Namespace,
 		})
 	}
 
@@ -402,18 +469,9 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 					routePath, function.Namespace, function.Name, "KDexFunction",
 				)
 
-				kdexv1alpha1.SetConditions(
-					&internalHost.Status.Conditions,
-					kdexv1alpha1.ConditionStatuses{
-						Degraded:    metav1.ConditionTrue,
-						Progressing: metav1.ConditionFalse,
-						Ready:       metav1.ConditionFalse,
-					},
-					kdexv1alpha1.ConditionReasonReconcileError,
-					err.Error(),
-				)
+				failureReason = EventReasonPathConflict
 
-				return ctrl.Result{}, err
+				return r.degraded(ctx, &internalHost, err)
 			}
 			seenPaths[routePath] = true
 		}
@@ -430,20 +488,9 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		log.V(2).Info("deleting host package references", "packageReferences", internalPackageReferences.Name)
 
 		if err := r.Delete(ctx, internalPackageReferences); client.IgnoreNotFound(err) != nil {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
-
 			log.V(2).Info("error deleting package references", "packageReferences", internalPackageReferences.Name, "err", err)
 
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
 		}
 
 		internalPackageReferences = nil
@@ -472,6 +519,11 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 		// Synthetic Backend for the packages
 		packagesBackend := resolvedBackend{
+			Annotations: map[string]string{
+				backendAutoscalingAnnotation:  internalHost.Annotations[packagesAutoscalingAnnotation],
+				backendAvailabilityAnnotation: internalHost.Annotations[packagesAvailabilityAnnotation],
+				backendEnvFromAnnotation:      internalHost.Annotations[backendEnvFromAnnotation],
+			},
 			Backend: be,
 			Name:    "packages",
 			Kind:    "KDexInternalPackageReferences",
@@ -481,47 +533,97 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	backendOps := map[string]controllerutil.OperationResult{}
-	deployments := make([]*appsv1.Deployment, 0, len(requiredBackends))
+	workloads := make([]client.Object, 0, len(requiredBackends))
+
+	var runtimeConfig *corev1.ConfigMap
+	backendOps["configmap/runtime-config"], runtimeConfig, err = r.createOrUpdateRuntimeConfig(ctx, &internalHost)
+	if err != nil {
+		return r.degraded(ctx, &internalHost, err)
+	}
+	internalHost.Status.Attributes[runtimeConfigVersionAttribute] = child.RuntimeConfigVersion(runtimeConfig.Data)
+
+	var hostPeer *networkingv1.NetworkPolicyPeer
+	if config.networkPolicy != nil {
+		hostPeer, err = r.hostPeer(ctx)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+	}
 
 	for _, backend := range requiredBackends {
 		keyBase := fmt.Sprintf("%s/%s", strings.ToLower(backend.Kind), backend.Name)
 		name := fmt.Sprintf("%s-%s", internalHost.Name, backend.Name)
 
-		var dep *appsv1.Deployment
-		backendOps[keyBase+"/deployment"], dep, err = r.createOrUpdateBackendDeployment(ctx, &internalHost, name, backend)
+		autoscaling, err := parseBackendAutoscaling(backend.Annotations)
 		if err != nil {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
 		}
-		backendOps[keyBase+"/service"], err = r.createOrUpdateBackendService(ctx, &internalHost, name, backend)
+		availability, err := r.backendAvailability(backend)
 		if err != nil {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
+		}
+
+		workload, err := parseBackendWorkload(backend.Annotations)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+
+		workloadKey := keyBase + "/deployment"
+		if workload != nil {
+			workloadKey = keyBase + "/" + strings.ToLower(workload.Kind)
+		}
+		var wl client.Object
+		backendOps[workloadKey], wl, err = r.createOrUpdateBackendWorkload(
+			ctx, &internalHost, name, backend, runtimeConfig, autoscaling, availability, workload,
+		)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		backendOps[keyBase+"/service"], err = r.createOrUpdateBackendService(ctx, &internalHost, name, backend, workload)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
 		}
-		if dep != nil {
-			deployments = append(deployments, dep)
+		backendOps[keyBase+"/headless-service"], err = r.createOrUpdateBackendHeadlessService(
+			ctx, &internalHost, name, backend, workload,
+		)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		backendOps[keyBase+"/autoscaler"], err = r.createOrUpdateBackendAutoscaler(ctx, &internalHost, wl, backend, autoscaling)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		backendOps[keyBase+"/disruptionbudget"], err = r.createOrUpdateBackendDisruptionBudget(ctx, &internalHost, wl, backend, availability)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		backendOps[keyBase+"/networkpolicy"], err = r.createOrUpdateBackendNetworkPolicy(ctx, &internalHost, wl, backend, config.networkPolicy, hostPeer)
+		if err != nil {
+			return r.degraded(ctx, &internalHost, err)
+		}
+		if wl != nil {
+			workloads = append(workloads, wl)
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(backendOps)) {
+		if op := backendOps[key]; op != controllerutil.OperationResultNone {
+			r.Recorder.Eventf(&internalHost, nil, corev1.EventTypeNormal, EventReasonBackendUpdated, "Deploy", "%s %s", key, op)
 		}
 	}
 
-	if err := r.cleanupObsoleteBackends(ctx, &internalHost, requiredBackends); err != nil {
+	drift, err := r.auditChildEnv(ctx, &internalHost, workloads)
+	if err != nil {
+		log.V(2).Info("env audit failed", "err", err)
+	} else if len(drift) > 0 {
+		internalHost.Status.Attributes[envDriftAttribute] = strings.Join(drift, " ")
+		log.Info("children env diverges from the host", "children", drift)
+	} else {
+		delete(internalHost.Status.Attributes, envDriftAttribute)
+	}
+
+	retireAfter, err := r.cleanupObsoleteBackends(ctx, &internalHost, requiredBackends, config.backendGracePeriod)
+	if err != nil {
 		log.V(2).Info("cleanup obsolete backends failed, requeueing", "err", err)
 
 		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
@@ -530,36 +632,32 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	var ingressOrHTTPRouteOp controllerutil.OperationResult
 	if internalHost.Spec.Routing.Strategy == kdexv1alpha1.HTTPRouteRoutingStrategy {
 		ingressOrHTTPRouteOp, err = r.createOrUpdateHTTPRoute(ctx, &internalHost, requiredBackends)
+		if err == nil {
+			err = r.setHTTPRouteRoutable(ctx, &internalHost)
+		}
 		if err != nil {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
 		}
 	} else {
 		ingressOrHTTPRouteOp, err = r.createOrUpdateIngress(ctx, &internalHost, requiredBackends)
 		if err != nil {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionTrue,
-					Progressing: metav1.ConditionFalse,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconcileError,
-				err.Error(),
-			)
-			return ctrl.Result{}, err
+			return r.degraded(ctx, &internalHost, err)
 		}
 	}
 
+	if ingressOrHTTPRouteOp != controllerutil.OperationResultNone {
+		kind := "Ingress"
+		if internalHost.Spec.Routing.Strategy == kdexv1alpha1.HTTPRouteRoutingStrategy {
+			kind = "HTTPRoute"
+		}
+		r.Recorder.Eventf(&internalHost, nil, corev1.EventTypeNormal, EventReasonIngressUpdated, "Route", "%s %s %s", kind, internalHost.Name, ingressOrHTTPRouteOp)
+	}
+
+	acmeSolvers, err := r.acmeSolvers(ctx, &internalHost)
+	if err != nil {
+		log.V(2).Info("listing acme solvers failed", "err", err)
+	}
+
 	issuer := fmt.Sprintf("%s://%s", internalHost.Spec.Routing.Scheme, internalHost.Spec.Routing.Domains[0])
 
 	authConfig, err := auth.NewConfig(
@@ -576,23 +674,39 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		func() (string, string, string, error) {
 			return auth.OIDCConfigLoader(internalHost.Spec.ServiceAccountSecrets, internalHost.Spec.DevMode)
 		},
+		func() ([]auth.OIDCProvider, string, error) {
+			return auth.OIDCProvidersLoader(internalHost.Spec.ServiceAccountSecrets, internalHost.Spec.DevMode)
+		},
 		issuer,
 		issuer,
 		internalHost.Spec.DevMode,
 		r.HostHandler.GetCacheManager(),
 	)
 	if err != nil {
-		kdexv1alpha1.SetConditions(
-			&internalHost.Status.Conditions,
-			kdexv1alpha1.ConditionStatuses{
-				Degraded:    metav1.ConditionTrue,
-				Progressing: metav1.ConditionFalse,
-				Ready:       metav1.ConditionFalse,
-			},
-			kdexv1alpha1.ConditionReasonReconcileError,
-			err.Error(),
-		)
-		return ctrl.Result{}, err
+		return r.degraded(ctx, &internalHost, err)
+	}
+
+	// Functions and other workloads call the host with service account
+	// tokens projected for the audience of the host.
+	if config.serviceAccountEntitlements != nil {
+		authConfig.ServiceAccounts = auth.NewServiceAccountAuthenticator(r.Client, issuer, config.serviceAccountEntitlements)
+	}
+
+	// Sessions are shared with the other hosts trusting the same issuers,
+	// minted for their audiences as they are for the audience of the host.
+	authConfig.CookieDomain = config.cookieDomain
+	authConfig.TrustedProxies = config.trustedProxies
+	if trustedIssuers := slices.DeleteFunc(config.trustedIssuers, func(i string) bool { return i == issuer }); len(trustedIssuers) > 0 {
+		authConfig.TrustedIssuers = auth.NewTrustedIssuers(issuer, trustedIssuers)
+		authConfig.Signer.AddAudiences(trustedIssuers...)
+	}
+
+	// Support staff act as other subjects with the tokens of an impersonation.
+	authConfig.Impersonation = config.impersonation
+
+	// The security events of the host go to the sink of its audit log.
+	if config.audit != nil {
+		authConfig.Auditor = auth.NewAuditor(internalHost.Name, config.audit.Categories, config.audit.NewSink(r.Recorder, internalHost.DeepCopy()))
 	}
 
 	authLookups := []auth.Lookup{
@@ -613,34 +727,34 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		authLookups,
 	)
 	if err != nil {
-		kdexv1alpha1.SetConditions(
-			&internalHost.Status.Conditions,
-			kdexv1alpha1.ConditionStatuses{
-				Degraded:    metav1.ConditionTrue,
-				Progressing: metav1.ConditionFalse,
-				Ready:       metav1.ConditionFalse,
-			},
-			kdexv1alpha1.ConditionReasonReconcileError,
-			err.Error(),
-		)
-		return ctrl.Result{}, err
+		return r.degraded(ctx, &internalHost, err)
 	}
 
 	authExchanger, err := auth.NewExchanger(ctx, *authConfig, r.HostHandler.GetCacheManager(), rp)
 	if err != nil {
-		kdexv1alpha1.SetConditions(
-			&internalHost.Status.Conditions,
-			kdexv1alpha1.ConditionStatuses{
-				Degraded:    metav1.ConditionTrue,
-				Progressing: metav1.ConditionFalse,
-				Ready:       metav1.ConditionFalse,
-			},
-			kdexv1alpha1.ConditionReasonReconcileError,
-			err.Error(),
-		)
-		return ctrl.Result{}, err
+		return r.degraded(ctx, &internalHost, err)
+	}
+
+	if err := r.HostHandler.SetMiddlewares(config.middlewares); err != nil {
+		return r.degraded(ctx, &internalHost, err)
 	}
 
+	r.HostHandler.SetA11yAudit(config.a11yMode)
+	r.HostHandler.SetArchive(config.archive)
+	r.HostHandler.SetBrands(config.brands)
+	r.HostHandler.SetLinkCheck(config.linkCheckInterval)
+	r.HostHandler.SetFaultInjection(config.faultInjection)
+	r.HostHandler.SetFederation(config.federation)
+	r.HostHandler.SetIntegrity(config.integrityMode)
+	r.HostHandler.SetMediaTypes(config.mediaTypes)
+	r.HostHandler.SetPerformanceBudgetMode(config.budgetMode)
+	r.HostHandler.SetPersonalization(config.personalization)
+	r.HostHandler.SetProbes(collectProbes(log, pageHandlers, functions.Items))
+	r.HostHandler.SetProfiling(config.profiling)
+	r.HostHandler.SetSLOs(config.slos)
+	r.HostHandler.SetThemeExperiment(config.themeExperiment, themeVariantAssets)
+	r.HostHandler.SetWellKnown(config.securityTxt, config.changePassword)
+	r.HostHandler.SetACMESolvers(acmeSolvers)
 	r.HostHandler.SetHost(
 		ctx,
 		&internalHost.Spec.KDexHostSpec,
@@ -657,37 +771,45 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		internalHost.Spec.Routing.Scheme,
 	)
 
-	for _, dep := range deployments {
-		if dep == nil {
-			continue
-		}
-		ready := false
-		for _, cond := range dep.Status.Conditions {
-			if cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionTrue {
-				ready = true
-			}
-		}
-		if !ready {
-			kdexv1alpha1.SetConditions(
-				&internalHost.Status.Conditions,
-				kdexv1alpha1.ConditionStatuses{
-					Degraded:    metav1.ConditionFalse,
-					Progressing: metav1.ConditionTrue,
-					Ready:       metav1.ConditionFalse,
-				},
-				kdexv1alpha1.ConditionReasonReconciling,
-				fmt.Sprintf("Waiting for deployment/%s to be ready.", dep.Name),
-			)
+	rollouts, err := r.backendRollouts(ctx, workloads)
+	if err != nil {
+		return r.degraded(ctx, &internalHost, err)
+	}
 
-			log.V(2).Info(
-				"waiting for deployments",
-				"deployment", dep.Name,
-				"conditions", dep.Status.Conditions,
-			)
+	failed, progressing := rollupBackends(&internalHost, rollouts)
 
-			return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
-		}
-		internalHost.Status.Attributes[dep.Name+".deployment"] = "ready"
+	if len(failed) > 0 {
+		kdexv1alpha1.SetConditions(
+			&internalHost.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf("Backend rollout failed. %s", strings.Join(failed, "; ")),
+		)
+
+		log.V(2).Info("backend rollout failed", "rollouts", rollouts)
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	if len(progressing) > 0 {
+		kdexv1alpha1.SetConditions(
+			&internalHost.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			fmt.Sprintf("Waiting for backends to be ready. %s", strings.Join(progressing, "; ")),
+		)
+
+		log.V(2).Info("waiting for deployments", "rollouts", rollouts)
+
+		return ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
 	}
 
 	kdexv1alpha1.SetConditions(
@@ -707,7 +829,27 @@ func (r *KDexInternalHostReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		"ingressOrHTTPRouteOp", ingressOrHTTPRouteOp,
 	)
 
-	return ctrl.Result{}, nil
+	// The obsolete backends kept for their grace period are deleted, the keys
+	// rotated and the expiring certificates reported, by a later reconcile.
+	return ctrl.Result{RequeueAfter: nextRetirement(nextRetirement(retireAfter, rotateAfter), certificatesAfter)}, nil
+}
+
+// degraded sets the conditions of the host degraded by the error of its
+// reconcile, and returns the error for the reconcile to be retried.
+func (r *KDexInternalHostReconciler) degraded(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost, err error) (ctrl.Result, error) {
+	logf.FromContext(ctx).V(2).Info("reconcile degraded", "err", err)
+
+	kdexv1alpha1.SetConditions(
+		&internalHost.Status.Conditions,
+		kdexv1alpha1.ConditionStatuses{
+			Degraded:    metav1.ConditionTrue,
+			Progressing: metav1.ConditionFalse,
+			Ready:       metav1.ConditionFalse,
+		},
+		kdexv1alpha1.ConditionReasonReconcileError,
+		err.Error(),
+	)
+	return ctrl.Result{}, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -745,13 +887,21 @@ func (r *KDexInternalHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&kdexv1alpha1.KDexInternalHost{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&batchv1.CronJob{}).
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
+		Owns(&gatewayv1.Gateway{}).
 		Owns(&gatewayv1.HTTPRoute{}).
 		Owns(&kdexv1alpha1.KDexInternalPackageReferences{}).
 		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
 		Watches(
 			&kdexv1alpha1.KDexFunction{},
 			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
@@ -852,6 +1002,25 @@ func (r *KDexInternalHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					},
 				}
 			})).
+		Watches(
+			&networkingv1.Ingress{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+				if obj.GetLabels()[acmeSolverLabel] != "true" {
+					return nil
+				}
+
+				return []reconcile.Request{
+					{
+						NamespacedName: types.NamespacedName{
+							Name:      r.FocalHost,
+							Namespace: obj.GetNamespace(),
+						},
+					},
+				}
+			})).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForAuthSecret)).
 		Watches(
 			&corev1.ServiceAccount{},
 			MakeHandlerByReferencePath(r.Client, r.Scheme, &kdexv1alpha1.KDexInternalHost{}, &kdexv1alpha1.KDexInternalHostList{}, "{.Spec.ServiceAccountRef}")).
@@ -861,15 +1030,93 @@ func (r *KDexInternalHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				LogConstructor: LogConstructor("kdexinternalhost", mgr),
 			},
 		).
-		Named("kdexinternalhost").
-		Complete(r)
+		Named("kdexinternalhost")
+
+	if r.Certificates != nil {
+		// The certificates of the manager are reported as soon as they are
+		// reloaded.
+		b = b.WatchesRawSource(source.Channel(
+			r.Certificates.Rotated(),
+			handler.TypedEnqueueRequestsFromMapFunc(func(ctx context.Context, _ string) []reconcile.Request {
+				return []reconcile.Request{
+					{
+						NamespacedName: types.NamespacedName{
+							Name:      r.FocalHost,
+							Namespace: r.ControllerNamespace,
+						},
+					},
+				}
+			})))
+	}
+
+	return b.Complete(r)
 }
 
 type resolvedBackend struct {
-	Backend   kdexv1alpha1.Backend
-	Kind      string
-	Name      string
-	Namespace string
+	Annotations map[string]string
+	Backend     kdexv1alpha1.Backend
+	Kind        string
+	Name        string
+	Namespace   string
+}
+
+// applyBackendProbes sets the probes of the backend container from the
+// probe annotations of the object declaring the backend. Probes without an
+// annotation fall back to those of the default deployment.
+func applyBackendProbes(container *corev1.Container, defaults *corev1.Container, annotations map[string]string) error {
+	probes := []struct {
+		annotation string
+		fallback   *corev1.Probe
+		target     **corev1.Probe
+	}{
+		{backendLivenessProbeAnnotation, defaults.LivenessProbe, &container.LivenessProbe},
+		{backendReadinessProbeAnnotation, defaults.ReadinessProbe, &container.ReadinessProbe},
+		{backendStartupProbeAnnotation, defaults.StartupProbe, &container.StartupProbe},
+	}
+
+	for _, p := range probes {
+		value, ok := annotations[p.annotation]
+		if !ok {
+			*p.target = p.fallback.DeepCopy()
+			continue
+		}
+
+		probe, err := parseBackendProbe(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", p.annotation, err)
+		}
+		*p.target = probe
+	}
+
+	return nil
+}
+
+// parseBackendProbe accepts either a path, which is probed with an HTTP GET on
+// the "server" port, or a JSON encoded core/v1 Probe.
+func parseBackendProbe(value string) (*corev1.Probe, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(value, "/") {
+		return &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path: value,
+					Port: intstr.FromString("server"),
+				},
+			},
+		}, nil
+	}
+
+	probe := &corev1.Probe{}
+	if err := json.Unmarshal([]byte(value), probe); err != nil {
+		return nil, err
+	}
+
+	if probe.Exec == nil && probe.GRPC == nil && probe.HTTPGet == nil && probe.TCPSocket == nil {
+		return nil, fmt.Errorf("probe must specify one of exec, grpc, httpGet or tcpSocket")
+	}
+
+	return probe, nil
 }
 
 func (r *KDexInternalHostReconciler) collectInitialPaths(
@@ -1032,6 +1279,24 @@ func (r *KDexInternalHostReconciler) getMemoizedService() *corev1.ServiceSpec {
 	return r.memoizedService
 }
 
+// builderSecretRefs returns the npm secret and the image pull secrets of the
+// service account of the host, used by the jobs building its assets.
+func builderSecretRefs(internalHost *kdexv1alpha1.KDexInternalHost) (*corev1.LocalObjectReference, []corev1.LocalObjectReference) {
+	var npmSecretRef *corev1.LocalObjectReference
+	npmSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] == "npm" })
+	if len(npmSecrets) > 0 {
+		npmSecretRef = &corev1.LocalObjectReference{Name: npmSecrets[0].Name}
+	}
+
+	pullImageSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeDockerConfigJson })
+	pullImageSecretRefs := make([]corev1.LocalObjectReference, 0, len(pullImageSecrets))
+	for _, s := range pullImageSecrets {
+		pullImageSecretRefs = append(pullImageSecretRefs, corev1.LocalObjectReference{Name: s.Name})
+	}
+
+	return npmSecretRef, pullImageSecretRefs
+}
+
 func (r *KDexInternalHostReconciler) createOrUpdatePackageReferences(
 	ctx context.Context,
 	internalHost *kdexv1alpha1.KDexInternalHost,
@@ -1040,12 +1305,7 @@ func (r *KDexInternalHostReconciler) createOrUpdatePackageReferences(
 ) (bool, ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
-	npmSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] == "npm" })
-	pullImageSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeDockerConfigJson })
-	pullImageSecretRefs := make([]corev1.LocalObjectReference, 0, len(pullImageSecrets))
-	for _, s := range pullImageSecrets {
-		pullImageSecretRefs = append(pullImageSecretRefs, corev1.LocalObjectReference{Name: s.Name})
-	}
+	npmSecretRef, pullImageSecretRefs := builderSecretRefs(internalHost)
 
 	op, err := ctrl.CreateOrUpdate(
 		ctx,
@@ -1069,10 +1329,8 @@ func (r *KDexInternalHostReconciler) createOrUpdatePackageReferences(
 			internalPackageReferences.Spec.BuilderImage = "node:25-alpine"
 			internalPackageReferences.Spec.BuilderImagePullSecrets = pullImageSecretRefs
 
-			if len(npmSecrets) > 0 {
-				internalPackageReferences.Spec.NPMSecretRef = &corev1.LocalObjectReference{
-					Name: npmSecrets[0].Name,
-				}
+			if npmSecretRef != nil {
+				internalPackageReferences.Spec.NPMSecretRef = npmSecretRef
 			}
 			internalPackageReferences.Spec.PackageReferences = packageReferences
 			internalPackageReferences.Spec.ServiceAccountRef = internalHost.Spec.ServiceAccountRef
@@ -1128,6 +1386,21 @@ func (r *KDexInternalHostReconciler) createOrUpdateIngress(
 	internalHost *kdexv1alpha1.KDexInternalHost,
 	backends []resolvedBackend,
 ) (controllerutil.OperationResult, error) {
+	profile, options, err := parseIngressProfile(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	edge, err := parseEdgeAuth(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	routing, err := parseRoutingAnnotations(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	var edgePaths []networkingv1.HTTPIngressPath
+
 	ingress := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      internalHost.Name,
@@ -1145,24 +1418,33 @@ func (r *KDexInternalHostReconciler) createOrUpdateIngress(
 				maps.Copy(ingress.Annotations, internalHost.Annotations)
 				ingress.Labels = make(map[string]string)
 				maps.Copy(ingress.Labels, internalHost.Labels)
+			}
+			if ingress.Labels == nil {
+				ingress.Labels = make(map[string]string)
+			}
+			ingress.Labels["kdex.dev/ingress"] = ingress.Name
 
-				ingress.Labels["kdex.dev/ingress"] = ingress.Name
+			// The HTTP-01 challenge paths cert-manager adds while it issues the
+			// certificates of the host are kept until it removes them.
+			challengePaths := r.acmeChallengePaths(ingress.Spec.Rules)
 
-				ingress.Spec = *r.getMemoizedIngress().DeepCopy()
+			// The spec is rebuilt on every reconcile so that the changes of the
+			// host and of the configuration, and the edits of the Ingress,
+			// converge.
+			ingress.Spec = *r.getMemoizedIngress().DeepCopy()
 
-				if ingress.Spec.DefaultBackend == nil {
-					ingress.Spec.DefaultBackend = &networkingv1.IngressBackend{}
-				}
+			if ingress.Spec.DefaultBackend == nil {
+				ingress.Spec.DefaultBackend = &networkingv1.IngressBackend{}
+			}
 
-				if ingress.Spec.DefaultBackend.Service == nil {
-					ingress.Spec.DefaultBackend.Service = &networkingv1.IngressServiceBackend{}
-				}
+			if ingress.Spec.DefaultBackend.Service == nil {
+				ingress.Spec.DefaultBackend.Service = &networkingv1.IngressServiceBackend{}
+			}
 
-				ingress.Spec.DefaultBackend.Service.Name = r.ServiceName
+			ingress.Spec.DefaultBackend.Service.Name = r.ServiceName
 
-				ingress.Spec.DefaultBackend.Service.Port.Name = internalHost.Name
-				ingress.Spec.IngressClassName = internalHost.Spec.Routing.IngressClassName
-			}
+			ingress.Spec.DefaultBackend.Service.Port.Name = internalHost.Name
+			ingress.Spec.IngressClassName = internalHost.Spec.Routing.IngressClassName
 
 			pathType := networkingv1.PathTypePrefix
 			rules := make([]networkingv1.IngressRule, 0, len(internalHost.Spec.Routing.Domains))
@@ -1191,27 +1473,39 @@ func (r *KDexInternalHostReconciler) createOrUpdateIngress(
 				})
 			}
 
+			edgePaths = nil
 			for _, rb := range backends {
-				name := fmt.Sprintf("%s-%s", internalHost.Name, rb.Name)
-				for _, rule := range rules {
-					rule.HTTP.Paths = append(rule.HTTP.Paths,
-						networkingv1.HTTPIngressPath{
-							Path:     rb.Backend.IngressPath,
-							PathType: &pathType,
-							Backend: networkingv1.IngressBackend{
-								Service: &networkingv1.IngressServiceBackend{
-									Name: name,
-									Port: networkingv1.ServiceBackendPort{
-										Name: "server",
-									},
-								},
+				if rb.Backend.IngressPath == "" {
+					continue
+				}
+				path := networkingv1.HTTPIngressPath{
+					Path:     rb.Backend.IngressPath,
+					PathType: &pathType,
+					Backend: networkingv1.IngressBackend{
+						Service: &networkingv1.IngressServiceBackend{
+							Name: fmt.Sprintf("%s-%s", internalHost.Name, rb.Name),
+							Port: networkingv1.ServiceBackendPort{
+								Name: "server",
 							},
 						},
-					)
+					},
 				}
+				// The backends authorized at the edge are routed by their own
+				// Ingress.
+				if edge.protects(rb.Backend.IngressPath) {
+					edgePaths = append(edgePaths, path)
+					continue
+				}
+				for _, rule := range rules {
+					rule.HTTP.Paths = append(rule.HTTP.Paths, path)
+				}
+			}
+
+			for _, rule := range rules {
+				rule.HTTP.Paths = append(rule.HTTP.Paths, challengePaths[rule.Host]...)
 			}
 
-			ingress.Spec.Rules = append(r.getMemoizedIngress().Rules, rules...)
+			ingress.Spec.Rules = append(ingress.Spec.Rules, rules...)
 
 			if internalHost.Spec.Routing.Scheme == "https" {
 				tlsSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeTLS })
@@ -1223,6 +1517,17 @@ func (r *KDexInternalHostReconciler) createOrUpdateIngress(
 				}
 			}
 
+			if profile == "" {
+				detected, err := r.detectIngressProfile(ctx, ingress.Spec.IngressClassName)
+				if err != nil {
+					return err
+				}
+				profile = detected
+			}
+			options.https = len(ingress.Spec.TLS) > 0
+			applyIngressProfile(ingress, internalHost, profile, options)
+			applyRoutingAnnotations(ingress, routing)
+
 			return ctrl.SetControllerReference(internalHost, ingress, r.Scheme)
 		},
 	)
@@ -1242,30 +1547,140 @@ func (r *KDexInternalHostReconciler) createOrUpdateIngress(
 		return controllerutil.OperationResultNone, err
 	}
 
-	if len(ingress.Status.LoadBalancer.Ingress) > 0 {
-		var addresses strings.Builder
-		separator := ""
-		for _, ing := range ingress.Status.LoadBalancer.Ingress {
-			if ing.IP != "" {
-				addresses.WriteString(separator + ing.IP)
-				separator = ","
-			} else if ing.Hostname != "" {
-				addresses.WriteString(separator + ing.Hostname)
-				separator = ","
-			}
-		}
-		internalHost.Status.Attributes["ingress"] = addresses.String()
+	edgeOp, err := r.createOrUpdateEdgeAuthIngress(ctx, internalHost, ingress, edgePaths, profile, options)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&internalHost.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+
+		return controllerutil.OperationResultNone, err
+	}
+	if op == controllerutil.OperationResultNone {
+		op = edgeOp
 	}
 
+	if addresses := ingressAddresses(ingress); len(addresses) > 0 {
+		internalHost.Status.Attributes["ingress"] = strings.Join(addresses, ",")
+	}
+	setIngressRoutable(internalHost, ingress)
+
 	return op, nil
 }
 
 func (r *KDexInternalHostReconciler) createOrUpdateHTTPRoute(
-	_ context.Context,
-	_ *kdexv1alpha1.KDexInternalHost,
-	_ []resolvedBackend,
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backends []resolvedBackend,
 ) (controllerutil.OperationResult, error) {
-	return controllerutil.OperationResultNone, nil
+	options, err := parseGatewayOptions(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	parents, err := r.httpRouteParents(internalHost, options)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	edge, err := parseEdgeAuth(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	routing, err := parseRoutingAnnotations(internalHost.Annotations)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	gatewayOp := controllerutil.OperationResultNone
+	if options.owned() {
+		gatewayOp, err = r.createOrUpdateGateway(ctx, internalHost, options)
+	} else {
+		err = r.deleteOwnedGateway(ctx, internalHost)
+	}
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      internalHost.Name,
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	op, err := ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		route,
+		func() error {
+			if route.CreationTimestamp.IsZero() {
+				route.Annotations = make(map[string]string)
+				maps.Copy(route.Annotations, internalHost.Annotations)
+				route.Labels = make(map[string]string)
+				maps.Copy(route.Labels, internalHost.Labels)
+
+				route.Labels["kdex.dev/httproute"] = route.Name
+			}
+
+			applyRoutingAnnotations(route, routing)
+
+			route.Spec.ParentRefs = parents
+
+			route.Spec.Hostnames = make([]gatewayv1.Hostname, 0, len(internalHost.Spec.Routing.Domains))
+			for _, domain := range internalHost.Spec.Routing.Domains {
+				route.Spec.Hostnames = append(route.Spec.Hostnames, gatewayv1.Hostname(domain))
+			}
+
+			rule := func(path string, service string, port int32) gatewayv1.HTTPRouteRule {
+				return gatewayv1.HTTPRouteRule{
+					BackendRefs: []gatewayv1.HTTPBackendRef{{
+						BackendRef: gatewayv1.BackendRef{
+							BackendObjectReference: gatewayv1.BackendObjectReference{
+								Name: gatewayv1.ObjectName(service),
+								Port: new(gatewayv1.PortNumber(port)),
+							},
+						},
+					}},
+					Matches: []gatewayv1.HTTPRouteMatch{{
+						Path: &gatewayv1.HTTPPathMatch{
+							Type:  new(gatewayv1.PathMatchPathPrefix),
+							Value: new(path),
+						},
+					}},
+				}
+			}
+
+			rules := []gatewayv1.HTTPRouteRule{rule("/", r.ServiceName, r.Port)}
+			backendPort := servicePort(r.getMemoizedService().Ports, "server", r.Port)
+			for _, rb := range backends {
+				if rb.Backend.IngressPath == "" {
+					continue
+				}
+				backendRule := rule(rb.Backend.IngressPath, fmt.Sprintf("%s-%s", internalHost.Name, rb.Name), backendPort)
+				if edge.protects(rb.Backend.IngressPath) {
+					backendRule.Filters = append(backendRule.Filters, r.edgeAuthFilter())
+				}
+				rules = append(rules, backendRule)
+			}
+
+			route.Spec.Rules = append(r.Configuration.BackendDefault.HttpRoute.DeepCopy().Rules, rules...)
+
+			return ctrl.SetControllerReference(internalHost, route, r.Scheme)
+		},
+	)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if op == controllerutil.OperationResultNone {
+		op = gatewayOp
+	}
+	return op, nil
 }
 
 func (r *KDexInternalHostReconciler) createOrUpdateBackendDeployment(
@@ -1273,6 +1688,9 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendDeployment(
 	internalHost *kdexv1alpha1.KDexInternalHost,
 	name string,
 	resolvedBackend resolvedBackend,
+	runtimeConfig *corev1.ConfigMap,
+	autoscaling *backendAutoscaling,
+	availability *backendAvailability,
 ) (controllerutil.OperationResult, *appsv1.Deployment, error) {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1281,6 +1699,16 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendDeployment(
 		},
 	}
 
+	backend := resolvedBackend.Backend.DeepCopy()
+	child.DefaultBackend(backend, &r.Configuration.BackendDefault)
+
+	stamp := map[string]string{
+		"kdex.dev/backend": resolvedBackend.Name,
+		"kdex.dev/host":    internalHost.Name,
+		"kdex.dev/kind":    resolvedBackend.Kind,
+		"kdex.dev/type":    internal.BACKEND,
+	}
+
 	op, err := ctrl.CreateOrUpdate(
 		ctx,
 		r.Client,
@@ -1292,132 +1720,31 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendDeployment(
 				deployment.Labels = make(map[string]string)
 				maps.Copy(deployment.Labels, internalHost.Labels)
 
-				deployment.Labels["kdex.dev/type"] = internal.BACKEND
-				deployment.Labels["kdex.dev/backend"] = resolvedBackend.Name
-				deployment.Labels["kdex.dev/host"] = internalHost.Name
-				deployment.Labels["kdex.dev/kind"] = resolvedBackend.Kind
+				deployment.Labels = child.StampLabels(deployment.Labels, stamp)
 
 				deployment.Spec = *r.getMemoizedBackendDeployment().DeepCopy()
 
-				deployment.Spec.Selector.MatchLabels["kdex.dev/type"] = internal.BACKEND
-				deployment.Spec.Selector.MatchLabels["kdex.dev/backend"] = resolvedBackend.Name
-				deployment.Spec.Selector.MatchLabels["kdex.dev/host"] = internalHost.Name
-				deployment.Spec.Selector.MatchLabels["kdex.dev/kind"] = resolvedBackend.Kind
-
-				deployment.Spec.Template.Labels["kdex.dev/type"] = internal.BACKEND
-				deployment.Spec.Template.Labels["kdex.dev/backend"] = resolvedBackend.Name
-				deployment.Spec.Template.Labels["kdex.dev/host"] = internalHost.Name
-				deployment.Spec.Template.Labels["kdex.dev/kind"] = resolvedBackend.Kind
-			}
-
-			deployment.Spec.Template.Spec.Containers[0].Name = "backend"
-
-			if len(resolvedBackend.Backend.Env) > 0 {
-				for _, env := range resolvedBackend.Backend.Env {
-					foundEnv := false
-					for idx, value := range deployment.Spec.Template.Spec.Containers[0].Env {
-						if value.Name == env.Name {
-							foundEnv = true
-							deployment.Spec.Template.Spec.Containers[0].Env[idx].Value = env.Value
-							break
-						}
-					}
-					if !foundEnv {
-						deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, env)
-					}
-				}
-			}
-
-			foundPathPrefixEnv := false
-			for idx, value := range deployment.Spec.Template.Spec.Containers[0].Env {
-				if value.Name == "PATH_PREFIX" {
-					foundPathPrefixEnv = true
-					deployment.Spec.Template.Spec.Containers[0].Env[idx].Value = resolvedBackend.Backend.IngressPath
-					break
-				}
-			}
-
-			if !foundPathPrefixEnv {
-				deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
-					Name:  "PATH_PREFIX",
-					Value: resolvedBackend.Backend.IngressPath,
-				})
-			}
-
-			imagePullSecrets := internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeDockerConfigJson })
-			if len(imagePullSecrets) > 0 {
-				for _, sec := range imagePullSecrets {
-					deployment.Spec.Template.Spec.ImagePullSecrets = append(
-						deployment.Spec.Template.Spec.ImagePullSecrets,
-						corev1.LocalObjectReference{
-							Name: sec.Name,
-						},
-					)
-				}
-			}
-
-			if resolvedBackend.Backend.Replicas != nil {
-				deployment.Spec.Replicas = resolvedBackend.Backend.Replicas
+				deployment.Spec.Selector.MatchLabels = child.StampLabels(deployment.Spec.Selector.MatchLabels, stamp)
+				deployment.Spec.Template.Labels = child.StampLabels(deployment.Spec.Template.Labels, stamp)
 			}
 
-			if resolvedBackend.Backend.Resources.Size() > 0 {
-				deployment.Spec.Template.Spec.Containers[0].Resources = resolvedBackend.Backend.Resources
-			}
-
-			if resolvedBackend.Backend.ServerImage != "" {
-				deployment.Spec.Template.Spec.Containers[0].Image = resolvedBackend.Backend.ServerImage
-			} else {
-				deployment.Spec.Template.Spec.Containers[0].Image = r.Configuration.BackendDefault.ServerImage
-			}
-
-			if resolvedBackend.Backend.ServerImagePullPolicy != "" {
-				deployment.Spec.Template.Spec.Containers[0].ImagePullPolicy = resolvedBackend.Backend.ServerImagePullPolicy
-			} else {
-				deployment.Spec.Template.Spec.Containers[0].ImagePullPolicy = r.Configuration.BackendDefault.ServerImagePullPolicy
+			if err := r.mutateBackendPodTemplate(
+				ctx,
+				internalHost,
+				resolvedBackend,
+				backend,
+				&deployment.Spec.Template,
+				deployment.Spec.Selector.MatchLabels,
+				runtimeConfig,
+				availability,
+				nil,
+			); err != nil {
+				return err
 			}
 
-			if resolvedBackend.Backend.StaticImage != "" {
-				foundOCIVolume := false
-				for idx, value := range deployment.Spec.Template.Spec.Volumes {
-					if value.Name == internal.OCI_IMAGE {
-						foundOCIVolume = true
-						deployment.Spec.Template.Spec.Volumes[idx].Image.Reference = resolvedBackend.Backend.StaticImage
-						deployment.Spec.Template.Spec.Volumes[idx].Image.PullPolicy = resolvedBackend.Backend.StaticImagePullPolicy
-						break
-					}
-				}
-
-				if !foundOCIVolume {
-					deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
-						Name: internal.OCI_IMAGE,
-						VolumeSource: corev1.VolumeSource{
-							Image: &corev1.ImageVolumeSource{
-								Reference:  resolvedBackend.Backend.StaticImage,
-								PullPolicy: resolvedBackend.Backend.StaticImagePullPolicy,
-							},
-						},
-					})
-				}
-
-				foundOCIVolumeMount := false
-				for idx, value := range deployment.Spec.Template.Spec.Containers[0].VolumeMounts {
-					if value.Name == internal.OCI_IMAGE {
-						foundOCIVolumeMount = true
-						deployment.Spec.Template.Spec.Containers[0].VolumeMounts[idx].MountPath = "/public"
-						deployment.Spec.Template.Spec.Containers[0].VolumeMounts[idx].Name = internal.OCI_IMAGE
-						deployment.Spec.Template.Spec.Containers[0].VolumeMounts[idx].ReadOnly = true
-						break
-					}
-				}
-
-				if !foundOCIVolumeMount {
-					deployment.Spec.Template.Spec.Containers[0].VolumeMounts = append(deployment.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
-						Name:      internal.OCI_IMAGE,
-						MountPath: "/public",
-						ReadOnly:  true,
-					})
-				}
-			}
+			deployment.Spec.Replicas = backendReplicas(
+				deployment.Spec.Replicas, !deployment.CreationTimestamp.IsZero(), backend, autoscaling,
+			)
 
 			return ctrl.SetControllerReference(internalHost, deployment, r.Scheme)
 		},
@@ -1441,11 +1768,114 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendDeployment(
 	return op, deployment, nil
 }
 
+// mutateBackendPodTemplate sets the pod template of the workload of the
+// backend, a Deployment or a StatefulSet, from the backend and the backend
+// defaults.
+func (r *KDexInternalHostReconciler) mutateBackendPodTemplate(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	resolvedBackend resolvedBackend,
+	backend *kdexv1alpha1.Backend,
+	template *corev1.PodTemplateSpec,
+	podLabels map[string]string,
+	runtimeConfig *corev1.ConfigMap,
+	availability *backendAvailability,
+	workload *backendWorkload,
+) error {
+	container := &template.Spec.Containers[0]
+	container.Name = "backend"
+
+	envFrom, err := parseBackendEnvFrom(resolvedBackend.Annotations)
+	if err != nil {
+		return err
+	}
+	if err := r.checkEnvReferences(ctx, internalHost.Namespace, backend.Env, envFrom); err != nil {
+		return err
+	}
+	applyBackendEnv(container, &r.getMemoizedBackendDeployment().Template.Spec.Containers[0], backend.Env, envFrom)
+	container.Env = child.SetEnv(
+		container.Env,
+		child.CORSDomains(internalHost.Spec.Routing.Domains),
+		corev1.EnvVar{
+			Name:  "PATH_PREFIX",
+			Value: backend.IngressPath,
+		},
+	)
+
+	child.AddImagePullSecrets(
+		&template.Spec,
+		internalHost.Spec.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool { return s.Type == corev1.SecretTypeDockerConfigJson })...,
+	)
+
+	applyBackendAvailability(
+		&template.Spec,
+		&r.getMemoizedBackendDeployment().Template.Spec,
+		availability,
+		podLabels,
+	)
+
+	if backend.Resources.Size() > 0 {
+		container.Resources = backend.Resources
+	}
+
+	if err := applyBackendProbes(
+		container,
+		&r.getMemoizedBackendDeployment().Template.Spec.Containers[0],
+		resolvedBackend.Annotations,
+	); err != nil {
+		return err
+	}
+
+	if backend.ServerImage != "" {
+		container.Image = backend.ServerImage
+	} else {
+		container.Image = r.Configuration.BackendDefault.ServerImage
+	}
+
+	container.ImagePullPolicy = backend.ServerImagePullPolicy
+
+	if backend.StaticImage != "" {
+		child.SetImageVolume(
+			&template.Spec,
+			container,
+			internal.OCI_IMAGE,
+			backend.StaticImage,
+			backend.StaticImagePullPolicy,
+			"/public",
+		)
+	}
+
+	child.SetRuntimeConfig(
+		template,
+		container,
+		runtimeConfig,
+		resolvedBackend.Annotations[backendRuntimeEnvAnnotation] == "true",
+	)
+
+	if workload != nil {
+		setVolumeMounts(container, workload.VolumeMounts)
+	}
+
+	checksum, err := PodConfigChecksum(&template.Spec)
+	if err != nil {
+		return err
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[configChecksumAnnotation] = checksum
+
+	return nil
+}
+
+// createOrUpdateBackendService maintains the Service of the backend, or
+// deletes it when the backend runs in a CronJob, serving no requests.
 func (r *KDexInternalHostReconciler) createOrUpdateBackendService(
 	ctx context.Context,
 	internalHost *kdexv1alpha1.KDexInternalHost,
 	name string,
 	resolvedBackend resolvedBackend,
+	workload *backendWorkload,
 ) (controllerutil.OperationResult, error) {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1454,6 +1884,13 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendService(
 		},
 	}
 
+	if workload.scheduled() {
+		if err := r.Delete(ctx, service); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
 	op, err := ctrl.CreateOrUpdate(
 		ctx,
 		r.Client,
@@ -1480,6 +1917,9 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendService(
 				service.Spec.Selector["kdex.dev/kind"] = resolvedBackend.Kind
 			}
 
+			// Only ready pods may receive traffic
+			service.Spec.PublishNotReadyAddresses = false
+
 			return ctrl.SetControllerReference(internalHost, service, r.Scheme)
 		},
 	)
@@ -1502,11 +1942,15 @@ func (r *KDexInternalHostReconciler) createOrUpdateBackendService(
 	return op, nil
 }
 
+// cleanupObsoleteBackends deletes the objects of the backends no longer
+// required by the host. Their workloads and Services are deleted once the
+// grace period elapsed, it returns the time left until the next one is due.
 func (r *KDexInternalHostReconciler) cleanupObsoleteBackends(
 	ctx context.Context,
 	internalHost *kdexv1alpha1.KDexInternalHost,
 	backends []resolvedBackend,
-) error {
+	grace time.Duration,
+) (time.Duration, error) {
 	backendNames := make(map[string]bool)
 	for _, rb := range backends {
 		name := fmt.Sprintf("%s-%s", internalHost.Name, rb.Name)
@@ -1521,31 +1965,87 @@ func (r *KDexInternalHostReconciler) cleanupObsoleteBackends(
 	// Cleanup Deployments
 	deploymentList := &appsv1.DeploymentList{}
 	if err := r.List(ctx, deploymentList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
-		return err
+		return 0, err
 	}
 
+	var next time.Duration
 	for _, deployment := range deploymentList.Items {
-		if !backendNames[deployment.Name] {
-			if err := r.Delete(ctx, &deployment); err != nil {
-				return err
+		if backendNames[deployment.Name] {
+			if err := r.reviveRequired(ctx, &deployment); err != nil {
+				return 0, err
 			}
-			delete(internalHost.Status.Attributes, deployment.Name+".deployment")
+			continue
 		}
+
+		due, left, err := r.retireObsolete(ctx, internalHost, &deployment, "Deployment", grace)
+		if err != nil {
+			return 0, err
+		}
+		next = nextRetirement(next, left)
+		if !due {
+			continue
+		}
+
+		if err := r.Delete(ctx, &deployment); err != nil {
+			return 0, err
+		}
+		r.recordBackendDeleted(internalHost, &deployment, "Deployment")
+		delete(internalHost.Status.Attributes, deployment.Name+".deployment")
+		delete(internalHost.Status.Attributes, deployment.Name+".replicas")
+	}
+
+	left, err := r.cleanupObsoleteStatefulSets(ctx, internalHost, backendNames, labelSelector, grace)
+	if err != nil {
+		return 0, err
+	}
+	next = nextRetirement(next, left)
+
+	left, err = r.cleanupObsoleteCronJobs(ctx, internalHost, backendNames, labelSelector, grace)
+	if err != nil {
+		return 0, err
+	}
+	next = nextRetirement(next, left)
+
+	if err := r.cleanupObsoleteAutoscalers(ctx, internalHost, backendNames, labelSelector); err != nil {
+		return 0, err
+	}
+
+	if err := r.cleanupObsoleteDisruptionBudgets(ctx, internalHost, backendNames, labelSelector); err != nil {
+		return 0, err
+	}
+
+	if err := r.cleanupObsoleteNetworkPolicies(ctx, internalHost, backendNames, labelSelector); err != nil {
+		return 0, err
 	}
 
 	// Cleanup Services
 	serviceList := &corev1.ServiceList{}
 	if err := r.List(ctx, serviceList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
-		return err
+		return 0, err
 	}
 
 	for _, service := range serviceList.Items {
-		if !backendNames[service.Name] {
-			if err := r.Delete(ctx, &service); err != nil {
-				return err
+		if backendNames[strings.TrimSuffix(service.Name, headlessServiceSuffix)] {
+			if err := r.reviveRequired(ctx, &service); err != nil {
+				return 0, err
 			}
+			continue
+		}
+
+		due, left, err := r.retireObsolete(ctx, internalHost, &service, "Service", grace)
+		if err != nil {
+			return 0, err
+		}
+		next = nextRetirement(next, left)
+		if !due {
+			continue
 		}
+
+		if err := r.Delete(ctx, &service); err != nil {
+			return 0, err
+		}
+		r.recordBackendDeleted(internalHost, &service, "Service")
 	}
 
-	return nil
+	return next, nil
 }
@@ -18,12 +18,48 @@ package controller
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/host"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/themebuild"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 var _ = Describe("KDexInternalHost Controller", func() {
@@ -78,3 +114,1691 @@ var _ = Describe("KDexInternalHost Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("Backend probes", func() {
+	defaults := &corev1.Container{
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("server")},
+			},
+		},
+	}
+
+	It("falls back to the default probes", func() {
+		container := &corev1.Container{}
+		Expect(applyBackendProbes(container, defaults, nil)).To(Succeed())
+		Expect(container.LivenessProbe).To(Equal(defaults.LivenessProbe))
+		Expect(container.ReadinessProbe).To(BeNil())
+		Expect(container.StartupProbe).To(BeNil())
+	})
+
+	It("applies path and JSON probes", func() {
+		container := &corev1.Container{}
+		Expect(applyBackendProbes(container, defaults, map[string]string{
+			backendReadinessProbeAnnotation: "/ready",
+			backendStartupProbeAnnotation:   `{"httpGet":{"path":"/started","port":8080},"failureThreshold":30,"periodSeconds":2}`,
+		})).To(Succeed())
+
+		Expect(container.LivenessProbe).To(Equal(defaults.LivenessProbe))
+		Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal("/ready"))
+		Expect(container.ReadinessProbe.HTTPGet.Port).To(Equal(intstr.FromString("server")))
+		Expect(container.StartupProbe.HTTPGet.Path).To(Equal("/started"))
+		Expect(container.StartupProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(8080)))
+		Expect(container.StartupProbe.FailureThreshold).To(Equal(int32(30)))
+		Expect(container.StartupProbe.PeriodSeconds).To(Equal(int32(2)))
+	})
+
+	It("rejects probes without a handler", func() {
+		container := &corev1.Container{}
+		Expect(applyBackendProbes(container, defaults, map[string]string{
+			backendLivenessProbeAnnotation: `{"periodSeconds":5}`,
+		})).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Backend env", func() {
+	It("parses the env sources of a backend", func() {
+		envFrom, err := parseBackendEnvFrom(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envFrom).To(BeNil())
+
+		envFrom, err = parseBackendEnvFrom(map[string]string{
+			backendEnvFromAnnotation: `[{"secretRef": {"name": "orders-db"}}, {"configMapRef": {"name": "orders"}, "prefix": "ORDERS_"}]`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envFrom).To(HaveLen(2))
+		Expect(envFrom[1].Prefix).To(Equal("ORDERS_"))
+
+		for _, value := range []string{
+			`[{}]`,
+			`[{"secretRef": {"name": "a"}, "configMapRef": {"name": "b"}}]`,
+			`{"secretRef": {"name": "a"}}`,
+		} {
+			_, err = parseBackendEnvFrom(map[string]string{backendEnvFromAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("replaces the env of the backend container", func() {
+		defaults := &corev1.Container{
+			Env:     []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}},
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "common"}}}},
+		}
+		container := &corev1.Container{
+			Env: []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}, {Name: "REMOVED", Value: "x"}},
+		}
+		envFrom := []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "orders-db"}}}}
+
+		applyBackendEnv(container, defaults, []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}, envFrom)
+		Expect(container.Env).To(Equal([]corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}))
+		Expect(container.EnvFrom).To(HaveLen(2))
+		Expect(container.EnvFrom[1].SecretRef.Name).To(Equal("orders-db"))
+		Expect(defaults.Env[0].Value).To(Equal("info"))
+	})
+
+	It("requires the ConfigMaps and the Secrets the env of a backend refers to", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "orders-db", Namespace: "default"},
+			}).Build(),
+			Scheme: s,
+		}
+		secretRef := func(name string, optional *bool) corev1.EnvFromSource {
+			return corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Optional:             optional,
+			}}
+		}
+
+		Expect(r.checkEnvReferences(context.Background(), "default", nil, []corev1.EnvFromSource{secretRef("orders-db", nil)})).To(Succeed())
+		Expect(r.checkEnvReferences(context.Background(), "default", nil, []corev1.EnvFromSource{secretRef("missing", new(true))})).To(Succeed())
+		Expect(r.checkEnvReferences(context.Background(), "default", nil, []corev1.EnvFromSource{secretRef("missing", nil)})).To(
+			MatchError(ContainSubstring("missing Secret missing")),
+		)
+
+		err := r.checkEnvReferences(context.Background(), "default", []corev1.EnvVar{{
+			Name: "ORDERS_URL",
+			ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "orders"},
+				Key:                  "url",
+			}},
+		}}, nil)
+		Expect(err).To(MatchError(ContainSubstring("missing ConfigMap orders")))
+	})
+})
+
+var _ = Describe("Pod config checksum", func() {
+	spec := func() *corev1.PodSpec {
+		return &corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Env:   []corev1.EnvVar{{Name: "CORS_DOMAINS", Value: "foo.bar"}},
+				Image: "server:1",
+				Name:  "backend",
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "oci-image",
+				VolumeSource: corev1.VolumeSource{
+					Image: &corev1.ImageVolumeSource{Reference: "static:1"},
+				},
+			}},
+		}
+	}
+
+	It("is stable", func() {
+		a, err := PodConfigChecksum(spec())
+		Expect(err).NotTo(HaveOccurred())
+		b, err := PodConfigChecksum(spec())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a).To(Equal(b))
+	})
+
+	It("changes with env, images and volumes", func() {
+		base, err := PodConfigChecksum(spec())
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, mutate := range []func(*corev1.PodSpec){
+			func(s *corev1.PodSpec) { s.Containers[0].Env[0].Value = "baz.bar" },
+			func(s *corev1.PodSpec) { s.Containers[0].Image = "server:2" },
+			func(s *corev1.PodSpec) { s.Volumes[0].Image.Reference = "static:2" },
+		} {
+			changed := spec()
+			mutate(changed)
+			checksum, err := PodConfigChecksum(changed)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checksum).NotTo(Equal(base))
+		}
+	})
+
+	It("ignores unrelated fields", func() {
+		base, err := PodConfigChecksum(spec())
+		Expect(err).NotTo(HaveOccurred())
+
+		changed := spec()
+		changed.Containers[0].ReadinessProbe = &corev1.Probe{}
+		checksum, err := PodConfigChecksum(changed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checksum).To(Equal(base))
+	})
+})
+
+var _ = Describe("Backend rollouts", func() {
+	deployment := func(status appsv1.DeploymentStatus) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "host-backend", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: new(int32(2))},
+			Status:     status,
+		}
+	}
+
+	complete := appsv1.DeploymentStatus{
+		AvailableReplicas:  2,
+		ObservedGeneration: 2,
+		ReadyReplicas:      2,
+		Replicas:           2,
+		UpdatedReplicas:    2,
+	}
+
+	It("is ready once every replica is updated and available", func() {
+		rollout := deploymentRollout(deployment(complete), nil)
+		Expect(rollout.State).To(Equal(rolloutReady))
+		Expect(rollout.Ready).To(Equal(int32(2)))
+		Expect(rollout.Desired).To(Equal(int32(2)))
+	})
+
+	It("is progressing while replicas are missing", func() {
+		status := complete
+		status.AvailableReplicas = 1
+		status.ReadyReplicas = 1
+		rollout := deploymentRollout(deployment(status), nil)
+		Expect(rollout.State).To(Equal(rolloutProgressing))
+		Expect(rollout.Message).To(Equal("1 of 2 replicas available"))
+
+		status = complete
+		status.ObservedGeneration = 1
+		Expect(deploymentRollout(deployment(status), nil).State).To(Equal(rolloutProgressing))
+
+		status = complete
+		status.Replicas = 3
+		Expect(deploymentRollout(deployment(status), nil).State).To(Equal(rolloutProgressing))
+	})
+
+	It("fails when the progress deadline is exceeded", func() {
+		status := complete
+		status.UpdatedReplicas = 1
+		status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "ReplicaSet has timed out progressing.",
+		}}
+		rollout := deploymentRollout(deployment(status), nil)
+		Expect(rollout.State).To(Equal(rolloutFailed))
+		Expect(rollout.Message).To(Equal("ReplicaSet has timed out progressing."))
+	})
+
+	It("fails when pods are crash looping", func() {
+		status := complete
+		status.ReadyReplicas = 1
+		pods := []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "host-backend-abc"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "backend",
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+				}},
+			},
+		}}
+		rollout := deploymentRollout(deployment(status), pods)
+		Expect(rollout.State).To(Equal(rolloutFailed))
+		Expect(rollout.Message).To(Equal("container backend of pod host-backend-abc is in CrashLoopBackOff"))
+	})
+
+	It("rolls the backends up in the status of the host", func() {
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+
+		failed, progressing := rollupBackends(internalHost, []backendRollout{
+			{Desired: 1, Name: "host-web", Ready: 1, State: rolloutReady},
+			{Desired: 2, Message: "1 of 2 replicas available", Name: "host-api", Ready: 1, State: rolloutProgressing},
+		})
+		Expect(failed).To(BeEmpty())
+		Expect(progressing).To(Equal([]string{"deployment/host-api: 1 of 2 replicas available"}))
+		Expect(internalHost.Status.Attributes).To(HaveKeyWithValue("host-api.replicas", "1/2"))
+		Expect(internalHost.Status.Attributes[backendsAttribute]).To(MatchJSON(`[
+			{"desired": 2, "message": "1 of 2 replicas available", "name": "host-api", "ready": 1, "state": "progressing"},
+			{"desired": 1, "name": "host-web", "ready": 1, "state": "ready"}
+		]`))
+		condition := meta.FindStatusCondition(internalHost.Status.Conditions, backendsAvailableCondition)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(reasonBackendsProgressing))
+
+		rollupBackends(internalHost, []backendRollout{
+			{Desired: 1, Name: "host-web", Ready: 1, State: rolloutReady},
+		})
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, backendsAvailableCondition)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Theme builds", func() {
+	It("serves the compiled image of themes with sources", func() {
+		theme := &kdexv1alpha1.KDexTheme{}
+		theme.Spec.StaticImage = "registry/brand:1"
+		theme.Status.Attributes = map[string]string{themebuild.ImageAttribute: "registry/shop-theme-brand:abc@sha256:fff"}
+
+		applyThemeBuild(theme)
+		Expect(theme.Spec.StaticImage).To(Equal("registry/brand:1"))
+
+		theme.Annotations = map[string]string{themebuild.SourcesAnnotation: "brand-scss"}
+		applyThemeBuild(theme)
+		Expect(theme.Spec.StaticImage).To(Equal("registry/shop-theme-brand:abc@sha256:fff"))
+	})
+
+	It("waits for the first build of themes with sources", func() {
+		theme := &kdexv1alpha1.KDexTheme{}
+		theme.Annotations = map[string]string{themebuild.SourcesAnnotation: "brand-scss"}
+
+		applyThemeBuild(theme)
+		Expect(theme.Spec.StaticImage).To(BeEmpty())
+	})
+
+	It("preloads the fonts of compiled themes", func() {
+		theme := &kdexv1alpha1.KDexTheme{}
+		theme.Annotations = map[string]string{themebuild.SourcesAnnotation: "brand-scss"}
+		theme.Spec.IngressPath = "/theme"
+		theme.Spec.Assets = kdexv1alpha1.Assets{{LinkHref: "/theme/main.css", Attributes: map[string]string{"rel": "stylesheet"}}}
+		theme.Status.Attributes = map[string]string{
+			themebuild.ImageAttribute:   "registry/shop-theme-brand:abc@sha256:fff",
+			themebuild.PreloadAttribute: "fonts/inter-400-normal.woff2,fonts/inter-700-normal.woff2",
+		}
+
+		applyThemeBuild(theme)
+		Expect(theme.Spec.Assets).To(HaveLen(3))
+		Expect(theme.Spec.Assets[0].LinkHref).To(Equal("/theme/fonts/inter-400-normal.woff2"))
+		Expect(theme.Spec.Assets[0].Attributes).To(HaveKeyWithValue("rel", "preload"))
+		Expect(theme.Spec.Assets[0].Attributes).To(HaveKeyWithValue("as", "font"))
+		Expect(theme.Spec.Assets[2].LinkHref).To(Equal("/theme/main.css"))
+	})
+})
+
+var _ = Describe("Ready transition events", func() {
+	failed := func(message string) []metav1.Condition {
+		conditions := []metav1.Condition{}
+		kdexv1alpha1.SetConditions(
+			&conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			message,
+		)
+		return conditions
+	}
+	ready := func() []metav1.Condition {
+		conditions := []metav1.Condition{}
+		kdexv1alpha1.SetConditions(
+			&conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionTrue,
+			},
+			kdexv1alpha1.ConditionReasonReconcileSuccess,
+			"Reconciliation successful",
+		)
+		return conditions
+	}
+	host := &kdexv1alpha1.KDexInternalHost{}
+
+	It("records a failure once", func() {
+		recorder := events.NewFakeRecorder(10)
+		recordReadyTransition(recorder, host, metav1.Condition{}, failed("duplicated path /"), EventReasonPathConflict)
+		Expect(recorder.Events).To(Receive(Equal("Warning PathConflict duplicated path /")))
+
+		recordReadyTransition(recorder, host, readyCondition(failed("duplicated path /")), failed("duplicated path /"), EventReasonPathConflict)
+		Expect(recorder.Events).NotTo(Receive())
+
+		recordReadyTransition(recorder, host, readyCondition(failed("duplicated path /")), failed("no domains"), "")
+		Expect(recorder.Events).To(Receive(Equal("Warning ReconcileFailed no domains")))
+	})
+
+	It("records becoming ready", func() {
+		recorder := events.NewFakeRecorder(10)
+		recordReadyTransition(recorder, host, readyCondition(failed("no domains")), ready(), "")
+		Expect(recorder.Events).To(Receive(Equal("Normal Ready Reconciliation successful")))
+
+		recordReadyTransition(recorder, host, readyCondition(ready()), ready(), "")
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
+
+var _ = Describe("ACME challenge paths", func() {
+	path := func(p string, service string) networkingv1.HTTPIngressPath {
+		return networkingv1.HTTPIngressPath{
+			Path: p,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: service,
+					Port: networkingv1.ServiceBackendPort{Number: 8089},
+				},
+			},
+		}
+	}
+	r := &KDexInternalHostReconciler{ServiceName: "kdex-web"}
+
+	It("keeps the challenge paths of the solvers only", func() {
+		paths := r.acmeChallengePaths([]networkingv1.IngressRule{
+			{
+				Host: "shop.example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							path("/", "kdex-web"),
+							path("/.well-known/acme-challenge/abc", "cm-acme-http-solver-x1"),
+							path("/.well-known/acme-challenge/def", "kdex-web"),
+						},
+					},
+				},
+			},
+			{Host: "empty.example.com"},
+		})
+		Expect(paths).To(HaveLen(1))
+		Expect(paths["shop.example.com"]).To(Equal([]networkingv1.HTTPIngressPath{
+			path("/.well-known/acme-challenge/abc", "cm-acme-http-solver-x1"),
+		}))
+	})
+})
+
+var _ = Describe("Routable condition", func() {
+	newHost := func() *kdexv1alpha1.KDexInternalHost {
+		return &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					Routing: kdexv1alpha1.Routing{Domains: []string{"shop.example.com"}, Scheme: "https"},
+				},
+			},
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+	}
+
+	It("waits for the load balancer address of the ingress", func() {
+		internalHost := newHost()
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}
+
+		setIngressRoutable(internalHost, ingress)
+		Expect(meta.IsStatusConditionFalse(internalHost.Status.Conditions, routableCondition)).To(BeTrue())
+		Expect(internalHost.Status.Attributes).NotTo(HaveKey(urlsAttribute))
+
+		ingress.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}, {Hostname: "lb.example.com"}}
+		setIngressRoutable(internalHost, ingress)
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, routableCondition)).To(BeTrue())
+		Expect(internalHost.Status.Attributes).To(HaveKeyWithValue(addressesAttribute, "10.0.0.1,lb.example.com"))
+		Expect(internalHost.Status.Attributes).To(HaveKeyWithValue(urlsAttribute, "https://shop.example.com"))
+	})
+
+	It("aggregates the acceptance of the HTTPRoute by its gateways", func() {
+		s := runtime.NewScheme()
+		Expect(gatewayv1.Install(s)).To(Succeed())
+		route := &gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+				},
+			},
+			Status: gatewayv1.HTTPRouteStatus{
+				RouteStatus: gatewayv1.RouteStatus{
+					Parents: []gatewayv1.RouteParentStatus{{
+						ParentRef: gatewayv1.ParentReference{Name: "public"},
+						Conditions: []metav1.Condition{{
+							Type:   string(gatewayv1.RouteConditionAccepted),
+							Status: metav1.ConditionFalse,
+							Reason: "NotAllowedByListeners",
+						}},
+					}},
+				},
+			},
+		}
+		gateway := &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "default"},
+			Status: gatewayv1.GatewayStatus{
+				Addresses: []gatewayv1.GatewayStatusAddress{{Value: "203.0.113.7"}},
+			},
+		}
+
+		internalHost := newHost()
+		r := &KDexInternalHostReconciler{Client: fake.NewClientBuilder().WithScheme(s).Build()}
+		Expect(r.setHTTPRouteRoutable(context.Background(), internalHost)).To(Succeed())
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, routableCondition).Reason).To(Equal(reasonRouteNotFound))
+
+		r.Client = fake.NewClientBuilder().WithScheme(s).WithObjects(route.DeepCopy(), gateway).Build()
+		Expect(r.setHTTPRouteRoutable(context.Background(), internalHost)).To(Succeed())
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, routableCondition).Reason).To(Equal(reasonRouteNotAccepted))
+
+		route.Status.Parents[0].Conditions[0].Status = metav1.ConditionTrue
+		r.Client = fake.NewClientBuilder().WithScheme(s).WithObjects(route, gateway).Build()
+		Expect(r.setHTTPRouteRoutable(context.Background(), internalHost)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, routableCondition)).To(BeTrue())
+		Expect(internalHost.Status.Attributes).To(HaveKeyWithValue(addressesAttribute, "203.0.113.7"))
+		Expect(internalHost.Status.Attributes).To(HaveKeyWithValue(urlsAttribute, "https://shop.example.com"))
+	})
+})
+
+var _ = Describe("Ingress convergence", func() {
+	It("corrects the edits of the Ingress and propagates the changes of the host", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client:      fake.NewClientBuilder().WithScheme(s).Build(),
+			Scheme:      s,
+			ServiceName: "kdex-web",
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "shop",
+				Namespace:   "default",
+				Annotations: map[string]string{ingressProfileAnnotation: ingressProfileNone},
+				UID:         "shop-uid",
+			},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					Routing: kdexv1alpha1.Routing{
+						Domains:          []string{"shop.example.com"},
+						IngressClassName: new("public"),
+						Scheme:           "http",
+					},
+				},
+			},
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+		key := types.NamespacedName{Name: "shop", Namespace: "default"}
+
+		_, err := r.createOrUpdateIngress(context.Background(), internalHost, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		ingress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), key, ingress)).To(Succeed())
+		ingress.Spec.DefaultBackend.Service.Name = "edited"
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{Host: "rogue.example.com"})
+		delete(ingress.Labels, "kdex.dev/ingress")
+		// The fake client does not set the creation timestamp.
+		ingress.CreationTimestamp = metav1.Now()
+		Expect(r.Update(context.Background(), ingress)).To(Succeed())
+
+		r.ServiceName = "kdex-web-v2"
+		internalHost.Spec.Routing.IngressClassName = new("internal")
+		_, err = r.createOrUpdateIngress(context.Background(), internalHost, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.Get(context.Background(), key, ingress)).To(Succeed())
+		Expect(ingress.Labels).To(HaveKeyWithValue("kdex.dev/ingress", "shop"))
+		Expect(ingress.Spec.IngressClassName).To(Equal(new("internal")))
+		Expect(ingress.Spec.DefaultBackend.Service.Name).To(Equal("kdex-web-v2"))
+		Expect(ingress.Spec.Rules).To(HaveLen(1))
+		Expect(ingress.Spec.Rules[0].Host).To(Equal("shop.example.com"))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal("kdex-web-v2"))
+	})
+})
+
+var _ = Describe("Ingress profiles", func() {
+	It("parses the profile and the options of the host", func() {
+		profile, options, err := parseIngressProfile(map[string]string{
+			ingressProfileAnnotation:     "nginx",
+			ingressMaxBodySizeAnnotation: "16Mi",
+			ingressTimeoutAnnotation:     "90s",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profile).To(Equal("nginx"))
+		Expect(options).To(Equal(ingressOptions{maxBodySize: 16 << 20, timeout: 90 * time.Second}))
+
+		_, _, err = parseIngressProfile(map[string]string{ingressProfileAnnotation: "istio"})
+		Expect(err).To(HaveOccurred())
+		_, _, err = parseIngressProfile(map[string]string{ingressTimeoutAnnotation: "-1s"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("detects the profile of the ingress class", func() {
+		s := runtime.NewScheme()
+		Expect(networkingv1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{Client: fake.NewClientBuilder().WithScheme(s).WithObjects(
+			&networkingv1.IngressClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "public", Annotations: map[string]string{defaultIngressClassAnnotation: "true"}},
+				Spec:       networkingv1.IngressClassSpec{Controller: "traefik.io/ingress-controller"},
+			},
+			&networkingv1.IngressClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal"},
+				Spec:       networkingv1.IngressClassSpec{Controller: "k8s.io/ingress-nginx"},
+			},
+		).Build()}
+
+		Expect(r.detectIngressProfile(context.Background(), new("internal"))).To(Equal("nginx"))
+		Expect(r.detectIngressProfile(context.Background(), nil)).To(Equal("traefik"))
+		Expect(r.detectIngressProfile(context.Background(), new("missing"))).To(BeEmpty())
+	})
+
+	It("replaces the annotations of the previous profile but not those of the host", func() {
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "1m"}},
+		}
+		ingress := &networkingv1.Ingress{}
+		options := ingressOptions{https: true, maxBodySize: 1 << 20, timeout: 2 * time.Minute}
+
+		applyIngressProfile(ingress, internalHost, "alb", options)
+		Expect(ingress.Annotations).To(HaveKeyWithValue("alb.ingress.kubernetes.io/ssl-redirect", "443"))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("alb.ingress.kubernetes.io/load-balancer-attributes", "idle_timeout.timeout_seconds=120"))
+
+		ingress.Annotations["nginx.ingress.kubernetes.io/proxy-body-size"] = "1m"
+		applyIngressProfile(ingress, internalHost, "nginx", options)
+		Expect(ingress.Annotations).To(Equal(map[string]string{
+			"nginx.ingress.kubernetes.io/proxy-body-size":    "1m",
+			"nginx.ingress.kubernetes.io/proxy-read-timeout": "120",
+			"nginx.ingress.kubernetes.io/proxy-send-timeout": "120",
+			"nginx.ingress.kubernetes.io/ssl-redirect":       "true",
+		}))
+
+		applyIngressProfile(ingress, internalHost, ingressProfileNone, options)
+		Expect(ingress.Annotations).To(Equal(map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "1m"}))
+	})
+
+	It("passes the routing annotations of the host through", func() {
+		routing, err := parseRoutingAnnotations(map[string]string{
+			routingAnnotationsAnnotation: `{"nginx.ingress.kubernetes.io/limit-rps": "10", "external-dns.alpha.kubernetes.io/ttl": "60"}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = parseRoutingAnnotations(map[string]string{routingAnnotationsAnnotation: `{"kdex.dev/host": "shop"}`})
+		Expect(err).To(HaveOccurred())
+		_, err = parseRoutingAnnotations(map[string]string{routingAnnotationsAnnotation: `{"not a key": "x"}`})
+		Expect(err).To(HaveOccurred())
+
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"kdex.dev/host": "shop"}},
+		}
+		applyRoutingAnnotations(ingress, routing)
+		Expect(ingress.Annotations).To(Equal(map[string]string{
+			"kdex.dev/host":                         "shop",
+			"nginx.ingress.kubernetes.io/limit-rps": "10",
+			"external-dns.alpha.kubernetes.io/ttl":  "60",
+			appliedRoutingAnnotationsAnnotation:     "external-dns.alpha.kubernetes.io/ttl,nginx.ingress.kubernetes.io/limit-rps",
+		}))
+
+		applyRoutingAnnotations(ingress, map[string]string{"nginx.ingress.kubernetes.io/limit-rps": "20"})
+		Expect(ingress.Annotations).To(Equal(map[string]string{
+			"kdex.dev/host":                         "shop",
+			"nginx.ingress.kubernetes.io/limit-rps": "20",
+			appliedRoutingAnnotationsAnnotation:     "nginx.ingress.kubernetes.io/limit-rps",
+		}))
+
+		applyRoutingAnnotations(ingress, nil)
+		Expect(ingress.Annotations).To(Equal(map[string]string{"kdex.dev/host": "shop"}))
+	})
+})
+
+var _ = Describe("Gateways", func() {
+	newHost := func(annotations map[string]string) *kdexv1alpha1.KDexInternalHost {
+		return &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", Annotations: annotations, UID: "shop-uid"},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					Routing: kdexv1alpha1.Routing{
+						Domains:  []string{"shop.example.com"},
+						Scheme:   "https",
+						Strategy: kdexv1alpha1.HTTPRouteRoutingStrategy,
+					},
+					ServiceAccountSecrets: kdexv1alpha1.ServiceAccountSecrets{
+						{ObjectMeta: metav1.ObjectMeta{Name: "shop-tls"}, Type: corev1.SecretTypeTLS},
+					},
+				},
+			},
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+	}
+
+	It("parses the gateway of the host", func() {
+		options, err := parseGatewayOptions(map[string]string{gatewayAnnotation: "infra/public"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.owned()).To(BeFalse())
+		Expect(options.parent.Name).To(Equal(gatewayv1.ObjectName("public")))
+		Expect(*options.parent.Namespace).To(Equal(gatewayv1.Namespace("infra")))
+
+		options, err = parseGatewayOptions(map[string]string{gatewayClassAnnotation: "envoy"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.owned()).To(BeTrue())
+
+		_, err = parseGatewayOptions(map[string]string{gatewayAnnotation: "public", gatewayClassAnnotation: "envoy"})
+		Expect(err).To(HaveOccurred())
+		_, err = parseGatewayOptions(map[string]string{gatewayAnnotation: "/public"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("creates the gateway owned by the host and attaches its route to it", func() {
+		s := runtime.NewScheme()
+		Expect(gatewayv1.Install(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client:      fake.NewClientBuilder().WithScheme(s).Build(),
+			Port:        8090,
+			Scheme:      s,
+			ServiceName: "kdex-web",
+		}
+
+		internalHost := newHost(map[string]string{gatewayClassAnnotation: "envoy"})
+		_, err := r.createOrUpdateHTTPRoute(context.Background(), internalHost, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		gateway := &gatewayv1.Gateway{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop", Namespace: "default"}, gateway)).To(Succeed())
+		Expect(gateway.Spec.GatewayClassName).To(Equal(gatewayv1.ObjectName("envoy")))
+		Expect(gateway.Spec.Listeners).To(HaveLen(2))
+		Expect(gateway.Spec.Listeners[1].TLS.CertificateRefs[0].Name).To(Equal(gatewayv1.ObjectName("shop-tls")))
+
+		route := &gatewayv1.HTTPRoute{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop", Namespace: "default"}, route)).To(Succeed())
+		Expect(route.Spec.ParentRefs).To(Equal([]gatewayv1.ParentReference{{Name: "shop"}}))
+		Expect(route.Spec.Hostnames).To(Equal([]gatewayv1.Hostname{"shop.example.com"}))
+		Expect(route.Spec.Rules[0].BackendRefs[0].Name).To(Equal(gatewayv1.ObjectName("kdex-web")))
+		Expect(*route.Spec.Rules[0].BackendRefs[0].Port).To(Equal(gatewayv1.PortNumber(8090)))
+
+		internalHost.Annotations = map[string]string{gatewayAnnotation: "public"}
+		_, err = r.createOrUpdateHTTPRoute(context.Background(), internalHost, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop", Namespace: "default"}, gateway)).NotTo(Succeed())
+
+		internalHost.Annotations = nil
+		_, err = r.createOrUpdateHTTPRoute(context.Background(), internalHost, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("mirrors the conditions of the gateways", func() {
+		internalHost := newHost(nil)
+		gateway := &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", Generation: 2},
+			Status: gatewayv1.GatewayStatus{
+				Conditions: []metav1.Condition{
+					{Type: "Accepted", Status: metav1.ConditionTrue, Reason: "Accepted", ObservedGeneration: 2},
+					{Type: "Programmed", Status: metav1.ConditionFalse, Reason: "AddressNotAssigned", Message: "no address", ObservedGeneration: 2},
+				},
+			},
+		}
+
+		setGatewayConditions(internalHost, []*gatewayv1.Gateway{gateway}, nil)
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, gatewayAcceptedCondition)).To(BeTrue())
+		programmed := meta.FindStatusCondition(internalHost.Status.Conditions, gatewayProgrammedCondition)
+		Expect(programmed.Status).To(Equal(metav1.ConditionFalse))
+		Expect(programmed.Reason).To(Equal("AddressNotAssigned"))
+
+		gateway.Generation = 3
+		setGatewayConditions(internalHost, []*gatewayv1.Gateway{gateway}, nil)
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, gatewayAcceptedCondition).Status).To(Equal(metav1.ConditionUnknown))
+
+		setGatewayConditions(internalHost, nil, []string{"default/shop"})
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, gatewayAcceptedCondition).Reason).To(Equal(reasonGatewayNotFound))
+	})
+})
+
+var _ = Describe("Backend autoscaling", func() {
+	It("parses the autoscaling of a backend", func() {
+		autoscaling, err := parseBackendAutoscaling(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(autoscaling).To(BeNil())
+
+		autoscaling, err = parseBackendAutoscaling(map[string]string{
+			backendAutoscalingAnnotation: `{"minReplicas": 2, "maxReplicas": 10, "targetCPUUtilization": 70, "targetRequestsPerSecond": "100"}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		metrics := autoscaling.metrics()
+		Expect(metrics).To(HaveLen(2))
+		Expect(*metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(70)))
+		Expect(metrics[1].Pods.Metric.Name).To(Equal(defaultRequestsPerSecondMetric))
+		Expect(metrics[1].Pods.Target.AverageValue.String()).To(Equal("100"))
+
+		for _, value := range []string{
+			`{"maxReplicas": 10}`,
+			`{"minReplicas": 3, "maxReplicas": 2, "targetCPUUtilization": 70}`,
+			`{"minReplicas": 0, "maxReplicas": 2, "targetCPUUtilization": 70}`,
+			`{"maxReplicas": 2, "targetRequestsPerSecond": "0"}`,
+			`not json`,
+		} {
+			_, err = parseBackendAutoscaling(map[string]string{backendAutoscalingAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("maintains the autoscaler of the backend deployment", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).Build(),
+			Scheme: s,
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+		}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop-packages", Namespace: "default"},
+		}
+		backend := resolvedBackend{Kind: "KDexInternalPackageReferences", Name: "packages"}
+		autoscaling, err := parseBackendAutoscaling(map[string]string{
+			backendAutoscalingAnnotation: `{"maxReplicas": 4, "targetCPUUtilization": 80}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		op, err := r.createOrUpdateBackendAutoscaler(context.Background(), internalHost, deployment, backend, autoscaling)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-packages", Namespace: "default"}, hpa)).To(Succeed())
+		Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal("shop-packages"))
+		Expect(hpa.Spec.MaxReplicas).To(Equal(int32(4)))
+		Expect(hpa.Labels).To(HaveKeyWithValue("kdex.dev/host", "shop"))
+
+		_, err = r.createOrUpdateBackendAutoscaler(context.Background(), internalHost, deployment, backend, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-packages", Namespace: "default"}, hpa)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Backend availability", func() {
+	It("parses the availability of a backend", func() {
+		availability, err := parseBackendAvailability(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(availability).To(BeNil())
+
+		availability, err = parseBackendAvailability(map[string]string{
+			backendAvailabilityAnnotation: `{"minAvailable": "50%", "topologySpreadConstraints": [{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone"}]}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(availability.MinAvailable.String()).To(Equal("50%"))
+		Expect(availability.TopologySpreadConstraints).To(HaveLen(1))
+
+		for _, value := range []string{
+			`{"minAvailable": 1, "maxUnavailable": 1}`,
+			`{"topologySpreadConstraints": [{"maxSkew": 1}]}`,
+			`{"topologySpreadConstraints": [{"topologyKey": "kubernetes.io/hostname"}]}`,
+			`not json`,
+		} {
+			_, err = parseBackendAvailability(map[string]string{backendAvailabilityAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("falls back on the availability of the backend defaults", func() {
+		r := &KDexInternalHostReconciler{}
+		r.Configuration.BackendDefault.Deployment.Template.Annotations = map[string]string{
+			backendAvailabilityAnnotation: `{"maxUnavailable": 1}`,
+		}
+
+		availability, err := r.backendAvailability(resolvedBackend{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(availability.MaxUnavailable.IntValue()).To(Equal(1))
+
+		availability, err = r.backendAvailability(resolvedBackend{
+			Annotations: map[string]string{backendAvailabilityAnnotation: `{"minAvailable": 2}`},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(availability.MaxUnavailable).To(BeNil())
+		Expect(availability.MinAvailable.IntValue()).To(Equal(2))
+	})
+
+	It("spreads the pods of the backend deployment", func() {
+		defaults := &corev1.PodSpec{
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{MaxSkew: 2, TopologyKey: "kubernetes.io/hostname"}},
+		}
+		podLabels := map[string]string{"kdex.dev/backend": "orders"}
+
+		podSpec := &corev1.PodSpec{}
+		applyBackendAvailability(podSpec, defaults, nil, podLabels)
+		Expect(podSpec.TopologySpreadConstraints).To(Equal(defaults.TopologySpreadConstraints))
+
+		availability, err := parseBackendAvailability(map[string]string{
+			backendAvailabilityAnnotation: `{"topologySpreadConstraints": [{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone"}], "affinity": {"nodeAffinity": {}}}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		applyBackendAvailability(podSpec, defaults, availability, podLabels)
+		Expect(podSpec.Affinity.NodeAffinity).NotTo(BeNil())
+		Expect(podSpec.TopologySpreadConstraints).To(HaveLen(1))
+		constraint := podSpec.TopologySpreadConstraints[0]
+		Expect(constraint.TopologyKey).To(Equal("topology.kubernetes.io/zone"))
+		Expect(constraint.WhenUnsatisfiable).To(Equal(corev1.ScheduleAnyway))
+		Expect(constraint.LabelSelector.MatchLabels).To(Equal(podLabels))
+	})
+
+	It("maintains the disruption budget of the backend deployment", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).Build(),
+			Scheme: s,
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+		}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop-orders", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"kdex.dev/backend": "orders"}},
+			},
+		}
+		backend := resolvedBackend{Kind: "KDexApp", Name: "orders"}
+		availability, err := parseBackendAvailability(map[string]string{
+			backendAvailabilityAnnotation: `{"minAvailable": 1}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		op, err := r.createOrUpdateBackendDisruptionBudget(context.Background(), internalHost, deployment, backend, availability)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+
+		pdb := &policyv1.PodDisruptionBudget{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-orders", Namespace: "default"}, pdb)).To(Succeed())
+		Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(1))
+		Expect(pdb.Spec.Selector.MatchLabels).To(HaveKeyWithValue("kdex.dev/backend", "orders"))
+		Expect(pdb.Labels).To(HaveKeyWithValue("kdex.dev/host", "shop"))
+
+		Expect(r.cleanupObsoleteDisruptionBudgets(context.Background(), internalHost, map[string]bool{"shop-orders": true}, client.MatchingLabels{
+			"kdex.dev/host": "shop",
+		})).To(Succeed())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-orders", Namespace: "default"}, pdb)).To(Succeed())
+
+		_, err = r.createOrUpdateBackendDisruptionBudget(context.Background(), internalHost, deployment, backend, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-orders", Namespace: "default"}, pdb)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Backend network policies", func() {
+	It("parses the network policy of a host", func() {
+		policy, err := parseNetworkPolicy(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(BeNil())
+
+		policy, err = parseNetworkPolicy(map[string]string{
+			networkPolicyAnnotation: `{"ingressFrom": [{"namespaceSelector": {"matchLabels": {"kubernetes.io/metadata.name": "ingress-nginx"}}}]}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.IngressFrom).To(HaveLen(1))
+
+		policy, err = parseNetworkPolicy(map[string]string{networkPolicyAnnotation: `{}`})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.IngressFrom).To(BeEmpty())
+
+		for _, value := range []string{`{"ingressFrom": [{}]}`, `not json`} {
+			_, err = parseNetworkPolicy(map[string]string{networkPolicyAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("maintains the network policy of the backend deployment", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "kdex-web", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "kdex-web"}},
+			}).Build(),
+			ControllerNamespace: "default",
+			Scheme:              s,
+			ServiceName:         "kdex-web",
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+		}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop-packages", Namespace: "default"},
+		}
+		backend := resolvedBackend{Kind: "KDexInternalPackageReferences", Name: "packages"}
+		policy, err := parseNetworkPolicy(map[string]string{
+			networkPolicyAnnotation: `{"ingressFrom": [{"namespaceSelector": {"matchLabels": {"kubernetes.io/metadata.name": "ingress-nginx"}}}]}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		hostPeer, err := r.hostPeer(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hostPeer.PodSelector.MatchLabels).To(HaveKeyWithValue("app", "kdex-web"))
+
+		op, err := r.createOrUpdateBackendNetworkPolicy(context.Background(), internalHost, deployment, backend, policy, hostPeer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+
+		networkPolicy := &networkingv1.NetworkPolicy{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-packages", Namespace: "default"}, networkPolicy)).To(Succeed())
+		Expect(networkPolicy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{
+			"kdex.dev/backend": "packages",
+			"kdex.dev/host":    "shop",
+		}))
+		Expect(networkPolicy.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+		Expect(networkPolicy.Spec.Ingress).To(HaveLen(1))
+		Expect(networkPolicy.Spec.Ingress[0].From).To(HaveLen(2))
+		Expect(networkPolicy.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(HaveKeyWithValue("app", "kdex-web"))
+		Expect(networkPolicy.Spec.Ingress[0].From[1].NamespaceSelector.MatchLabels).To(HaveKeyWithValue(
+			"kubernetes.io/metadata.name", "ingress-nginx",
+		))
+
+		_, err = r.createOrUpdateBackendNetworkPolicy(context.Background(), internalHost, deployment, backend, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-packages", Namespace: "default"}, networkPolicy)).NotTo(Succeed())
+
+		r.ServiceName = "missing"
+		_, err = r.hostPeer(context.Background())
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Edge authentication", func() {
+	newReconciler := func() *KDexInternalHostReconciler {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(gatewayv1.Install(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		return &KDexInternalHostReconciler{
+			Client:      fake.NewClientBuilder().WithScheme(s).Build(),
+			Port:        8090,
+			Scheme:      s,
+			ServiceName: "kdex-web",
+		}
+	}
+	newHost := func(strategy kdexv1alpha1.RoutingStrategy, annotations map[string]string) *kdexv1alpha1.KDexInternalHost {
+		return &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", Annotations: annotations, UID: "shop-uid"},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					Routing: kdexv1alpha1.Routing{
+						Domains:  []string{"shop.example.com"},
+						Scheme:   "http",
+						Strategy: strategy,
+					},
+				},
+			},
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+	}
+	backends := []resolvedBackend{
+		{Name: "orders", Kind: "KDexApp", Backend: kdexv1alpha1.Backend{IngressPath: "/-/orders"}},
+		{Name: "catalog", Kind: "KDexApp", Backend: kdexv1alpha1.Backend{IngressPath: "/-/catalog"}},
+	}
+
+	It("parses the backends authorized at the edge", func() {
+		edge, err := parseEdgeAuth(map[string]string{edgeAuthAnnotation: "/-/orders, /-/billing"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edge.protects("/-/orders")).To(BeTrue())
+		Expect(edge.protects("/-/catalog")).To(BeFalse())
+
+		edge, err = parseEdgeAuth(map[string]string{edgeAuthAnnotation: "*"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edge.protects("/-/catalog")).To(BeTrue())
+
+		edge, err = parseEdgeAuth(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edge.protects("/-/orders")).To(BeFalse())
+
+		_, err = parseEdgeAuth(map[string]string{edgeAuthAnnotation: "/orders"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("routes the backends authorized at the edge through their own nginx Ingress", func() {
+		r := newReconciler()
+		internalHost := newHost(kdexv1alpha1.IngressRoutingStrategy, map[string]string{
+			ingressProfileAnnotation: "nginx",
+			edgeAuthAnnotation:       "/-/orders",
+		})
+		_, err := r.createOrUpdateIngress(context.Background(), internalHost, backends)
+		Expect(err).NotTo(HaveOccurred())
+
+		ingress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop", Namespace: "default"}, ingress)).To(Succeed())
+		paths := []string{}
+		for _, path := range ingress.Spec.Rules[len(ingress.Spec.Rules)-1].HTTP.Paths {
+			paths = append(paths, path.Path)
+		}
+		Expect(paths).To(Equal([]string{"/", "/-/catalog"}))
+
+		edgeIngress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-edge-auth", Namespace: "default"}, edgeIngress)).To(Succeed())
+		Expect(edgeIngress.Spec.Rules).To(HaveLen(1))
+		Expect(edgeIngress.Spec.Rules[0].HTTP.Paths).To(HaveLen(1))
+		Expect(edgeIngress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/-/orders"))
+		Expect(edgeIngress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal("shop-orders"))
+		Expect(edgeIngress.Annotations).To(HaveKeyWithValue(
+			"nginx.ingress.kubernetes.io/auth-url", "http://kdex-web.default.svc.cluster.local:8090/-/authz",
+		))
+
+		delete(internalHost.Annotations, edgeAuthAnnotation)
+		_, err = r.createOrUpdateIngress(context.Background(), internalHost, backends)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-edge-auth", Namespace: "default"}, edgeIngress)).NotTo(Succeed())
+
+		internalHost.Annotations = map[string]string{ingressProfileAnnotation: "haproxy", edgeAuthAnnotation: "*"}
+		_, err = r.createOrUpdateIngress(context.Background(), internalHost, backends)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("routes the backends authorized at the edge through a Traefik forwardAuth middleware", func() {
+		r := newReconciler()
+		internalHost := newHost(kdexv1alpha1.IngressRoutingStrategy, map[string]string{
+			ingressProfileAnnotation: "traefik",
+			edgeAuthAnnotation:       "*",
+		})
+		_, err := r.createOrUpdateIngress(context.Background(), internalHost, backends)
+		Expect(err).NotTo(HaveOccurred())
+
+		middleware := &unstructured.Unstructured{}
+		middleware.SetGroupVersionKind(internal.TraefikMiddlewareGVK)
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-edge-auth", Namespace: "default"}, middleware)).To(Succeed())
+		address, _, _ := unstructured.NestedString(middleware.Object, "spec", "forwardAuth", "address")
+		Expect(address).To(Equal("http://kdex-web.default.svc.cluster.local:8090/-/authz"))
+		headers, _, _ := unstructured.NestedStringSlice(middleware.Object, "spec", "forwardAuth", "authResponseHeaders")
+		Expect(headers).To(ContainElements("X-Auth-Subject", "X-Auth-Request-Email"))
+
+		edgeIngress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-edge-auth", Namespace: "default"}, edgeIngress)).To(Succeed())
+		Expect(edgeIngress.Spec.Rules[0].HTTP.Paths).To(HaveLen(2))
+		Expect(edgeIngress.Annotations).To(HaveKeyWithValue(
+			"traefik.ingress.kubernetes.io/router.middlewares", "default-shop-edge-auth@kubernetescrd",
+		))
+
+		delete(internalHost.Annotations, edgeAuthAnnotation)
+		_, err = r.createOrUpdateIngress(context.Background(), internalHost, backends)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-edge-auth", Namespace: "default"}, middleware)).NotTo(Succeed())
+	})
+
+	It("filters the HTTPRoute rules of the backends authorized at the edge", func() {
+		r := newReconciler()
+		internalHost := newHost(kdexv1alpha1.HTTPRouteRoutingStrategy, map[string]string{
+			gatewayAnnotation:  "public",
+			edgeAuthAnnotation: "/-/orders",
+		})
+		_, err := r.createOrUpdateHTTPRoute(context.Background(), internalHost, backends)
+		Expect(err).NotTo(HaveOccurred())
+
+		route := &gatewayv1.HTTPRoute{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop", Namespace: "default"}, route)).To(Succeed())
+		Expect(route.Spec.Rules).To(HaveLen(3))
+		Expect(route.Spec.Rules[0].Filters).To(BeEmpty())
+		Expect(route.Spec.Rules[1].Filters).To(HaveLen(1))
+		externalAuth := route.Spec.Rules[1].Filters[0].ExternalAuth
+		Expect(externalAuth.BackendRef.Name).To(Equal(gatewayv1.ObjectName("kdex-web")))
+		Expect(externalAuth.HTTPAuthConfig.Path).To(Equal("/-/authz"))
+		Expect(route.Spec.Rules[2].Filters).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Backend workloads", func() {
+	It("parses the workload of a backend", func() {
+		workload, err := parseBackendWorkload(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload).To(BeNil())
+
+		workload, err = parseBackendWorkload(map[string]string{backendWorkloadAnnotation: `{"kind": "Deployment"}`})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload).To(BeNil())
+
+		workload, err = parseBackendWorkload(map[string]string{
+			backendWorkloadAnnotation: `{"kind": "StatefulSet", "volumeClaimTemplates": [{"metadata": {"name": "data"}}], "volumeMounts": [{"name": "data", "mountPath": "/data"}]}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.VolumeClaimTemplates).To(HaveLen(1))
+		Expect(workload.VolumeMounts).To(HaveLen(1))
+
+		for _, value := range []string{
+			`{"kind": "DaemonSet"}`,
+			`{"volumeClaimTemplates": [{"metadata": {"name": "data"}}]}`,
+			`{"kind": "StatefulSet", "volumeClaimTemplates": [{}]}`,
+			`{"kind": "StatefulSet", "volumeMounts": [{"name": "data", "mountPath": "/data"}]}`,
+			`{"kind": "StatefulSet", "volumeClaimTemplates": [{"metadata": {"name": "data"}}], "volumeMounts": [{"name": "data"}]}`,
+			`not json`,
+		} {
+			_, err = parseBackendWorkload(map[string]string{backendWorkloadAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("moves the backend between a Deployment and a StatefulSet", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).Build(),
+			Scheme: s,
+		}
+		r.Configuration.BackendDefault.Deployment = appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "backend"}}}},
+		}
+		r.Configuration.BackendDefault.Service = corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8090)}},
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+		}
+		runtimeConfig := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shop-runtime-config", Namespace: "default"}}
+		backend := resolvedBackend{Kind: "KDexApp", Name: "cms"}
+		workload, err := parseBackendWorkload(map[string]string{
+			backendWorkloadAnnotation: `{"kind": "StatefulSet", "volumeClaimTemplates": [{"metadata": {"name": "data"}, "spec": {"accessModes": ["ReadWriteOnce"]}}], "volumeMounts": [{"name": "data", "mountPath": "/data"}]}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		name := types.NamespacedName{Name: "shop-cms", Namespace: "default"}
+
+		_, _, err = r.createOrUpdateBackendWorkload(context.Background(), internalHost, name.Name, backend, runtimeConfig, nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), name, &appsv1.Deployment{})).To(Succeed())
+
+		op, written, err := r.createOrUpdateBackendWorkload(context.Background(), internalHost, name.Name, backend, runtimeConfig, nil, nil, workload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+		Expect(workloadKind(written)).To(Equal("StatefulSet"))
+		Expect(r.Get(context.Background(), name, &appsv1.Deployment{})).NotTo(Succeed())
+
+		statefulSet := &appsv1.StatefulSet{}
+		Expect(r.Get(context.Background(), name, statefulSet)).To(Succeed())
+		Expect(statefulSet.Spec.ServiceName).To(Equal("shop-cms-headless"))
+		Expect(statefulSet.Spec.Selector.MatchLabels).To(HaveKeyWithValue("kdex.dev/backend", "cms"))
+		Expect(statefulSet.Spec.VolumeClaimTemplates).To(HaveLen(1))
+		Expect(statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "data", MountPath: "/data"}))
+
+		_, err = r.createOrUpdateBackendHeadlessService(context.Background(), internalHost, name.Name, backend, workload)
+		Expect(err).NotTo(HaveOccurred())
+		service := &corev1.Service{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-cms-headless", Namespace: "default"}, service)).To(Succeed())
+		Expect(service.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+		Expect(service.Spec.PublishNotReadyAddresses).To(BeTrue())
+		Expect(service.Spec.Ports).To(HaveLen(1))
+		Expect(service.Spec.Selector).To(HaveKeyWithValue("kdex.dev/backend", "cms"))
+
+		op, err = r.createOrUpdateBackendDisruptionBudget(context.Background(), internalHost, written, backend, &backendAvailability{
+			MaxUnavailable: new(intstr.FromInt(1)),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+
+		_, _, err = r.createOrUpdateBackendWorkload(context.Background(), internalHost, name.Name, backend, runtimeConfig, nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), name, &appsv1.StatefulSet{})).NotTo(Succeed())
+		_, err = r.createOrUpdateBackendHeadlessService(context.Background(), internalHost, name.Name, backend, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-cms-headless", Namespace: "default"}, service)).NotTo(Succeed())
+	})
+
+	It("derives the rollout of a StatefulSet", func() {
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop-cms", Generation: 2},
+			Spec:       appsv1.StatefulSetSpec{Replicas: new(int32(2))},
+			Status: appsv1.StatefulSetStatus{
+				AvailableReplicas:  2,
+				CurrentRevision:    "shop-cms-1",
+				ObservedGeneration: 2,
+				ReadyReplicas:      2,
+				Replicas:           2,
+				UpdateRevision:     "shop-cms-1",
+				UpdatedReplicas:    2,
+			},
+		}
+		rollout := statefulSetRollout(statefulSet, nil)
+		Expect(rollout.State).To(Equal(rolloutReady))
+		Expect(rollout.Kind).To(Equal("statefulset"))
+
+		statefulSet.Status.UpdateRevision = "shop-cms-2"
+		statefulSet.Status.UpdatedReplicas = 1
+		rollout = statefulSetRollout(statefulSet, nil)
+		Expect(rollout.State).To(Equal(rolloutProgressing))
+		Expect(rollout.Message).To(Equal("1 of 2 replicas updated"))
+
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			Status: kdexv1alpha1.KDexObjectStatus{Attributes: map[string]string{}},
+		}
+		_, progressing := rollupBackends(internalHost, []backendRollout{rollout})
+		Expect(progressing).To(Equal([]string{"statefulset/shop-cms: 1 of 2 replicas updated"}))
+	})
+
+	It("parses the schedule of a CronJob backend", func() {
+		workload, err := parseBackendWorkload(map[string]string{
+			backendWorkloadAnnotation: `{"kind": "CronJob", "schedule": "*/15 * * * *", "concurrencyPolicy": "Forbid", "successfulJobsHistoryLimit": 1}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.scheduled()).To(BeTrue())
+		Expect(*workload.SuccessfulJobsHistoryLimit).To(Equal(int32(1)))
+
+		for _, value := range []string{
+			`{"kind": "CronJob"}`,
+			`{"kind": "CronJob", "schedule": "@often"}`,
+			`{"kind": "CronJob", "schedule": "* * * *"}`,
+			`{"kind": "CronJob", "schedule": "@daily", "concurrencyPolicy": "Never"}`,
+			`{"kind": "CronJob", "schedule": "@daily", "failedJobsHistoryLimit": -1}`,
+			`{"kind": "CronJob", "schedule": "@daily", "volumeClaimTemplates": [{"metadata": {"name": "data"}}]}`,
+			`{"kind": "StatefulSet", "schedule": "@daily"}`,
+			`{"schedule": "@daily"}`,
+		} {
+			_, err = parseBackendWorkload(map[string]string{backendWorkloadAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("runs a scheduled backend in a CronJob serving no requests", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		r := &KDexInternalHostReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(s).Build(),
+			Recorder: events.NewFakeRecorder(10),
+			Scheme:   s,
+		}
+		r.Configuration.BackendDefault.Deployment = appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:           "backend",
+				ReadinessProbe: &corev1.Probe{},
+			}}}},
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+		}
+		runtimeConfig := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shop-runtime-config", Namespace: "default"}}
+		backend := resolvedBackend{Kind: "KDexApp", Name: "sitemap"}
+		workload, err := parseBackendWorkload(map[string]string{
+			backendWorkloadAnnotation: `{"kind": "CronJob", "schedule": "0 3 * * *", "timeZone": "Europe/Paris"}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		name := types.NamespacedName{Name: "shop-sitemap", Namespace: "default"}
+
+		_, err = r.createOrUpdateBackendService(context.Background(), internalHost, name.Name, backend, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = r.createOrUpdateBackendWorkload(context.Background(), internalHost, name.Name, backend, runtimeConfig, nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		op, written, err := r.createOrUpdateBackendWorkload(context.Background(), internalHost, name.Name, backend, runtimeConfig, nil, nil, workload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+		Expect(workloadServes(written)).To(BeFalse())
+		Expect(r.Get(context.Background(), name, &appsv1.Deployment{})).NotTo(Succeed())
+
+		cronJob := &batchv1.CronJob{}
+		Expect(r.Get(context.Background(), name, cronJob)).To(Succeed())
+		Expect(cronJob.Spec.Schedule).To(Equal("0 3 * * *"))
+		Expect(*cronJob.Spec.TimeZone).To(Equal("Europe/Paris"))
+		Expect(cronJob.Spec.ConcurrencyPolicy).To(Equal(batchv1.AllowConcurrent))
+		template := cronJob.Spec.JobTemplate.Spec.Template
+		Expect(template.Labels).To(HaveKeyWithValue("kdex.dev/backend", "sitemap"))
+		Expect(template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+		Expect(template.Spec.Containers[0].ReadinessProbe).To(BeNil())
+
+		_, err = r.createOrUpdateBackendService(context.Background(), internalHost, name.Name, backend, workload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), name, &corev1.Service{})).NotTo(Succeed())
+
+		op, err = r.createOrUpdateBackendAutoscaler(context.Background(), internalHost, written, backend, &backendAutoscaling{MaxReplicas: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultNone))
+
+		rollout := workloadRollout(written, nil)
+		Expect(rollout.State).To(Equal(rolloutReady))
+		Expect(rollout.Kind).To(Equal("cronjob"))
+
+		_, err = r.cleanupObsoleteCronJobs(context.Background(), internalHost, map[string]bool{}, client.MatchingLabels{
+			"kdex.dev/host": "shop",
+		}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), name, cronJob)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Backend retention", func() {
+	It("parses the grace period of a host", func() {
+		grace, err := parseBackendGracePeriod(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grace).To(Equal(defaultBackendGracePeriod))
+
+		grace, err = parseBackendGracePeriod(map[string]string{backendGracePeriodAnnotation: "0s"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grace).To(BeZero())
+
+		for _, value := range []string{"-1m", "soon"} {
+			_, err = parseBackendGracePeriod(map[string]string{backendGracePeriodAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("deletes the obsolete backends after their grace period", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		labels := map[string]string{"kdex.dev/type": internal.BACKEND, "kdex.dev/host": "shop"}
+		deployment := func(name string, annotations map[string]string) *appsv1.Deployment {
+			return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "default", Labels: labels, Annotations: annotations,
+			}}
+		}
+		recorder := events.NewFakeRecorder(10)
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(
+				deployment("shop-orders", nil),
+				deployment("shop-catalog", nil),
+				deployment("shop-legacy", map[string]string{retainAnnotation: "true"}),
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "shop-orders", Namespace: "default", Labels: labels}},
+			).Build(),
+			Recorder: recorder,
+			Scheme:   s,
+		}
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+		}
+		catalog := types.NamespacedName{Name: "shop-catalog", Namespace: "default"}
+		orders := []resolvedBackend{{Name: "orders"}}
+
+		next, err := r.cleanupObsoleteBackends(context.Background(), internalHost, orders, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(time.Minute))
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal BackendObsolete Deployment shop-catalog is no longer required")))
+		Expect(recorder.Events).NotTo(Receive())
+		obsolete := &appsv1.Deployment{}
+		Expect(r.Get(context.Background(), catalog, obsolete)).To(Succeed())
+		Expect(obsolete.Annotations).To(HaveKey(obsoleteSinceAnnotation))
+
+		_, err = r.cleanupObsoleteBackends(context.Background(), internalHost, append(orders, resolvedBackend{Name: "catalog"}), time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), catalog, obsolete)).To(Succeed())
+		Expect(obsolete.Annotations).NotTo(HaveKey(obsoleteSinceAnnotation), "required again")
+
+		obsolete.Annotations = map[string]string{obsoleteSinceAnnotation: time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339)}
+		Expect(r.Update(context.Background(), obsolete)).To(Succeed())
+		next, err = r.cleanupObsoleteBackends(context.Background(), internalHost, orders, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeZero())
+		Expect(recorder.Events).To(Receive(Equal("Normal BackendDeleted Deployment shop-catalog deleted")))
+		Expect(r.Get(context.Background(), catalog, obsolete)).NotTo(Succeed())
+
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-legacy", Namespace: "default"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(r.Get(context.Background(), types.NamespacedName{Name: "shop-orders", Namespace: "default"}, &corev1.Service{})).To(Succeed())
+	})
+})
+
+var _ = Describe("Auth secret reloads", func() {
+	It("enqueues the host when a secret of its authentication changes", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					ServiceAccountRef: corev1.LocalObjectReference{Name: "shop"},
+				},
+			},
+		}
+		serviceAccount := &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Secrets:    []corev1.ObjectReference{{Name: "shop-jwt-keys"}, {Name: "shop-npm"}},
+		}
+		r := &KDexInternalHostReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(s).WithObjects(internalHost, serviceAccount).Build(),
+			FocalHost: "shop",
+		}
+		secret := func(name string, namespace string, secretType string) *corev1.Secret {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: namespace, Annotations: map[string]string{"kdex.dev/secret-type": secretType},
+			}}
+		}
+
+		Expect(r.requestsForAuthSecret(context.Background(), secret("shop-jwt-keys", "default", "jwt-keys"))).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Name: "shop", Namespace: "default"}},
+		))
+		Expect(r.requestsForAuthSecret(context.Background(), secret("shop-npm", "default", "npm"))).To(BeEmpty(), "not an auth secret")
+		Expect(r.requestsForAuthSecret(context.Background(), secret("other-jwt-keys", "default", "jwt-keys"))).To(BeEmpty(), "not a secret of the host")
+		Expect(r.requestsForAuthSecret(context.Background(), secret("shop-jwt-keys", "other", "jwt-keys"))).To(BeEmpty(), "no host in the namespace")
+	})
+})
+
+var _ = Describe("Host annotations", func() {
+	It("parses the annotations of a host", func() {
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					host.A11yAuditAnnotation:      "strict",
+					host.FaultInjectionAnnotation: "true",
+					host.ProfilingAnnotation:      "true",
+					jwtKeyRotationAnnotation:      `{"interval": "720h"}`,
+					auth.TrustedIssuersAnnotation: "https://support.example.com/",
+					auth.CookieDomainAnnotation:   "example.com",
+					networkPolicyAnnotation:       `{}`,
+					backendGracePeriodAnnotation:  "1h",
+				},
+			},
+		}
+		internalHost.Spec.Routing.Domains = []string{"shop.example.com"}
+
+		config, err := parseHostAnnotations(internalHost)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.a11yMode).To(Equal(host.A11yAuditStrict))
+		Expect(config.faultInjection).To(BeTrue())
+		Expect(config.profiling).To(BeTrue())
+		Expect(config.jwtKeyRotation).NotTo(BeNil())
+		Expect(config.trustedIssuers).To(Equal([]string{"https://support.example.com"}))
+		Expect(config.cookieDomain).To(Equal("example.com"))
+		Expect(config.networkPolicy).NotTo(BeNil())
+		Expect(config.backendGracePeriod).To(Equal(time.Hour))
+
+		config, err = parseHostAnnotations(&kdexv1alpha1.KDexInternalHost{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.a11yMode).To(BeEmpty())
+		Expect(config.jwtKeyRotation).To(BeNil())
+		Expect(config.federation).To(BeNil())
+
+		internalHost.Annotations[host.A11yAuditAnnotation] = "block"
+		_, err = parseHostAnnotations(internalHost)
+		Expect(err).To(MatchError(ContainSubstring(host.A11yAuditAnnotation)))
+	})
+
+	It("degrades the host with the error of its reconcile", func() {
+		r := &KDexInternalHostReconciler{}
+		internalHost := &kdexv1alpha1.KDexInternalHost{}
+
+		res, err := r.degraded(context.Background(), internalHost, fmt.Errorf("invalid annotation"))
+		Expect(err).To(MatchError("invalid annotation"))
+		Expect(res).To(Equal(ctrl.Result{}))
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, string(kdexv1alpha1.ConditionTypeDegraded))).To(BeTrue())
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, string(kdexv1alpha1.ConditionTypeReady)).Message).To(Equal("invalid annotation"))
+	})
+})
+
+var _ = Describe("JWT key rotation", func() {
+	It("parses the rotation of a host", func() {
+		rotation, err := parseJWTKeyRotation(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotation).To(BeNil())
+
+		rotation, err = parseJWTKeyRotation(map[string]string{jwtKeyRotationAnnotation: `{"interval": "720h"}`})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotation.GracePeriod.Duration).To(Equal(defaultKeyGracePeriod))
+
+		for _, value := range []string{`{"interval": "1m"}`, `{"gracePeriod": "-1h"}`, `{"every": "720h"}`} {
+			_, err = parseJWTKeyRotation(map[string]string{jwtKeyRotationAnnotation: value})
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("rotates the keys and removes the retired ones after the grace period", func() {
+		now := time.Now().Truncate(time.Second)
+		privateKey, err := keys.GenerateECDSAKeyPEM()
+		Expect(err).NotTo(HaveOccurred())
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kdexv1alpha1.AddToScheme(s)).To(Succeed())
+		internalHost := &kdexv1alpha1.KDexInternalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default", UID: "shop-uid"},
+			Spec: kdexv1alpha1.KDexInternalHostSpec{
+				KDexHostSpec: kdexv1alpha1.KDexHostSpec{
+					ServiceAccountRef: corev1.LocalObjectReference{Name: "shop"},
+				},
+			},
+		}
+		manual := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "shop-manual-key", Namespace: "default",
+				Annotations:       map[string]string{"kdex.dev/secret-type": "jwt-keys", activeKeyAnnotation: "true"},
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			},
+			Data: map[string][]byte{keys.PrivateKeySecretKey: privateKey},
+		}
+		r := &KDexInternalHostReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(internalHost, manual, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+				Secrets:    []corev1.ObjectReference{{Name: "shop-manual-key"}},
+			}).Build(),
+			Recorder: events.NewFakeRecorder(10),
+			Scheme:   s,
+		}
+		rotation := &jwtKeyRotation{
+			GracePeriod: &metav1.Duration{Duration: time.Hour},
+			Interval:    &metav1.Duration{Duration: 24 * time.Hour},
+		}
+		jwtSecrets := func() []corev1.Secret {
+			secrets, err := ResolveServiceAccountSecrets(context.Background(), r.Client, "default", "shop")
+			Expect(err).NotTo(HaveOccurred())
+			return secrets
+		}
+
+		next, err := r.rotateJWTKeys(context.Background(), internalHost, rotation, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(23*time.Hour), "the manual key is rotated at its own pace")
+		Expect(jwtSecrets()).To(HaveLen(1))
+
+		rotation.Trigger = "compromised"
+		next, err = r.rotateJWTKeys(context.Background(), internalHost, rotation, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(time.Hour), "the retired key is removed after the grace period")
+		secrets := jwtSecrets()
+		Expect(secrets).To(HaveLen(2))
+		Expect(secrets[0].Annotations).To(HaveKeyWithValue(activeKeyAnnotation, "false"))
+		Expect(secrets[1].Annotations).To(HaveKeyWithValue(activeKeyAnnotation, "true"))
+		Expect(secrets[1].Annotations).To(HaveKeyWithValue(keyRotationTriggerAnnotation, "compromised"))
+
+		activeName := secrets[1].Name
+		pairs, err := keys.LoadOrGenerateKeyPair(secrets, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*pairs).To(HaveLen(2), "the retired key still verifies the tokens it signed")
+		Expect(pairs.ActiveKey().KeyId).To(Equal(activeName))
+
+		_, err = r.rotateJWTKeys(context.Background(), internalHost, rotation, now.Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jwtSecrets()).To(HaveLen(2), "the trigger is consumed")
+
+		next, err = r.rotateJWTKeys(context.Background(), internalHost, rotation, now.Add(25*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(time.Hour))
+		secrets = jwtSecrets()
+		Expect(secrets).To(HaveLen(2))
+		Expect(secrets[0].Name).NotTo(Equal("shop-manual-key"), "the retired manual key is removed from the service account")
+		Expect(secrets[1].Annotations).To(HaveKeyWithValue(keyRotationTriggerAnnotation, "compromised"), "the trigger is carried over")
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(manual), &corev1.Secret{})).To(Succeed(), "the manual key is kept")
+
+		_, err = r.rotateJWTKeys(context.Background(), internalHost, rotation, now.Add(27*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jwtSecrets()).To(HaveLen(1))
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(&secrets[0]), &corev1.Secret{})).NotTo(Succeed(), "the generated key is deleted")
+	})
+})
+
+var _ = Describe("Manager certificates", func() {
+	writeCertificate := func(dir string, notAfter time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			NotAfter:     notAfter,
+			NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "kdex-host-manager"},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+	}
+
+	It("reports the expiry of the certificates on the host", func() {
+		now := time.Now().Truncate(time.Second)
+		internalHost := &kdexv1alpha1.KDexInternalHost{}
+
+		var certificates *Certificates
+		Expect(certificates.setCertificatesValid(internalHost, now)).To(BeZero())
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, certificatesValidCondition)).To(BeNil())
+
+		certificates = NewCertificates()
+		Expect(certificates.setCertificatesValid(internalHost, now)).To(BeZero())
+		Expect(meta.FindStatusCondition(internalHost.Status.Conditions, certificatesValidCondition)).To(BeNil(), "no certificate is tracked")
+
+		dir, err := os.MkdirTemp("", "certificates")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = os.RemoveAll(dir) }()
+		writeCertificate(dir, now.Add(30*24*time.Hour))
+		watcher, err := certificates.Watch("webhook", filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		Expect(err).NotTo(HaveOccurred())
+		cert, err := watcher.GetCertificate(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert).NotTo(BeNil())
+		Eventually(certificates.Rotated()).Should(Receive(Equal(event.TypedGenericEvent[string]{Object: "webhook"})))
+		Expect(testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("webhook"))).To(Equal(float64(now.Add(30 * 24 * time.Hour).Unix())))
+
+		Expect(certificates.setCertificatesValid(internalHost, now)).To(Equal(23*24*time.Hour), "the host is requeued when the certificate starts expiring")
+		condition := meta.FindStatusCondition(internalHost.Status.Conditions, certificatesValidCondition)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+
+		Expect(certificates.setCertificatesValid(internalHost, now.Add(25*24*time.Hour))).To(Equal(5*24*time.Hour), "the host is requeued when the certificate expires")
+		condition = meta.FindStatusCondition(internalHost.Status.Conditions, certificatesValidCondition)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(reasonCertificateExpiring))
+		Expect(condition.Message).To(ContainSubstring("webhook certificate expires at"))
+
+		Expect(certificates.setCertificatesValid(internalHost, now.Add(31*24*time.Hour))).To(BeZero())
+		condition = meta.FindStatusCondition(internalHost.Status.Conditions, certificatesValidCondition)
+		Expect(condition.Reason).To(Equal(reasonCertificateExpired))
+
+		_, err = certificates.Watch("metrics", filepath.Join(dir, "missing.crt"), filepath.Join(dir, "tls.key"))
+		Expect(err).To(MatchError(ContainSubstring("failed to load the metrics certificate")))
+	})
+
+	It("reloads a rotated certificate", func() {
+		now := time.Now().Truncate(time.Second)
+		certificates := NewCertificates()
+		dir, err := os.MkdirTemp("", "certificates")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = os.RemoveAll(dir) }()
+		writeCertificate(dir, now.Add(time.Hour))
+		watcher, err := certificates.Watch("metrics", filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(certificates.Rotated()).Should(Receive())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			defer GinkgoRecover()
+			Expect(watcher.Start(ctx)).To(Succeed())
+		}()
+
+		// The watch may start after the rotation, which is then picked up by
+		// the periodic read of the watcher.
+		time.Sleep(100 * time.Millisecond)
+		writeCertificate(dir, now.Add(90*24*time.Hour))
+		Eventually(certificates.Rotated(), 15*time.Second).Should(Receive())
+		Eventually(func() float64 {
+			return testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("metrics"))
+		}, 15*time.Second).Should(Equal(float64(now.Add(90 * 24 * time.Hour).Unix())))
+
+		internalHost := &kdexv1alpha1.KDexInternalHost{}
+		certificates.setCertificatesValid(internalHost, now)
+		Expect(meta.IsStatusConditionTrue(internalHost.Status.Conditions, certificatesValidCondition)).To(BeTrue())
+	})
+})
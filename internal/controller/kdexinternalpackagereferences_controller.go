@@ -30,6 +30,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	"kdex.dev/crds/configuration"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -48,11 +49,15 @@ type KDexInternalPackageReferencesReconciler struct {
 	Configuration       configuration.NexusConfiguration
 	ControllerNamespace string
 	FocalHost           string
+	Recorder            events.EventRecorder
 	RequeueDelay        time.Duration
 	Scheme              *runtime.Scheme
 }
 
 func (r *KDexInternalPackageReferencesReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexInternalPackageReferences", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	if req.Namespace != r.ControllerNamespace {
@@ -74,12 +79,16 @@ func (r *KDexInternalPackageReferencesReconciler) Reconcile(ctx context.Context,
 		ipr.Status.Attributes = make(map[string]string)
 	}
 
+	previousReady := readyCondition(ipr.Status.Conditions)
+
 	// Defer status update
 	defer func() {
 		ipr.Status.ObservedGeneration = ipr.Generation
 		if updateErr := r.Status().Update(ctx, &ipr); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			recordReadyTransition(r.Recorder, &ipr, previousReady, ipr.Status.Conditions, "")
 		}
 
 		log.V(3).Info("status", "status", ipr.Status, "err", err, "res", res)
@@ -25,6 +25,7 @@ import (
 	"github.com/kdex-tech/host-manager/internal/host"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -42,11 +43,15 @@ type KDexInternalTranslationReconciler struct {
 	ControllerNamespace string
 	FocalHost           string
 	HostHandler         *host.HostHandler
+	Recorder            events.EventRecorder
 	RequeueDelay        time.Duration
 	Scheme              *runtime.Scheme
 }
 
 func (r *KDexInternalTranslationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexInternalTranslation", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	if req.Namespace != r.ControllerNamespace {
@@ -64,12 +69,16 @@ func (r *KDexInternalTranslationReconciler) Reconcile(ctx context.Context, req c
 		return ctrl.Result{}, nil
 	}
 
+	previousReady := readyCondition(translation.Status.Conditions)
+
 	// Defer status update
 	defer func() {
 		translation.Status.ObservedGeneration = translation.Generation
 		if updateErr := r.Status().Update(ctx, &translation); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			recordReadyTransition(r.Recorder, &translation, previousReady, translation.Status.Conditions, "")
 		}
 
 		log.V(3).Info("status", "status", translation.Status, "err", err, "res", res)
@@ -105,7 +114,16 @@ func (r *KDexInternalTranslationReconciler) Reconcile(ctx context.Context, req c
 		"Reconciling",
 	)
 
-	r.HostHandler.AddOrUpdateTranslation(translation.Name, &translation.Spec.KDexTranslationSpec)
+	switch {
+	case translation.Annotations[host.TranslationRoleAnnotation] == host.TranslationRoleGlossary:
+		r.HostHandler.AddOrUpdateGlossary(translation.Name, &translation.Spec.KDexTranslationSpec)
+	case translation.Annotations[host.TranslationRoleAnnotation] == host.TranslationRoleMemory:
+		r.HostHandler.AddOrUpdateTranslationMemory(translation.Name, &translation.Spec.KDexTranslationSpec)
+	case translation.Annotations[host.MachineTranslatedAnnotation] == "true":
+		r.HostHandler.AddOrUpdateMachineTranslation(translation.Name, &translation.Spec.KDexTranslationSpec)
+	default:
+		r.HostHandler.AddOrUpdateTranslation(translation.Name, &translation.Spec.KDexTranslationSpec)
+	}
 
 	kdexv1alpha1.SetConditions(
 		&translation.Status.Conditions,
@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	"kdex.dev/crds/configuration"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -46,12 +47,16 @@ type KDexInternalUtilityPageReconciler struct {
 	ControllerNamespace string
 	FocalHost           string
 	HostHandler         *host.HostHandler
+	Recorder            events.EventRecorder
 	RequeueDelay        time.Duration
 	Scheme              *runtime.Scheme
 }
 
 // nolint:gocyclo
 func (r *KDexInternalUtilityPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexInternalUtilityPage", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	if req.Namespace != r.ControllerNamespace {
@@ -76,12 +81,16 @@ func (r *KDexInternalUtilityPageReconciler) Reconcile(ctx context.Context, req c
 		internalUtilityPage.Status.Attributes = make(map[string]string)
 	}
 
+	previousReady := readyCondition(internalUtilityPage.Status.Conditions)
+
 	// Defer status update
 	defer func() {
 		internalUtilityPage.Status.ObservedGeneration = internalUtilityPage.Generation
 		if updateErr := r.Status().Update(ctx, &internalUtilityPage); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			recordReadyTransition(r.Recorder, &internalUtilityPage, previousReady, internalUtilityPage.Status.Conditions, "")
 		}
 
 		if meta.IsStatusConditionFalse(internalUtilityPage.Status.Conditions, string(kdexv1alpha1.ConditionTypeReady)) {
@@ -122,6 +131,23 @@ func (r *KDexInternalUtilityPageReconciler) Reconcile(ctx context.Context, req c
 		"Reconciling",
 	)
 
+	utilityPageSpec := internalUtilityPage.Spec.KDexUtilityPageSpec
+	utilityPageType, err := host.ParseUtilityPageType(internalUtilityPage.Annotations, utilityPageSpec.Type)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&internalUtilityPage.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+	utilityPageSpec.Type = utilityPageType
+
 	backendRefs := []kdexv1alpha1.KDexObjectReference{}
 	defaultBackendServerImage := r.Configuration.BackendDefault.ServerImage
 	packageRefs := []kdexv1alpha1.PackageReference{}
@@ -384,7 +410,7 @@ func (r *KDexInternalUtilityPageReconciler) Reconcile(ctx context.Context, req c
 		PackageReferences: uniquePackageRefs,
 		RequiredBackends:  uniqueBackendRefs,
 		Scripts:           uniqueScriptDefs,
-		UtilityPage:       &internalUtilityPage.Spec.KDexUtilityPageSpec,
+		UtilityPage:       &utilityPageSpec,
 	})
 
 	kdexv1alpha1.SetConditions(
@@ -20,14 +20,17 @@ import (
 	"context"
 	"fmt"
 	"maps"
+	"strings"
 	"time"
 
 	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/a11y"
 	"github.com/kdex-tech/host-manager/internal/host"
 	"github.com/kdex-tech/host-manager/internal/page"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 	"kdex.dev/crds/configuration"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -47,12 +50,16 @@ type KDexPageBindingReconciler struct {
 	ControllerNamespace string
 	FocalHost           string
 	HostHandler         *host.HostHandler
+	Recorder            events.EventRecorder
 	RequeueDelay        time.Duration
 	Scheme              *runtime.Scheme
 }
 
 //nolint:gocyclo
 func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := startReconcileSpan(ctx, "KDexPageBinding", req)
+	defer func() { endReconcileSpan(span, res, err) }()
+
 	log := logf.FromContext(ctx)
 
 	if req.Namespace != r.ControllerNamespace {
@@ -74,12 +81,16 @@ func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		pageBinding.Status.Attributes = make(map[string]string)
 	}
 
+	previousReady := readyCondition(pageBinding.Status.Conditions)
+
 	// Defer status update
 	defer func() {
 		pageBinding.Status.ObservedGeneration = pageBinding.Generation
 		if updateErr := r.Status().Update(ctx, &pageBinding); updateErr != nil {
 			err = updateErr
 			res = ctrl.Result{}
+		} else {
+			recordReadyTransition(r.Recorder, &pageBinding, previousReady, pageBinding.Status.Conditions, "")
 		}
 
 		if meta.IsStatusConditionFalse(pageBinding.Status.Conditions, string(kdexv1alpha1.ConditionTypeReady)) {
@@ -378,7 +389,36 @@ func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		"uniqueScriptDefs", uniqueScriptDefs,
 	)
 
-	r.HostHandler.Pages.Set(page.PageHandler{
+	if _, err := host.ParseDataLoaders(pageBinding.Annotations); err != nil {
+		kdexv1alpha1.SetConditions(
+			&pageBinding.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	if _, err := host.ParseProbes(pageBinding.Annotations, pageBinding.Spec.BasePath); err != nil {
+		kdexv1alpha1.SetConditions(
+			&pageBinding.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+
+	pageHandler := page.PageHandler{
+		Annotations:       pageBinding.Annotations,
 		Content:           contentsMap,
 		Footer:            footerContent,
 		Header:            headerContent,
@@ -389,7 +429,57 @@ func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		Page:              &pageBinding.Spec,
 		RequiredBackends:  uniqueBackendRefs,
 		Scripts:           uniqueScriptDefs,
-	})
+	}
+
+	if blocked := r.auditPage(&pageBinding, pageHandler); len(blocked) > 0 {
+		kdexv1alpha1.SetConditions(
+			&pageBinding.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf("Accessibility audit failed in %s, see /-/admin/a11y", strings.Join(blocked, ", ")),
+		)
+		return ctrl.Result{}, nil
+	}
+
+	exceeded, err := r.checkBudget(&pageBinding, pageHandler)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&pageBinding.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return ctrl.Result{}, err
+	}
+	if exceeded != "" && r.HostHandler.PerformanceBudgetMode() == host.PerformanceBudgetStrict {
+		kdexv1alpha1.SetConditions(
+			&pageBinding.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			fmt.Sprintf("Performance budget exceeded in %s", exceeded),
+		)
+		return ctrl.Result{}, nil
+	}
+
+	r.HostHandler.Pages.Set(pageHandler)
+
+	message := "Reconciliation successful"
+	if exceeded != "" {
+		log.Info("performance budget exceeded", "budgets", exceeded)
+		message = fmt.Sprintf("Reconciliation successful, performance budget exceeded in %s", exceeded)
+	}
 
 	kdexv1alpha1.SetConditions(
 		&pageBinding.Status.Conditions,
@@ -399,7 +489,7 @@ func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			Ready:       metav1.ConditionTrue,
 		},
 		kdexv1alpha1.ConditionReasonReconcileSuccess,
-		"Reconciliation successful",
+		message,
 	)
 
 	log.V(1).Info("reconciled")
@@ -407,6 +497,50 @@ func (r *KDexPageBindingReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	return ctrl.Result{}, nil
 }
 
+// auditPage records the accessibility audit of the page in the status of the
+// binding. It returns the languages in which the page has critical or serious
+// violations when the audits of the host are strict.
+func (r *KDexPageBindingReconciler) auditPage(pageBinding *kdexv1alpha1.KDexPageBinding, pageHandler page.PageHandler) []string {
+	maps.DeleteFunc(pageBinding.Status.Attributes, func(k string, _ string) bool {
+		return strings.HasPrefix(k, "a11y.")
+	})
+
+	blocked := []string{}
+	for _, audit := range r.HostHandler.AuditPage(pageHandler) {
+		pageBinding.Status.Attributes["a11y."+audit.Lang+".violations"] = fmt.Sprintf("%d", len(audit.Violations))
+		if summary := a11y.Summary(audit.Violations); summary != "" {
+			pageBinding.Status.Attributes["a11y."+audit.Lang+".rules"] = summary
+		}
+		if r.HostHandler.A11yAuditMode() == host.A11yAuditStrict && a11y.Blocking(audit.Violations) {
+			blocked = append(blocked, audit.Lang)
+		}
+	}
+	return blocked
+}
+
+// checkBudget records the measures of the renders of the page against its
+// performance budget in the status of the binding. It returns the exceeded
+// budgets, e.g. "en: htmlBytes 61234 > 50000".
+func (r *KDexPageBindingReconciler) checkBudget(pageBinding *kdexv1alpha1.KDexPageBinding, pageHandler page.PageHandler) (string, error) {
+	maps.DeleteFunc(pageBinding.Status.Attributes, func(k string, _ string) bool {
+		return strings.HasPrefix(k, "budget.")
+	})
+
+	checks, err := r.HostHandler.CheckBudget(pageHandler)
+	if err != nil {
+		return "", err
+	}
+	for _, check := range checks {
+		for name, measure := range check.Measures {
+			pageBinding.Status.Attributes["budget."+check.Lang+"."+name] = fmt.Sprintf("%d", measure)
+		}
+		if len(check.Exceeded) > 0 {
+			pageBinding.Status.Attributes["budget."+check.Lang+".exceeded"] = strings.Join(check.Exceeded, ", ")
+		}
+	}
+	return host.BudgetSummary(checks), nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *KDexPageBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	l := LogConstructor("kdexpagebinding", mgr)(nil)
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/keys"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// jwtKeyRotationAnnotation holds, on a host, the JSON encoded rotation of
+	// the keys signing its tokens, e.g. {"interval": "720h", "gracePeriod": "24h"}.
+	// Changing its trigger, e.g. {"trigger": "2026-10-16"}, rotates the keys
+	// right away.
+	jwtKeyRotationAnnotation = "kdex.dev/jwt-key-rotation"
+	// activeKeyAnnotation marks the jwt-keys secret whose key signs the
+	// tokens.
+	activeKeyAnnotation = "kdex.dev/active-key"
+	// keyRetiredAtAnnotation records, on a jwt-keys secret, when a newer key
+	// replaced it. Its key is still published until the grace period elapsed.
+	keyRetiredAtAnnotation = "kdex.dev/retired-at"
+	// keyRotatedAtAnnotation records, on a jwt-keys secret, when the rotation
+	// generated it.
+	keyRotatedAtAnnotation = "kdex.dev/rotated-at"
+	// keyRotationTriggerAnnotation records, on a jwt-keys secret, the trigger
+	// of the rotation when it was generated.
+	keyRotationTriggerAnnotation = "kdex.dev/rotation-trigger"
+
+	// defaultKeyGracePeriod outlasts the tokens signed with a retired key.
+	defaultKeyGracePeriod  = 24 * time.Hour
+	minKeyRotationInterval = time.Hour
+)
+
+// jwtKeyRotation generates the keys signing the tokens of a host. The
+// retired keys keep verifying the tokens they signed for the grace period.
+type jwtKeyRotation struct {
+	// GracePeriod is how long a retired key is kept, 24h by default.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+	// Interval between two rotations, at least 1h. Keys are only rotated by
+	// trigger when it is not set.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Trigger rotates the keys when it changes.
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// parseJWTKeyRotation returns the key rotation of the annotations of a host,
+// nil when jwtKeyRotationAnnotation is not set.
+func parseJWTKeyRotation(annotations map[string]string) (*jwtKeyRotation, error) {
+	value := annotations[jwtKeyRotationAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	rotation := &jwtKeyRotation{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rotation); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", jwtKeyRotationAnnotation, err)
+	}
+
+	if rotation.GracePeriod == nil {
+		rotation.GracePeriod = &metav1.Duration{Duration: defaultKeyGracePeriod}
+	}
+	if rotation.GracePeriod.Duration < 0 {
+		return nil, fmt.Errorf("invalid %s annotation: the grace period must not be negative", jwtKeyRotationAnnotation)
+	}
+	if rotation.Interval != nil && rotation.Interval.Duration < minKeyRotationInterval {
+		return nil, fmt.Errorf("invalid %s annotation: the interval must be at least %s", jwtKeyRotationAnnotation, minKeyRotationInterval)
+	}
+
+	return rotation, nil
+}
+
+// rotateJWTKeys generates a new active key for the host when none is active,
+// when the interval elapsed since the active one was generated, or when the
+// trigger changed. The key is stored in a jwt-keys secret of the service
+// account of the host, and the previous keys are retired. The retired keys
+// are removed from the service account once the grace period elapsed, and
+// deleted when the rotation generated them. It returns the time left until
+// the next rotation or removal.
+func (r *KDexInternalHostReconciler) rotateJWTKeys(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	rotation *jwtKeyRotation,
+	now time.Time,
+) (time.Duration, error) {
+	var serviceAccount corev1.ServiceAccount
+	if err := r.Get(ctx, types.NamespacedName{Name: internalHost.Spec.ServiceAccountRef.Name, Namespace: internalHost.Namespace}, &serviceAccount); err != nil {
+		return 0, fmt.Errorf("failed to get service account %s/%s: %w", internalHost.Namespace, internalHost.Spec.ServiceAccountRef.Name, err)
+	}
+
+	secrets, err := ResolveServiceAccountSecrets(ctx, r.Client, internalHost.Namespace, serviceAccount.Name)
+	if err != nil {
+		return 0, err
+	}
+	secrets = slices.DeleteFunc(secrets, func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] != "jwt-keys" })
+	slices.SortStableFunc(secrets, func(a, b corev1.Secret) int { return keyGeneratedAt(&a).Compare(keyGeneratedAt(&b)) })
+
+	var active *corev1.Secret
+	for i := range secrets {
+		if secrets[i].Annotations[keyRetiredAtAnnotation] == "" {
+			active = &secrets[i]
+		}
+	}
+
+	due := active == nil ||
+		(rotation.Interval != nil && now.Sub(keyGeneratedAt(active)) >= rotation.Interval.Duration) ||
+		(rotation.Trigger != "" && active.Annotations[keyRotationTriggerAnnotation] != rotation.Trigger)
+
+	next := time.Duration(0)
+	if due {
+		if err := r.generateJWTKey(ctx, internalHost, &serviceAccount, secrets, rotation, now); err != nil {
+			return 0, err
+		}
+		if rotation.Interval != nil {
+			next = rotation.Interval.Duration
+		}
+	} else if rotation.Interval != nil {
+		next = rotation.Interval.Duration - now.Sub(keyGeneratedAt(active))
+	}
+
+	for i := range secrets {
+		secret := &secrets[i]
+		retiredAt, err := time.Parse(time.RFC3339, secret.Annotations[keyRetiredAtAnnotation])
+		if err != nil {
+			continue
+		}
+		if left := rotation.GracePeriod.Duration - now.Sub(retiredAt); left > 0 {
+			next = nextRetirement(next, left)
+			continue
+		}
+		if err := r.removeJWTKey(ctx, internalHost, &serviceAccount, secret); err != nil {
+			return 0, err
+		}
+	}
+
+	return next, nil
+}
+
+// generateJWTKey stores a new active key in a jwt-keys secret of the service
+// account and retires the other keys.
+func (r *KDexInternalHostReconciler) generateJWTKey(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	serviceAccount *corev1.ServiceAccount,
+	secrets []corev1.Secret,
+	rotation *jwtKeyRotation,
+	now time.Time,
+) error {
+	privateKey, err := keys.GenerateECDSAKeyPEM()
+	if err != nil {
+		return fmt.Errorf("failed to generate jwt key: %w", err)
+	}
+
+	stamp := now.UTC().Format(time.RFC3339)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				"kdex.dev/secret-type": "jwt-keys",
+				activeKeyAnnotation:    "true",
+				keyRotatedAtAnnotation: stamp,
+			},
+			Name:      fmt.Sprintf("%s-jwt-keys-%d", internalHost.Name, now.Unix()),
+			Namespace: internalHost.Namespace,
+		},
+		Data: map[string][]byte{
+			keys.PrivateKeySecretKey: privateKey,
+		},
+	}
+	if rotation.Trigger != "" {
+		secret.Annotations[keyRotationTriggerAnnotation] = rotation.Trigger
+	}
+	if err := controllerutil.SetControllerReference(internalHost, secret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return fmt.Errorf("failed to create jwt-keys secret %s: %w", secret.Name, err)
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Secrets = append(serviceAccount.Secrets, corev1.ObjectReference{Name: secret.Name})
+	if err := r.Patch(ctx, serviceAccount, patch); err != nil {
+		return fmt.Errorf("failed to add jwt-keys secret %s to service account %s: %w", secret.Name, serviceAccount.Name, err)
+	}
+
+	retired := 0
+	for i := range secrets {
+		previous := &secrets[i]
+		if previous.Annotations[keyRetiredAtAnnotation] != "" {
+			continue
+		}
+		retired++
+
+		patch := client.MergeFrom(previous.DeepCopy())
+		previous.Annotations[activeKeyAnnotation] = "false"
+		previous.Annotations[keyRetiredAtAnnotation] = stamp
+		if err := r.Patch(ctx, previous, patch); err != nil {
+			return fmt.Errorf("failed to retire jwt-keys secret %s: %w", previous.Name, err)
+		}
+	}
+
+	r.Recorder.Eventf(internalHost, nil, corev1.EventTypeNormal, EventReasonKeyRotated, "Rotate", "jwt-keys secret %s signs the tokens, %d previous keys retired", secret.Name, retired)
+	return nil
+}
+
+// removeJWTKey removes a retired key from the service account, and deletes
+// its secret when the rotation generated it.
+func (r *KDexInternalHostReconciler) removeJWTKey(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	serviceAccount *corev1.ServiceAccount,
+	secret *corev1.Secret,
+) error {
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Secrets = slices.DeleteFunc(serviceAccount.Secrets, func(ref corev1.ObjectReference) bool { return ref.Name == secret.Name })
+	if err := r.Patch(ctx, serviceAccount, patch); err != nil {
+		return fmt.Errorf("failed to remove jwt-keys secret %s from service account %s: %w", secret.Name, serviceAccount.Name, err)
+	}
+
+	if metav1.IsControlledBy(secret, internalHost) {
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete jwt-keys secret %s: %w", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// keyGeneratedAt returns when the key of a jwt-keys secret was generated.
+func keyGeneratedAt(secret *corev1.Secret) time.Time {
+	if rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[keyRotatedAtAnnotation]); err == nil {
+		return rotatedAt
+	}
+	return secret.CreationTimestamp.Time
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// functionStateSinceAttribute is the status attribute holding the time the
+	// function entered its current state.
+	functionStateSinceAttribute = "state.since"
+
+	functionBuildFailure = "failure"
+	functionBuildSuccess = "success"
+)
+
+var (
+	certificateExpiryGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_certificate_expiry_timestamp_seconds",
+			Help: "Unix time each certificate served by the manager, webhook or metrics, expires.",
+		},
+		[]string{"certificate"},
+	)
+	functionBuildsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_function_builds_total",
+			Help: "Number of image builds of each function by result, success or failure.",
+		},
+		[]string{"namespace", "host", "function", "result"},
+	)
+	functionDeployDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kdex_function_deploy_duration_seconds",
+			Help:    "Time from the executable of each function being available to its deployment.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+		},
+		[]string{"namespace", "host", "function"},
+	)
+	functionRequeuesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_function_requeues_total",
+			Help: "Number of reconciles of each function requeued, after a delay or an error, in each state.",
+		},
+		[]string{"namespace", "host", "function", "state"},
+	)
+	functionStateDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kdex_function_state_duration_seconds",
+			Help:    "Time spent by each function in each state before leaving it.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+		},
+		[]string{"namespace", "host", "function", "state"},
+	)
+	functionStateEnteredGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_function_state_entered_timestamp_seconds",
+			Help: "Unix time each function entered its current state, the only state reported for it.",
+		},
+		[]string{"namespace", "host", "function", "state"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		certificateExpiryGauge,
+		functionBuildsCounter,
+		functionDeployDurationHistogram,
+		functionRequeuesCounter,
+		functionStateDurationHistogram,
+		functionStateEnteredGauge,
+	)
+}
+
+// functionLabels returns the namespace, host and function labels of the
+// function.
+func functionLabels(function *kdexv1alpha1.KDexFunction) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace": function.Namespace,
+		"host":      function.Spec.HostRef.Name,
+		"function":  function.Name,
+	}
+}
+
+// enterFunctionState stamps the time the function entered its state when it
+// is not the previous state, or when it was never stamped. It returns the time
+// spent in the previous state, zero when the state did not change or the
+// previous state was never stamped.
+func enterFunctionState(function *kdexv1alpha1.KDexFunction, previous kdexv1alpha1.KDexFunctionState, now time.Time) time.Duration {
+	since, err := time.Parse(time.RFC3339, function.Status.Attributes[functionStateSinceAttribute])
+	if err == nil && function.Status.State == previous {
+		return 0
+	}
+
+	function.Status.Attributes[functionStateSinceAttribute] = now.UTC().Format(time.RFC3339)
+	if err != nil || function.Status.State == previous {
+		return 0
+	}
+	return now.Sub(since)
+}
+
+// observeFunctionReconcile records the metrics of a reconcile of the function
+// which left the previous state after spent, and ended with res and err.
+func observeFunctionReconcile(function *kdexv1alpha1.KDexFunction, previous kdexv1alpha1.KDexFunctionState, spent time.Duration, res ctrl.Result, err error) {
+	labels := functionLabels(function)
+	state := string(function.Status.State)
+
+	if spent > 0 {
+		functionStateDurationHistogram.MustCurryWith(labels).WithLabelValues(string(previous)).Observe(spent.Seconds())
+
+		if previous == kdexv1alpha1.KDexFunctionStateExecutableAvailable &&
+			function.Status.State == kdexv1alpha1.KDexFunctionStateFunctionDeployed {
+			functionDeployDurationHistogram.With(labels).Observe(spent.Seconds())
+		}
+	}
+
+	if function.Status.State != previous {
+		functionStateEnteredGauge.DeletePartialMatch(labels)
+	}
+	if since, parseErr := time.Parse(time.RFC3339, function.Status.Attributes[functionStateSinceAttribute]); parseErr == nil {
+		functionStateEnteredGauge.MustCurryWith(labels).WithLabelValues(state).Set(float64(since.Unix()))
+	}
+
+	if err != nil || res.RequeueAfter > 0 {
+		functionRequeuesCounter.MustCurryWith(labels).WithLabelValues(state).Inc()
+	}
+}
+
+// observeFunctionBuild counts a build of the function with the result.
+func observeFunctionBuild(function *kdexv1alpha1.KDexFunction, result string) {
+	functionBuildsCounter.MustCurryWith(functionLabels(function)).WithLabelValues(result).Inc()
+}
+
+// forgetFunctionMetrics drops the metrics of the deleted function.
+func forgetFunctionMetrics(namespace string, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "function": name}
+	functionBuildsCounter.DeletePartialMatch(labels)
+	functionDeployDurationHistogram.DeletePartialMatch(labels)
+	functionRequeuesCounter.DeletePartialMatch(labels)
+	functionStateDurationHistogram.DeletePartialMatch(labels)
+	functionStateEnteredGauge.DeletePartialMatch(labels)
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/child"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// networkPolicyAnnotation holds, on a host, the JSON encoded
+// backendNetworkPolicy restricting the traffic reaching the pods of its
+// backends, its packages and its themes, e.g. {"ingressFrom":
+// [{"namespaceSelector": {"matchLabels": {"kubernetes.io/metadata.name":
+// "ingress-nginx"}}}]}. The backends take any traffic when it is not set.
+const networkPolicyAnnotation = "kdex.dev/network-policy"
+
+// backendNetworkPolicy admits, to the pods of the backends of a host, the
+// traffic of the pods behind the service of the host and of the peers of
+// IngressFrom, typically the ingress controller or the gateway.
+type backendNetworkPolicy struct {
+	IngressFrom []networkingv1.NetworkPolicyPeer `json:"ingressFrom,omitempty"`
+}
+
+// parseNetworkPolicy returns the network policy of the annotations of a host,
+// nil when networkPolicyAnnotation is not set.
+func parseNetworkPolicy(annotations map[string]string) (*backendNetworkPolicy, error) {
+	value := annotations[networkPolicyAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	policy := &backendNetworkPolicy{}
+	if err := json.Unmarshal([]byte(value), policy); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", networkPolicyAnnotation, err)
+	}
+
+	for _, peer := range policy.IngressFrom {
+		if peer.PodSelector == nil && peer.NamespaceSelector == nil && peer.IPBlock == nil {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: ingressFrom peers require a podSelector, a namespaceSelector or an ipBlock",
+				networkPolicyAnnotation,
+			)
+		}
+	}
+
+	return policy, nil
+}
+
+// hostPeer returns the peer of the pods behind the service of the host, nil
+// when the reconciler does not know its service.
+func (r *KDexInternalHostReconciler) hostPeer(ctx context.Context) (*networkingv1.NetworkPolicyPeer, error) {
+	if r.ServiceName == "" {
+		return nil, nil
+	}
+
+	service := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Name: r.ServiceName, Namespace: r.ControllerNamespace}, service); err != nil {
+		return nil, fmt.Errorf("failed to get the service of the host: %w", err)
+	}
+	if len(service.Spec.Selector) == 0 {
+		return nil, fmt.Errorf("the service %s of the host selects no pods", r.ServiceName)
+	}
+
+	return &networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: service.Spec.Selector},
+	}, nil
+}
+
+// createOrUpdateBackendNetworkPolicy maintains the NetworkPolicy of the pods
+// of the backend workload, or deletes it when the host sets none.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendNetworkPolicy(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	workload client.Object,
+	resolvedBackend resolvedBackend,
+	policy *backendNetworkPolicy,
+	hostPeer *networkingv1.NetworkPolicyPeer,
+) (controllerutil.OperationResult, error) {
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.GetName(),
+			Namespace: workload.GetNamespace(),
+		},
+	}
+
+	if policy == nil {
+		if err := r.Delete(ctx, networkPolicy); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		networkPolicy,
+		func() error {
+			networkPolicy.Labels = child.StampLabels(networkPolicy.Labels, map[string]string{
+				"kdex.dev/backend": resolvedBackend.Name,
+				"kdex.dev/host":    internalHost.Name,
+				"kdex.dev/kind":    resolvedBackend.Kind,
+				"kdex.dev/type":    internal.BACKEND,
+			})
+
+			from := make([]networkingv1.NetworkPolicyPeer, 0, len(policy.IngressFrom)+1)
+			if hostPeer != nil {
+				from = append(from, *hostPeer.DeepCopy())
+			}
+			for _, peer := range policy.IngressFrom {
+				from = append(from, *peer.DeepCopy())
+			}
+
+			networkPolicy.Spec = networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"kdex.dev/backend": resolvedBackend.Name,
+						"kdex.dev/host":    internalHost.Name,
+					},
+				},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: from}},
+			}
+
+			return ctrl.SetControllerReference(internalHost, networkPolicy, r.Scheme)
+		},
+	)
+}
+
+// cleanupObsoleteNetworkPolicies deletes the NetworkPolicies of the backends
+// no longer required by the host.
+func (r *KDexInternalHostReconciler) cleanupObsoleteNetworkPolicies(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backendNames map[string]bool,
+	labelSelector client.MatchingLabels,
+) error {
+	policyList := &networkingv1.NetworkPolicyList{}
+	if err := r.List(ctx, policyList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
+		return err
+	}
+
+	for _, networkPolicy := range policyList.Items {
+		if !backendNames[networkPolicy.Name] {
+			if err := r.Delete(ctx, &networkPolicy); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/host"
+	"github.com/kdex-tech/host-manager/internal/page"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// collectProbes returns the probes of the page bindings and the functions of
+// the host. Invalid probes are reported by the controllers of the objects
+// declaring them and are left out.
+func collectProbes(log logr.Logger, pageHandlers []page.PageHandler, functions []kdexv1alpha1.KDexFunction) []host.Probe {
+	probes := []host.Probe{}
+
+	for _, pageHandler := range pageHandlers {
+		if pageHandler.Page == nil {
+			continue
+		}
+		pageProbes, err := host.ParseProbes(pageHandler.Annotations, pageHandler.Page.BasePath)
+		if err != nil {
+			log.V(2).Info("ignoring invalid probes", "page", pageHandler.Name, "err", err.Error())
+			continue
+		}
+		for _, probe := range pageProbes {
+			probe.Owner = "KDexPageBinding/" + pageHandler.Name
+			probes = append(probes, probe)
+		}
+	}
+
+	for _, function := range functions {
+		functionProbes, err := host.ParseProbes(function.Annotations, function.Spec.API.BasePath)
+		if err != nil {
+			log.V(2).Info("ignoring invalid probes", "function", function.Name, "err", err.Error())
+			continue
+		}
+		for _, probe := range functionProbes {
+			probe.Owner = "KDexFunction/" + function.Name
+			probes = append(probes, probe)
+		}
+	}
+
+	return probes
+}
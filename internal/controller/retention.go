@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// retainAnnotation, set to "true" on the Deployment, StatefulSet, CronJob
+	// or Service of a backend, keeps it when the host no longer requires the
+	// backend.
+	retainAnnotation = "kdex.dev/retain"
+	// backendGracePeriodAnnotation holds, on a host, how long the workloads
+	// and the Services of the backends it no longer requires are kept before
+	// they are deleted, e.g. "10m". It defaults to defaultBackendGracePeriod,
+	// "0s" deletes them right away.
+	backendGracePeriodAnnotation = "kdex.dev/backend-grace-period"
+	// obsoleteSinceAnnotation records, on a workload or a Service, when the
+	// host stopped requiring its backend.
+	obsoleteSinceAnnotation = "kdex.dev/obsolete-since"
+
+	// defaultBackendGracePeriod outlasts the backends missing from a stale
+	// cache while they are renamed.
+	defaultBackendGracePeriod = time.Minute
+)
+
+// parseBackendGracePeriod returns the grace period of
+// backendGracePeriodAnnotation, defaultBackendGracePeriod when it is not set.
+func parseBackendGracePeriod(annotations map[string]string) (time.Duration, error) {
+	value := annotations[backendGracePeriodAnnotation]
+	if value == "" {
+		return defaultBackendGracePeriod, nil
+	}
+
+	grace, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation: %w", backendGracePeriodAnnotation, err)
+	}
+	if grace < 0 {
+		return 0, fmt.Errorf("invalid %s annotation: the grace period must not be negative", backendGracePeriodAnnotation)
+	}
+
+	return grace, nil
+}
+
+// retireObsolete reports whether the object of a backend the host no longer
+// requires is due for deletion. Objects annotated with retainAnnotation never
+// are. The others are first marked obsolete, with an event announcing their
+// deletion, and are due once the grace period elapsed. Until then, the time
+// left is returned.
+func (r *KDexInternalHostReconciler) retireObsolete(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	obj client.Object,
+	kind string,
+	grace time.Duration,
+) (bool, time.Duration, error) {
+	annotations := obj.GetAnnotations()
+	if annotations[retainAnnotation] == "true" {
+		return false, 0, nil
+	}
+
+	since, err := time.Parse(time.RFC3339, annotations[obsoleteSinceAnnotation])
+	if err != nil {
+		if grace == 0 {
+			return true, 0, nil
+		}
+
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[obsoleteSinceAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		obj.SetAnnotations(annotations)
+		if err := r.Patch(ctx, obj, patch); err != nil {
+			return false, 0, err
+		}
+
+		r.Recorder.Eventf(
+			internalHost, nil, corev1.EventTypeNormal, EventReasonBackendObsolete, "Delete",
+			"%s %s is no longer required, it will be deleted in %s unless it is required again or annotated %s=true",
+			kind, obj.GetName(), grace, retainAnnotation,
+		)
+		return false, grace, nil
+	}
+
+	if left := grace - time.Since(since); left > 0 {
+		return false, left, nil
+	}
+	return true, 0, nil
+}
+
+// reviveRequired removes the obsolete mark of the object of a backend the
+// host requires again.
+func (r *KDexInternalHostReconciler) reviveRequired(ctx context.Context, obj client.Object) error {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[obsoleteSinceAnnotation]; !ok {
+		return nil
+	}
+
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	delete(annotations, obsoleteSinceAnnotation)
+	obj.SetAnnotations(annotations)
+	return r.Patch(ctx, obj, patch)
+}
+
+// recordBackendDeleted records the deletion of the object of an obsolete
+// backend.
+func (r *KDexInternalHostReconciler) recordBackendDeleted(internalHost *kdexv1alpha1.KDexInternalHost, obj client.Object, kind string) {
+	r.Recorder.Eventf(internalHost, nil, corev1.EventTypeNormal, EventReasonBackendDeleted, "Delete", "%s %s deleted", kind, obj.GetName())
+}
+
+// nextRetirement returns the earliest of the times left, ignoring zeros.
+func nextRetirement(current time.Duration, left time.Duration) time.Duration {
+	if left > 0 && (current == 0 || left < current) {
+		return left
+	}
+	return current
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// rollbackImageAnnotation pins, on a function, the deployed image to one
+	// of the images of its history. Removing it deploys the latest build
+	// again.
+	rollbackImageAnnotation = "kdex.dev/rollback-image"
+
+	// imageHistoryAttribute lists the images the function was successfully
+	// deployed with, the most recent first.
+	imageHistoryAttribute = "image.history"
+	// rollbackImageAttribute is the image the function is rolled back to.
+	rollbackImageAttribute = "image.rollback"
+
+	maxImageHistory = 10
+)
+
+// imageHistory returns the images the function was successfully deployed
+// with, the most recent first.
+func imageHistory(function *kdexv1alpha1.KDexFunction) []string {
+	history := function.Status.Attributes[imageHistoryAttribute]
+	if history == "" {
+		return nil
+	}
+	return strings.Split(history, ",")
+}
+
+// recordDeployedImage moves the image of the executable of the function to
+// the front of its history, dropping the oldest images beyond
+// maxImageHistory.
+func recordDeployedImage(function *kdexv1alpha1.KDexFunction) {
+	if function.Status.Executable == nil || function.Status.Executable.Image == "" {
+		return
+	}
+
+	image := function.Status.Executable.Image
+	history := slices.DeleteFunc(imageHistory(function), func(i string) bool { return i == image })
+	history = append([]string{image}, history...)
+	if len(history) > maxImageHistory {
+		history = history[:maxImageHistory]
+	}
+	function.Status.Attributes[imageHistoryAttribute] = strings.Join(history, ",")
+}
+
+// rollbackImage returns the image the function is to be rolled back to, if
+// any. The image must be in the history of the function.
+func rollbackImage(function *kdexv1alpha1.KDexFunction) (string, error) {
+	image := function.Annotations[rollbackImageAnnotation]
+	if image == "" {
+		return "", nil
+	}
+	if !slices.Contains(imageHistory(function), image) {
+		return "", fmt.Errorf(
+			"rollback image %s of function %s/%s is not one of its previously deployed images %v",
+			image, function.Namespace, function.Name, imageHistory(function),
+		)
+	}
+	return image, nil
+}
+
+// handleRollback redeploys the image selected by rollbackImageAnnotation,
+// or the latest build once the annotation is removed. It reports whether
+// the reconcile should return with the result.
+func (r *KDexFunctionReconciler) handleRollback(hc handlerContext) (bool, ctrl.Result, error) {
+	log := logf.FromContext(hc.ctx)
+
+	image, err := rollbackImage(hc.function)
+	if err != nil {
+		kdexv1alpha1.SetConditions(
+			&hc.function.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return true, ctrl.Result{}, err
+	}
+
+	rolledBack := hc.function.Status.Attributes[rollbackImageAttribute]
+
+	if image == "" {
+		if rolledBack == "" {
+			return false, ctrl.Result{}, nil
+		}
+
+		log.Info("Rollback removed, redeploying the latest build", "image", rolledBack)
+
+		delete(hc.function.Status.Attributes, rollbackImageAttribute)
+		hc.function.Status.State = kdexv1alpha1.KDexFunctionStateSourceAvailable
+
+		if err := r.deleteDeployerJobs(hc); err != nil {
+			return true, ctrl.Result{}, err
+		}
+
+		return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	// Builds completing while the function is rolled back replace the
+	// executable, it is rolled back again before they are deployed.
+	if rolledBack == image && hc.function.Status.Executable != nil && hc.function.Status.Executable.Image == image {
+		return false, ctrl.Result{}, nil
+	}
+
+	log.Info("Rolling back function", "image", image)
+
+	if err := r.removeCanary(hc); err != nil {
+		return true, ctrl.Result{}, err
+	}
+
+	executable := &kdexv1alpha1.Executable{Image: image}
+	if hc.function.Status.Executable != nil {
+		executable.Scaling = hc.function.Status.Executable.Scaling
+	}
+	hc.function.Status.Executable = executable
+	hc.function.Status.Attributes[rollbackImageAttribute] = image
+	hc.function.Status.State = kdexv1alpha1.KDexFunctionStateExecutableAvailable
+	hc.function.Status.Detail = fmt.Sprintf("%v: rolled back to %s", kdexv1alpha1.KDexFunctionStateExecutableAvailable, image)
+
+	kdexv1alpha1.SetConditions(
+		&hc.function.Status.Conditions,
+		kdexv1alpha1.ConditionStatuses{
+			Degraded:    metav1.ConditionFalse,
+			Progressing: metav1.ConditionTrue,
+			Ready:       metav1.ConditionFalse,
+		},
+		kdexv1alpha1.ConditionReasonReconciling,
+		hc.function.Status.Detail,
+	)
+
+	if err := r.deleteDeployerJobs(hc); err != nil {
+		return true, ctrl.Result{}, err
+	}
+
+	return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+}
+
+// deleteDeployerJobs deletes the deployer jobs of the function. Deployer jobs
+// are named after the image they deploy, a completed one would otherwise be
+// taken for the deployment of an image deployed before, and a running one
+// could deploy the image replaced after the rollback.
+func (r *KDexFunctionReconciler) deleteDeployerJobs(hc handlerContext) error {
+	var jobList batchv1.JobList
+	if err := r.List(hc.ctx, &jobList, client.InNamespace(hc.function.Namespace), client.MatchingLabels{
+		"app":      "deployer",
+		"function": hc.function.Name,
+	}); err != nil {
+		return err
+	}
+
+	for _, job := range jobList.Items {
+		if err := r.Delete(hc.ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
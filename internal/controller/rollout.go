@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type rolloutState string
+
+const (
+	// backendsAttribute holds the rollout of each backend of the host, as a
+	// JSON list.
+	backendsAttribute = "backends"
+	// backendsAvailableCondition is True when the deployment of every backend
+	// of the host is available, so that the host is serving.
+	backendsAvailableCondition = "BackendsAvailable"
+
+	reasonBackendsAvailable    = "BackendsAvailable"
+	reasonBackendsProgressing  = "BackendsProgressing"
+	reasonBackendRolloutFailed = "BackendRolloutFailed"
+)
+
+const (
+	rolloutFailed      rolloutState = "failed"
+	rolloutProgressing rolloutState = "progressing"
+	rolloutReady       rolloutState = "ready"
+)
+
+// failingContainerReasons are the waiting reasons of containers that do not
+// recover without a change to the backend.
+var failingContainerReasons = []string{
+	"CrashLoopBackOff",
+	"CreateContainerConfigError",
+	"ErrImagePull",
+	"ImagePullBackOff",
+	"InvalidImageName",
+}
+
+// backendRollout summarizes the rollout of the workload of a backend.
+type backendRollout struct {
+	Desired int32 `json:"desired"`
+	// Kind is statefulset for the backends running in a StatefulSet, empty
+	// for those running in a Deployment.
+	Kind    string       `json:"kind,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Name    string       `json:"name"`
+	Ready   int32        `json:"ready"`
+	State   rolloutState `json:"state"`
+}
+
+// deploymentRollout derives the rollout state of the deployment from its
+// status and the status of its pods. A rollout is only ready once every
+// desired replica runs the current template and is available.
+func deploymentRollout(dep *appsv1.Deployment, pods []corev1.Pod) backendRollout {
+	desired := int32(1)
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+
+	rollout := backendRollout{
+		Desired: desired,
+		Name:    dep.Name,
+		Ready:   dep.Status.ReadyReplicas,
+		State:   rolloutFailed,
+	}
+
+	for _, cond := range dep.Status.Conditions {
+		switch {
+		case cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse &&
+			cond.Reason == "ProgressDeadlineExceeded":
+			rollout.Message = cond.Message
+			return rollout
+		case cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue:
+			rollout.Message = cond.Message
+			return rollout
+		}
+	}
+
+	if rollout.Message = failingContainer(pods); rollout.Message != "" {
+		return rollout
+	}
+
+	rollout.State = rolloutProgressing
+
+	switch {
+	case dep.Status.ObservedGeneration < dep.Generation:
+		rollout.Message = "waiting for the rollout to be observed"
+	case dep.Status.UpdatedReplicas < desired:
+		rollout.Message = fmt.Sprintf("%d of %d replicas updated", dep.Status.UpdatedReplicas, desired)
+	case dep.Status.Replicas > dep.Status.UpdatedReplicas:
+		rollout.Message = fmt.Sprintf("%d old replicas pending termination", dep.Status.Replicas-dep.Status.UpdatedReplicas)
+	case dep.Status.AvailableReplicas < desired:
+		rollout.Message = fmt.Sprintf("%d of %d replicas available", dep.Status.AvailableReplicas, desired)
+	default:
+		rollout.State = rolloutReady
+	}
+
+	return rollout
+}
+
+// statefulSetRollout derives the rollout state of the StatefulSet from its
+// status and the status of its pods, as deploymentRollout does for
+// Deployments. A StatefulSet reports no progress deadline, its rollout fails
+// only on the containers of its pods.
+func statefulSetRollout(sts *appsv1.StatefulSet, pods []corev1.Pod) backendRollout {
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+
+	rollout := backendRollout{
+		Desired: desired,
+		Kind:    "statefulset",
+		Name:    sts.Name,
+		Ready:   sts.Status.ReadyReplicas,
+		State:   rolloutFailed,
+	}
+
+	if rollout.Message = failingContainer(pods); rollout.Message != "" {
+		return rollout
+	}
+
+	rollout.State = rolloutProgressing
+
+	switch {
+	case sts.Status.ObservedGeneration < sts.Generation:
+		rollout.Message = "waiting for the rollout to be observed"
+	case sts.Status.UpdateRevision != "" && sts.Status.CurrentRevision != sts.Status.UpdateRevision:
+		rollout.Message = fmt.Sprintf("%d of %d replicas updated", sts.Status.UpdatedReplicas, desired)
+	case sts.Status.Replicas > desired:
+		rollout.Message = fmt.Sprintf("%d old replicas pending termination", sts.Status.Replicas-desired)
+	case sts.Status.AvailableReplicas < desired:
+		rollout.Message = fmt.Sprintf("%d of %d replicas available", sts.Status.AvailableReplicas, desired)
+	default:
+		rollout.State = rolloutReady
+	}
+
+	return rollout
+}
+
+// failingContainer describes the first container of the pods waiting for a
+// reason it does not recover from, empty when there is none.
+func failingContainer(pods []corev1.Pod) string {
+	for _, pod := range pods {
+		for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+			if status.State.Waiting != nil && slices.Contains(failingContainerReasons, status.State.Waiting.Reason) {
+				return fmt.Sprintf("container %s of pod %s is in %s", status.Name, pod.Name, status.State.Waiting.Reason)
+			}
+		}
+	}
+	return ""
+}
+
+// cronJobRollout reports a CronJob ready, as it has nothing to roll out: its
+// jobs run the current template when they are scheduled.
+func cronJobRollout(cronJob *batchv1.CronJob) backendRollout {
+	rollout := backendRollout{
+		Kind:  "cronjob",
+		Name:  cronJob.Name,
+		State: rolloutReady,
+	}
+	if cronJob.Status.LastScheduleTime != nil {
+		rollout.Message = "last scheduled at " + cronJob.Status.LastScheduleTime.UTC().Format(time.RFC3339)
+	}
+	return rollout
+}
+
+// workloadRollout returns the rollout of the Deployment, StatefulSet or
+// CronJob of a backend.
+func workloadRollout(workload client.Object, pods []corev1.Pod) backendRollout {
+	switch w := workload.(type) {
+	case *appsv1.StatefulSet:
+		return statefulSetRollout(w, pods)
+	case *batchv1.CronJob:
+		return cronJobRollout(w)
+	}
+	return deploymentRollout(workload.(*appsv1.Deployment), pods)
+}
+
+// backendRollouts returns the rollout of each workload. The pods of a
+// workload are only inspected while its rollout is incomplete.
+func (r *KDexInternalHostReconciler) backendRollouts(
+	ctx context.Context,
+	workloads []client.Object,
+) ([]backendRollout, error) {
+	rollouts := make([]backendRollout, 0, len(workloads))
+
+	for _, workload := range workloads {
+		rollout := workloadRollout(workload, nil)
+		if selector := workloadSelector(workload); rollout.State == rolloutProgressing && selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(selector)
+			if err != nil {
+				return nil, err
+			}
+
+			pods := &corev1.PodList{}
+			if err := r.List(ctx, pods, client.InNamespace(workload.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+				return nil, err
+			}
+
+			rollout = workloadRollout(workload, pods.Items)
+		}
+
+		rollouts = append(rollouts, rollout)
+	}
+
+	return rollouts, nil
+}
+
+// rollupBackends records the rollouts in the status of the host, one list of
+// the backends and the BackendsAvailable condition, and returns the messages
+// of the failed and of the progressing rollouts.
+func rollupBackends(internalHost *kdexv1alpha1.KDexInternalHost, rollouts []backendRollout) ([]string, []string) {
+	failed := []string{}
+	progressing := []string{}
+	for _, rollout := range rollouts {
+		internalHost.Status.Attributes[rollout.Name+".deployment"] = string(rollout.State)
+		internalHost.Status.Attributes[rollout.Name+".replicas"] = fmt.Sprintf("%d/%d", rollout.Ready, rollout.Desired)
+
+		kind := cmp.Or(rollout.Kind, "deployment")
+		switch rollout.State {
+		case rolloutFailed:
+			failed = append(failed, fmt.Sprintf("%s/%s: %s", kind, rollout.Name, rollout.Message))
+		case rolloutProgressing:
+			progressing = append(progressing, fmt.Sprintf("%s/%s: %s", kind, rollout.Name, rollout.Message))
+		}
+	}
+
+	sorted := slices.SortedFunc(slices.Values(rollouts), func(a, b backendRollout) int { return strings.Compare(a.Name, b.Name) })
+	backends, _ := json.Marshal(sorted)
+	internalHost.Status.Attributes[backendsAttribute] = string(backends)
+
+	condition := metav1.Condition{
+		Message: fmt.Sprintf("%d backends available", len(rollouts)),
+		Reason:  reasonBackendsAvailable,
+		Status:  metav1.ConditionTrue,
+		Type:    backendsAvailableCondition,
+	}
+	switch {
+	case len(failed) > 0:
+		condition.Message = strings.Join(failed, "; ")
+		condition.Reason = reasonBackendRolloutFailed
+		condition.Status = metav1.ConditionFalse
+	case len(progressing) > 0:
+		condition.Message = strings.Join(progressing, "; ")
+		condition.Reason = reasonBackendsProgressing
+		condition.Status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(&internalHost.Status.Conditions, condition)
+
+	return failed, progressing
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// routableCondition is True when the Ingress or the HTTPRoute of the host
+	// routes its domains: the Ingress has a load balancer address, or every
+	// Gateway the HTTPRoute is attached to accepted it.
+	routableCondition = "Routable"
+
+	reasonAddressAssigned  = "AddressAssigned"
+	reasonAddressPending   = "AddressPending"
+	reasonRouteAccepted    = "Accepted"
+	reasonRouteNotAccepted = "NotAccepted"
+	reasonRouteNotFound    = "RouteNotFound"
+
+	// addressesAttribute holds the comma separated external addresses of the
+	// host, the load balancer addresses of its Ingress or the addresses of the
+	// Gateways accepting its HTTPRoute.
+	addressesAttribute = "addresses"
+	// urlsAttribute holds the comma separated URLs of the domains of the host
+	// once it is routable.
+	urlsAttribute = "urls"
+)
+
+// ingressAddresses returns the load balancer addresses of the ingress.
+func ingressAddresses(ingress *networkingv1.Ingress) []string {
+	addresses := []string{}
+	for _, ing := range ingress.Status.LoadBalancer.Ingress {
+		if ing.IP != "" {
+			addresses = append(addresses, ing.IP)
+		} else if ing.Hostname != "" {
+			addresses = append(addresses, ing.Hostname)
+		}
+	}
+	return addresses
+}
+
+// setIngressRoutable sets the Routable condition and the addresses of the host
+// from the status of its ingress.
+func setIngressRoutable(internalHost *kdexv1alpha1.KDexInternalHost, ingress *networkingv1.Ingress) {
+	addresses := ingressAddresses(ingress)
+	if len(addresses) == 0 {
+		setRoutable(internalHost, metav1.ConditionFalse, reasonAddressPending, fmt.Sprintf("Ingress %s has no load balancer address yet", ingress.Name), nil)
+		return
+	}
+
+	setRoutable(internalHost, metav1.ConditionTrue, reasonAddressAssigned, fmt.Sprintf("Ingress %s is served at %s", ingress.Name, strings.Join(addresses, ",")), addresses)
+}
+
+// setHTTPRouteRoutable sets the Routable condition and the addresses of the
+// host from the status of its HTTPRoute and of the Gateways it is attached to.
+func (r *KDexInternalHostReconciler) setHTTPRouteRoutable(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost) error {
+	route := &gatewayv1.HTTPRoute{}
+	if err := r.Get(ctx, types.NamespacedName{Name: internalHost.Name, Namespace: internalHost.Namespace}, route); err != nil {
+		if apierrors.IsNotFound(err) {
+			setRoutable(internalHost, metav1.ConditionFalse, reasonRouteNotFound, fmt.Sprintf("HTTPRoute %s not found", internalHost.Name), nil)
+			return nil
+		}
+		return err
+	}
+
+	gateways := []*gatewayv1.Gateway{}
+	missing := []string{}
+	for _, parent := range route.Spec.ParentRefs {
+		if parent.Kind != nil && *parent.Kind != "Gateway" {
+			continue
+		}
+		namespace := route.Namespace
+		if parent.Namespace != nil {
+			namespace = string(*parent.Namespace)
+		}
+
+		gateway := &gatewayv1.Gateway{}
+		if err := r.Get(ctx, types.NamespacedName{Name: string(parent.Name), Namespace: namespace}, gateway); err != nil {
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, fmt.Sprintf("%s/%s", namespace, parent.Name))
+				continue
+			}
+			return err
+		}
+		gateways = append(gateways, gateway)
+	}
+	setGatewayConditions(internalHost, gateways, missing)
+
+	if len(route.Status.Parents) == 0 {
+		setRoutable(internalHost, metav1.ConditionFalse, reasonRouteNotAccepted, fmt.Sprintf("HTTPRoute %s is not attached to any Gateway yet", route.Name), nil)
+		return nil
+	}
+
+	for _, parent := range route.Status.Parents {
+		accepted := meta.FindStatusCondition(parent.Conditions, string(gatewayv1.RouteConditionAccepted))
+		if accepted == nil || accepted.Status != metav1.ConditionTrue {
+			message := "no Accepted condition"
+			if accepted != nil {
+				message = accepted.Message
+			}
+			setRoutable(internalHost, metav1.ConditionFalse, reasonRouteNotAccepted, fmt.Sprintf("HTTPRoute %s is not accepted by %s: %s", route.Name, parent.ParentRef.Name, message), nil)
+			return nil
+		}
+	}
+
+	addresses := []string{}
+	names := []string{}
+	for _, gateway := range gateways {
+		names = append(names, fmt.Sprintf("%s/%s", gateway.Namespace, gateway.Name))
+		for _, address := range gateway.Status.Addresses {
+			if !slices.Contains(addresses, address.Value) {
+				addresses = append(addresses, address.Value)
+			}
+		}
+	}
+
+	setRoutable(internalHost, metav1.ConditionTrue, reasonRouteAccepted, fmt.Sprintf("HTTPRoute %s is accepted by %s", route.Name, strings.Join(names, ",")), addresses)
+	return nil
+}
+
+// setRoutable sets the Routable condition of the host, its addresses and, when
+// routable, the URLs of its domains.
+func setRoutable(internalHost *kdexv1alpha1.KDexInternalHost, status metav1.ConditionStatus, reason string, message string, addresses []string) {
+	meta.SetStatusCondition(&internalHost.Status.Conditions, metav1.Condition{
+		Message: message,
+		Reason:  reason,
+		Status:  status,
+		Type:    routableCondition,
+	})
+
+	if len(addresses) > 0 {
+		internalHost.Status.Attributes[addressesAttribute] = strings.Join(addresses, ",")
+	} else {
+		delete(internalHost.Status.Attributes, addressesAttribute)
+	}
+
+	if status != metav1.ConditionTrue {
+		delete(internalHost.Status.Attributes, urlsAttribute)
+		return
+	}
+	urls := make([]string, 0, len(internalHost.Spec.Routing.Domains))
+	for _, domain := range internalHost.Spec.Routing.Domains {
+		urls = append(urls, fmt.Sprintf("%s://%s", internalHost.Spec.Routing.Scheme, domain))
+	}
+	internalHost.Status.Attributes[urlsAttribute] = strings.Join(urls, ",")
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// routingAnnotationsAnnotation holds, on a host, the JSON encoded
+	// annotations set on its Ingresses and HTTPRoute on every reconcile, e.g.
+	// {"nginx.ingress.kubernetes.io/limit-rps": "10", "external-dns.alpha.kubernetes.io/ttl": "60"}.
+	// They take precedence over the annotations of the ingress profile.
+	routingAnnotationsAnnotation = "kdex.dev/routing-annotations"
+	// appliedRoutingAnnotationsAnnotation records, on an Ingress or HTTPRoute,
+	// the keys of the routing annotations set on it, so that those no longer
+	// declared are removed.
+	appliedRoutingAnnotationsAnnotation = "kdex.dev/applied-routing-annotations"
+)
+
+// parseRoutingAnnotations returns the annotations of
+// routingAnnotationsAnnotation, nil when it is not set.
+func parseRoutingAnnotations(annotations map[string]string) (map[string]string, error) {
+	value := annotations[routingAnnotationsAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	routing := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &routing); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", routingAnnotationsAnnotation, err)
+	}
+
+	for key := range routing {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s annotation: key %q: %s", routingAnnotationsAnnotation, key, strings.Join(errs, ", "))
+		}
+		if strings.HasPrefix(key, "kdex.dev/") {
+			return nil, fmt.Errorf("invalid %s annotation: key %q is reserved", routingAnnotationsAnnotation, key)
+		}
+	}
+
+	return routing, nil
+}
+
+// applyRoutingAnnotations sets the routing annotations on the object and
+// removes those it was previously given which are no longer declared.
+func applyRoutingAnnotations(obj client.Object, routing map[string]string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	for key := range strings.SplitSeq(annotations[appliedRoutingAnnotationsAnnotation], ",") {
+		if _, ok := routing[key]; !ok {
+			delete(annotations, key)
+		}
+	}
+	delete(annotations, appliedRoutingAnnotationsAnnotation)
+
+	keys := make([]string, 0, len(routing))
+	for key, value := range routing {
+		annotations[key] = value
+		keys = append(keys, key)
+	}
+	if len(keys) > 0 {
+		slices.Sort(keys)
+		annotations[appliedRoutingAnnotationsAnnotation] = strings.Join(keys, ",")
+	}
+
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// backendRuntimeEnvAnnotation set to "true" on the object declaring a
+	// backend injects the runtime settings as env vars in addition to the
+	// mounted files.
+	backendRuntimeEnvAnnotation = "kdex.dev/backend-runtime-env"
+
+	runtimeConfigVersionAttribute = "runtime-config.version"
+)
+
+// createOrUpdateRuntimeConfig projects the runtime settings of the host into
+// the ConfigMap mounted by its backends.
+func (r *KDexInternalHostReconciler) createOrUpdateRuntimeConfig(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+) (controllerutil.OperationResult, *corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      child.RuntimeConfigName(internalHost.Name),
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	op, err := ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		configMap,
+		func() error {
+			configMap.Labels = child.StampLabels(configMap.Labels, map[string]string{
+				"kdex.dev/host": internalHost.Name,
+			})
+			configMap.Data = child.RuntimeConfigData(&internalHost.Spec.KDexHostSpec)
+
+			return ctrl.SetControllerReference(internalHost, configMap, r.Scheme)
+		},
+	)
+	if err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	return op, configMap, nil
+}
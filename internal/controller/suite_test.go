@@ -219,6 +219,7 @@ var _ = BeforeSuite(func() {
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
 		Port:                8090,
+		Recorder:            k8sManager.GetEventRecorder("kdexinternalhost"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              k8sManager.GetScheme(),
 		ServiceName:         focalHost,
@@ -232,6 +233,7 @@ var _ = BeforeSuite(func() {
 		ControllerNamespace: namespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            k8sManager.GetEventRecorder("kdexpagebinding"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              k8sManager.GetScheme(),
 	}
@@ -243,6 +245,7 @@ var _ = BeforeSuite(func() {
 		ControllerNamespace: namespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            k8sManager.GetEventRecorder("kdexinternaltranslation"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              k8sClient.Scheme(),
 	}
@@ -254,6 +257,7 @@ var _ = BeforeSuite(func() {
 		ControllerNamespace: namespace,
 		FocalHost:           focalHost,
 		HostHandler:         hostHandler,
+		Recorder:            k8sManager.GetEventRecorder("kdexinternalutilitypage"),
 		RequeueDelay:        requeueDelay,
 		Scheme:              k8sManager.GetScheme(),
 	}
@@ -264,6 +268,7 @@ var _ = BeforeSuite(func() {
 		Client:        k8sManager.GetClient(),
 		Configuration: configuration,
 		HostHandler:   hostHandler,
+		Recorder:      k8sManager.GetEventRecorder("kdexfunction"),
 		RequeueDelay:  requeueDelay,
 		Scheme:        k8sManager.GetScheme(),
 	}
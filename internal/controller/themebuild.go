@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	kjob "github.com/kdex-tech/host-manager/internal/job"
+	"github.com/kdex-tech/host-manager/internal/themebuild"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// themeStatusAndSpec returns the status and the spec of a KDexTheme or a
+// KDexClusterTheme.
+func themeStatusAndSpec(theme client.Object) (*kdexv1alpha1.KDexObjectStatus, *kdexv1alpha1.KDexThemeSpec) {
+	switch v := theme.(type) {
+	case *kdexv1alpha1.KDexTheme:
+		return &v.Status, &v.Spec
+	case *kdexv1alpha1.KDexClusterTheme:
+		return &v.Status, &v.Spec
+	}
+	return nil, nil
+}
+
+// applyThemeBuild serves the compiled asset image of a theme with SCSS
+// sources as the static image of its backend, and preloads its fonts.
+func applyThemeBuild(theme client.Object) {
+	if theme == nil || theme.GetAnnotations()[themebuild.SourcesAnnotation] == "" {
+		return
+	}
+	status, spec := themeStatusAndSpec(theme)
+	if status == nil || status.Attributes[themebuild.ImageAttribute] == "" {
+		return
+	}
+	spec.StaticImage = status.Attributes[themebuild.ImageAttribute]
+
+	if status.Attributes[themebuild.PreloadAttribute] == "" {
+		return
+	}
+	preloads := kdexv1alpha1.Assets{}
+	for file := range strings.SplitSeq(status.Attributes[themebuild.PreloadAttribute], ",") {
+		preloads = append(preloads, kdexv1alpha1.Asset{
+			Attributes: map[string]string{
+				"as":          "font",
+				"crossorigin": "anonymous",
+				"rel":         "preload",
+				"type":        "font/woff2",
+			},
+			LinkHref: path.Join(spec.IngressPath, file),
+		})
+	}
+	spec.Assets = append(preloads, spec.Assets...)
+}
+
+// buildTheme compiles the SCSS sources of the theme, when it has some, into
+// an asset image whose reference and file digests are recorded in the status
+// of the theme. The host waits for the first build of the theme, later ones
+// keep serving the previous image until they complete.
+func (r *KDexInternalHostReconciler) buildTheme(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	theme client.Object,
+) (bool, ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	fail := func(err error) (bool, ctrl.Result, error) {
+		kdexv1alpha1.SetConditions(
+			&internalHost.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionTrue,
+				Progressing: metav1.ConditionFalse,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconcileError,
+			err.Error(),
+		)
+		return true, ctrl.Result{}, err
+	}
+
+	sourcesName := theme.GetAnnotations()[themebuild.SourcesAnnotation]
+	if sourcesName == "" {
+		if theme.GetAnnotations()[themebuild.FontsAnnotation] != "" {
+			return fail(fmt.Errorf("theme %s declares fonts without %s", theme.GetName(), themebuild.SourcesAnnotation))
+		}
+		return false, ctrl.Result{}, nil
+	}
+
+	status, _ := themeStatusAndSpec(theme)
+	if status == nil {
+		return false, ctrl.Result{}, nil
+	}
+	if status.Attributes == nil {
+		status.Attributes = map[string]string{}
+	}
+
+	built := status.Attributes[themebuild.ImageAttribute] != ""
+
+	fonts, err := themebuild.ParseFonts(theme.GetAnnotations())
+	if err != nil {
+		return fail(err)
+	}
+
+	unicodes := ""
+	if len(fonts) > 0 {
+		langs, err := r.hostLanguages(ctx, internalHost)
+		if err != nil {
+			return fail(err)
+		}
+		unicodes = themebuild.UnicodeRanges(langs)
+	}
+
+	namespace := theme.GetNamespace()
+	if namespace == "" {
+		namespace = r.ControllerNamespace
+	}
+
+	sources := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: sourcesName}, sources); err != nil {
+		return fail(fmt.Errorf("failed to get sources %s/%s of theme %s: %w", namespace, sourcesName, theme.GetName(), err))
+	}
+
+	npmSecretRef, pullSecretRefs := builderSecretRefs(internalHost)
+
+	builder := themebuild.ThemeBuild{
+		Client: r.Client,
+		// TODO: make configurable
+		BuilderImage: "node:25-alpine",
+		// TODO: make configurable
+		FontBuilderImage:  "python:3.13-alpine",
+		Fonts:             fonts,
+		ImagePullSecrets:  pullSecretRefs,
+		ImageRegistry:     internalHost.Spec.Registries.ImageRegistry,
+		Log:               log,
+		NPMSecretRef:      npmSecretRef,
+		PackageBuilder:    &r.Configuration.PackageBuilder,
+		Scheme:            r.Scheme,
+		ServiceAccountRef: internalHost.Spec.ServiceAccountRef,
+		Unicodes:          unicodes,
+	}
+
+	checksum := builder.Checksum(sources)
+	if built && status.Attributes[themebuild.SourcesAttribute] == checksum {
+		return false, ctrl.Result{}, nil
+	}
+
+	job, err := builder.GetOrCreateJob(ctx, internalHost, theme, sources)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := r.cleanupThemeBuilds(ctx, internalHost, theme, checksum); err != nil {
+		return fail(err)
+	}
+
+	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+		message := fmt.Sprintf("Waiting on theme build job %s/%s to complete", job.Namespace, job.Name)
+		log.V(2).Info(message)
+
+		if built {
+			return false, ctrl.Result{}, nil
+		}
+
+		kdexv1alpha1.SetConditions(
+			&internalHost.Status.Conditions,
+			kdexv1alpha1.ConditionStatuses{
+				Degraded:    metav1.ConditionFalse,
+				Progressing: metav1.ConditionTrue,
+				Ready:       metav1.ConditionFalse,
+			},
+			kdexv1alpha1.ConditionReasonReconciling,
+			message,
+		)
+		return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	pod, err := kjob.GetPodForJob(ctx, r.Client, job)
+	if err != nil {
+		return fail(err)
+	}
+
+	if job.Status.Failed > 0 {
+		var message string
+		for _, containerStatus := range pod.Status.InitContainerStatuses {
+			if containerStatus.State.Terminated != nil && containerStatus.State.Terminated.ExitCode != 0 {
+				message = containerStatus.State.Terminated.Message
+			}
+		}
+		err := fmt.Errorf("theme build job %s/%s failed: %s", job.Namespace, job.Name, message)
+		r.Recorder.Eventf(theme, job, corev1.EventTypeWarning, EventReasonBuildFailed, "Build", "%s", err.Error())
+		if built {
+			// The failed job is kept until the sources change, the previous
+			// image is served meanwhile.
+			log.Error(err, "keeping previous theme image", "theme", theme.GetName())
+			return false, ctrl.Result{}, nil
+		}
+		return fail(err)
+	}
+
+	result := builder.Harvest(internalHost, theme, pod)
+	if result == nil {
+		// Job reported success but we can't find the outputs yet? Wait a bit.
+		return true, ctrl.Result{RequeueAfter: r.RequeueDelay}, nil
+	}
+
+	status.Attributes[themebuild.DigestsAttribute] = themebuild.FormatDigests(result.Digests)
+	status.Attributes[themebuild.ImageAttribute] = result.Image
+	if len(result.Preload) > 0 {
+		status.Attributes[themebuild.PreloadAttribute] = strings.Join(result.Preload, ",")
+	} else {
+		delete(status.Attributes, themebuild.PreloadAttribute)
+	}
+	status.Attributes[themebuild.SourcesAttribute] = checksum
+	if err := r.Status().Update(ctx, theme); err != nil {
+		return true, ctrl.Result{}, err
+	}
+
+	r.Recorder.Eventf(theme, job, corev1.EventTypeNormal, EventReasonImageBuilt, "Build", "Built image %s", result.Image)
+	log.V(1).Info("theme image ready", "theme", theme.GetName(), "image", result.Image)
+
+	return false, ctrl.Result{}, nil
+}
+
+// hostLanguages returns the default language of the host and the languages
+// of its translations, which the fonts of its themes are subset to.
+func (r *KDexInternalHostReconciler) hostLanguages(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+) ([]string, error) {
+	langs := []string{internalHost.Spec.DefaultLang}
+
+	var translations kdexv1alpha1.KDexInternalTranslationList
+	if err := r.List(ctx, &translations, client.InNamespace(internalHost.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list translations of host %s: %w", internalHost.Name, err)
+	}
+	for _, translation := range translations.Items {
+		if translation.Spec.HostRef.Name != internalHost.Name {
+			continue
+		}
+		for _, t := range translation.Spec.Translations {
+			langs = append(langs, t.Lang)
+		}
+	}
+	return langs, nil
+}
+
+// cleanupThemeBuilds deletes the completed build jobs of previous sources of
+// the theme, with their copy of the sources.
+func (r *KDexInternalHostReconciler) cleanupThemeBuilds(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	theme client.Object,
+	checksum string,
+) error {
+	log := logf.FromContext(ctx)
+
+	var jobList batchv1.JobList
+	if err := r.List(ctx, &jobList, client.InNamespace(internalHost.Namespace), client.MatchingLabels(themebuild.JobLabels(theme))); err != nil {
+		return err
+	}
+
+	for _, job := range jobList.Items {
+		if job.Labels["kdex.dev/generation"] == checksum || (job.Status.Succeeded == 0 && job.Status.Failed == 0) {
+			continue
+		}
+		if !metav1.IsControlledBy(&job, internalHost) {
+			continue
+		}
+
+		log.V(2).Info("Cleaning up obsolete theme build", "job", job.Name)
+		if err := r.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace}}
+		if err := r.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var tracer = otel.Tracer("github.com/kdex-tech/host-manager/internal/controller")
+
+// startReconcileSpan starts the span of a reconcile of the resource of the
+// kind, the parent of the spans of the calls made while reconciling it.
+func startReconcileSpan(ctx context.Context, kind string, req ctrl.Request) (context.Context, trace.Span) {
+	return tracer.Start(ctx, kind+" reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("kdex.kind", kind),
+		attribute.String("kdex.name", req.Name),
+	))
+}
+
+// endReconcileSpan ends the span of a reconcile which ended with res and err.
+func endReconcileSpan(span trace.Span, res ctrl.Result, err error) {
+	if res.RequeueAfter > 0 {
+		span.SetAttributes(attribute.String("kdex.requeue_after", res.RequeueAfter.String()))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
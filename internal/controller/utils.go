@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"os"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -74,6 +76,41 @@ func HashScriptDef(script kdexv1alpha1.ScriptDef) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// PodConfigChecksum hashes the parts of a pod spec that configure its
+// containers (images, env and volumes). Recording it on the pod template rolls
+// the pods whenever any of them changes, even when the change alone would not.
+func PodConfigChecksum(spec *corev1.PodSpec) (string, error) {
+	type containerConfig struct {
+		Env     []corev1.EnvVar        `json:"env,omitempty"`
+		EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+		Image   string                 `json:"image"`
+		Name    string                 `json:"name"`
+	}
+
+	config := struct {
+		Containers []containerConfig `json:"containers"`
+		Volumes    []corev1.Volume   `json:"volumes,omitempty"`
+	}{
+		Volumes: spec.Volumes,
+	}
+	for _, c := range append(slices.Clone(spec.InitContainers), spec.Containers...) {
+		config.Containers = append(config.Containers, containerConfig{
+			Env:     c.Env,
+			EnvFrom: c.EnvFrom,
+			Image:   c.Image,
+			Name:    c.Name,
+		})
+	}
+
+	bytes, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(bytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
 // nolint:gocyclo
 func MakeHandlerByReferencePath(
 	c client.Client,
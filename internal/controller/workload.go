@@ -0,0 +1,635 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/kdex-tech/host-manager/internal/child"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// backendWorkloadAnnotation holds, on the object declaring a backend, the
+	// JSON encoded backendWorkload running it, e.g. {"kind": "StatefulSet",
+	// "volumeClaimTemplates": [{"metadata": {"name": "data"}, "spec":
+	// {"accessModes": ["ReadWriteOnce"], "resources": {"requests":
+	// {"storage": "1Gi"}}}}], "volumeMounts": [{"name": "data",
+	// "mountPath": "/data"}]} or {"kind": "CronJob", "schedule": "0 3 * * *"}.
+	// Backends run in a Deployment when it is not set.
+	backendWorkloadAnnotation = "kdex.dev/backend-workload"
+
+	// headlessServiceSuffix is appended to the name of the StatefulSet of a
+	// backend to name the headless Service governing it.
+	headlessServiceSuffix = "-headless"
+)
+
+// backendWorkload runs a backend needing stable storage, e.g. a small database
+// or a CMS, in a StatefulSet, or a periodic backend, e.g. a sitemap generator
+// or a cache warmer, in a CronJob rather than a Deployment. A CronJob backend
+// serves no requests: it has no ingress path, Service, HorizontalPodAutoscaler
+// or PodDisruptionBudget.
+type backendWorkload struct {
+	// ConcurrencyPolicy is that of the CronJob, Allow by default.
+	ConcurrencyPolicy batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// FailedJobsHistoryLimit is the number of failed jobs the CronJob keeps,
+	// 1 by default.
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// Kind is Deployment, the default, StatefulSet or CronJob.
+	Kind string `json:"kind,omitempty"`
+	// Schedule is the cron schedule of the CronJob, e.g. "*/15 * * * *".
+	Schedule string `json:"schedule,omitempty"`
+	// SuccessfulJobsHistoryLimit is the number of successful jobs the CronJob
+	// keeps, 3 by default.
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// TimeZone is the time zone of the schedule, that of the cluster by
+	// default.
+	TimeZone *string `json:"timeZone,omitempty"`
+	// VolumeClaimTemplates are those of the StatefulSet. They are set when
+	// the StatefulSet is created and its claims outlive the backend.
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+	// VolumeMounts mount the claims of the VolumeClaimTemplates in the
+	// backend container.
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// parseBackendWorkload returns the workload of the annotations of the object
+// declaring a backend, nil when the backend runs in a Deployment.
+func parseBackendWorkload(annotations map[string]string) (*backendWorkload, error) {
+	value := annotations[backendWorkloadAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	workload := &backendWorkload{}
+	if err := json.Unmarshal([]byte(value), workload); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", backendWorkloadAnnotation, err)
+	}
+
+	scheduled := workload.Schedule != "" || workload.ConcurrencyPolicy != "" || workload.TimeZone != nil ||
+		workload.FailedJobsHistoryLimit != nil || workload.SuccessfulJobsHistoryLimit != nil
+	claimed := len(workload.VolumeClaimTemplates) > 0 || len(workload.VolumeMounts) > 0
+
+	switch workload.Kind {
+	case "", "Deployment":
+		if claimed || scheduled {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: volumeClaimTemplates and volumeMounts require the StatefulSet kind, "+
+					"the schedule and the jobs history limits the CronJob kind",
+				backendWorkloadAnnotation,
+			)
+		}
+		return nil, nil
+	case "CronJob":
+		return workload, validateSchedule(workload, claimed)
+	case "StatefulSet":
+		if scheduled {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: the schedule and the jobs history limits require the CronJob kind",
+				backendWorkloadAnnotation,
+			)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"invalid %s annotation kind %q, expected Deployment, StatefulSet or CronJob",
+			backendWorkloadAnnotation, workload.Kind,
+		)
+	}
+
+	claims := map[string]bool{}
+	for _, template := range workload.VolumeClaimTemplates {
+		if template.Name == "" {
+			return nil, fmt.Errorf("invalid %s annotation: volumeClaimTemplates require a name", backendWorkloadAnnotation)
+		}
+		claims[template.Name] = true
+	}
+	for _, mount := range workload.VolumeMounts {
+		if !claims[mount.Name] || mount.MountPath == "" {
+			return nil, fmt.Errorf(
+				"invalid %s annotation: volumeMounts require the name of a volumeClaimTemplate and a mountPath",
+				backendWorkloadAnnotation,
+			)
+		}
+	}
+
+	return workload, nil
+}
+
+// validateSchedule validates the CronJob of a backend workload.
+func validateSchedule(workload *backendWorkload, claimed bool) error {
+	if claimed {
+		return fmt.Errorf(
+			"invalid %s annotation: volumeClaimTemplates and volumeMounts require the StatefulSet kind",
+			backendWorkloadAnnotation,
+		)
+	}
+	if !validSchedule(workload.Schedule) {
+		return fmt.Errorf(
+			"invalid %s annotation schedule %q, expected 5 cron fields or a macro such as @daily",
+			backendWorkloadAnnotation, workload.Schedule,
+		)
+	}
+	switch workload.ConcurrencyPolicy {
+	case "", batchv1.AllowConcurrent, batchv1.ForbidConcurrent, batchv1.ReplaceConcurrent:
+	default:
+		return fmt.Errorf(
+			"invalid %s annotation concurrencyPolicy %q, expected Allow, Forbid or Replace",
+			backendWorkloadAnnotation, workload.ConcurrencyPolicy,
+		)
+	}
+	for _, limit := range []*int32{workload.FailedJobsHistoryLimit, workload.SuccessfulJobsHistoryLimit} {
+		if limit != nil && *limit < 0 {
+			return fmt.Errorf("invalid %s annotation: the jobs history limits can not be negative", backendWorkloadAnnotation)
+		}
+	}
+	return nil
+}
+
+// validSchedule checks the shape of a cron schedule, the API server checks
+// its fields.
+func validSchedule(schedule string) bool {
+	if strings.HasPrefix(schedule, "@") {
+		return slices.Contains(
+			[]string{"@annually", "@daily", "@hourly", "@midnight", "@monthly", "@weekly", "@yearly"}, schedule,
+		)
+	}
+	fields := strings.Fields(schedule)
+	return len(fields) == 5 && !slices.ContainsFunc(fields, func(field string) bool {
+		return strings.Trim(field, "0123456789*/,-?ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz") != ""
+	})
+}
+
+// scheduled reports whether the backend runs in a CronJob, serving no
+// requests.
+func (w *backendWorkload) scheduled() bool {
+	return w != nil && w.Kind == "CronJob"
+}
+
+// setVolumeMounts adds the mounts to the container, replacing its mounts of
+// the same names.
+func setVolumeMounts(container *corev1.Container, mounts []corev1.VolumeMount) {
+	for _, mount := range mounts {
+		idx := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == mount.Name })
+		if idx == -1 {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		} else {
+			container.VolumeMounts[idx] = mount
+		}
+	}
+}
+
+// backendReplicas returns the replicas of the workload of the backend. The
+// replicas of an autoscaled backend belong to its HorizontalPodAutoscaler once
+// the workload exists.
+func backendReplicas(
+	replicas *int32,
+	exists bool,
+	backend *kdexv1alpha1.Backend,
+	autoscaling *backendAutoscaling,
+) *int32 {
+	switch {
+	case autoscaling != nil && !exists:
+		return autoscaling.MinReplicas
+	case autoscaling != nil:
+		return replicas
+	case backend.Replicas != nil:
+		return backend.Replicas
+	}
+	return replicas
+}
+
+// workloadKind returns the kind of the workload of a backend.
+func workloadKind(workload client.Object) string {
+	switch workload.(type) {
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *batchv1.CronJob:
+		return "CronJob"
+	}
+	return "Deployment"
+}
+
+// workloadSelector returns the selector of the pods of the workload of a
+// backend, nil for a CronJob, whose pods are those of its jobs.
+func workloadSelector(workload client.Object) *metav1.LabelSelector {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return w.Spec.Selector
+	case *appsv1.StatefulSet:
+		return w.Spec.Selector
+	}
+	return nil
+}
+
+// workloadServes reports whether the workload of a backend serves requests,
+// i.e. is not a CronJob.
+func workloadServes(workload client.Object) bool {
+	_, ok := workload.(*batchv1.CronJob)
+	return !ok
+}
+
+// workloadPodTemplate returns the pod template of the workload of a backend.
+func workloadPodTemplate(workload client.Object) *corev1.PodTemplateSpec {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *batchv1.CronJob:
+		return &w.Spec.JobTemplate.Spec.Template
+	}
+	return nil
+}
+
+// createOrUpdateBackendWorkload maintains the Deployment or, per the workload,
+// the StatefulSet or the CronJob running the backend and deletes the others,
+// so that a backend changing kinds is moved from one to the other.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendWorkload(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	name string,
+	resolvedBackend resolvedBackend,
+	runtimeConfig *corev1.ConfigMap,
+	autoscaling *backendAutoscaling,
+	availability *backendAvailability,
+	workload *backendWorkload,
+) (controllerutil.OperationResult, client.Object, error) {
+	meta := metav1.ObjectMeta{Name: name, Namespace: internalHost.Namespace}
+
+	kind := "Deployment"
+	if workload != nil {
+		kind = workload.Kind
+	}
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{ObjectMeta: meta},
+		&appsv1.StatefulSet{ObjectMeta: *meta.DeepCopy()},
+		// The jobs of the CronJob are deleted with it.
+		&batchv1.CronJob{ObjectMeta: *meta.DeepCopy()},
+	} {
+		if workloadKind(obj) == kind {
+			continue
+		}
+		if err := r.Delete(
+			ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground),
+		); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, nil, err
+		}
+	}
+
+	var op controllerutil.OperationResult
+	var obj client.Object
+	var err error
+	switch kind {
+	case "CronJob":
+		op, obj, err = r.createOrUpdateBackendCronJob(ctx, internalHost, name, resolvedBackend, runtimeConfig, availability, workload)
+	case "StatefulSet":
+		op, obj, err = r.createOrUpdateBackendStatefulSet(
+			ctx, internalHost, name, resolvedBackend, runtimeConfig, autoscaling, availability, workload,
+		)
+	default:
+		op, obj, err = r.createOrUpdateBackendDeployment(
+			ctx, internalHost, name, resolvedBackend, runtimeConfig, autoscaling, availability,
+		)
+	}
+	if err != nil {
+		return op, nil, err
+	}
+	return op, obj, nil
+}
+
+// createOrUpdateBackendStatefulSet maintains the StatefulSet of the backend,
+// whose pods are those of its Deployment with the claims of the workload
+// mounted.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendStatefulSet(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	name string,
+	resolvedBackend resolvedBackend,
+	runtimeConfig *corev1.ConfigMap,
+	autoscaling *backendAutoscaling,
+	availability *backendAvailability,
+	workload *backendWorkload,
+) (controllerutil.OperationResult, *appsv1.StatefulSet, error) {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	backend := resolvedBackend.Backend.DeepCopy()
+	child.DefaultBackend(backend, &r.Configuration.BackendDefault)
+
+	stamp := map[string]string{
+		"kdex.dev/backend": resolvedBackend.Name,
+		"kdex.dev/host":    internalHost.Name,
+		"kdex.dev/kind":    resolvedBackend.Kind,
+		"kdex.dev/type":    internal.BACKEND,
+	}
+
+	op, err := ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		statefulSet,
+		func() error {
+			if statefulSet.CreationTimestamp.IsZero() {
+				statefulSet.Annotations = make(map[string]string)
+				maps.Copy(statefulSet.Annotations, internalHost.Annotations)
+				statefulSet.Labels = make(map[string]string)
+				maps.Copy(statefulSet.Labels, internalHost.Labels)
+
+				statefulSet.Labels = child.StampLabels(statefulSet.Labels, stamp)
+
+				defaults := r.getMemoizedBackendDeployment().DeepCopy()
+				statefulSet.Spec = appsv1.StatefulSetSpec{
+					MinReadySeconds:      defaults.MinReadySeconds,
+					Replicas:             defaults.Replicas,
+					RevisionHistoryLimit: defaults.RevisionHistoryLimit,
+					Selector:             defaults.Selector,
+					ServiceName:          name + headlessServiceSuffix,
+					Template:             defaults.Template,
+				}
+				if statefulSet.Spec.Selector == nil {
+					statefulSet.Spec.Selector = &metav1.LabelSelector{}
+				}
+				for _, template := range workload.VolumeClaimTemplates {
+					statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates, *template.DeepCopy())
+				}
+
+				statefulSet.Spec.Selector.MatchLabels = child.StampLabels(statefulSet.Spec.Selector.MatchLabels, stamp)
+				statefulSet.Spec.Template.Labels = child.StampLabels(statefulSet.Spec.Template.Labels, stamp)
+			}
+
+			if err := r.mutateBackendPodTemplate(
+				ctx,
+				internalHost,
+				resolvedBackend,
+				backend,
+				&statefulSet.Spec.Template,
+				statefulSet.Spec.Selector.MatchLabels,
+				runtimeConfig,
+				availability,
+				workload,
+			); err != nil {
+				return err
+			}
+
+			statefulSet.Spec.Replicas = backendReplicas(
+				statefulSet.Spec.Replicas, !statefulSet.CreationTimestamp.IsZero(), backend, autoscaling,
+			)
+
+			return ctrl.SetControllerReference(internalHost, statefulSet, r.Scheme)
+		},
+	)
+	if err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	return op, statefulSet, nil
+}
+
+// createOrUpdateBackendCronJob maintains the CronJob of a periodic backend,
+// whose jobs run the pods of its Deployment, without their probes, until
+// their backend container exits.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendCronJob(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	name string,
+	resolvedBackend resolvedBackend,
+	runtimeConfig *corev1.ConfigMap,
+	availability *backendAvailability,
+	workload *backendWorkload,
+) (controllerutil.OperationResult, *batchv1.CronJob, error) {
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	backend := resolvedBackend.Backend.DeepCopy()
+	child.DefaultBackend(backend, &r.Configuration.BackendDefault)
+
+	stamp := map[string]string{
+		"kdex.dev/backend": resolvedBackend.Name,
+		"kdex.dev/host":    internalHost.Name,
+		"kdex.dev/kind":    resolvedBackend.Kind,
+		"kdex.dev/type":    internal.BACKEND,
+	}
+
+	op, err := ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		cronJob,
+		func() error {
+			template := &cronJob.Spec.JobTemplate.Spec.Template
+			if cronJob.CreationTimestamp.IsZero() {
+				cronJob.Annotations = make(map[string]string)
+				maps.Copy(cronJob.Annotations, internalHost.Annotations)
+				cronJob.Labels = make(map[string]string)
+				maps.Copy(cronJob.Labels, internalHost.Labels)
+
+				cronJob.Labels = child.StampLabels(cronJob.Labels, stamp)
+
+				*template = *r.getMemoizedBackendDeployment().Template.DeepCopy()
+				template.Labels = child.StampLabels(template.Labels, stamp)
+			}
+
+			if err := r.mutateBackendPodTemplate(
+				ctx,
+				internalHost,
+				resolvedBackend,
+				backend,
+				template,
+				maps.Clone(stamp),
+				runtimeConfig,
+				availability,
+				workload,
+			); err != nil {
+				return err
+			}
+
+			// The probes of a server would fail, or restart, a job.
+			container := &template.Spec.Containers[0]
+			container.LivenessProbe = nil
+			container.ReadinessProbe = nil
+			container.StartupProbe = nil
+			if template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+				template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+			}
+
+			cronJob.Spec.ConcurrencyPolicy = cmp.Or(workload.ConcurrencyPolicy, batchv1.AllowConcurrent)
+			cronJob.Spec.FailedJobsHistoryLimit = workload.FailedJobsHistoryLimit
+			cronJob.Spec.Schedule = workload.Schedule
+			cronJob.Spec.SuccessfulJobsHistoryLimit = workload.SuccessfulJobsHistoryLimit
+			cronJob.Spec.TimeZone = workload.TimeZone
+
+			return ctrl.SetControllerReference(internalHost, cronJob, r.Scheme)
+		},
+	)
+	if err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	return op, cronJob, nil
+}
+
+// createOrUpdateBackendHeadlessService maintains the headless Service
+// governing the StatefulSet of the backend, giving its pods stable names, or
+// deletes it when the backend runs in a Deployment.
+func (r *KDexInternalHostReconciler) createOrUpdateBackendHeadlessService(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	name string,
+	resolvedBackend resolvedBackend,
+	workload *backendWorkload,
+) (controllerutil.OperationResult, error) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + headlessServiceSuffix,
+			Namespace: internalHost.Namespace,
+		},
+	}
+
+	if workload == nil {
+		if err := r.Delete(ctx, service); err != nil && !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultNone, nil
+	}
+
+	stamp := map[string]string{
+		"kdex.dev/backend": resolvedBackend.Name,
+		"kdex.dev/host":    internalHost.Name,
+		"kdex.dev/kind":    resolvedBackend.Kind,
+		"kdex.dev/type":    internal.BACKEND,
+	}
+
+	return ctrl.CreateOrUpdate(
+		ctx,
+		r.Client,
+		service,
+		func() error {
+			service.Labels = child.StampLabels(service.Labels, stamp)
+
+			// The cluster IP of a service can not change once it exists.
+			if service.CreationTimestamp.IsZero() {
+				service.Spec.ClusterIP = corev1.ClusterIPNone
+			}
+			service.Spec.Ports = nil
+			for _, port := range r.getMemoizedService().Ports {
+				service.Spec.Ports = append(service.Spec.Ports, *port.DeepCopy())
+			}
+			// The peers of a StatefulSet find each other before they are
+			// ready.
+			service.Spec.PublishNotReadyAddresses = true
+			service.Spec.Selector = maps.Clone(stamp)
+
+			return ctrl.SetControllerReference(internalHost, service, r.Scheme)
+		},
+	)
+}
+
+// cleanupObsoleteCronJobs deletes the CronJobs, and their jobs, of the
+// backends no longer required by the host once their grace period elapsed.
+// It returns the time left until the next one is due.
+func (r *KDexInternalHostReconciler) cleanupObsoleteCronJobs(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backendNames map[string]bool,
+	labelSelector client.MatchingLabels,
+	grace time.Duration,
+) (time.Duration, error) {
+	cronJobList := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
+		return 0, err
+	}
+
+	var next time.Duration
+	for _, cronJob := range cronJobList.Items {
+		if backendNames[cronJob.Name] {
+			if err := r.reviveRequired(ctx, &cronJob); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		due, left, err := r.retireObsolete(ctx, internalHost, &cronJob, "CronJob", grace)
+		if err != nil {
+			return 0, err
+		}
+		next = nextRetirement(next, left)
+		if !due {
+			continue
+		}
+
+		if err := r.Delete(
+			ctx, &cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground),
+		); err != nil && !apierrors.IsNotFound(err) {
+			return 0, err
+		}
+		r.recordBackendDeleted(internalHost, &cronJob, "CronJob")
+		delete(internalHost.Status.Attributes, cronJob.Name+".deployment")
+		delete(internalHost.Status.Attributes, cronJob.Name+".replicas")
+	}
+
+	return next, nil
+}
+
+// cleanupObsoleteStatefulSets deletes the StatefulSets of the backends no
+// longer required by the host once their grace period elapsed. The claims of
+// their volumes are kept. It returns the time left until the next one is due.
+func (r *KDexInternalHostReconciler) cleanupObsoleteStatefulSets(
+	ctx context.Context,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	backendNames map[string]bool,
+	labelSelector client.MatchingLabels,
+	grace time.Duration,
+) (time.Duration, error) {
+	statefulSetList := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, statefulSetList, client.InNamespace(internalHost.Namespace), labelSelector); err != nil {
+		return 0, err
+	}
+
+	var next time.Duration
+	for _, statefulSet := range statefulSetList.Items {
+		if backendNames[statefulSet.Name] {
+			if err := r.reviveRequired(ctx, &statefulSet); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		due, left, err := r.retireObsolete(ctx, internalHost, &statefulSet, "StatefulSet", grace)
+		if err != nil {
+			return 0, err
+		}
+		next = nextRetirement(next, left)
+		if !due {
+			continue
+		}
+
+		if err := r.Delete(ctx, &statefulSet); err != nil && !apierrors.IsNotFound(err) {
+			return 0, err
+		}
+		r.recordBackendDeleted(internalHost, &statefulSet, "StatefulSet")
+		delete(internalHost.Status.Attributes, statefulSet.Name+".deployment")
+		delete(internalHost.Status.Attributes, statefulSet.Name+".replicas")
+	}
+
+	return next, nil
+}
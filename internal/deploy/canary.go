@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// CanaryWeightAnnotation enables, on a function, canary rollouts of its
+	// new images. The value is the percentage of the requests, from 1 to 99,
+	// sent to the canary.
+	CanaryWeightAnnotation = "kdex.dev/canary-weight"
+	// CanaryMaxErrorRatioAnnotation is the ratio of failed requests above
+	// which the canary is aborted.
+	CanaryMaxErrorRatioAnnotation = "kdex.dev/canary-max-error-ratio"
+	// CanaryMinRequestsAnnotation is the number of requests the canary must
+	// serve before it is promoted.
+	CanaryMinRequestsAnnotation = "kdex.dev/canary-min-requests"
+
+	// CanaryImageAttribute is the status attribute of the image of the
+	// canary of a function.
+	CanaryImageAttribute = "canary.image"
+	// CanaryURLAttribute is the status attribute of the URL of the canary of
+	// a function.
+	CanaryURLAttribute = "canary.url"
+
+	DefaultCanaryMaxErrorRatio = 0.05
+	DefaultCanaryMinRequests   = 100
+
+	canarySuffix = "-canary"
+)
+
+// Canary is the rollout policy of the new images of a function.
+type Canary struct {
+	MaxErrorRatio float64
+	MinRequests   int
+	Weight        int
+}
+
+// ParseCanary returns the canary policy of the annotations of a function, nil
+// when CanaryWeightAnnotation is not set.
+func ParseCanary(annotations map[string]string) (*Canary, error) {
+	weight, ok := annotations[CanaryWeightAnnotation]
+	if !ok || weight == "" {
+		return nil, nil
+	}
+
+	canary := &Canary{
+		MaxErrorRatio: DefaultCanaryMaxErrorRatio,
+		MinRequests:   DefaultCanaryMinRequests,
+	}
+
+	var err error
+	canary.Weight, err = strconv.Atoi(weight)
+	if err != nil || canary.Weight < 1 || canary.Weight > 99 {
+		return nil, fmt.Errorf("invalid %s %q, expected a percentage from 1 to 99", CanaryWeightAnnotation, weight)
+	}
+
+	if v, ok := annotations[CanaryMaxErrorRatioAnnotation]; ok {
+		canary.MaxErrorRatio, err = strconv.ParseFloat(v, 64)
+		if err != nil || canary.MaxErrorRatio < 0 || canary.MaxErrorRatio >= 1 {
+			return nil, fmt.Errorf("invalid %s %q, expected a ratio from 0 to 1", CanaryMaxErrorRatioAnnotation, v)
+		}
+	}
+
+	if v, ok := annotations[CanaryMinRequestsAnnotation]; ok {
+		canary.MinRequests, err = strconv.Atoi(v)
+		if err != nil || canary.MinRequests < 1 {
+			return nil, fmt.Errorf("invalid %s %q, expected a positive number", CanaryMinRequestsAnnotation, v)
+		}
+	}
+
+	return canary, nil
+}
+
+// Verdict decides the canary from the requests it served. It is aborted as
+// soon as its failures exceed the ratio of the minimum requests, and promoted
+// once it served the minimum requests within the ratio.
+func (c *Canary) Verdict(requests int64, failures int64) (promote bool, abort bool) {
+	if float64(failures) > c.MaxErrorRatio*float64(max(requests, int64(c.MinRequests))) {
+		return false, true
+	}
+	return requests >= int64(c.MinRequests), false
+}
@@ -0,0 +1,106 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseCanary(t *testing.T) {
+	canary, err := ParseCanary(nil)
+	require.NoError(t, err)
+	assert.Nil(t, canary)
+
+	canary, err = ParseCanary(map[string]string{CanaryWeightAnnotation: "10"})
+	require.NoError(t, err)
+	assert.Equal(t, &Canary{MaxErrorRatio: DefaultCanaryMaxErrorRatio, MinRequests: DefaultCanaryMinRequests, Weight: 10}, canary)
+
+	canary, err = ParseCanary(map[string]string{
+		CanaryMaxErrorRatioAnnotation: "0.1",
+		CanaryMinRequestsAnnotation:   "20",
+		CanaryWeightAnnotation:        "50",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Canary{MaxErrorRatio: 0.1, MinRequests: 20, Weight: 50}, canary)
+
+	for _, annotations := range []map[string]string{
+		{CanaryWeightAnnotation: "100"},
+		{CanaryWeightAnnotation: "ten"},
+		{CanaryWeightAnnotation: "10", CanaryMaxErrorRatioAnnotation: "1"},
+		{CanaryWeightAnnotation: "10", CanaryMinRequestsAnnotation: "0"},
+	} {
+		_, err := ParseCanary(annotations)
+		assert.Error(t, err, annotations)
+	}
+}
+
+func TestCanary_Verdict(t *testing.T) {
+	canary := &Canary{MaxErrorRatio: 0.05, MinRequests: 100, Weight: 10}
+
+	tests := []struct {
+		requests int64
+		failures int64
+		promote  bool
+		abort    bool
+	}{
+		{requests: 0},
+		{requests: 50, failures: 5},
+		{requests: 50, failures: 6, abort: true},
+		{requests: 100, failures: 5, promote: true},
+		{requests: 400, failures: 21, abort: true},
+	}
+
+	for _, tt := range tests {
+		promote, abort := canary.Verdict(tt.requests, tt.failures)
+		assert.Equal(t, tt.promote, promote, "%d of %d", tt.failures, tt.requests)
+		assert.Equal(t, tt.abort, abort, "%d of %d", tt.failures, tt.requests)
+	}
+}
+
+func TestDeployCanary(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "checkout"
+	function.Namespace = "ns"
+	function.Generation = 1
+	function.UID = "uid"
+	function.Spec.HostRef.Name = "shop"
+	function.Status.Executable = &kdexv1alpha1.Executable{Image: "registry/shop/checkout:2"}
+
+	host := kdexv1alpha1.KDexInternalHost{}
+	host.Spec.Routing.Domains = []string{"shop.example.com"}
+	host.Spec.Routing.Scheme = "https"
+
+	deployer := Deployer{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		FaaSAdaptor: kdexv1alpha1.KDexFaaSAdaptorSpec{
+			Deployer: kdexv1alpha1.Deployer{Image: "deployer/lambda:1"},
+			Provider: ProviderLambda,
+		},
+		Host:   host,
+		Scheme: scheme,
+	}
+
+	stable, err := deployer.Deploy(context.Background(), function)
+	require.NoError(t, err)
+	assert.NotContains(t, stable.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "FUNCTION_CANARY", Value: "true"})
+
+	deployer.Canary = true
+	canary, err := deployer.Deploy(context.Background(), function)
+	require.NoError(t, err)
+	assert.NotEqual(t, stable.Name, canary.Name)
+
+	env := canary.Spec.Template.Spec.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: "FUNCTION_CANARY", Value: "true"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "FUNCTION_DEPLOYED_NAME", Value: "shop-checkout-canary"})
+}
@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ContractTestAnnotation enables, on a function, the contract test of its
+	// deployments before they are ready. The value is the tool the spec of
+	// the function is tested with, schemathesis or dredd.
+	ContractTestAnnotation = "kdex.dev/contract-test"
+	// ContractTestImageAnnotation overrides the image of the tool.
+	ContractTestImageAnnotation = "kdex.dev/contract-test-image"
+
+	// ContractTestAttribute is the status attribute of the last image of a
+	// function which passed its contract test.
+	ContractTestAttribute = "contract.test.image"
+
+	ContractTestDredd        = "dredd"
+	ContractTestSchemathesis = "schemathesis"
+
+	// ContractTestContainer is the container of the contract test job, its
+	// termination message holds the tail of the report of the tool.
+	ContractTestContainer = "contract-test"
+
+	// openAPIURLAttribute is the status attribute of the spec of a function
+	// as served inside the cluster.
+	openAPIURLAttribute = "openapi.schema.url.internal"
+)
+
+// ContractTest is the tool testing the deployments of a function against
+// its spec.
+type ContractTest struct {
+	Image string
+	Tool  string
+}
+
+var contractTestImages = map[string]string{
+	ContractTestDredd:        "apiaryio/dredd:14.1.0",
+	ContractTestSchemathesis: "schemathesis/schemathesis:stable",
+}
+
+// The reports are written to the termination message, which is limited to
+// 4096 bytes.
+var contractTestCommands = map[string]string{
+	ContractTestDredd: `dredd "$OPENAPI_URL" "$FUNCTION_URL" --loglevel=warning > /tmp/report 2>&1
+status=$?
+tail -c 4000 /tmp/report > /dev/termination-log
+exit $status`,
+	ContractTestSchemathesis: `schemathesis run "$OPENAPI_URL" --url "$FUNCTION_URL" --checks all --no-color > /tmp/report 2>&1
+status=$?
+tail -c 4000 /tmp/report > /dev/termination-log
+exit $status`,
+}
+
+// ParseContractTest returns the contract test of the annotations of a
+// function, nil when ContractTestAnnotation is not set.
+func ParseContractTest(annotations map[string]string) (*ContractTest, error) {
+	tool := annotations[ContractTestAnnotation]
+	if tool == "" {
+		return nil, nil
+	}
+
+	image, ok := contractTestImages[tool]
+	if !ok {
+		return nil, fmt.Errorf("invalid %s %q, expected %s or %s", ContractTestAnnotation, tool, ContractTestSchemathesis, ContractTestDredd)
+	}
+	if v := annotations[ContractTestImageAnnotation]; v != "" {
+		image = v
+	}
+
+	return &ContractTest{Image: image, Tool: tool}, nil
+}
+
+// ContractTest returns the job testing the deployed function against its
+// spec, creating it when the image of the function was not tested yet.
+func (d *Deployer) ContractTest(ctx context.Context, function *kdexv1alpha1.KDexFunction, test *ContractTest) (*batchv1.Job, error) {
+	if function.Status.Executable == nil || function.Status.URL == "" {
+		return nil, fmt.Errorf("function %s/%s is not deployed", function.Namespace, function.Name)
+	}
+
+	openAPIURL := function.Status.Attributes[openAPIURLAttribute]
+	if openAPIURL == "" {
+		return nil, fmt.Errorf("function %s/%s has no OpenAPI spec URL", function.Namespace, function.Name)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(function.Status.Executable.Image))
+	h.Write([]byte(test.Tool))
+	h.Write([]byte(test.Image))
+	idHash := fmt.Sprintf("%x", h.Sum(nil))[:8]
+
+	jobName := fmt.Sprintf("%s-contract-%d-%s", function.Name, function.Generation, idHash)
+
+	job := &batchv1.Job{}
+	err := d.Client.Get(ctx, client.ObjectKey{Namespace: function.Namespace, Name: jobName}, job)
+	if err == nil {
+		return job, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: function.Namespace,
+			Labels: map[string]string{
+				"app":                 ContractTestContainer,
+				"function":            function.Name,
+				"kdex.dev/generation": fmt.Sprintf("%d", function.Generation),
+			},
+			Annotations: map[string]string{
+				"kdex.dev/generation": fmt.Sprintf("%d", function.Generation),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// A failed contract test is a verdict, not a flake.
+			BackoffLimit: new(int32(0)),
+			Completions:  new(int32(1)),
+			Parallelism:  new(int32(1)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"kdex.dev/generation": fmt.Sprintf("%d", function.Generation),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Command: []string{"sh", "-c", contractTestCommands[test.Tool]},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "FUNCTION_URL",
+									Value: function.Status.URL,
+								},
+								{
+									Name:  "OPENAPI_URL",
+									Value: openAPIURL,
+								},
+							},
+							Image:                    test.Image,
+							Name:                     ContractTestContainer,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						},
+					},
+					ImagePullSecrets: d.ImagePullSecrets,
+					RestartPolicy:    corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+
+	if err = ctrl.SetControllerReference(function, job, d.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to create contract test job: %w", err)
+	}
+
+	if err = d.Client.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create contract test job: %w", err)
+	}
+
+	return job, nil
+}
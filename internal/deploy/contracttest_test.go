@@ -0,0 +1,82 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseContractTest(t *testing.T) {
+	test, err := ParseContractTest(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, test)
+
+	test, err = ParseContractTest(map[string]string{ContractTestAnnotation: ContractTestSchemathesis})
+	require.NoError(t, err)
+	assert.Equal(t, &ContractTest{Image: "schemathesis/schemathesis:stable", Tool: ContractTestSchemathesis}, test)
+
+	test, err = ParseContractTest(map[string]string{
+		ContractTestAnnotation:      ContractTestDredd,
+		ContractTestImageAnnotation: "registry/dredd:2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &ContractTest{Image: "registry/dredd:2", Tool: ContractTestDredd}, test)
+
+	_, err = ParseContractTest(map[string]string{ContractTestAnnotation: "true"})
+	assert.Error(t, err)
+}
+
+func TestDeployContractTest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "checkout"
+	function.Namespace = "ns"
+	function.Generation = 2
+	function.UID = "uid"
+	function.Status.Executable = &kdexv1alpha1.Executable{Image: "registry/shop/checkout:1"}
+
+	deployer := Deployer{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	test := &ContractTest{Image: "schemathesis/schemathesis:stable", Tool: ContractTestSchemathesis}
+
+	_, err := deployer.ContractTest(context.Background(), function, test)
+	assert.ErrorContains(t, err, "is not deployed")
+
+	function.Status.URL = "http://checkout.ns.svc.cluster.local"
+	_, err = deployer.ContractTest(context.Background(), function, test)
+	assert.ErrorContains(t, err, "no OpenAPI spec URL")
+
+	function.Status.Attributes = map[string]string{openAPIURLAttribute: "http://shop.kdex.svc.cluster.local:8090/-/openapi?type=function&tag=checkout"}
+	job, err := deployer.ContractTest(context.Background(), function, test)
+	require.NoError(t, err)
+	assert.Regexp(t, `^checkout-contract-2-[0-9a-f]{8}$`, job.Name)
+	assert.Equal(t, ContractTestContainer, job.Labels["app"])
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+
+	container := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, ContractTestContainer, container.Name)
+	assert.Equal(t, test.Image, container.Image)
+	assert.Contains(t, container.Command[2], "schemathesis run")
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "FUNCTION_URL", Value: function.Status.URL})
+
+	again, err := deployer.ContractTest(context.Background(), function, test)
+	require.NoError(t, err)
+	assert.Equal(t, job.Name, again.Name)
+
+	function.Status.Executable.Image = "registry/shop/checkout:2"
+	next, err := deployer.ContractTest(context.Background(), function, test)
+	require.NoError(t, err)
+	assert.NotEqual(t, job.Name, next.Name)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/kdex-tech/host-manager/internal/child"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -16,11 +17,27 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// HostTokenAudienceEnv is the env of the deployer holding the audience
+	// of the service account token the deployer projects into the function
+	// so that it can call back into the host, see
+	// auth.ServiceAccountEntitlementsAnnotation.
+	HostTokenAudienceEnv = "HOST_TOKEN_AUDIENCE"
+	// HostTokenPathEnv is the env of the deployer holding the path the token
+	// is projected at in the function.
+	HostTokenPathEnv = "HOST_TOKEN_PATH"
+	// HostTokenPath is where the token is projected in the function.
+	HostTokenPath = "/var/run/secrets/kdex.dev/host/token"
+)
+
 type Deployer struct {
+	// Canary deploys the function beside its stable deployment.
+	Canary           bool
 	Client           client.Client
 	FaaSAdaptor      kdexv1alpha1.KDexFaaSAdaptorSpec
 	Host             kdexv1alpha1.KDexInternalHost
 	ImagePullSecrets []corev1.LocalObjectReference
+	PackageType      PackageType
 	Scheme           *runtime.Scheme
 	ServiceAccount   string
 }
@@ -59,6 +76,9 @@ func (d *Deployer) Deploy(ctx context.Context, function *kdexv1alpha1.KDexFuncti
 	h := sha256.New()
 	h.Write([]byte(image))
 	h.Write([]byte(adaptorGen))
+	if d.Canary {
+		h.Write([]byte(canarySuffix))
+	}
 	idHash := fmt.Sprintf("%x", h.Sum(nil))[:8]
 
 	jobName := fmt.Sprintf("%s-deployer-%d-%s", function.Name, function.Generation, idHash)
@@ -72,101 +92,7 @@ func (d *Deployer) Deploy(ctx context.Context, function *kdexv1alpha1.KDexFuncti
 		return nil, err
 	}
 
-	issuer := fmt.Sprintf("%s://%s", d.Host.Spec.Routing.Scheme, d.Host.Spec.Routing.Domains[0])
-
-	env := d.FaaSAdaptor.Deployer.Env
-
-	env = append(env, []corev1.EnvVar{
-		{
-			Name:  "AUDIENCE",
-			Value: function.Status.URL,
-		},
-		{
-			Name:  "FUNCTION_BASEPATH",
-			Value: function.Spec.API.BasePath,
-		},
-		{
-			Name:  "FUNCTION_GENERATION",
-			Value: fmt.Sprintf("%d", function.Generation),
-		},
-		{
-			Name:  "FUNCTION_HOST",
-			Value: function.Spec.HostRef.Name,
-		},
-		{
-			Name:  "FUNCTION_IMAGE",
-			Value: image,
-		},
-		{
-			Name:  "FUNCTION_NAME",
-			Value: function.Name,
-		},
-		{
-			Name:  "FUNCTION_NAMESPACE",
-			Value: function.Namespace,
-		},
-		{
-			Name:  "JWKS_URL",
-			Value: issuer + "/.well-known/jwks.json",
-		},
-		{
-			Name:  "ISSUER",
-			Value: issuer,
-		},
-	}...)
-
-	if function.Status.Executable.Scaling != nil {
-		env = append(env, []corev1.EnvVar{
-			{
-				Name:  "SCALING_ACTIVATION_SCALE",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.ActivationScale),
-			},
-			{
-				Name:  "SCALING_INITIAL_SCALE",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.InitialScale),
-			},
-			{
-				Name:  "SCALING_MAX_SCALE",
-				Value: fmt.Sprintf("%d", function.Status.Executable.Scaling.MaxScale),
-			},
-			{
-				Name:  "SCALING_METRIC",
-				Value: *function.Status.Executable.Scaling.Metric,
-			},
-			{
-				Name:  "SCALING_MIN_SCALE",
-				Value: fmt.Sprintf("%d", function.Status.Executable.Scaling.MinScale),
-			},
-			{
-				Name:  "SCALING_PANIC_THRESHOLD_PERCENTAGE",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.PanicThresholdPercentage),
-			},
-			{
-				Name:  "SCALING_PANIC_WINDOW_PERCENTAGE",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.PanicWindowPercentage),
-			},
-			{
-				Name:  "SCALING_SCALE_DOWN_DELAY",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.ScaleDownDelay),
-			},
-			{
-				Name:  "SCALING_SCALE_TO_ZERO_POD_RETENTION_PERIOD",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.ScaleToZeroPodRetentionPeriod),
-			},
-			{
-				Name:  "SCALING_STABLE_WINDOW",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.StableWindow),
-			},
-			{
-				Name:  "SCALING_TARGET",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.Target),
-			},
-			{
-				Name:  "SCALING_TARGET_UTILIZATION_PERCENTAGE",
-				Value: fmt.Sprintf("%d", *function.Status.Executable.Scaling.TargetUtilizationPercentage),
-			},
-		}...)
-	}
+	env := d.functionEnv(function)
 
 	var forwardedEnvVars strings.Builder
 	sep := ""
@@ -178,8 +104,43 @@ func (d *Deployer) Deploy(ctx context.Context, function *kdexv1alpha1.KDexFuncti
 	env = append(env, corev1.EnvVar{
 		Name:  "FORWARDED_ENV_VARS",
 		Value: forwardedEnvVars.String(),
+	}, corev1.EnvVar{
+		Name:  "FAAS_PROVIDER",
+		Value: d.FaaSAdaptor.Provider,
 	})
 
+	// Canaries are deployed beside the stable deployment, the deployer
+	// reports the URL of the canary.
+	if d.Canary {
+		env = append(env, corev1.EnvVar{
+			Name:  "FUNCTION_CANARY",
+			Value: "true",
+		})
+	}
+
+	// External providers do not namespace their functions and may deploy
+	// them from a zip archive.
+	if External(d.FaaSAdaptor.Provider) {
+		packageType := d.PackageType
+		if packageType == "" {
+			packageType = PackageTypeImage
+		}
+		env = append(env, corev1.EnvVar{
+			Name:  "FUNCTION_DEPLOYED_NAME",
+			Value: externalName(function, d.Canary),
+		}, corev1.EnvVar{
+			Name:  "FUNCTION_PACKAGE_TYPE",
+			Value: string(packageType),
+		})
+	}
+
+	// The deployer of an external provider usually needs the cloud identity
+	// bound to its own service account.
+	serviceAccount := d.ServiceAccount
+	if d.FaaSAdaptor.Deployer.ServiceAccountName != "" {
+		serviceAccount = d.FaaSAdaptor.Deployer.ServiceAccountName
+	}
+
 	job = &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jobName,
@@ -221,7 +182,7 @@ func (d *Deployer) Deploy(ctx context.Context, function *kdexv1alpha1.KDexFuncti
 					},
 					ImagePullSecrets:   d.ImagePullSecrets,
 					RestartPolicy:      corev1.RestartPolicyNever,
-					ServiceAccountName: d.ServiceAccount,
+					ServiceAccountName: serviceAccount,
 				},
 			},
 		},
@@ -238,7 +199,111 @@ func (d *Deployer) Deploy(ctx context.Context, function *kdexv1alpha1.KDexFuncti
 	return job, nil
 }
 
+// functionEnv returns the env the function is deployed with: its identity,
+// the issuer of the tokens it accepts, the token it calls the host with and
+// its scaling. External providers, which run the function outside of the
+// cluster, and OpenFaaS, whose functions mount no volumes, cannot project the
+// token.
+func (d *Deployer) functionEnv(function *kdexv1alpha1.KDexFunction) []corev1.EnvVar {
+	issuer := fmt.Sprintf("%s://%s", d.Host.Spec.Routing.Scheme, d.Host.Spec.Routing.Domains[0])
+
+	env := child.SetEnv(d.FaaSAdaptor.Deployer.Env, []corev1.EnvVar{
+		{
+			Name:  "AUDIENCE",
+			Value: function.Status.URL,
+		},
+		{
+			Name:  "FUNCTION_BASEPATH",
+			Value: function.Spec.API.BasePath,
+		},
+		{
+			Name:  "FUNCTION_GENERATION",
+			Value: fmt.Sprintf("%d", function.Generation),
+		},
+		{
+			Name:  "FUNCTION_HOST",
+			Value: function.Spec.HostRef.Name,
+		},
+		{
+			Name:  "FUNCTION_IMAGE",
+			Value: function.Status.Executable.Image,
+		},
+		{
+			Name:  "FUNCTION_NAME",
+			Value: function.Name,
+		},
+		{
+			Name:  "FUNCTION_NAMESPACE",
+			Value: function.Namespace,
+		},
+		{
+			Name:  "JWKS_URL",
+			Value: issuer + "/.well-known/jwks.json",
+		},
+		{
+			Name:  "ISSUER",
+			Value: issuer,
+		},
+		child.CORSDomains(d.Host.Spec.Routing.Domains),
+	}...)
+
+	if !External(d.FaaSAdaptor.Provider) && d.FaaSAdaptor.Provider != ProviderOpenFaaS {
+		env = child.SetEnv(env,
+			corev1.EnvVar{Name: HostTokenAudienceEnv, Value: issuer},
+			corev1.EnvVar{Name: HostTokenPathEnv, Value: HostTokenPath},
+		)
+	}
+
+	// Unset scaling fields are left to the defaults of the provider.
+	if scaling := function.Status.Executable.Scaling; scaling != nil {
+		scalingEnv := []corev1.EnvVar{}
+		if scaling.ActivationScale != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_ACTIVATION_SCALE", Value: fmt.Sprintf("%d", *scaling.ActivationScale)})
+		}
+		if scaling.InitialScale != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_INITIAL_SCALE", Value: fmt.Sprintf("%d", *scaling.InitialScale)})
+		}
+		if scaling.MaxScale != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_MAX_SCALE", Value: fmt.Sprintf("%d", *scaling.MaxScale)})
+		}
+		if scaling.Metric != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_METRIC", Value: *scaling.Metric})
+		}
+		if scaling.MinScale != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_MIN_SCALE", Value: fmt.Sprintf("%d", *scaling.MinScale)})
+		}
+		if scaling.PanicThresholdPercentage != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_PANIC_THRESHOLD_PERCENTAGE", Value: fmt.Sprintf("%d", *scaling.PanicThresholdPercentage)})
+		}
+		if scaling.PanicWindowPercentage != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_PANIC_WINDOW_PERCENTAGE", Value: fmt.Sprintf("%d", *scaling.PanicWindowPercentage)})
+		}
+		if scaling.ScaleDownDelay != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_SCALE_DOWN_DELAY", Value: fmt.Sprintf("%d", *scaling.ScaleDownDelay)})
+		}
+		if scaling.ScaleToZeroPodRetentionPeriod != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_SCALE_TO_ZERO_POD_RETENTION_PERIOD", Value: fmt.Sprintf("%d", *scaling.ScaleToZeroPodRetentionPeriod)})
+		}
+		if scaling.StableWindow != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_STABLE_WINDOW", Value: fmt.Sprintf("%d", *scaling.StableWindow)})
+		}
+		if scaling.Target != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_TARGET", Value: fmt.Sprintf("%d", *scaling.Target)})
+		}
+		if scaling.TargetUtilizationPercentage != nil {
+			scalingEnv = append(scalingEnv, corev1.EnvVar{Name: "SCALING_TARGET_UTILIZATION_PERCENTAGE", Value: fmt.Sprintf("%d", *scaling.TargetUtilizationPercentage)})
+		}
+		env = child.SetEnv(env, scalingEnv...)
+	}
+
+	return env
+}
+
 func (d *Deployer) Observe(ctx context.Context, function *kdexv1alpha1.KDexFunction) (client.Object, error) {
+	if d.FaaSAdaptor.Provider == ProviderOpenFaaS {
+		return d.observeOpenFaaS(ctx, function)
+	}
+
 	if d.FaaSAdaptor.Observer == nil {
 		return nil, nil // No observer configured
 	}
@@ -0,0 +1,105 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// Providers of FaaS adaptors. The functions of external providers run
+// outside of the cluster and are reached through the host proxy at the URL
+// their deployer job reports.
+const (
+	ProviderAzureFunctions       = "azure-functions"
+	ProviderGoogleCloudFunctions = "google-cloud-functions"
+	ProviderKnative              = "knative"
+	ProviderLambda               = "lambda"
+)
+
+// PackageType is how the deployer of an external provider ships the
+// executable.
+type PackageType string
+
+const (
+	// PackageTypeAnnotation selects, on a FaaS adaptor of an external
+	// provider, how the deployer ships the executable. Images are used when it
+	// is not set.
+	PackageTypeAnnotation = "kdex.dev/package-type"
+
+	// PackageTypeImage deploys the built image as is.
+	PackageTypeImage PackageType = "image"
+	// PackageTypeZip deploys a zip archive the deployer extracts from the
+	// built image.
+	PackageTypeZip PackageType = "zip"
+
+	// maxExternalNameLength is the shortest limit of the external providers,
+	// the one of Lambda.
+	maxExternalNameLength = 64
+)
+
+// ParsePackageType returns the package type named by the value of
+// PackageTypeAnnotation.
+func ParsePackageType(value string) (PackageType, error) {
+	switch PackageType(value) {
+	case "", PackageTypeImage:
+		return PackageTypeImage, nil
+	case PackageTypeZip:
+		return PackageTypeZip, nil
+	default:
+		return "", fmt.Errorf("unknown package type %q, expected %s or %s", value, PackageTypeImage, PackageTypeZip)
+	}
+}
+
+// External reports whether the functions of the provider run outside of the
+// cluster.
+func External(provider string) bool {
+	return slices.Contains([]string{ProviderAzureFunctions, ProviderGoogleCloudFunctions, ProviderLambda}, provider)
+}
+
+// Result is the termination message of a deployer job.
+type Result struct {
+	URL string `json:"url"`
+}
+
+// ParseResult reads the termination message of the deployer job. The URL
+// must be absolute, and use https when the provider is external since the
+// host proxy reaches it over the internet.
+func ParseResult(provider string, message string) (*Result, error) {
+	result := &Result{}
+	if err := json.Unmarshal([]byte(message), result); err != nil {
+		return nil, fmt.Errorf("invalid deployer result: %w", err)
+	}
+
+	u, err := url.Parse(result.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deployer result url: %w", err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("deployer result url %q is not absolute", result.URL)
+	}
+	if External(provider) && u.Scheme != "https" {
+		return nil, fmt.Errorf("deployer result url %q of %s function must use https", result.URL, provider)
+	}
+
+	return result, nil
+}
+
+// externalName names the function on the external provider after the host
+// and the function, the names of the provider are not namespaced.
+func externalName(function *kdexv1alpha1.KDexFunction, canary bool) string {
+	name := fmt.Sprintf("%s-%s", function.Spec.HostRef.Name, function.Name)
+	limit := maxExternalNameLength
+	if canary {
+		limit -= len(canarySuffix)
+	}
+	if len(name) > limit {
+		name = name[:limit]
+	}
+	if canary {
+		name += canarySuffix
+	}
+	return name
+}
@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParsePackageType(t *testing.T) {
+	packageType, err := ParsePackageType("")
+	require.NoError(t, err)
+	assert.Equal(t, PackageTypeImage, packageType)
+
+	packageType, err = ParsePackageType("zip")
+	require.NoError(t, err)
+	assert.Equal(t, PackageTypeZip, packageType)
+
+	_, err = ParsePackageType("jar")
+	assert.Error(t, err)
+}
+
+func TestParseResult(t *testing.T) {
+	result, err := ParseResult(ProviderLambda, `{"url":"https://abc.lambda-url.us-east-1.on.aws/"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.lambda-url.us-east-1.on.aws/", result.URL)
+
+	result, err = ParseResult(ProviderKnative, `{"url":"http://fn.default.svc.cluster.local"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "http://fn.default.svc.cluster.local", result.URL)
+
+	_, err = ParseResult(ProviderLambda, `{"url":"http://abc.lambda-url.us-east-1.on.aws/"}`)
+	assert.ErrorContains(t, err, "must use https")
+
+	_, err = ParseResult(ProviderKnative, `{"url":"/fn"}`)
+	assert.ErrorContains(t, err, "is not absolute")
+
+	_, err = ParseResult(ProviderKnative, `deployed`)
+	assert.ErrorContains(t, err, "invalid deployer result")
+}
+
+func TestDeployExternal(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "checkout-" + strings.Repeat("x", 60)
+	function.Namespace = "ns"
+	function.Generation = 1
+	function.UID = "uid"
+	function.Spec.HostRef.Name = "shop"
+	function.Status.Executable = &kdexv1alpha1.Executable{Image: "registry/shop/checkout:1"}
+
+	host := kdexv1alpha1.KDexInternalHost{}
+	host.Spec.Routing.Domains = []string{"shop.example.com"}
+	host.Spec.Routing.Scheme = "https"
+
+	deployer := Deployer{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		FaaSAdaptor: kdexv1alpha1.KDexFaaSAdaptorSpec{
+			Deployer: kdexv1alpha1.Deployer{
+				Image:              "deployer/lambda:1",
+				ServiceAccountName: "lambda-deployer",
+			},
+			Provider: ProviderLambda,
+		},
+		Host:           host,
+		PackageType:    PackageTypeZip,
+		Scheme:         scheme,
+		ServiceAccount: "shop",
+	}
+
+	job, err := deployer.Deploy(context.Background(), function)
+	require.NoError(t, err)
+
+	pod := job.Spec.Template.Spec
+	assert.Equal(t, "lambda-deployer", pod.ServiceAccountName)
+
+	env := pod.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: "FAAS_PROVIDER", Value: ProviderLambda})
+	assert.Contains(t, env, corev1.EnvVar{Name: "FUNCTION_PACKAGE_TYPE", Value: "zip"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "FUNCTION_DEPLOYED_NAME", Value: ("shop-" + function.Name)[:maxExternalNameLength]})
+
+	for _, e := range env {
+		assert.NotEqual(t, HostTokenAudienceEnv, e.Name, "external functions cannot project service account tokens")
+		if e.Name == "FORWARDED_ENV_VARS" {
+			assert.NotContains(t, e.Value, "FAAS_PROVIDER")
+			assert.NotContains(t, e.Value, "FUNCTION_PACKAGE_TYPE")
+		}
+	}
+}
+
+func TestDeploy_HostToken(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "checkout"
+	function.Namespace = "ns"
+	function.Generation = 1
+	function.UID = "uid"
+	function.Spec.HostRef.Name = "shop"
+	function.Status.Executable = &kdexv1alpha1.Executable{Image: "registry/shop/checkout:1"}
+
+	host := kdexv1alpha1.KDexInternalHost{}
+	host.Spec.Routing.Domains = []string{"shop.example.com"}
+	host.Spec.Routing.Scheme = "https"
+
+	deployer := Deployer{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		FaaSAdaptor: kdexv1alpha1.KDexFaaSAdaptorSpec{
+			Deployer: kdexv1alpha1.Deployer{Image: "deployer/knative:1"},
+			Provider: ProviderKnative,
+		},
+		Host:   host,
+		Scheme: scheme,
+	}
+
+	job, err := deployer.Deploy(context.Background(), function)
+	require.NoError(t, err)
+
+	env := job.Spec.Template.Spec.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: HostTokenAudienceEnv, Value: "https://shop.example.com"})
+	assert.Contains(t, env, corev1.EnvVar{Name: HostTokenPathEnv, Value: HostTokenPath})
+}
@@ -0,0 +1,252 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// ProviderOpenFaaS is the provider of the FaaS adaptors deploying
+	// functions as Function resources of the OpenFaaS operator.
+	ProviderOpenFaaS = "openfaas"
+
+	// OpenFaaSGatewayEnv is the env of the deployer holding the URL of the
+	// OpenFaaS gateway serving the functions.
+	OpenFaaSGatewayEnv     = "OPENFAAS_URL"
+	DefaultOpenFaaSGateway = "http://gateway.openfaas:8080"
+)
+
+// Deployment is the progress of a function deployed by the controller rather
+// than by a deployer job. URL is set once the function is available.
+type Deployment struct {
+	Failure string
+	Object  client.Object
+	URL     string
+}
+
+// DeployOpenFaaS creates or updates the OpenFaaS Function of the function.
+// The operator deploys it in the namespace of the function and the gateway
+// routes /function/<name>.<namespace> to it.
+func (d *Deployer) DeployOpenFaaS(
+	ctx context.Context,
+	function *kdexv1alpha1.KDexFunction,
+) (controllerutil.OperationResult, *Deployment, error) {
+	if function.Status.Executable == nil {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("function %s/%s has no executable", function.Namespace, function.Name)
+	}
+
+	fn := &unstructured.Unstructured{}
+	fn.SetGroupVersionKind(internal.OpenFaaSFunctionGVK)
+	fn.SetNamespace(function.Namespace)
+	fn.SetName(openFaaSName(function, d.Canary))
+
+	op, err := controllerutil.CreateOrUpdate(ctx, d.Client, fn, func() error {
+		labels := fn.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["function"] = function.Name
+		labels["kdex.dev/canary"] = fmt.Sprintf("%t", d.Canary)
+		labels["kdex.dev/generation"] = fmt.Sprintf("%d", function.Generation)
+		labels["kdex.dev/host"] = function.Spec.HostRef.Name
+		fn.SetLabels(labels)
+
+		fn.Object["spec"] = d.openFaaSSpec(function)
+
+		return ctrl.SetControllerReference(function, fn, d.Scheme)
+	})
+	if err != nil {
+		return controllerutil.OperationResultNone, nil, fmt.Errorf("failed to deploy OpenFaaS function: %w", err)
+	}
+
+	deployment, err := d.openFaaSDeployment(ctx, function, fn)
+	if err != nil {
+		return controllerutil.OperationResultNone, nil, err
+	}
+
+	return op, deployment, nil
+}
+
+// RemoveCanary deletes the canary of the function once it is promoted or
+// aborted. The canaries of deployer jobs are left to their deployer, which
+// replaces them with the next canary.
+func (d *Deployer) RemoveCanary(ctx context.Context, function *kdexv1alpha1.KDexFunction) error {
+	if d.FaaSAdaptor.Provider != ProviderOpenFaaS {
+		return nil
+	}
+
+	fn := &unstructured.Unstructured{}
+	fn.SetGroupVersionKind(internal.OpenFaaSFunctionGVK)
+	fn.SetNamespace(function.Namespace)
+	fn.SetName(openFaaSName(function, true))
+	if err := d.Client.Delete(ctx, fn); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to remove OpenFaaS canary: %w", err)
+	}
+	return nil
+}
+
+// observeOpenFaaS checks that the OpenFaaS Function of the function is still
+// available on the gateway.
+func (d *Deployer) observeOpenFaaS(ctx context.Context, function *kdexv1alpha1.KDexFunction) (client.Object, error) {
+	fn := &unstructured.Unstructured{}
+	fn.SetGroupVersionKind(internal.OpenFaaSFunctionGVK)
+	if err := d.Client.Get(ctx, client.ObjectKey{Namespace: function.Namespace, Name: openFaaSName(function, false)}, fn); err != nil {
+		return nil, fmt.Errorf("failed to observe OpenFaaS function: %w", err)
+	}
+
+	deployment, err := d.openFaaSDeployment(ctx, function, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case deployment.Failure != "":
+		return nil, fmt.Errorf("OpenFaaS function %s/%s failed: %s", fn.GetNamespace(), fn.GetName(), deployment.Failure)
+	case deployment.URL == "":
+		return nil, fmt.Errorf("OpenFaaS function %s/%s is not available", fn.GetNamespace(), fn.GetName())
+	case deployment.URL != function.Status.URL:
+		return nil, fmt.Errorf("OpenFaaS function %s/%s moved to %s", fn.GetNamespace(), fn.GetName(), deployment.URL)
+	}
+
+	return fn, nil
+}
+
+// openFaaSDeployment reads the progress of the function from the Deployment
+// the operator created for it.
+func (d *Deployer) openFaaSDeployment(
+	ctx context.Context,
+	function *kdexv1alpha1.KDexFunction,
+	fn *unstructured.Unstructured,
+) (*Deployment, error) {
+	deployment := &Deployment{Object: fn}
+
+	workload := &appsv1.Deployment{}
+	err := d.Client.Get(ctx, client.ObjectKey{Namespace: fn.GetNamespace(), Name: fn.GetName()}, workload)
+	if apierrors.IsNotFound(err) {
+		return deployment, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OpenFaaS function deployment: %w", err)
+	}
+
+	// The deployment is not yet updated to the image of the executable.
+	if workload.Generation != workload.Status.ObservedGeneration ||
+		!openFaaSRunsImage(workload, function.Status.Executable) {
+		return deployment, nil
+	}
+
+	for _, cond := range workload.Status.Conditions {
+		switch {
+		case cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse:
+			deployment.Failure = cond.Message
+		case cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionTrue:
+			deployment.URL = fmt.Sprintf("%s/function/%s.%s", d.openFaaSGateway(), fn.GetName(), fn.GetNamespace())
+		}
+	}
+
+	if deployment.Failure != "" {
+		deployment.URL = ""
+	}
+
+	return deployment, nil
+}
+
+// openFaaSSpec returns the spec of the OpenFaaS Function. The env of the
+// function is passed as its environment and the scaling as the labels of the
+// OpenFaaS autoscaler.
+func (d *Deployer) openFaaSSpec(function *kdexv1alpha1.KDexFunction) map[string]any {
+	environment := map[string]any{}
+	for _, env := range d.functionEnv(function) {
+		if env.ValueFrom == nil {
+			environment[env.Name] = env.Value
+		}
+	}
+
+	labels := map[string]any{
+		"function":      function.Name,
+		"kdex.dev/host": function.Spec.HostRef.Name,
+	}
+	maps.Copy(labels, openFaaSScaling(function.Status.Executable.Scaling))
+
+	return map[string]any{
+		"environment": environment,
+		"image":       function.Status.Executable.Image,
+		"labels":      labels,
+		"name":        openFaaSName(function, d.Canary),
+	}
+}
+
+// openFaaSScaling maps the scaling of the executable to the labels of the
+// OpenFaaS autoscaler.
+func openFaaSScaling(scaling *kdexv1alpha1.ScalingConfig) map[string]any {
+	labels := map[string]any{}
+	if scaling == nil {
+		return labels
+	}
+
+	if scaling.MinScale != nil {
+		labels["com.openfaas.scale.min"] = fmt.Sprintf("%d", *scaling.MinScale)
+		labels["com.openfaas.scale.zero"] = fmt.Sprintf("%t", *scaling.MinScale == 0)
+	}
+	if scaling.MaxScale != nil {
+		labels["com.openfaas.scale.max"] = fmt.Sprintf("%d", *scaling.MaxScale)
+	}
+	if scaling.Target != nil {
+		labels["com.openfaas.scale.target"] = fmt.Sprintf("%d", *scaling.Target)
+	}
+	if scaling.Metric != nil {
+		// OpenFaaS calls the concurrency metric capacity.
+		metric := *scaling.Metric
+		if metric == "concurrency" {
+			metric = "capacity"
+		}
+		labels["com.openfaas.scale.type"] = metric
+	}
+
+	return labels
+}
+
+// openFaaSGateway returns the URL of the gateway from the env of the
+// deployer.
+func (d *Deployer) openFaaSGateway() string {
+	for _, env := range d.FaaSAdaptor.Deployer.Env {
+		if env.Name == OpenFaaSGatewayEnv && env.Value != "" {
+			return strings.TrimSuffix(env.Value, "/")
+		}
+	}
+	return DefaultOpenFaaSGateway
+}
+
+// openFaaSName names the OpenFaaS Function after the host and the function,
+// functions of several hosts may share a namespace.
+func openFaaSName(function *kdexv1alpha1.KDexFunction, canary bool) string {
+	name := fmt.Sprintf("%s-%s", function.Spec.HostRef.Name, function.Name)
+	if canary {
+		name += canarySuffix
+	}
+	return name
+}
+
+func openFaaSRunsImage(workload *appsv1.Deployment, executable *kdexv1alpha1.Executable) bool {
+	if executable == nil {
+		return false
+	}
+	for _, container := range workload.Spec.Template.Spec.Containers {
+		if container.Image == executable.Image {
+			return true
+		}
+	}
+	return false
+}
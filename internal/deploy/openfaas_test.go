@@ -0,0 +1,121 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kdex-tech/host-manager/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestDeployOpenFaaS(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	function := &kdexv1alpha1.KDexFunction{}
+	function.Name = "fn"
+	function.Namespace = "ns"
+	function.Generation = 2
+	function.UID = "uid"
+	function.Spec.HostRef.Name = "host"
+	function.Spec.API.BasePath = "/api/fn"
+	function.Status.Executable = &kdexv1alpha1.Executable{
+		Image: "registry/host/fn:2",
+		Scaling: &kdexv1alpha1.ScalingConfig{
+			MaxScale: new(int32(5)),
+			Metric:   new("concurrency"),
+		},
+	}
+
+	host := kdexv1alpha1.KDexInternalHost{}
+	host.Spec.Routing.Domains = []string{"example.com"}
+	host.Spec.Routing.Scheme = "https"
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	deployer := Deployer{
+		Client: c,
+		FaaSAdaptor: kdexv1alpha1.KDexFaaSAdaptorSpec{
+			Deployer: kdexv1alpha1.Deployer{
+				Env: []corev1.EnvVar{{Name: OpenFaaSGatewayEnv, Value: "http://gateway.faas:8080/"}},
+			},
+			Provider: ProviderOpenFaaS,
+		},
+		Host:   host,
+		Scheme: scheme,
+	}
+
+	op, deployment, err := deployer.DeployOpenFaaS(context.Background(), function)
+	require.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultCreated, op)
+	assert.Empty(t, deployment.URL)
+	assert.Empty(t, deployment.Failure)
+
+	fn := &unstructured.Unstructured{}
+	fn.SetGroupVersionKind(internal.OpenFaaSFunctionGVK)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: "host-fn"}, fn))
+
+	image, _, _ := unstructured.NestedString(fn.Object, "spec", "image")
+	assert.Equal(t, "registry/host/fn:2", image)
+	environment, _, _ := unstructured.NestedStringMap(fn.Object, "spec", "environment")
+	assert.Equal(t, "https://example.com", environment["ISSUER"])
+	assert.Equal(t, "/api/fn", environment["FUNCTION_BASEPATH"])
+	labels, _, _ := unstructured.NestedStringMap(fn.Object, "spec", "labels")
+	assert.Equal(t, "5", labels["com.openfaas.scale.max"])
+	assert.Equal(t, "capacity", labels["com.openfaas.scale.type"])
+	assert.Len(t, fn.GetOwnerReferences(), 1)
+
+	_, err = deployer.Observe(context.Background(), function)
+	assert.ErrorContains(t, err, "is not available")
+
+	workload := &appsv1.Deployment{}
+	workload.Name = "host-fn"
+	workload.Namespace = "ns"
+	workload.Spec.Template.Spec.Containers = []corev1.Container{{Name: "host-fn", Image: "registry/host/fn:2"}}
+	workload.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+	}
+	require.NoError(t, c.Create(context.Background(), workload))
+	require.NoError(t, c.Status().Update(context.Background(), workload))
+
+	op, deployment, err = deployer.DeployOpenFaaS(context.Background(), function)
+	require.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultNone, op)
+	assert.Equal(t, "http://gateway.faas:8080/function/host-fn.ns", deployment.URL)
+
+	function.Status.URL = deployment.URL
+	obj, err := deployer.Observe(context.Background(), function)
+	require.NoError(t, err)
+	assert.Equal(t, "host-fn", obj.GetName())
+
+	t.Run("stale image", func(t *testing.T) {
+		next := function.DeepCopy()
+		next.Status.Executable.Image = "registry/host/fn:3"
+
+		_, deployment, err := deployer.DeployOpenFaaS(context.Background(), next)
+		require.NoError(t, err)
+		assert.Empty(t, deployment.URL)
+	})
+
+	t.Run("progress deadline exceeded", func(t *testing.T) {
+		workload.Status.Conditions = append(workload.Status.Conditions, appsv1.DeploymentCondition{
+			Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Message: "ProgressDeadlineExceeded",
+		})
+		require.NoError(t, c.Status().Update(context.Background(), workload))
+
+		_, deployment, err := deployer.DeployOpenFaaS(context.Background(), function)
+		require.NoError(t, err)
+		assert.Equal(t, "ProgressDeadlineExceeded", deployment.Failure)
+		assert.Empty(t, deployment.URL)
+	})
+}
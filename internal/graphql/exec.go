@@ -0,0 +1,360 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// MaxRootFields is the number of root fields a request selects at most,
+	// aliases included, since every root field calls a function.
+	MaxRootFields = 16
+	// MaxAliases is the number of aliased fields a request selects at most.
+	MaxAliases = 32
+)
+
+// Request is a GraphQL request as posted by clients.
+type Request struct {
+	OperationName string         `json:"operationName,omitempty"`
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response. Data is omitted when the request could not
+// be executed at all.
+type Response struct {
+	Data   any     `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Resolver resolves a root field by calling the function operation with the
+// coerced arguments keyed by argument name.
+type Resolver interface {
+	Resolve(ctx context.Context, field *Field, args map[string]any) (any, error)
+}
+
+type ResolverFunc func(ctx context.Context, field *Field, args map[string]any) (any, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, field *Field, args map[string]any) (any, error) {
+	return f(ctx, field, args)
+}
+
+// object is a JSON object which keeps the order of the selections.
+type object []objectEntry
+
+type objectEntry struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Execute validates the request against the schema and resolves its root
+// fields one after the other. A failing field resolves to null and adds an
+// error, the other fields are still resolved.
+func (s *Schema) Execute(ctx context.Context, req Request, resolver Resolver) Response {
+	ops, err := parse(req.Query)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	op, err := selectOperation(ops, req.OperationName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if err := s.validate(op); err != nil {
+		return errorResponse(err)
+	}
+
+	vars, err := coerceVariables(op.variables, req.Variables)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rootType := "Query"
+	if op.kind == "mutation" {
+		rootType = "Mutation"
+	}
+
+	resp := Response{}
+	data := object{}
+
+	for _, sel := range op.selections {
+		if sel.name == "__typename" {
+			data = append(data, objectEntry{key: sel.key(), value: rootType})
+			continue
+		}
+
+		field := s.Field(op.kind, sel.name)
+
+		args := map[string]any{}
+		for _, arg := range sel.args {
+			v, err := resolveValue(arg.value, vars)
+			if err != nil {
+				return errorResponse(err)
+			}
+			args[arg.name] = v
+		}
+
+		if missing := missingArgs(field, args); len(missing) > 0 {
+			resp.Errors = append(resp.Errors, Error{
+				Message: fmt.Sprintf("missing required arguments: %s", strings.Join(missing, ", ")),
+				Path:    []any{sel.key()},
+			})
+			data = append(data, objectEntry{key: sel.key(), value: nil})
+			continue
+		}
+
+		result, err := resolver.Resolve(ctx, field, args)
+		if err != nil {
+			resp.Errors = append(resp.Errors, Error{Message: err.Error(), Path: []any{sel.key()}})
+			data = append(data, objectEntry{key: sel.key(), value: nil})
+			continue
+		}
+
+		data = append(data, objectEntry{key: sel.key(), value: s.project(result, sel.selections, baseType(field.Type))})
+	}
+
+	resp.Data = data
+	return resp
+}
+
+// validate checks the fields and arguments of the operation against the
+// schema before anything is resolved.
+func (s *Schema) validate(op *operationDef) error {
+	rootFields := 0
+	for _, sel := range op.selections {
+		if sel.name != "__typename" {
+			rootFields++
+		}
+	}
+	if rootFields > MaxRootFields {
+		return fmt.Errorf("request selects %d root fields, at most %d are allowed", rootFields, MaxRootFields)
+	}
+	if aliases := countAliases(op.selections); aliases > MaxAliases {
+		return fmt.Errorf("request selects %d aliased fields, at most %d are allowed", aliases, MaxAliases)
+	}
+
+	for _, sel := range op.selections {
+		if sel.name == "__typename" {
+			continue
+		}
+
+		field := s.Field(op.kind, sel.name)
+		if field == nil {
+			return fmt.Errorf("cannot query field %q on %s", sel.name, op.kind)
+		}
+
+		for _, arg := range sel.args {
+			if !slices.ContainsFunc(field.Args, func(a Arg) bool { return a.Name == arg.name }) {
+				return fmt.Errorf("unknown argument %q on field %q", arg.name, sel.name)
+			}
+		}
+
+		if err := s.validateSelections(field.Type, sel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countAliases returns the number of aliased fields of the selections and of
+// their nested selections.
+func countAliases(sels []*selection) int {
+	count := 0
+	for _, sel := range sels {
+		if sel.alias != "" {
+			count++
+		}
+		count += countAliases(sel.selections)
+	}
+	return count
+}
+
+func (s *Schema) validateSelections(typ string, sel *selection) error {
+	objectType := s.Types[baseType(typ)]
+
+	if objectType == nil {
+		if len(sel.selections) > 0 {
+			return fmt.Errorf("field %q of type %s must not have a selection set", sel.name, typ)
+		}
+		return nil
+	}
+
+	if len(sel.selections) == 0 {
+		return fmt.Errorf("field %q of type %s must have a selection set", sel.name, typ)
+	}
+
+	for _, nested := range sel.selections {
+		if nested.name == "__typename" {
+			continue
+		}
+		if len(nested.args) > 0 {
+			return fmt.Errorf("unknown argument %q on field %q", nested.args[0].name, nested.name)
+		}
+		idx := slices.IndexFunc(objectType.Fields, func(f TypeField) bool { return f.Name == nested.name })
+		if idx == -1 {
+			return fmt.Errorf("cannot query field %q on type %s", nested.name, objectType.Name)
+		}
+		if err := s.validateSelections(objectType.Fields[idx].Type, nested); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// project keeps the selected fields of the resolved JSON value. Properties
+// missing from the value resolve to null.
+func (s *Schema) project(value any, sels []*selection, typeName string) any {
+	if len(sels) == 0 || value == nil {
+		return value
+	}
+
+	if list, ok := value.([]any); ok {
+		out := make([]any, len(list))
+		for i, item := range list {
+			out[i] = s.project(item, sels, typeName)
+		}
+		return out
+	}
+
+	props, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	objectType := s.Types[typeName]
+	out := object{}
+	for _, sel := range sels {
+		if sel.name == "__typename" {
+			out = append(out, objectEntry{key: sel.key(), value: typeName})
+			continue
+		}
+		idx := slices.IndexFunc(objectType.Fields, func(f TypeField) bool { return f.Name == sel.name })
+		field := objectType.Fields[idx]
+		out = append(out, objectEntry{
+			key:   sel.key(),
+			value: s.project(props[field.Property], sel.selections, baseType(field.Type)),
+		})
+	}
+	return out
+}
+
+func selectOperation(ops []*operationDef, name string) (*operationDef, error) {
+	if name == "" {
+		if len(ops) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document contains several operations")
+		}
+		return ops[0], nil
+	}
+
+	idx := slices.IndexFunc(ops, func(op *operationDef) bool { return op.name == name })
+	if idx == -1 {
+		return nil, fmt.Errorf("unknown operation %q", name)
+	}
+	return ops[idx], nil
+}
+
+func coerceVariables(defs []variableDef, provided map[string]any) (map[string]any, error) {
+	vars := map[string]any{}
+	for _, def := range defs {
+		v, ok := provided[def.name]
+		switch {
+		case ok:
+			vars[def.name] = v
+		case def.hasDefault:
+			vars[def.name] = def.defaultValue
+		case strings.HasSuffix(def.typ, "!"):
+			return nil, fmt.Errorf("variable $%s of type %s was not provided", def.name, def.typ)
+		default:
+			vars[def.name] = nil
+		}
+		if ok && v == nil && strings.HasSuffix(def.typ, "!") {
+			return nil, fmt.Errorf("variable $%s of type %s must not be null", def.name, def.typ)
+		}
+	}
+	return vars, nil
+}
+
+func resolveValue(v any, vars map[string]any) (any, error) {
+	switch v := v.(type) {
+	case variable:
+		value, ok := vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return value, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			resolved, err := resolveValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			resolved, err := resolveValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func missingArgs(field *Field, args map[string]any) []string {
+	missing := []string{}
+	for _, a := range field.Args {
+		if a.Required && args[a.Name] == nil {
+			missing = append(missing, a.Name)
+		}
+	}
+	return missing
+}
+
+func baseType(typ string) string {
+	return strings.Trim(typ, "[]!")
+}
+
+func errorResponse(err error) Response {
+	return Response{Errors: []Error{{Message: err.Error()}}}
+}
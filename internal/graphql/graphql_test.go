@@ -0,0 +1,259 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPaths() map[string]ko.PathInfo {
+	user := openapi.NewObjectSchema().
+		WithProperty("id", openapi.NewStringSchema()).
+		WithProperty("display_name", openapi.NewStringSchema()).
+		WithProperty("age", openapi.NewIntegerSchema()).
+		WithProperty("address", openapi.NewObjectSchema().WithProperty("city", openapi.NewStringSchema()))
+
+	jsonResponse := func(schema *openapi.SchemaRef) *openapi.Responses {
+		return openapi.NewResponses(openapi.WithStatus(200, &openapi.ResponseRef{
+			Value: openapi.NewResponse().WithJSONSchemaRef(schema),
+		}))
+	}
+
+	return map[string]ko.PathInfo{
+		"/api/users": {
+			API: ko.OpenAPI{
+				BasePath: "/api/users",
+				Paths: map[string]ko.PathItem{
+					"/api/users": {
+						Get: &openapi.Operation{
+							OperationID: "list-users",
+							Parameters:  openapi.Parameters{ko.QueryParam("limit", "")},
+							Responses: jsonResponse(openapi.NewSchemaRef("", openapi.NewArraySchema().
+								WithItems(openapi.NewObjectSchema()))),
+						},
+						Post: &openapi.Operation{
+							OperationID: "create-user",
+							Responses:   jsonResponse(openapi.NewSchemaRef("#/components/schemas/User", nil)),
+						},
+					},
+					"/api/users/{id}": {
+						Get: &openapi.Operation{
+							OperationID: "get-user",
+							Parameters:  openapi.Parameters{ko.PathParam("id", "")},
+							Responses:   jsonResponse(openapi.NewSchemaRef("#/components/schemas/User", nil)),
+							Summary:     "Get a user",
+						},
+						Delete: &openapi.Operation{
+							OperationID: "delete-user",
+							Parameters:  openapi.Parameters{ko.PathParam("id", "")},
+						},
+					},
+				},
+				Schemas: map[string]*openapi.SchemaRef{
+					"User": openapi.NewSchemaRef("", user),
+				},
+			},
+			Type: ko.FunctionPathType,
+		},
+		"/-/healthz": {
+			API: ko.OpenAPI{
+				BasePath: "/-/healthz",
+				Paths: map[string]ko.PathItem{
+					"/-/healthz": {Get: &openapi.Operation{OperationID: "healthz-get"}},
+				},
+			},
+			Type: ko.SystemPathType,
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	s := Build(testPaths())
+
+	require.Len(t, s.Queries, 2)
+	assert.Equal(t, "listUsers", s.Queries[0].Name)
+	assert.Equal(t, "[JSON]", s.Queries[0].Type)
+	assert.Equal(t, []Arg{{In: ArgInQuery, Name: "limit", Param: "limit", Type: "String"}}, s.Queries[0].Args)
+
+	assert.Equal(t, "getUser", s.Queries[1].Name)
+	assert.Equal(t, "User", s.Queries[1].Type)
+	assert.Equal(t, "/api/users/{id}", s.Queries[1].Path)
+	assert.Equal(t, []Arg{{In: ArgInPath, Name: "id", Param: "id", Required: true, Type: "String"}}, s.Queries[1].Args)
+
+	require.Len(t, s.Mutations, 2)
+	assert.Equal(t, "createUser", s.Mutations[0].Name)
+	assert.Equal(t, http.MethodPost, s.Mutations[0].Method)
+	assert.Equal(t, []Arg{{In: ArgInBody, Name: InputArg, Type: "JSON"}}, s.Mutations[0].Args)
+	assert.Equal(t, "deleteUser", s.Mutations[1].Name)
+	assert.Equal(t, "JSON", s.Mutations[1].Type)
+
+	require.Contains(t, s.Types, "User")
+	assert.Equal(t, []TypeField{
+		{Name: "address", Property: "address", Type: "UserAddress"},
+		{Name: "age", Property: "age", Type: "Int"},
+		{Name: "displayName", Property: "display_name", Type: "String"},
+		{Name: "id", Property: "id", Type: "String"},
+	}, s.Types["User"].Fields)
+	assert.Contains(t, s.Types, "UserAddress")
+}
+
+func TestSDL(t *testing.T) {
+	sdl := Build(testPaths()).SDL()
+
+	assert.Contains(t, sdl, "scalar JSON\n")
+	assert.Contains(t, sdl, "type Query {\n  listUsers(limit: String): [JSON]\n  \"Get a user\"\n  getUser(id: String!): User\n}\n")
+	assert.Contains(t, sdl, "type Mutation {\n  createUser(input: JSON): User\n  deleteUser(id: String!): JSON\n}\n")
+	assert.Contains(t, sdl, "type UserAddress {\n  city: String\n}\n")
+	assert.NotContains(t, sdl, "healthz")
+}
+
+func TestBuild_uniqueNames(t *testing.T) {
+	paths := map[string]ko.PathInfo{
+		"/a": {
+			API: ko.OpenAPI{Paths: map[string]ko.PathItem{
+				"/a": {Get: &openapi.Operation{OperationID: "fetch"}},
+				"/b": {Get: &openapi.Operation{OperationID: "fetch"}},
+				"/c": {Get: &openapi.Operation{}},
+			}},
+			Type: ko.FunctionPathType,
+		},
+	}
+
+	s := Build(paths)
+
+	require.Len(t, s.Queries, 3)
+	assert.Equal(t, "fetch", s.Queries[0].Name)
+	assert.Equal(t, "fetch2", s.Queries[1].Name)
+	assert.Equal(t, "genCGet", s.Queries[2].Name)
+}
+
+func TestExecute(t *testing.T) {
+	s := Build(testPaths())
+
+	var calls []string
+	resolver := ResolverFunc(func(ctx context.Context, field *Field, args map[string]any) (any, error) {
+		calls = append(calls, fmt.Sprintf("%s %s %v", field.Method, field.Path, args))
+		switch field.Name {
+		case "getUser":
+			if args["id"] == "missing" {
+				return nil, fmt.Errorf("404 Not Found")
+			}
+			return map[string]any{
+				"id":           args["id"],
+				"display_name": "Jane",
+				"address":      map[string]any{"city": "Paris"},
+			}, nil
+		case "listUsers":
+			return []any{map[string]any{"id": "1"}}, nil
+		}
+		return map[string]any{"id": "new"}, nil
+	})
+
+	tests := []struct {
+		name  string
+		req   Request
+		calls []string
+		want  string
+	}{
+		{
+			name:  "query with alias, nested selection and typename",
+			req:   Request{Query: `{ me: getUser(id: "1") { __typename displayName age address { city } } }`},
+			calls: []string{"GET /api/users/{id} map[id:1]"},
+			want:  `{"data":{"me":{"__typename":"User","displayName":"Jane","age":null,"address":{"city":"Paris"}}}}`,
+		},
+		{
+			name: "variables and named operation",
+			req: Request{
+				OperationName: "Second",
+				Query: `
+					query First { listUsers }
+					# the one to run
+					query Second($id: String!, $limit: String = "5") { getUser(id: $id) { id } listUsers(limit: $limit) }`,
+				Variables: map[string]any{"id": "2"},
+			},
+			calls: []string{"GET /api/users/{id} map[id:2]", "GET /api/users map[limit:5]"},
+			want:  `{"data":{"getUser":{"id":"2"},"listUsers":[{"id":"1"}]}}`,
+		},
+		{
+			name:  "mutation with input",
+			req:   Request{Query: `mutation { createUser(input: {name: "Bob", tags: ["a", 1, true, null]}) { id } }`},
+			calls: []string{"POST /api/users map[input:map[name:Bob tags:[a 1 true <nil>]]]"},
+			want:  `{"data":{"createUser":{"id":"new"}}}`,
+		},
+		{
+			name:  "field errors resolve to null",
+			req:   Request{Query: `{ getUser(id: "missing") { id } other: getUser(id: "3") { id } }`},
+			calls: []string{"GET /api/users/{id} map[id:missing]", "GET /api/users/{id} map[id:3]"},
+			want:  `{"data":{"getUser":null,"other":{"id":"3"}},"errors":[{"message":"404 Not Found","path":["getUser"]}]}`,
+		},
+		{
+			name: "missing required argument",
+			req:  Request{Query: `{ getUser { id } }`},
+			want: `{"data":{"getUser":null},"errors":[{"message":"missing required arguments: id","path":["getUser"]}]}`,
+		},
+		{
+			name: "unknown field",
+			req:  Request{Query: `{ getUser(id: "1") { password } }`},
+			want: `{"errors":[{"message":"cannot query field \"password\" on type User"}]}`,
+		},
+		{
+			name: "queries cannot call mutations",
+			req:  Request{Query: `{ createUser { id } }`},
+			want: `{"errors":[{"message":"cannot query field \"createUser\" on query"}]}`,
+		},
+		{
+			name: "object without selection",
+			req:  Request{Query: `{ getUser(id: "1") }`},
+			want: `{"errors":[{"message":"field \"getUser\" of type User must have a selection set"}]}`,
+		},
+		{
+			name: "missing variable",
+			req:  Request{Query: `query ($id: String!) { getUser(id: $id) { id } }`},
+			want: `{"errors":[{"message":"variable $id of type String! was not provided"}]}`,
+		},
+		{
+			name: "too many root fields",
+			req:  Request{Query: "{" + strings.Repeat(" listUsers", MaxRootFields+1) + " }"},
+			want: `{"errors":[{"message":"request selects 17 root fields, at most 16 are allowed"}]}`,
+		},
+		{
+			name: "too many aliases",
+			req:  Request{Query: `{ getUser(id: "1") {` + strings.Repeat(" a: id", MaxAliases+1) + ` } }`},
+			want: `{"errors":[{"message":"request selects 33 aliased fields, at most 32 are allowed"}]}`,
+		},
+		{
+			name: "fragments are rejected",
+			req:  Request{Query: `{ getUser(id: "1") { ...UserFields } }`},
+			want: `{"errors":[{"message":"syntax error at offset 21: fragments are not supported"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+
+			resp := s.Execute(context.Background(), tt.req, resolver)
+
+			got, err := json.Marshal(resp)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.Equal(t, tt.want, string(got), "selection order is kept")
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestCamelName(t *testing.T) {
+	assert.Equal(t, "getUserById", camelName("get-user_by id"))
+	assert.Equal(t, "_2fa", camelName("2fa"))
+	assert.Equal(t, "_", camelName("--"))
+	assert.Equal(t, "GetUser", pascalName("get user"))
+}
@@ -0,0 +1,442 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type operationDef struct {
+	kind       string
+	name       string
+	selections []*selection
+	variables  []variableDef
+}
+
+type variableDef struct {
+	defaultValue any
+	hasDefault   bool
+	name         string
+	typ          string
+}
+
+type selection struct {
+	alias      string
+	args       []argument
+	name       string
+	selections []*selection
+}
+
+type argument struct {
+	name  string
+	value any
+}
+
+// variable is a reference to a variable in an argument value.
+type variable string
+
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type parser struct {
+	pos int
+	src string
+}
+
+func parse(src string) ([]*operationDef, error) {
+	p := &parser{src: src}
+
+	ops := []*operationDef{}
+	for {
+		p.skipIgnored()
+		if p.pos >= len(p.src) {
+			break
+		}
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("document contains no operation")
+	}
+
+	return ops, nil
+}
+
+func (p *parser) operation() (*operationDef, error) {
+	op := &operationDef{kind: "query"}
+
+	if p.peek() != '{' {
+		kind := p.name()
+		switch kind {
+		case "query", "mutation":
+			op.kind = kind
+		case "subscription":
+			return nil, p.errorf("subscriptions are not supported")
+		case "fragment":
+			return nil, p.errorf("fragments are not supported")
+		default:
+			return nil, p.errorf("expected an operation, found %q", kind)
+		}
+
+		if isNameStart(p.peek()) {
+			op.name = p.name()
+		}
+
+		if p.peek() == '(' {
+			vars, err := p.variableDefs()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = vars
+		}
+	}
+
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = sels
+
+	return op, nil
+}
+
+func (p *parser) variableDefs() ([]variableDef, error) {
+	p.pos++ // (
+
+	defs := []variableDef{}
+	for p.peek() != ')' {
+		if err := p.expect('$'); err != nil {
+			return nil, err
+		}
+		def := variableDef{name: p.name()}
+		if def.name == "" {
+			return nil, p.errorf("expected a variable name")
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def.typ = typ
+
+		if p.peek() == '=' {
+			p.pos++
+			v, err := p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			def.defaultValue = v
+			def.hasDefault = true
+		}
+
+		defs = append(defs, def)
+	}
+	p.pos++ // )
+
+	return defs, nil
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.peek() == '[' {
+		p.pos++
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(']'); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		typ = p.name()
+		if typ == "" {
+			return "", p.errorf("expected a type")
+		}
+	}
+
+	if p.peek() == '!' {
+		p.pos++
+		typ += "!"
+	}
+
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	sels := []*selection{}
+	for p.peek() != '}' {
+		switch p.peek() {
+		case 0:
+			return nil, p.errorf("unterminated selection set")
+		case '.':
+			return nil, p.errorf("fragments are not supported")
+		case '@':
+			return nil, p.errorf("directives are not supported")
+		}
+
+		sel := &selection{name: p.name()}
+		if sel.name == "" {
+			return nil, p.errorf("expected a field")
+		}
+
+		if p.peek() == ':' {
+			p.pos++
+			sel.alias = sel.name
+			sel.name = p.name()
+			if sel.name == "" {
+				return nil, p.errorf("expected a field after alias %q", sel.alias)
+			}
+		}
+
+		if p.peek() == '(' {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			sel.args = args
+		}
+
+		if p.peek() == '@' {
+			return nil, p.errorf("directives are not supported")
+		}
+
+		if p.peek() == '{' {
+			nested, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sel.selections = nested
+		}
+
+		sels = append(sels, sel)
+	}
+	p.pos++ // }
+
+	if len(sels) == 0 {
+		return nil, p.errorf("selection set is empty")
+	}
+
+	return sels, nil
+}
+
+func (p *parser) arguments() ([]argument, error) {
+	p.pos++ // (
+
+	args := []argument{}
+	for p.peek() != ')' {
+		name := p.name()
+		if name == "" {
+			return nil, p.errorf("expected an argument name")
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, argument{name: name, value: v})
+	}
+	p.pos++ // )
+
+	return args, nil
+}
+
+// value parses a value. Constant values, such as variable defaults, must not
+// reference variables.
+func (p *parser) value(constant bool) (any, error) {
+	c := p.peek()
+	switch {
+	case c == '$':
+		if constant {
+			return nil, p.errorf("variables are not allowed in constant values")
+		}
+		p.pos++
+		name := p.name()
+		if name == "" {
+			return nil, p.errorf("expected a variable name")
+		}
+		return variable(name), nil
+	case c == '"':
+		return p.stringValue()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number()
+	case c == '[':
+		p.pos++
+		list := []any{}
+		for p.peek() != ']' {
+			if p.peek() == 0 {
+				return nil, p.errorf("unterminated list")
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.pos++
+		return list, nil
+	case c == '{':
+		p.pos++
+		obj := map[string]any{}
+		for p.peek() != '}' {
+			name := p.name()
+			if name == "" {
+				return nil, p.errorf("expected an object field")
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = v
+		}
+		p.pos++
+		return obj, nil
+	case isNameStart(c):
+		switch name := p.name(); name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			// Enum values are passed to the function as strings.
+			return name, nil
+		}
+	}
+
+	return nil, p.errorf("expected a value")
+}
+
+func (p *parser) stringValue() (string, error) {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end == -1 {
+			return "", p.errorf("unterminated block string")
+		}
+		s := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += end + 6
+		return s, nil
+	}
+
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '"':
+			p.pos++
+			s, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) number() (any, error) {
+	start := p.pos
+	float := false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == 'e' || c == 'E' {
+			float = true
+		} else if !(c >= '0' && c <= '9') && c != '-' && c != '+' {
+			break
+		}
+		p.pos++
+	}
+
+	lit := p.src[start:p.pos]
+	if !float {
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", lit)
+	}
+	return f, nil
+}
+
+func (p *parser) name() string {
+	p.skipIgnored()
+	start := p.pos
+	for p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || (p.pos > start && p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// peek returns the next significant character, or 0 at the end of the
+// document.
+func (p *parser) peek() byte {
+	p.skipIgnored()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// skipIgnored skips whitespace, commas and comments which are insignificant
+// in GraphQL.
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,376 @@
+// Package graphql exposes the operations of the registered functions as a
+// GraphQL schema. GET operations become queries and writes become mutations.
+// Only the subset of GraphQL needed to select from JSON responses is
+// supported: operations, variables, aliases, arguments and nested
+// selections. Fragments and directives are rejected.
+package graphql
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+)
+
+const (
+	ArgInBody  = "body"
+	ArgInPath  = "path"
+	ArgInQuery = "query"
+
+	// InputArg is the argument holding the request body of a mutation.
+	InputArg = "input"
+
+	scalarJSON = "JSON"
+)
+
+var mutationMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Schema is the GraphQL schema generated from the function operations.
+type Schema struct {
+	Mutations []*Field
+	Queries   []*Field
+	Types     map[string]*ObjectType
+}
+
+// Field is a root field resolved by calling a function operation.
+type Field struct {
+	Args        []Arg
+	Description string
+	Method      string
+	Name        string
+	Path        string
+	Type        string
+}
+
+// Arg is an argument of a root field and where it goes in the request.
+type Arg struct {
+	In       string
+	Name     string
+	Param    string
+	Required bool
+	Type     string
+}
+
+// ObjectType is a type generated from an object schema of a response.
+type ObjectType struct {
+	Fields []TypeField
+	Name   string
+}
+
+// TypeField is a field of an object type and the property it selects.
+type TypeField struct {
+	Name     string
+	Property string
+	Type     string
+}
+
+// Build generates the schema of the function paths. Operations and fields
+// are ordered by path and method so the schema is stable across rebuilds.
+func Build(paths map[string]ko.PathInfo) *Schema {
+	s := &Schema{Types: map[string]*ObjectType{}}
+
+	for _, basePath := range slices.Sorted(maps.Keys(paths)) {
+		info := paths[basePath]
+		if info.Type != ko.FunctionPathType {
+			continue
+		}
+
+		for _, routePath := range slices.Sorted(maps.Keys(info.API.Paths)) {
+			item := info.API.Paths[routePath]
+
+			if item.Get != nil {
+				s.Queries = append(s.Queries, s.field(info.API.Schemas, routePath, http.MethodGet, item, item.Get, s.Queries))
+			}
+			for _, method := range mutationMethods {
+				if op := operation(item, method); op != nil {
+					s.Mutations = append(s.Mutations, s.field(info.API.Schemas, routePath, method, item, op, s.Mutations))
+				}
+			}
+		}
+	}
+
+	return s
+}
+
+// Field returns the root field of the operation type by name.
+func (s *Schema) Field(operationType string, name string) *Field {
+	fields := s.Queries
+	if operationType == "mutation" {
+		fields = s.Mutations
+	}
+	idx := slices.IndexFunc(fields, func(f *Field) bool { return f.Name == name })
+	if idx == -1 {
+		return nil
+	}
+	return fields[idx]
+}
+
+// SDL renders the schema in the GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+
+	b.WriteString("scalar JSON\n")
+
+	writeRoot := func(name string, fields []*Field) {
+		if len(fields) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\ntype %s {\n", name)
+		for _, f := range fields {
+			if f.Description != "" {
+				fmt.Fprintf(&b, "  %q\n", f.Description)
+			}
+			fmt.Fprintf(&b, "  %s", f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, 0, len(f.Args))
+				for _, a := range f.Args {
+					t := a.Type
+					if a.Required {
+						t += "!"
+					}
+					args = append(args, a.Name+": "+t)
+				}
+				fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+			}
+			fmt.Fprintf(&b, ": %s\n", f.Type)
+		}
+		b.WriteString("}\n")
+	}
+
+	// GraphQL requires a query type even when no function exposes a GET.
+	if len(s.Queries) == 0 {
+		b.WriteString("\ntype Query {\n  _empty: Boolean\n}\n")
+	}
+	writeRoot("Query", s.Queries)
+	writeRoot("Mutation", s.Mutations)
+
+	for _, name := range slices.Sorted(maps.Keys(s.Types)) {
+		fmt.Fprintf(&b, "\ntype %s {\n", name)
+		for _, f := range s.Types[name].Fields {
+			fmt.Fprintf(&b, "  %s: %s\n", f.Name, f.Type)
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+func (s *Schema) field(
+	schemas map[string]*openapi.SchemaRef,
+	routePath string,
+	method string,
+	item ko.PathItem,
+	op *openapi.Operation,
+	existing []*Field,
+) *Field {
+	id := op.OperationID
+	if id == "" {
+		id = ko.GenerateOperationID(ko.GenerateNameFromPath(routePath, ""), method, "")
+	}
+
+	name := uniqueName(camelName(id), func(n string) bool {
+		return slices.ContainsFunc(existing, func(f *Field) bool { return f.Name == n })
+	})
+
+	f := &Field{
+		Description: op.Summary,
+		Method:      method,
+		Name:        name,
+		Path:        routePath,
+		Type:        s.outputType(schemas, responseSchema(op), pascalName(name)+"Result", map[string]bool{}),
+	}
+
+	params := make([]*openapi.Parameter, 0, len(item.Parameters)+len(op.Parameters))
+	for i := range item.Parameters {
+		params = append(params, &item.Parameters[i])
+	}
+	for _, ref := range op.Parameters {
+		if ref != nil && ref.Value != nil {
+			params = append(params, ref.Value)
+		}
+	}
+
+	for _, p := range params {
+		if p.In != ArgInPath && p.In != ArgInQuery {
+			continue
+		}
+		argName := camelName(p.Name)
+		if slices.ContainsFunc(f.Args, func(a Arg) bool { return a.Name == argName }) {
+			continue
+		}
+		f.Args = append(f.Args, Arg{
+			In:       p.In,
+			Name:     argName,
+			Param:    p.Name,
+			Required: p.In == ArgInPath || p.Required,
+			Type:     inputType(p.Schema),
+		})
+	}
+
+	if method != http.MethodGet && method != http.MethodDelete {
+		f.Args = append(f.Args, Arg{
+			In:       ArgInBody,
+			Name:     InputArg,
+			Required: op.RequestBody != nil && op.RequestBody.Value != nil && op.RequestBody.Value.Required,
+			Type:     scalarJSON,
+		})
+	}
+
+	return f
+}
+
+// outputType returns the GraphQL type of the schema, generating object types
+// for objects with properties. The first definition of a type name wins.
+func (s *Schema) outputType(
+	schemas map[string]*openapi.SchemaRef,
+	ref *openapi.SchemaRef,
+	name string,
+	visiting map[string]bool,
+) string {
+	if ref == nil {
+		return scalarJSON
+	}
+
+	schema := ref.Value
+	if ref.Ref != "" {
+		schemaName := ref.Ref[strings.LastIndex(ref.Ref, "/")+1:]
+		name = pascalName(schemaName)
+		if schema == nil && schemas[schemaName] != nil {
+			schema = schemas[schemaName].Value
+		}
+	}
+	if schema == nil {
+		return scalarJSON
+	}
+
+	switch {
+	case schema.Type.Is(openapi.TypeArray):
+		return "[" + s.outputType(schemas, schema.Items, name+"Item", visiting) + "]"
+	case schema.Type.Is(openapi.TypeObject) || (schema.Type == nil && len(schema.Properties) > 0):
+		if len(schema.Properties) == 0 {
+			return scalarJSON
+		}
+		if _, ok := s.Types[name]; ok || visiting[name] {
+			return name
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		t := &ObjectType{Name: name}
+		for _, prop := range slices.Sorted(maps.Keys(schema.Properties)) {
+			t.Fields = append(t.Fields, TypeField{
+				Name:     camelName(prop),
+				Property: prop,
+				Type:     s.outputType(schemas, schema.Properties[prop], name+pascalName(prop), visiting),
+			})
+		}
+		s.Types[name] = t
+		return name
+	}
+
+	return scalarType(schema)
+}
+
+func inputType(ref *openapi.SchemaRef) string {
+	if ref == nil || ref.Value == nil {
+		return "String"
+	}
+	if ref.Value.Type.Is(openapi.TypeArray) {
+		return "[" + inputType(ref.Value.Items) + "]"
+	}
+	if t := scalarType(ref.Value); t != scalarJSON {
+		return t
+	}
+	return "String"
+}
+
+func scalarType(schema *openapi.Schema) string {
+	switch {
+	case schema.Type.Is(openapi.TypeBoolean):
+		return "Boolean"
+	case schema.Type.Is(openapi.TypeInteger):
+		return "Int"
+	case schema.Type.Is(openapi.TypeNumber):
+		return "Float"
+	case schema.Type.Is(openapi.TypeString):
+		return "String"
+	}
+	return scalarJSON
+}
+
+func responseSchema(op *openapi.Operation) *openapi.SchemaRef {
+	if op.Responses == nil {
+		return nil
+	}
+	for _, status := range []int{http.StatusOK, http.StatusCreated} {
+		resp := op.Responses.Status(status)
+		if resp == nil || resp.Value == nil {
+			continue
+		}
+		if mt := resp.Value.Content.Get("application/json"); mt != nil {
+			return mt.Schema
+		}
+	}
+	return nil
+}
+
+func operation(item ko.PathItem, method string) *openapi.Operation {
+	switch method {
+	case http.MethodDelete:
+		return item.Delete
+	case http.MethodPatch:
+		return item.Patch
+	case http.MethodPost:
+		return item.Post
+	case http.MethodPut:
+		return item.Put
+	}
+	return nil
+}
+
+// camelName turns an identifier like "get-user_by id" into the GraphQL name
+// "getUserById".
+func camelName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return r > unicode.MaxASCII || (!unicode.IsLetter(r) && !unicode.IsDigit(r))
+	})
+	if len(words) == 0 {
+		return "_"
+	}
+
+	var b strings.Builder
+	for i, w := range words {
+		if i == 0 {
+			b.WriteString(strings.ToLower(w[:1]) + w[1:])
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+
+	name := b.String()
+	if unicode.IsDigit(rune(name[0])) || strings.HasPrefix(name, "__") {
+		name = "_" + name
+	}
+	return name
+}
+
+func pascalName(s string) string {
+	name := camelName(s)
+	if name[0] == '_' {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func uniqueName(name string, taken func(string) bool) string {
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	return candidate
+}
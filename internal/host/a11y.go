@@ -0,0 +1,163 @@
+package host
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/kdex-tech/host-manager/internal/a11y"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// A11yAuditAnnotation enables, on a host, the accessibility audit of the
+	// renders of its pages in each of its languages.
+	A11yAuditAnnotation = "kdex.dev/a11y-audit"
+	// A11yAuditReport reports the violations at /-/admin/a11y and in the
+	// status of the page bindings.
+	A11yAuditReport = "report"
+	// A11yAuditStrict also keeps pages with critical or serious violations
+	// from being published.
+	A11yAuditStrict = "strict"
+)
+
+// A11yPageAudit is the accessibility audit of the render of a page in a
+// language.
+type A11yPageAudit struct {
+	Lang       string           `json:"lang"`
+	Page       string           `json:"page"`
+	Violations []a11y.Violation `json:"violations"`
+}
+
+// A11yReport is the latest accessibility audit of the pages of a host.
+type A11yReport struct {
+	Mode  string          `json:"mode"`
+	Pages []A11yPageAudit `json:"pages"`
+}
+
+// ParseA11yAudit returns the audit mode of the annotations of a host, "" when
+// A11yAuditAnnotation is not set.
+func ParseA11yAudit(annotations map[string]string) (string, error) {
+	switch mode := annotations[A11yAuditAnnotation]; mode {
+	case "", A11yAuditReport, A11yAuditStrict:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid %s annotation %q, expected %s or %s", A11yAuditAnnotation, mode, A11yAuditReport, A11yAuditStrict)
+	}
+}
+
+// SetA11yAudit sets the audit mode of the host, "" disables the audits.
+func (hh *HostHandler) SetA11yAudit(mode string) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.a11yMode = mode
+	if mode == "" {
+		hh.a11yAudits.Clear()
+		a11yViolationsGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+	}
+}
+
+// A11yAuditMode returns the audit mode of the host.
+func (hh *HostHandler) A11yAuditMode() string {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	return hh.a11yMode
+}
+
+// AuditPage audits the renders of the page in each language of the host and
+// records them for the report. It returns nil when audits are disabled or the
+// host is not set yet.
+func (hh *HostHandler) AuditPage(ph page.PageHandler) []A11yPageAudit {
+	hh.mu.RLock()
+	mode := hh.a11yMode
+	ready := hh.host != nil
+	translations := hh.Translations
+	hh.mu.RUnlock()
+
+	if mode == "" || !ready {
+		return nil
+	}
+	return hh.auditPage(ph, &translations)
+}
+
+// auditPages audits the pages after the mux is rebuilt, dropping the audits
+// of pages which are gone.
+func (hh *HostHandler) auditPages(pageHandlers []page.PageHandler, translations *Translations) {
+	if hh.A11yAuditMode() == "" {
+		return
+	}
+
+	names := map[string]bool{}
+	for _, ph := range pageHandlers {
+		names[ph.Name] = true
+		hh.auditPage(ph, translations)
+	}
+	hh.a11yAudits.Range(func(key, _ any) bool {
+		if !names[key.(string)] {
+			hh.a11yAudits.Delete(key)
+			a11yViolationsGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name, "page": key.(string)})
+		}
+		return true
+	})
+}
+
+func (hh *HostHandler) auditPage(ph page.PageHandler, translations *Translations) []A11yPageAudit {
+	a11yViolationsGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name, "page": ph.Name})
+
+	audits := []A11yPageAudit{}
+	for _, l := range translations.Languages() {
+		rendered, err := hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+		if err != nil {
+			hh.log.Error(err, "failed to render page for audit", "page", ph.Name, "language", l)
+			continue
+		}
+		violations, err := a11y.Audit(rendered)
+		if err != nil {
+			hh.log.Error(err, "failed to audit page", "page", ph.Name, "language", l)
+			continue
+		}
+		audits = append(audits, A11yPageAudit{Lang: l.String(), Page: ph.Name, Violations: violations})
+
+		counts := map[a11y.Impact]float64{}
+		for _, v := range violations {
+			counts[v.Impact]++
+		}
+		for _, impact := range []a11y.Impact{a11y.ImpactCritical, a11y.ImpactSerious, a11y.ImpactModerate, a11y.ImpactMinor} {
+			a11yViolationsGauge.WithLabelValues(hh.Name, ph.Name, l.String(), string(impact)).Set(counts[impact])
+		}
+	}
+
+	hh.a11yAudits.Store(ph.Name, audits)
+	return audits
+}
+
+// A11yReportGet serves the latest accessibility audit of the pages, of the
+// page query parameter when set.
+func (hh *HostHandler) A11yReportGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	report := A11yReport{Mode: hh.A11yAuditMode(), Pages: []A11yPageAudit{}}
+
+	pageName := r.URL.Query().Get("page")
+	hh.a11yAudits.Range(func(key, value any) bool {
+		if pageName == "" || pageName == key.(string) {
+			report.Pages = append(report.Pages, value.([]A11yPageAudit)...)
+		}
+		return true
+	})
+	slices.SortFunc(report.Pages, func(a, b A11yPageAudit) int {
+		return cmp.Or(cmp.Compare(a.Page, b.Page), cmp.Compare(a.Lang, b.Lang))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		hh.log.Error(err, "failed to encode accessibility report")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
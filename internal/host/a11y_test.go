@@ -0,0 +1,95 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseA11yAudit(t *testing.T) {
+	for value, want := range map[string]string{"": "", "report": A11yAuditReport, "strict": A11yAuditStrict} {
+		mode, err := ParseA11yAudit(map[string]string{A11yAuditAnnotation: value})
+		require.NoError(t, err)
+		assert.Equal(t, want, mode)
+	}
+
+	_, err := ParseA11yAudit(map[string]string{A11yAuditAnnotation: "block"})
+	assert.Error(t, err)
+}
+
+func TestHostHandler_AuditPage(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+
+	ph := page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html lang="[[ .Language ]]"><head><title>[[ .Title ]]</title></head><body><img src="/logo.png"></body></html>`,
+	}
+
+	hh.SetA11yAudit(A11yAuditStrict)
+	assert.Nil(t, hh.AuditPage(ph), "host not set")
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{ActivePair: pair}, "http")
+
+	audits := hh.AuditPage(ph)
+	require.Len(t, audits, 1)
+	assert.Equal(t, "en", audits[0].Lang)
+	assert.Equal(t, "home", audits[0].Page)
+	require.Len(t, audits[0].Violations, 1)
+	assert.Equal(t, "image-alt", audits[0].Violations[0].Rule)
+
+	// Publishing the page audits it again with the other pages of the host.
+	hh.Pages.Set(ph)
+
+	get := func(query string) A11yReport {
+		r := httptest.NewRequest(http.MethodGet, "/-/admin/a11y"+query, nil)
+		r.Header.Set("Authorization", bearerToken(t, pair, "hosts:shop:read", "hosts:shop:write"))
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		report := A11yReport{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return report
+	}
+
+	w := httptest.NewRecorder()
+	hh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/admin/a11y", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "anonymous")
+
+	r := httptest.NewRequest(http.MethodGet, "/-/admin/a11y", nil)
+	r.Header.Set("Authorization", bearerToken(t, pair, "hosts:other:read", "hosts:other:write"))
+	w = httptest.NewRecorder()
+	hh.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code, "entitled to another host")
+
+	report := get("")
+	assert.Equal(t, A11yAuditStrict, report.Mode)
+	require.Len(t, report.Pages, 1)
+	assert.Equal(t, audits[0], report.Pages[0])
+	assert.Empty(t, get("?page=other").Pages)
+
+	hh.Pages.Delete("home")
+	assert.Empty(t, get("").Pages)
+
+	hh.SetA11yAudit("")
+	assert.Nil(t, hh.AuditPage(ph))
+}
@@ -0,0 +1,73 @@
+package host
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// ACMEChallengePrefix is the path prefix of the HTTP-01 challenges of the ACME
+// certificate issuers, e.g. cert-manager.
+const ACMEChallengePrefix = "/.well-known/acme-challenge/"
+
+// ACMESolver answers the HTTP-01 challenges of a domain at a path, e.g. the
+// solver cert-manager runs while it issues a certificate for the domain.
+type ACMESolver struct {
+	// Domain is the domain of the challenge, empty for every domain.
+	Domain string
+	// Path is the path of the challenge, ACMEChallengePrefix followed by its
+	// token.
+	Path string
+	// URL is the URL of the solver, e.g.
+	// "http://cm-acme-http-solver-abcde.shop.svc:8089".
+	URL *url.URL
+}
+
+// SetACMESolvers replaces the solvers of the HTTP-01 challenges of the host.
+// The challenges without a solver are not found.
+func (hh *HostHandler) SetACMESolvers(solvers []ACMESolver) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.acmeSolvers = solvers
+}
+
+// ACMEChallengeGet passes the HTTP-01 challenge through to its solver, keeping
+// the Host of the request which the solver checks against its domain. The
+// challenges reach the host when the ingress controller routes them with the
+// default backend instead of the rules of the solver.
+func (hh *HostHandler) ACMEChallengeGet(w http.ResponseWriter, r *http.Request) {
+	domain := r.Host
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+
+	var target *url.URL
+	hh.mu.RLock()
+	for _, solver := range hh.acmeSolvers {
+		if solver.Path == r.URL.Path && (solver.Domain == "" || strings.EqualFold(solver.Domain, domain)) {
+			target = solver.URL
+			break
+		}
+	}
+	hh.mu.RUnlock()
+
+	if target == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(preq *httputil.ProxyRequest) {
+			preq.SetURL(target)
+			preq.Out.Host = preq.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			hh.log.Error(err, "acme solver unavailable", "url", target, "path", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,67 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_ACMEChallengeGet(t *testing.T) {
+	solver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like the cert-manager solver, answer the challenge of its domain only.
+		if host, _, _ := strings.Cut(r.Host, ":"); host != "shop.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("key-authorization " + r.URL.Path))
+	}))
+	defer solver.Close()
+	solverURL, err := url.Parse(solver.URL)
+	require.NoError(t, err)
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		Routing:     kdexv1alpha1.Routing{Domains: []string{"shop.example.com", "outlet.example.com"}},
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	serve := func(host string, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Host = host
+		hh.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := serve("shop.example.com", ACMEChallengePrefix+"abc")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	hh.SetACMESolvers([]ACMESolver{
+		{Domain: "shop.example.com", Path: ACMEChallengePrefix + "abc", URL: solverURL},
+	})
+
+	rr = serve("shop.example.com:80", ACMEChallengePrefix+"abc")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "key-authorization "+ACMEChallengePrefix+"abc", rr.Body.String())
+
+	rr = serve("outlet.example.com", ACMEChallengePrefix+"abc")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve("shop.example.com", ACMEChallengePrefix+"def")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	solver.Close()
+	rr = serve("shop.example.com", ACMEChallengePrefix+"abc")
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+}
@@ -0,0 +1,447 @@
+package host
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/archive"
+	"github.com/kdex-tech/host-manager/internal/page"
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// ArchiveAnnotation enables, on a host, the archival of each version of
+	// the renders of its pages, i.e. each render with a new hash, to a bucket
+	// with object lock enabled of an S3 compatible storage, e.g.
+	// {"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records","retentionDays":2557}.
+	// The versions are locked in COMPLIANCE mode unless the mode is
+	// GOVERNANCE, and placed under a legal hold when legalHold is true.
+	ArchiveAnnotation = "kdex.dev/archive"
+	// ArchiveSecretType is the kdex.dev/secret-type of the service account
+	// secret holding, in its access_key_id and secret_access_key keys, the
+	// credentials of the bucket.
+	ArchiveSecretType = "archive"
+
+	archiveTimeout = time.Minute
+)
+
+var archiveVersionRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Archive is the configuration of the archival of the renders of a host.
+type Archive struct {
+	LegalHold bool
+	Mode      string
+	Prefix    string
+	Retention time.Duration
+	Store     *archive.Store
+
+	fingerprint string
+}
+
+// ArchiveRecord is the metadata of an archived version of the render of a
+// page in a language, stored along with it.
+type ArchiveRecord struct {
+	Archived    time.Time `json:"archived"`
+	Host        string    `json:"host"`
+	Lang        string    `json:"lang"`
+	LegalHold   *bool     `json:"legalHold,omitempty"`
+	Mode        string    `json:"mode"`
+	Page        string    `json:"page"`
+	Path        string    `json:"path"`
+	RetainUntil time.Time `json:"retainUntil"`
+	SHA256      string    `json:"sha256"`
+}
+
+// ArchiveVersion is an archived version of the render of a page in a
+// language, as listed.
+type ArchiveVersion struct {
+	Archived time.Time `json:"archived"`
+	Lang     string    `json:"lang"`
+	Page     string    `json:"page"`
+	SHA256   string    `json:"sha256"`
+}
+
+type archivedRender struct {
+	html   string
+	record ArchiveRecord
+}
+
+// ParseArchive returns the archival of the annotations of a host with the
+// credentials of its bucket, nil when ArchiveAnnotation is not set.
+func ParseArchive(annotations map[string]string, secrets kdexv1alpha1.ServiceAccountSecrets) (*Archive, error) {
+	value := annotations[ArchiveAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	config := struct {
+		Bucket        string `json:"bucket"`
+		Endpoint      string `json:"endpoint"`
+		LegalHold     bool   `json:"legalHold"`
+		Mode          string `json:"mode"`
+		Prefix        string `json:"prefix"`
+		Region        string `json:"region"`
+		RetentionDays int    `json:"retentionDays"`
+	}{}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q, expected a JSON object of endpoint, region, bucket and retentionDays: %w", ArchiveAnnotation, value, err)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid %s annotation %q, endpoint %q is not an http(s) url", ArchiveAnnotation, value, config.Endpoint)
+	}
+	if config.Bucket == "" || config.Region == "" {
+		return nil, fmt.Errorf("invalid %s annotation %q, bucket and region are required", ArchiveAnnotation, value)
+	}
+	if config.RetentionDays <= 0 {
+		return nil, fmt.Errorf("invalid %s annotation %q, retentionDays must be positive", ArchiveAnnotation, value)
+	}
+	mode := cmp.Or(config.Mode, archive.RetentionCompliance)
+	if mode != archive.RetentionCompliance && mode != archive.RetentionGovernance {
+		return nil, fmt.Errorf("invalid %s annotation %q, mode must be %s or %s", ArchiveAnnotation, value, archive.RetentionCompliance, archive.RetentionGovernance)
+	}
+
+	archiveSecrets := secrets.Filter(func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] == ArchiveSecretType })
+	if len(archiveSecrets) != 1 {
+		return nil, fmt.Errorf("%s annotation requires one service account secret of type %s, found %d", ArchiveAnnotation, ArchiveSecretType, len(archiveSecrets))
+	}
+	secret := archiveSecrets[0]
+	accessKeyID, secretAccessKey := string(secret.Data["access_key_id"]), string(secret.Data["secret_access_key"])
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("secret %s of %s annotation has no access_key_id or secret_access_key", secret.Name, ArchiveAnnotation)
+	}
+
+	fingerprint := sha256.New()
+	fingerprint.Write([]byte(value))
+	for _, key := range slices.Sorted(maps.Keys(secret.Data)) {
+		fmt.Fprintf(fingerprint, "%s\x00%s\n", key, secret.Data[key])
+	}
+
+	return &Archive{
+		LegalHold: config.LegalHold,
+		Mode:      mode,
+		Prefix:    config.Prefix,
+		Retention: time.Duration(config.RetentionDays) * 24 * time.Hour,
+		Store: &archive.Store{
+			AccessKeyID:     accessKeyID,
+			Bucket:          config.Bucket,
+			Client:          &http.Client{Timeout: archiveTimeout},
+			Endpoint:        endpoint,
+			Region:          config.Region,
+			SecretAccessKey: secretAccessKey,
+		},
+		fingerprint: hex.EncodeToString(fingerprint.Sum(nil)),
+	}, nil
+}
+
+// SetArchive sets the archival of the host, nil disables it. The renders are
+// archived when the mux is rebuilt.
+func (hh *HostHandler) SetArchive(a *Archive) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if a == nil && hh.archive == nil ||
+		a != nil && hh.archive != nil && a.fingerprint == hh.archive.fingerprint {
+		return
+	}
+	hh.archive = a
+	hh.archived.Clear()
+}
+
+// archiveRenders archives, in the background, the renders of the pages after
+// the mux is rebuilt which are not archived yet. Each version is written once
+// to the bucket, by any replica of the host, and can not be altered or
+// deleted before its retention ends.
+func (hh *HostHandler) archiveRenders(pageHandlers []page.PageHandler, translations *Translations) {
+	hh.mu.RLock()
+	a := hh.archive
+	hh.mu.RUnlock()
+
+	if a == nil {
+		return
+	}
+
+	renders := []archivedRender{}
+	for _, ph := range pageHandlers {
+		for _, l := range translations.Languages() {
+			rendered, err := hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+			if err != nil {
+				hh.log.Error(err, "failed to render page for archive", "page", ph.Name, "language", l)
+				continue
+			}
+			sum := renderHash(rendered)
+			if archived, ok := hh.archived.Load(ph.Name + "/" + l.String()); ok && archived == sum {
+				continue
+			}
+			pagePath := ph.BasePath()
+			if l.String() != hh.defaultLanguage {
+				pagePath = "/" + l.String() + pagePath
+			}
+			renders = append(renders, archivedRender{
+				html: rendered,
+				record: ArchiveRecord{
+					Host:   hh.Name,
+					Lang:   l.String(),
+					Mode:   a.Mode,
+					Page:   ph.Name,
+					Path:   pagePath,
+					SHA256: sum,
+				},
+			})
+		}
+	}
+	if len(renders) == 0 {
+		return
+	}
+
+	go func() {
+		hh.archiveMu.Lock()
+		defer hh.archiveMu.Unlock()
+
+		for _, render := range renders {
+			if err := hh.storeRender(context.Background(), a, render); err != nil {
+				archiveFailuresCounter.WithLabelValues(hh.Name).Inc()
+				hh.log.Error(err, "failed to archive page", "page", render.record.Page, "language", render.record.Lang, "sha256", render.record.SHA256)
+				continue
+			}
+			hh.archived.Store(render.record.Page+"/"+render.record.Lang, render.record.SHA256)
+		}
+	}()
+}
+
+// storeRender writes the render and its record to the bucket, unless they
+// were written before.
+func (hh *HostHandler) storeRender(ctx context.Context, a *Archive, render archivedRender) error {
+	now := time.Now().UTC()
+	lock := archive.Lock{LegalHold: a.LegalHold, Mode: a.Mode, Until: now.Add(a.Retention)}
+	record := render.record
+	record.Archived = now
+	record.RetainUntil = lock.Until
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	key := a.key(record.Host, record.Page, record.Lang, record.SHA256)
+	for _, object := range []struct {
+		body        []byte
+		contentType string
+		key         string
+	}{
+		{body: []byte(render.html), contentType: "text/html; charset=utf-8", key: key + ".html"},
+		{body: payload, contentType: "application/json", key: key + ".json"},
+	} {
+		exists, err := a.Store.Exists(ctx, object.key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := a.Store.Put(ctx, object.key, object.body, object.contentType, map[string]string{
+			"Host":   record.Host,
+			"Lang":   record.Lang,
+			"Page":   record.Page,
+			"Sha256": record.SHA256,
+		}, lock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key is the key of the version of the render, without extension.
+func (a *Archive) key(host string, pageName string, lang string, sum string) string {
+	return a.Prefix + host + "/" + pageName + "/" + lang + "/" + sum
+}
+
+// ArchiveGet lists the archived versions of the renders of the pages, of the
+// page and lang query parameters when set, the latest archived first.
+func (hh *HostHandler) ArchiveGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+	a := hh.currentArchive(w, r)
+	if a == nil {
+		return
+	}
+
+	hostPrefix := a.Prefix + hh.Name + "/"
+	prefix := hostPrefix
+	pageName, lang := r.URL.Query().Get("page"), r.URL.Query().Get("lang")
+	if pageName != "" {
+		prefix += pageName + "/"
+		if lang != "" {
+			prefix += lang + "/"
+		}
+	}
+
+	objects, err := a.Store.List(r.Context(), prefix)
+	if err != nil {
+		hh.log.Error(err, "failed to list archived pages")
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	versions := []ArchiveVersion{}
+	for _, object := range objects {
+		parts := strings.Split(strings.TrimPrefix(object.Key, hostPrefix), "/")
+		if len(parts) != 3 || !strings.HasSuffix(parts[2], ".html") || lang != "" && parts[1] != lang {
+			continue
+		}
+		versions = append(versions, ArchiveVersion{
+			Archived: object.LastModified,
+			Lang:     parts[1],
+			Page:     parts[0],
+			SHA256:   strings.TrimSuffix(parts[2], ".html"),
+		})
+	}
+	slices.SortFunc(versions, func(a, b ArchiveVersion) int {
+		return cmp.Or(b.Archived.Compare(a.Archived), cmp.Compare(a.Page, b.Page), cmp.Compare(a.Lang, b.Lang))
+	})
+
+	hh.writeArchiveJSON(w, map[string]any{"versions": versions})
+}
+
+// ArchiveVersionGet serves the archived version of the render of a page in a
+// language, as it was published.
+func (hh *HostHandler) ArchiveVersionGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+	a, key := hh.archiveVersion(w, r)
+	if a == nil {
+		return
+	}
+
+	body, contentType, err := a.Store.Get(r.Context(), key+".html")
+	if err != nil {
+		hh.writeArchiveError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", cmp.Or(contentType, "text/html; charset=utf-8"))
+	_, _ = w.Write(body)
+}
+
+// ArchiveRecordGet serves the record of an archived version, with its
+// current legal hold.
+func (hh *HostHandler) ArchiveRecordGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+	a, key := hh.archiveVersion(w, r)
+	if a == nil {
+		return
+	}
+
+	body, _, err := a.Store.Get(r.Context(), key+".json")
+	if err != nil {
+		hh.writeArchiveError(w, r, err)
+		return
+	}
+	record := ArchiveRecord{}
+	if err := json.Unmarshal(body, &record); err != nil {
+		hh.log.Error(err, "failed to parse archive record", "key", key)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	held, err := a.Store.LegalHold(r.Context(), key+".html")
+	if err != nil {
+		hh.writeArchiveError(w, r, err)
+		return
+	}
+	record.LegalHold = &held
+
+	hh.writeArchiveJSON(w, record)
+}
+
+// ArchiveLegalHoldPut places an archived version under a legal hold, or
+// releases it, as the legalHold of the body.
+func (hh *HostHandler) ArchiveLegalHoldPut(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+	a, key := hh.archiveVersion(w, r)
+	if a == nil {
+		return
+	}
+
+	body := struct {
+		LegalHold *bool `json:"legalHold"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil || body.LegalHold == nil {
+		http.Error(w, "expected a JSON object of legalHold", http.StatusBadRequest)
+		return
+	}
+
+	for _, object := range []string{key + ".html", key + ".json"} {
+		if err := a.Store.SetLegalHold(r.Context(), object, *body.LegalHold); err != nil {
+			hh.writeArchiveError(w, r, err)
+			return
+		}
+	}
+
+	hh.log.Info("archive legal hold", "key", key, "legalHold", *body.LegalHold)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentArchive returns the archival of the host, nil when the request was
+// answered because the host archives nothing.
+func (hh *HostHandler) currentArchive(w http.ResponseWriter, r *http.Request) *Archive {
+	hh.mu.RLock()
+	a := hh.archive
+	hh.mu.RUnlock()
+
+	if a == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+	}
+	return a
+}
+
+// archiveVersion returns the archival of the host and the key of the version
+// of the path values, nil when the request was answered.
+func (hh *HostHandler) archiveVersion(w http.ResponseWriter, r *http.Request) (*Archive, string) {
+	a := hh.currentArchive(w, r)
+	if a == nil {
+		return nil, ""
+	}
+	pageName, lang, version := r.PathValue("page"), r.PathValue("lang"), r.PathValue("sha256")
+	if pageName == "" || lang == "" || !archiveVersionRegex.MatchString(version) {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return nil, ""
+	}
+	return a, a.key(hh.Name, pageName, lang, version)
+}
+
+func (hh *HostHandler) writeArchiveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, archive.ErrNotFound) {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	hh.log.Error(err, "failed to read archive", "path", r.URL.Path)
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
+
+func (hh *HostHandler) writeArchiveJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		hh.log.Error(err, "failed to encode archive response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
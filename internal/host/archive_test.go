@@ -0,0 +1,233 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/archive"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// archiveBucket is a bucket of the records of the renders holding its objects
+// in memory, refusing to overwrite them.
+type archiveBucket struct {
+	holds   map[string]string
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (b *archiveBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/records/")
+	_, hold := r.URL.Query()["legal-hold"]
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		result := struct {
+			XMLName  xml.Name         `xml:"ListBucketResult"`
+			Contents []archive.Object `xml:"Contents"`
+		}{}
+		for k, body := range b.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, archive.Object{Key: k, LastModified: time.Now().UTC(), Size: int64(len(body))})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut && hold:
+		body, _ := io.ReadAll(r.Body)
+		b.holds[key] = map[bool]string{true: "ON", false: "OFF"}[strings.Contains(string(body), "ON")]
+	case r.Method == http.MethodPut:
+		if _, ok := b.objects[key]; ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		b.objects[key] = body
+		b.puts++
+		if r.Header.Get("X-Amz-Object-Lock-Mode") != archive.RetentionCompliance {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	case r.Method == http.MethodGet && hold:
+		status, ok := b.holds[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("<LegalHold><Status>" + status + "</Status></LegalHold>"))
+	default:
+		body, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	}
+}
+
+func (b *archiveBucket) count() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.objects), b.puts
+}
+
+func archiveSecret(data map[string][]byte) corev1.Secret {
+	return corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "archive",
+			Annotations: map[string]string{"kdex.dev/secret-type": ArchiveSecretType},
+		},
+		Data: data,
+	}
+}
+
+func TestParseArchive(t *testing.T) {
+	a, err := ParseArchive(map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	secrets := kdexv1alpha1.ServiceAccountSecrets{
+		archiveSecret(map[string][]byte{"access_key_id": []byte("key"), "secret_access_key": []byte("secret")}),
+	}
+	a, err = ParseArchive(map[string]string{
+		ArchiveAnnotation: `{"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records","prefix":"web/","retentionDays":7}`,
+	}, secrets)
+	require.NoError(t, err)
+	assert.Equal(t, archive.RetentionCompliance, a.Mode)
+	assert.Equal(t, 7*24*time.Hour, a.Retention)
+	assert.Equal(t, "records", a.Store.Bucket)
+	assert.Equal(t, "key", a.Store.AccessKeyID)
+	assert.Equal(t, "web/shop/home/en/0", a.key("shop", "home", "en", "0"))
+
+	for _, value := range []string{
+		`[]`,
+		`{"endpoint":"s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records","retentionDays":7}`,
+		`{"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","retentionDays":7}`,
+		`{"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records"}`,
+		`{"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records","retentionDays":7,"mode":"NONE"}`,
+	} {
+		_, err = ParseArchive(map[string]string{ArchiveAnnotation: value}, secrets)
+		assert.Error(t, err, value)
+	}
+
+	_, err = ParseArchive(map[string]string{
+		ArchiveAnnotation: `{"endpoint":"https://s3.eu-west-1.amazonaws.com","region":"eu-west-1","bucket":"records","retentionDays":7}`,
+	}, kdexv1alpha1.ServiceAccountSecrets{archiveSecret(map[string][]byte{"access_key_id": []byte("key")})})
+	assert.ErrorContains(t, err, "no access_key_id or secret_access_key")
+}
+
+func TestHostHandler_Archive(t *testing.T) {
+	bucket := &archiveBucket{holds: map[string]string{}, objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	a, err := ParseArchive(map[string]string{
+		ArchiveAnnotation: `{"endpoint":"` + server.URL + `","region":"eu-west-1","bucket":"records","retentionDays":7}`,
+	}, kdexv1alpha1.ServiceAccountSecrets{
+		archiveSecret(map[string][]byte{"access_key_id": []byte("key"), "secret_access_key": []byte("secret")}),
+	})
+	require.NoError(t, err)
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+	hh.SetArchive(a)
+
+	ph := page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><body>Terms of sale</body></html>`,
+	}
+	hh.Pages.Set(ph)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{ActivePair: pair}, "http")
+
+	assert.Eventually(t, func() bool {
+		objects, _ := bucket.count()
+		return objects == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", bearerToken(t, pair, "hosts:shop:read", "hosts:shop:write"))
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	hh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/admin/archive", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "anonymous")
+
+	w = serve(http.MethodGet, "/-/admin/archive?page=home&lang=en", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	list := struct {
+		Versions []ArchiveVersion `json:"versions"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Versions, 1)
+	version := list.Versions[0]
+	assert.Equal(t, "home", version.Page)
+	assert.Equal(t, "en", version.Lang)
+
+	versionPath := "/-/admin/archive/home/en/" + version.SHA256
+	w = serve(http.MethodGet, versionPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Terms of sale")
+	assert.Equal(t, version.SHA256, renderHash(w.Body.String()))
+
+	record := func() ArchiveRecord {
+		w := serve(http.MethodGet, versionPath+"/metadata", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		record := ArchiveRecord{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+		return record
+	}
+	r := record()
+	assert.Equal(t, "/home", r.Path)
+	assert.Equal(t, archive.RetentionCompliance, r.Mode)
+	assert.WithinDuration(t, r.Archived.Add(7*24*time.Hour), r.RetainUntil, time.Second)
+	require.NotNil(t, r.LegalHold)
+	assert.False(t, *r.LegalHold)
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, versionPath+"/legal-hold", `{}`).Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPut, versionPath+"/legal-hold", `{"legalHold":true}`).Code)
+	assert.True(t, *record().LegalHold)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/archive/home/en/"+strings.Repeat("0", 64), "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/archive/home/en/latest", "").Code)
+
+	// Publishing the same render archives nothing new.
+	hh.Pages.Set(ph)
+	time.Sleep(50 * time.Millisecond)
+	objects, puts := bucket.count()
+	assert.Equal(t, 2, objects)
+	assert.Equal(t, 2, puts)
+
+	hh.SetArchive(nil)
+	hh.Pages.Set(ph)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/archive", "").Code)
+}
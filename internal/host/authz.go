@@ -0,0 +1,203 @@
+package host
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// AuthzPath is the path of the endpoint verifying, for the ingress
+	// controllers and the gateways offloading the authentication of the host
+	// to the edge, whether a request may reach its backend.
+	AuthzPath = "/-/authz"
+	// AuthzSubjectHeader holds, on the authorized requests, the subject of
+	// their identity, empty for the anonymous ones.
+	AuthzSubjectHeader = "X-Auth-Subject"
+
+	// The identity headers of the authorized requests in the names of
+	// oauth2-proxy, for the backends already behind one.
+	AuthzEmailHeader  = "X-Auth-Request-Email"
+	AuthzGroupsHeader = "X-Auth-Request-Groups"
+	AuthzUserHeader   = "X-Auth-Request-User"
+)
+
+// AuthzIdentityHeaders are the headers of the identity of the authorized
+// requests, which the edge copies onto the requests passed on to the
+// backends.
+var AuthzIdentityHeaders = []string{AuthzSubjectHeader, AuthzEmailHeader, AuthzGroupsHeader, AuthzUserHeader}
+
+var authzMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace,
+}
+
+// authzRoute holds the access decision inputs of an operation of the host.
+type authzRoute struct {
+	requirements []kdexv1alpha1.SecurityRequirement
+	resource     string
+	resourceName string
+}
+
+func (authzRoute) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+// newAuthzRoutes returns the mux matching the original requests verified by
+// AuthzVerify with the operations of the registered paths. The operations
+// without requirements of their own, and every method of the paths of the
+// backends, require those of the host, except for the functions which are
+// public unless they declare some. Conflicting patterns are skipped.
+func newAuthzRoutes(registeredPaths map[string]ko.PathInfo, hostRequirements []kdexv1alpha1.SecurityRequirement) *http.ServeMux {
+	routes := http.NewServeMux()
+
+	for _, path := range slices.Sorted(maps.Keys(registeredPaths)) {
+		info := registeredPaths[path]
+		resource := "backends"
+		switch info.Type {
+		case ko.FunctionPathType:
+			resource = "functions"
+		case ko.PagePathType:
+			resource = "pages"
+		}
+
+		for _, pattern := range slices.Sorted(maps.Keys(info.API.Paths)) {
+			item := info.API.Paths[pattern]
+			for _, method := range authzMethods {
+				op := item.GetOperation(method)
+				if op == nil && info.Type != ko.BackendPathType {
+					continue
+				}
+
+				route := authzRoute{
+					requirements: hostRequirements,
+					resource:     resource,
+					resourceName: info.API.BasePath,
+				}
+				if info.Type == ko.FunctionPathType || (op != nil && op.Security != nil) {
+					route.requirements = operationRequirements(op)
+				}
+
+				func() {
+					defer func() { _ = recover() }()
+					routes.Handle(method+" "+pattern, route)
+				}()
+			}
+		}
+	}
+
+	return routes
+}
+
+// authzOriginalRequest returns the method and the path of the request being
+// verified, passed on by nginx in X-Original-Method and X-Original-URI, by
+// Traefik in X-Forwarded-Method and X-Forwarded-Uri, or, by the gateways
+// implementing the HTTP ExternalAuth filter, as the method of the request and
+// its path following AuthzPath.
+func authzOriginalRequest(r *http.Request) (string, string, error) {
+	method, uri := r.Header.Get("X-Original-Method"), r.Header.Get("X-Original-URI")
+	if uri == "" {
+		method, uri = r.Header.Get("X-Forwarded-Method"), r.Header.Get("X-Forwarded-Uri")
+	}
+	if uri == "" {
+		return r.Method, authzCleanPath(strings.TrimPrefix(r.URL.Path, AuthzPath)), nil
+	}
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid original URI %q: %w", uri, err)
+	}
+	return cmp.Or(strings.ToUpper(method), http.MethodGet), authzCleanPath(u.Path), nil
+}
+
+// authzCleanPath returns the canonical path of the original request, keeping
+// its trailing slash, so that the requirements of its route apply to it
+// however its dot segments and slashes are written. The original URIs are
+// passed on unnormalized, e.g. the $request_uri of nginx.
+func authzCleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// authzRequirements returns the resource, its name and the requirements of the
+// operation of the method and the path. The paths unknown to the host, e.g.
+// those of the backends declared outside of it, require the security of the
+// host.
+func (hh *HostHandler) authzRequirements(method string, path string) (string, string, []kdexv1alpha1.SecurityRequirement) {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	if hh.authzRoutes != nil {
+		handler, _ := hh.authzRoutes.Handler(&http.Request{Method: method, URL: &url.URL{Path: path}})
+		if route, ok := handler.(authzRoute); ok {
+			return route.resource, route.resourceName, route.requirements
+		}
+	}
+
+	return "backends", path, hh.hostRequirementsLocked()
+}
+
+// setAuthzIdentity sets the identity headers of the auth context, none for
+// the anonymous requests.
+func setAuthzIdentity(header http.Header, authContext auth.AuthContext) {
+	if subject, _ := authContext.GetSubject(); subject != "" {
+		header.Set(AuthzSubjectHeader, subject)
+		header.Set(AuthzUserHeader, subject)
+	}
+	if email, _ := authContext["email"].(string); email != "" {
+		header.Set(AuthzEmailHeader, email)
+	}
+	if roles, _ := authContext.GetRoles(); len(roles) > 0 {
+		header.Set(AuthzGroupsHeader, strings.Join(roles, ","))
+	}
+}
+
+// AuthzVerify answers 200 when the original request may reach its backend,
+// with its identity in AuthzIdentityHeaders, 401 when it must be authenticated
+// first and 403 when its identity lacks the entitlements of its path. Every
+// request is allowed when the authentication of the host is disabled.
+func (hh *HostHandler) AuthzVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	method, path, err := authzOriginalRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	authContext, authenticated := auth.GetAuthContext(r.Context())
+	setAuthzIdentity(w.Header(), authContext)
+
+	if !hh.authConfig.IsAuthEnabled() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	resource, resourceName, requirements := hh.authzRequirements(method, path)
+	authorized, err := hh.authChecker.CheckAccess(r.Context(), resource, resourceName, requirements)
+	if !authorized {
+		hh.auditAccessDenied(r, method, path, resource, resourceName, err)
+	}
+	switch {
+	case err != nil:
+		hh.log.Error(err, "edge authorization check failed", "method", method, "path", path)
+		w.WriteHeader(http.StatusForbidden)
+	case authorized:
+		w.WriteHeader(http.StatusOK)
+	case !authenticated:
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		hh.log.V(1).Info("edge authorization denied", "method", method, "path", path)
+		w.WriteHeader(http.StatusForbidden)
+	}
+}
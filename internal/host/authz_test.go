@@ -0,0 +1,205 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestAuthzOriginalRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    func() *http.Request
+		wantMethod string
+		wantPath   string
+		wantErr    bool
+	}{
+		{
+			name: "nginx auth_request",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", AuthzPath, nil)
+				r.Header.Set("X-Original-Method", "post")
+				r.Header.Set("X-Original-URI", "/-/orders/42?expand=lines")
+				return r
+			},
+			wantMethod: "POST",
+			wantPath:   "/-/orders/42",
+		},
+		{
+			name: "traefik forwardAuth",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", AuthzPath, nil)
+				r.Header.Set("X-Forwarded-Uri", "/-/orders/")
+				return r
+			},
+			wantMethod: "GET",
+			wantPath:   "/-/orders/",
+		},
+		{
+			name: "gateway external auth",
+			request: func() *http.Request {
+				return httptest.NewRequest("DELETE", AuthzPath+"/-/orders/42", nil)
+			},
+			wantMethod: "DELETE",
+			wantPath:   "/-/orders/42",
+		},
+		{
+			name: "unnormalized original URI",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", AuthzPath, nil)
+				r.Header.Set("X-Original-URI", "/-/catalog/..//orders/./42/?x=1")
+				return r
+			},
+			wantMethod: "GET",
+			wantPath:   "/-/orders/42/",
+		},
+		{
+			name: "unnormalized gateway path",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", AuthzPath, nil)
+				r.URL.Path = AuthzPath + "/-/catalog/../../-/orders"
+				return r
+			},
+			wantMethod: "GET",
+			wantPath:   "/-/orders",
+		},
+		{
+			name: "invalid original URI",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", AuthzPath, nil)
+				r.Header.Set("X-Original-URI", "orders")
+				return r
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, path, err := authzOriginalRequest(tt.request())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMethod, method)
+			assert.Equal(t, tt.wantPath, path)
+		})
+	}
+}
+
+func TestHostHandler_AuthzVerify(t *testing.T) {
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+	security := []kdexv1alpha1.SecurityRequirement{{"bearer": {"orders"}}}
+	paths := map[string]ko.PathInfo{
+		"/-/orders/": {
+			API: ko.OpenAPI{
+				BasePath: "/-/orders/",
+				Paths: map[string]ko.PathItem{
+					"/-/orders/{path...}": {Get: &openapi.Operation{OperationID: "orders-get"}},
+				},
+			},
+			Type: ko.BackendPathType,
+		},
+		"/-/catalog": {
+			API: ko.OpenAPI{
+				BasePath: "/-/catalog",
+				Paths: map[string]ko.PathItem{
+					"/-/catalog": {Get: &openapi.Operation{OperationID: "catalog-get"}},
+				},
+			},
+			Type: ko.FunctionPathType,
+		},
+	}
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		Security:    &security,
+	}, nil, 0, nil, nil, nil, "", paths, nil, &auth.Exchanger{}, &auth.Config{
+		ActivePair:            pair,
+		AnonymousEntitlements: []string{"functions:/-/catalog:read"},
+	}, "http")
+
+	token := func(entitlements ...string) string {
+		unsigned := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"sub":          "jane",
+			"email":        "jane@example.com",
+			"entitlements": entitlements,
+			"roles":        []string{"buyer", "staff"},
+		})
+		unsigned.Header["kid"] = pair.KeyId
+		signed, err := unsigned.SignedString(pair.Private)
+		require.NoError(t, err)
+		return signed
+	}
+	verify := func(method string, uri string, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", AuthzPath, nil)
+		r.Header.Set("X-Original-Method", method)
+		r.Header.Set("X-Original-URI", uri)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		hh.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := verify("GET", "/-/orders/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = verify("POST", "/-/orders/42", token("backends:/-/orders/:read"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = verify("POST", "/-/orders/42", token("orders", "backends:/-/orders/:read"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "jane", rr.Header().Get(AuthzSubjectHeader))
+	assert.Equal(t, "jane", rr.Header().Get(AuthzUserHeader))
+	assert.Equal(t, "jane@example.com", rr.Header().Get(AuthzEmailHeader))
+	assert.Equal(t, "buyer,staff", rr.Header().Get(AuthzGroupsHeader))
+
+	rr = verify("GET", "/-/catalog", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(AuthzSubjectHeader))
+
+	// The dot segments do not reach a route past its requirements
+	rr = verify("GET", "/-/catalog/../orders/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = verify("POST", "/-/catalog/../orders/42", token("backends:/-/orders/:read"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = verify("GET", "/-/orders/../catalog", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The gateways pass the path of the original request after AuthzPath.
+	r := httptest.NewRequest("GET", AuthzPath+"/-/catalog", nil)
+	rr = httptest.NewRecorder()
+	hh.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestHostHandler_AuthzVerifyDisabled(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	r := httptest.NewRequest("GET", AuthzPath, nil)
+	r.Header.Set("X-Original-URI", "/-/orders/42")
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
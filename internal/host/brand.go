@@ -0,0 +1,134 @@
+package host
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html"
+	"maps"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// BrandsAnnotation holds, on a host serving several brands, the JSON encoded
+// Brand of each of its domains, e.g.
+// {"shop.example.org": {"brandName": "Example Outlet", "symbols": {"--color-primary": "#c00"}}}.
+// The requests of the other domains get the brand of the host.
+const BrandsAnnotation = "kdex.dev/brands"
+
+var (
+	symbolName    = regexp.MustCompile(`^--[a-zA-Z0-9_-]+$`)
+	symbolInvalid = regexp.MustCompile(`[<>{};\\]|/\*`)
+)
+
+// Brand overrides the brand of a host for the requests of one of its domains.
+// It is exposed to the templates as .Extra.Brand, so that they can vary, e.g.
+// the logo or the footer, by .Extra.Brand.Domain.
+type Brand struct {
+	// BrandName replaces the brand name of the host, when set.
+	BrandName string `json:"brandName,omitempty"`
+	// Domain is the domain of the brand.
+	Domain string `json:"-"`
+	// Organization replaces the organization of the host, when set.
+	Organization string `json:"organization,omitempty"`
+	// Symbols override the CSS custom properties of the theme, e.g.
+	// "--color-primary".
+	Symbols map[string]string `json:"symbols,omitempty"`
+}
+
+// ParseBrands returns the brands of BrandsAnnotation by domain, nil when it is
+// not set. Every domain must be one of the domains of the host.
+func ParseBrands(annotations map[string]string, domains []string) (map[string]*Brand, error) {
+	value := annotations[BrandsAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed := map[string]*Brand{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", BrandsAnnotation, err)
+	}
+
+	brands := make(map[string]*Brand, len(parsed))
+	for domain, brand := range parsed {
+		if brand == nil {
+			return nil, fmt.Errorf("invalid %s annotation: domain %s has no brand", BrandsAnnotation, domain)
+		}
+		domain = strings.ToLower(domain)
+		if !slices.ContainsFunc(domains, func(d string) bool { return strings.EqualFold(d, domain) }) {
+			return nil, fmt.Errorf("invalid %s annotation: %s is not a domain of the host", BrandsAnnotation, domain)
+		}
+		for name, symbol := range brand.Symbols {
+			if !symbolName.MatchString(name) || symbol == "" || symbolInvalid.MatchString(symbol) {
+				return nil, fmt.Errorf("invalid %s annotation: invalid symbol %s: %q of domain %s", BrandsAnnotation, name, symbol, domain)
+			}
+		}
+		brand.Domain = domain
+		brands[domain] = brand
+	}
+
+	return brands, nil
+}
+
+// SetBrands replaces the brands of the domains of the host. Nil brands serve
+// the brand of the host on every domain.
+func (hh *HostHandler) SetBrands(brands map[string]*Brand) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.brands = brands
+}
+
+// brandFor returns the brand of the domain of the request, nil when it has
+// none.
+func (hh *HostHandler) brandFor(r *http.Request) *Brand {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	return hh.brandForLocked(r)
+}
+
+func (hh *HostHandler) brandForLocked(r *http.Request) *Brand {
+	domain := r.Host
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	return hh.brands[strings.ToLower(domain)]
+}
+
+// withBrand adds the brand to the template data, unless nil.
+func withBrand(extra map[string]any, brand *Brand) map[string]any {
+	if brand != nil {
+		extra["Brand"] = brand
+	}
+	return extra
+}
+
+// brandOf returns the brand name and organization of the template data, those
+// of the host unless overridden by its brand.
+func (hh *HostHandler) brandOf(extra map[string]any) (string, string) {
+	brand, _ := extra["Brand"].(*Brand)
+	if brand == nil {
+		return hh.getBrandName(), hh.getOrganization()
+	}
+	return cmp.Or(brand.BrandName, hh.getBrandName()), cmp.Or(brand.Organization, hh.getOrganization())
+}
+
+// symbolsStyle renders the symbols of the brand as a style overriding those
+// of the theme, empty without symbols.
+func (b *Brand) symbolsStyle() string {
+	if b == nil || len(b.Symbols) == 0 {
+		return ""
+	}
+
+	var style strings.Builder
+	style.WriteString(`<style data-kdex-brand="` + html.EscapeString(b.Domain) + `">:root{`)
+	for _, name := range slices.Sorted(maps.Keys(b.Symbols)) {
+		style.WriteString(name + ":" + b.Symbols[name] + ";")
+	}
+	style.WriteString("}</style>\n")
+	return style.String()
+}
@@ -0,0 +1,89 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseBrands(t *testing.T) {
+	domains := []string{"shop.example.com", "Outlet.example.org"}
+
+	brands, err := ParseBrands(nil, domains)
+	require.NoError(t, err)
+	assert.Nil(t, brands)
+
+	brands, err = ParseBrands(map[string]string{
+		BrandsAnnotation: `{"outlet.example.org":{"brandName":"Outlet","symbols":{"--color-primary":"#c00","--logo":"url(/outlet.svg)"}}}`,
+	}, domains)
+	require.NoError(t, err)
+	require.Contains(t, brands, "outlet.example.org")
+	assert.Equal(t, "Outlet", brands["outlet.example.org"].BrandName)
+	assert.Equal(t, "outlet.example.org", brands["outlet.example.org"].Domain)
+
+	for _, value := range []string{
+		`not json`,
+		`{"outlet.example.org":null}`,
+		`{"other.example.org":{"brandName":"Other"}}`,
+		`{"outlet.example.org":{"symbols":{"color":"red"}}}`,
+		`{"outlet.example.org":{"symbols":{"--color":"red;}</style><script>"}}}`,
+		`{"outlet.example.org":{"symbols":{"--color":""}}}`,
+	} {
+		_, err := ParseBrands(map[string]string{BrandsAnnotation: value}, domains)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHostHandler_Brands(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.Pages.Set(page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><head>[[ .Theme ]]</head><body>[[ .BrandName ]] by [[ .Organization ]][[ with .Extra.Brand ]] on [[ .Domain ]][[ end ]]</body></html>`,
+	})
+
+	brands, err := ParseBrands(map[string]string{
+		BrandsAnnotation: `{"outlet.example.org":{"brandName":"Outlet","symbols":{"--color-primary":"#c00"}}}`,
+	}, []string{"shop.example.com", "outlet.example.org"})
+	require.NoError(t, err)
+	hh.SetBrands(brands)
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang:  "en",
+		BrandName:    "Shop",
+		Organization: "Example Inc.",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	get := func(host string) string {
+		r := httptest.NewRequest("GET", "/home/", nil)
+		r.Host = host
+		rr := httptest.NewRecorder()
+		hh.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	body := get("shop.example.com")
+	assert.Contains(t, body, "Shop by Example Inc.</body>")
+	assert.NotContains(t, body, "data-kdex-brand")
+
+	body = get("Outlet.example.org:8443")
+	assert.Contains(t, body, "Outlet by Example Inc. on outlet.example.org</body>")
+	assert.Contains(t, body, `<style data-kdex-brand="outlet.example.org">:root{--color-primary:#c00;}</style>`)
+
+	// Each brand is cached apart.
+	assert.Contains(t, get("shop.example.com"), "Shop by Example Inc.</body>")
+}
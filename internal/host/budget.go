@@ -0,0 +1,253 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/html"
+)
+
+const (
+	// PerformanceBudgetAnnotation declares, on a page binding, the budgets of
+	// the renders of the page as JSON, e.g.
+	// {"htmlBytes":50000,"blockingScripts":1,"modules":20}.
+	PerformanceBudgetAnnotation = "kdex.dev/performance-budget"
+	// PerformanceBudgetModeAnnotation sets, on a host, what exceeding a budget
+	// does to a page binding.
+	PerformanceBudgetModeAnnotation = "kdex.dev/performance-budget-mode"
+	// PerformanceBudgetWarn reports the exceeded budgets in the status of the
+	// page bindings, which stay ready. It is the default.
+	PerformanceBudgetWarn = "warn"
+	// PerformanceBudgetStrict also keeps pages exceeding a budget from being
+	// published.
+	PerformanceBudgetStrict = "strict"
+
+	BudgetBlockingScripts = "blockingScripts"
+	BudgetHTMLBytes       = "htmlBytes"
+	BudgetModules         = "modules"
+)
+
+// PerformanceBudget are the limits of the renders of a page, unset limits are
+// not checked.
+type PerformanceBudget struct {
+	// BlockingScripts is the number of external scripts which are neither
+	// async, deferred nor modules.
+	BlockingScripts *int `json:"blockingScripts,omitempty"`
+	// HTMLBytes is the size of the rendered document.
+	HTMLBytes *int `json:"htmlBytes,omitempty"`
+	// Modules is the number of modules of the importmap.
+	Modules *int `json:"modules,omitempty"`
+}
+
+// BudgetCheck is the check of the budgets of the render of a page in a
+// language.
+type BudgetCheck struct {
+	Exceeded []string
+	Lang     string
+	Measures map[string]int
+}
+
+// ParsePerformanceBudget returns the budget of the annotations of a page
+// binding, nil when PerformanceBudgetAnnotation is not set.
+func ParsePerformanceBudget(annotations map[string]string) (*PerformanceBudget, error) {
+	value := annotations[PerformanceBudgetAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	budget := &PerformanceBudget{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(budget); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", PerformanceBudgetAnnotation, err)
+	}
+	for name, limit := range budget.limits() {
+		if limit < 0 {
+			return nil, fmt.Errorf("invalid %s annotation: %s must not be negative", PerformanceBudgetAnnotation, name)
+		}
+	}
+	return budget, nil
+}
+
+// ParsePerformanceBudgetMode returns the budget mode of the annotations of a
+// host.
+func ParsePerformanceBudgetMode(annotations map[string]string) (string, error) {
+	switch mode := annotations[PerformanceBudgetModeAnnotation]; mode {
+	case "":
+		return PerformanceBudgetWarn, nil
+	case PerformanceBudgetWarn, PerformanceBudgetStrict:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid %s annotation %q, expected %s or %s", PerformanceBudgetModeAnnotation, mode, PerformanceBudgetWarn, PerformanceBudgetStrict)
+	}
+}
+
+// SetPerformanceBudgetMode sets the budget mode of the host.
+func (hh *HostHandler) SetPerformanceBudgetMode(mode string) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	hh.budgetMode = mode
+}
+
+// PerformanceBudgetMode returns the budget mode of the host.
+func (hh *HostHandler) PerformanceBudgetMode() string {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	if hh.budgetMode == "" {
+		return PerformanceBudgetWarn
+	}
+	return hh.budgetMode
+}
+
+// CheckBudget checks the renders of the page in each language of the host
+// against the budget of the page. It returns nil when the page has no budget
+// or the host is not set yet.
+func (hh *HostHandler) CheckBudget(ph page.PageHandler) ([]BudgetCheck, error) {
+	budget, err := ParsePerformanceBudget(ph.Annotations)
+	if err != nil || budget == nil {
+		return nil, err
+	}
+
+	hh.mu.RLock()
+	ready := hh.host != nil
+	translations := hh.Translations
+	hh.mu.RUnlock()
+
+	if !ready {
+		return nil, nil
+	}
+	return hh.checkBudget(ph, budget, &translations), nil
+}
+
+// checkBudgets checks the pages after the mux is rebuilt, the importmap of
+// the host may have changed.
+func (hh *HostHandler) checkBudgets(pageHandlers []page.PageHandler, translations *Translations) {
+	performanceBudgetGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+	for _, ph := range pageHandlers {
+		if budget, err := ParsePerformanceBudget(ph.Annotations); err == nil && budget != nil {
+			hh.checkBudget(ph, budget, translations)
+		}
+	}
+}
+
+func (hh *HostHandler) checkBudget(ph page.PageHandler, budget *PerformanceBudget, translations *Translations) []BudgetCheck {
+	performanceBudgetGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name, "page": ph.Name})
+
+	checks := []BudgetCheck{}
+	for _, l := range translations.Languages() {
+		rendered, err := hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+		if err != nil {
+			hh.log.Error(err, "failed to render page for performance budget", "page", ph.Name, "language", l)
+			continue
+		}
+		measures, err := measurePage(rendered)
+		if err != nil {
+			hh.log.Error(err, "failed to measure page", "page", ph.Name, "language", l)
+			continue
+		}
+
+		check := BudgetCheck{Exceeded: []string{}, Lang: l.String(), Measures: measures}
+		limits := budget.limits()
+		for _, name := range []string{BudgetBlockingScripts, BudgetHTMLBytes, BudgetModules} {
+			limit, ok := limits[name]
+			if !ok {
+				continue
+			}
+			if measures[name] > limit {
+				check.Exceeded = append(check.Exceeded, fmt.Sprintf("%s %d > %d", name, measures[name], limit))
+			}
+			usage := float64(measures[name])
+			if limit > 0 {
+				usage /= float64(limit)
+			}
+			performanceBudgetGauge.WithLabelValues(hh.Name, ph.Name, l.String(), name).Set(usage)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (b *PerformanceBudget) limits() map[string]int {
+	limits := map[string]int{}
+	if b.BlockingScripts != nil {
+		limits[BudgetBlockingScripts] = *b.BlockingScripts
+	}
+	if b.HTMLBytes != nil {
+		limits[BudgetHTMLBytes] = *b.HTMLBytes
+	}
+	if b.Modules != nil {
+		limits[BudgetModules] = *b.Modules
+	}
+	return limits
+}
+
+// measurePage returns the size, the blocking scripts and the importmap
+// modules of the document.
+func measurePage(document string) (map[string]int, error) {
+	measures := map[string]int{BudgetBlockingScripts: 0, BudgetHTMLBytes: len(document), BudgetModules: 0}
+
+	z := html.NewTokenizer(strings.NewReader(document))
+	importmap := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("failed to tokenize document: %w", err)
+			}
+			return measures, nil
+		case html.StartTagToken:
+			token := z.Token()
+			if token.Data != "script" {
+				continue
+			}
+			attrs := map[string]string{}
+			for _, a := range token.Attr {
+				attrs[a.Key] = a.Val
+			}
+			importmap = attrs["type"] == "importmap"
+			_, async := attrs["async"]
+			_, deferred := attrs["defer"]
+			if attrs["src"] != "" && !async && !deferred && attrs["type"] != "module" {
+				measures[BudgetBlockingScripts]++
+			}
+		case html.TextToken:
+			if !importmap {
+				continue
+			}
+			importmap = false
+			var m struct {
+				Imports map[string]string            `json:"imports"`
+				Scopes  map[string]map[string]string `json:"scopes"`
+			}
+			if err := json.Unmarshal(z.Text(), &m); err != nil {
+				return nil, fmt.Errorf("invalid importmap: %w", err)
+			}
+			measures[BudgetModules] += len(m.Imports)
+			for _, scope := range m.Scopes {
+				measures[BudgetModules] += len(scope)
+			}
+		case html.EndTagToken:
+			importmap = false
+		}
+	}
+}
+
+// BudgetSummary returns the exceeded budgets of the checks, e.g.
+// "en: htmlBytes 61234 > 50000".
+func BudgetSummary(checks []BudgetCheck) string {
+	parts := []string{}
+	for _, check := range checks {
+		if len(check.Exceeded) > 0 {
+			parts = append(parts, check.Lang+": "+strings.Join(check.Exceeded, ", "))
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, "; ")
+}
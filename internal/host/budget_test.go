@@ -0,0 +1,106 @@
+package host
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParsePerformanceBudget(t *testing.T) {
+	budget, err := ParsePerformanceBudget(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, budget)
+
+	budget, err = ParsePerformanceBudget(map[string]string{PerformanceBudgetAnnotation: `{"htmlBytes":50000,"modules":0}`})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{BudgetHTMLBytes: 50000, BudgetModules: 0}, budget.limits())
+
+	for _, value := range []string{`50000`, `{"bytes":50000}`, `{"blockingScripts":-1}`} {
+		_, err = ParsePerformanceBudget(map[string]string{PerformanceBudgetAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParsePerformanceBudgetMode(t *testing.T) {
+	for value, want := range map[string]string{"": PerformanceBudgetWarn, "warn": PerformanceBudgetWarn, "strict": PerformanceBudgetStrict} {
+		mode, err := ParsePerformanceBudgetMode(map[string]string{PerformanceBudgetModeAnnotation: value})
+		require.NoError(t, err)
+		assert.Equal(t, want, mode)
+	}
+
+	_, err := ParsePerformanceBudgetMode(map[string]string{PerformanceBudgetModeAnnotation: "fail"})
+	assert.Error(t, err)
+}
+
+func TestMeasurePage(t *testing.T) {
+	measures, err := measurePage(`<html><head>
+<script type="importmap">{"imports":{"@shop/cart":"/cart.js","@shop/ui":"/ui.js"},"scopes":{"/cart/":{"@shop/ui":"/ui-1.js"}}}</script>
+<script type="module">import "@shop/cart";</script>
+<script src="/legacy.js"></script>
+<script src="/analytics.js" async></script>
+<script src="/widgets.js" defer></script>
+<script type="module" src="/app.js"></script>
+<script>window.inline = true;</script>
+</head><body></body></html>`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, measures[BudgetBlockingScripts])
+	assert.Equal(t, 3, measures[BudgetModules])
+	assert.Positive(t, measures[BudgetHTMLBytes])
+
+	_, err = measurePage(`<script type="importmap">{</script>`)
+	assert.Error(t, err)
+}
+
+func TestHostHandler_CheckBudget(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+
+	ph := page.PageHandler{
+		Annotations: map[string]string{PerformanceBudgetAnnotation: `{"blockingScripts":0,"htmlBytes":100000,"modules":1}`},
+		Name:        "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate:      `<html><head>[[ .HeadScript ]]<script src="/legacy.js"></script></head><body></body></html>`,
+		PackageReferences: []kdexv1alpha1.PackageReference{{Name: "@shop/cart", Version: "1.0.0"}},
+	}
+
+	checks, err := hh.CheckBudget(ph)
+	require.NoError(t, err)
+	assert.Nil(t, checks, "host not set")
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, `{"imports":{"@shop/cart":"/cart.js","@shop/ui":"/ui.js"}}`, nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	checks, err = hh.CheckBudget(ph)
+	require.NoError(t, err)
+	require.Len(t, checks, 1)
+	assert.Equal(t, "en", checks[0].Lang)
+	assert.Equal(t, 1, checks[0].Measures[BudgetBlockingScripts])
+	assert.Equal(t, 2, checks[0].Measures[BudgetModules])
+	assert.Equal(t, []string{"blockingScripts 1 > 0", "modules 2 > 1"}, checks[0].Exceeded)
+	assert.Equal(t, "en: blockingScripts 1 > 0, modules 2 > 1", BudgetSummary(checks))
+
+	ph.Annotations = nil
+	checks, err = hh.CheckBudget(ph)
+	require.NoError(t, err)
+	assert.Nil(t, checks)
+
+	ph.Annotations = map[string]string{PerformanceBudgetAnnotation: `{`}
+	_, err = hh.CheckBudget(ph)
+	assert.Error(t, err)
+
+	assert.Equal(t, PerformanceBudgetWarn, hh.PerformanceBudgetMode())
+	hh.SetPerformanceBudgetMode(PerformanceBudgetStrict)
+	assert.Equal(t, PerformanceBudgetStrict, hh.PerformanceBudgetMode())
+}
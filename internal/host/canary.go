@@ -0,0 +1,95 @@
+package host
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+type canaryKey struct{}
+
+// canaryStats counts the requests the canary image of a function served.
+type canaryStats struct {
+	failures atomic.Int64
+	image    string
+	requests atomic.Int64
+}
+
+func (s *canaryStats) observe(failed bool) {
+	s.requests.Add(1)
+	if failed {
+		s.failures.Add(1)
+	}
+}
+
+// canaryRoute sends the weight percentage of the requests of a function to
+// its canary.
+type canaryRoute struct {
+	stats  *canaryStats
+	target *url.URL
+	weight int
+}
+
+// CanaryStats returns the requests and the failed requests the canary image
+// of the function served.
+func (hh *HostHandler) CanaryStats(name string, image string) (requests int64, failures int64) {
+	v, ok := hh.canaries.Load(name)
+	if !ok || v.(*canaryStats).image != image {
+		return 0, 0
+	}
+	stats := v.(*canaryStats)
+	return stats.requests.Load(), stats.failures.Load()
+}
+
+// canaryRouteFor returns the route to the canary of the function, nil when
+// it has none. Invalid canaries are ignored, the controller reports them.
+func (hh *HostHandler) canaryRouteFor(fn *kdexv1alpha1.KDexFunction) *canaryRoute {
+	image := fn.Status.Attributes[deploy.CanaryImageAttribute]
+	if image == "" {
+		return nil
+	}
+
+	canary, err := deploy.ParseCanary(fn.GetAnnotations())
+	if err != nil || canary == nil {
+		return nil
+	}
+
+	target, err := url.Parse(fn.Status.Attributes[deploy.CanaryURLAttribute])
+	if err != nil || target.Host == "" {
+		hh.log.Info("ignoring invalid canary URL", "function", fn.Name, "url", fn.Status.Attributes[deploy.CanaryURLAttribute])
+		return nil
+	}
+
+	stats := &canaryStats{image: image}
+	if v, loaded := hh.canaries.LoadOrStore(fn.Name, stats); loaded {
+		if existing := v.(*canaryStats); existing.image == image {
+			stats = existing
+		} else {
+			hh.canaries.Store(fn.Name, stats)
+		}
+	}
+
+	return &canaryRoute{
+		stats:  stats,
+		target: target,
+		weight: canary.Weight,
+	}
+}
+
+// pick reports whether the request goes to the canary.
+func (c *canaryRoute) pick() bool {
+	return c != nil && rand.IntN(100) < c.weight
+}
+
+func withCanary(ctx context.Context, route *canaryRoute) context.Context {
+	return context.WithValue(ctx, canaryKey{}, route)
+}
+
+func canaryFrom(ctx context.Context) *canaryRoute {
+	route, _ := ctx.Value(canaryKey{}).(*canaryRoute)
+	return route
+}
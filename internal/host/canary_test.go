@@ -0,0 +1,53 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_canaryRouteFor(t *testing.T) {
+	hh := &HostHandler{log: logr.Discard()}
+
+	fn := &kdexv1alpha1.KDexFunction{}
+	fn.Name = "checkout"
+	fn.Status.Attributes = map[string]string{}
+	assert.Nil(t, hh.canaryRouteFor(fn))
+	assert.False(t, hh.canaryRouteFor(fn).pick())
+
+	fn.Status.Attributes[deploy.CanaryImageAttribute] = "registry/checkout:2"
+	fn.Status.Attributes[deploy.CanaryURLAttribute] = "http://checkout-canary.shop.svc.cluster.local"
+	assert.Nil(t, hh.canaryRouteFor(fn), "no canary policy")
+
+	fn.Annotations = map[string]string{deploy.CanaryWeightAnnotation: "20"}
+	route := hh.canaryRouteFor(fn)
+	require.NotNil(t, route)
+	assert.Equal(t, 20, route.weight)
+	assert.Equal(t, "checkout-canary.shop.svc.cluster.local", route.target.Host)
+
+	route.stats.observe(false)
+	route.stats.observe(true)
+	requests, failures := hh.CanaryStats("checkout", "registry/checkout:2")
+	assert.Equal(t, int64(2), requests)
+	assert.Equal(t, int64(1), failures)
+
+	// The host rebuilds its routes on every change of its functions, the
+	// requests of the canary are kept.
+	hh.canaryRouteFor(fn).stats.observe(false)
+	requests, _ = hh.CanaryStats("checkout", "registry/checkout:2")
+	assert.Equal(t, int64(3), requests)
+
+	fn.Status.Attributes[deploy.CanaryImageAttribute] = "registry/checkout:3"
+	hh.canaryRouteFor(fn)
+	requests, _ = hh.CanaryStats("checkout", "registry/checkout:3")
+	assert.Zero(t, requests)
+	requests, _ = hh.CanaryStats("checkout", "registry/checkout:2")
+	assert.Zero(t, requests)
+
+	fn.Status.Attributes[deploy.CanaryURLAttribute] = "/relative"
+	assert.Nil(t, hh.canaryRouteFor(fn))
+}
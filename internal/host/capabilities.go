@@ -0,0 +1,119 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// Capabilities describes which optional subsystems of the host are enabled,
+// so that the shells of the clients and integration tests adapt to the host
+// instead of probing its endpoints and interpreting their 404s.
+type Capabilities struct {
+	// APIVersions are the versions of the APIs of the host, by API.
+	APIVersions     map[string]string     `json:"apiVersions"`
+	Auth            AuthCapabilities      `json:"auth"`
+	DefaultLanguage string                `json:"defaultLanguage"`
+	Features        map[string]Capability `json:"features"`
+	Host            string                `json:"host"`
+	Languages       []string              `json:"languages"`
+	// Version is the version of the host manager serving the host.
+	Version string `json:"version"`
+}
+
+// AuthCapabilities describes the authentication of the host.
+type AuthCapabilities struct {
+	Enabled bool `json:"enabled"`
+	// MFA is true when the local logins may be completed with a second
+	// factor.
+	MFA bool `json:"mfa"`
+	// Modes are the ways of authenticating with the host: local, oauth2,
+	// oidc, serviceAccounts and trustedIssuers.
+	Modes []string `json:"modes,omitempty"`
+	// OIDCProviders are the names of the OIDC providers offered on the login
+	// page.
+	OIDCProviders []string `json:"oidcProviders,omitempty"`
+	RefreshTokens bool     `json:"refreshTokens"`
+	Revocation    bool     `json:"revocation"`
+}
+
+// Capability describes an optional subsystem of the host.
+type Capability struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"`
+}
+
+// capabilities returns the capabilities of the host.
+func (hh *HostHandler) capabilities() Capabilities {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	capabilities := Capabilities{
+		APIVersions: map[string]string{
+			"crds":    kdexv1alpha1.GroupVersion.String(),
+			"openapi": ko.Version,
+		},
+		DefaultLanguage: hh.defaultLanguage,
+		Features: map[string]Capability{
+			"a11y":            {Enabled: hh.a11yMode != "", Mode: hh.a11yMode},
+			"federation":      {Enabled: hh.federation != nil},
+			"graphql":         {Enabled: hh.GraphQL},
+			"integrity":       {Enabled: hh.integrityMode != "", Mode: hh.integrityMode},
+			"linkCheck":       {Enabled: hh.linkCheckInterval > 0},
+			"mockFunctions":   {Enabled: hh.MockFunctions},
+			"personalization": {Enabled: hh.personalization != nil},
+			"sniffer":         {Enabled: hh.sniffer != nil},
+			"slos":            {Enabled: hh.slos != nil},
+			"themeExperiment": {Enabled: hh.themeExperiment != nil && !hh.themeExperiment.Disabled},
+		},
+		Host:      hh.Name,
+		Languages: []string{},
+		Version:   supportVersions().Version,
+	}
+
+	for _, tag := range hh.Translations.Languages() {
+		capabilities.Languages = append(capabilities.Languages, tag.String())
+	}
+
+	if hh.authConfig.IsAuthEnabled() {
+		capabilities.Auth = AuthCapabilities{
+			Enabled:       true,
+			MFA:           hh.authExchanger.IsMFAEnabled(),
+			Modes:         []string{"local"},
+			RefreshTokens: hh.authExchanger.IsRefreshTokenEnabled(),
+			Revocation:    hh.authConfig.Revocations != nil,
+		}
+		if hh.authConfig.IsM2MEnabled() {
+			capabilities.Auth.Modes = append(capabilities.Auth.Modes, "oauth2")
+		}
+		if hh.authConfig.IsOIDCEnabled() {
+			capabilities.Auth.Modes = append(capabilities.Auth.Modes, "oidc")
+			for _, provider := range hh.authConfig.OIDCProviders() {
+				capabilities.Auth.OIDCProviders = append(capabilities.Auth.OIDCProviders, provider.Name)
+			}
+		}
+		if hh.authConfig.ServiceAccounts != nil {
+			capabilities.Auth.Modes = append(capabilities.Auth.Modes, "serviceAccounts")
+		}
+		if hh.authConfig.TrustedIssuers != nil {
+			capabilities.Auth.Modes = append(capabilities.Auth.Modes, "trustedIssuers")
+		}
+	}
+
+	return capabilities
+}
+
+// CapabilitiesGet serves the capabilities of the host.
+func (hh *HostHandler) CapabilitiesGet(w http.ResponseWriter, r *http.Request) {
+	if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hh.capabilities()); err != nil {
+		hh.log.Error(err, "failed to encode capabilities")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
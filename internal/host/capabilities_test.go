@@ -0,0 +1,71 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_capabilities(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/-/capabilities", nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) Capabilities {
+		require.Equal(t, http.StatusOK, w.Code)
+		capabilities := Capabilities{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&capabilities))
+		return capabilities
+	}
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	capabilities := decode(get(nil))
+	assert.Equal(t, "shop", capabilities.Host)
+	assert.Equal(t, "en", capabilities.DefaultLanguage)
+	assert.Equal(t, []string{"en"}, capabilities.Languages)
+	assert.Equal(t, map[string]string{"crds": "kdex.dev/v1alpha1", "openapi": "3.0.0"}, capabilities.APIVersions)
+	assert.Equal(t, AuthCapabilities{}, capabilities.Auth)
+	assert.Equal(t, Capability{}, capabilities.Features["graphql"])
+	assert.Contains(t, capabilities.Features, "sniffer")
+
+	hh.GraphQL = true
+	hh.SetIntegrity(IntegrityRecord)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{
+		ActivePair: keys.GenerateECDSAKeyPair().ActiveKey(),
+		Clients:    map[string]auth.AuthClient{"m2m": {ClientID: "m2m"}},
+	}, "http")
+
+	w := get(nil)
+	etag := w.Header().Get("ETag")
+	capabilities = decode(w)
+	assert.Equal(t, AuthCapabilities{Enabled: true, Modes: []string{"local", "oauth2"}}, capabilities.Auth)
+	assert.Equal(t, Capability{Enabled: true}, capabilities.Features["graphql"])
+	assert.Equal(t, Capability{Enabled: true, Mode: IntegrityRecord}, capabilities.Features["integrity"])
+
+	assert.Equal(t, http.StatusNotModified, get(http.Header{"If-None-Match": {etag}}).Code)
+}
@@ -0,0 +1,347 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	kdexhttp "github.com/kdex-tech/host-manager/internal/http"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// ConsoleUtilityPageType is the utility page rendering the test console of
+	// a function. It is not part of the KDexUtilityPageType enum of the CRD, a
+	// utility page is made the console with UtilityPageTypeAnnotation.
+	ConsoleUtilityPageType kdexv1alpha1.KDexUtilityPageType = "Console"
+	// UtilityPageTypeAnnotation overrides, on a utility page, the type of its
+	// spec with one of the types the CRD does not know of.
+	UtilityPageTypeAnnotation = "kdex.dev/utility-page-type"
+)
+
+// ParseUtilityPageType returns the type of a utility page, the one of
+// UtilityPageTypeAnnotation when set.
+func ParseUtilityPageType(annotations map[string]string, specType kdexv1alpha1.KDexUtilityPageType) (kdexv1alpha1.KDexUtilityPageType, error) {
+	switch t := kdexv1alpha1.KDexUtilityPageType(annotations[UtilityPageTypeAnnotation]); t {
+	case "":
+		return specType, nil
+	case ConsoleUtilityPageType, MFAUtilityPageType:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid %s annotation %q, expected %s or %s", UtilityPageTypeAnnotation, t, ConsoleUtilityPageType, MFAUtilityPageType)
+	}
+}
+
+// Console is the template data of the console utility page, available as
+// .Extra.Console.
+type Console struct {
+	Name       string
+	Operations []ConsoleOperation
+	State      string
+	// Target prefixes the paths of the operations. Requests to ready
+	// functions go through the contract validating proxy, the others are
+	// answered by the mocks of the function.
+	Target string
+}
+
+// ConsoleOperation is an operation of the function with a form to try it.
+type ConsoleOperation struct {
+	Body        string
+	ContentType string
+	Description string
+	ID          string
+	Method      string
+	Parameters  []ConsoleParameter
+	Path        string
+	Summary     string
+}
+
+// ConsoleParameter is a field of the form of an operation.
+type ConsoleParameter struct {
+	Description string
+	Example     string
+	In          string
+	Name        string
+	Required    bool
+	Type        string
+}
+
+// ConsoleGet renders the console utility page of the function.
+func (hh *HostHandler) ConsoleGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("function")
+
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	var fn *kdexv1alpha1.KDexFunction
+	for i := range hh.functions {
+		if hh.functions[i].Name == name && len(hh.functions[i].Spec.API.Paths) > 0 {
+			fn = hh.functions[i].DeepCopy()
+			break
+		}
+	}
+	if fn == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	l, err := kdexhttp.GetLang(r, hh.defaultLanguage, hh.Translations.Languages())
+	if err != nil {
+		l = language.Make(hh.defaultLanguage)
+	}
+
+	console, err := consoleOf(fn)
+	if err != nil {
+		hh.log.Error(err, "invalid function contract", "function", fn.Name)
+		http.Error(w, "function contract is invalid", http.StatusInternalServerError)
+		return
+	}
+
+	rendered := hh.renderUtilityPage(
+		ConsoleUtilityPageType,
+		l,
+		withBrand(map[string]any{"Console": console}, hh.brandForLocked(r)),
+		&hh.Translations,
+	)
+
+	if rendered == "" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Language", l.String())
+	w.Header().Set("Content-Type", "text/html")
+	_, _ = w.Write([]byte(rendered))
+}
+
+// utilityPage returns the utility page of the type. Hosts in dev mode fall
+// back to the built in console, and every host to the built in MFA page.
+func (hh *HostHandler) utilityPage(utilityType kdexv1alpha1.KDexUtilityPageType) (page.PageHandler, bool) {
+	if ph, ok := hh.utilityPages[utilityType]; ok {
+		return ph, true
+	}
+	if utilityType == ConsoleUtilityPageType && hh.host != nil && hh.host.DevMode {
+		return defaultConsolePage, true
+	}
+	if utilityType == MFAUtilityPageType {
+		return defaultMFAPage, true
+	}
+	return page.PageHandler{}, false
+}
+
+// consoleOf builds the console of the operations of the function from its
+// spec.
+func consoleOf(fn *kdexv1alpha1.KDexFunction) (Console, error) {
+	console := Console{Name: fn.Name, Operations: []ConsoleOperation{}, State: string(fn.Status.State)}
+	if fn.Status.State == kdexv1alpha1.KDexFunctionStateReady {
+		console.Target = "/-/fn/" + fn.Name
+	}
+
+	builder := ko.Builder{TypesToInclude: []ko.PathType{ko.FunctionPathType}}
+	doc := builder.BuildOneOff("", fn)
+	if err := openapi.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return Console{}, err
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(doc.Paths.Map())) {
+		item := doc.Paths.Value(path)
+		for _, method := range []string{
+			http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		} {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+			console.Operations = append(console.Operations, consoleOperation(method, path, item.Parameters, op))
+		}
+	}
+	return console, nil
+}
+
+func consoleOperation(method string, path string, shared openapi.Parameters, op *openapi.Operation) ConsoleOperation {
+	id := op.OperationID
+	if id == "" {
+		id = method + path
+	}
+	operation := ConsoleOperation{
+		Description: op.Description,
+		ID:          "op-" + strings.Trim(consoleIDReplacer.Replace(strings.ToLower(id)), "-"),
+		Method:      method,
+		Parameters:  []ConsoleParameter{},
+		Path:        path,
+		Summary:     op.Summary,
+	}
+
+	// Operation parameters override the ones of the path.
+	parameters := map[string]*openapi.Parameter{}
+	keys := []string{}
+	for _, refs := range []openapi.Parameters{shared, op.Parameters} {
+		for _, ref := range refs {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			key := ref.Value.In + ":" + ref.Value.Name
+			if _, ok := parameters[key]; !ok {
+				keys = append(keys, key)
+			}
+			parameters[key] = ref.Value
+		}
+	}
+	for _, key := range keys {
+		p := parameters[key]
+		if p.In == openapi.ParameterInCookie {
+			continue
+		}
+		operation.Parameters = append(operation.Parameters, ConsoleParameter{
+			Description: p.Description,
+			Example:     parameterExample(p),
+			In:          p.In,
+			Name:        p.Name,
+			Required:    p.Required,
+			Type:        parameterType(p),
+		})
+	}
+
+	if op.RequestBody == nil || op.RequestBody.Value == nil || len(op.RequestBody.Value.Content) == 0 {
+		return operation
+	}
+	content := op.RequestBody.Value.Content
+	operation.ContentType = "application/json"
+	if content.Get(operation.ContentType) == nil {
+		operation.ContentType = slices.Sorted(maps.Keys(content))[0]
+	}
+	value := mockValue(content.Get(operation.ContentType))
+	if s, ok := value.(string); ok && !strings.Contains(operation.ContentType, "json") {
+		operation.Body = s
+	} else if body, err := json.MarshalIndent(value, "", "  "); err == nil {
+		operation.Body = string(body)
+	}
+	return operation
+}
+
+var consoleIDReplacer = strings.NewReplacer("/", "-", "{", "", "}", "", ".", "", "_", "-", " ", "-")
+
+func parameterExample(p *openapi.Parameter) string {
+	example := p.Example
+	if example == nil && p.Schema != nil && p.Schema.Value != nil {
+		example = p.Schema.Value.Example
+		if example == nil {
+			example = p.Schema.Value.Default
+		}
+	}
+	if example == nil {
+		return ""
+	}
+	return fmt.Sprint(example)
+}
+
+func parameterType(p *openapi.Parameter) string {
+	if p.Schema == nil || p.Schema.Value == nil || p.Schema.Value.Type == nil || len(p.Schema.Value.Type.Slice()) == 0 {
+		return openapi.TypeString
+	}
+	return p.Schema.Value.Type.Slice()[0]
+}
+
+var defaultConsolePage = page.PageHandler{
+	MainTemplate: consoleTemplate,
+	Name:         "kdex-console",
+	UtilityPage:  &kdexv1alpha1.KDexUtilityPageSpec{Type: ConsoleUtilityPageType},
+}
+
+const consoleTemplate = `<!DOCTYPE html>
+<html lang="[[ .Language ]]">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>[[ .Extra.Console.Name ]] - [[ .BrandName ]]</title>
+[[ .Meta ]]
+[[ .Theme ]]
+[[ .HeadScript ]]
+<style>
+.kdex-console { font-family: system-ui, sans-serif; margin: 0 auto; max-width: 60rem; padding: 1rem; }
+.kdex-console section { border-top: 1px solid #ccc; padding: 1rem 0; }
+.kdex-console label { display: block; font-weight: 600; margin-top: .5rem; }
+.kdex-console input, .kdex-console textarea { box-sizing: border-box; font-family: monospace; width: 100%; }
+.kdex-console button { margin-top: .75rem; }
+.kdex-console pre { background: #f5f5f5; overflow: auto; padding: .5rem; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<main class="kdex-console">
+<h1>[[ .Extra.Console.Name ]]</h1>
+<p>[[ .Extra.Console.State ]]</p>
+[[ range $op := .Extra.Console.Operations ]]
+<section aria-labelledby="[[ $op.ID ]]">
+<h2 id="[[ $op.ID ]]"><code>[[ $op.Method ]] [[ $op.Path ]]</code></h2>
+[[ with $op.Summary ]]<p>[[ . ]]</p>[[ end ]]
+[[ with $op.Description ]]<p>[[ . ]]</p>[[ end ]]
+<form data-method="[[ $op.Method ]]" data-path="[[ $op.Path ]]" data-target="[[ $.Extra.Console.Target ]]" data-content-type="[[ $op.ContentType ]]">
+[[ range $op.Parameters ]]
+<label for="[[ $op.ID ]]-[[ .In ]]-[[ .Name ]]">[[ .Name ]] <small>[[ .In ]], [[ .Type ]][[ if .Required ]], required[[ end ]]</small></label>
+<input id="[[ $op.ID ]]-[[ .In ]]-[[ .Name ]]" name="[[ .Name ]]" data-in="[[ .In ]]" value="[[ .Example ]]"[[ with .Description ]] title="[[ . ]]"[[ end ]][[ if .Required ]] required[[ end ]]>
+[[ end ]]
+[[ if $op.ContentType ]]
+<label for="[[ $op.ID ]]-body">body <small>[[ $op.ContentType ]]</small></label>
+<textarea id="[[ $op.ID ]]-body" name="body" rows="8">[[ $op.Body ]]</textarea>
+[[ end ]]
+<button type="submit">Send</button>
+</form>
+<pre class="kdex-console-response" aria-live="polite"></pre>
+</section>
+[[ end ]]
+</main>
+<script>
+document.querySelectorAll('.kdex-console form').forEach(function (form) {
+  form.addEventListener('submit', async function (event) {
+    event.preventDefault();
+    var path = form.dataset.path;
+    var query = new URLSearchParams();
+    var headers = {};
+    form.querySelectorAll('[data-in]').forEach(function (input) {
+      if (input.value === '') return;
+      switch (input.dataset.in) {
+        case 'path':
+          path = path.replace('{' + input.name + '...}', input.value).replace('{' + input.name + '}', encodeURIComponent(input.value));
+          break;
+        case 'query':
+          query.append(input.name, input.value);
+          break;
+        case 'header':
+          headers[input.name] = input.value;
+          break;
+      }
+    });
+    var init = { method: form.dataset.method, headers: headers };
+    if (form.elements.body) {
+      headers['Content-Type'] = form.dataset.contentType;
+      init.body = form.elements.body.value;
+    }
+    var output = form.nextElementSibling;
+    output.textContent = '...';
+    try {
+      var search = query.toString();
+      var response = await fetch(form.dataset.target + path + (search ? '?' + search : ''), init);
+      var text = await response.text();
+      try { text = JSON.stringify(JSON.parse(text), null, 2); } catch (e) {}
+      var lines = [response.status + ' ' + response.statusText];
+      response.headers.forEach(function (value, key) { lines.push(key + ': ' + value); });
+      output.textContent = lines.join('\n') + '\n\n' + text;
+    } catch (e) {
+      output.textContent = String(e);
+    }
+  });
+});
+</script>
+[[ .FootScript ]]
+</body>
+</html>
+`
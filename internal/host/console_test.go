@@ -0,0 +1,145 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func consoleFunction() kdexv1alpha1.KDexFunction {
+	item := openapi.NewObjectSchema().
+		WithProperty("id", openapi.NewStringSchema()).
+		WithRequired([]string{"id"})
+
+	api := ko.OpenAPI{
+		BasePath: "/api/items",
+		Paths: map[string]ko.PathItem{
+			"/api/items/{id}": {
+				Get: &openapi.Operation{
+					OperationID: "get-item",
+					Parameters: openapi.Parameters{
+						ko.PathParam("id", "The id of the item"),
+						{Value: openapi.NewQueryParameter("limit").WithSchema(openapi.NewIntegerSchema().WithDefault(10))},
+					},
+					Summary: "Get an item",
+				},
+			},
+			"/api/items": {
+				Post: &openapi.Operation{
+					RequestBody: &openapi.RequestBodyRef{
+						Value: openapi.NewRequestBody().WithRequired(true).WithJSONSchema(item),
+					},
+				},
+			},
+		},
+	}
+
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "items"
+	fn.Spec.API = *api.ToKDexAPI()
+	fn.Status.State = kdexv1alpha1.KDexFunctionStateReady
+	return fn
+}
+
+func TestParseUtilityPageType(t *testing.T) {
+	pageType, err := ParseUtilityPageType(nil, kdexv1alpha1.ErrorUtilityPageType)
+	require.NoError(t, err)
+	assert.Equal(t, kdexv1alpha1.ErrorUtilityPageType, pageType)
+
+	pageType, err = ParseUtilityPageType(map[string]string{UtilityPageTypeAnnotation: "Console"}, kdexv1alpha1.ErrorUtilityPageType)
+	require.NoError(t, err)
+	assert.Equal(t, ConsoleUtilityPageType, pageType)
+
+	_, err = ParseUtilityPageType(map[string]string{UtilityPageTypeAnnotation: "Dashboard"}, kdexv1alpha1.ErrorUtilityPageType)
+	assert.Error(t, err)
+}
+
+func TestConsoleOf(t *testing.T) {
+	fn := consoleFunction()
+
+	console, err := consoleOf(&fn)
+	require.NoError(t, err)
+	assert.Equal(t, "items", console.Name)
+	assert.Equal(t, "/-/fn/items", console.Target)
+	require.Len(t, console.Operations, 2)
+
+	create := console.Operations[0]
+	assert.Equal(t, http.MethodPost, create.Method)
+	assert.Equal(t, "/api/items", create.Path)
+	assert.Equal(t, "op-post-api-items", create.ID)
+	assert.Equal(t, "application/json", create.ContentType)
+	assert.JSONEq(t, `{"id":"string"}`, create.Body)
+
+	get := console.Operations[1]
+	assert.Equal(t, "op-get-item", get.ID)
+	assert.Equal(t, "Get an item", get.Summary)
+	assert.Empty(t, get.ContentType)
+	assert.Equal(t, []ConsoleParameter{
+		{Description: "The id of the item", In: "path", Name: "id", Required: true, Type: "string"},
+		{Example: "10", In: "query", Name: "limit", Type: "integer"},
+	}, get.Parameters)
+
+	fn.Status.State = kdexv1alpha1.KDexFunctionStateSourceAvailable
+	console, err = consoleOf(&fn)
+	require.NoError(t, err)
+	assert.Empty(t, console.Target)
+}
+
+func TestHostHandler_ConsoleGet(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{DefaultLang: "en", BrandName: "Shop"}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+	hh.functions = []kdexv1alpha1.KDexFunction{consoleFunction()}
+
+	registeredPaths := map[string]ko.PathInfo{}
+	hh.consoleHandler(http.NewServeMux(), registeredPaths)
+	assert.Empty(t, registeredPaths, "no console page outside of dev mode")
+
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/-/console/items", nil)
+		r.SetPathValue("function", "items")
+		w := httptest.NewRecorder()
+		hh.ConsoleGet(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, get().Code)
+
+	hh.host.DevMode = true
+	hh.consoleHandler(http.NewServeMux(), registeredPaths)
+	assert.Contains(t, registeredPaths, "/-/console/{function}")
+
+	w := get()
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<title>items - Shop</title>`)
+	assert.Contains(t, body, `data-target="/-/fn/items"`)
+	assert.Contains(t, body, `<label for="op-get-item-path-id">`)
+	assert.Contains(t, body, `<textarea id="op-post-api-items-body" name="body" rows="8">`)
+
+	hh.host.DevMode = false
+	hh.AddOrUpdateUtilityPage(page.PageHandler{
+		MainTemplate: `<html><body>[[ range .Extra.Console.Operations ]][[ .Method ]] [[ .Path ]];[[ end ]]</body></html>`,
+		Name:         "console",
+		UtilityPage:  &kdexv1alpha1.KDexUtilityPageSpec{Type: ConsoleUtilityPageType},
+	})
+	w = get()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html><body>POST /api/items;GET /api/items/{id};</body></html>", w.Body.String())
+
+	r := httptest.NewRequest(http.MethodGet, "/-/console/missing", nil)
+	r.SetPathValue("function", "missing")
+	w = httptest.NewRecorder()
+	hh.ConsoleGet(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,224 @@
+package host
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const maxContractBodyBytes = 10 << 20
+
+// ContractViolation is the body of the errors returned by the contract
+// validating proxy.
+type ContractViolation struct {
+	Error      string   `json:"error"`
+	Function   string   `json:"function"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+type contractRouter struct {
+	generation int64
+	router     routers.Router
+}
+
+// ContractHandler proxies /-/fn/{function}/{path...} to the function at
+// /{path...}, validating the request and the response against the OpenAPI
+// spec of the function. Invalid requests are rejected with a 400 before they
+// reach the function and invalid responses are replaced by a 502.
+func (hh *HostHandler) ContractHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("function")
+
+	hh.mu.RLock()
+	var fn *kdexv1alpha1.KDexFunction
+	for i := range hh.functions {
+		if hh.functions[i].Name == name && hh.functions[i].Status.State == kdexv1alpha1.KDexFunctionStateReady {
+			fn = hh.functions[i].DeepCopy()
+			break
+		}
+	}
+	mux := hh.Mux
+	hh.mu.RUnlock()
+
+	if fn == nil || mux == nil {
+		writeContractViolation(w, http.StatusNotFound, ContractViolation{Error: "function not found", Function: name})
+		return
+	}
+
+	router, err := hh.contractRouter(fn)
+	if err != nil {
+		hh.log.Error(err, "invalid function contract", "function", fn.Name)
+		writeContractViolation(w, http.StatusInternalServerError, ContractViolation{
+			Error:      "function contract is invalid",
+			Function:   fn.Name,
+			Violations: violations(err),
+		})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxContractBodyBytes))
+	if err != nil {
+		writeContractViolation(w, http.StatusBadRequest, ContractViolation{
+			Error:      "request body could not be read",
+			Function:   fn.Name,
+			Violations: []string{err.Error()},
+		})
+		return
+	}
+
+	target, err := url.Parse("/" + r.PathValue("path"))
+	if err != nil {
+		writeContractViolation(w, http.StatusBadRequest, ContractViolation{Error: "invalid path", Function: fn.Name})
+		return
+	}
+	target.RawQuery = r.URL.RawQuery
+
+	sub := r.Clone(r.Context())
+	sub.URL = target
+	sub.RequestURI = target.RequestURI()
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+	sub.ContentLength = int64(len(body))
+	// The response is validated so it must not be compressed.
+	sub.Header.Del("Accept-Encoding")
+
+	// Spec paths have no trailing slash.
+	lookup := *sub
+	lookup.URL = &url.URL{Path: strings.TrimSuffix(target.Path, "/"), RawQuery: target.RawQuery}
+	if lookup.URL.Path == "" {
+		lookup.URL.Path = "/"
+	}
+
+	route, pathParams, err := router.FindRoute(&lookup)
+	if err != nil {
+		status := http.StatusNotFound
+		if pathDeclared(router, &lookup) {
+			status = http.StatusMethodNotAllowed
+		}
+		writeContractViolation(w, status, ContractViolation{
+			Error:      "no operation of the function matches the request",
+			Function:   fn.Name,
+			Violations: []string{err.Error()},
+		})
+		return
+	}
+
+	options := &openapi3filter.Options{
+		// The host authenticates and authorizes the call when proxying it.
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+	requestInput := &openapi3filter.RequestValidationInput{
+		Options:    options,
+		PathParams: pathParams,
+		Request:    &lookup,
+		Route:      route,
+	}
+	if err := openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+		writeContractViolation(w, http.StatusBadRequest, ContractViolation{
+			Error:      "request violates the function contract",
+			Function:   fn.Name,
+			Violations: violations(err),
+		})
+		return
+	}
+
+	// Validation consumed the body.
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+
+	rw := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+	mux.ServeHTTP(rw, sub)
+
+	if err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+		Body:                   io.NopCloser(bytes.NewReader(rw.body.Bytes())),
+		Header:                 rw.header,
+		Options:                options,
+		RequestValidationInput: requestInput,
+		Status:                 rw.status,
+	}); err != nil {
+		hh.log.V(1).Info("function response violates its contract", "function", fn.Name, "path", target.Path, "err", err)
+		writeContractViolation(w, http.StatusBadGateway, ContractViolation{
+			Error:      "response violates the function contract",
+			Function:   fn.Name,
+			Violations: violations(err),
+		})
+		return
+	}
+
+	maps.Copy(w.Header(), rw.header)
+	w.WriteHeader(rw.status)
+	_, _ = w.Write(rw.body.Bytes())
+}
+
+// contractRouter returns the router of the function's spec, building it
+// again only when the function changed.
+func (hh *HostHandler) contractRouter(fn *kdexv1alpha1.KDexFunction) (routers.Router, error) {
+	if cached, ok := hh.contractRouters.Load(fn.Name); ok && cached.(*contractRouter).generation == fn.Generation {
+		return cached.(*contractRouter).router, nil
+	}
+
+	builder := ko.Builder{TypesToInclude: []ko.PathType{ko.FunctionPathType}}
+	doc := builder.BuildOneOff("", fn)
+	// Route on the path alone, the request already reached the host.
+	doc.Servers = nil
+
+	if err := openapi.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, err
+	}
+
+	router, err := legacy.NewRouter(doc, openapi.DisableExamplesValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	hh.contractRouters.Store(fn.Name, &contractRouter{generation: fn.Generation, router: router})
+	return router, nil
+}
+
+// pathDeclared reports whether any operation of the spec is declared at the
+// path of the request, whatever its method.
+func pathDeclared(router routers.Router, r *http.Request) bool {
+	for _, method := range []string{
+		http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace,
+	} {
+		probe := *r
+		probe.Method = method
+		if _, _, err := router.FindRoute(&probe); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func violations(err error) []string {
+	var multi openapi.MultiError
+	if !errors.As(err, &multi) {
+		return []string{err.Error()}
+	}
+
+	out := []string{}
+	for _, e := range multi {
+		out = append(out, violations(e)...)
+	}
+	return out
+}
+
+func writeContractViolation(w http.ResponseWriter, status int, violation ContractViolation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(violation); err != nil {
+		_, _ = fmt.Fprintln(w, violation.Error)
+	}
+}
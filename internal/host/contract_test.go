@@ -0,0 +1,170 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_ContractHandler(t *testing.T) {
+	item := openapi.NewObjectSchema().
+		WithProperty("id", openapi.NewStringSchema()).
+		WithRequired([]string{"id"})
+
+	api := ko.OpenAPI{
+		BasePath: "/api/items",
+		Paths: map[string]ko.PathItem{
+			"/api/items/{id}": {
+				Get: &openapi.Operation{
+					OperationID: "get-item",
+					Parameters: openapi.Parameters{
+						ko.PathParam("id", ""),
+						{Value: openapi.NewQueryParameter("limit").WithSchema(openapi.NewIntegerSchema())},
+					},
+					Responses: openapi.NewResponses(openapi.WithStatus(200, &openapi.ResponseRef{
+						Value: openapi.NewResponse().WithDescription("item").WithJSONSchema(item),
+					})),
+				},
+			},
+			"/api/items": {
+				Post: &openapi.Operation{
+					OperationID: "create-item",
+					RequestBody: &openapi.RequestBodyRef{
+						Value: openapi.NewRequestBody().WithRequired(true).WithJSONSchema(item),
+					},
+					Responses: openapi.NewResponses(openapi.WithStatus(201, &openapi.ResponseRef{
+						Value: openapi.NewResponse().WithDescription("created").WithJSONSchema(item),
+					})),
+				},
+			},
+		},
+	}
+
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "items"
+	fn.Generation = 1
+	fn.Spec.API = *api.ToKDexAPI()
+	fn.Status.State = kdexv1alpha1.KDexFunctionStateReady
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/items/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/items/broken" {
+			_, _ = w.Write([]byte(`{"name":"no id"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"` + r.URL.Path[len("/api/items/"):] + `"}`))
+	})
+	mux.HandleFunc("POST /api/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"new"}`))
+	})
+
+	hh := &HostHandler{Mux: mux, functions: []kdexv1alpha1.KDexFunction{fn}, log: logr.Discard()}
+	outer := http.NewServeMux()
+	outer.HandleFunc("/-/fn/{function}/{path...}", hh.ContractHandler)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantError  string
+	}{
+		{
+			name:       "valid",
+			method:     http.MethodGet,
+			target:     "/-/fn/items/api/items/a?limit=5",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"a"}`,
+		},
+		{
+			name:       "valid body",
+			method:     http.MethodPost,
+			target:     "/-/fn/items/api/items",
+			body:       `{"id":"x"}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":"new"}`,
+		},
+		{
+			name:       "invalid query",
+			method:     http.MethodGet,
+			target:     "/-/fn/items/api/items/a?limit=five",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "request violates the function contract",
+		},
+		{
+			name:       "invalid body",
+			method:     http.MethodPost,
+			target:     "/-/fn/items/api/items",
+			body:       `{"name":"x"}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "request violates the function contract",
+		},
+		{
+			name:       "invalid response",
+			method:     http.MethodGet,
+			target:     "/-/fn/items/api/items/broken",
+			wantStatus: http.StatusBadGateway,
+			wantError:  "response violates the function contract",
+		},
+		{
+			name:       "undeclared method",
+			method:     http.MethodDelete,
+			target:     "/-/fn/items/api/items/a",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantError:  "no operation of the function matches the request",
+		},
+		{
+			name:       "undeclared path",
+			method:     http.MethodGet,
+			target:     "/-/fn/items/other",
+			wantStatus: http.StatusNotFound,
+			wantError:  "no operation of the function matches the request",
+		},
+		{
+			name:       "unknown function",
+			method:     http.MethodGet,
+			target:     "/-/fn/missing/api/items/a",
+			wantStatus: http.StatusNotFound,
+			wantError:  "function not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+
+			outer.ServeHTTP(w, r)
+
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+				return
+			}
+
+			var violation ContractViolation
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &violation))
+			assert.Equal(t, tt.wantError, violation.Error)
+			if tt.wantStatus == http.StatusBadRequest || tt.wantStatus == http.StatusBadGateway {
+				assert.NotEmpty(t, violation.Violations)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"golang.org/x/text/language"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// DataLoadersAnnotation declares, on a page binding, the JSON encoded map
+	// of the DataLoader of the page by name, e.g.
+	// {"orders": {"function": "orders", "operation": "list-orders", "params": {"limit": 5}, "ttl": "1m", "fallback": []}}.
+	// The results are exposed to the templates of the page as .Extra.Data.<name>.
+	DataLoadersAnnotation = "kdex.dev/data-loaders"
+
+	dataLoaderCacheClass     = "dataloader"
+	defaultDataLoaderTimeout = 5 * time.Second
+	maxDataLoaderTTL         = time.Hour
+)
+
+// dataLoaderMethods are the methods of the operations a loader may call.
+var dataLoaderMethods = []string{
+	http.MethodDelete,
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodPost,
+	http.MethodPut,
+}
+
+// DataLoader declares data of a page loaded from an operation of a function
+// when the page is rendered.
+type DataLoader struct {
+	// Fallback is the data of the loader when the operation fails and no
+	// previous result is cached, null when unset.
+	Fallback json.RawMessage `json:"fallback,omitempty"`
+	// Function is the name of the function.
+	Function string `json:"function"`
+	// Operation is the operationId of the operation of the function.
+	Operation string `json:"operation"`
+	// Params fill the path parameters of the operation, the others are sent
+	// in the query of GET, HEAD and DELETE operations and as the JSON body of
+	// the others.
+	Params map[string]any `json:"params,omitempty"`
+	// Timeout bounds the call of the operation, 5s when unset.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// TTL is how long the result is reused, it is not cached when unset. It
+	// is capped at 1h.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// ParseDataLoaders returns the loaders of DataLoadersAnnotation by name, nil
+// when it is not set.
+func ParseDataLoaders(annotations map[string]string) (map[string]DataLoader, error) {
+	value := annotations[DataLoadersAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	loaders := map[string]DataLoader{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&loaders); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", DataLoadersAnnotation, err)
+	}
+
+	for name, loader := range loaders {
+		if name == "" {
+			return nil, fmt.Errorf("invalid %s annotation: loaders require a name", DataLoadersAnnotation)
+		}
+		if loader.Function == "" || loader.Operation == "" {
+			return nil, fmt.Errorf("invalid %s annotation: loader %s requires a function and an operation", DataLoadersAnnotation, name)
+		}
+		if loader.Timeout != nil && loader.Timeout.Duration <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation: timeout of loader %s must be positive", DataLoadersAnnotation, name)
+		}
+		if loader.TTL != nil && loader.TTL.Duration < 0 {
+			return nil, fmt.Errorf("invalid %s annotation: ttl of loader %s must not be negative", DataLoadersAnnotation, name)
+		}
+	}
+
+	return loaders, nil
+}
+
+// dataLoaderEntry is a result of a loader in the cache.
+type dataLoaderEntry struct {
+	Data    json.RawMessage `json:"data"`
+	Expires time.Time       `json:"expires"`
+}
+
+// loadData runs the loaders of the page concurrently and returns their
+// results by name. The operations are called through the host mux, like the
+// requests of the visitors, but with the identity of the host rather than the
+// visitor's, so that the results can be shared by the visitors. A loader
+// which fails is given its last cached result, even expired, or else its
+// fallback.
+func (hh *HostHandler) loadData(
+	ctx context.Context,
+	pageName string,
+	loaders map[string]DataLoader,
+	l language.Tag,
+) map[string]any {
+	data := make(map[string]any, len(loaders))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, loader := range loaders {
+		wg.Go(func() {
+			result := hh.runDataLoader(ctx, pageName, name, loader, l)
+
+			mu.Lock()
+			defer mu.Unlock()
+			data[name] = result
+		})
+	}
+
+	wg.Wait()
+	return data
+}
+
+func (hh *HostHandler) runDataLoader(
+	ctx context.Context,
+	pageName string,
+	name string,
+	loader DataLoader,
+	l language.Tag,
+) any {
+	dataCache := hh.cacheManager.GetCache(dataLoaderCacheClass, cache.CacheOptions{TTL: new(maxDataLoaderTTL)})
+	cacheKey := fmt.Sprintf("%s:%s:%s", pageName, name, l.String())
+
+	var cached *dataLoaderEntry
+	if value, ok, isCurrent, err := dataCache.Get(ctx, cacheKey); err != nil {
+		hh.log.Error(err, "failed to get from cache", "page", pageName, "loader", name)
+	} else if ok {
+		entry := &dataLoaderEntry{}
+		if err := json.Unmarshal([]byte(value), entry); err == nil {
+			cached = entry
+			if isCurrent && time.Now().Before(entry.Expires) {
+				return decodeData(entry.Data)
+			}
+		}
+	}
+
+	// The proxy of the function signs a token of the identity of the host.
+	raw, err := hh.callDataLoader(auth.SetAuthContext(ctx, auth.AuthContext{"sub": "system:host:" + hh.Name}), loader, l.String())
+	if err != nil {
+		hh.log.Error(err, "data loader failed", "page", pageName, "loader", name, "function", loader.Function, "operation", loader.Operation)
+		if cached != nil {
+			return decodeData(cached.Data)
+		}
+		return decodeData(loader.Fallback)
+	}
+
+	if loader.TTL != nil && loader.TTL.Duration > 0 {
+		entry, err := json.Marshal(dataLoaderEntry{
+			Data:    raw,
+			Expires: time.Now().Add(min(loader.TTL.Duration, maxDataLoaderTTL)),
+		})
+		if err == nil {
+			err = dataCache.Set(ctx, cacheKey, string(entry))
+		}
+		if err != nil {
+			hh.log.Error(err, "failed to set cache", "page", pageName, "loader", name)
+		}
+	}
+
+	return decodeData(raw)
+}
+
+// callDataLoader calls the operation of the loader with the identity of the
+// context and returns its JSON result.
+func (hh *HostHandler) callDataLoader(ctx context.Context, loader DataLoader, acceptLanguage string) (json.RawMessage, error) {
+	method, path, err := hh.dataLoaderOperation(loader)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	params := map[string]any{}
+	for param, value := range loader.Params {
+		s := fmt.Sprint(value)
+		switch {
+		case strings.Contains(path, "{"+param+"...}"):
+			path = strings.Replace(path, "{"+param+"...}", s, 1)
+		case strings.Contains(path, "{"+param+"}"):
+			path = strings.Replace(path, "{"+param+"}", url.PathEscape(s), 1)
+		case method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete:
+			if list, ok := value.([]any); ok {
+				for _, item := range list {
+					query.Add(param, fmt.Sprint(item))
+				}
+				continue
+			}
+			query.Add(param, s)
+		default:
+			params[param] = value
+		}
+	}
+	if strings.Contains(path, "{") {
+		return nil, fmt.Errorf("%s %s: missing path parameters", method, path)
+	}
+
+	var body []byte
+	if len(params) > 0 {
+		if body, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := defaultDataLoaderTimeout
+	if loader.Timeout != nil {
+		timeout = loader.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	target := &url.URL{Path: path, RawQuery: query.Encode()}
+	r, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "application/json")
+	if acceptLanguage != "" {
+		r.Header.Set("Accept-Language", acceptLanguage)
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	hh.mu.RLock()
+	mux := hh.Mux
+	hh.mu.RUnlock()
+	if mux == nil {
+		return nil, fmt.Errorf("%s %s: host is not ready", method, path)
+	}
+
+	rw := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+	mux.ServeHTTP(rw, r)
+
+	if rw.status >= 400 {
+		return nil, fmt.Errorf("%s %s: %d %s", method, path, rw.status, http.StatusText(rw.status))
+	}
+	if rw.body.Len() == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if !json.Valid(rw.body.Bytes()) {
+		return json.Marshal(rw.body.String())
+	}
+	return json.RawMessage(bytes.Clone(rw.body.Bytes())), nil
+}
+
+// dataLoaderOperation returns the method and the path of the operation of the
+// loader.
+func (hh *HostHandler) dataLoaderOperation(loader DataLoader) (string, string, error) {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	idx := slices.IndexFunc(hh.functions, func(fn kdexv1alpha1.KDexFunction) bool { return fn.Name == loader.Function })
+	if idx == -1 {
+		return "", "", fmt.Errorf("function %s not found", loader.Function)
+	}
+
+	for path, pathItem := range hh.functions[idx].Spec.API.Paths {
+		for _, method := range dataLoaderMethods {
+			if op := pathItem.GetOp(method); op != nil && op.OperationID == loader.Operation {
+				return method, path, nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("operation %s of function %s not found", loader.Operation, loader.Function)
+}
+
+// decodeData returns the template data of a JSON result, nil when there is
+// none.
+func decodeData(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,125 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseDataLoaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "valid",
+			value: `{"orders": {"function": "orders", "operation": "list-orders", "ttl": "1m", "fallback": []}}`,
+			want:  1,
+		},
+		{
+			name:    "missing operation",
+			value:   `{"orders": {"function": "orders"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			value:   `{"orders": {"function": "orders", "operation": "list-orders", "cache": "1m"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative ttl",
+			value:   `{"orders": {"function": "orders", "operation": "list-orders", "ttl": "-1m"}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDataLoaders(map[string]string{DataLoadersAnnotation: tt.value})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestHostHandler_loadData(t *testing.T) {
+	api := ko.OpenAPI{
+		BasePath: "/api/orders",
+		Paths: map[string]ko.PathItem{
+			"/api/orders/{customer}": {
+				Get: &openapi.Operation{OperationID: "list-orders"},
+			},
+		},
+	}
+
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "orders"
+	fn.Spec.API = *api.ToKDexAPI()
+
+	var mu sync.Mutex
+	calls := 0
+	failing := false
+	var subject any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/orders/{customer}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		authContext, _ := auth.GetAuthContext(r.Context())
+		subject = authContext["sub"]
+		_ = json.NewEncoder(w).Encode([]string{r.PathValue("customer"), r.URL.Query().Get("limit"), r.Header.Get("Accept-Language")})
+	})
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := &HostHandler{
+		Mux:          mux,
+		Name:         "shop",
+		cacheManager: cacheManager,
+		functions:    []kdexv1alpha1.KDexFunction{fn},
+		log:          logr.Discard(),
+	}
+
+	loaders, err := ParseDataLoaders(map[string]string{DataLoadersAnnotation: `{
+		"orders": {"function": "orders", "operation": "list-orders", "params": {"customer": "c1", "limit": 5}, "ttl": "1m"},
+		"uncached": {"function": "orders", "operation": "list-orders", "params": {"customer": "c2"}, "fallback": []},
+		"missing": {"function": "orders", "operation": "delete-orders", "fallback": {"orders": []}}
+	}`})
+	require.NoError(t, err)
+
+	data := hh.loadData(context.Background(), "home", loaders, language.French)
+	assert.Equal(t, []any{"c1", "5", "fr"}, data["orders"])
+	assert.Equal(t, []any{"c2", "", "fr"}, data["uncached"])
+	assert.Equal(t, map[string]any{"orders": []any{}}, data["missing"], "unknown operations fall back")
+	assert.Equal(t, "system:host:shop", subject, "the operations are called with the identity of the host")
+	assert.Equal(t, 2, calls)
+
+	failing = true
+	data = hh.loadData(context.Background(), "home", loaders, language.French)
+	assert.Equal(t, []any{"c1", "5", "fr"}, data["orders"], "the result is reused until it expires")
+	assert.Equal(t, []any{}, data["uncached"], "failures fall back")
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,198 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// ThemeExperimentAnnotation holds, on a host, the JSON encoded
+	// ThemeExperiment serving alternative themes to a share of the sessions.
+	ThemeExperimentAnnotation = "kdex.dev/theme-experiment"
+	// ThemeExperimentCookie keeps a session in the variant it was assigned.
+	// The value is "<experiment>:<variant>".
+	ThemeExperimentCookie = "kdex_theme"
+	// ThemeOverrideHeader forces the variant of a request, e.g. to review a
+	// theme before shifting traffic to it. Forced requests are not assigned
+	// nor counted.
+	ThemeOverrideHeader = "X-KDex-Theme"
+	// ThemeControlVariant is the variant serving the theme of the host.
+	ThemeControlVariant = "control"
+
+	themeExperimentCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+// ThemeExperiment splits the sessions of a host between its theme and
+// alternative themes. The sessions not assigned to one of the variants get
+// ThemeControlVariant.
+type ThemeExperiment struct {
+	// Disabled is the kill switch of the experiment: every request gets the
+	// theme of the host and assignments are kept for when it is enabled again.
+	Disabled bool           `json:"disabled,omitempty"`
+	Name     string         `json:"name"`
+	Variants []ThemeVariant `json:"variants"`
+}
+
+// ThemeVariant is an alternative theme served to Weight percent of the
+// sessions.
+type ThemeVariant struct {
+	Name     string                           `json:"name"`
+	ThemeRef kdexv1alpha1.KDexObjectReference `json:"themeRef"`
+	Weight   int                              `json:"weight"`
+}
+
+// ParseThemeExperiment returns the theme experiment of the annotations of a
+// host, nil when ThemeExperimentAnnotation is not set.
+func ParseThemeExperiment(annotations map[string]string) (*ThemeExperiment, error) {
+	value := annotations[ThemeExperimentAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	experiment := &ThemeExperiment{}
+	if err := json.Unmarshal([]byte(value), experiment); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ThemeExperimentAnnotation, err)
+	}
+
+	if experiment.Name == "" || strings.Contains(experiment.Name, ":") {
+		return nil, fmt.Errorf("invalid %s annotation: invalid name %q", ThemeExperimentAnnotation, experiment.Name)
+	}
+
+	total := 0
+	seen := map[string]bool{ThemeControlVariant: true}
+	for _, variant := range experiment.Variants {
+		if variant.Name == "" || seen[variant.Name] {
+			return nil, fmt.Errorf("invalid %s annotation: invalid or duplicate variant name %q", ThemeExperimentAnnotation, variant.Name)
+		}
+		seen[variant.Name] = true
+		if variant.ThemeRef.Kind != "KDexTheme" && variant.ThemeRef.Kind != "KDexClusterTheme" {
+			return nil, fmt.Errorf("invalid %s annotation: variant %s must reference a KDexTheme or a KDexClusterTheme", ThemeExperimentAnnotation, variant.Name)
+		}
+		if variant.Weight < 0 {
+			return nil, fmt.Errorf("invalid %s annotation: variant %s has a negative weight", ThemeExperimentAnnotation, variant.Name)
+		}
+		total += variant.Weight
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("invalid %s annotation: the weights of the variants add up to %d%%", ThemeExperimentAnnotation, total)
+	}
+
+	return experiment, nil
+}
+
+// themeExperiment is a theme experiment with the assets of its variants.
+type themeExperiment struct {
+	ThemeExperiment
+	assets map[string][]kdexv1alpha1.Asset
+}
+
+type themeVariantKey struct{}
+
+// SetThemeExperiment replaces the theme experiment of the host. The assets
+// are those of the theme of each variant. A nil experiment ends it.
+func (hh *HostHandler) SetThemeExperiment(experiment *ThemeExperiment, assets map[string][]kdexv1alpha1.Asset) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if experiment == nil {
+		hh.themeExperiment = nil
+		return
+	}
+	hh.themeExperiment = &themeExperiment{ThemeExperiment: *experiment, assets: assets}
+}
+
+// resolveThemeVariant returns the variant of the theme experiment serving the
+// request, "" without an active experiment. New sessions are assigned a
+// variant by weight, which ThemeExperimentCookie keeps.
+func (hh *HostHandler) resolveThemeVariant(w http.ResponseWriter, r *http.Request) string {
+	experiment := hh.themeExperiment
+	if experiment == nil || experiment.Disabled {
+		return ""
+	}
+
+	if forced := r.Header.Get(ThemeOverrideHeader); forced != "" && experiment.hasVariant(forced) {
+		return forced
+	}
+
+	if cookie, err := r.Cookie(ThemeExperimentCookie); err == nil {
+		name, variant, ok := strings.Cut(cookie.Value, ":")
+		if ok && name == experiment.Name && experiment.hasVariant(variant) {
+			themeExposuresCounter.WithLabelValues(hh.Name, experiment.Name, variant).Inc()
+			return variant
+		}
+	}
+
+	variant := experiment.pick()
+	http.SetCookie(w, &http.Cookie{
+		Name:     ThemeExperimentCookie,
+		Value:    experiment.Name + ":" + variant,
+		Path:     "/",
+		MaxAge:   themeExperimentCookieMaxAge,
+		HttpOnly: true,
+		Secure:   hh.isSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	themeAssignmentsCounter.WithLabelValues(hh.Name, experiment.Name, variant).Inc()
+	themeExposuresCounter.WithLabelValues(hh.Name, experiment.Name, variant).Inc()
+	return variant
+}
+
+// themeAssetsToString renders the theme assets of the variant, those of the
+// host for ThemeControlVariant or no variant.
+func (hh *HostHandler) themeAssetsToString(variant string) string {
+	experiment := hh.themeExperiment
+	if experiment == nil || variant == "" || variant == ThemeControlVariant {
+		return hh.ThemeAssetsToString()
+	}
+
+	assets, ok := experiment.assets[variant]
+	if !ok {
+		return hh.ThemeAssetsToString()
+	}
+
+	var buffer bytes.Buffer
+	for _, asset := range assets {
+		buffer.WriteString(asset.ToTag())
+		buffer.WriteRune('\n')
+	}
+	return buffer.String()
+}
+
+func (e *themeExperiment) hasVariant(name string) bool {
+	if name == ThemeControlVariant {
+		return true
+	}
+	for _, variant := range e.Variants {
+		if variant.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *themeExperiment) pick() string {
+	n := rand.IntN(100)
+	for _, variant := range e.Variants {
+		if n < variant.Weight {
+			return variant.Name
+		}
+		n -= variant.Weight
+	}
+	return ThemeControlVariant
+}
+
+func withThemeVariant(ctx context.Context, variant string) context.Context {
+	return context.WithValue(ctx, themeVariantKey{}, variant)
+}
+
+func themeVariantFrom(ctx context.Context) string {
+	variant, _ := ctx.Value(themeVariantKey{}).(string)
+	return variant
+}
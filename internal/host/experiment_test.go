@@ -0,0 +1,117 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseThemeExperiment(t *testing.T) {
+	experiment, err := ParseThemeExperiment(nil)
+	require.NoError(t, err)
+	assert.Nil(t, experiment)
+
+	experiment, err = ParseThemeExperiment(map[string]string{
+		ThemeExperimentAnnotation: `{"name":"rebrand","variants":[{"name":"brand-2026","themeRef":{"kind":"KDexTheme","name":"brand-2026"},"weight":20}]}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "rebrand", experiment.Name)
+	require.Len(t, experiment.Variants, 1)
+	assert.Equal(t, 20, experiment.Variants[0].Weight)
+
+	for _, value := range []string{
+		`not json`,
+		`{"variants":[]}`,
+		`{"name":"a:b"}`,
+		`{"name":"rebrand","variants":[{"name":"control","themeRef":{"kind":"KDexTheme","name":"t"},"weight":20}]}`,
+		`{"name":"rebrand","variants":[{"name":"new","themeRef":{"kind":"KDexApp","name":"t"},"weight":20}]}`,
+		`{"name":"rebrand","variants":[{"name":"new","themeRef":{"kind":"KDexTheme","name":"t"},"weight":-1}]}`,
+		`{"name":"rebrand","variants":[{"name":"a","themeRef":{"kind":"KDexTheme","name":"t"},"weight":60},{"name":"b","themeRef":{"kind":"KDexTheme","name":"t"},"weight":60}]}`,
+	} {
+		_, err := ParseThemeExperiment(map[string]string{ThemeExperimentAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHostHandler_resolveThemeVariant(t *testing.T) {
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), nil)
+
+	resolve := func(r *http.Request) (string, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		return hh.resolveThemeVariant(rec, r), rec
+	}
+
+	variant, rec := resolve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, variant)
+	assert.Empty(t, rec.Result().Cookies())
+
+	experiment := &ThemeExperiment{
+		Name: "rebrand",
+		Variants: []ThemeVariant{
+			{Name: "brand-2026", ThemeRef: kdexv1alpha1.KDexObjectReference{Kind: "KDexTheme", Name: "brand-2026"}, Weight: 100},
+		},
+	}
+	hh.SetThemeExperiment(experiment, map[string][]kdexv1alpha1.Asset{
+		"brand-2026": {{LinkHref: "/theme/brand-2026.css", Attributes: map[string]string{"rel": "stylesheet"}}},
+	})
+
+	// New sessions are assigned by weight and kept in their variant.
+	variant, rec = resolve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "brand-2026", variant)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, ThemeExperimentCookie, cookies[0].Name)
+	assert.Equal(t, "rebrand:brand-2026", cookies[0].Value)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: ThemeExperimentCookie, Value: "rebrand:control"})
+	variant, rec = resolve(r)
+	assert.Equal(t, ThemeControlVariant, variant)
+	assert.Empty(t, rec.Result().Cookies())
+
+	// Sessions of another experiment are assigned again.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: ThemeExperimentCookie, Value: "launch:control"})
+	variant, _ = resolve(r)
+	assert.Equal(t, "brand-2026", variant)
+
+	// The override header wins and is not assigned.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ThemeOverrideHeader, ThemeControlVariant)
+	variant, rec = resolve(r)
+	assert.Equal(t, ThemeControlVariant, variant)
+	assert.Empty(t, rec.Result().Cookies())
+
+	assert.Contains(t, hh.themeAssetsToString("brand-2026"), "/theme/brand-2026.css")
+	assert.Equal(t, hh.ThemeAssetsToString(), hh.themeAssetsToString(ThemeControlVariant))
+
+	// The kill switch serves the theme of the host to everyone.
+	experiment.Disabled = true
+	hh.SetThemeExperiment(experiment, nil)
+	variant, rec = resolve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, variant)
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestThemeExperiment_pick(t *testing.T) {
+	experiment := &themeExperiment{ThemeExperiment: ThemeExperiment{
+		Name: "rebrand",
+		Variants: []ThemeVariant{
+			{Name: "a", Weight: 30},
+			{Name: "b", Weight: 20},
+		},
+	}}
+
+	counts := map[string]int{}
+	for range 10000 {
+		counts[experiment.pick()]++
+	}
+	assert.InDelta(t, 3000, counts["a"], 300)
+	assert.InDelta(t, 2000, counts["b"], 300)
+	assert.InDelta(t, 5000, counts[ThemeControlVariant], 300)
+}
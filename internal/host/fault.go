@@ -0,0 +1,317 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// FaultInjectionAnnotation enables, on a host, the injection of faults in
+	// the calls of its functions with "true". It is meant for the hosts of
+	// staging environments. The endpoints controlling the faults are only
+	// served by the hosts with authentication.
+	FaultInjectionAnnotation = "kdex.dev/fault-injection"
+	// FaultHeader is set on the responses of the injected errors, so that
+	// they can be told from the errors of the function.
+	FaultHeader = "X-Kdex-Fault"
+
+	FaultError   = "error"
+	FaultLatency = "latency"
+	FaultReset   = "reset"
+
+	defaultFaultStatus = http.StatusServiceUnavailable
+	maxFaultDuration   = time.Hour
+	maxFaultLatency    = time.Minute
+)
+
+// FaultRequest injects faults in the calls of a function by the host, until
+// it expires. Each attempt of a call draws its faults, so the retries and the
+// circuit breaker of the function see them as failures of the function.
+type FaultRequest struct {
+	// Duration is how long the faults are injected, at most 1h.
+	Duration *metav1.Duration `json:"duration"`
+	// ErrorPercent is the percentage of the calls answered with ErrorStatus
+	// instead of calling the function.
+	ErrorPercent float64 `json:"errorPercent,omitempty"`
+	// ErrorStatus is 503 by default.
+	ErrorStatus int `json:"errorStatus,omitempty"`
+	// Latency is added to the calls, at most 1m.
+	Latency *metav1.Duration `json:"latency,omitempty"`
+	// LatencyPercent is the percentage of the calls delayed, 100 by default.
+	LatencyPercent float64 `json:"latencyPercent,omitempty"`
+	// Path restricts the faults to the calls of the paths under it, e.g.
+	// "/api/orders/export", all the paths of the function by default.
+	Path string `json:"path,omitempty"`
+	// ResetPercent is the percentage of the calls failing as if the
+	// connection to the function was reset.
+	ResetPercent float64 `json:"resetPercent,omitempty"`
+}
+
+// FaultStatus is the state of the faults injected in a function.
+type FaultStatus struct {
+	FaultRequest
+	// Injected are the numbers of faults injected by kind.
+	Injected map[string]int64 `json:"injected"`
+	// Requests is the number of calls which could have been faulted.
+	Requests int64     `json:"requests"`
+	Started  time.Time `json:"started"`
+	Until    time.Time `json:"until"`
+}
+
+// faultInjection are the faults injected in a function.
+type faultInjection struct {
+	errors    atomic.Int64
+	latencies atomic.Int64
+	request   FaultRequest
+	requests  atomic.Int64
+	resets    atomic.Int64
+	started   time.Time
+	until     time.Time
+}
+
+type faultKey struct{}
+
+// ParseFaultInjection returns whether the annotations of a host enable the
+// injection of faults.
+func ParseFaultInjection(annotations map[string]string) (bool, error) {
+	value := annotations[FaultInjectionAnnotation]
+	if value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", FaultInjectionAnnotation, err)
+	}
+	return enabled, nil
+}
+
+// SetFaultInjection enables the injection of faults in the functions of the
+// host. Disabling it stops the faults being injected. The endpoints are
+// registered when the mux is rebuilt.
+func (hh *HostHandler) SetFaultInjection(enabled bool) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.faultInjection = enabled
+	if !enabled {
+		hh.faults.Clear()
+	}
+}
+
+// faultFor returns the faults injected in the call of the function by the
+// request, nil when there are none.
+func (hh *HostHandler) faultFor(name string, r *http.Request) *faultInjection {
+	v, ok := hh.faults.Load(name)
+	if !ok {
+		return nil
+	}
+
+	fault := v.(*faultInjection)
+	if !time.Now().Before(fault.until) {
+		hh.faults.CompareAndDelete(name, fault)
+		return nil
+	}
+	if prefix := fault.request.Path; prefix != "" && r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+		return nil
+	}
+	return fault
+}
+
+func withFault(ctx context.Context, fault *faultInjection) context.Context {
+	return context.WithValue(ctx, faultKey{}, fault)
+}
+
+// faultTransport injects the faults of the context of the calls of a
+// function.
+type faultTransport struct {
+	function string
+	host     string
+	next     http.RoundTripper
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, _ := req.Context().Value(faultKey{}).(*faultInjection)
+	if fault == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	fault.requests.Add(1)
+	f := fault.request
+
+	if f.Latency != nil && rand.Float64()*100 < f.LatencyPercent {
+		fault.latencies.Add(1)
+		faultsInjectedCounter.WithLabelValues(t.host, t.function, FaultLatency).Inc()
+		timer := time.NewTimer(f.Latency.Duration)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if rand.Float64()*100 < f.ResetPercent {
+		fault.resets.Add(1)
+		faultsInjectedCounter.WithLabelValues(t.host, t.function, FaultReset).Inc()
+		return nil, fmt.Errorf("injected fault: %w", syscall.ECONNRESET)
+	}
+
+	if rand.Float64()*100 < f.ErrorPercent {
+		fault.errors.Add(1)
+		faultsInjectedCounter.WithLabelValues(t.host, t.function, FaultError).Inc()
+		body := fmt.Sprintf("injected fault of function %s", t.function)
+		return &http.Response{
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Header: http.Header{
+				"Content-Type": []string{"text/plain; charset=utf-8"},
+				FaultHeader:    []string{FaultError},
+			},
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Request:    req,
+			Status:     fmt.Sprintf("%d %s", f.ErrorStatus, http.StatusText(f.ErrorStatus)),
+			StatusCode: f.ErrorStatus,
+		}, nil
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func (f *faultInjection) status() FaultStatus {
+	return FaultStatus{
+		FaultRequest: f.request,
+		Injected: map[string]int64{
+			FaultError:   f.errors.Load(),
+			FaultLatency: f.latencies.Load(),
+			FaultReset:   f.resets.Load(),
+		},
+		Requests: f.requests.Load(),
+		Started:  f.started,
+		Until:    f.until,
+	}
+}
+
+// validateFaultRequest fills the defaults of the request, or returns why it
+// is invalid.
+func validateFaultRequest(f *FaultRequest, basePath string) error {
+	if f.Duration == nil || f.Duration.Duration <= 0 || f.Duration.Duration > maxFaultDuration {
+		return fmt.Errorf("the duration must be positive and at most %s", maxFaultDuration)
+	}
+	if f.Path != "" && f.Path != basePath && !strings.HasPrefix(f.Path, strings.TrimSuffix(basePath, "/")+"/") {
+		return fmt.Errorf("the path must be under the base path %s of the function", basePath)
+	}
+	if f.Latency != nil {
+		if f.Latency.Duration <= 0 || f.Latency.Duration > maxFaultLatency {
+			return fmt.Errorf("the latency must be positive and at most %s", maxFaultLatency)
+		}
+		if f.LatencyPercent == 0 {
+			f.LatencyPercent = 100
+		}
+	}
+	if f.ErrorStatus == 0 {
+		f.ErrorStatus = defaultFaultStatus
+	}
+	if f.ErrorStatus < http.StatusBadRequest || f.ErrorStatus > 599 {
+		return fmt.Errorf("the error status must be a 4xx or a 5xx status")
+	}
+	for name, percent := range map[string]float64{"errorPercent": f.ErrorPercent, "latencyPercent": f.LatencyPercent, "resetPercent": f.ResetPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("%s must be between 0 and 100", name)
+		}
+	}
+	if f.Latency == nil && f.ErrorPercent == 0 && f.ResetPercent == 0 {
+		return fmt.Errorf("no fault to inject, set a latency, errorPercent or resetPercent")
+	}
+	return nil
+}
+
+// FaultPost starts injecting faults in the calls of the function, replacing
+// the previous ones.
+func (hh *HostHandler) FaultPost(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	body := FaultRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid fault request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateFaultRequest(&body, fn.Spec.API.BasePath); err != nil {
+		http.Error(w, fmt.Sprintf("invalid fault request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	fault := &faultInjection{
+		request: body,
+		started: now,
+		until:   now.Add(body.Duration.Duration),
+	}
+	hh.faults.Store(fn.Name, fault)
+
+	hh.log.Info(
+		"fault injection started",
+		"function", fn.Name,
+		"path", body.Path,
+		"duration", body.Duration.Duration.String(),
+		"errorPercent", body.ErrorPercent,
+		"resetPercent", body.ResetPercent,
+	)
+
+	hh.writeFaultStatus(w, http.StatusAccepted, fault.status())
+}
+
+// FaultGet serves the faults injected in the function.
+func (hh *HostHandler) FaultGet(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	v, ok := hh.faults.Load(fn.Name)
+	if !ok || !time.Now().Before(v.(*faultInjection).until) {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	hh.writeFaultStatus(w, http.StatusOK, v.(*faultInjection).status())
+}
+
+// FaultDelete stops injecting faults in the function.
+func (hh *HostHandler) FaultDelete(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	if _, loaded := hh.faults.LoadAndDelete(fn.Name); loaded {
+		hh.log.Info("fault injection stopped", "function", fn.Name)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (hh *HostHandler) writeFaultStatus(w http.ResponseWriter, code int, status FaultStatus) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		hh.log.Error(err, "failed to encode fault status")
+	}
+}
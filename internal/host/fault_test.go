@@ -0,0 +1,184 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseFaultInjection(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{name: "not set"},
+		{name: "enabled", value: "true", want: true},
+		{name: "disabled", value: "false"},
+		{name: "invalid", value: "staging", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFaultInjection(map[string]string{FaultInjectionAnnotation: tt.value})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer upstream.Close()
+
+	transport := &faultTransport{function: "orders", host: "fault-test", next: http.DefaultTransport}
+	roundTrip := func(ctx context.Context, f FaultRequest) (*http.Response, error) {
+		req := httptest.NewRequest(http.MethodGet, upstream.URL+"/api/orders", nil)
+		req.RequestURI = ""
+		if f.Duration != nil {
+			ctx = withFault(ctx, &faultInjection{request: f, until: time.Now().Add(f.Duration.Duration)})
+		}
+		return transport.RoundTrip(req.WithContext(ctx))
+	}
+	minute := &metav1.Duration{Duration: time.Minute}
+
+	resp, err := roundTrip(context.Background(), FaultRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "no fault")
+	assert.Equal(t, 1, calls)
+
+	resp, err = roundTrip(context.Background(), FaultRequest{Duration: minute, ErrorPercent: 100, ErrorStatus: http.StatusBadGateway})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, FaultError, resp.Header.Get(FaultHeader))
+	assert.Equal(t, 1, calls, "the function is not called")
+	assert.Equal(t, float64(1), testutil.ToFloat64(faultsInjectedCounter.WithLabelValues("fault-test", "orders", FaultError)))
+
+	_, err = roundTrip(context.Background(), FaultRequest{Duration: minute, ResetPercent: 100})
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 1, calls)
+
+	start := time.Now()
+	resp, err = roundTrip(context.Background(), FaultRequest{Duration: minute, Latency: &metav1.Duration{Duration: 50 * time.Millisecond}, LatencyPercent: 100})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 2, calls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = roundTrip(ctx, FaultRequest{Duration: minute, Latency: minute, LatencyPercent: 100})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the latency ends with the request")
+	assert.Equal(t, 2, calls)
+}
+
+func TestHostHandler_faults(t *testing.T) {
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "orders"
+	fn.Spec.API.BasePath = "/api/orders"
+
+	hh := &HostHandler{
+		authChecker: auth.NewAuthorizationChecker(nil, logr.Discard()),
+		authConfig:  &auth.Config{ActivePair: &keys.KeyPair{}},
+		functions:   []kdexv1alpha1.KDexFunction{fn},
+		log:         logr.Discard(),
+	}
+
+	mux := http.NewServeMux()
+	hh.faultHandler(mux, map[string]ko.PathInfo{})
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": []any{"functions:/api/orders:read", "functions:/api/orders:write"}}))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/faults/orders", `{"duration": "1m", "errorPercent": 50}`).Code, "not enabled")
+
+	hh.SetFaultInjection(true)
+	authConfig := hh.authConfig
+	hh.authConfig = nil
+	mux = http.NewServeMux()
+	hh.faultHandler(mux, map[string]ko.PathInfo{})
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/faults/orders", `{"duration": "1m", "errorPercent": 50}`).Code, "authentication disabled")
+
+	hh.authConfig = authConfig
+	mux = http.NewServeMux()
+	hh.faultHandler(mux, map[string]ko.PathInfo{})
+	r := httptest.NewRequest(http.MethodPost, "/-/admin/faults/orders", strings.NewReader(`{"duration": "1m", "errorPercent": 50}`))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code, "anonymous")
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/faults/orders", "").Code, "no faults")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/faults/payments", `{"duration": "1m", "errorPercent": 50}`).Code, "unknown function")
+	for _, body := range []string{
+		`{"errorPercent": 50}`,
+		`{"duration": "2h", "errorPercent": 50}`,
+		`{"duration": "1m"}`,
+		`{"duration": "1m", "errorPercent": 150}`,
+		`{"duration": "1m", "errorPercent": 50, "errorStatus": 200}`,
+		`{"duration": "1m", "latency": "2m"}`,
+		`{"duration": "1m", "errorPercent": 50, "path": "/api/payments"}`,
+		`{"duration": "1m", "errorPercent": 50, "kind": "error"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/-/admin/faults/orders", body).Code, body)
+	}
+
+	w = serve(http.MethodPost, "/-/admin/faults/orders", `{"duration": "1m", "errorPercent": 50, "latency": "1s", "path": "/api/orders/export"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	started := FaultStatus{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&started))
+	assert.Equal(t, http.StatusServiceUnavailable, started.ErrorStatus)
+	assert.Equal(t, float64(100), started.LatencyPercent)
+	assert.WithinDuration(t, started.Started.Add(time.Minute), started.Until, time.Millisecond)
+
+	assert.Nil(t, hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders/42", nil)), "outside of the path")
+	assert.Nil(t, hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders/exports", nil)))
+	fault := hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders/export/csv", nil))
+	require.NotNil(t, fault)
+	fault.requests.Add(2)
+	fault.errors.Add(1)
+
+	w = serve(http.MethodGet, "/-/admin/faults/orders", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	status := FaultStatus{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, int64(2), status.Requests)
+	assert.Equal(t, int64(1), status.Injected[FaultError])
+
+	fault.until = time.Now()
+	assert.Nil(t, hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders/export", nil)), "expired")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/faults/orders", "").Code)
+
+	require.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/-/admin/faults/orders", `{"duration": "1m", "resetPercent": 10}`).Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/-/admin/faults/orders", "").Code)
+	assert.Nil(t, hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders", nil)))
+
+	require.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/-/admin/faults/orders", `{"duration": "1m", "resetPercent": 10}`).Code)
+	hh.SetFaultInjection(false)
+	assert.Nil(t, hh.faultFor("orders", httptest.NewRequest(http.MethodGet, "/api/orders", nil)), "disabling stops the faults")
+}
@@ -0,0 +1,528 @@
+package host
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// FederationAnnotation makes, on a host, the host the aggregator of the
+	// OpenAPI catalogs of its peers, e.g.
+	// {"interval":"5m","peers":[{"name":"billing","url":"https://billing.example.com"}]}.
+	// The combined catalog is served at /-/federation/openapi.
+	FederationAnnotation = "kdex.dev/federation"
+	// FederationPeerAnnotation names, on a service account secret of type
+	// federation, the peer the secret authenticates to. The secret holds
+	// either the client_id and client_secret of an M2M client of the peer, or
+	// the tls.crt, tls.key and optional ca.crt of an mTLS client certificate.
+	FederationPeerAnnotation = "kdex.dev/federation-peer"
+	// FederationSecretType is the kdex.dev/secret-type of the service account
+	// secrets of the peers.
+	FederationSecretType = "federation"
+
+	defaultFederationInterval = 5 * time.Minute
+	federationFetchTimeout    = 10 * time.Second
+	maxFederationResponseSize = 8 << 20
+	minFederationInterval     = time.Minute
+	// federationStaleAfter is the number of intervals after which the catalog
+	// of a peer which could not be fetched again is reported stale.
+	federationStaleAfter = 3
+)
+
+var (
+	federationPeerNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	componentRefRegex       = regexp.MustCompile(`"#/components/([A-Za-z]+)/`)
+)
+
+// Federation is the configuration of the aggregation of the catalogs of the
+// peers of a host.
+type Federation struct {
+	Interval time.Duration
+	Peers    []FederationPeer
+
+	fingerprint string
+}
+
+// FederationPeer is a host whose catalog is aggregated, authenticated with
+// an M2M token when ClientID is set, or with a client certificate when TLS
+// is set.
+type FederationPeer struct {
+	ClientID     string
+	ClientSecret string
+	Name         string
+	TLS          *tls.Config
+	URL          string
+}
+
+// FederationPeerStatus is the freshness of the catalog of a peer.
+type FederationPeerStatus struct {
+	Error   string     `json:"error,omitempty"`
+	Fetched *time.Time `json:"fetched,omitempty"`
+	Name    string     `json:"name"`
+	Paths   int        `json:"paths"`
+	Stale   bool       `json:"stale"`
+	URL     string     `json:"url"`
+}
+
+type federatedPeer struct {
+	doc          *openapi.T
+	err          error
+	fetched      time.Time
+	token        string
+	tokenExpires time.Time
+}
+
+// ParseFederation returns the federation of the annotations of a host with
+// the credentials of its peers, nil when FederationAnnotation is not set.
+func ParseFederation(annotations map[string]string, secrets kdexv1alpha1.ServiceAccountSecrets) (*Federation, error) {
+	value := annotations[FederationAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	config := struct {
+		Interval string `json:"interval"`
+		Peers    []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"peers"`
+	}{}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q, expected a JSON object of interval and peers: %w", FederationAnnotation, value, err)
+	}
+
+	federation := &Federation{Interval: defaultFederationInterval}
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil || interval < minFederationInterval {
+			return nil, fmt.Errorf("invalid %s annotation %q, expected an interval of at least %s", FederationAnnotation, value, minFederationInterval)
+		}
+		federation.Interval = interval
+	}
+
+	fingerprint := sha256.New()
+	fingerprint.Write([]byte(value))
+
+	peerSecrets := map[string]corev1.Secret{}
+	for _, secret := range secrets.Filter(func(s corev1.Secret) bool { return s.Annotations["kdex.dev/secret-type"] == FederationSecretType }) {
+		peerSecrets[secret.Annotations[FederationPeerAnnotation]] = secret
+	}
+
+	for _, p := range config.Peers {
+		if !federationPeerNameRegex.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid %s annotation %q, peer name %q must be a DNS label", FederationAnnotation, value, p.Name)
+		}
+		if slices.ContainsFunc(federation.Peers, func(o FederationPeer) bool { return o.Name == p.Name }) {
+			return nil, fmt.Errorf("invalid %s annotation %q, peer %s is listed twice", FederationAnnotation, value, p.Name)
+		}
+		u, err := url.Parse(p.URL)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s annotation %q, peer %s url %q is not absolute", FederationAnnotation, value, p.Name, p.URL)
+		}
+
+		secret, ok := peerSecrets[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("peer %s of %s annotation has no service account secret of type %s", p.Name, FederationAnnotation, FederationSecretType)
+		}
+		peer, err := federationPeer(p.Name, strings.TrimSuffix(p.URL, "/"), secret)
+		if err != nil {
+			return nil, err
+		}
+		federation.Peers = append(federation.Peers, peer)
+
+		for _, key := range slices.Sorted(maps.Keys(secret.Data)) {
+			fmt.Fprintf(fingerprint, "%s\x00%s\x00%s\n", p.Name, key, secret.Data[key])
+		}
+	}
+
+	federation.fingerprint = hex.EncodeToString(fingerprint.Sum(nil))
+	return federation, nil
+}
+
+func federationPeer(name string, peerURL string, secret corev1.Secret) (FederationPeer, error) {
+	peer := FederationPeer{Name: name, URL: peerURL}
+
+	if clientID := string(secret.Data["client_id"]); clientID != "" {
+		peer.ClientID = clientID
+		peer.ClientSecret = string(secret.Data["client_secret"])
+		return peer, nil
+	}
+
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return peer, fmt.Errorf("secret %s of peer %s has neither a client_id nor a valid client certificate: %w", secret.Name, name, err)
+	}
+	peer.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if ca := secret.Data[corev1.ServiceAccountRootCAKey]; len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return peer, fmt.Errorf("secret %s of peer %s has an invalid %s", secret.Name, name, corev1.ServiceAccountRootCAKey)
+		}
+		peer.TLS.RootCAs = pool
+	}
+	return peer, nil
+}
+
+// SetFederation sets the federation of the host, nil disables it. Changing
+// the federation restarts the aggregation.
+func (hh *HostHandler) SetFederation(federation *Federation) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if federation == nil && hh.federation == nil ||
+		federation != nil && hh.federation != nil && federation.fingerprint == hh.federation.fingerprint {
+		return
+	}
+	if hh.federationCancel != nil {
+		hh.federationCancel()
+		hh.federationCancel = nil
+	}
+	hh.federation = federation
+	hh.federatedPeers = map[string]*federatedPeer{}
+	federationPeerFetchedGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+
+	if federation == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hh.federationCancel = cancel
+	go hh.runFederation(ctx, federation)
+}
+
+func (hh *HostHandler) runFederation(ctx context.Context, federation *Federation) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		hh.FetchPeers(ctx, federation)
+		timer.Reset(federation.Interval)
+	}
+}
+
+// FetchPeers fetches the catalogs of the peers of the federation. The last
+// catalog fetched of a peer is kept when it cannot be fetched again.
+func (hh *HostHandler) FetchPeers(ctx context.Context, federation *Federation) {
+	for _, peer := range federation.Peers {
+		hh.mu.RLock()
+		state, ok := hh.federatedPeers[peer.Name]
+		current := hh.federation == federation
+		hh.mu.RUnlock()
+		if !current {
+			return
+		}
+		if !ok {
+			state = &federatedPeer{}
+		}
+
+		next := *state
+		doc, err := hh.fetchPeer(ctx, peer, &next)
+		if err != nil {
+			hh.log.Error(err, "failed to fetch the catalog of federation peer", "peer", peer.Name)
+			next.err = err
+		} else {
+			next.doc = doc
+			next.err = nil
+			next.fetched = time.Now()
+			federationPeerFetchedGauge.WithLabelValues(hh.Name, peer.Name).Set(float64(next.fetched.Unix()))
+		}
+
+		hh.mu.Lock()
+		if hh.federation == federation {
+			hh.federatedPeers[peer.Name] = &next
+		}
+		hh.mu.Unlock()
+	}
+}
+
+func (hh *HostHandler) fetchPeer(ctx context.Context, peer FederationPeer, state *federatedPeer) (*openapi.T, error) {
+	ctx, cancel := context.WithTimeout(ctx, federationFetchTimeout)
+	defer cancel()
+
+	client := &http.Client{}
+	if peer.TLS != nil {
+		client.Transport = &http.Transport{TLSClientConfig: peer.TLS}
+	}
+
+	if peer.ClientID != "" && (state.token == "" || time.Now().After(state.tokenExpires)) {
+		form := url.Values{
+			"client_id":     {peer.ClientID},
+			"client_secret": {peer.ClientSecret},
+			"grant_type":    {"client_credentials"},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer.URL+"/-/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		body, err := doFederationRequest(client, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token: %w", err)
+		}
+		token := struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}{}
+		if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+			return nil, fmt.Errorf("invalid token response: %w", err)
+		}
+		state.token = token.AccessToken
+		// Renew the token a little before it expires.
+		state.tokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - federationFetchTimeout)
+	}
+
+	query := url.Values{"type": {
+		strings.ToLower(string(ko.BackendPathType)),
+		strings.ToLower(string(ko.FunctionPathType)),
+		strings.ToLower(string(ko.PagePathType)),
+	}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL+"/-/openapi?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if state.token != "" {
+		req.Header.Set("Authorization", "Bearer "+state.token)
+	}
+	body, err := doFederationRequest(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catalog: %w", err)
+	}
+
+	return namespaceCatalog(peer, body)
+}
+
+func doFederationRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFederationResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// namespaceCatalog namespaces the catalog of the peer by its name: the paths
+// are prefixed with /<peer>, and the components and operation ids with
+// <peer>. so that they do not collide with those of the other hosts.
+func namespaceCatalog(peer FederationPeer, body []byte) (*openapi.T, error) {
+	body = componentRefRegex.ReplaceAll(body, []byte(`"#/components/$1/`+peer.Name+`.`))
+
+	doc := &openapi.T{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	out := &openapi.T{Components: &openapi.Components{}, Paths: &openapi.Paths{}}
+	if c := doc.Components; c != nil {
+		out.Components.Callbacks = prefixKeys(c.Callbacks, peer.Name)
+		out.Components.Examples = prefixKeys(c.Examples, peer.Name)
+		out.Components.Headers = prefixKeys(c.Headers, peer.Name)
+		out.Components.Links = prefixKeys(c.Links, peer.Name)
+		out.Components.Parameters = prefixKeys(c.Parameters, peer.Name)
+		out.Components.RequestBodies = prefixKeys(c.RequestBodies, peer.Name)
+		out.Components.Responses = prefixKeys(c.Responses, peer.Name)
+		out.Components.Schemas = prefixKeys(c.Schemas, peer.Name)
+		out.Components.SecuritySchemes = prefixKeys(c.SecuritySchemes, peer.Name)
+	}
+
+	if doc.Paths == nil {
+		return out, nil
+	}
+	for path, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			if op.OperationID != "" {
+				op.OperationID = peer.Name + "." + op.OperationID
+			}
+			op.Tags = append(op.Tags, peer.Name)
+			if op.Security != nil {
+				security := openapi.SecurityRequirements{}
+				for _, requirement := range *op.Security {
+					security = append(security, prefixKeys(requirement, peer.Name))
+				}
+				op.Security = &security
+			}
+		}
+		if item.Extensions == nil {
+			item.Extensions = map[string]any{}
+		}
+		item.Extensions["x-kdex-federation"] = map[string]string{
+			"host": peer.Name,
+			"path": path,
+			"url":  peer.URL + path,
+		}
+		out.Paths.Set("/"+peer.Name+path, item)
+	}
+	return out, nil
+}
+
+func prefixKeys[M ~map[string]V, V any](m M, prefix string) M {
+	if m == nil {
+		return nil
+	}
+	out := M{}
+	for k, v := range m {
+		out[prefix+"."+k] = v
+	}
+	return out
+}
+
+// FederationStatus returns the freshness of the catalogs of the peers, nil
+// when the host aggregates no peers.
+func (hh *HostHandler) FederationStatus() []FederationPeerStatus {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	if hh.federation == nil {
+		return nil
+	}
+
+	statuses := []FederationPeerStatus{}
+	for _, peer := range hh.federation.Peers {
+		status := FederationPeerStatus{Name: peer.Name, Stale: true, URL: peer.URL}
+		if state, ok := hh.federatedPeers[peer.Name]; ok {
+			if state.err != nil {
+				status.Error = state.err.Error()
+			}
+			if state.doc != nil {
+				status.Fetched = new(state.fetched)
+				status.Paths = state.doc.Paths.Len()
+				status.Stale = state.err != nil && time.Since(state.fetched) > federationStaleAfter*hh.federation.Interval
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// FederationGet serves the freshness of the catalogs of the peers.
+func (hh *HostHandler) FederationGet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"host":  hh.Name,
+		"peers": hh.FederationStatus(),
+	}); err != nil {
+		hh.log.Error(err, "failed to encode federation status")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// FederationOpenAPIGet serves the catalog of the host combined with the
+// namespaced catalogs of its peers. The freshness of the catalogs of the
+// peers is reported in the x-kdex-federation extension of the info.
+func (hh *HostHandler) FederationOpenAPIGet(w http.ResponseWriter, r *http.Request) {
+	statuses := hh.FederationStatus()
+
+	hh.mu.RLock()
+	doc := hh.GetOpenAPIBuilder().BuildOpenAPI(ko.Host(r), hh.Name, hh.registeredPaths, filterFromQuery(r.URL.Query()))
+	peers := make([]*openapi.T, 0, len(hh.federatedPeers))
+	for _, name := range slices.Sorted(maps.Keys(hh.federatedPeers)) {
+		if peer := hh.federatedPeers[name]; peer.doc != nil {
+			peers = append(peers, peer.doc)
+		}
+	}
+	hh.mu.RUnlock()
+
+	doc.Info.Title = fmt.Sprintf("KDex Federation - %s", hh.Name)
+	if doc.Info.Extensions == nil {
+		doc.Info.Extensions = map[string]any{}
+	}
+	doc.Info.Extensions["x-kdex-federation"] = statuses
+
+	mergeCatalogs(doc, peers...)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		hh.log.Error(err, "failed to encode federated OpenAPI spec")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// mergeCatalogs adds the namespaced catalogs of the peers to the catalog of
+// the host. The shared maps of the catalogs of the peers are not modified.
+func mergeCatalogs(doc *openapi.T, peers ...*openapi.T) {
+	if doc.Components == nil {
+		doc.Components = &openapi.Components{}
+	}
+	if doc.Paths == nil {
+		doc.Paths = &openapi.Paths{}
+	}
+	c := doc.Components
+	for _, peer := range peers {
+		c.Callbacks = mergeInto(c.Callbacks, peer.Components.Callbacks)
+		c.Examples = mergeInto(c.Examples, peer.Components.Examples)
+		c.Headers = mergeInto(c.Headers, peer.Components.Headers)
+		c.Links = mergeInto(c.Links, peer.Components.Links)
+		c.Parameters = mergeInto(c.Parameters, peer.Components.Parameters)
+		c.RequestBodies = mergeInto(c.RequestBodies, peer.Components.RequestBodies)
+		c.Responses = mergeInto(c.Responses, peer.Components.Responses)
+		c.Schemas = mergeInto(c.Schemas, peer.Components.Schemas)
+		c.SecuritySchemes = mergeInto(c.SecuritySchemes, peer.Components.SecuritySchemes)
+
+		for path, item := range peer.Paths.Map() {
+			doc.Paths.Set(path, item)
+		}
+	}
+
+	tags := map[string]*openapi.Tag{}
+	for _, tag := range doc.Tags {
+		tags[tag.Name] = tag
+	}
+	for _, peer := range peers {
+		for _, item := range peer.Paths.Map() {
+			for _, op := range item.Operations() {
+				for _, name := range op.Tags {
+					if _, ok := tags[name]; !ok {
+						tags[name] = &openapi.Tag{Name: name}
+					}
+				}
+			}
+		}
+	}
+	doc.Tags = slices.SortedFunc(maps.Values(tags), func(a, b *openapi.Tag) int { return cmp.Compare(a.Name, b.Name) })
+}
+
+func mergeInto[M ~map[string]V, V any](dst M, src M) M {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = M{}
+	}
+	maps.Copy(dst, src)
+	return dst
+}
@@ -0,0 +1,214 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const billingCatalog = `{
+	"openapi": "3.0.0",
+	"info": {"title": "billing", "version": "1"},
+	"components": {
+		"schemas": {"Invoice": {"type": "object"}},
+		"securitySchemes": {"bearer": {"type": "http", "scheme": "bearer"}}
+	},
+	"paths": {
+		"/v1/invoices": {
+			"get": {
+				"operationId": "invoices-get",
+				"security": [{"bearer": []}],
+				"responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}}}
+			}
+		}
+	}
+}`
+
+func federationSecret(peer string, data map[string][]byte) corev1.Secret {
+	return corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: peer + "-federation",
+			Annotations: map[string]string{
+				"kdex.dev/secret-type":   FederationSecretType,
+				FederationPeerAnnotation: peer,
+			},
+		},
+		Data: data,
+	}
+}
+
+// billingPeer serves billingCatalog to the holders of a token of the
+// client_credentials of billing, failing when fail is set.
+func billingPeer(t *testing.T, fail *atomic.Bool) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /-/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "portal" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "billing-token", "expires_in": 3600})
+	})
+	mux.HandleFunc("GET /-/openapi", func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer billing-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.ElementsMatch(t, []string{"backend", "function", "page"}, r.URL.Query()["type"])
+		_, _ = w.Write([]byte(billingCatalog))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseFederation(t *testing.T) {
+	federation, err := ParseFederation(map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, federation)
+
+	secrets := kdexv1alpha1.ServiceAccountSecrets{
+		federationSecret("billing", map[string][]byte{"client_id": []byte("portal"), "client_secret": []byte("secret")}),
+	}
+	federation, err = ParseFederation(map[string]string{
+		FederationAnnotation: `{"interval":"2m","peers":[{"name":"billing","url":"https://billing.example.com/"}]}`,
+	}, secrets)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, federation.Interval)
+	require.Len(t, federation.Peers, 1)
+	assert.Equal(t, "https://billing.example.com", federation.Peers[0].URL)
+	assert.Equal(t, "portal", federation.Peers[0].ClientID)
+
+	for _, value := range []string{
+		`[]`,
+		`{"interval":"10s","peers":[]}`,
+		`{"peers":[{"name":"Billing","url":"https://billing.example.com"}]}`,
+		`{"peers":[{"name":"billing","url":"/billing"}]}`,
+		`{"peers":[{"name":"billing","url":"https://billing.example.com"},{"name":"billing","url":"https://billing.example.com"}]}`,
+		`{"peers":[{"name":"orders","url":"https://orders.example.com"}]}`,
+	} {
+		_, err = ParseFederation(map[string]string{FederationAnnotation: value}, secrets)
+		assert.Error(t, err, value)
+	}
+
+	_, err = ParseFederation(map[string]string{
+		FederationAnnotation: `{"peers":[{"name":"billing","url":"https://billing.example.com"}]}`,
+	}, kdexv1alpha1.ServiceAccountSecrets{federationSecret("billing", map[string][]byte{})})
+	assert.ErrorContains(t, err, "neither a client_id nor a valid client certificate")
+}
+
+func TestHostHandler_Federation(t *testing.T) {
+	fail := &atomic.Bool{}
+	peer := billingPeer(t, fail)
+
+	federation, err := ParseFederation(map[string]string{
+		FederationAnnotation: `{"peers":[{"name":"billing","url":"` + peer.URL + `"}]}`,
+	}, kdexv1alpha1.ServiceAccountSecrets{
+		federationSecret("billing", map[string][]byte{"client_id": []byte("portal"), "client_secret": []byte("secret")}),
+	})
+	require.NoError(t, err)
+
+	cacheManager, _ := cache.NewCacheManager("", "portal", nil)
+	hh := NewHostHandler(nil, "portal", "kdex", logr.Discard(), cacheManager)
+	hh.SetFederation(federation)
+	t.Cleanup(func() { hh.SetFederation(nil) })
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Portal",
+		OpenAPI: kdexv1alpha1.OpenAPI{
+			TypesToInclude: []kdexv1alpha1.TypeToInclude{kdexv1alpha1.TypeSYSTEM},
+		},
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	require.Eventually(t, func() bool {
+		statuses := hh.FederationStatus()
+		return len(statuses) == 1 && statuses[0].Fetched != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/federation/openapi", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	doc := map[string]any{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+
+	paths := doc["paths"].(map[string]any)
+	assert.Contains(t, paths, "/-/openapi", "local paths are kept")
+	require.Contains(t, paths, "/billing/v1/invoices")
+	item := paths["/billing/v1/invoices"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"host": "billing",
+		"path": "/v1/invoices",
+		"url":  peer.URL + "/v1/invoices",
+	}, item["x-kdex-federation"])
+
+	get := item["get"].(map[string]any)
+	assert.Equal(t, "billing.invoices-get", get["operationId"])
+	assert.Equal(t, []any{"billing"}, get["tags"])
+	assert.Equal(t, []any{map[string]any{"billing.bearer": []any{}}}, get["security"])
+	schema := get["responses"].(map[string]any)["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+	assert.Equal(t, map[string]any{"$ref": "#/components/schemas/billing.Invoice"}, schema)
+
+	components := doc["components"].(map[string]any)
+	assert.Contains(t, components["schemas"], "billing.Invoice")
+	assert.Contains(t, components["securitySchemes"], "billing.bearer")
+
+	freshness := doc["info"].(map[string]any)["x-kdex-federation"].([]any)
+	require.Len(t, freshness, 1)
+	assert.Equal(t, "billing", freshness[0].(map[string]any)["name"])
+	assert.Equal(t, false, freshness[0].(map[string]any)["stale"])
+
+	// A peer which cannot be fetched keeps its last catalog until it is stale.
+	fail.Store(true)
+	hh.FetchPeers(context.Background(), federation)
+
+	rr = httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/federation", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	status := struct {
+		Host  string                 `json:"host"`
+		Peers []FederationPeerStatus `json:"peers"`
+	}{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, "portal", status.Host)
+	require.Len(t, status.Peers, 1)
+	assert.Contains(t, status.Peers[0].Error, "returned 503")
+	assert.Equal(t, 1, status.Peers[0].Paths)
+	assert.False(t, status.Peers[0].Stale)
+
+	hh.mu.Lock()
+	hh.federatedPeers["billing"].fetched = time.Now().Add(-federationStaleAfter * federation.Interval)
+	hh.mu.Unlock()
+	assert.True(t, hh.FederationStatus()[0].Stale)
+}
+
+func TestHostHandler_FederationDisabled(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "portal", nil)
+	hh := NewHostHandler(nil, "portal", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Portal",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/federation/openapi", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -3,6 +3,7 @@ package host
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -176,6 +177,17 @@ func isAgent(userAgent string) bool {
 	return false
 }
 
+// inspectFormat picks the format of the sniffer inspect page best suited to
+// the client.
+func inspectFormat(r *http.Request) string {
+	if isAgent(r.UserAgent()) {
+		return "json"
+	} else if isCLI(r.UserAgent()) || strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		return "text"
+	}
+	return "html"
+}
+
 // User-Agent detection for CLI tools
 func isCLI(userAgent string) bool {
 	userAgent = strings.ToLower(userAgent)
@@ -205,6 +217,17 @@ func (hh *HostHandler) DesignMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// In proxy mode unmatched requests are forwarded to the upstream so
+		// that the sniffer learns from the actual responses
+		if hh.SnifferUpstream != nil && p == "" && !strings.HasPrefix(r.URL.Path, "/-/") {
+			var bodyBytes []byte
+			if r.Body != nil {
+				bodyBytes, _ = io.ReadAll(r.Body)
+			}
+			hh.proxyToUpstream(w, r, bodyBytes)
+			return
+		}
+
 		// We should only invoke the sniffer if:
 		// - there is no handler, OR
 		// - if the handler is a KDexFunctionHandler AND the function is
@@ -251,7 +274,12 @@ func (hh *HostHandler) DesignMiddleware(next http.Handler) http.Handler {
 			if err != nil {
 				hh.log.Error(err, "failed to analyze request", "path", r.URL.Path)
 				// Fallback to standard error serving if analysis fails
-				hh.serveError(w, r, http.StatusBadRequest, err.Error())
+				code := http.StatusBadRequest
+				var conflict *sniffer.SchemaConflictError
+				if errors.As(err, &conflict) {
+					code = http.StatusConflict
+				}
+				hh.serveError(w, r, code, err.Error())
 				return
 			}
 
@@ -262,17 +290,10 @@ func (hh *HostHandler) DesignMiddleware(next http.Handler) http.Handler {
 			}
 
 			// Store result
-			id := hh.analysisCache.Store(result)
+			id := hh.storeAnalysis(result)
 
 			// Smart Redirection
-			format := "html"
-			if isAgent(r.UserAgent()) {
-				format = "json"
-			} else if isCLI(r.UserAgent()) || strings.Contains(r.Header.Get("Accept"), "text/plain") {
-				format = "text"
-			}
-
-			inspectURL := fmt.Sprintf("/-/sniffer/inspect/%s?format=%s", id, format)
+			inspectURL := fmt.Sprintf("/-/sniffer/inspect/%s?format=%s", id, inspectFormat(r))
 			absoluteURL := fmt.Sprintf("%s%s", ko.Host(r), inspectURL)
 
 			w.Header().Set("Location", inspectURL)
@@ -332,7 +353,7 @@ func (hh *HostHandler) InspectHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("uuid")
 	format := r.URL.Query().Get("format")
 
-	result, ok := hh.analysisCache.Get(id)
+	result, ok := hh.lookupAnalysis(r, id)
 	if !ok {
 		http.Error(w, "Analysis result expired or not found.", http.StatusNotFound)
 		return
@@ -0,0 +1,327 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Types of values formatted by the format endpoint.
+const (
+	FormatCurrency = "currency"
+	FormatDate     = "date"
+	FormatDateTime = "datetime"
+	FormatNumber   = "number"
+	FormatPercent  = "percent"
+	FormatTime     = "time"
+)
+
+// nbsp separates currency symbols from amounts, as in the CLDR patterns.
+const nbsp = "\u00a0"
+
+// dateTimeLayouts are the numeric date and time patterns of CLDR, as time
+// layouts, by language or language and region.
+var dateTimeLayouts = map[string][2]string{
+	"cs":    {"2. 1. 2006", "15:04"},
+	"da":    {"2.1.2006", "15.04"},
+	"de":    {"2.1.2006", "15:04"},
+	"el":    {"2/1/2006", "3:04 PM"},
+	"en":    {"1/2/2006", "3:04 PM"},
+	"en-AU": {"2/1/2006", "3:04 PM"},
+	"en-CA": {"2006-01-02", "3:04 PM"},
+	"en-GB": {"02/01/2006", "15:04"},
+	"en-IE": {"2/1/2006", "15:04"},
+	"en-IN": {"2/1/2006", "3:04 PM"},
+	"en-NZ": {"2/01/2006", "3:04 PM"},
+	"es":    {"2/1/2006", "15:04"},
+	"fi":    {"2.1.2006", "15.04"},
+	"fr":    {"02/01/2006", "15:04"},
+	"fr-CA": {"2006-01-02", "15 h 04"},
+	"fr-CH": {"02.01.2006", "15:04"},
+	"hi":    {"2/1/2006", "3:04 PM"},
+	"hu":    {"2006. 01. 02.", "15:04"},
+	"it":    {"2/1/2006", "15:04"},
+	"ja":    {"2006/1/2", "15:04"},
+	"ko":    {"2006. 1. 2.", "PM 3:04"},
+	"nb":    {"2.1.2006", "15:04"},
+	"nl":    {"2-1-2006", "15:04"},
+	"pl":    {"2.01.2006", "15:04"},
+	"pt":    {"02/01/2006", "15:04"},
+	"ro":    {"02.01.2006", "15:04"},
+	"ru":    {"02.01.2006", "15:04"},
+	"sv":    {"2006-01-02", "15:04"},
+	"tr":    {"02.01.2006", "15:04"},
+	"uk":    {"02.01.2006", "15:04"},
+	"zh":    {"2006/1/2", "15:04"},
+}
+
+// currencySuffixLanguages place the currency symbol after the amount.
+var currencySuffixLanguages = map[string]bool{
+	"cs": true, "da": true, "de": true, "el": true, "es": true, "fi": true,
+	"fr": true, "hu": true, "it": true, "nb": true, "pl": true, "pt-PT": true,
+	"ro": true, "ru": true, "sv": true, "uk": true,
+}
+
+// currencySpacedLanguages separate a leading currency symbol from the
+// amount.
+var currencySpacedLanguages = map[string]bool{
+	"de-CH": true, "nl": true, "pt": true,
+}
+
+// Formatter formats numbers, currencies and dates following the conventions
+// of a language, and times in a time zone. Pages use it as .Extra.Format,
+// for example [[ .Extra.Format.Currency 9.99 "EUR" ]], and clients through
+// the format endpoint so that both render the same strings.
+type Formatter struct {
+	location *time.Location
+	printer  *message.Printer
+	tag      language.Tag
+}
+
+// NewFormatter returns a formatter for the language rendering times in the
+// location, UTC when it is nil.
+func NewFormatter(tag language.Tag, location *time.Location) *Formatter {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Formatter{
+		location: location,
+		printer:  message.NewPrinter(tag),
+		tag:      tag,
+	}
+}
+
+// Currency formats the amount in the currency of the ISO 4217 code, or the
+// currency of the region of the language when the code is empty, with the
+// number of digits of the currency.
+func (f *Formatter) Currency(value any, code string) (string, error) {
+	amount, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	unit, err := f.currencyUnit(code)
+	if err != nil {
+		return "", err
+	}
+
+	scale, _ := currency.Standard.Rounding(unit)
+	formatted := f.printer.Sprint(number.Decimal(amount, number.Scale(scale)))
+	symbol := f.printer.Sprint(currency.Symbol(unit))
+
+	switch {
+	case f.lookup(func(key string) bool { return currencySuffixLanguages[key] }) != "":
+		return formatted + nbsp + symbol, nil
+	case f.lookup(func(key string) bool { return currencySpacedLanguages[key] }) != "":
+		return symbol + nbsp + formatted, nil
+	default:
+		return symbol + formatted, nil
+	}
+}
+
+// Date formats the date of the value, a time, an RFC 3339 timestamp, a date
+// or unix seconds. Dates and times without a time zone are in the location
+// of the formatter.
+func (f *Formatter) Date(value any) (string, error) {
+	t, err := f.toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(f.layouts()[0]), nil
+}
+
+// DateTime formats the date and the time of the value.
+func (f *Formatter) DateTime(value any) (string, error) {
+	t, err := f.toTime(value)
+	if err != nil {
+		return "", err
+	}
+	layouts := f.layouts()
+	return t.Format(layouts[0] + " " + layouts[1]), nil
+}
+
+// Number formats the value with the grouping and the decimal separator of
+// the language. The number of fraction digits is fixed when given.
+func (f *Formatter) Number(value any, fractionDigits ...int) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	if len(fractionDigits) > 0 {
+		return f.printer.Sprint(number.Decimal(n, number.Scale(fractionDigits[0]))), nil
+	}
+	return f.printer.Sprint(number.Decimal(n)), nil
+}
+
+// Percent formats the ratio as a percentage.
+func (f *Formatter) Percent(value any) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	return f.printer.Sprint(number.Percent(n)), nil
+}
+
+// Time formats the time of the value.
+func (f *Formatter) Time(value any) (string, error) {
+	t, err := f.toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(f.layouts()[1]), nil
+}
+
+// format formats the value as the given type.
+func (f *Formatter) format(kind string, value string, code string) (string, error) {
+	switch kind {
+	case FormatCurrency:
+		return f.Currency(value, code)
+	case FormatDate:
+		return f.Date(value)
+	case FormatDateTime:
+		return f.DateTime(value)
+	case FormatNumber:
+		return f.Number(value)
+	case FormatPercent:
+		return f.Percent(value)
+	case FormatTime:
+		return f.Time(value)
+	default:
+		return "", fmt.Errorf("unknown format type %q", kind)
+	}
+}
+
+func (f *Formatter) currencyUnit(code string) (currency.Unit, error) {
+	if code == "" {
+		unit, confidence := currency.FromTag(f.tag)
+		if confidence == language.No {
+			return currency.Unit{}, fmt.Errorf("no currency for language %s", f.tag)
+		}
+		return unit, nil
+	}
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return currency.Unit{}, fmt.Errorf("invalid currency %q: %w", code, err)
+	}
+	return unit, nil
+}
+
+func (f *Formatter) layouts() [2]string {
+	if key := f.lookup(func(key string) bool { _, ok := dateTimeLayouts[key]; return ok }); key != "" {
+		return dateTimeLayouts[key]
+	}
+	return [2]string{time.DateOnly, "15:04"}
+}
+
+// lookup returns the first of the language and region, and the language, of
+// the tag accepted by the predicate.
+func (f *Formatter) lookup(accept func(string) bool) string {
+	base, _ := f.tag.Base()
+	region, confidence := f.tag.Region()
+	if confidence != language.No {
+		if key := base.String() + "-" + region.String(); accept(key) {
+			return key
+		}
+	}
+	if accept(base.String()) {
+		return base.String()
+	}
+	return ""
+}
+
+// FormatGet formats the value query parameters as the type query parameter
+// for the language of the path, and the time zone of the visitor.
+func (hh *HostHandler) FormatGet(w http.ResponseWriter, r *http.Request) {
+	tag, err := language.Parse(r.PathValue("l10n"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid language tag: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	kind := query.Get("type")
+	loc, _ := visitorTimeZone(r)
+	formatter := NewFormatter(tag, loc)
+
+	values := []string{}
+	for _, value := range query["value"] {
+		formatted, err := formatter.format(kind, value, query.Get("currency"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		values = append(values, formatted)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"lang":     tag.String(),
+		"timeZone": formatter.location.String(),
+		"type":     kind,
+		"values":   values,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("cannot format %T as a number", value)
+	}
+}
+
+// toTime returns the value as a time in the location of the formatter.
+func (f *Formatter) toTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.In(f.location), nil
+	case *time.Time:
+		return v.In(f.location), nil
+	case int64:
+		return time.Unix(v, 0).In(f.location), nil
+	case int:
+		return time.Unix(int64(v), 0).In(f.location), nil
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.In(f.location), nil
+		}
+		for _, layout := range []string{time.DateTime, time.DateOnly} {
+			if t, err := time.ParseInLocation(layout, v, f.location); err == nil {
+				return t, nil
+			}
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0).In(f.location), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	default:
+		return time.Time{}, fmt.Errorf("cannot format %T as a time", value)
+	}
+}
@@ -0,0 +1,133 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestFormatter(t *testing.T) {
+	at := time.Date(2026, time.March, 7, 14, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		lang     string
+		currency string
+		date     string
+		datetime string
+		number   string
+		percent  string
+	}{
+		{lang: "en-US", currency: "$1,234.50", date: "3/7/2026", datetime: "3/7/2026 2:05 PM", number: "1,234.5", percent: "25%"},
+		{lang: "en-GB", currency: "£1,234.50", date: "07/03/2026", datetime: "07/03/2026 14:05", number: "1,234.5", percent: "25%"},
+		{lang: "de-DE", currency: "1.234,50\u00a0€", date: "7.3.2026", datetime: "7.3.2026 14:05", number: "1.234,5", percent: "25\u00a0%"},
+		{lang: "fr-FR", currency: "1\u00a0234,50\u00a0€", date: "07/03/2026", datetime: "07/03/2026 14:05", number: "1\u00a0234,5", percent: "25\u00a0%"},
+		{lang: "ja-JP", currency: "￥1,234", date: "2026/3/7", datetime: "2026/3/7 14:05", number: "1,234.5", percent: "25%"},
+		{lang: "nl-NL", currency: "€\u00a01.234,50", date: "7-3-2026", datetime: "7-3-2026 14:05", number: "1.234,5", percent: "25%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			f := NewFormatter(language.MustParse(tt.lang), nil)
+
+			got, err := f.Currency(1234.5, "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.currency, got)
+
+			got, err = f.Date(at)
+			require.NoError(t, err)
+			assert.Equal(t, tt.date, got)
+
+			got, err = f.DateTime(at.Format(time.RFC3339))
+			require.NoError(t, err)
+			assert.Equal(t, tt.datetime, got)
+
+			got, err = f.Number("1234.5")
+			require.NoError(t, err)
+			assert.Equal(t, tt.number, got)
+
+			got, err = f.Percent(0.25)
+			require.NoError(t, err)
+			assert.Equal(t, tt.percent, got)
+		})
+	}
+
+	f := NewFormatter(language.MustParse("en-US"), nil)
+
+	got, err := f.Currency(9.999, "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "€10.00", got)
+
+	got, err = f.Number(2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "2.00", got)
+
+	got, err = f.Time(at.Unix())
+	require.NoError(t, err)
+	assert.Equal(t, "2:05 PM", got)
+
+	got, err = NewFormatter(language.MustParse("eo"), nil).Date("2026-03-07")
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-07", got)
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	f = NewFormatter(language.MustParse("fr-FR"), paris)
+
+	got, err = f.DateTime(time.Date(2026, time.March, 7, 23, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "08/03/2026 00:30", got)
+
+	got, err = f.Date("2026-03-07")
+	require.NoError(t, err)
+	assert.Equal(t, "07/03/2026", got)
+
+	_, err = f.Currency(1, "XYZW")
+	assert.ErrorContains(t, err, "invalid currency")
+
+	_, err = f.Number("ten")
+	assert.ErrorContains(t, err, "invalid number")
+
+	_, err = f.Date("yesterday")
+	assert.ErrorContains(t, err, "invalid time")
+}
+
+func TestFormatGet(t *testing.T) {
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /-/format/{l10n}", hh.FormatGet)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(TimeZoneHeader, "Europe/Berlin")
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/-/format/de-DE?type=currency&currency=USD&value=9.99&value=1000")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	body := struct {
+		Lang     string   `json:"lang"`
+		TimeZone string   `json:"timeZone"`
+		Type     string   `json:"type"`
+		Values   []string `json:"values"`
+	}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "de-DE", body.Lang)
+	assert.Equal(t, "Europe/Berlin", body.TimeZone)
+	assert.Equal(t, FormatCurrency, body.Type)
+	assert.Equal(t, []string{"9,99 $", "1.000,00 $"}, body.Values)
+
+	assert.Equal(t, http.StatusBadRequest, get("/-/format/de-DE?type=weight&value=1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/-/format/de-DE?type=number&value=abc").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/-/format/x-invalid-?type=number&value=1").Code)
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/auth"
 	kh "github.com/kdex-tech/host-manager/internal/http"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
@@ -46,16 +47,24 @@ func (hh *HostHandler) applyCachingHeaders(
 	}
 
 	isPrivate := len(requirements) > 0
+	// The personalization context is assembled from the identity, the
+	// cookies and the headers of the visitor.
+	personalization := personalizationFrom(r.Context())
 
-	if isPrivate {
+	if isPrivate || personalization != nil {
 		w.Header().Set("Cache-Control", "private, no-cache, must-revalidate")
 	} else {
 		w.Header().Set("Cache-Control", "public, max-age=3600, must-revalidate")
 	}
 
-	vary := "Accept-Language"
-	if isPrivate && hh.authConfig.IsAuthEnabled() {
+	// The variant of the theme experiment is negotiated through a cookie.
+	variant := themeVariantFrom(r.Context())
+
+	vary := "Accept-Language, " + TimeZoneHeader
+	if (isPrivate && hh.authConfig.IsAuthEnabled()) || personalization != nil {
 		vary += ", Authorization, Cookie"
+	} else if variant != "" {
+		vary += ", Cookie"
 	}
 	w.Header().Set("Vary", vary)
 
@@ -63,6 +72,15 @@ func (hh *HostHandler) applyCachingHeaders(
 	if isPrivate && hh.authConfig.IsAuthEnabled() {
 		identity = ":" + hh.getUserHash(r)
 	}
+	if loc, _ := visitorTimeZone(r); loc != nil {
+		identity += ":" + loc.String()
+	}
+	if variant != "" {
+		identity += ":" + variant
+	}
+	if personalization != nil {
+		identity += ":" + personalization.hash
+	}
 
 	if lastModified.IsZero() {
 		lastModified = hh.reconcileTime
@@ -78,7 +96,8 @@ func (hh *HostHandler) applyCachingHeaders(
 		return true
 	}
 
-	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+	// The personalization context may change without the content changing.
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && personalization == nil {
 		t, err := http.ParseTime(ifModifiedSince)
 		if err == nil && !lastModified.After(t) {
 			w.WriteHeader(http.StatusNotModified)
@@ -122,12 +141,14 @@ func (hh *HostHandler) handleAuth(
 
 	if err != nil {
 		hh.log.Error(err, "authorization check failed", resource, resourceName)
+		hh.auditAccessDenied(r, r.Method, r.URL.Path, resource, resourceName, err)
 		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
 		return true
 	}
 
 	if !authorized {
 		hh.log.V(1).Info("unauthorized access attempt", resource, resourceName)
+		hh.auditAccessDenied(r, r.Method, r.URL.Path, resource, resourceName, nil)
 		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
 		return true
 	}
@@ -135,6 +156,66 @@ func (hh *HostHandler) handleAuth(
 	return false
 }
 
+// auditAccessDenied records, in the audit log of the host, the request of the
+// method and path denied access to the resource by an authorization check,
+// failing with err or not. The checks filtering what a subject is shown, e.g.
+// the navigation, are not denials.
+func (hh *HostHandler) auditAccessDenied(r *http.Request, method string, path string, resource string, resourceName string, err error) {
+	details := map[string]string{
+		"method":       method,
+		"path":         path,
+		"resource":     resource,
+		"resourceName": resourceName,
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	authContext, _ := auth.GetAuthContext(r.Context())
+	subject, _ := authContext.GetSubject()
+	hh.authConfig.Auditor.Record(hh.authConfig.WithClientIP(r), auth.AuditEvent{
+		Category: auth.AuditCategoryAccess,
+		Details:  details,
+		Event:    "access_denied",
+		Outcome:  auth.AuditOutcomeFailure,
+		Subject:  subject,
+	})
+}
+
+// handleRequiredAuth is handleAuth failing closed: the requests are denied,
+// rather than allowed, when the authentication of the host is disabled.
+func (hh *HostHandler) handleRequiredAuth(
+	r *http.Request,
+	w http.ResponseWriter,
+	resource string,
+	resourceName string,
+	requirements []kdexv1alpha1.SecurityRequirement,
+) bool {
+	if !hh.authConfig.IsAuthEnabled() {
+		hh.log.V(1).Info("authentication disabled, access denied", resource, resourceName)
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return true
+	}
+
+	return hh.handleAuth(r, w, resource, resourceName, requirements)
+}
+
+// handleAdminAuth checks the access to the admin endpoints of the host as a
+// whole, which requires the hosts:<name>:write entitlement. They are not
+// served by the hosts without authentication.
+func (hh *HostHandler) handleAdminAuth(r *http.Request, w http.ResponseWriter) bool {
+	return hh.handleRequiredAuth(
+		r,
+		w,
+		"hosts",
+		hh.Name,
+		[]kdexv1alpha1.SecurityRequirement{
+			{
+				"bearer": []string{fmt.Sprintf("hosts:%s:write", hh.Name)},
+			},
+		},
+	)
+}
+
 // Helper to strip the Domain attribute from a Set-Cookie string
 func (hh *HostHandler) stripCookieDomain(cookieStr string) string {
 	parts := strings.Split(cookieStr, ";")
@@ -180,11 +261,37 @@ func filterFromQuery(queryParams url.Values) ko.Filter {
 	return filter
 }
 
-func functionCallRequirements(
-	r *http.Request, fn *kdexv1alpha1.KDexFunction,
-) []kdexv1alpha1.SecurityRequirement {
+func operationRequirements(op *openapi.Operation) []kdexv1alpha1.SecurityRequirement {
 	var requirements []kdexv1alpha1.SecurityRequirement
 
+	if op != nil && op.Security != nil {
+		for _, s := range *op.Security {
+			requirements = append(requirements, kdexv1alpha1.SecurityRequirement(s))
+		}
+	}
+
+	return requirements
+}
+
+// functionOperation returns the operation of the function's API that matches
+// the request, or nil when none does.
+func functionOperation(
+	r *http.Request, fn *kdexv1alpha1.KDexFunction,
+) *openapi.Operation {
+	pattern := functionPattern(r, fn)
+	if pattern == "" {
+		return nil
+	}
+
+	parts := strings.Split(pattern, " ")
+	pathItem := fn.Spec.API.Paths[parts[1]]
+	return pathItem.GetOp(parts[0])
+}
+
+// functionPattern returns the pattern, e.g. "GET /api/orders/{id}", of the
+// operation of the function's API that matches the request, or "" when none
+// does.
+func functionPattern(r *http.Request, fn *kdexv1alpha1.KDexFunction) string {
 	routes := []string{}
 	for path, pathItem := range fn.Spec.API.Paths {
 		if pathItem.Connect != nil {
@@ -217,16 +324,5 @@ func functionCallRequirements(
 	}
 
 	pattern, _ := kh.DiscoverPattern(routes, r)
-	if pattern != "" {
-		parts := strings.Split(pattern, " ")
-		pathItem := fn.Spec.API.Paths[parts[1]]
-		op := pathItem.GetOp(parts[0])
-		if op != nil && op.Security != nil {
-			for _, s := range *op.Security {
-				requirements = append(requirements, kdexv1alpha1.SecurityRequirement(s))
-			}
-		}
-	}
-
-	return requirements
+	return pattern
 }
@@ -0,0 +1,345 @@
+package host
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/build"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// GitHookSecretType is the kdex.dev/secret-type of the service account
+	// secrets holding, in their "secret" key, the secret git providers sign
+	// their webhooks with.
+	GitHookSecretType = "git-webhook"
+
+	// gitHookReplayWindow is how long the deliveries of a push are accepted
+	// after the push, each once.
+	gitHookReplayWindow = 24 * time.Hour
+
+	maxGitHookPayload = 5 << 20
+	zeroCommit        = "0000000000000000000000000000000000000000"
+)
+
+// GitHookResult reports the functions rebuilt for a push.
+type GitHookResult struct {
+	Commit    string   `json:"commit,omitempty"`
+	Functions []string `json:"functions"`
+	Ref       string   `json:"ref,omitempty"`
+}
+
+// gitPush is a push event of GitHub, GitLab or Gitea.
+type gitPush struct {
+	After       string `json:"after"`
+	CheckoutSHA string `json:"checkout_sha"`
+	Commits     []struct {
+		ID        string `json:"id"`
+		Timestamp string `json:"timestamp"`
+	} `json:"commits"`
+	HeadCommit *struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"head_commit"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		GitURL   string `json:"git_url"`
+		HTMLURL  string `json:"html_url"`
+		// PushedAt is the time of the push, in seconds, of GitHub.
+		PushedAt json.RawMessage `json:"pushed_at"`
+		SSHURL   string          `json:"ssh_url"`
+	} `json:"repository"`
+}
+
+func (p *gitPush) commit() string {
+	if p.After != "" {
+		return p.After
+	}
+	return p.CheckoutSHA
+}
+
+// pushedAt returns the time of the push, that of its head commit for the
+// providers which do not send it, zero when unknown.
+func (p *gitPush) pushedAt() time.Time {
+	if seconds, err := strconv.ParseInt(string(p.Repository.PushedAt), 10, 64); err == nil {
+		return time.Unix(seconds, 0)
+	}
+	timestamp := ""
+	if p.HeadCommit != nil {
+		timestamp = p.HeadCommit.Timestamp
+	}
+	for _, commit := range p.Commits {
+		if timestamp == "" && commit.ID == p.commit() {
+			timestamp = commit.Timestamp
+		}
+	}
+	pushedAt, _ := time.Parse(time.RFC3339, timestamp)
+	return pushedAt
+}
+
+func (p *gitPush) repositories() []string {
+	repositories := []string{}
+	for _, u := range []string{
+		p.Repository.CloneURL, p.Repository.GitURL, p.Repository.HTMLURL, p.Repository.SSHURL,
+		p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL,
+	} {
+		if u != "" {
+			repositories = append(repositories, normalizeRepository(u))
+		}
+	}
+	return repositories
+}
+
+// revisions returns the revisions of the sources the push is a commit of,
+// the branch or tag name and the full ref.
+func (p *gitPush) revisions() []string {
+	revisions := []string{p.Ref}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if name, ok := strings.CutPrefix(p.Ref, prefix); ok {
+			revisions = append(revisions, name)
+		}
+	}
+	return revisions
+}
+
+// normalizeRepository reduces the https, ssh and scp-like addresses of a
+// repository to host/path.
+func normalizeRepository(repository string) string {
+	repository = strings.TrimSpace(repository)
+	if u, err := url.Parse(repository); err == nil && u.Host != "" {
+		repository = u.Hostname() + u.Path
+	} else if user, rest, ok := strings.Cut(repository, "@"); ok && !strings.Contains(user, "/") {
+		repository = strings.Replace(rest, ":", "/", 1)
+	}
+	repository = strings.TrimSuffix(strings.TrimSuffix(repository, "/"), ".git")
+	return strings.ToLower(repository)
+}
+
+// GitHookPost rebuilds the functions whose source tracks the pushed ref of
+// the repository. The commit is recorded on the functions, which are built
+// at it, and deployed functions are moved back to SourceAvailable. Signed
+// pushes are accepted once, within the gitHookReplayWindow of the push.
+func (hh *HostHandler) GitHookPost(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitHookPayload))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid git webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !verifyGitHook(r, payload, hh.gitHookSecrets()) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	if event == "" {
+		event = r.Header.Get("X-Gitea-Event")
+	}
+	if event == "" {
+		event = r.Header.Get("X-Gitlab-Event")
+	}
+	switch event {
+	case "ping":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "push", "Push Hook", "Tag Push Hook":
+	default:
+		http.Error(w, fmt.Sprintf("ignored git event %q", event), http.StatusAccepted)
+		return
+	}
+
+	push := gitPush{}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		http.Error(w, fmt.Sprintf("invalid git push: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if pushedAt := push.pushedAt(); !pushedAt.IsZero() && time.Since(pushedAt) > gitHookReplayWindow {
+		http.Error(w, fmt.Sprintf("git push of %s is too old", pushedAt.Format(time.RFC3339)), http.StatusBadRequest)
+		return
+	}
+
+	// The signature covers the payload only, which is the delivery.
+	delivery := sha256.Sum256(payload)
+	deliveryKey := "delivery:" + hex.EncodeToString(delivery[:])
+	deliveries := hh.gitHookDeliveries()
+	_, seen, _, err := deliveries.Get(r.Context(), deliveryKey)
+	if err != nil {
+		hh.log.Error(err, "failed to read git webhook deliveries")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if seen {
+		http.Error(w, "git push already delivered", http.StatusConflict)
+		return
+	}
+	if err := deliveries.Set(r.Context(), deliveryKey, push.commit()); err != nil {
+		hh.log.Error(err, "failed to record git webhook delivery")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	result := GitHookResult{Commit: push.commit(), Functions: []string{}, Ref: push.Ref}
+
+	// Deleted refs have nothing to build.
+	if result.Commit == "" || result.Commit == zeroCommit {
+		hh.writeGitHookResult(w, result)
+		return
+	}
+
+	hh.mu.RLock()
+	functions := hh.functions
+	hh.mu.RUnlock()
+
+	for _, fn := range gitHookFunctions(functions, &push) {
+		if err := hh.rebuildFunction(r.Context(), fn, result.Commit); err != nil {
+			hh.log.Error(err, "failed to rebuild function", "function", fn.Name, "commit", result.Commit)
+			// The provider redelivers the push
+			_ = deliveries.Delete(r.Context(), deliveryKey)
+			http.Error(w, fmt.Sprintf("failed to rebuild function %s", fn.Name), http.StatusInternalServerError)
+			return
+		}
+		result.Functions = append(result.Functions, fn.Name)
+	}
+
+	hh.log.Info("git push", "ref", push.Ref, "commit", result.Commit, "functions", result.Functions)
+
+	hh.writeGitHookResult(w, result)
+}
+
+// gitHookFunctions returns the functions built from the pushed ref of the
+// repository. Functions built from a commit, or from an executable, are not
+// affected by pushes.
+func gitHookFunctions(functions []kdexv1alpha1.KDexFunction, push *gitPush) []kdexv1alpha1.KDexFunction {
+	repositories := push.repositories()
+	revisions := push.revisions()
+
+	matches := []kdexv1alpha1.KDexFunction{}
+	for _, fn := range functions {
+		if fn.Spec.Origin.Executable != nil || fn.Status.Source == nil {
+			continue
+		}
+		source := fn.Status.Source
+		if !slices.Contains(repositories, normalizeRepository(source.Repository)) || !slices.Contains(revisions, source.Revision) {
+			continue
+		}
+		matches = append(matches, fn)
+	}
+	return matches
+}
+
+func (hh *HostHandler) rebuildFunction(ctx context.Context, fn kdexv1alpha1.KDexFunction, commit string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		function := &kdexv1alpha1.KDexFunction{}
+		if err := hh.client.Get(ctx, client.ObjectKeyFromObject(&fn), function); err != nil {
+			return err
+		}
+
+		if function.Status.Source == nil {
+			return nil
+		}
+		if function.Status.Attributes == nil {
+			function.Status.Attributes = map[string]string{}
+		}
+		if function.Status.Attributes[build.SourceCommitAttribute] == commit {
+			return nil
+		}
+		function.Status.Attributes[build.SourceCommitAttribute] = commit
+
+		switch function.Status.State {
+		case kdexv1alpha1.KDexFunctionStateExecutableAvailable,
+			kdexv1alpha1.KDexFunctionStateFunctionDeployed,
+			kdexv1alpha1.KDexFunctionStateReady:
+			function.Status.State = kdexv1alpha1.KDexFunctionStateSourceAvailable
+			function.Status.Detail = fmt.Sprintf("%v: %s pushed to %s@%s", kdexv1alpha1.KDexFunctionStateSourceAvailable, commit, function.Status.Source.Repository, function.Status.Source.Revision)
+		}
+
+		return hh.client.Status().Update(ctx, function)
+	})
+}
+
+func (hh *HostHandler) gitHookDeliveries() cache.Cache {
+	return hh.cacheManager.GetCache("git-hook-deliveries", cache.CacheOptions{
+		TTL:      new(gitHookReplayWindow),
+		Uncycled: true,
+	})
+}
+
+// gitHookSecrets returns the webhook secrets of the service account of the
+// host.
+func (hh *HostHandler) gitHookSecrets() [][]byte {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	return hh.gitHookSecretsLocked()
+}
+
+func (hh *HostHandler) gitHookSecretsLocked() [][]byte {
+	if hh.host == nil {
+		return nil
+	}
+	secrets := [][]byte{}
+	for _, s := range hh.host.ServiceAccountSecrets.Filter(func(s corev1.Secret) bool {
+		return s.Annotations["kdex.dev/secret-type"] == GitHookSecretType
+	}) {
+		if secret := s.Data["secret"]; len(secret) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// verifyGitHook checks the HMAC-SHA256 signature of GitHub and Gitea
+// webhooks, or the token of GitLab webhooks, against the secrets.
+func verifyGitHook(r *http.Request, payload []byte, secrets [][]byte) bool {
+	signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if signature == "" {
+		signature = r.Header.Get("X-Gitea-Signature")
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+
+	for _, secret := range secrets {
+		if signature != "" {
+			expected, err := hex.DecodeString(signature)
+			if err != nil {
+				return false
+			}
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(payload)
+			if hmac.Equal(mac.Sum(nil), expected) {
+				return true
+			}
+		} else if token != "" && subtle.ConstantTimeCompare([]byte(token), secret) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (hh *HostHandler) writeGitHookResult(w http.ResponseWriter, result GitHookResult) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		hh.log.Error(err, "failed to encode git webhook result")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
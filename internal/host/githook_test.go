@@ -0,0 +1,223 @@
+package host
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/build"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const githubPush = `{
+  "ref": "refs/heads/main",
+  "after": "4f1c2a9d3e8b7c6a5f4e3d2c1b0a9f8e7d6c5b4a",
+  "repository": {
+    "clone_url": "https://github.com/acme/checkout.git",
+    "ssh_url": "git@github.com:acme/checkout.git"
+  }
+}`
+
+func TestNormalizeRepository(t *testing.T) {
+	for _, repository := range []string{
+		"https://github.com/acme/checkout",
+		"https://github.com/acme/checkout.git",
+		"https://user@GitHub.com/Acme/Checkout/",
+		"ssh://git@github.com:22/acme/checkout.git",
+		"git@github.com:acme/checkout.git",
+	} {
+		assert.Equal(t, "github.com/acme/checkout", normalizeRepository(repository), repository)
+	}
+}
+
+func TestVerifyGitHook(t *testing.T) {
+	payload := []byte(githubPush)
+	secrets := [][]byte{[]byte("old"), []byte("s3cret")}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	request := func(header, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/-/hooks/git", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+
+	assert.True(t, verifyGitHook(request("X-Hub-Signature-256", "sha256="+signature), payload, secrets))
+	assert.True(t, verifyGitHook(request("X-Gitea-Signature", signature), payload, secrets))
+	assert.True(t, verifyGitHook(request("X-Gitlab-Token", "s3cret"), payload, secrets))
+
+	assert.False(t, verifyGitHook(request("", ""), payload, secrets))
+	assert.False(t, verifyGitHook(request("X-Hub-Signature-256", "sha256=zz"), payload, secrets))
+	assert.False(t, verifyGitHook(request("X-Hub-Signature-256", "sha256="+signature), []byte("{}"), secrets))
+	assert.False(t, verifyGitHook(request("X-Gitlab-Token", "wrong"), payload, secrets))
+	assert.False(t, verifyGitHook(request("X-Gitlab-Token", "s3cret"), payload, nil))
+}
+
+func TestGitPush_pushedAt(t *testing.T) {
+	pushedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payload string
+		want    time.Time
+	}{
+		{
+			name:    "github",
+			payload: fmt.Sprintf(`{"repository": {"pushed_at": %d}, "head_commit": {"timestamp": "2026-02-01T12:00:00Z"}}`, pushedAt.Unix()),
+			want:    pushedAt,
+		},
+		{
+			name:    "gitea",
+			payload: `{"head_commit": {"timestamp": "2026-03-01T13:00:00+01:00"}}`,
+			want:    pushedAt,
+		},
+		{
+			name:    "gitlab",
+			payload: `{"checkout_sha": "b", "commits": [{"id": "a", "timestamp": "2026-02-01T12:00:00Z"}, {"id": "b", "timestamp": "2026-03-01T12:00:00Z"}]}`,
+			want:    pushedAt,
+		},
+		{
+			name:    "unknown",
+			payload: `{"after": "b", "head_commit": null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			push := gitPush{}
+			require.NoError(t, json.Unmarshal([]byte(tt.payload), &push))
+			assert.True(t, tt.want.Equal(push.pushedAt()), push.pushedAt())
+		})
+	}
+}
+
+func TestGitHookFunctions(t *testing.T) {
+	function := func(name, repository, revision string) kdexv1alpha1.KDexFunction {
+		fn := kdexv1alpha1.KDexFunction{}
+		fn.Name = name
+		fn.Status.Source = &kdexv1alpha1.Source{Repository: repository, Revision: revision}
+		return fn
+	}
+
+	executable := function("executable", "https://github.com/acme/checkout", "main")
+	executable.Spec.Origin.Executable = &kdexv1alpha1.Executable{}
+
+	functions := []kdexv1alpha1.KDexFunction{
+		function("checkout", "git@github.com:acme/checkout.git", "main"),
+		function("checkout-full-ref", "https://github.com/acme/checkout", "refs/heads/main"),
+		function("checkout-release", "https://github.com/acme/checkout", "release"),
+		function("cart", "https://github.com/acme/cart", "main"),
+		executable,
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending"}},
+	}
+
+	push := gitPush{}
+	require.NoError(t, json.Unmarshal([]byte(githubPush), &push))
+
+	names := []string{}
+	for _, fn := range gitHookFunctions(functions, &push) {
+		names = append(names, fn.Name)
+	}
+	assert.Equal(t, []string{"checkout", "checkout-full-ref"}, names)
+}
+
+func TestGitHookPost(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	deployed := &kdexv1alpha1.KDexFunction{ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "kdex"}}
+	deployed.Status.State = kdexv1alpha1.KDexFunctionStateReady
+	deployed.Status.Source = &kdexv1alpha1.Source{Repository: "https://github.com/acme/checkout", Revision: "main"}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(deployed).
+		WithStatusSubresource(deployed).
+		Build()
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(c, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.host = &kdexv1alpha1.KDexHostSpec{
+		ServiceAccountSecrets: kdexv1alpha1.ServiceAccountSecrets{{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "git-webhook",
+				Annotations: map[string]string{"kdex.dev/secret-type": GitHookSecretType},
+			},
+			Data: map[string][]byte{"secret": []byte("s3cret")},
+		}},
+	}
+	hh.functions = []kdexv1alpha1.KDexFunction{*deployed}
+
+	post := func(event, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/-/hooks/git", strings.NewReader(body))
+		r.Header.Set("X-Gitlab-Event", event)
+		r.Header.Set("X-Gitlab-Token", token)
+		w := httptest.NewRecorder()
+		hh.GitHookPost(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("Push Hook", "wrong", githubPush).Code)
+	assert.Equal(t, http.StatusNoContent, post("ping", "s3cret", "{}").Code)
+	assert.Equal(t, http.StatusAccepted, post("Merge Request Hook", "s3cret", "{}").Code)
+
+	w := post("Push Hook", "s3cret", githubPush)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	result := GitHookResult{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "4f1c2a9d3e8b7c6a5f4e3d2c1b0a9f8e7d6c5b4a", result.Commit)
+	assert.Equal(t, []string{"checkout"}, result.Functions)
+
+	updated := &kdexv1alpha1.KDexFunction{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(deployed), updated))
+	assert.Equal(t, kdexv1alpha1.KDexFunctionStateSourceAvailable, updated.Status.State)
+	assert.Equal(t, result.Commit, updated.Status.Attributes[build.SourceCommitAttribute])
+	assert.Equal(t, "main", updated.Status.Source.Revision)
+
+	// The signed pushes are accepted once, shortly after the push
+	assert.Equal(t, http.StatusConflict, post("Push Hook", "s3cret", githubPush).Code)
+	old := strings.Replace(githubPush, `"ssh_url"`, fmt.Sprintf(`"pushed_at": %d, "ssh_url"`, time.Now().Add(-2*gitHookReplayWindow).Unix()), 1)
+	assert.Equal(t, http.StatusBadRequest, post("Push Hook", "s3cret", old).Code)
+
+	deletion := strings.Replace(githubPush, result.Commit, zeroCommit, 1)
+	w = post("Push Hook", "s3cret", deletion)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Empty(t, result.Functions)
+}
+
+func TestGitHookHandler(t *testing.T) {
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), nil)
+	hh.host = &kdexv1alpha1.KDexHostSpec{}
+
+	registeredPaths := map[string]ko.PathInfo{}
+	hh.gitHookHandler(http.NewServeMux(), registeredPaths)
+	assert.Empty(t, registeredPaths)
+
+	hh.host.ServiceAccountSecrets = kdexv1alpha1.ServiceAccountSecrets{{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"kdex.dev/secret-type": GitHookSecretType}},
+		Data:       map[string][]byte{"secret": []byte("s3cret")},
+	}}
+	hh.gitHookHandler(http.NewServeMux(), registeredPaths)
+	assert.Contains(t, registeredPaths, "/-/hooks/git")
+}
@@ -0,0 +1,225 @@
+package host
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// MachineTranslatedAnnotation set to "true" on a translation marks its
+	// values as machine translated. They are replaced by the approved strings
+	// of the translation memory and dropped when they break the glossary.
+	MachineTranslatedAnnotation = "kdex.dev/machine-translated"
+	// TranslationRoleAnnotation makes a translation the glossary or the
+	// translation memory of the host instead of a set of translated keys.
+	//
+	// The keys of a glossary are terms and its values their preferred
+	// translation in each language. Terms of the default language without a
+	// preferred translation must be kept as is.
+	//
+	// The keys of a translation memory are strings of the default language
+	// and its values their approved translation in each language.
+	TranslationRoleAnnotation = "kdex.dev/translation-role"
+
+	TranslationRoleGlossary = "glossary"
+	TranslationRoleMemory   = "memory"
+)
+
+// Kinds of TranslationViolation.
+const (
+	ViolationGlossary = "glossary"
+	ViolationMemory   = "memory"
+)
+
+// TranslationViolation is a translated value which does not follow the
+// glossary or the translation memory of the host.
+type TranslationViolation struct {
+	// Blocked is set when the value was machine translated and was not
+	// served.
+	Blocked  bool   `json:"blocked,omitempty"`
+	Expected string `json:"expected"`
+	Key      string `json:"key"`
+	Kind     string `json:"kind"`
+	Lang     string `json:"lang"`
+	Message  string `json:"message"`
+	// Replaced is set when the machine translated value was replaced by the
+	// approved string of the translation memory.
+	Replaced    bool   `json:"replaced,omitempty"`
+	Translation string `json:"translation"`
+}
+
+// AddOrUpdateGlossary sets the glossary of the given name.
+func (hh *HostHandler) AddOrUpdateGlossary(name string, glossary *kdexv1alpha1.KDexTranslationSpec) {
+	if glossary == nil {
+		return
+	}
+	hh.log.V(3).Info("add or update glossary", "glossary", name)
+	hh.mu.Lock()
+	hh.removeTranslationLocked(name)
+	hh.glossaries[name] = *glossary
+	hh.mu.Unlock()
+	hh.RebuildMux() // Called after lock is released
+}
+
+// AddOrUpdateMachineTranslation sets the translation of the given name whose
+// values were machine translated.
+func (hh *HostHandler) AddOrUpdateMachineTranslation(name string, translation *kdexv1alpha1.KDexTranslationSpec) {
+	if translation == nil {
+		return
+	}
+	hh.log.V(3).Info("add or update machine translation", "translation", name)
+	hh.mu.Lock()
+	hh.removeTranslationLocked(name)
+	hh.translationResources[name] = *translation
+	hh.machineTranslations[name] = true
+	hh.mu.Unlock()
+	hh.RebuildMux() // Called after lock is released
+}
+
+// AddOrUpdateTranslationMemory sets the translation memory of the given name.
+func (hh *HostHandler) AddOrUpdateTranslationMemory(name string, memory *kdexv1alpha1.KDexTranslationSpec) {
+	if memory == nil {
+		return
+	}
+	hh.log.V(3).Info("add or update translation memory", "memory", name)
+	hh.mu.Lock()
+	hh.removeTranslationLocked(name)
+	hh.translationMemories[name] = *memory
+	hh.mu.Unlock()
+	hh.RebuildMux() // Called after lock is released
+}
+
+// removeTranslationLocked forgets the resource of the given name whatever
+// its role.
+func (hh *HostHandler) removeTranslationLocked(name string) {
+	delete(hh.glossaries, name)
+	delete(hh.machineTranslations, name)
+	delete(hh.translationMemories, name)
+	delete(hh.translationResources, name)
+}
+
+// reviewTranslations checks the translated values of the resources against
+// the glossaries and translation memories. It returns the resources with the
+// machine translated values replaced or dropped, and the violations found.
+func reviewTranslations(
+	defaultLanguage string,
+	resources map[string]kdexv1alpha1.KDexTranslationSpec,
+	machineTranslated map[string]bool,
+	glossaries map[string]kdexv1alpha1.KDexTranslationSpec,
+	memories map[string]kdexv1alpha1.KDexTranslationSpec,
+) (map[string]kdexv1alpha1.KDexTranslationSpec, []TranslationViolation) {
+	defaultTag := language.Make(defaultLanguage).String()
+	glossary := byLanguage(glossaries)
+	memory := byLanguage(memories)
+
+	if len(glossary) == 0 && len(memory) == 0 {
+		return resources, nil
+	}
+
+	sources := byLanguage(resources)[defaultTag]
+	protected := glossary[defaultTag]
+
+	violations := []TranslationViolation{}
+	reviewed := make(map[string]kdexv1alpha1.KDexTranslationSpec, len(resources))
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		resource := resources[name]
+		machine := machineTranslated[name]
+
+		out := kdexv1alpha1.KDexTranslationSpec{Translations: make([]kdexv1alpha1.Translation, 0, len(resource.Translations))}
+		for _, tr := range resource.Translations {
+			lang := language.Make(tr.Lang).String()
+			if lang == defaultTag {
+				out.Translations = append(out.Translations, tr)
+				continue
+			}
+
+			terms := glossaryTerms(glossary[lang], protected)
+			keysAndValues := make(map[string]string, len(tr.KeysAndValues))
+			for _, key := range slices.Sorted(maps.Keys(tr.KeysAndValues)) {
+				value := tr.KeysAndValues[key]
+				source, ok := sources[key]
+				if !ok {
+					keysAndValues[key] = value
+					continue
+				}
+
+				if approved, ok := memory[lang][source]; ok && approved != value {
+					violations = append(violations, TranslationViolation{
+						Expected:    approved,
+						Key:         key,
+						Kind:        ViolationMemory,
+						Lang:        lang,
+						Message:     "translation differs from the approved string of the translation memory",
+						Replaced:    machine,
+						Translation: value,
+					})
+					if machine {
+						value = approved
+					}
+				}
+
+				blocked := false
+				for _, term := range slices.Sorted(maps.Keys(terms)) {
+					expected := terms[term]
+					if !containsFold(source, term) || containsFold(value, expected) {
+						continue
+					}
+					violations = append(violations, TranslationViolation{
+						Blocked:     machine,
+						Expected:    expected,
+						Key:         key,
+						Kind:        ViolationGlossary,
+						Lang:        lang,
+						Message:     fmt.Sprintf("glossary term %q must be translated as %q", term, expected),
+						Translation: value,
+					})
+					blocked = blocked || machine
+				}
+
+				if !blocked {
+					keysAndValues[key] = value
+				}
+			}
+
+			out.Translations = append(out.Translations, kdexv1alpha1.Translation{Lang: tr.Lang, KeysAndValues: keysAndValues})
+		}
+		reviewed[name] = out
+	}
+
+	return reviewed, violations
+}
+
+// glossaryTerms returns the expected translation of each term in a language:
+// its preferred translation, or the term itself when it is protected.
+func glossaryTerms(preferred map[string]string, protected map[string]string) map[string]string {
+	terms := make(map[string]string, len(preferred)+len(protected))
+	for term := range protected {
+		terms[term] = term
+	}
+	maps.Copy(terms, preferred)
+	return terms
+}
+
+// byLanguage merges the keys and values of the resources per language tag.
+func byLanguage(resources map[string]kdexv1alpha1.KDexTranslationSpec) map[string]map[string]string {
+	out := map[string]map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		for _, tr := range resources[name].Translations {
+			lang := language.Make(tr.Lang).String()
+			if out[lang] == nil {
+				out[lang] = map[string]string{}
+			}
+			maps.Copy(out[lang], tr.KeysAndValues)
+		}
+	}
+	return out
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,156 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func Test_reviewTranslations(t *testing.T) {
+	glossaries := map[string]kdexv1alpha1.KDexTranslationSpec{
+		"glossary": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"KDex": "KDex"}},
+				{Lang: "fr", KeysAndValues: map[string]string{"cart": "panier"}},
+			},
+		},
+	}
+	memories := map[string]kdexv1alpha1.KDexTranslationSpec{
+		"memory": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "fr", KeysAndValues: map[string]string{"Sign in": "Se connecter"}},
+			},
+		},
+	}
+	resources := map[string]kdexv1alpha1.KDexTranslationSpec{
+		"messages": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{
+					"brand":  "Welcome to KDex",
+					"cart":   "Your cart",
+					"signin": "Sign in",
+				}},
+				{Lang: "fr", KeysAndValues: map[string]string{
+					"brand":  "Bienvenue sur KDex",
+					"cart":   "Votre chariot",
+					"signin": "Connexion",
+				}},
+			},
+		},
+		"machine": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "de", KeysAndValues: map[string]string{
+					"brand": "Willkommen bei KDex",
+				}},
+				{Lang: "fr", KeysAndValues: map[string]string{
+					"brand":  "Bienvenue sur KDéx",
+					"signin": "Connexion",
+				}},
+			},
+		},
+	}
+
+	t.Run("approved translations are flagged", func(t *testing.T) {
+		reviewed, violations := reviewTranslations("en", resources, map[string]bool{}, glossaries, memories)
+
+		assert.Equal(t, resources["messages"], reviewed["messages"])
+		assert.ElementsMatch(t, []TranslationViolation{
+			{
+				Expected:    "panier",
+				Key:         "cart",
+				Kind:        ViolationGlossary,
+				Lang:        "fr",
+				Message:     `glossary term "cart" must be translated as "panier"`,
+				Translation: "Votre chariot",
+			},
+			{
+				Expected:    "Se connecter",
+				Key:         "signin",
+				Kind:        ViolationMemory,
+				Lang:        "fr",
+				Message:     "translation differs from the approved string of the translation memory",
+				Translation: "Connexion",
+			},
+			{
+				Expected:    "KDex",
+				Key:         "brand",
+				Kind:        ViolationGlossary,
+				Lang:        "fr",
+				Message:     `glossary term "KDex" must be translated as "KDex"`,
+				Translation: "Bienvenue sur KDéx",
+			},
+			{
+				Expected:    "Se connecter",
+				Key:         "signin",
+				Kind:        ViolationMemory,
+				Lang:        "fr",
+				Message:     "translation differs from the approved string of the translation memory",
+				Translation: "Connexion",
+			},
+		}, violations)
+	})
+
+	t.Run("machine translations are replaced or blocked", func(t *testing.T) {
+		reviewed, violations := reviewTranslations("en", resources, map[string]bool{"machine": true}, glossaries, memories)
+
+		assert.Equal(t, []kdexv1alpha1.Translation{
+			{Lang: "de", KeysAndValues: map[string]string{"brand": "Willkommen bei KDex"}},
+			{Lang: "fr", KeysAndValues: map[string]string{"signin": "Se connecter"}},
+		}, reviewed["machine"].Translations)
+
+		blocked, replaced := 0, 0
+		for _, v := range violations {
+			if v.Blocked {
+				blocked++
+				assert.Equal(t, "brand", v.Key)
+			}
+			if v.Replaced {
+				replaced++
+				assert.Equal(t, "signin", v.Key)
+			}
+		}
+		assert.Equal(t, 1, blocked)
+		assert.Equal(t, 1, replaced)
+	})
+
+	t.Run("without glossary nor memory", func(t *testing.T) {
+		reviewed, violations := reviewTranslations("en", resources, map[string]bool{"machine": true}, nil, nil)
+
+		assert.Equal(t, resources, reviewed)
+		assert.Empty(t, violations)
+	})
+}
+
+func TestTranslations_ReportViolations(t *testing.T) {
+	resources := map[string]kdexv1alpha1.KDexTranslationSpec{
+		"messages": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"brand": "KDex"}},
+				{Lang: "fr", KeysAndValues: map[string]string{"brand": "KDéx"}},
+			},
+		},
+	}
+	glossaries := map[string]kdexv1alpha1.KDexTranslationSpec{
+		"glossary": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"KDex": "KDex"}},
+			},
+		},
+	}
+
+	reviewed, violations := reviewTranslations("en", resources, map[string]bool{"messages": true}, glossaries, nil)
+	translations, err := NewTranslations("en", reviewed)
+	require.NoError(t, err)
+	translations.violations = violations
+
+	assert.Equal(t, []string{"brand"}, translations.Missing(language.French))
+
+	report := translations.Report()
+	require.Len(t, report.Languages, 2)
+	assert.Equal(t, "fr", report.Languages[1].Lang)
+	require.Len(t, report.Languages[1].Violations, 1)
+	assert.True(t, report.Languages[1].Violations[0].Blocked)
+}
@@ -0,0 +1,190 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/graphql"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+)
+
+const maxGraphQLRequestBytes = 1 << 20
+
+// GraphQLHandler serves the schema generated from the function operations
+// on GET and executes GraphQL requests on POST.
+func (hh *HostHandler) GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	hh.mu.RLock()
+	schema := hh.graphqlSchema
+	mux := hh.Mux
+	hh.mu.RUnlock()
+
+	if schema == nil || mux == nil {
+		http.Error(w, "GraphQL is disabled.", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(schema.SDL()))
+		return
+	}
+
+	var req graphql.Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLRequestBytes)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid GraphQL request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resp := schema.Execute(r.Context(), req, &graphqlResolver{handler: mux, request: r})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		hh.log.Error(err, "failed to encode GraphQL response")
+	}
+}
+
+// buildGraphQLSchema returns the schema of the function paths or nil when
+// GraphQL is disabled.
+func (hh *HostHandler) buildGraphQLSchema(registeredPaths map[string]ko.PathInfo) *graphql.Schema {
+	if !hh.GraphQL {
+		return nil
+	}
+	return graphql.Build(registeredPaths)
+}
+
+// graphqlResolver resolves root fields by dispatching a request derived from
+// the GraphQL request to the host mux. The function is therefore called
+// through the same proxy as a direct request, with the caller's identity and
+// the function's signing, breaker and timeout.
+type graphqlResolver struct {
+	handler http.Handler
+	request *http.Request
+}
+
+func (gr *graphqlResolver) Resolve(ctx context.Context, field *graphql.Field, args map[string]any) (any, error) {
+	path := field.Path
+	query := url.Values{}
+	var body []byte
+
+	for _, arg := range field.Args {
+		value, ok := args[arg.Name]
+		if !ok || value == nil {
+			continue
+		}
+
+		switch arg.In {
+		case graphql.ArgInPath:
+			s := fmt.Sprint(value)
+			if strings.Contains(path, "{"+arg.Param+"...}") {
+				segments, err := escapePathSegments(arg.Name, s)
+				if err != nil {
+					return nil, err
+				}
+				path = strings.Replace(path, "{"+arg.Param+"...}", segments, 1)
+				continue
+			}
+			if s == "." || s == ".." {
+				return nil, fmt.Errorf("invalid argument %s: %q is not a path segment", arg.Name, s)
+			}
+			path = strings.Replace(path, "{"+arg.Param+"}", url.PathEscape(s), 1)
+		case graphql.ArgInQuery:
+			if list, ok := value.([]any); ok {
+				for _, item := range list {
+					query.Add(arg.Param, fmt.Sprint(item))
+				}
+				continue
+			}
+			query.Add(arg.Param, fmt.Sprint(value))
+		case graphql.ArgInBody:
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		}
+	}
+
+	target, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = query.Encode()
+
+	sub := gr.request.Clone(ctx)
+	sub.Method = field.Method
+	sub.URL = target
+	sub.RequestURI = sub.URL.RequestURI()
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+	sub.ContentLength = int64(len(body))
+	sub.Header.Set("Accept", "application/json")
+	sub.Header.Del("Accept-Encoding")
+	sub.Header.Del("Content-Length")
+	if body != nil {
+		sub.Header.Set("Content-Type", "application/json")
+	} else {
+		sub.Header.Del("Content-Type")
+	}
+
+	rw := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+	gr.handler.ServeHTTP(rw, sub)
+
+	if rw.status >= 400 {
+		return nil, fmt.Errorf("%s %s: %d %s", field.Method, path, rw.status, http.StatusText(rw.status))
+	}
+
+	if rw.body.Len() == 0 {
+		return nil, nil
+	}
+
+	var result any
+	if err := json.Unmarshal(rw.body.Bytes(), &result); err != nil {
+		return rw.body.String(), nil
+	}
+
+	return result, nil
+}
+
+// bufferedResponseWriter collects the response of a sub-request.
+type bufferedResponseWriter struct {
+	body        bytes.Buffer
+	header      http.Header
+	status      int
+	wroteHeader bool
+}
+
+func (bw *bufferedResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.status = code
+}
+
+// escapePathSegments escapes each segment of the value of a wildcard path
+// argument. The dot segments are refused so that the argument cannot move the
+// request out of the path of the function.
+func escapePathSegments(name, value string) (string, error) {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid argument %s: %q has a dot segment", name, value)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
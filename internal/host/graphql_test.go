@@ -0,0 +1,147 @@
+package host
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostHandler_GraphQLHandler(t *testing.T) {
+	var received []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/items/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Authorization")+" "+string(body))
+
+		switch {
+		case r.URL.Path == "/api/items/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"new"}`))
+		default:
+			_, _ = w.Write([]byte(`{"id":"a b","secret":"x"}`))
+		}
+	})
+
+	paths := map[string]ko.PathInfo{
+		"/api/items": {
+			API: ko.OpenAPI{
+				BasePath: "/api/items",
+				Paths: map[string]ko.PathItem{
+					"/api/items/{id}": {
+						Get: &openapi.Operation{
+							OperationID: "get-item",
+							Parameters: openapi.Parameters{
+								ko.PathParam("id", ""),
+								ko.QueryParam("expand", ""),
+							},
+						},
+					},
+					"/api/items/files/{path...}": {
+						Get: &openapi.Operation{
+							OperationID: "get-file",
+							Parameters:  openapi.Parameters{ko.WildcardPathParam("path", "")},
+						},
+					},
+					"/api/items/": {
+						Post: &openapi.Operation{OperationID: "create-item"},
+					},
+				},
+			},
+			Type: ko.FunctionPathType,
+		},
+	}
+
+	hh := &HostHandler{GraphQL: true, Mux: mux, log: logr.Discard()}
+	hh.graphqlSchema = hh.buildGraphQLSchema(paths)
+
+	t.Run("schema", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		hh.GraphQLHandler(w, httptest.NewRequest(http.MethodGet, "/-/graphql", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "getItem(id: String!, expand: String): JSON")
+		assert.Contains(t, w.Body.String(), "createItem(input: JSON): JSON")
+	})
+
+	t.Run("execute", func(t *testing.T) {
+		received = nil
+
+		r := httptest.NewRequest(http.MethodPost, "/-/graphql", strings.NewReader(`{
+			"query": "query ($id: String!) { a: getItem(id: $id, expand: [\"x\", \"y\"]) b: getItem(id: \"missing\") } ",
+			"variables": {"id": "a b"}
+		}`))
+		r.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		hh.GraphQLHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{
+			"data": {"a": {"id": "a b", "secret": "x"}, "b": null},
+			"errors": [{"message": "GET /api/items/missing: 404 Not Found", "path": ["b"]}]
+		}`, w.Body.String())
+		assert.Equal(t, []string{
+			"GET /api/items/a%20b?expand=x&expand=y Bearer token ",
+			"GET /api/items/missing Bearer token ",
+		}, received)
+	})
+
+	t.Run("mutation", func(t *testing.T) {
+		received = nil
+
+		r := httptest.NewRequest(http.MethodPost, "/-/graphql", strings.NewReader(
+			`{"query": "mutation { createItem(input: {name: \"n\"}) }"}`,
+		))
+		w := httptest.NewRecorder()
+		hh.GraphQLHandler(w, r)
+
+		assert.JSONEq(t, `{"data": {"createItem": {"id": "new"}}}`, w.Body.String())
+		assert.Equal(t, []string{`POST /api/items/  {"name":"n"}`}, received)
+	})
+
+	t.Run("path arguments", func(t *testing.T) {
+		received = nil
+
+		r := httptest.NewRequest(http.MethodPost, "/-/graphql", strings.NewReader(
+			`{"query": "{ a: getFile(path: \"docs/a b?c#d\") b: getFile(path: \"docs/../../admin\") c: getItem(id: \"..\") }"}`,
+		))
+		w := httptest.NewRecorder()
+		hh.GraphQLHandler(w, r)
+
+		assert.JSONEq(t, `{
+			"data": {"a": {"id": "a b", "secret": "x"}, "b": null, "c": null},
+			"errors": [
+				{"message": "invalid argument path: \"docs/../../admin\" has a dot segment", "path": ["b"]},
+				{"message": "invalid argument id: \"..\" is not a path segment", "path": ["c"]}
+			]
+		}`, w.Body.String())
+		assert.Equal(t, []string{"GET /api/items/files/docs/a%20b%3Fc%23d  "}, received)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		hh.GraphQLHandler(w, httptest.NewRequest(http.MethodPost, "/-/graphql", strings.NewReader("{")))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := &HostHandler{Mux: mux, log: logr.Discard()}
+		disabled.graphqlSchema = disabled.buildGraphQLSchema(paths)
+
+		w := httptest.NewRecorder()
+		disabled.GraphQLHandler(w, httptest.NewRequest(http.MethodGet, "/-/graphql", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/a11y"
+	"github.com/kdex-tech/host-manager/internal/archive"
 	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/breaker"
 	kdexhttp "github.com/kdex-tech/host-manager/internal/http"
+	"github.com/kdex-tech/host-manager/internal/linkcheck"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	"github.com/kdex-tech/host-manager/internal/utils"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
@@ -17,7 +23,7 @@ func (hh *HostHandler) addHandlerAndRegister(mux *http.ServeMux, pr pageRender,
 	finalPath := toFinalPath(pr.ph.BasePath())
 	label := pr.ph.Label()
 
-	handler := hh.pageHandlerFunc(pr.ph, translations)
+	handler := hh.withPageMetrics("page", pr.ph.Name, hh.pageHandlerFunc(pr.ph, translations))
 
 	regFunc := func(p string, n string, l string, pattern bool, localized bool) {
 		reqs := hh.convertRequirements(pr.ph.Page.Security)
@@ -90,6 +96,244 @@ func (hh *HostHandler) addHandlerAndRegister(mux *http.ServeMux, pr pageRender,
 	}
 }
 
+func (hh *HostHandler) a11yHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.a11yMode == "" {
+		return
+	}
+
+	const path = "/-/admin/a11y"
+	mux.HandleFunc("GET "+path, hh.A11yReportGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Reports the accessibility violations found in the latest render of each page in each language.",
+					Get: &openapi.Operation{
+						Description: "GET the accessibility audit of the pages",
+						OperationID: "a11y-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("page", "The name of the page binding to report"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON accessibility report"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("mode", openapi.NewStringSchema().WithEnum(A11yAuditReport, A11yAuditStrict)).
+										WithProperty("pages", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("lang", openapi.NewStringSchema()).
+												WithProperty("page", openapi.NewStringSchema()).
+												WithProperty("violations", openapi.NewArraySchema().WithItems(
+													openapi.NewObjectSchema().
+														WithProperty("impact", openapi.NewStringSchema().WithEnum(
+															a11y.ImpactCritical, a11y.ImpactSerious, a11y.ImpactModerate, a11y.ImpactMinor,
+														)).
+														WithProperty("message", openapi.NewStringSchema()).
+														WithProperty("rule", openapi.NewStringSchema()).
+														WithProperty("target", openapi.NewStringSchema()),
+												)),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+						),
+						Summary: "Accessibility audit",
+						Tags:    []string{"system", "admin"},
+					},
+					Summary: "Accessibility audit of the pages",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+// acmeHandler is always registered so that the HTTP-01 challenges never fall
+// through to the pages or the sniffer, even before their solvers are known.
+func (hh *HostHandler) acmeHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = ACMEChallengePrefix + "{token}"
+	mux.HandleFunc("GET "+path, hh.ACMEChallengeGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: ACMEChallengePrefix,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Passes the ACME HTTP-01 challenges through to the solvers of the certificate issuers.",
+					Get: &openapi.Operation{
+						Description: "GET the key authorization of an HTTP-01 challenge from its solver",
+						OperationID: "acme-challenge-get",
+						Parameters: openapi.Parameters{
+							ko.PathParam("token", "The token of the challenge"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("Key authorization of the challenge"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewStringSchema(),
+									[]string{"text/plain"},
+								),
+							}),
+							openapi.WithName("404", &openapi.Response{
+								Description: new("No solver for the challenge"),
+							}),
+						),
+						Summary: "ACME HTTP-01 challenge",
+						Tags:    []string{"system", "well-known"},
+					},
+					Summary: "ACME HTTP-01 challenge",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) archiveHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.archive == nil {
+		return
+	}
+
+	const path = "/-/admin/archive"
+	const versionPath = path + "/{page}/{lang}/{sha256}"
+	const metadataPath = versionPath + "/metadata"
+	const legalHoldPath = versionPath + "/legal-hold"
+	mux.HandleFunc("GET "+path, hh.ArchiveGet)
+	mux.HandleFunc("GET "+versionPath, hh.ArchiveVersionGet)
+	mux.HandleFunc("GET "+metadataPath, hh.ArchiveRecordGet)
+	mux.HandleFunc("PUT "+legalHoldPath, hh.ArchiveLegalHoldPut)
+
+	params := openapi.Parameters{
+		ko.PathParam("page", "The name of the page binding"),
+		ko.PathParam("lang", "The language of the render"),
+		ko.PathParam("sha256", "The SHA-256 of the render"),
+	}
+	notFound := openapi.WithStatus(404, &openapi.ResponseRef{
+		Ref: "#/components/responses/NotFound",
+	})
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Lists the versions of the renders of the pages archived to the object lock storage of the host.",
+					Get: &openapi.Operation{
+						Description: "GET the archived versions of the pages",
+						OperationID: "admin-archive-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("page", "The name of the page binding to list"),
+							ko.QueryParam("lang", "The language to list, with page"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON archived versions"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("versions", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("archived", openapi.NewDateTimeSchema()).
+												WithProperty("lang", openapi.NewStringSchema()).
+												WithProperty("page", openapi.NewStringSchema()).
+												WithProperty("sha256", openapi.NewStringSchema()),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+							notFound,
+						),
+						Summary: "Archive",
+						Tags:    []string{"system", "admin", "archive"},
+					},
+					Summary: "Archived versions of the pages",
+				},
+				versionPath: {
+					Description: "Serves an archived version of the render of a page in a language, as it was published.",
+					Get: &openapi.Operation{
+						Description: "GET an archived version of a page",
+						OperationID: "admin-archive-version-get",
+						Parameters:  params,
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("HTML render"),
+								Content:     openapi.NewContentWithSchema(openapi.NewStringSchema(), []string{"text/html"}),
+							}),
+							notFound,
+						),
+						Summary: "Archived version",
+						Tags:    []string{"system", "admin", "archive"},
+					},
+					Summary: "Archived version of a page",
+				},
+				metadataPath: {
+					Description: "Serves the record of an archived version of the render of a page in a language, with its retention and legal hold.",
+					Get: &openapi.Operation{
+						Description: "GET the record of an archived version of a page",
+						OperationID: "admin-archive-metadata-get",
+						Parameters:  params,
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON archive record"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("archived", openapi.NewDateTimeSchema()).
+										WithProperty("host", openapi.NewStringSchema()).
+										WithProperty("lang", openapi.NewStringSchema()).
+										WithProperty("legalHold", openapi.NewBoolSchema()).
+										WithProperty("mode", openapi.NewStringSchema().WithEnum(archive.RetentionCompliance, archive.RetentionGovernance)).
+										WithProperty("page", openapi.NewStringSchema()).
+										WithProperty("path", openapi.NewStringSchema()).
+										WithProperty("retainUntil", openapi.NewDateTimeSchema()).
+										WithProperty("sha256", openapi.NewStringSchema()),
+									[]string{"application/json"},
+								),
+							}),
+							notFound,
+						),
+						Summary: "Archive record",
+						Tags:    []string{"system", "admin", "archive"},
+					},
+					Summary: "Record of an archived version of a page",
+				},
+				legalHoldPath: {
+					Description: "Places an archived version of the render of a page in a language under a legal hold, which protects it beyond its retention, or releases it.",
+					Put: &openapi.Operation{
+						Description: "PUT the legal hold of an archived version of a page",
+						OperationID: "admin-archive-legal-hold-put",
+						Parameters:  params,
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("legalHold", openapi.NewBoolSchema()).
+										WithRequired([]string{"legalHold"}),
+									[]string{"application/json"},
+								),
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("204", &openapi.Response{
+								Description: new("Legal hold set"),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							notFound,
+						),
+						Summary: "Legal hold",
+						Tags:    []string{"system", "admin", "archive"},
+					},
+					Summary: "Legal hold of an archived version of a page",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
 func (hh *HostHandler) authorizeHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
 	if !hh.authConfig.IsAuthEnabled() {
 		return
@@ -142,274 +386,1789 @@ func (hh *HostHandler) authorizeHandler(mux *http.ServeMux, registeredPaths map[
 	}, registeredPaths)
 }
 
-func (hh *HostHandler) discoveryHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	if !hh.authConfig.IsAuthEnabled() {
-		return
-	}
+// authzHandler is always registered so that the edge keeps working, allowing
+// every request, while the authentication of the host is disabled.
+func (hh *HostHandler) authzHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = AuthzPath + "/{path...}"
+	mux.HandleFunc(AuthzPath, hh.AuthzVerify)
+	mux.HandleFunc(AuthzPath+"/", hh.AuthzVerify)
 
-	const oauth2path = "/.well-known/oauth-authorization-server"
-	mux.HandleFunc("GET "+oauth2path, func(w http.ResponseWriter, r *http.Request) {
-		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
-			return
-		}
-		issuer := hh.serverAddress(r)
-		auth.DiscoveryHandler(issuer)(w, r)
-	})
-	registeredPaths[oauth2path] = ko.PathInfo{
+	responses := openapi.NewResponses(
+		openapi.WithName("200", &openapi.Response{
+			Description: new("The request may reach its backend"),
+			Headers: openapi.Headers{
+				AuthzSubjectHeader: &openapi.HeaderRef{
+					Value: &openapi.Header{
+						Parameter: openapi.Parameter{
+							Description: "The subject of the identity of the request",
+							Schema:      openapi.NewSchemaRef("", openapi.NewStringSchema()),
+						},
+					},
+				},
+			},
+		}),
+		openapi.WithName("401", &openapi.Response{
+			Description: new("The request must be authenticated first"),
+		}),
+		openapi.WithName("403", &openapi.Response{
+			Description: new("The identity of the request lacks the entitlements of its path"),
+		}),
+	)
+
+	hh.registerPath(AuthzPath, ko.PathInfo{
 		API: ko.OpenAPI{
-			BasePath: oauth2path,
+			BasePath: AuthzPath,
 			Paths: map[string]ko.PathItem{
-				oauth2path: {
-					Description: "Serve the OAuth 2.0 Authorization Server configuration",
+				AuthzPath: {
+					Description: "Verifies the access of the requests authorized at the edge, e.g. by the auth_request of nginx",
 					Get: &openapi.Operation{
-						Description: "GET the OAuth 2.0 Authorization Server configuration",
-						OperationID: "oauth2-authorization-server-get",
+						Description: "GET the access decision of the request in X-Original-Method and X-Original-URI, or X-Forwarded-Method and X-Forwarded-Uri",
+						OperationID: "authz-get",
+						Responses:   responses,
+						Summary:     "Edge authorization",
+						Tags:        []string{"system", "auth"},
+					},
+					Summary: "Edge authorization",
+				},
+				path: {
+					Description: "Verifies the access of the requests authorized at the edge by the HTTP ExternalAuth filter of a gateway",
+					Get: &openapi.Operation{
+						Description: "GET the access decision of the request of the path, with any method",
+						OperationID: "authz-path-get",
+						Parameters: openapi.Parameters{
+							ko.WildcardPathParam("path", "The path of the request"),
+						},
+						Responses: responses,
+						Summary:   "Edge authorization of a path",
+						Tags:      []string{"system", "auth"},
+					},
+					Summary: "Edge authorization of a path",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) bootstrapHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/bootstrap"
+	mux.HandleFunc("GET "+path, hh.BootstrapGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Serves what the scripts of the pages need to start for the visitor: the personalization context and the time zone.",
+					Get: &openapi.Operation{
+						Description: "GET the bootstrap of the visitor",
+						OperationID: "bootstrap-get",
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON bootstrap"),
 								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										Format: "json",
-										Type:   &openapi.Types{openapi.TypeObject},
-									},
+									openapi.NewObjectSchema().
+										WithProperty("personalization", &openapi.Schema{
+											AdditionalProperties: openapi.AdditionalProperties{
+												Has: new(true),
+											},
+											Type: &openapi.Types{openapi.TypeObject},
+										}).
+										WithProperty("timeZone", openapi.NewStringSchema()),
 									[]string{"application/json"},
 								),
-								Description: new("OpenID Configuration"),
-							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
 							}),
 						),
-						Summary: "OAuth 2.0 Authorization Server configuration",
-						Tags:    []string{"system", "oidc", "auth"},
+						Summary: "Visitor bootstrap",
+						Tags:    []string{"system", "personalization"},
 					},
-					Summary: "The OAuth 2.0 Authorization Server configuration",
+					Summary: "Visitor bootstrap",
 				},
 			},
 		},
 		Type: ko.SystemPathType,
-	}
+	}, registeredPaths)
+}
 
-	const oidcPath = "/.well-known/openid-configuration"
-	mux.HandleFunc("GET "+oidcPath, func(w http.ResponseWriter, r *http.Request) {
-		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+func (hh *HostHandler) cacheHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/cache/functions/{name}"
+	mux.HandleFunc("DELETE "+path, func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		hh.mu.RLock()
+		var fn *kdexv1alpha1.KDexFunction
+		for i := range hh.functions {
+			if hh.functions[i].Name == name {
+				fn = &hh.functions[i]
+				break
+			}
+		}
+		hh.mu.RUnlock()
+
+		if fn == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
 			return
 		}
-		issuer := hh.serverAddress(r)
-		auth.DiscoveryHandler(issuer)(w, r)
+
+		if shouldReturn := hh.handleRequiredAuth(
+			r,
+			w,
+			"functions",
+			fn.Spec.API.BasePath,
+			[]kdexv1alpha1.SecurityRequirement{
+				{
+					"bearer": []string{fmt.Sprintf("functions:%s:write", fn.Spec.API.BasePath)},
+				},
+			},
+		); shouldReturn {
+			return
+		}
+
+		if err := hh.purgeResponseCache(r.Context(), fn); err != nil {
+			hh.log.Error(err, "failed to purge response cache", "function", name)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	})
-	registeredPaths[oidcPath] = ko.PathInfo{
+
+	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
-			BasePath: oidcPath,
+			BasePath: path,
 			Paths: map[string]ko.PathItem{
-				oidcPath: {
-					Description: "Serve the OpenID configuration",
+				path: {
+					Description: "Purges the cached responses of a function's operations that carry the x-kdex-cache hint.",
+					Delete: &openapi.Operation{
+						Description: "DELETE cached function responses",
+						OperationID: "cache-functions-delete",
+						Parameters: openapi.Parameters{
+							ko.PathParam("name", "The name of the function"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("204", &openapi.Response{
+								Description: new("Cache purged"),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Purge function response cache",
+						Tags:    []string{"system", "cache", "functions"},
+					},
+					Summary: "Function response cache",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) capabilitiesHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/capabilities"
+	mux.HandleFunc("GET "+path, hh.CapabilitiesGet)
+
+	capability := openapi.NewObjectSchema().
+		WithProperty("enabled", openapi.NewBoolSchema()).
+		WithProperty("mode", openapi.NewStringSchema())
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Describes which optional subsystems of the host are enabled, for the clients to adapt to the host.",
 					Get: &openapi.Operation{
-						Description: "GET the OpenID configuration",
-						OperationID: "discovery-get",
+						Description: "GET the capabilities of the host",
+						OperationID: "capabilities-get",
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON capabilities"),
 								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										Format: "json",
-										Type:   &openapi.Types{openapi.TypeObject},
-									},
+									openapi.NewObjectSchema().
+										WithProperty("apiVersions", openapi.NewObjectSchema().WithAdditionalProperties(openapi.NewStringSchema())).
+										WithProperty("auth", openapi.NewObjectSchema().
+											WithProperty("enabled", openapi.NewBoolSchema()).
+											WithProperty("modes", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())).
+											WithProperty("refreshTokens", openapi.NewBoolSchema()).
+											WithProperty("revocation", openapi.NewBoolSchema())).
+										WithProperty("defaultLanguage", openapi.NewStringSchema()).
+										WithProperty("features", openapi.NewObjectSchema().WithAdditionalProperties(capability)).
+										WithProperty("host", openapi.NewStringSchema()).
+										WithProperty("languages", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())).
+										WithProperty("version", openapi.NewStringSchema()),
 									[]string{"application/json"},
 								),
-								Description: new("OpenID Configuration"),
-							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
 							}),
 						),
-						Summary: "OpenID Discovery",
-						Tags:    []string{"system", "oidc", "auth"},
+						Summary: "Host capabilities",
+						Tags:    []string{"system"},
+					},
+					Summary: "Host capabilities",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) consoleHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if _, ok := hh.utilityPage(ConsoleUtilityPageType); !ok {
+		return
+	}
+	if !slices.ContainsFunc(hh.functions, func(fn kdexv1alpha1.KDexFunction) bool { return len(fn.Spec.API.Paths) > 0 }) {
+		return
+	}
+
+	const path = "/-/console/{function}"
+	mux.HandleFunc("GET "+path, hh.ConsoleGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "An interactive console to try the operations of a function",
+					Get: &openapi.Operation{
+						Description: "GET the console of a function, with a form for each operation of its OpenAPI spec",
+						OperationID: "console-get",
+						Parameters: openapi.Parameters{
+							ko.PathParam("function", "The name of the function"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("HTML console"),
+								Content: openapi.Content{
+									"text/html": &openapi.MediaType{
+										Schema: &openapi.SchemaRef{
+											Value: &openapi.Schema{
+												Format: "html",
+												Type:   &openapi.Types{openapi.TypeString},
+											},
+										},
+									},
+								},
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Function test console",
+						Tags:    []string{"system", "functions"},
+					},
+					Summary: "Function test console",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) contractHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/fn/{function}/{path...}"
+	mux.HandleFunc(path, hh.ContractHandler)
+
+	operation := func(method string) *openapi.Operation {
+		return &openapi.Operation{
+			Description: method + " a function operation, validating the request and the response against the function's OpenAPI spec",
+			OperationID: "fn-" + strings.ToLower(method),
+			Parameters: openapi.Parameters{
+				ko.PathParam("function", "The name of the function"),
+				ko.WildcardPathParam("path", "The path of the operation without the leading slash"),
+			},
+			Responses: openapi.NewResponses(
+				openapi.WithName("200", &openapi.Response{
+					Description: new("The response of the function"),
+				}),
+				openapi.WithName("400", &openapi.Response{
+					Description: new("The request violates the function contract"),
+					Content: openapi.NewContentWithSchema(
+						&openapi.Schema{
+							Type: &openapi.Types{openapi.TypeObject},
+						},
+						[]string{"application/json"},
+					),
+				}),
+				openapi.WithStatus(404, &openapi.ResponseRef{
+					Ref: "#/components/responses/NotFound",
+				}),
+				openapi.WithName("502", &openapi.Response{
+					Description: new("The response of the function violates its contract"),
+					Content: openapi.NewContentWithSchema(
+						&openapi.Schema{
+							Type: &openapi.Types{openapi.TypeObject},
+						},
+						[]string{"application/json"},
+					),
+				}),
+			),
+			Summary: "Validated " + method,
+			Tags:    []string{"system", "function", "validation"},
+		}
+	}
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Proxies to a function, rejecting requests and responses which violate the function's OpenAPI spec.",
+					Delete:      operation(http.MethodDelete),
+					Get:         operation(http.MethodGet),
+					Patch:       operation(http.MethodPatch),
+					Post:        operation(http.MethodPost),
+					Put:         operation(http.MethodPut),
+					Summary:     "Contract validating function proxy",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) discoveryHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() {
+		return
+	}
+
+	const oauth2path = "/.well-known/oauth-authorization-server"
+	mux.HandleFunc("GET "+oauth2path, func(w http.ResponseWriter, r *http.Request) {
+		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+			return
+		}
+		issuer := hh.serverAddress(r)
+		auth.DiscoveryHandler(issuer)(w, r)
+	})
+	registeredPaths[oauth2path] = ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: oauth2path,
+			Paths: map[string]ko.PathItem{
+				oauth2path: {
+					Description: "Serve the OAuth 2.0 Authorization Server configuration",
+					Get: &openapi.Operation{
+						Description: "GET the OAuth 2.0 Authorization Server configuration",
+						OperationID: "oauth2-authorization-server-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "json",
+										Type:   &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("OpenID Configuration"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "OAuth 2.0 Authorization Server configuration",
+						Tags:    []string{"system", "oidc", "auth"},
+					},
+					Summary: "The OAuth 2.0 Authorization Server configuration",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}
+
+	const oidcPath = "/.well-known/openid-configuration"
+	mux.HandleFunc("GET "+oidcPath, func(w http.ResponseWriter, r *http.Request) {
+		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+			return
+		}
+		issuer := hh.serverAddress(r)
+		auth.DiscoveryHandler(issuer)(w, r)
+	})
+	registeredPaths[oidcPath] = ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: oidcPath,
+			Paths: map[string]ko.PathItem{
+				oidcPath: {
+					Description: "Serve the OpenID configuration",
+					Get: &openapi.Operation{
+						Description: "GET the OpenID configuration",
+						OperationID: "discovery-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "json",
+										Type:   &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("OpenID Configuration"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "OpenID Discovery",
+						Tags:    []string{"system", "oidc", "auth"},
+					},
+					Summary: "The OpenID configuration",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}
+}
+
+func (hh *HostHandler) faviconHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/favicon.ico"
+	mux.HandleFunc("GET "+path, hh.favicon.FaviconHandler)
+	registeredPaths[path] = ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "The favicon SVG resource",
+					Get: &openapi.Operation{
+						Description: "GET the favicon SVG",
+						OperationID: "favicon-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "xml",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"image/svg+xml"},
+								),
+								Description: new("SVG Favicon"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Favicon SVG",
+						Tags:    []string{"system", "favicon"},
+					},
+					Summary: "Favicon SVG resource",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}
+}
+
+func (hh *HostHandler) faultHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.faultInjection || !hh.authConfig.IsAuthEnabled() {
+		return
+	}
+
+	const path = "/-/admin/faults/{function}"
+	mux.HandleFunc("DELETE "+path, hh.FaultDelete)
+	mux.HandleFunc("GET "+path, hh.FaultGet)
+	mux.HandleFunc("POST "+path, hh.FaultPost)
+
+	statusContent := openapi.NewContentWithSchema(
+		openapi.NewObjectSchema().
+			WithProperty("duration", openapi.NewStringSchema()).
+			WithProperty("errorPercent", openapi.NewFloat64Schema()).
+			WithProperty("errorStatus", openapi.NewIntegerSchema()).
+			WithProperty("injected", openapi.NewObjectSchema().
+				WithProperty(FaultError, openapi.NewInt64Schema()).
+				WithProperty(FaultLatency, openapi.NewInt64Schema()).
+				WithProperty(FaultReset, openapi.NewInt64Schema())).
+			WithProperty("latency", openapi.NewStringSchema()).
+			WithProperty("latencyPercent", openapi.NewFloat64Schema()).
+			WithProperty("path", openapi.NewStringSchema()).
+			WithProperty("requests", openapi.NewInt64Schema()).
+			WithProperty("resetPercent", openapi.NewFloat64Schema()).
+			WithProperty("started", openapi.NewDateTimeSchema()).
+			WithProperty("until", openapi.NewDateTimeSchema()),
+		[]string{"application/json"},
+	)
+	params := openapi.Parameters{
+		ko.PathParam("function", "The name of the function"),
+	}
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Injects latency, errors and connection resets in the calls of a function by the host for a bounded time, to verify the circuit breakers and the retries of the clients.",
+					Delete: &openapi.Operation{
+						Description: "DELETE the faults injected in a function",
+						OperationID: "admin-faults-delete",
+						Parameters:  params,
+						Responses: openapi.NewResponses(
+							openapi.WithName("204", &openapi.Response{
+								Description: new("Faults stopped"),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Stop fault injection",
+						Tags:    []string{"system", "admin", "functions"},
+					},
+					Get: &openapi.Operation{
+						Description: "GET the faults injected in a function and how many were injected",
+						OperationID: "admin-faults-get",
+						Parameters:  params,
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON fault injection"),
+								Content:     statusContent,
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Fault injection",
+						Tags:    []string{"system", "admin", "functions"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST to start injecting faults in a function, replacing the previous ones",
+						OperationID: "admin-faults-post",
+						Parameters:  params,
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("duration", openapi.NewStringSchema()).
+										WithProperty("errorPercent", openapi.NewFloat64Schema().WithMin(0).WithMax(100)).
+										WithProperty("errorStatus", openapi.NewIntegerSchema().WithMin(400).WithMax(599)).
+										WithProperty("latency", openapi.NewStringSchema()).
+										WithProperty("latencyPercent", openapi.NewFloat64Schema().WithMin(0).WithMax(100)).
+										WithProperty("path", openapi.NewStringSchema()).
+										WithProperty("resetPercent", openapi.NewFloat64Schema().WithMin(0).WithMax(100)).
+										WithRequired([]string{"duration"}),
+									[]string{"application/json"},
+								),
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("202", &openapi.Response{
+								Description: new("JSON fault injection"),
+								Content:     statusContent,
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Start fault injection",
+						Tags:    []string{"system", "admin", "functions"},
+					},
+					Summary: "Fault injection",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) federationHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.federation == nil {
+		return
+	}
+
+	const path = "/-/federation"
+	mux.HandleFunc("GET "+path, hh.FederationGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Serves the freshness of the catalogs of the peers aggregated by the host.",
+					Get: &openapi.Operation{
+						Description: "GET the freshness of the catalogs of the federation peers",
+						OperationID: "federation-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON federation status"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("host", openapi.NewStringSchema()).
+										WithProperty("peers", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("error", openapi.NewStringSchema()).
+												WithProperty("fetched", openapi.NewDateTimeSchema()).
+												WithProperty("name", openapi.NewStringSchema()).
+												WithProperty("paths", openapi.NewIntegerSchema()).
+												WithProperty("stale", openapi.NewBoolSchema()).
+												WithProperty("url", openapi.NewStringSchema()),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+						),
+						Summary: "Federation status",
+						Tags:    []string{"system", "openapi"},
+					},
+					Summary: "Freshness of the federated catalogs",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	const openapiPath = "/-/federation/openapi"
+	mux.HandleFunc("GET "+openapiPath, hh.FederationOpenAPIGet)
+
+	hh.registerPath(openapiPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: openapiPath,
+			Paths: map[string]ko.PathItem{
+				openapiPath: {
+					Description: "Serves the OpenAPI 3.0 specification of this host combined with those of its federation peers, whose paths are prefixed with the name of the peer.",
+					Get: &openapi.Operation{
+						Description: "GET the federated OpenAPI 3.0 Spec",
+						OperationID: "federation-openapi-get",
+						Parameters: openapi.Parameters{
+							ko.ArrayQueryParam("path", "Filter the paths of this host by paths"),
+							ko.ArrayQueryParam("tag", "Filter the paths of this host by tags"),
+							ko.ArrayQueryParam("type", "Filter the paths of this host by path types"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										AdditionalProperties: openapi.AdditionalProperties{
+											Has: new(true),
+										},
+										Type: &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("Federated OpenAPI documentation"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Federated OpenAPI 3.0 Spec",
+						Tags:    []string{"system", "openapi"},
+					},
+					Summary: "Federated OpenAPI 3.0 specification",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) formatHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/format/{l10n}"
+	mux.HandleFunc("GET "+path, hh.FormatGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Formats numbers, currencies and dates for a given language tag and the time zone of the visitor the same way pages render them.",
+					Get: &openapi.Operation{
+						Description: "GET values formatted for a language",
+						OperationID: "format-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("currency", "The ISO 4217 code of the currency of currency values, the currency of the region of the language by default"),
+							ko.PathParam("l10n", "The language tag"),
+							ko.QueryParam("type", "The type of the values, one of currency, date, datetime, number, percent or time"),
+							ko.ArrayQueryParam("value", "The values to format, numbers, RFC 3339 timestamps, dates or unix seconds"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON formatted values, in the order of the value parameters"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("lang", openapi.NewStringSchema()).
+										WithProperty("timeZone", openapi.NewStringSchema()).
+										WithProperty("type", openapi.NewStringSchema().WithEnum(FormatCurrency, FormatDate, FormatDateTime, FormatNumber, FormatPercent, FormatTime)).
+										WithProperty("values", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+						),
+						Summary: "Locale formatted values",
+						Tags:    []string{"system", "format", "localization"},
+					},
+					Summary: "Locale formatted numbers, currencies and dates",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) gitHookHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if len(hh.gitHookSecretsLocked()) == 0 {
+		return
+	}
+
+	const path = "/-/hooks/git"
+	mux.HandleFunc("POST "+path, hh.GitHookPost)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Receives the push webhooks of GitHub, GitLab and Gitea. Functions built from the pushed branch or tag of the repository are rebuilt at the pushed commit.",
+					Post: &openapi.Operation{
+						Description: "POST a push event signed with the webhook secret (X-Hub-Signature-256, X-Gitea-Signature or X-Gitlab-Token)",
+						OperationID: "hooks-git-post",
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content:  openapi.NewContentWithSchema(openapi.NewObjectSchema(), []string{"application/json"}),
+								Required: true,
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON functions rebuilt for the push"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("commit", openapi.NewStringSchema()).
+										WithProperty("functions", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())).
+										WithProperty("ref", openapi.NewStringSchema()),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+						),
+						Summary: "Git push webhook",
+						Tags:    []string{"system", "hooks", "functions"},
+					},
+					Summary: "Git push webhook",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) graphqlHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.GraphQL {
+		return
+	}
+
+	const path = "/-/graphql"
+	mux.HandleFunc("GET "+path, hh.GraphQLHandler)
+	mux.HandleFunc("POST "+path, hh.GraphQLHandler)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Exposes the operations of the functions as a GraphQL schema. GET operations are queries, the others are mutations.",
+					Get: &openapi.Operation{
+						Description: "GET the GraphQL schema",
+						OperationID: "graphql-get",
+						Parameters:  openapi.Parameters{},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("GraphQL SDL"),
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "graphql",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"text/plain"},
+								),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "GraphQL Schema",
+						Tags:    []string{"system", "graphql"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST a GraphQL request",
+						OperationID: "graphql-post",
+						Parameters:  openapi.Parameters{},
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("operationName", openapi.NewStringSchema()).
+										WithProperty("query", openapi.NewStringSchema()).
+										WithProperty("variables", openapi.NewObjectSchema()).
+										WithRequired([]string{"query"}),
+									[]string{"application/json"},
+								),
+								Required: true,
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("GraphQL response"),
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Type: &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "GraphQL Request",
+						Tags:    []string{"system", "graphql"},
+					},
+					Summary: "GraphQL endpoint",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) healthzHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/healthz"
+	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		breakers := hh.breakers.Snapshots()
+
+		status := "ok"
+		for _, snapshot := range breakers {
+			if snapshot.State != breaker.StateClosed {
+				status = "degraded"
+				break
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"breakers": breakers,
+			"host":     hh.GetStatus(),
+			"status":   status,
+		}); err != nil {
+			hh.log.Error(err, "failed to encode health detail")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Reports the health of the host including the state of the circuit breakers guarding its functions.",
+					Get: &openapi.Operation{
+						Description: "GET host health detail",
+						OperationID: "healthz-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "json",
+										Type:   &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("Health detail"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Host health",
+						Tags:    []string{"system", "health"},
+					},
+					Summary: "The health of the host",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) impersonateHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() || hh.authConfig.Impersonation == nil {
+		return
+	}
+
+	const path = "/-/impersonate"
+	mux.HandleFunc("POST "+path, hh.ImpersonatePost)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Mints, for support staff holding the impersonation entitlement of the host, a time-boxed token acting as another subject. The actor is recorded in the act claim of the token and every request made with it is recorded in the audit log.",
+					Post: &openapi.Operation{
+						Description: "POST a subject to act as",
+						OperationID: "impersonate-post",
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.Content{
+									"application/x-www-form-urlencoded": &openapi.MediaType{
+										Schema: &openapi.SchemaRef{
+											Value: openapi.NewObjectSchema().
+												WithProperty("reason", openapi.NewStringSchema()).
+												WithProperty("subject", openapi.NewStringSchema()).
+												WithRequired([]string{"subject"}),
+										},
+									},
+								},
+								Description: "Impersonation request body",
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON token of the subject"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("access_token", openapi.NewStringSchema()).
+										WithProperty("expires_in", openapi.NewInt64Schema()).
+										WithProperty("scope", openapi.NewStringSchema()).
+										WithProperty("subject", openapi.NewStringSchema()).
+										WithProperty("token_type", openapi.NewStringSchema()),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Impersonate a subject",
+						Tags:    []string{"system", "auth"},
+					},
+					Summary: "The impersonation endpoint of the host",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) integrityHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.integrityMode == "" {
+		return
+	}
+
+	const path = "/-/integrity"
+	mux.HandleFunc("GET "+path, hh.IntegrityGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Serves the signed manifest of the hashes of the renders of the pages of a snapshot of the host.",
+					Get: &openapi.Operation{
+						Description: "GET the integrity manifest of the pages",
+						OperationID: "integrity-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("snapshot", "The snapshot of the manifest, the latest when unset"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON integrity manifest"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("entries", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("lang", openapi.NewStringSchema()).
+												WithProperty("page", openapi.NewStringSchema()).
+												WithProperty("path", openapi.NewStringSchema()).
+												WithProperty("sha256", openapi.NewStringSchema()),
+										)).
+										WithProperty("host", openapi.NewStringSchema()).
+										WithProperty("issued", openapi.NewDateTimeSchema()).
+										WithProperty("signature", openapi.NewStringSchema()).
+										WithProperty("snapshot", openapi.NewStringSchema()),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Integrity manifest",
+						Tags:    []string{"system"},
+					},
+					Summary: "Integrity manifest of the pages",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) introspectHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() {
+		return
+	}
+
+	oauth2 := &auth.OAuth2{
+		AuthConfig:    hh.authConfig,
+		AuthExchanger: hh.authExchanger,
+	}
+	const path = "/-/oauth/introspect"
+	mux.HandleFunc("POST "+path, oauth2.IntrospectHandler)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "The OAuth2 token introspection endpoint (RFC 7662) for the confidential clients of the host",
+					Post: &openapi.Operation{
+						Description: "POST a token to learn whether it is active and its claims",
+						OperationID: "introspect-post",
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.Content{
+									"application/x-www-form-urlencoded": &openapi.MediaType{
+										Schema: &openapi.SchemaRef{
+											Value: openapi.NewObjectSchema().
+												WithProperty("client_id", openapi.NewStringSchema()).
+												WithProperty("client_secret", openapi.NewStringSchema()).
+												WithProperty("token", openapi.NewStringSchema()).
+												WithProperty("token_type_hint", openapi.NewStringSchema().WithEnum("access_token", "refresh_token")).
+												WithRequired([]string{"token"}),
+										},
+									},
+								},
+								Description: "Introspection request body",
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("active", openapi.NewBoolSchema()).
+										WithProperty("client_id", openapi.NewStringSchema()).
+										WithProperty("exp", openapi.NewIntegerSchema()).
+										WithProperty("scope", openapi.NewStringSchema()).
+										WithProperty("sub", openapi.NewStringSchema()).
+										WithProperty("token_type", openapi.NewStringSchema()).
+										WithAnyAdditionalProperties(),
+									[]string{"application/json"},
+								),
+								Description: new("Introspection Response"),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "OAuth2 Token Introspection",
+						Tags:    []string{"system", "oauth2", "auth"},
+					},
+					Summary: "The OAuth2 token introspection endpoint",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) jwksHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() {
+		return
+	}
+
+	const path = "/.well-known/jwks.json"
+	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+			return
+		}
+		auth.JWKSHandler(hh.authConfig.KeyPairs)(w, r)
+	})
+	registeredPaths[path] = ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Serve the JWT key set",
+					Get: &openapi.Operation{
+						Description: "GET the JWT key set",
+						OperationID: "jwks-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "json",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("JWKS"),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "The JWKS",
+						Tags:    []string{"system", "jwks", "jwt", "auth"},
+					},
+					Summary: "The JWT key set",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}
+}
+
+func (hh *HostHandler) linkCheckHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.linkCheckInterval == 0 {
+		return
+	}
+
+	const path = "/-/admin/links"
+	mux.HandleFunc("GET "+path, hh.LinkReportGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Reports the HTML validation issues and broken internal links found by the latest check of each page in each language.",
+					Get: &openapi.Operation{
+						Description: "GET the link check of the pages",
+						OperationID: "links-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("page", "The name of the page binding to report"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON link check report"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("checked", openapi.NewDateTimeSchema()).
+										WithProperty("interval", openapi.NewStringSchema()).
+										WithProperty("pages", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("issues", openapi.NewArraySchema().WithItems(
+													openapi.NewObjectSchema().
+														WithProperty("message", openapi.NewStringSchema()).
+														WithProperty("rule", openapi.NewStringSchema().WithEnum(
+															linkcheck.RuleBrokenLink, linkcheck.RuleDuplicateID, linkcheck.RuleStrayEndTag, linkcheck.RuleUnclosedElement,
+														)).
+														WithProperty("target", openapi.NewStringSchema()),
+												)).
+												WithProperty("lang", openapi.NewStringSchema()).
+												WithProperty("page", openapi.NewStringSchema()).
+												WithProperty("path", openapi.NewStringSchema()),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+						),
+						Summary: "Link check",
+						Tags:    []string{"system", "admin"},
+					},
+					Summary: "HTML validation and broken link check of the pages",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) loginHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() {
+		return
+	}
+
+	const loginPath = "/-/login"
+	mux.HandleFunc("GET "+loginPath, hh.LoginGet)
+	mux.HandleFunc("POST "+loginPath, hh.LoginPost)
+
+	hh.registerPath(loginPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: loginPath,
+			Paths: map[string]ko.PathItem{
+				loginPath: {
+					Description: "Provides the login experience",
+					Get: &openapi.Operation{
+						Description: "GET the login view",
+						OperationID: "login-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("provider", "The name of the OIDC provider to log in with"),
+							ko.QueryParam("return", "The URL to redirect to after successful login"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "html",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"text/html"},
+								),
+								Description: new("HTML login page"),
+							}),
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Get login experience",
+						Tags:    []string{"system", "login", "auth"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST to login action",
+						OperationID: "login-post",
+						Responses: openapi.NewResponses(
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+						),
+						Summary: "Login action",
+						Tags:    []string{"system", "login", "auth"},
+					},
+					Summary: "Login experience",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	mux.HandleFunc("GET "+mfaPath, hh.MFAGet)
+	mux.HandleFunc("POST "+mfaPath, hh.MFAPost)
+
+	hh.registerPath(mfaPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: mfaPath,
+			Paths: map[string]ko.PathItem{
+				mfaPath: {
+					Description: "Completes the local logins with a second factor, enrolled on first use",
+					Get: &openapi.Operation{
+						Description: "GET the second factor view of a login",
+						OperationID: "login-mfa-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("challenge", "The challenge of the login"),
+							ko.QueryParam("error", "The error of the previous attempt"),
+							ko.QueryParam("return", "The URL to redirect to after successful login"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "html",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"text/html"},
+								),
+								Description: new("HTML second factor page"),
+							}),
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Get second factor experience",
+						Tags:    []string{"system", "login", "auth"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST the TOTP code completing a login",
+						OperationID: "login-mfa-post",
+						Responses: openapi.NewResponses(
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+						),
+						Summary: "Second factor action",
+						Tags:    []string{"system", "login", "auth"},
+					},
+					Summary: "Second factor experience",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	const logoutPath = "/-/logout"
+	mux.HandleFunc("POST "+logoutPath, hh.LogoutPost)
+
+	hh.registerPath(logoutPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: logoutPath,
+			Paths: map[string]ko.PathItem{
+				logoutPath: {
+					Description: "Provides the logout experience",
+					Post: &openapi.Operation{
+						Description: "POST to logout action",
+						OperationID: "logout-post",
+						Responses: openapi.NewResponses(
+							openapi.WithStatus(302, &openapi.ResponseRef{
+								Ref: "#/components/responses/Found",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Logout action",
+						Tags:    []string{"system", "logout", "auth"},
+					},
+					Summary: "Logout experience",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) navigationHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/navigation/{navKey}/{l10n}/{basePathMinusLeadingSlash...}"
+	mux.HandleFunc("GET "+path, hh.withPageMetrics("navigation", "", hh.NavigationGet))
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Dynamic HTML navigation components, supporting localization and breadcrumb contexts.",
+					Get: &openapi.Operation{
+						Description: "GET Dynamic HTML navigation",
+						OperationID: "navigation-get",
+						Parameters: openapi.Parameters{
+							ko.WildcardPathParam("basePathMinusLeadingSlash", "The base path without the leading slash"),
+							ko.PathParam("l10n", "The language tag"),
+							ko.PathParam("navKey", "The navigation key"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "html",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"text/html"},
+								),
+								Description: new("HTML navigation fragment"),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Dynamic HTML navigation",
+						Tags:    []string{"system", "navigation"},
+					},
+					Summary: "Dynamic HTML navigation components",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) notReadyHandler(w http.ResponseWriter, r *http.Request) {
+	l, err := kdexhttp.GetLang(r, hh.defaultLanguage, hh.Translations.Languages())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+		return
+	}
+
+	rendered := hh.renderUtilityPage(
+		kdexv1alpha1.AnnouncementUtilityPageType,
+		l,
+		map[string]any{},
+		&hh.Translations,
+	)
+
+	if rendered == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	hh.log.V(1).Info("serving announcement page", "language", l.String())
+
+	w.Header().Set("Content-Language", l.String())
+	w.Header().Set("Content-Type", "text/html")
+
+	_, err = w.Write([]byte(rendered))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (hh *HostHandler) oauthHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsOIDCEnabled() {
+		return
+	}
+
+	oauth2 := &auth.OAuth2{
+		AuthConfig:    hh.authConfig,
+		AuthExchanger: hh.authExchanger,
+	}
+	const path = "/-/oauth/callback"
+	mux.HandleFunc("GET "+path, oauth2.OAuthGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "The OAuth2 support endpoint",
+					Get: &openapi.Operation{
+						Description: "GET OAuth2 Callback",
+						OperationID: "oauth-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("code", "The authorization code"),
+							ko.QueryParam("state", "The state parameter for CSRF protection"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "OAuth2 Callback",
+						Tags:    []string{"system", "oauth2", "auth"},
+					},
+					Summary: "OAuth2 support",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	const logoutPath = "/-/oauth/backchannel-logout"
+	mux.HandleFunc("POST "+logoutPath, oauth2.BackChannelLogoutPost)
+
+	hh.registerPath(logoutPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: logoutPath,
+			Paths: map[string]ko.PathItem{
+				logoutPath: backChannelLogoutPathItem("backchannel-logout-post", "the OIDC provider of the host"),
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	if len(hh.authConfig.OIDC.Providers) == 0 {
+		return
+	}
+
+	// The named OIDC providers are called back by name
+	const providerPath = path + "/{provider}"
+	mux.HandleFunc("GET "+providerPath, oauth2.OAuthGet)
+
+	hh.registerPath(providerPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: providerPath,
+			Paths: map[string]ko.PathItem{
+				providerPath: {
+					Description: "The OAuth2 support endpoint of the named OIDC providers",
+					Get: &openapi.Operation{
+						Description: "GET OAuth2 Callback of a named OIDC provider",
+						OperationID: "oauth-provider-get",
+						Parameters: openapi.Parameters{
+							ko.PathParam("provider", "The name of the OIDC provider"),
+							ko.QueryParam("code", "The authorization code"),
+							ko.QueryParam("state", "The state parameter for CSRF protection"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithStatus(303, &openapi.ResponseRef{
+								Ref: "#/components/responses/SeeOther",
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "OAuth2 Callback of a named OIDC provider",
+						Tags:    []string{"system", "oauth2", "auth"},
 					},
-					Summary: "The OpenID configuration",
+					Summary: "OAuth2 support of the named OIDC providers",
 				},
 			},
 		},
 		Type: ko.SystemPathType,
-	}
-}
+	}, registeredPaths)
 
-func (hh *HostHandler) faviconHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	const path = "/favicon.ico"
-	mux.HandleFunc("GET "+path, hh.favicon.FaviconHandler)
-	registeredPaths[path] = ko.PathInfo{
+	const providerLogoutPath = logoutPath + "/{provider}"
+	mux.HandleFunc("POST "+providerLogoutPath, oauth2.BackChannelLogoutPost)
+
+	providerLogoutItem := backChannelLogoutPathItem("backchannel-logout-provider-post", "a named OIDC provider")
+	providerLogoutItem.Post.Parameters = openapi.Parameters{
+		ko.PathParam("provider", "The name of the OIDC provider"),
+	}
+	hh.registerPath(providerLogoutPath, ko.PathInfo{
 		API: ko.OpenAPI{
-			BasePath: path,
+			BasePath: providerLogoutPath,
 			Paths: map[string]ko.PathItem{
-				path: {
-					Description: "The favicon SVG resource",
-					Get: &openapi.Operation{
-						Description: "GET the favicon SVG",
-						OperationID: "favicon-get",
-						Responses: openapi.NewResponses(
-							openapi.WithName("200", &openapi.Response{
-								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										Format: "xml",
-										Type:   &openapi.Types{openapi.TypeString},
+				providerLogoutPath: providerLogoutItem,
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+// backChannelLogoutPathItem documents the OIDC back-channel logout endpoint of
+// the provider, its backchannel_logout_uri.
+func backChannelLogoutPathItem(operationID string, provider string) ko.PathItem {
+	return ko.PathItem{
+		Description: "The OIDC back-channel logout endpoint of " + provider,
+		Post: &openapi.Operation{
+			Description: "POST the logout_token of " + provider + " to end the sessions of its sid, or else of its subject, and revoke their tokens",
+			OperationID: operationID,
+			RequestBody: &openapi.RequestBodyRef{
+				Value: &openapi.RequestBody{
+					Content: openapi.Content{
+						"application/x-www-form-urlencoded": &openapi.MediaType{
+							Schema: &openapi.SchemaRef{
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"logout_token": &openapi.SchemaRef{
+											Value: &openapi.Schema{
+												Type: &openapi.Types{openapi.TypeString},
+											},
+										},
 									},
-									[]string{"image/svg+xml"},
-								),
-								Description: new("SVG Favicon"),
-							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
-							}),
-						),
-						Summary: "Favicon SVG",
-						Tags:    []string{"system", "favicon"},
+									Required: []string{"logout_token"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						},
 					},
-					Summary: "Favicon SVG resource",
+					Description: "Logout request body",
+					Required:    true,
 				},
 			},
+			Responses: openapi.NewResponses(
+				openapi.WithName("200", &openapi.Response{
+					Description: new("The sessions are ended"),
+				}),
+				openapi.WithStatus(400, &openapi.ResponseRef{
+					Ref: "#/components/responses/BadRequest",
+				}),
+			),
+			Summary: "OIDC Back-Channel Logout",
+			Tags:    []string{"system", "oauth2", "auth"},
 		},
-		Type: ko.SystemPathType,
+		Summary: "OIDC back-channel logout",
 	}
 }
 
-func (hh *HostHandler) jwksHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	if !hh.authConfig.IsAuthEnabled() {
-		return
-	}
+func (hh *HostHandler) openapiHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/openapi"
 
-	const path = "/.well-known/jwks.json"
-	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
-		if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
-			return
-		}
-		auth.JWKSHandler(hh.authConfig.KeyPairs)(w, r)
-	})
-	registeredPaths[path] = ko.PathInfo{
+	mux.HandleFunc("GET "+path, hh.OpenAPIGet)
+
+	// Register the path itself so it appears in the spec
+	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "Serve the JWT key set",
+					Description: "Serves the generated OpenAPI 3.0 specification for this host.",
 					Get: &openapi.Operation{
-						Description: "GET the JWT key set",
-						OperationID: "jwks-get",
+						Description: "GET OpenAPI 3.0 Spec",
+						OperationID: "openapi-get",
+						Parameters: openapi.Parameters{
+							ko.ArrayQueryParam("path", "Filter by paths"),
+							ko.ArrayQueryParam("tag", "Filter by tags"),
+							ko.ArrayQueryParam("type", "Filter by path types"),
+						},
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
 								Content: openapi.NewContentWithSchema(
 									&openapi.Schema{
-										Format: "json",
-										Type:   &openapi.Types{openapi.TypeString},
+										AdditionalProperties: openapi.AdditionalProperties{
+											Has: new(true),
+										},
+										Type: &openapi.Types{openapi.TypeObject},
 									},
 									[]string{"application/json"},
 								),
-								Description: new("JWKS"),
+								Description: new("OpenAPI documentation"),
 							}),
 							openapi.WithStatus(500, &openapi.ResponseRef{
 								Ref: "#/components/responses/InternalServerError",
 							}),
 						),
-						Summary: "The JWKS",
-						Tags:    []string{"system", "jwks", "jwt", "auth"},
+						Summary: "OpenAPI 3.0 Spec",
+						Tags:    []string{"system", "openapi"},
 					},
-					Summary: "The JWT key set",
+					Summary: "Generated OpenAPI 3.0 specification",
 				},
 			},
 		},
 		Type: ko.SystemPathType,
-	}
+	}, registeredPaths)
 }
 
-func (hh *HostHandler) loginHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	if !hh.authConfig.IsAuthEnabled() {
+func (hh *HostHandler) pprofHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.profiling {
 		return
 	}
 
-	const loginPath = "/-/login"
-	mux.HandleFunc("GET "+loginPath, hh.LoginGet)
-	mux.HandleFunc("POST "+loginPath, hh.LoginPost)
+	const path = "/-/admin/pprof/{profile...}"
+	mux.HandleFunc("GET "+path, hh.PprofGet)
+	mux.HandleFunc("POST "+path, hh.PprofGet)
 
-	hh.registerPath(loginPath, ko.PathInfo{
+	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
-			BasePath: loginPath,
+			BasePath: path,
 			Paths: map[string]ko.PathItem{
-				loginPath: {
-					Description: "Provides the login experience",
+				path: {
+					Description: "Serves the runtime profiles of the host in the format of net/http/pprof, e.g. /-/admin/pprof/heap or /-/admin/pprof/profile?seconds=30, and their index without a profile.",
 					Get: &openapi.Operation{
-						Description: "GET the login view",
-						OperationID: "login-get",
+						Description: "GET a runtime profile",
+						OperationID: "admin-pprof-get",
 						Parameters: openapi.Parameters{
-							ko.QueryParam("return", "The URL to redirect to after successful login"),
+							ko.WildcardPathParam("profile", "The profile, e.g. allocs, block, goroutine, heap, mutex, profile or trace"),
+							ko.QueryParam("debug", "The format of the profile, 0 for the pprof format and 1 or 2 for text"),
+							ko.QueryParam("seconds", "The duration of the CPU profile or of the trace, or of the delta of the other profiles"),
 						},
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("Profile"),
 								Content: openapi.NewContentWithSchema(
 									&openapi.Schema{
-										Format: "html",
+										Format: "binary",
 										Type:   &openapi.Types{openapi.TypeString},
 									},
-									[]string{"text/html"},
+									[]string{"application/octet-stream", "text/plain"},
 								),
-								Description: new("HTML login page"),
-							}),
-							openapi.WithStatus(303, &openapi.ResponseRef{
-								Ref: "#/components/responses/SeeOther",
-							}),
-							openapi.WithStatus(400, &openapi.ResponseRef{
-								Ref: "#/components/responses/BadRequest",
 							}),
 							openapi.WithStatus(404, &openapi.ResponseRef{
 								Ref: "#/components/responses/NotFound",
 							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
-							}),
-						),
-						Summary: "Get login experience",
-						Tags:    []string{"system", "login", "auth"},
-					},
-					Post: &openapi.Operation{
-						Description: "POST to login action",
-						OperationID: "login-post",
-						Responses: openapi.NewResponses(
-							openapi.WithStatus(303, &openapi.ResponseRef{
-								Ref: "#/components/responses/SeeOther",
-							}),
-							openapi.WithStatus(400, &openapi.ResponseRef{
-								Ref: "#/components/responses/BadRequest",
-							}),
 						),
-						Summary: "Login action",
-						Tags:    []string{"system", "login", "auth"},
+						Summary: "Runtime profile",
+						Tags:    []string{"system", "admin"},
 					},
-					Summary: "Login experience",
+					Summary: "Runtime profiles",
 				},
 			},
 		},
 		Type: ko.SystemPathType,
 	}, registeredPaths)
+}
 
-	const logoutPath = "/-/logout"
-	mux.HandleFunc("POST "+logoutPath, hh.LogoutPost)
+func (hh *HostHandler) revokeHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() {
+		return
+	}
 
-	hh.registerPath(logoutPath, ko.PathInfo{
+	oauth2 := &auth.OAuth2{
+		AuthConfig:    hh.authConfig,
+		AuthExchanger: hh.authExchanger,
+	}
+	const path = "/-/oauth/revoke"
+	mux.HandleFunc("POST "+path, oauth2.RevokeHandler)
+
+	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
-			BasePath: logoutPath,
+			BasePath: path,
 			Paths: map[string]ko.PathItem{
-				logoutPath: {
-					Description: "Provides the logout experience",
+				path: {
+					Description: "The OAuth2 token revocation endpoint (RFC 7009) for the refresh tokens and access tokens of the host",
 					Post: &openapi.Operation{
-						Description: "POST to logout action",
-						OperationID: "logout-post",
+						Description: "POST a token to revoke it",
+						OperationID: "revoke-post",
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.Content{
+									"application/x-www-form-urlencoded": &openapi.MediaType{
+										Schema: &openapi.SchemaRef{
+											Value: openapi.NewObjectSchema().
+												WithProperty("client_id", openapi.NewStringSchema()).
+												WithProperty("client_secret", openapi.NewStringSchema()).
+												WithProperty("token", openapi.NewStringSchema()).
+												WithProperty("token_type_hint", openapi.NewStringSchema().WithEnum("access_token", "refresh_token")).
+												WithRequired([]string{"token"}),
+										},
+									},
+								},
+								Description: "Revocation request body",
+							},
+						},
 						Responses: openapi.NewResponses(
-							openapi.WithStatus(302, &openapi.ResponseRef{
-								Ref: "#/components/responses/Found",
+							openapi.WithName("200", &openapi.Response{
+								Description: new("The token is revoked, or was not valid"),
 							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+							openapi.WithName("503", &openapi.Response{
+								Description: new("The revocation list is unavailable"),
 							}),
 						),
-						Summary: "Logout action",
-						Tags:    []string{"system", "logout", "auth"},
+						Summary: "OAuth2 Token Revocation",
+						Tags:    []string{"system", "oauth2", "auth"},
 					},
-					Summary: "Logout experience",
+					Summary: "The OAuth2 token revocation endpoint",
 				},
 			},
 		},
@@ -417,37 +2176,33 @@ func (hh *HostHandler) loginHandler(mux *http.ServeMux, registeredPaths map[stri
 	}, registeredPaths)
 }
 
-func (hh *HostHandler) navigationHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	const path = "/-/navigation/{navKey}/{l10n}/{basePathMinusLeadingSlash...}"
-	mux.HandleFunc("GET "+path, hh.NavigationGet)
+func (hh *HostHandler) schemaHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	// TODO: Add support to just list all known schemas in an HTML list with links to each schema.
+	const path = "/-/schema/{path...}"
+	mux.HandleFunc("GET "+path, hh.SchemaGet)
 
+	// Register the path itself so it appears in the spec
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "Dynamic HTML navigation components, supporting localization and breadcrumb contexts.",
+					Description: "Serves individual JSONschema from the registered OpenAPI specifications. The path should be in the format /-/schema/{basePath}/{schemaName} (e.g., /-/schema/v1/users/User) or simply /-/schema/{schemaName} for a global lookup.",
 					Get: &openapi.Operation{
-						Description: "GET Dynamic HTML navigation",
-						OperationID: "navigation-get",
+						Description: "GET JSONschema",
+						OperationID: "schema-get",
 						Parameters: openapi.Parameters{
-							ko.WildcardPathParam("basePathMinusLeadingSlash", "The base path without the leading slash"),
-							ko.PathParam("l10n", "The language tag"),
-							ko.PathParam("navKey", "The navigation key"),
+							ko.WildcardPathParam("path", "The schema path (e.g., v1/users/User or User)"),
 						},
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
 								Content: openapi.NewContentWithSchema(
 									&openapi.Schema{
-										Format: "html",
-										Type:   &openapi.Types{openapi.TypeString},
+										Type: &openapi.Types{openapi.TypeObject},
 									},
-									[]string{"text/html"},
+									[]string{"application/json"},
 								),
-								Description: new("HTML navigation fragment"),
-							}),
-							openapi.WithStatus(400, &openapi.ResponseRef{
-								Ref: "#/components/responses/BadRequest",
+								Description: new("JSONschema fragment"),
 							}),
 							openapi.WithStatus(404, &openapi.ResponseRef{
 								Ref: "#/components/responses/NotFound",
@@ -456,94 +2211,128 @@ func (hh *HostHandler) navigationHandler(mux *http.ServeMux, registeredPaths map
 								Ref: "#/components/responses/InternalServerError",
 							}),
 						),
-						Summary: "Dynamic HTML navigation",
-						Tags:    []string{"system", "navigation"},
+						Summary: "JSONschema",
+						Tags:    []string{"system", "jsonschema", "schema", "openapi"},
 					},
-					Summary: "Dynamic HTML navigation components",
+					Summary: "JSONschema Provider",
 				},
 			},
 		},
-		Type: ko.SystemPathType,
-	}, registeredPaths)
-}
-
-func (hh *HostHandler) notReadyHandler(w http.ResponseWriter, r *http.Request) {
-	l, err := kdexhttp.GetLang(r, hh.defaultLanguage, hh.Translations.Languages())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
-		return
-	}
-
-	rendered := hh.renderUtilityPage(
-		kdexv1alpha1.AnnouncementUtilityPageType,
-		l,
-		map[string]any{},
-		&hh.Translations,
-	)
-
-	if rendered == "" {
-		http.Error(w, "not found", http.StatusNotFound)
-		return
-	}
-
-	hh.log.V(1).Info("serving announcement page", "language", l.String())
-
-	w.Header().Set("Content-Language", l.String())
-	w.Header().Set("Content-Type", "text/html")
-
-	_, err = w.Write([]byte(rendered))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+		Type: ko.SystemPathType,
+	}, registeredPaths)
 }
 
-func (hh *HostHandler) oauthHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	if !hh.authConfig.IsOIDCEnabled() {
+func (hh *HostHandler) sessionsHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if !hh.authConfig.IsAuthEnabled() || !hh.authExchanger.IsRefreshTokenEnabled() {
 		return
 	}
 
-	oauth2 := &auth.OAuth2{
-		AuthConfig:    hh.authConfig,
-		AuthExchanger: hh.authExchanger,
-	}
-	const path = "/-/oauth/callback"
-	mux.HandleFunc("GET "+path, oauth2.OAuthGet)
+	const path = "/-/admin/sessions"
+	const sessionPath = path + "/{id}"
+	mux.HandleFunc("GET "+path, hh.SessionsGet)
+	mux.HandleFunc("DELETE "+path, hh.SessionsDelete)
+	mux.HandleFunc("DELETE "+sessionPath, hh.SessionDelete)
+
+	subjectParam := ko.QueryParam("subject", "The subject of the sessions")
 
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "The OAuth2 support endpoint",
-					Get: &openapi.Operation{
-						Description: "GET OAuth2 Callback",
-						OperationID: "oauth-get",
-						Parameters: openapi.Parameters{
-							ko.QueryParam("code", "The authorization code"),
-							ko.QueryParam("state", "The state parameter for CSRF protection"),
-						},
+					Description: "Lists and revokes the refresh token sessions of the host, the refresh tokens rotated from one another since a login.",
+					Delete: &openapi.Operation{
+						Description: "DELETE the sessions of a subject",
+						OperationID: "admin-sessions-delete",
+						Parameters:  openapi.Parameters{subjectParam},
 						Responses: openapi.NewResponses(
-							openapi.WithStatus(303, &openapi.ResponseRef{
-								Ref: "#/components/responses/SeeOther",
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON number of sessions revoked"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("revoked", openapi.NewInt64Schema()),
+									[]string{"application/json"},
+								),
 							}),
 							openapi.WithStatus(400, &openapi.ResponseRef{
 								Ref: "#/components/responses/BadRequest",
 							}),
-							openapi.WithStatus(401, &openapi.ResponseRef{
-								Ref: "#/components/responses/Unauthorized",
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
 							}),
 							openapi.WithStatus(500, &openapi.ResponseRef{
 								Ref: "#/components/responses/InternalServerError",
 							}),
 						),
-						Summary: "OAuth2 Callback",
-						Tags:    []string{"system", "oauth2", "auth"},
+						Summary: "Revoke the sessions of a subject",
+						Tags:    []string{"system", "admin", "auth"},
 					},
-					Summary: "OAuth2 support",
+					Get: &openapi.Operation{
+						Description: "GET the active sessions, those of a subject when set",
+						OperationID: "admin-sessions-get",
+						Parameters:  openapi.Parameters{subjectParam},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON sessions"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("sessions", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("authMethod", openapi.NewStringSchema()).
+												WithProperty("clientId", openapi.NewStringSchema()).
+												WithProperty("expiresAt", openapi.NewDateTimeSchema()).
+												WithProperty("id", openapi.NewStringSchema()).
+												WithProperty("issuedAt", openapi.NewDateTimeSchema()).
+												WithProperty("scope", openapi.NewStringSchema()).
+												WithProperty("subject", openapi.NewStringSchema()),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Sessions",
+						Tags:    []string{"system", "admin", "auth"},
+					},
+					Summary: "Refresh token sessions of the host",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	hh.registerPath(sessionPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: sessionPath,
+			Paths: map[string]ko.PathItem{
+				sessionPath: {
+					Description: "Revokes a refresh token session of the host and the access tokens it minted.",
+					Delete: &openapi.Operation{
+						Description: "DELETE a session",
+						OperationID: "admin-session-delete",
+						Parameters: openapi.Parameters{
+							ko.PathParam("id", "The id of the session"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("204", &openapi.Response{
+								Description: new("Session revoked"),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Revoke a session",
+						Tags:    []string{"system", "admin", "auth"},
+					},
+					Summary: "Refresh token session of the host",
 				},
 			},
 		},
@@ -551,47 +2340,153 @@ func (hh *HostHandler) oauthHandler(mux *http.ServeMux, registeredPaths map[stri
 	}, registeredPaths)
 }
 
-func (hh *HostHandler) openapiHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	const path = "/-/openapi"
+func (hh *HostHandler) shadowHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/admin/shadow/{function}"
+	const replayPath = path + "/replay"
+	mux.HandleFunc("DELETE "+path, hh.ShadowDelete)
+	mux.HandleFunc("GET "+path, hh.ShadowGet)
+	mux.HandleFunc("POST "+path, hh.ShadowCapturePost)
+	mux.HandleFunc("POST "+replayPath, hh.ShadowReplayPost)
 
-	mux.HandleFunc("GET "+path, hh.OpenAPIGet)
+	statsSchema := openapi.NewObjectSchema().
+		WithProperty("errorRatio", openapi.NewFloat64Schema()).
+		WithProperty("failures", openapi.NewInt64Schema()).
+		WithProperty("p50Ms", openapi.NewFloat64Schema()).
+		WithProperty("p95Ms", openapi.NewFloat64Schema()).
+		WithProperty("requests", openapi.NewInt64Schema())
+	statusContent := openapi.NewContentWithSchema(
+		openapi.NewObjectSchema().
+			WithProperty("capturing", openapi.NewBoolSchema()).
+			WithProperty("paths", openapi.NewArraySchema().WithItems(
+				openapi.NewObjectSchema().
+					WithProperty("pattern", openapi.NewStringSchema()).
+					WithProperty("ratePerSecond", openapi.NewFloat64Schema()).
+					WithProperty("requests", openapi.NewIntegerSchema()),
+			)).
+			WithProperty("replay", openapi.NewObjectSchema().
+				WithProperty("delta", openapi.NewObjectSchema().
+					WithProperty("errorRatio", openapi.NewFloat64Schema()).
+					WithProperty("p50Ms", openapi.NewFloat64Schema()).
+					WithProperty("p95Ms", openapi.NewFloat64Schema())).
+				WithProperty("finished", openapi.NewDateTimeSchema()).
+				WithProperty("image", openapi.NewStringSchema()).
+				WithProperty("live", statsSchema).
+				WithProperty("multiplier", openapi.NewIntegerSchema()).
+				WithProperty("replay", statsSchema).
+				WithProperty("started", openapi.NewDateTimeSchema()).
+				WithProperty("target", openapi.NewStringSchema())).
+			WithProperty("requests", openapi.NewIntegerSchema()).
+			WithProperty("started", openapi.NewDateTimeSchema()).
+			WithProperty("until", openapi.NewDateTimeSchema()),
+		[]string{"application/json"},
+	)
+	params := openapi.Parameters{
+		ko.PathParam("function", "The name of the function"),
+	}
 
-	// Register the path itself so it appears in the spec
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "Serves the generated OpenAPI 3.0 specification for this host.",
+					Description: "Captures a window of the live traffic of a function, its operations, rates and anonymized parameters, to replay it against a staging deployment.",
+					Delete: &openapi.Operation{
+						Description: "DELETE the capture of a function, stopping its replay",
+						OperationID: "admin-shadow-delete",
+						Parameters:  params,
+						Responses: openapi.NewResponses(
+							openapi.WithName("204", &openapi.Response{
+								Description: new("Capture discarded"),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Discard shadow capture",
+						Tags:    []string{"system", "admin", "functions"},
+					},
 					Get: &openapi.Operation{
-						Description: "GET OpenAPI 3.0 Spec",
-						OperationID: "openapi-get",
-						Parameters: openapi.Parameters{
-							ko.ArrayQueryParam("path", "Filter by paths"),
-							ko.ArrayQueryParam("tag", "Filter by tags"),
-							ko.ArrayQueryParam("type", "Filter by path types"),
-						},
+						Description: "GET the capture of a function and the report of its latest replay",
+						OperationID: "admin-shadow-get",
+						Parameters:  params,
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON shadow capture"),
+								Content:     statusContent,
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Shadow capture",
+						Tags:    []string{"system", "admin", "functions"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST to start capturing the live traffic of a function, replacing its previous capture",
+						OperationID: "admin-shadow-post",
+						Parameters:  params,
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
 								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										AdditionalProperties: openapi.AdditionalProperties{
-											Has: new(true),
-										},
-										Type: &openapi.Types{openapi.TypeObject},
-									},
+									openapi.NewObjectSchema().
+										WithProperty("maxRequests", openapi.NewIntegerSchema().WithMax(maxShadowRequests)).
+										WithProperty("window", openapi.NewStringSchema()),
 									[]string{"application/json"},
 								),
-								Description: new("OpenAPI documentation"),
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("202", &openapi.Response{
+								Description: new("JSON shadow capture"),
+								Content:     statusContent,
 							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
 							}),
 						),
-						Summary: "OpenAPI 3.0 Spec",
-						Tags:    []string{"system", "openapi"},
+						Summary: "Start shadow capture",
+						Tags:    []string{"system", "admin", "functions"},
 					},
-					Summary: "Generated OpenAPI 3.0 specification",
+					Summary: "Shadow traffic capture",
+				},
+				replayPath: {
+					Description: "Replays the captured traffic of a function against its canary, by default, or a service of the namespace of the host, and reports the latency and error deltas with the live traffic.",
+					Post: &openapi.Operation{
+						Description: "POST to replay the captured traffic of a function, each request multiplier times",
+						OperationID: "admin-shadow-replay-post",
+						Parameters:  params,
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("multiplier", openapi.NewIntegerSchema().WithMin(1).WithMax(maxShadowMultiplier)).
+										WithProperty("target", openapi.NewStringSchema().WithFormat("uri")),
+									[]string{"application/json"},
+								),
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("202", &openapi.Response{
+								Description: new("JSON shadow capture"),
+								Content:     statusContent,
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithName("409", &openapi.Response{
+								Description: new("The traffic is being captured or replayed"),
+							}),
+						),
+						Summary: "Replay shadow traffic",
+						Tags:    []string{"system", "admin", "functions"},
+					},
+					Summary: "Shadow traffic replay",
 				},
 			},
 		},
@@ -599,45 +2494,53 @@ func (hh *HostHandler) openapiHandler(mux *http.ServeMux, registeredPaths map[st
 	}, registeredPaths)
 }
 
-func (hh *HostHandler) schemaHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	// TODO: Add support to just list all known schemas in an HTML list with links to each schema.
-	const path = "/-/schema/{path...}"
-	mux.HandleFunc("GET "+path, hh.SchemaGet)
+func (hh *HostHandler) sloHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.slos == nil {
+		return
+	}
+
+	const path = "/-/admin/slo"
+	mux.HandleFunc("GET "+path, hh.SLOGet)
 
-	// Register the path itself so it appears in the spec
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "Serves individual JSONschema from the registered OpenAPI specifications. The path should be in the format /-/schema/{basePath}/{schemaName} (e.g., /-/schema/v1/users/User) or simply /-/schema/{schemaName} for a global lookup.",
+					Description: "Reports the error budget and the burn rates of each SLO declared by the host, as of their latest evaluation.",
 					Get: &openapi.Operation{
-						Description: "GET JSONschema",
-						OperationID: "schema-get",
-						Parameters: openapi.Parameters{
-							ko.WildcardPathParam("path", "The schema path (e.g., v1/users/User or User)"),
-						},
+						Description: "GET the state of the SLOs",
+						OperationID: "admin-slo-get",
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON SLO report"),
 								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										Type: &openapi.Types{openapi.TypeObject},
-									},
+									openapi.NewObjectSchema().
+										WithProperty("evaluated", openapi.NewDateTimeSchema()).
+										WithProperty("objectives", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("badRequests", openapi.NewInt64Schema()).
+												WithProperty("budgetRemaining", openapi.NewFloat64Schema()).
+												WithProperty("burnRates", openapi.NewObjectSchema().WithAdditionalProperties(openapi.NewFloat64Schema())).
+												WithProperty("name", openapi.NewStringSchema()).
+												WithProperty("requests", openapi.NewInt64Schema()).
+												WithProperty("severity", openapi.NewStringSchema().WithEnum(
+													SLOSeverityCritical, SLOSeverityOK, SLOSeverityWarning,
+												)).
+												WithProperty("target", openapi.NewFloat64Schema()).
+												WithProperty("window", openapi.NewStringSchema()),
+										)),
 									[]string{"application/json"},
 								),
-								Description: new("JSONschema fragment"),
 							}),
 							openapi.WithStatus(404, &openapi.ResponseRef{
 								Ref: "#/components/responses/NotFound",
 							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
-							}),
 						),
-						Summary: "JSONschema",
-						Tags:    []string{"system", "jsonschema", "schema", "openapi"},
+						Summary: "SLOs",
+						Tags:    []string{"system", "admin"},
 					},
-					Summary: "JSONschema Provider",
+					Summary: "Error budgets and burn rates of the SLOs of the host",
 				},
 			},
 		},
@@ -701,6 +2604,56 @@ func (hh *HostHandler) snifferHandler(mux *http.ServeMux, registeredPaths map[st
 			Type: ko.SystemPathType,
 		}, registeredPaths)
 
+		const historyPath = "/-/sniffer/history"
+		mux.HandleFunc("GET "+historyPath, hh.HistoryHandler)
+
+		hh.registerPath(historyPath, ko.PathInfo{
+			API: ko.OpenAPI{
+				BasePath: historyPath,
+				Paths: map[string]ko.PathItem{
+					historyPath: {
+						Description: "Lists the persisted results of the Request Sniffer, newest first.",
+						Get: &openapi.Operation{
+							Description: "GET Sniffer history",
+							OperationID: "sniffer-history-get",
+							Parameters: openapi.Parameters{
+								ko.QueryParam("function", "Only reports of the named function"),
+								ko.QueryParam("limit", "The maximum number of reports"),
+								ko.QueryParam("lint", "Only reports with a lint containing the value"),
+								ko.QueryParam("method", "Only reports of the HTTP method"),
+								ko.QueryParam("path", "Only reports whose path starts with the value"),
+								ko.QueryParam("since", "Only reports made since the RFC 3339 timestamp"),
+							},
+							Responses: openapi.NewResponses(
+								openapi.WithName("200", &openapi.Response{
+									Description: new("Reports"),
+									Content: openapi.NewContentWithSchema(
+										&openapi.Schema{
+											Type: &openapi.Types{openapi.TypeObject},
+										},
+										[]string{"application/json"},
+									),
+								}),
+								openapi.WithStatus(400, &openapi.ResponseRef{
+									Ref: "#/components/responses/BadRequest",
+								}),
+								openapi.WithStatus(404, &openapi.ResponseRef{
+									Ref: "#/components/responses/NotFound",
+								}),
+								openapi.WithStatus(500, &openapi.ResponseRef{
+									Ref: "#/components/responses/InternalServerError",
+								}),
+							),
+							Summary: "Sniffer History",
+							Tags:    []string{"system", "sniffer", "history"},
+						},
+						Summary: "Request Sniffer history",
+					},
+				},
+			},
+			Type: ko.SystemPathType,
+		}, registeredPaths)
+
 		const docsPath = "/-/sniffer/docs"
 		mux.HandleFunc("GET "+docsPath, hh.sniffer.DocsHandler)
 
@@ -736,58 +2689,204 @@ func (hh *HostHandler) snifferHandler(mux *http.ServeMux, registeredPaths map[st
 					},
 				},
 			},
-			Type: ko.SystemPathType,
-		}, registeredPaths)
-	}
+			Type: ko.SystemPathType,
+		}, registeredPaths)
+	}
+}
+
+func (hh *HostHandler) stateHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/state/"
+	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		authContext, ok := auth.GetAuthContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(authContext); err != nil {
+			hh.log.Error(err, "failed to encode claims")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Returns the current authenticated session state (claims) without requiring the client to parse the JWT.",
+					Get: &openapi.Operation{
+						Description: "GET authenticated session state",
+						OperationID: "state-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "json",
+										Type:   &openapi.Types{openapi.TypeObject},
+									},
+									[]string{"application/json"},
+								),
+								Description: new("Current session claims"),
+							}),
+							openapi.WithStatus(401, &openapi.ResponseRef{
+								Ref: "#/components/responses/Unauthorized",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Authenticated session state",
+						Tags:    []string{"system", "state", "auth"},
+					},
+					Summary: "The current authenticated session state (claims)",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) supportHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const bundlePath = "/-/admin/support-bundle"
+	const configPath = "/-/admin/config"
+	mux.HandleFunc("GET "+bundlePath, hh.SupportBundleGet)
+	mux.HandleFunc("GET "+configPath, hh.SupportConfigGet)
+
+	hh.registerPath(bundlePath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: bundlePath,
+			Paths: map[string]ko.PathItem{
+				bundlePath: {
+					Description: "Produces an archive of the effective configuration of the host and its latest changes, its conditions and latest events, the versions of its components and its goroutine and heap profiles, to attach to support tickets. No secret is included.",
+					Get: &openapi.Operation{
+						Description: "GET the support bundle of the host as a gzipped tar",
+						OperationID: "admin-support-bundle-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("Gzipped tar of config.json, config-changes.json, snapshot.json, versions.json and profiles/"),
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "binary",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"application/gzip"},
+								),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Support bundle",
+						Tags:    []string{"system", "admin"},
+					},
+					Summary: "Support bundle of the host",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	hh.registerPath(configPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: configPath,
+			Paths: map[string]ko.PathItem{
+				configPath: {
+					Description: "Reports the effective configuration of the host, without its secrets, and the changes of its fields by the latest reconciles.",
+					Get: &openapi.Operation{
+						Description: "GET the effective configuration of the host and its latest changes",
+						OperationID: "admin-config-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON effective configuration"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("changes", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("changes", openapi.NewArraySchema().WithItems(
+													openapi.NewObjectSchema().
+														WithProperty("from", &openapi.Schema{}).
+														WithProperty("path", openapi.NewStringSchema()).
+														WithProperty("to", &openapi.Schema{}),
+												)).
+												WithProperty("time", openapi.NewDateTimeSchema()),
+										)).
+										WithProperty("config", openapi.NewObjectSchema()),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+						),
+						Summary: "Effective configuration",
+						Tags:    []string{"system", "admin"},
+					},
+					Summary: "Effective configuration of the host",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
 }
 
-func (hh *HostHandler) stateHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
-	const path = "/-/state/"
-	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
-		authContext, ok := auth.GetAuthContext(r.Context())
-		if !ok {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+func (hh *HostHandler) timezoneHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/timezone"
+	mux.HandleFunc("GET "+path, hh.TimeZoneGet)
+	mux.HandleFunc("POST "+path, hh.TimeZonePost)
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(authContext); err != nil {
-			hh.log.Error(err, "failed to encode claims")
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
-	})
+	timeZoneSchema := openapi.NewObjectSchema().
+		WithProperty("source", openapi.NewStringSchema().WithEnum(TimeZoneSourceCookie, TimeZoneSourceDefault, TimeZoneSourceHeader)).
+		WithProperty("timeZone", openapi.NewStringSchema())
 
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
 			BasePath: path,
 			Paths: map[string]ko.PathItem{
 				path: {
-					Description: "Returns the current authenticated session state (claims) without requiring the client to parse the JWT.",
+					Description: "Negotiates the IANA time zone pages and formatted dates are rendered in for the visitor. The Time-Zone request header takes precedence over the negotiated time zone.",
 					Get: &openapi.Operation{
-						Description: "GET authenticated session state",
-						OperationID: "state-get",
+						Description: "GET the time zone of the visitor",
+						OperationID: "timezone-get",
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON time zone"),
+								Content:     openapi.NewContentWithSchema(timeZoneSchema, []string{"application/json"}),
+							}),
+						),
+						Summary: "Visitor time zone",
+						Tags:    []string{"system", "timezone", "localization"},
+					},
+					Post: &openapi.Operation{
+						Description: "POST the time zone of the visitor, an empty time zone removes it",
+						OperationID: "timezone-post",
+						RequestBody: &openapi.RequestBodyRef{
+							Value: &openapi.RequestBody{
 								Content: openapi.NewContentWithSchema(
-									&openapi.Schema{
-										Format: "json",
-										Type:   &openapi.Types{openapi.TypeObject},
-									},
+									openapi.NewObjectSchema().
+										WithProperty("timeZone", openapi.NewStringSchema()),
 									[]string{"application/json"},
 								),
-								Description: new("Current session claims"),
-							}),
-							openapi.WithStatus(401, &openapi.ResponseRef{
-								Ref: "#/components/responses/Unauthorized",
+								Required: true,
+							},
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON time zone"),
+								Content:     openapi.NewContentWithSchema(timeZoneSchema, []string{"application/json"}),
 							}),
-							openapi.WithStatus(500, &openapi.ResponseRef{
-								Ref: "#/components/responses/InternalServerError",
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
 							}),
 						),
-						Summary: "Authenticated session state",
-						Tags:    []string{"system", "state", "auth"},
+						Summary: "Negotiate the visitor time zone",
+						Tags:    []string{"system", "timezone", "localization"},
 					},
-					Summary: "The current authenticated session state (claims)",
+					Summary: "Visitor time zone",
 				},
 			},
 		},
@@ -822,6 +2921,11 @@ func (hh *HostHandler) tokenHandler(mux *http.ServeMux, registeredPaths map[stri
 										Schema: &openapi.SchemaRef{
 											Value: &openapi.Schema{
 												Properties: openapi.Schemas{
+													"audience": &openapi.SchemaRef{
+														Value: &openapi.Schema{
+															Type: &openapi.Types{openapi.TypeString},
+														},
+													},
 													"client_id": &openapi.SchemaRef{
 														Value: &openapi.Schema{
 															Type: &openapi.Types{openapi.TypeString},
@@ -852,11 +2956,31 @@ func (hh *HostHandler) tokenHandler(mux *http.ServeMux, registeredPaths map[stri
 															Type: &openapi.Types{openapi.TypeString},
 														},
 													},
+													"requested_token_type": &openapi.SchemaRef{
+														Value: &openapi.Schema{
+															Type: &openapi.Types{openapi.TypeString},
+														},
+													},
+													"resource": &openapi.SchemaRef{
+														Value: &openapi.Schema{
+															Type: &openapi.Types{openapi.TypeString},
+														},
+													},
 													"scope": &openapi.SchemaRef{
 														Value: &openapi.Schema{
 															Type: &openapi.Types{openapi.TypeString},
 														},
 													},
+													"subject_token": &openapi.SchemaRef{
+														Value: &openapi.Schema{
+															Type: &openapi.Types{openapi.TypeString},
+														},
+													},
+													"subject_token_type": &openapi.SchemaRef{
+														Value: &openapi.Schema{
+															Type: &openapi.Types{openapi.TypeString},
+														},
+													},
 													"username": &openapi.SchemaRef{
 														Value: &openapi.Schema{
 															Type: &openapi.Types{openapi.TypeString},
@@ -889,6 +3013,9 @@ func (hh *HostHandler) tokenHandler(mux *http.ServeMux, registeredPaths map[stri
 							openapi.WithStatus(401, &openapi.ResponseRef{
 								Ref: "#/components/responses/Unauthorized",
 							}),
+							openapi.WithName("429", &openapi.Response{
+								Description: new("Too many failed logins of the username, retry after the Retry-After header"),
+							}),
 							openapi.WithStatus(500, &openapi.ResponseRef{
 								Ref: "#/components/responses/InternalServerError",
 							}),
@@ -906,7 +3033,7 @@ func (hh *HostHandler) tokenHandler(mux *http.ServeMux, registeredPaths map[stri
 
 func (hh *HostHandler) translationHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
 	const path = "/-/translation/{l10n}"
-	mux.HandleFunc("GET "+path, hh.TranslationGet)
+	mux.HandleFunc("GET "+path, hh.withPageMetrics("translation", "", hh.TranslationGet))
 
 	hh.registerPath(path, ko.PathInfo{
 		API: ko.OpenAPI{
@@ -920,6 +3047,7 @@ func (hh *HostHandler) translationHandler(mux *http.ServeMux, registeredPaths ma
 						Parameters: openapi.Parameters{
 							ko.ArrayQueryParam("key", "Filter by specific translation keys"),
 							ko.PathParam("l10n", "The language tag"),
+							ko.QueryParam("missing", "When true, only the keys of the default language not translated in the language are returned"),
 						},
 						Responses: openapi.NewResponses(
 							openapi.WithName("200", &openapi.Response{
@@ -950,4 +3078,288 @@ func (hh *HostHandler) translationHandler(mux *http.ServeMux, registeredPaths ma
 		},
 		Type: ko.SystemPathType,
 	}, registeredPaths)
+
+	const reportPath = "/-/translation-report"
+	mux.HandleFunc("GET "+reportPath, hh.TranslationReportGet)
+
+	hh.registerPath(reportPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: reportPath,
+			Paths: map[string]ko.PathItem{
+				reportPath: {
+					Description: "Reports, per language, the keys of the default language which are translated and missing.",
+					Get: &openapi.Operation{
+						Description: "GET the completeness of the translations relative to the default language",
+						OperationID: "translation-report-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON translation completeness report"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("defaultLanguage", openapi.NewStringSchema()).
+										WithProperty("keys", openapi.NewIntegerSchema()).
+										WithProperty("languages", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("coverage", openapi.NewFloat64Schema()).
+												WithProperty("lang", openapi.NewStringSchema()).
+												WithProperty("missing", openapi.NewIntegerSchema()).
+												WithProperty("missingKeys", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())).
+												WithProperty("translated", openapi.NewIntegerSchema()).
+												WithProperty("violations", openapi.NewArraySchema().WithItems(
+													openapi.NewObjectSchema().
+														WithProperty("blocked", openapi.NewBoolSchema()).
+														WithProperty("expected", openapi.NewStringSchema()).
+														WithProperty("key", openapi.NewStringSchema()).
+														WithProperty("kind", openapi.NewStringSchema().WithEnum(ViolationGlossary, ViolationMemory)).
+														WithProperty("lang", openapi.NewStringSchema()).
+														WithProperty("message", openapi.NewStringSchema()).
+														WithProperty("replaced", openapi.NewBoolSchema()).
+														WithProperty("translation", openapi.NewStringSchema()),
+												)),
+										)),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "Translation completeness per language",
+						Tags:    []string{"system", "translation", "localization"},
+					},
+					Summary: "Translation completeness per language",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	const exportPath = "/-/admin/translations/export"
+	mux.HandleFunc("GET "+exportPath, hh.TranslationExportGet)
+
+	hh.registerPath(exportPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: exportPath,
+			Paths: map[string]ko.PathItem{
+				exportPath: {
+					Description: "Exports the keys of the default language and their translation in a language as XLIFF 2.0 for localization vendors.",
+					Get: &openapi.Operation{
+						Description: "GET the translations of a language as XLIFF 2.0",
+						OperationID: "translations-export-get",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("lang", "The language tag of the targets"),
+							ko.QueryParam("missing", "When true, only the keys not translated in the language are exported"),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("XLIFF 2.0 document"),
+								Content: openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "xml",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"application/xliff+xml"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "XLIFF export",
+						Tags:    []string{"system", "translation", "localization", "admin"},
+					},
+					Summary: "XLIFF export of the translations",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+
+	const importPath = "/-/admin/translations/import"
+	mux.HandleFunc("POST "+importPath, hh.TranslationImportPost)
+
+	hh.registerPath(importPath, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: importPath,
+			Paths: map[string]ko.PathItem{
+				importPath: {
+					Description: "Validates an XLIFF 2.0 delivery and merges its translated units into the translations of its target language. Units in conflict are reported and skipped.",
+					Post: &openapi.Operation{
+						Description: "POST an XLIFF 2.0 delivery",
+						OperationID: "translations-import-post",
+						Parameters: openapi.Parameters{
+							ko.QueryParam("dryRun", "When true, the delivery is only validated"),
+						},
+						RequestBody: &openapi.RequestBodyRef{
+							Value: openapi.NewRequestBody().WithRequired(true).WithContent(
+								openapi.NewContentWithSchema(
+									&openapi.Schema{
+										Format: "xml",
+										Type:   &openapi.Types{openapi.TypeString},
+									},
+									[]string{"application/xliff+xml"},
+								),
+							),
+						},
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON import report"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("conflicts", openapi.NewArraySchema().WithItems(
+											openapi.NewObjectSchema().
+												WithProperty("current", openapi.NewStringSchema()).
+												WithProperty("delivered", openapi.NewStringSchema()).
+												WithProperty("key", openapi.NewStringSchema()).
+												WithProperty("kind", openapi.NewStringSchema().WithEnum(
+													XLIFFConflictModified, XLIFFConflictSource, XLIFFConflictUnknown, XLIFFConflictUntranslated,
+												)).
+												WithProperty("message", openapi.NewStringSchema()),
+										)).
+										WithProperty("dryRun", openapi.NewBoolSchema()).
+										WithProperty("imported", openapi.NewIntegerSchema()).
+										WithProperty("lang", openapi.NewStringSchema()).
+										WithProperty("resources", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithStatus(400, &openapi.ResponseRef{
+								Ref: "#/components/responses/BadRequest",
+							}),
+							openapi.WithStatus(404, &openapi.ResponseRef{
+								Ref: "#/components/responses/NotFound",
+							}),
+							openapi.WithStatus(500, &openapi.ResponseRef{
+								Ref: "#/components/responses/InternalServerError",
+							}),
+						),
+						Summary: "XLIFF import",
+						Tags:    []string{"system", "translation", "localization", "admin"},
+					},
+					Summary: "XLIFF import of vendor deliveries",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) versionHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	const path = "/-/version"
+	mux.HandleFunc("GET "+path, hh.VersionGet)
+
+	hh.registerPath(path, ko.PathInfo{
+		API: ko.OpenAPI{
+			BasePath: path,
+			Paths: map[string]ko.PathItem{
+				path: {
+					Description: "Describes the snapshot of the host serving the requests, whose version stamps every response in the " + SnapshotHeader + " header.",
+					Get: &openapi.Operation{
+						Description: "GET the snapshot of the host",
+						OperationID: "version-get",
+						Responses: openapi.NewResponses(
+							openapi.WithName("200", &openapi.Response{
+								Description: new("JSON snapshot"),
+								Content: openapi.NewContentWithSchema(
+									openapi.NewObjectSchema().
+										WithProperty("generation", openapi.NewInt64Schema()).
+										WithProperty("host", openapi.NewStringSchema()).
+										WithProperty("managerVersion", openapi.NewStringSchema()).
+										WithProperty("time", openapi.NewDateTimeSchema()).
+										WithProperty("version", openapi.NewInt64Schema()),
+									[]string{"application/json"},
+								),
+							}),
+							openapi.WithName("304", &openapi.Response{
+								Description: new("Not Modified"),
+							}),
+						),
+						Summary: "Host snapshot",
+						Tags:    []string{"system"},
+					},
+					Summary: "Host snapshot",
+				},
+			},
+		},
+		Type: ko.SystemPathType,
+	}, registeredPaths)
+}
+
+func (hh *HostHandler) wellKnownHandler(mux *http.ServeMux, registeredPaths map[string]ko.PathInfo) {
+	if hh.changePassword != "" {
+		const changePasswordPath = "/.well-known/change-password"
+		mux.HandleFunc("GET "+changePasswordPath, hh.ChangePasswordGet)
+
+		hh.registerPath(changePasswordPath, ko.PathInfo{
+			API: ko.OpenAPI{
+				BasePath: changePasswordPath,
+				Paths: map[string]ko.PathItem{
+					changePasswordPath: {
+						Description: "Redirects browsers and password managers to the page where the users change their password.",
+						Get: &openapi.Operation{
+							Description: "GET the page where the users change their password",
+							OperationID: "change-password-get",
+							Responses: openapi.NewResponses(
+								openapi.WithName("302", &openapi.Response{
+									Description: new("Redirect to the change password page"),
+									Headers: openapi.Headers{
+										"Location": &openapi.HeaderRef{
+											Value: &openapi.Header{
+												Parameter: openapi.Parameter{
+													Schema: openapi.NewSchemaRef("", openapi.NewStringSchema()),
+												},
+											},
+										},
+									},
+								}),
+							),
+							Summary: "Change password page",
+							Tags:    []string{"system", "well-known"},
+						},
+						Summary: "Change password page",
+					},
+				},
+			},
+			Type: ko.SystemPathType,
+		}, registeredPaths)
+	}
+
+	if hh.securityTxt != nil {
+		const securityTxtPath = "/.well-known/security.txt"
+		mux.HandleFunc("GET "+securityTxtPath, hh.SecurityTxtGet)
+
+		hh.registerPath(securityTxtPath, ko.PathInfo{
+			API: ko.OpenAPI{
+				BasePath: securityTxtPath,
+				Paths: map[string]ko.PathItem{
+					securityTxtPath: {
+						Description: "Serves the RFC 9116 security.txt telling how to report the vulnerabilities of the host.",
+						Get: &openapi.Operation{
+							Description: "GET the security contacts and policy of the host",
+							OperationID: "security-txt-get",
+							Responses: openapi.NewResponses(
+								openapi.WithName("200", &openapi.Response{
+									Description: new("security.txt"),
+									Content: openapi.NewContentWithSchema(
+										openapi.NewStringSchema(),
+										[]string{"text/plain"},
+									),
+								}),
+							),
+							Summary: "Security contacts",
+							Tags:    []string{"system", "well-known"},
+						},
+						Summary: "Security contacts",
+					},
+				},
+			},
+			Type: ko.SystemPathType,
+		}, registeredPaths)
+	}
 }
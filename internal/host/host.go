@@ -19,6 +19,7 @@ import (
 	"github.com/kdex-tech/host-manager/internal/page"
 	"github.com/kdex-tech/host-manager/internal/sniffer"
 	"github.com/kdex-tech/host-manager/internal/utils"
+	"github.com/kdex-tech/host-manager/internal/web/middleware"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -33,6 +34,7 @@ func (hh *HostHandler) AddOrUpdateTranslation(name string, translation *kdexv1al
 	}
 	hh.log.V(3).Info("add or update translation", "translation", name)
 	hh.mu.Lock()
+	hh.removeTranslationLocked(name)
 	hh.translationResources[name] = *translation
 	hh.mu.Unlock()
 	hh.RebuildMux() // Called after lock is released
@@ -155,13 +157,26 @@ func (hh *HostHandler) L10nRender(
 ) (string, error) {
 
 	// make sure everything passed to the renderer is mutation safe (i.e. copy it)
+	extra := maps.Clone(extraTemplateData)
+	if extra == nil {
+		extra = map[string]any{}
+	}
+	loc, _ := extra["TimeZone"].(*time.Location)
+	if loc == nil {
+		loc = time.UTC
+		extra["TimeZone"] = loc
+	}
+	extra["Format"] = NewFormatter(l, loc)
+	variant, _ := extra["ThemeVariant"].(string)
+	brand, _ := extra["Brand"].(*Brand)
+	brandName, organization := hh.brandOf(extra)
 
 	renderer := render.Renderer{
 		BasePath:        handler.BasePath(),
-		BrandName:       hh.getBrandName(),
+		BrandName:       brandName,
 		Contents:        handler.ContentToHTMLMap(),
 		DefaultLanguage: hh.defaultLanguage,
-		Extra:           maps.Clone(extraTemplateData),
+		Extra:           extra,
 		Footer:          handler.Footer,
 		FootScript:      hh.FootScriptToHTML(handler),
 		Header:          handler.Header,
@@ -172,12 +187,12 @@ func (hh *HostHandler) L10nRender(
 		MessagePrinter:  hh.messagePrinter(translations, l),
 		Meta:            hh.MetaToString(handler, l),
 		Navigations:     handler.NavigationToHTMLMap(),
-		Organization:    hh.getOrganization(),
+		Organization:    organization,
 		PageMap:         maps.Clone(pageMap),
 		PatternPath:     handler.PatternPath(),
 		TemplateContent: handler.MainTemplate,
 		TemplateName:    handler.Name,
-		Theme:           hh.ThemeAssetsToString(),
+		Theme:           hh.themeAssetsToString(variant) + brand.symbolsStyle(),
 		Title:           handler.Label(),
 	}
 
@@ -239,7 +254,19 @@ func (hh *HostHandler) RebuildMux() {
 
 	// copy fields that we need while under RLock
 	defaultLanguageResource := hh.defaultLanguage
-	translationResources := maps.Clone(hh.translationResources)
+	translationResources, translationViolations := reviewTranslations(
+		defaultLanguageResource,
+		maps.Clone(hh.translationResources),
+		hh.machineTranslations,
+		hh.glossaries,
+		hh.translationMemories,
+	)
+	if hh.host.DevMode {
+		if translationResources == nil {
+			translationResources = map[string]kdexv1alpha1.KDexTranslationSpec{}
+		}
+		translationResources[pseudoTranslationName] = pseudoTranslations(defaultLanguageResource, translationResources)
+	}
 
 	newTranslations, err := NewTranslations(defaultLanguageResource, translationResources)
 	if err != nil {
@@ -247,6 +274,8 @@ func (hh *HostHandler) RebuildMux() {
 		hh.mu.RUnlock()
 		return
 	}
+	newTranslations.violations = translationViolations
+	observeTranslations(hh.Name, newTranslations.Report())
 
 	registeredPaths := map[string]ko.PathInfo{}
 	maps.Copy(registeredPaths, hh.pathsCollectedInReconcile)
@@ -259,13 +288,23 @@ func (hh *HostHandler) RebuildMux() {
 		mux.HandleFunc("GET /{$}", hh.notReadyHandler)
 		mux.HandleFunc("GET /{l10n}/{$}", hh.notReadyHandler)
 
+		registerHeadAndOptions(registeredPaths)
+		authzRoutes := newAuthzRoutes(registeredPaths, hh.hostRequirementsLocked())
+
 		hh.mu.RUnlock()
 		hh.mu.Lock()
 		hh.Translations = *newTranslations
+		hh.authzRoutes = authzRoutes
+		hh.graphqlSchema = hh.buildGraphQLSchema(registeredPaths)
 		hh.registeredPaths = registeredPaths
 		hh.Mux = mux
 		hh.mu.Unlock()
 
+		hh.auditPages(pageHandlers, newTranslations)
+		hh.checkBudgets(pageHandlers, newTranslations)
+		hh.recordIntegrity(pageHandlers, newTranslations)
+		hh.archiveRenders(pageHandlers, newTranslations)
+
 		return
 	}
 
@@ -282,15 +321,20 @@ func (hh *HostHandler) RebuildMux() {
 	}
 
 	functionHandlers := []functionHandler{}
-	if hh.issuerAddress() != "" {
-		for _, f := range hh.functions {
-			if f.Status.State != kdexv1alpha1.KDexFunctionStateReady {
-				continue
-			}
+	for _, f := range hh.functions {
+		switch {
+		case f.Status.State == kdexv1alpha1.KDexFunctionStateReady && hh.issuerAddress() != "":
 			functionHandlers = append(functionHandlers, functionHandler{
 				basePath: f.Spec.API.BasePath,
 				handler:  hh.reverseProxyHandler(&f, hh.issuerAddress()),
 			})
+		case f.Status.State != kdexv1alpha1.KDexFunctionStateReady && hh.MockFunctions && f.Spec.API.BasePath != "":
+			// Until the function is built, its operations are answered from
+			// its spec.
+			functionHandlers = append(functionHandlers, functionHandler{
+				basePath: f.Spec.API.BasePath,
+				handler:  hh.mockHandler(f.DeepCopy()),
+			})
 		}
 	}
 
@@ -310,16 +354,25 @@ func (hh *HostHandler) RebuildMux() {
 		}
 	}
 
+	registerHeadAndOptions(registeredPaths)
+
 	hh.Translations = *newTranslations
+	hh.authzRoutes = newAuthzRoutes(registeredPaths, hh.hostRequirementsLocked())
+	hh.graphqlSchema = hh.buildGraphQLSchema(registeredPaths)
 	hh.registeredPaths = registeredPaths
 	hh.Mux = mux
 	hh.mu.Unlock()
+
+	hh.auditPages(pageHandlers, newTranslations)
+	hh.checkBudgets(pageHandlers, newTranslations)
+	hh.recordIntegrity(pageHandlers, newTranslations)
+	hh.archiveRenders(pageHandlers, newTranslations)
 }
 
 func (hh *HostHandler) RemoveTranslation(name string) {
 	hh.log.V(1).Info("delete translation", "translation", name)
 	hh.mu.Lock()
-	delete(hh.translationResources, name)
+	hh.removeTranslationLocked(name)
 	hh.mu.Unlock()
 
 	hh.RebuildMux() // Called after lock is released
@@ -402,8 +455,16 @@ func (hh *HostHandler) SecuritySchemes() *openapi.SecuritySchemes {
 func (hh *HostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	hh.mu.RLock()
 	mux := hh.Mux
+	middlewares := hh.middlewares
+	snapshot := hh.snapshot
+	var domains []string
+	if hh.host != nil {
+		domains = hh.host.Routing.Domains
+	}
 	hh.mu.RUnlock()
 
+	setSnapshotHeader(w, snapshot)
+
 	if hh.GetStatus() == HostStatusInitializing {
 		hh.notReadyHandler(w, r)
 		return
@@ -414,11 +475,32 @@ func (hh *HostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wrappedMux := hh.authConfig.AddAuthentication(mux)
+	hh.nameSpan(mux, r)
+
+	w, observed := hh.observeSLOs(w, r)
+	defer observed()
+
+	wrappedMux := hh.authConfig.AddAuthentication(withAccessLogSubject(withHeadAndOptions(mux, domains)))
+	if middlewares != nil {
+		wrappedMux = middlewares(wrappedMux)
+	}
 	wrappedMux = hh.DesignMiddleware(wrappedMux)
 	wrappedMux.ServeHTTP(w, r)
 }
 
+// withAccessLogSubject records the subject of the authenticated requests in
+// the access log.
+func withAccessLogSubject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authContext, ok := auth.GetAuthContext(r.Context()); ok {
+			if subject, _ := authContext["sub"].(string); subject != "" {
+				middleware.SetAccessLogSubject(r.Context(), subject)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (hh *HostHandler) SetHost(
 	ctx context.Context,
 	host *kdexv1alpha1.KDexHostSpec,
@@ -442,6 +524,7 @@ func (hh *HostHandler) SetHost(
 	}
 	hh.defaultLanguage = host.DefaultLang
 	hh.functions = functions
+	hh.breakers.Retain(utils.MapSlice(functions, func(f kdexv1alpha1.KDexFunction) string { return f.Name })...)
 	hh.scheme = scheme
 	hh.favicon = ico.NewICO(host.FaviconSVGTemplate, render.TemplateData{
 		BrandName:       host.BrandName,
@@ -457,21 +540,32 @@ func (hh *HostHandler) SetHost(
 
 	var snif *sniffer.RequestSniffer
 	if host.DevMode {
+		if hh.snifferQueue == nil && hh.SnifferWriteWindow > 0 {
+			hh.snifferQueue = sniffer.NewWriteQueue(hh.client, hh.Name, hh.SnifferWriteWindow, hh.log.WithName("sniffer-queue"))
+		}
+
 		snif = &sniffer.RequestSniffer{
-			BasePathRegex:   (&kdexv1alpha1.API{}).BasePathRegex(),
-			Client:          hh.client,
-			Functions:       functions,
-			HostName:        hh.Name,
-			ItemPathRegex:   (&kdexv1alpha1.API{}).ItemPathRegex(),
-			OpenAPIBuilder:  hh.openapiBuilder,
-			Namespace:       hh.Namespace,
-			ReconcileTime:   hh.reconcileTime,
-			SecuritySchemes: hh.SecuritySchemes(),
+			BasePathRegex:          (&kdexv1alpha1.API{}).BasePathRegex(),
+			Client:                 hh.client,
+			Functions:              functions,
+			HostName:               hh.Name,
+			ItemPathRegex:          (&kdexv1alpha1.API{}).ItemPathRegex(),
+			MediaTypes:             hh.mediaTypes,
+			OpenAPIBuilder:         hh.openapiBuilder,
+			Namespace:              hh.Namespace,
+			Queue:                  hh.snifferQueue,
+			ReconcileTime:          hh.reconcileTime,
+			SchemaConflictStrategy: hh.SnifferSchemaConflictStrategy,
+			SecuritySchemes:        hh.SecuritySchemes(),
 		}
 	}
 
 	hh.sniffer = snif
+	if snif != nil && hh.snifferHistory == nil && hh.SnifferHistorySize > 0 {
+		hh.snifferHistory = NewSnifferHistory(hh.client, hh.Name, hh.Namespace, hh.SnifferHistorySize, hh.log.WithName("sniffer-history"))
+	}
 	hh.reconcileTime = time.Now()
+	hh.nextSnapshotLocked(generation, hh.reconcileTime)
 	hh.importmap = importmap
 
 	if authConfig != nil {
@@ -496,6 +590,8 @@ func (hh *HostHandler) SetHost(
 		}),
 	}
 
+	hh.recordConfigLocked(hh.reconcileTime)
+
 	// TODO: Map the functions to a reverse proxy handler by their base path
 	// Note that once they are mapped, the sniffer will no longer work for those paths so we might need an alternative
 	// way to modify the OpenAPI spec for the functions.
@@ -560,19 +656,47 @@ func (hh *HostHandler) messagePrinter(translations *Translations, tag language.T
 func (hh *HostHandler) muxWithDefaultsLocked(registeredPaths map[string]ko.PathInfo) *http.ServeMux {
 	mux := http.NewServeMux()
 
+	hh.a11yHandler(mux, registeredPaths)
+	hh.acmeHandler(mux, registeredPaths)
+	hh.archiveHandler(mux, registeredPaths)
 	hh.authorizeHandler(mux, registeredPaths)
+	hh.authzHandler(mux, registeredPaths)
+	hh.bootstrapHandler(mux, registeredPaths)
+	hh.cacheHandler(mux, registeredPaths)
+	hh.capabilitiesHandler(mux, registeredPaths)
+	hh.consoleHandler(mux, registeredPaths)
+	hh.contractHandler(mux, registeredPaths)
 	hh.discoveryHandler(mux, registeredPaths)
 	hh.faviconHandler(mux, registeredPaths)
+	hh.faultHandler(mux, registeredPaths)
+	hh.federationHandler(mux, registeredPaths)
+	hh.formatHandler(mux, registeredPaths)
+	hh.gitHookHandler(mux, registeredPaths)
+	hh.graphqlHandler(mux, registeredPaths)
+	hh.healthzHandler(mux, registeredPaths)
+	hh.impersonateHandler(mux, registeredPaths)
+	hh.integrityHandler(mux, registeredPaths)
+	hh.introspectHandler(mux, registeredPaths)
 	hh.jwksHandler(mux, registeredPaths)
+	hh.linkCheckHandler(mux, registeredPaths)
 	hh.loginHandler(mux, registeredPaths)
 	hh.navigationHandler(mux, registeredPaths)
 	hh.oauthHandler(mux, registeredPaths)
 	hh.openapiHandler(mux, registeredPaths)
+	hh.pprofHandler(mux, registeredPaths)
+	hh.revokeHandler(mux, registeredPaths)
 	hh.schemaHandler(mux, registeredPaths)
+	hh.sessionsHandler(mux, registeredPaths)
+	hh.shadowHandler(mux, registeredPaths)
+	hh.sloHandler(mux, registeredPaths)
 	hh.snifferHandler(mux, registeredPaths)
 	hh.stateHandler(mux, registeredPaths)
+	hh.supportHandler(mux, registeredPaths)
+	hh.timezoneHandler(mux, registeredPaths)
 	hh.tokenHandler(mux, registeredPaths)
 	hh.translationHandler(mux, registeredPaths)
+	hh.versionHandler(mux, registeredPaths)
+	hh.wellKnownHandler(mux, registeredPaths)
 
 	// TODO: implement a check handler
 
@@ -582,16 +706,20 @@ func (hh *HostHandler) muxWithDefaultsLocked(registeredPaths map[string]ko.PathI
 func (hh *HostHandler) pageRequirements(ph *page.PageHandler) []kdexv1alpha1.SecurityRequirement {
 	hh.mu.RLock()
 	defer hh.mu.RUnlock()
-	var requirements []kdexv1alpha1.SecurityRequirement
-	if hh.host.Security != nil {
-		requirements = *hh.host.Security
-	}
+	requirements := hh.hostRequirementsLocked()
 	if ph.Page.Security != nil {
 		requirements = *ph.Page.Security
 	}
 	return requirements
 }
 
+func (hh *HostHandler) hostRequirementsLocked() []kdexv1alpha1.SecurityRequirement {
+	if hh.host == nil || hh.host.Security == nil {
+		return nil
+	}
+	return *hh.host.Security
+}
+
 func (hh *HostHandler) registerPath(path string, info ko.PathInfo, m map[string]ko.PathInfo) {
 	current, ok := m[path]
 	if !ok {
@@ -612,7 +740,7 @@ func (hh *HostHandler) registerPath(path string, info ko.PathInfo, m map[string]
 }
 
 func (hh *HostHandler) renderUtilityPage(utilityType kdexv1alpha1.KDexUtilityPageType, l language.Tag, extraTemplateData map[string]any, translations *Translations) string {
-	ph, ok := hh.utilityPages[utilityType]
+	ph, ok := hh.utilityPage(utilityType)
 	if !ok {
 		return ""
 	}
@@ -676,7 +804,7 @@ func (hh *HostHandler) serveError(w http.ResponseWriter, r *http.Request, code i
 	rendered := hh.renderUtilityPage(
 		kdexv1alpha1.ErrorUtilityPageType,
 		l,
-		map[string]any{"ErrorCode": code, "ErrorCodeString": http.StatusText(code), "ErrorMessage": msg},
+		withBrand(errorTemplateData(r, code, msg), hh.brandForLocked(r)),
 		&hh.Translations,
 	)
 	hh.mu.RUnlock()
@@ -693,6 +821,16 @@ func (hh *HostHandler) serveError(w http.ResponseWriter, r *http.Request, code i
 	_, _ = w.Write([]byte(rendered))
 }
 
+// errorTemplateData is the extra template data of error pages, which are
+// rendered in the time zone of the visitor.
+func errorTemplateData(r *http.Request, code int, msg string) map[string]any {
+	data := map[string]any{"ErrorCode": code, "ErrorCodeString": http.StatusText(code), "ErrorMessage": msg}
+	if loc, _ := visitorTimeZone(r); loc != nil {
+		data["TimeZone"] = loc
+	}
+	return data
+}
+
 func (hh *HostHandler) serverAddress(r *http.Request) string {
 	return fmt.Sprintf("%s://%s", hh.scheme, r.Host)
 }
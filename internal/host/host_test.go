@@ -5,10 +5,13 @@ import (
 	"testing"
 
 	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	"github.com/kdex-tech/host-manager/internal/page"
 	G "github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
@@ -490,3 +493,15 @@ func TestHostHandler_AddOrUpdateTranslation(t *testing.T) {
 		})
 	}
 }
+
+// bearerToken signs a local token of the entitlements with the pair.
+func bearerToken(t *testing.T, pair *keys.KeyPair, entitlements ...string) string {
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"sub":          "admin",
+		"entitlements": entitlements,
+	})
+	unsigned.Header["kid"] = pair.KeyId
+	signed, err := unsigned.SignedString(pair.Private)
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
@@ -0,0 +1,54 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+)
+
+// ImpersonationToken is the response of POST /-/impersonate.
+type ImpersonationToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	Subject     string `json:"subject"`
+	TokenType   string `json:"token_type"`
+}
+
+// ImpersonatePost mints, for the authenticated actor holding the
+// impersonation entitlement of the host, a time-boxed token of the subject of
+// the form, impersonated for the reason of the form.
+func (hh *HostHandler) ImpersonatePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	actor, _ := auth.GetAuthContext(r.Context())
+	ts, err := hh.authExchanger.Impersonate(hh.authConfig.WithClientIP(r), actor, r.PostFormValue("subject"), r.PostFormValue("reason"))
+	if errors.Is(err, auth.ErrImpersonationForbidden) {
+		hh.log.V(1).Info("unauthorized impersonation attempt", "error", err.Error())
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		hh.log.Error(err, "failed to impersonate")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ImpersonationToken{
+		AccessToken: ts.AccessToken,
+		ExpiresIn:   int64(hh.authConfig.ImpersonationTTL().Seconds()),
+		Scope:       ts.Scope,
+		Subject:     ts.Subject,
+		TokenType:   "Bearer",
+	}); err != nil {
+		hh.log.Error(err, "failed to encode impersonation token")
+	}
+}
@@ -0,0 +1,87 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_ImpersonatePost(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", new(1*time.Hour))
+	cfg, err := auth.NewConfig(
+		&kdexv1alpha1.Auth{},
+		func() (map[string]auth.AuthClient, error) { return map[string]auth.AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]auth.OIDCProvider, string, error) { return nil, "", nil },
+		"shop",
+		"http://shop.example.com",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+
+	hh := &HostHandler{
+		Name:        "shop",
+		authChecker: auth.NewAuthorizationChecker(nil, logr.Discard()),
+		authConfig:  cfg,
+		log:         logr.Discard(),
+	}
+
+	registeredPaths := map[string]ko.PathInfo{}
+	hh.impersonateHandler(http.NewServeMux(), registeredPaths)
+	assert.NotContains(t, registeredPaths, "/-/impersonate", "not enabled")
+
+	cfg.Impersonation = &auth.Impersonation{Entitlement: "support:impersonate", TTL: 10 * time.Minute}
+	hh.authExchanger, err = auth.NewExchanger(context.Background(), *cfg, cacheManager, passwordIdentities{})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	hh.impersonateHandler(mux, registeredPaths)
+	assert.Contains(t, registeredPaths, "/-/impersonate")
+
+	serve := func(form url.Values, authContext auth.AuthContext) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/-/impersonate", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if authContext != nil {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), authContext))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	staff := auth.AuthContext{"sub": "carol", "entitlements": []any{"support:impersonate"}}
+
+	assert.Equal(t, http.StatusNotFound, serve(url.Values{"subject": {"alice"}}, nil).Code, "anonymous")
+	assert.Equal(t, http.StatusNotFound, serve(url.Values{"subject": {"alice"}}, auth.AuthContext{"sub": "bob"}).Code, "not entitled")
+	assert.Equal(t, http.StatusBadRequest, serve(url.Values{}, staff).Code, "no subject")
+
+	w := serve(url.Values{"subject": {"alice"}, "reason": {"ticket 42"}}, staff)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var token ImpersonationToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.Equal(t, "alice", token.Subject)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, int64(600), token.ExpiresIn)
+
+	claims, err := cfg.VerifyLocalToken(token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, map[string]any{"sub": "carol"}, claims["act"])
+}
@@ -0,0 +1,242 @@
+package host
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/kdex-tech/host-manager/internal/sign"
+	"golang.org/x/text/language"
+)
+
+const (
+	// IntegrityAnnotation enables, on a host, the manifests of the hashes of
+	// the renders of its pages, recorded for each snapshot of the host, i.e.
+	// each rebuild of its mux which changed a render.
+	IntegrityAnnotation = "kdex.dev/integrity"
+	// IntegrityRecord records the manifests and serves them at /-/integrity.
+	IntegrityRecord = "record"
+	// IntegrityVerify also verifies the renders served against the
+	// manifests, refusing to serve those matching none.
+	IntegrityVerify = "verify"
+
+	// IntegrityHeader reports the verification of a served page: verified,
+	// stale when it matches a previous snapshot, or unverified when the page
+	// was rendered for a visitor time zone or theme variant, which the
+	// manifests do not cover.
+	IntegrityHeader = "X-KDex-Integrity"
+
+	maxIntegrityManifests = 10
+)
+
+// IntegrityEntry is the hash of the render of a page in a language.
+type IntegrityEntry struct {
+	Lang   string `json:"lang"`
+	Page   string `json:"page"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// IntegrityManifest is the hashes of the renders of the pages of a snapshot
+// of a host. The signature is a JWT of the snapshot and of the hashes by
+// path, signed by the active key of the host, see /.well-known/jwks.json.
+type IntegrityManifest struct {
+	Entries   []IntegrityEntry `json:"entries"`
+	Host      string           `json:"host"`
+	Issued    time.Time        `json:"issued"`
+	Signature string           `json:"signature,omitempty"`
+	Snapshot  string           `json:"snapshot"`
+}
+
+// ParseIntegrity returns the integrity mode of the annotations of a host, ""
+// when IntegrityAnnotation is not set.
+func ParseIntegrity(annotations map[string]string) (string, error) {
+	switch mode := annotations[IntegrityAnnotation]; mode {
+	case "", IntegrityRecord, IntegrityVerify:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid %s annotation %q, expected %s or %s", IntegrityAnnotation, mode, IntegrityRecord, IntegrityVerify)
+	}
+}
+
+// SetIntegrity sets the integrity mode of the host, "" disables the
+// manifests. The manifests are recorded when the mux is rebuilt.
+func (hh *HostHandler) SetIntegrity(mode string) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.integrityMode = mode
+	if mode == "" {
+		hh.integrityManifests = nil
+	}
+}
+
+// recordIntegrity records the manifest of the renders of the pages after the
+// mux is rebuilt, unless they are those of the latest snapshot.
+func (hh *HostHandler) recordIntegrity(pageHandlers []page.PageHandler, translations *Translations) {
+	hh.mu.RLock()
+	mode := hh.integrityMode
+	var pair *keys.KeyPair
+	if hh.authConfig != nil {
+		pair = hh.authConfig.ActivePair
+	}
+	latest := ""
+	if n := len(hh.integrityManifests); n > 0 {
+		latest = hh.integrityManifests[n-1].Snapshot
+	}
+	hh.mu.RUnlock()
+
+	if mode == "" {
+		return
+	}
+
+	entries := []IntegrityEntry{}
+	for _, ph := range pageHandlers {
+		for _, l := range translations.Languages() {
+			rendered, err := hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+			if err != nil {
+				hh.log.Error(err, "failed to render page for integrity manifest", "page", ph.Name, "language", l)
+				continue
+			}
+			pagePath := ph.BasePath()
+			if l.String() != hh.defaultLanguage {
+				pagePath = "/" + l.String() + pagePath
+			}
+			entries = append(entries, IntegrityEntry{Lang: l.String(), Page: ph.Name, Path: pagePath, SHA256: renderHash(rendered)})
+		}
+	}
+	slices.SortFunc(entries, func(a, b IntegrityEntry) int {
+		return cmp.Or(cmp.Compare(a.Page, b.Page), cmp.Compare(a.Lang, b.Lang))
+	})
+
+	snapshot := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(snapshot, "%s\x00%s\x00%s\n", e.Page, e.Lang, e.SHA256)
+	}
+	manifest := IntegrityManifest{
+		Entries:  entries,
+		Host:     hh.Name,
+		Issued:   time.Now().UTC(),
+		Snapshot: hex.EncodeToString(snapshot.Sum(nil)),
+	}
+	if manifest.Snapshot == latest {
+		return
+	}
+
+	if pair != nil {
+		pages := map[string]string{}
+		for _, e := range entries {
+			pages[e.Path] = e.SHA256
+		}
+		signature, err := sign.SignClaims(pair.Private, pair.KeyId, jwt.MapClaims{
+			"iat":      manifest.Issued.Unix(),
+			"iss":      hh.Name,
+			"pages":    pages,
+			"snapshot": manifest.Snapshot,
+		})
+		if err != nil {
+			hh.log.Error(err, "failed to sign integrity manifest", "snapshot", manifest.Snapshot)
+		}
+		manifest.Signature = signature
+	}
+
+	hh.mu.Lock()
+	if hh.integrityMode != "" {
+		hh.integrityManifests = append(hh.integrityManifests, manifest)
+		if len(hh.integrityManifests) > maxIntegrityManifests {
+			hh.integrityManifests = hh.integrityManifests[len(hh.integrityManifests)-maxIntegrityManifests:]
+		}
+	}
+	hh.mu.Unlock()
+}
+
+// verifyIntegrity sets IntegrityHeader for the render of the page. It
+// reports false when the render matches no snapshot, i.e. it was altered
+// after it was recorded.
+func (hh *HostHandler) verifyIntegrity(w http.ResponseWriter, name string, l language.Tag, rendered string, canonical bool) bool {
+	hh.mu.RLock()
+	mode := hh.integrityMode
+	manifests := hh.integrityManifests
+	hh.mu.RUnlock()
+
+	if mode != IntegrityVerify {
+		return true
+	}
+	if !canonical {
+		w.Header().Set(IntegrityHeader, "unverified")
+		return true
+	}
+
+	sum := renderHash(rendered)
+	recorded := false
+	for i := len(manifests) - 1; i >= 0; i-- {
+		for _, e := range manifests[i].Entries {
+			if e.Page != name || e.Lang != l.String() {
+				continue
+			}
+			recorded = true
+			if e.SHA256 != sum {
+				continue
+			}
+			if i == len(manifests)-1 {
+				w.Header().Set(IntegrityHeader, "verified; snapshot="+manifests[i].Snapshot)
+			} else {
+				w.Header().Set(IntegrityHeader, "stale; snapshot="+manifests[i].Snapshot)
+			}
+			return true
+		}
+	}
+
+	// Pages published since the latest snapshot are not recorded yet.
+	if !recorded {
+		w.Header().Set(IntegrityHeader, "unverified")
+		return true
+	}
+
+	integrityMismatchesCounter.WithLabelValues(hh.Name, name, l.String()).Inc()
+	hh.log.Error(fmt.Errorf("render matches no integrity manifest"), "refusing to serve altered page", "page", name, "language", l, "sha256", sum)
+	return false
+}
+
+// IntegrityGet serves the latest manifest, or the manifest of the snapshot
+// query parameter when set.
+func (hh *HostHandler) IntegrityGet(w http.ResponseWriter, r *http.Request) {
+	hh.mu.RLock()
+	manifests := hh.integrityManifests
+	hh.mu.RUnlock()
+
+	if len(manifests) == 0 {
+		http.Error(w, "no integrity manifest recorded yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	manifest := manifests[len(manifests)-1]
+	if snapshot := r.URL.Query().Get("snapshot"); snapshot != "" {
+		i := slices.IndexFunc(manifests, func(m IntegrityManifest) bool { return m.Snapshot == snapshot })
+		if i < 0 {
+			http.Error(w, fmt.Sprintf("snapshot %s not found", snapshot), http.StatusNotFound)
+			return
+		}
+		manifest = manifests[i]
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		hh.log.Error(err, "failed to encode integrity manifest")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func renderHash(rendered string) string {
+	sum := sha256.Sum256([]byte(rendered))
+	return hex.EncodeToString(sum[:])
+}
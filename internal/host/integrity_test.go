@@ -0,0 +1,130 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseIntegrity(t *testing.T) {
+	for _, value := range []string{"", IntegrityRecord, IntegrityVerify} {
+		mode, err := ParseIntegrity(map[string]string{IntegrityAnnotation: value})
+		require.NoError(t, err)
+		assert.Equal(t, value, mode)
+	}
+
+	_, err := ParseIntegrity(map[string]string{IntegrityAnnotation: "enforce"})
+	assert.Error(t, err)
+}
+
+func TestHostHandler_Integrity(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetIntegrity(IntegrityVerify)
+
+	hh.Pages.Set(page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><body>Approved content</body></html>`,
+	})
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/integrity", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	manifest := IntegrityManifest{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &manifest))
+	assert.Equal(t, "shop", manifest.Host)
+	require.Len(t, manifest.Entries, 1)
+	assert.Equal(t, IntegrityEntry{Lang: "en", Page: "home", Path: "/home", SHA256: manifest.Entries[0].SHA256}, manifest.Entries[0])
+
+	assert.Empty(t, manifest.Signature, "auth not enabled")
+
+	rr = httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/home/", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "verified; snapshot="+manifest.Snapshot, rr.Header().Get(IntegrityHeader))
+
+	rr = httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/integrity?snapshot=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Alter the render between approval and serving.
+	require.NoError(t, hh.cacheManager.GetCache("page", cache.CacheOptions{}).Set(context.Background(), "home:en", "<html><body>Altered content</body></html>"))
+
+	rr = httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/home/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.False(t, strings.Contains(rr.Body.String(), "Altered"))
+}
+
+func TestHostHandler_IntegritySignature(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetIntegrity(IntegrityRecord)
+
+	hh.Pages.Set(page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><body>Approved content</body></html>`,
+	})
+
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{ActivePair: pair}, "http")
+
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/integrity", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	manifest := IntegrityManifest{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &manifest))
+	require.Len(t, manifest.Entries, 1)
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(manifest.Signature, claims, func(*jwt.Token) (any, error) {
+		return pair.Private.Public(), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Snapshot, claims["snapshot"])
+	assert.Equal(t, map[string]any{"/home": manifest.Entries[0].SHA256}, claims["pages"])
+}
+
+func TestHostHandler_IntegrityDisabled(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	rr := httptest.NewRecorder()
+	hh.ServeHTTP(rr, httptest.NewRequest("GET", "/-/integrity", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,262 @@
+package host
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/linkcheck"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// LinkCheckAnnotation enables, on a host, the periodic validation of the
+	// renders of its pages and the check of their internal links and assets.
+	// The value is the interval of the checks, e.g. "1h".
+	LinkCheckAnnotation = "kdex.dev/link-check"
+	// LinkCheckIgnoreAnnotation suppresses, on a page binding, the issues of
+	// the comma separated rules or path.Match patterns of targets, e.g.
+	// "duplicate-id,/legacy/*".
+	LinkCheckIgnoreAnnotation = "kdex.dev/link-check-ignore"
+
+	linkCheckRetry       = 10 * time.Second
+	minLinkCheckInterval = time.Minute
+)
+
+// LinkPageCheck is the check of the render of a page in a language.
+type LinkPageCheck struct {
+	Issues []linkcheck.Issue `json:"issues"`
+	Lang   string            `json:"lang"`
+	Page   string            `json:"page"`
+	Path   string            `json:"path"`
+}
+
+// LinkReport is the latest check of the pages of a host.
+type LinkReport struct {
+	Checked  time.Time       `json:"checked"`
+	Interval string          `json:"interval"`
+	Pages    []LinkPageCheck `json:"pages"`
+}
+
+// ParseLinkCheck returns the interval of the checks of the annotations of a
+// host, 0 when LinkCheckAnnotation is not set.
+func ParseLinkCheck(annotations map[string]string) (time.Duration, error) {
+	value := annotations[LinkCheckAnnotation]
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < minLinkCheckInterval {
+		return 0, fmt.Errorf("invalid %s annotation %q, expected a duration of at least %s", LinkCheckAnnotation, value, minLinkCheckInterval)
+	}
+	return interval, nil
+}
+
+// SetLinkCheck sets the interval of the checks of the host, 0 disables them.
+// Changing the interval restarts the checks.
+func (hh *HostHandler) SetLinkCheck(interval time.Duration) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if interval == hh.linkCheckInterval {
+		return
+	}
+	if hh.linkCheckCancel != nil {
+		hh.linkCheckCancel()
+		hh.linkCheckCancel = nil
+	}
+	hh.linkCheckInterval = interval
+
+	if interval == 0 {
+		hh.linkReport = nil
+		linkIssuesGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hh.linkCheckCancel = cancel
+	go hh.runLinkChecks(ctx, interval)
+}
+
+func (hh *HostHandler) runLinkChecks(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		// Hosts which are not ready yet are checked again shortly.
+		if hh.CheckLinks() == nil {
+			timer.Reset(linkCheckRetry)
+		} else {
+			timer.Reset(interval)
+		}
+	}
+}
+
+// CheckLinks validates the renders of the pages in each language of the
+// host and checks their internal links and assets against the mux, which
+// serves draft content too. It returns nil while the host is not ready.
+func (hh *HostHandler) CheckLinks() *LinkReport {
+	hh.mu.RLock()
+	mux := hh.Mux
+	interval := hh.linkCheckInterval
+	translations := hh.Translations
+	hh.mu.RUnlock()
+
+	if mux == nil || hh.Pages == nil {
+		return nil
+	}
+
+	report := &LinkReport{Checked: time.Now(), Interval: interval.String(), Pages: []LinkPageCheck{}}
+	statuses := map[string]int{}
+
+	linkIssuesGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+	for _, ph := range hh.Pages.List() {
+		report.Pages = append(report.Pages, hh.checkPage(mux, ph, &translations, statuses)...)
+	}
+	slices.SortFunc(report.Pages, func(a, b LinkPageCheck) int {
+		return cmp.Or(cmp.Compare(a.Page, b.Page), cmp.Compare(a.Lang, b.Lang))
+	})
+
+	hh.mu.Lock()
+	if hh.linkCheckInterval == interval {
+		hh.linkReport = report
+	}
+	hh.mu.Unlock()
+
+	return report
+}
+
+func (hh *HostHandler) checkPage(mux http.Handler, ph page.PageHandler, translations *Translations, statuses map[string]int) []LinkPageCheck {
+	// Pattern pages need their parameters to be rendered.
+	if ph.Page == nil || ph.BasePath() == "" || strings.Contains(ph.PatternPath(), "{") {
+		return nil
+	}
+
+	ignored := []string{}
+	for entry := range strings.SplitSeq(ph.Annotations[LinkCheckIgnoreAnnotation], ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			ignored = append(ignored, entry)
+		}
+	}
+
+	checks := []LinkPageCheck{}
+	for _, l := range translations.Languages() {
+		pagePath := ph.BasePath()
+		if l.String() != hh.defaultLanguage {
+			pagePath = "/" + l.String() + pagePath
+		}
+
+		rendered, err := hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+		if err != nil {
+			hh.log.Error(err, "failed to render page for link check", "page", ph.Name, "language", l)
+			continue
+		}
+		found, links, err := linkcheck.Validate(rendered)
+		if err != nil {
+			hh.log.Error(err, "failed to validate page", "page", ph.Name, "language", l)
+			continue
+		}
+
+		base := &url.URL{Path: pagePath}
+		for _, link := range links {
+			target, ok := linkcheck.Internal(base, link)
+			if !ok {
+				continue
+			}
+			status, ok := statuses[target]
+			if !ok {
+				status = probe(mux, target)
+				statuses[target] = status
+			}
+			if broken(status) {
+				found = append(found, linkcheck.Issue{
+					Message: fmt.Sprintf("GET %s returned %d", target, status),
+					Rule:    linkcheck.RuleBrokenLink,
+					Target:  target,
+				})
+			}
+		}
+
+		issues := []linkcheck.Issue{}
+		counts := map[string]float64{}
+		for _, issue := range found {
+			if linkcheck.Suppressed(issue, ignored) {
+				continue
+			}
+			issues = append(issues, issue)
+			counts[issue.Rule]++
+		}
+		for _, rule := range []string{linkcheck.RuleBrokenLink, linkcheck.RuleDuplicateID, linkcheck.RuleStrayEndTag, linkcheck.RuleUnclosedElement} {
+			linkIssuesGauge.WithLabelValues(hh.Name, ph.Name, l.String(), rule).Set(counts[rule])
+		}
+
+		checks = append(checks, LinkPageCheck{Issues: issues, Lang: l.String(), Page: ph.Name, Path: pagePath})
+	}
+	return checks
+}
+
+// broken reports whether the status of a link means it is broken. Links to
+// protected content answer 401 or 403 and are not.
+func broken(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusGone || status >= http.StatusInternalServerError
+}
+
+// probe returns the status of a HEAD, or a GET when HEAD is not allowed, of
+// the target served by the mux.
+func probe(mux http.Handler, target string) int {
+	status := http.StatusNotFound
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		r := httptest.NewRequest(method, target, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		status = w.Code
+		if status != http.StatusMethodNotAllowed {
+			break
+		}
+	}
+	return status
+}
+
+// LinkReportGet serves the latest check of the pages, of the page query
+// parameter when set.
+func (hh *HostHandler) LinkReportGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	hh.mu.RLock()
+	latest := hh.linkReport
+	interval := hh.linkCheckInterval
+	hh.mu.RUnlock()
+
+	report := LinkReport{Interval: interval.String(), Pages: []LinkPageCheck{}}
+	if latest != nil {
+		report.Checked = latest.Checked
+		pageName := r.URL.Query().Get("page")
+		for _, check := range latest.Pages {
+			if pageName == "" || pageName == check.Page {
+				report.Pages = append(report.Pages, check)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		hh.log.Error(err, "failed to encode link report")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,106 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/linkcheck"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseLinkCheck(t *testing.T) {
+	interval, err := ParseLinkCheck(map[string]string{})
+	require.NoError(t, err)
+	assert.Zero(t, interval)
+
+	interval, err = ParseLinkCheck(map[string]string{LinkCheckAnnotation: "6h"})
+	require.NoError(t, err)
+	assert.Equal(t, 6*time.Hour, interval)
+
+	for _, value := range []string{"daily", "30s", "-1h"} {
+		_, err := ParseLinkCheck(map[string]string{LinkCheckAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHostHandler_CheckLinks(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.linkCheckInterval = time.Hour
+	pair := (*keys.GenerateECDSAKeyPair())[0]
+
+	assert.Nil(t, hh.CheckLinks(), "host not set")
+
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{ActivePair: pair}, "http")
+
+	hh.Pages.Set(page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><body><a href="/about">About</a><a href="missing">Missing</a><a href="#top">Top</a><a href="https://example.com/">Out</a></body></html>`,
+	})
+	hh.Pages.Set(page.PageHandler{
+		Annotations: map[string]string{LinkCheckIgnoreAnnotation: "/legacy/*, stray-end-tag"},
+		Name:        "about",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "About",
+			Paths: kdexv1alpha1.Paths{BasePath: "/about"},
+		},
+		MainTemplate: `<html><body><a href="/home">Home</a><a href="/legacy/team">Team</a><p id="a"></p><p id="a"></p></span></body></html>`,
+	})
+
+	report := hh.CheckLinks()
+	require.NotNil(t, report)
+	require.Len(t, report.Pages, 2)
+
+	assert.Equal(t, LinkPageCheck{
+		Issues: []linkcheck.Issue{{Message: "The id is used by 2 elements", Rule: linkcheck.RuleDuplicateID, Target: "#a"}},
+		Lang:   "en",
+		Page:   "about",
+		Path:   "/about",
+	}, report.Pages[0])
+	assert.Equal(t, LinkPageCheck{
+		Issues: []linkcheck.Issue{{Message: "GET /missing returned 404", Rule: linkcheck.RuleBrokenLink, Target: "/missing"}},
+		Lang:   "en",
+		Page:   "home",
+		Path:   "/home",
+	}, report.Pages[1])
+
+	get := func(query string) LinkReport {
+		r := httptest.NewRequest(http.MethodGet, "/-/admin/links"+query, nil)
+		r.Header.Set("Authorization", bearerToken(t, pair, "hosts:shop:read", "hosts:shop:write"))
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		got := LinkReport{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got
+	}
+
+	w := httptest.NewRecorder()
+	hh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/admin/links", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "anonymous")
+
+	got := get("?page=home")
+	assert.Equal(t, "1h0m0s", got.Interval)
+	assert.Equal(t, report.Pages[1:], got.Pages)
+
+	hh.SetLinkCheck(0)
+	assert.Nil(t, hh.linkReport)
+}
@@ -1,15 +1,27 @@
 package host
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/kdex-tech/host-manager/internal/auth"
 	kdexhttp "github.com/kdex-tech/host-manager/internal/http"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 )
 
+// loginProvider is an OIDC provider offered on the login page, available to
+// its template as .Extra.OIDCProviders.
+type loginProvider struct {
+	DisplayName string
+	Name        string
+	// URL logs in with the provider.
+	URL string
+}
+
 func (hh *HostHandler) LoginGet(w http.ResponseWriter, r *http.Request) {
 	if hh.applyCachingHeaders(w, r, []kdexv1alpha1.SecurityRequirement{{"authenticated": {}}}, hh.reconcileTime) {
 		return
@@ -21,15 +33,40 @@ func (hh *HostHandler) LoginGet(w http.ResponseWriter, r *http.Request) {
 		returnURL = "/"
 	}
 
-	// TODO: when OIDC is enabled show it on the Login screen so that we retain ability to login locally
-
-	// If OIDC is configured, force login through it
-	if authCodeURL := hh.authExchanger.AuthCodeURL(returnURL); authCodeURL != "" {
+	// Log in with the OIDC provider chosen on the login page
+	if provider := query.Get("provider"); provider != "" {
+		authCodeURL := hh.authExchanger.ProviderAuthCodeURL(provider, returnURL)
+		if authCodeURL == "" {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
 		http.Redirect(w, r, authCodeURL, http.StatusSeeOther)
 		return
 	}
 
-	// Fallback: Local Login Page
+	// If a single OIDC provider is configured, force login through it
+	providers := hh.authConfig.OIDCProviders()
+	if len(providers) == 1 {
+		if authCodeURL := hh.authExchanger.ProviderAuthCodeURL(providers[0].Name, returnURL); authCodeURL != "" {
+			http.Redirect(w, r, authCodeURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	// Fallback: Local Login Page, offering the OIDC providers as well
+	extra := map[string]any{}
+	if len(providers) > 0 {
+		loginProviders := []loginProvider{}
+		for _, provider := range providers {
+			loginProviders = append(loginProviders, loginProvider{
+				DisplayName: provider.DisplayName,
+				Name:        provider.Name,
+				URL:         "/-/login?provider=" + url.QueryEscape(provider.Name) + "&return=" + url.QueryEscape(returnURL),
+			})
+		}
+		extra["OIDCProviders"] = loginProviders
+	}
+
 	l, err := kdexhttp.GetLang(r, hh.defaultLanguage, hh.Translations.Languages())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -39,7 +76,7 @@ func (hh *HostHandler) LoginGet(w http.ResponseWriter, r *http.Request) {
 	rendered := hh.renderUtilityPage(
 		kdexv1alpha1.LoginUtilityPageType,
 		l,
-		map[string]any{},
+		withBrand(extra, hh.brandFor(r)),
 		&hh.Translations,
 	)
 
@@ -77,7 +114,17 @@ func (hh *HostHandler) LoginPost(w http.ResponseWriter, r *http.Request) {
 
 	// Local login doesn't have a clientID, so we pass empty string
 	// We also don't need the ID Token for cookie-based session
-	ts, err := hh.authExchanger.LoginLocal(r.Context(), username, password, "", "", auth.AuthMethodLocal)
+	ts, err := hh.authExchanger.LoginLocal(hh.authConfig.WithClientIP(r), username, password, "", "", auth.AuthMethodLocal)
+	if locked := (*auth.LoginLockedError)(nil); errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())))
+		http.Redirect(w, r, "/-/login?error=locked&return="+url.QueryEscape(returnURL), http.StatusSeeOther)
+		return
+	}
+	if challenge := (*auth.MFAChallenge)(nil); errors.As(err, &challenge) {
+		// The login is completed with the second factor of the subject
+		mfaRedirect(w, r, challenge.ID, returnURL, "")
+		return
+	}
 	if err != nil {
 		// FAILED: 401 Unauthorized / render login page again with error message?
 		// For now simple redirect back to login
@@ -87,26 +134,48 @@ func (hh *HostHandler) LoginPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// SUCCESS: Set cookie and redirect
+	hh.setSessionCookie(w, ts.AccessToken)
+
+	http.Redirect(w, r, returnURL, http.StatusSeeOther)
+}
+
+// setSessionCookie sets the cookie of the session of the access token.
+func (hh *HostHandler) setSessionCookie(w http.ResponseWriter, accessToken string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     hh.authConfig.CookieName,
-		Value:    ts.AccessToken,
+		Value:    accessToken,
 		Path:     "/",
+		Domain:   hh.authConfig.CookieDomain,
 		HttpOnly: true,
 		Secure:   hh.isSecure(),
 		SameSite: http.SameSiteLaxMode,
 	})
-
-	http.Redirect(w, r, returnURL, http.StatusSeeOther)
 }
 
 func (hh *HostHandler) LogoutPost(w http.ResponseWriter, r *http.Request) {
 	returnURL := "/"
 
+	// Revoke the session token so that copies of it are not honored either
+	provider := auth.DefaultOIDCProvider
+	if authContext, ok := auth.GetAuthContext(r.Context()); ok {
+		jti, _ := authContext["jti"].(string)
+		if err := hh.authConfig.Revocations.Revoke(r.Context(), jti); err != nil {
+			hh.log.Error(err, "failed to revoke session token", "jti", jti)
+		}
+
+		// The session ends at the named provider the user logged in with
+		idp, _ := authContext["idp"].(string)
+		if name, found := strings.CutPrefix(idp, "oidc:"); found {
+			provider = name
+		}
+	}
+
 	// Clear local cookies
 	http.SetCookie(w, &http.Cookie{
 		Name:     hh.authConfig.CookieName,
 		Value:    "",
 		Path:     "/",
+		Domain:   hh.authConfig.CookieDomain,
 		MaxAge:   -1, // Tells browser to delete immediately
 		HttpOnly: true,
 		Secure:   hh.isSecure(),
@@ -114,7 +183,7 @@ func (hh *HostHandler) LogoutPost(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Build the OIDC Logout URL
-	logoutURLString, err := hh.authExchanger.EndSessionURL()
+	logoutURLString, err := hh.authExchanger.ProviderEndSessionURL(provider)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,149 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_LoginGet_OIDCProviders(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"authorization_endpoint": server.URL + "/auth",
+			"issuer":                 server.URL,
+			"jwks_uri":               server.URL + "/jwks.json",
+			"token_endpoint":         server.URL + "/token",
+		})
+	}))
+	defer server.Close()
+
+	cfg := &auth.Config{}
+	cfg.OIDC.Providers = []auth.OIDCProvider{
+		{ClientID: "corp-client", DisplayName: "Corporate", Name: "corp", ProviderURL: server.URL, RedirectURL: "/-/oauth/callback/corp"},
+		{ClientID: "google-client", DisplayName: "Google", Name: "google", ProviderURL: server.URL, RedirectURL: "/-/oauth/callback/google"},
+	}
+	exchanger, err := auth.NewExchanger(context.Background(), *cfg, nil, nil)
+	require.NoError(t, err)
+
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{DefaultLang: "en", BrandName: "Shop"}, nil, 0, nil, nil, nil, "", nil, nil, exchanger, cfg, "http")
+	hh.AddOrUpdateUtilityPage(page.PageHandler{
+		MainTemplate: `<html><body>[[ range .Extra.OIDCProviders ]][[ .Name ]]:[[ .DisplayName ]];[[ end ]]</body></html>`,
+		Name:         "login",
+		UtilityPage:  &kdexv1alpha1.KDexUtilityPageSpec{Type: kdexv1alpha1.LoginUtilityPageType},
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hh.LoginGet(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/-/login?return=/cart")
+	require.Equal(t, http.StatusOK, w.Code, "several providers are offered on the login page")
+	assert.Equal(t, "<html><body>corp:Corporate;google:Google;</body></html>", w.Body.String())
+
+	w = get("/-/login?provider=google&return=/cart")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	location := w.Header().Get("Location")
+	assert.Contains(t, location, server.URL+"/auth?")
+	assert.Contains(t, location, "client_id=google-client")
+	assert.Contains(t, location, "redirect_uri=%2F-%2Foauth%2Fcallback%2Fgoogle")
+	assert.Contains(t, location, "state=%2Fcart")
+
+	assert.Equal(t, http.StatusNotFound, get("/-/login?provider=unknown").Code)
+
+	// A single provider is logged in with directly
+	cfg.OIDC.Providers = cfg.OIDC.Providers[:1]
+	exchanger, err = auth.NewExchanger(context.Background(), *cfg, nil, nil)
+	require.NoError(t, err)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{DefaultLang: "en", BrandName: "Shop"}, nil, 0, nil, nil, nil, "", nil, nil, exchanger, cfg, "http")
+
+	w = get("/-/login?return=/cart")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "client_id=corp-client")
+}
+
+// passwordIdentities is a local identity provider accepting the password
+// "password" of every subject.
+type passwordIdentities struct{}
+
+func (passwordIdentities) FindInternal(subject string, password string) (jwt.MapClaims, error) {
+	if password != "password" {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return jwt.MapClaims{"sub": subject}, nil
+}
+
+func (passwordIdentities) FindInternalMFA(subject string, identity jwt.MapClaims) (auth.MFA, error) {
+	return auth.MFA{}, nil
+}
+
+func (passwordIdentities) FindInternalRolesAndEntitlements(subject string) ([]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (passwordIdentities) SetInternalMFA(subject string, secret string) error {
+	return nil
+}
+
+func TestHostHandler_LoginPost_Lockout(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", new(1*time.Hour))
+	cfg, err := auth.NewConfig(
+		&kdexv1alpha1.Auth{},
+		func() (map[string]auth.AuthClient, error) { return map[string]auth.AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]auth.OIDCProvider, string, error) { return nil, "", nil },
+		"shop",
+		"http://shop.example.com",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	exchanger, err := auth.NewExchanger(context.Background(), *cfg, cacheManager, passwordIdentities{})
+	require.NoError(t, err)
+
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{DefaultLang: "en", BrandName: "Shop"}, nil, 0, nil, nil, nil, "", nil, nil, exchanger, cfg, "http")
+
+	post := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"alice"}, "password": {password}, "return": {"/cart"}}
+		r := httptest.NewRequest(http.MethodPost, "/-/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+
+	for range 6 {
+		w := post("wrong")
+		require.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Contains(t, w.Header().Get("Location"), "error=invalid_credentials")
+	}
+
+	w := post("password")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/-/login?error=locked")
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Empty(t, w.Result().Cookies(), "no session while locked out")
+}
@@ -0,0 +1,47 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/mime"
+)
+
+// MediaTypesAnnotation holds, on a host, the JSON encoded media types its
+// bodies are detected as before the generic detection, e.g. the proprietary
+// formats it misclassifies: [{"type": "application/vnd.acme.drawing",
+// "extensions": [".acd"], "magic": ["41434d45"]}].
+const MediaTypesAnnotation = "kdex.dev/media-types"
+
+// ParseMediaTypes returns the registry of the media types of the annotations
+// of a host, nil when MediaTypesAnnotation is not set.
+func ParseMediaTypes(annotations map[string]string) (*mime.Registry, error) {
+	value := annotations[MediaTypesAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	mediaTypes := []mime.MediaType{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mediaTypes); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", MediaTypesAnnotation, err)
+	}
+
+	registry, err := mime.NewRegistry(mediaTypes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", MediaTypesAnnotation, err)
+	}
+	return registry, nil
+}
+
+// SetMediaTypes sets the registry of the media types of the host, nil only
+// detects with the generic detection. The sniffer picks it up when the host
+// is set.
+func (hh *HostHandler) SetMediaTypes(registry *mime.Registry) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.mediaTypes = registry
+}
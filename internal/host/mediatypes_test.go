@@ -0,0 +1,26 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaTypes(t *testing.T) {
+	registry, err := ParseMediaTypes(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, registry, "not set")
+
+	registry, err = ParseMediaTypes(map[string]string{
+		MediaTypesAnnotation: `[{"type": "application/vnd.acme.drawing", "extensions": [".acd"], "magic": ["41434d45"]}]`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.acme.drawing", registry.TypeByExtension("plan.acd"))
+
+	_, err = ParseMediaTypes(map[string]string{MediaTypesAnnotation: `[{"type": "application/vnd.acme.drawing", "suffix": ".acd"}]`})
+	assert.ErrorContains(t, err, "unknown field")
+
+	_, err = ParseMediaTypes(map[string]string{MediaTypesAnnotation: `[{"type": "application/vnd.acme.drawing", "magic": ["ACME"]}]`})
+	assert.ErrorContains(t, err, "invalid magic")
+}
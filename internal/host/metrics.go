@@ -0,0 +1,251 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/text/language"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	a11yViolationsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_a11y_violations",
+			Help: "Number of accessibility violations of each impact in the render of each page in each language.",
+		},
+		[]string{"host", "page", "lang", "impact"},
+	)
+	archiveFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_archive_failures_total",
+			Help: "Number of versions of the renders of the pages which failed to be archived.",
+		},
+		[]string{"host"},
+	)
+	faultsInjectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_faults_injected_total",
+			Help: "Number of faults of each kind injected in the calls of each function.",
+		},
+		[]string{"host", "function", "fault"},
+	)
+	federationPeerFetchedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_federation_peer_fetched_timestamp_seconds",
+			Help: "Unix time of the latest successful fetch of the catalog of each federation peer.",
+		},
+		[]string{"host", "peer"},
+	)
+	integrityMismatchesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_integrity_mismatches_total",
+			Help: "Number of renders of each page in each language refused because they matched no integrity manifest.",
+		},
+		[]string{"host", "page", "lang"},
+	)
+	linkIssuesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_link_check_issues",
+			Help: "Number of issues of each rule found by the latest link check of each page in each language.",
+		},
+		[]string{"host", "page", "lang", "rule"},
+	)
+	pageRequestDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kdex_host_page_request_duration_seconds",
+			Help:    "Time to serve the requests of each page, navigation or translation handler in each language by status.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host", "handler", "page", "lang", "status"},
+	)
+	pageRequestsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_page_requests_total",
+			Help: "Number of requests served by each page, navigation or translation handler in each language by status.",
+		},
+		[]string{"host", "handler", "page", "lang", "status"},
+	)
+	performanceBudgetGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_performance_budget_usage",
+			Help: "Ratio of each performance budget used by the render of each page in each language, above 1 when exceeded.",
+		},
+		[]string{"host", "page", "lang", "budget"},
+	)
+	probeDurationGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_probe_duration_seconds",
+			Help: "Latency of the latest request of each probe of each page binding or function.",
+		},
+		[]string{"host", "owner", "probe"},
+	)
+	probeUpGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_probe_up",
+			Help: "Whether the latest request of each probe of each page binding or function got the expected response, 1 when it did.",
+		},
+		[]string{"host", "owner", "probe"},
+	)
+	sloBudgetRemainingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_slo_error_budget_remaining",
+			Help: "Ratio of the error budget of each SLO left over its window, negative once overspent.",
+		},
+		[]string{"host", "slo"},
+	)
+	sloBurnRateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_slo_burn_rate",
+			Help: "Rate the error budget of each SLO is spent at over each window, 1 spending it exactly over the window of the SLO.",
+		},
+		[]string{"host", "slo", "window"},
+	)
+	translationKeysGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_translation_keys",
+			Help: "Number of keys of the default language translated in each language.",
+		},
+		[]string{"host", "lang"},
+	)
+	translationMissingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_translation_missing_keys",
+			Help: "Number of keys of the default language missing from each language.",
+		},
+		[]string{"host", "lang"},
+	)
+	themeAssignmentsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_theme_assignments_total",
+			Help: "Number of sessions assigned to each variant of the theme experiment.",
+		},
+		[]string{"host", "experiment", "variant"},
+	)
+	themeExposuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kdex_host_theme_exposures_total",
+			Help: "Number of pages served in each variant of the theme experiment.",
+		},
+		[]string{"host", "experiment", "variant"},
+	)
+	translationViolationsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kdex_host_translation_violations",
+			Help: "Number of translated values breaking the glossary or the translation memory in each language.",
+		},
+		[]string{"host", "lang"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		a11yViolationsGauge,
+		archiveFailuresCounter,
+		faultsInjectedCounter,
+		federationPeerFetchedGauge,
+		integrityMismatchesCounter,
+		linkIssuesGauge,
+		pageRequestDurationHistogram,
+		pageRequestsCounter,
+		performanceBudgetGauge,
+		probeDurationGauge,
+		probeUpGauge,
+		sloBudgetRemainingGauge,
+		sloBurnRateGauge,
+		themeAssignmentsCounter,
+		themeExposuresCounter,
+		translationKeysGauge,
+		translationMissingGauge,
+		translationViolationsGauge,
+	)
+}
+
+// observeTranslations replaces the translation gauges of the host with the
+// report, dropping languages which are gone.
+func observeTranslations(host string, report TranslationReport) {
+	translationKeysGauge.DeletePartialMatch(prometheus.Labels{"host": host})
+	translationMissingGauge.DeletePartialMatch(prometheus.Labels{"host": host})
+	translationViolationsGauge.DeletePartialMatch(prometheus.Labels{"host": host})
+	for _, lang := range report.Languages {
+		translationKeysGauge.WithLabelValues(host, lang.Lang).Set(float64(lang.Translated))
+		translationMissingGauge.WithLabelValues(host, lang.Lang).Set(float64(lang.Missing))
+		translationViolationsGauge.WithLabelValues(host, lang.Lang).Set(float64(len(lang.Violations)))
+	}
+}
+
+type pageObservationKey struct{}
+
+type pageObservation struct {
+	lang string
+	page string
+}
+
+// observePage records the page served in the metrics of the request, for the
+// handlers serving several pages.
+func observePage(ctx context.Context, page string) {
+	if observation, ok := ctx.Value(pageObservationKey{}).(*pageObservation); ok {
+		observation.page = page
+	}
+}
+
+// observeLang records the language served in the metrics of the request. The
+// requests failing before it is negotiated have no language.
+func observeLang(ctx context.Context, lang language.Tag) {
+	if observation, ok := ctx.Value(pageObservationKey{}).(*pageObservation); ok {
+		observation.lang = lang.String()
+	}
+}
+
+// withPageMetrics counts the requests served by the handler and observes their
+// latency, by page, language and status. The page is the one of the handler
+// unless it observes another.
+func (hh *HostHandler) withPageMetrics(handler string, page string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		observation := &pageObservation{page: page}
+		sw := &statusResponseWriter{ResponseWriter: w}
+		next(sw, r.WithContext(context.WithValue(r.Context(), pageObservationKey{}, observation)))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		labels := []string{hh.Name, handler, observation.page, observation.lang, strconv.Itoa(sw.status)}
+		pageRequestsCounter.WithLabelValues(labels...).Inc()
+		pageRequestDurationHistogram.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusResponseWriter records the status of a response.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *statusResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,47 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_WithPageMetrics(t *testing.T) {
+	translations, err := NewTranslations("en", map[string]kdexv1alpha1.KDexTranslationSpec{
+		"messages": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"greeting": "Hello"}},
+				{Lang: "fr", KeysAndValues: map[string]string{"greeting": "Bonjour"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	hh := &HostHandler{
+		Name:            "metrics-test",
+		Translations:    *translations,
+		authConfig:      &auth.Config{},
+		defaultLanguage: "en",
+		log:             logr.Discard(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /-/translation/{l10n}", hh.withPageMetrics("translation", "", hh.TranslationGet))
+	mux.HandleFunc("GET /home", hh.withPageMetrics("page", "home", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+	}))
+
+	for _, target := range []string{"/-/translation/fr", "/-/translation/fr", "/-/translation/xx-invalid", "/home"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(pageRequestsCounter.WithLabelValues("metrics-test", "translation", "", "fr", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(pageRequestsCounter.WithLabelValues("metrics-test", "translation", "", "", "400")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(pageRequestsCounter.WithLabelValues("metrics-test", "page", "home", "", "503")))
+}
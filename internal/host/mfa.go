@@ -0,0 +1,194 @@
+package host
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+	kdexhttp "github.com/kdex-tech/host-manager/internal/http"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/kdex-tech/host-manager/internal/qr"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// MFAUtilityPageType is the utility page completing the local logins
+	// with a second factor, enrolling it first when the subject has none. It
+	// is not part of the KDexUtilityPageType enum of the CRD, a utility page
+	// is made the MFA page with UtilityPageTypeAnnotation. Hosts without one
+	// use the built in page.
+	MFAUtilityPageType kdexv1alpha1.KDexUtilityPageType = "MFA"
+
+	mfaPath = "/-/login/mfa"
+)
+
+// MFA is the template data of the MFA utility page, available as .Extra.MFA.
+// The page posts the Challenge, the TOTP code and the Return URL to
+// /-/login/mfa.
+type MFA struct {
+	Challenge string
+	// Enroll is true when the subject enrolls its second factor, scanning
+	// QRCode or entering Secret in its authenticator app.
+	Enroll bool
+	// Error is the error of the previous attempt, e.g. invalid_code.
+	Error string
+	// QRCode is the data URL of the SVG image of the QR code of URI.
+	QRCode template.URL
+	Return string
+	Secret string
+	// URI is the otpauth URI of the second factor to enroll.
+	URI string
+}
+
+// mfaRedirect redirects the login of the challenge to the MFA page.
+func mfaRedirect(w http.ResponseWriter, r *http.Request, challenge string, returnURL string, errorCode string) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+	if errorCode != "" {
+		query.Set("error", errorCode)
+	}
+	query.Set("return", returnURL)
+	http.Redirect(w, r, mfaPath+"?"+query.Encode(), http.StatusSeeOther)
+}
+
+// MFAGet renders the MFA page of the challenge of a login, with the second
+// factor to enroll when the subject has none. Expired challenges start the
+// login over.
+func (hh *HostHandler) MFAGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	returnURL := cmp.Or(query.Get("return"), "/")
+
+	challenge, found, err := hh.authExchanger.LookupMFAChallenge(r.Context(), query.Get("challenge"))
+	if err != nil {
+		hh.log.Error(err, "failed to look up MFA challenge")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Redirect(w, r, "/-/login?error=mfa_expired&return="+url.QueryEscape(returnURL), http.StatusSeeOther)
+		return
+	}
+
+	l, err := kdexhttp.GetLang(r, hh.defaultLanguage, hh.Translations.Languages())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	extra := withBrand(map[string]any{}, hh.brandFor(r))
+	mfa := MFA{Challenge: challenge.ID, Error: query.Get("error"), Return: returnURL}
+	if challenge.Enroll != "" {
+		issuer, _ := hh.brandOf(extra)
+		mfa.Enroll = true
+		mfa.Secret = challenge.Enroll
+		mfa.URI = auth.TOTPURI(issuer, challenge.Subject, challenge.Enroll)
+		code, err := qr.Encode(mfa.URI)
+		if err != nil {
+			// The secret is entered in the authenticator app instead
+			hh.log.Error(err, "failed to encode the QR code of the second factor", "subject", challenge.Subject)
+		} else {
+			mfa.QRCode = template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(code.SVG(4))))
+		}
+	}
+	extra["MFA"] = mfa
+
+	rendered := hh.renderUtilityPage(MFAUtilityPageType, l, extra, &hh.Translations)
+	if rendered == "" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// The page holds the secret being enrolled
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Language", l.String())
+	w.Header().Set("Content-Type", "text/html")
+	_, _ = w.Write([]byte(rendered))
+}
+
+// MFAPost completes the login of the challenge with the TOTP code and sets
+// the session cookie. Wrong codes return to the MFA page while the challenge
+// lasts, and to the login page once the second factor is locked out.
+func (hh *HostHandler) MFAPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	challenge := r.FormValue("challenge")
+	code := strings.ReplaceAll(strings.TrimSpace(r.FormValue("code")), " ", "")
+	returnURL := cmp.Or(r.FormValue("return"), "/")
+
+	ts, err := hh.authExchanger.VerifyMFA(hh.authConfig.WithClientIP(r), challenge, code)
+	if errors.Is(err, auth.ErrInvalidMFACode) {
+		mfaRedirect(w, r, challenge, returnURL, "invalid_code")
+		return
+	}
+	if locked := (*auth.LoginLockedError)(nil); errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())))
+		http.Redirect(w, r, "/-/login?error=locked&return="+url.QueryEscape(returnURL), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		hh.log.Error(err, "second factor login failed")
+		http.Redirect(w, r, "/-/login?error=mfa_failed&return="+url.QueryEscape(returnURL), http.StatusSeeOther)
+		return
+	}
+
+	hh.setSessionCookie(w, ts.AccessToken)
+	http.Redirect(w, r, returnURL, http.StatusSeeOther)
+}
+
+var defaultMFAPage = page.PageHandler{
+	MainTemplate: mfaTemplate,
+	Name:         "kdex-mfa",
+	UtilityPage:  &kdexv1alpha1.KDexUtilityPageSpec{Type: MFAUtilityPageType},
+}
+
+const mfaTemplate = `<!DOCTYPE html>
+<html lang="[[ .Language ]]">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Verification - [[ .BrandName ]]</title>
+[[ .Meta ]]
+[[ .Theme ]]
+[[ .HeadScript ]]
+<style>
+.kdex-mfa { font-family: system-ui, sans-serif; margin: 0 auto; max-width: 24rem; padding: 1rem; }
+.kdex-mfa label { display: block; font-weight: 600; margin-top: .5rem; }
+.kdex-mfa input { box-sizing: border-box; font-family: monospace; font-size: 1.5rem; letter-spacing: .25rem; width: 100%; }
+.kdex-mfa button { margin-top: .75rem; }
+.kdex-mfa code { word-break: break-all; }
+</style>
+</head>
+<body>
+<main class="kdex-mfa">
+[[ with .Extra.MFA ]]
+<h1>Two-step verification</h1>
+[[ if .Enroll ]]
+<p>Scan the QR code with your authenticator app, or enter the key below, then enter the code it shows.</p>
+[[ with .QRCode ]]<img src="[[ . ]]" alt="QR code of the key to add to your authenticator app" width="228" height="228">[[ end ]]
+<p><code>[[ .Secret ]]</code></p>
+[[ else ]]
+<p>Enter the code shown by your authenticator app.</p>
+[[ end ]]
+[[ if .Error ]]<p role="alert">The code is not valid, try again.</p>[[ end ]]
+<form method="post" action="/-/login/mfa">
+<input type="hidden" name="challenge" value="[[ .Challenge ]]">
+<input type="hidden" name="return" value="[[ .Return ]]">
+<label for="kdex-mfa-code">Code</label>
+<input id="kdex-mfa-code" name="code" inputmode="numeric" autocomplete="one-time-code" pattern="[0-9 ]*" maxlength="7" required autofocus>
+<button type="submit">Verify</button>
+</form>
+[[ end ]]
+</main>
+[[ .FootScript ]]
+</body>
+</html>
+`
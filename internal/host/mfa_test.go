@@ -0,0 +1,119 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// mfaIdentities is a local identity provider requiring a second factor of
+// every subject.
+type mfaIdentities struct {
+	secrets map[string]string
+}
+
+func (m *mfaIdentities) FindInternal(subject string, password string) (jwt.MapClaims, error) {
+	return jwt.MapClaims{"sub": subject}, nil
+}
+
+func (m *mfaIdentities) FindInternalMFA(subject string, identity jwt.MapClaims) (auth.MFA, error) {
+	return auth.MFA{Required: true, Secret: m.secrets[subject]}, nil
+}
+
+func (m *mfaIdentities) FindInternalRolesAndEntitlements(subject string) ([]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (m *mfaIdentities) SetInternalMFA(subject string, secret string) error {
+	m.secrets[subject] = secret
+	return nil
+}
+
+func TestHostHandler_MFA(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", new(1*time.Hour))
+	cfg, err := auth.NewConfig(
+		&kdexv1alpha1.Auth{},
+		func() (map[string]auth.AuthClient, error) { return map[string]auth.AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]auth.OIDCProvider, string, error) { return nil, "", nil },
+		"shop",
+		"http://shop.example.com",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	identities := &mfaIdentities{secrets: map[string]string{}}
+	exchanger, err := auth.NewExchanger(context.Background(), *cfg, cacheManager, identities)
+	require.NoError(t, err)
+
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{DefaultLang: "en", BrandName: "Shop"}, nil, 0, nil, nil, nil, "", nil, nil, exchanger, cfg, "http")
+
+	serve := func(method string, target string, form url.Values) *httptest.ResponseRecorder {
+		var r *http.Request
+		if form != nil {
+			r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, target, nil)
+		}
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/-/login", url.Values{"username": {"alice"}, "password": {"secret"}, "return": {"/cart"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Empty(t, w.Result().Cookies(), "no session before the second factor")
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/-/login/mfa", location.Path)
+	assert.Equal(t, "/cart", location.Query().Get("return"))
+	challenge := location.Query().Get("challenge")
+	require.NotEmpty(t, challenge)
+
+	// The built in page enrolls the second factor
+	w = serve(http.MethodGet, location.String(), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), `<img src="data:image/svg&#43;xml;base64,`)
+	assert.Contains(t, w.Body.String(), `name="challenge" value="`+challenge+`"`)
+
+	looked, found, err := exchanger.LookupMFAChallenge(context.Background(), challenge)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Contains(t, w.Body.String(), "<code>"+looked.Enroll+"</code>")
+
+	w = serve(http.MethodPost, "/-/login/mfa", url.Values{"challenge": {challenge}, "code": {"000000"}, "return": {"/cart"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "error=invalid_code")
+	assert.Empty(t, w.Result().Cookies())
+
+	code, err := auth.TOTPCode(looked.Enroll, time.Now())
+	require.NoError(t, err)
+	w = serve(http.MethodPost, "/-/login/mfa", url.Values{"challenge": {challenge}, "code": {code[:3] + " " + code[3:]}, "return": {"/cart"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/cart", w.Header().Get("Location"))
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.Equal(t, cfg.CookieName, w.Result().Cookies()[0].Name)
+	assert.Equal(t, looked.Enroll, identities.secrets["alice"])
+
+	// The completed challenge starts the login over
+	w = serve(http.MethodGet, location.String(), nil)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/-/login?error=mfa_expired")
+}
@@ -0,0 +1,124 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/pkg/hostmiddleware"
+)
+
+// MiddlewaresAnnotation holds, on a host, the JSON encoded list of the
+// MiddlewareDeclaration of the custom middlewares it runs, e.g.
+// [{"name": "tenant", "order": 10, "paths": ["/shop/"], "config": {"header": "X-Tenant"}},
+// {"name": "headers", "plugin": "headers.so"}].
+const MiddlewaresAnnotation = "kdex.dev/middlewares"
+
+// MiddlewareDeclaration declares a custom middleware of a host, see
+// pkg/hostmiddleware.
+type MiddlewareDeclaration struct {
+	// Config is passed as is to the factory of the middleware.
+	Config json.RawMessage `json:"config,omitempty"`
+	// Name is the name the middleware is registered under, or names the
+	// middleware of the plugin in the logs and errors.
+	Name string `json:"name"`
+	// Order sorts the middlewares, the lowest first, i.e. outermost. The
+	// middlewares of the same order run in the order they are declared.
+	Order int `json:"order,omitempty"`
+	// Paths are the prefixes of the paths of the requests the middleware
+	// runs for, every request when empty.
+	Paths []string `json:"paths,omitempty"`
+	// Plugin is the file of the Go plugin of the middleware in the plugin
+	// directory of the host manager, when it is not compiled in.
+	Plugin string `json:"plugin,omitempty"`
+}
+
+// ParseMiddlewares returns the declarations of MiddlewaresAnnotation, sorted
+// by order, nil when it is not set.
+func ParseMiddlewares(annotations map[string]string) ([]MiddlewareDeclaration, error) {
+	value := annotations[MiddlewaresAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	declarations := []MiddlewareDeclaration{}
+	if err := json.Unmarshal([]byte(value), &declarations); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", MiddlewaresAnnotation, err)
+	}
+
+	for _, declaration := range declarations {
+		if declaration.Name == "" {
+			return nil, fmt.Errorf("invalid %s annotation: middlewares require a name", MiddlewaresAnnotation)
+		}
+		for _, path := range declaration.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("invalid %s annotation: path %q of middleware %s is not absolute", MiddlewaresAnnotation, path, declaration.Name)
+			}
+		}
+	}
+
+	slices.SortStableFunc(declarations, func(a, b MiddlewareDeclaration) int { return a.Order - b.Order })
+	return declarations, nil
+}
+
+// SetMiddlewares replaces the custom middlewares of the host by those of the
+// declarations, nil removes them. The middlewares wrap the authentication of
+// the requests, so that they also run for the requests it refuses.
+func (hh *HostHandler) SetMiddlewares(declarations []MiddlewareDeclaration) error {
+	wraps := make([]func(http.Handler) http.Handler, 0, len(declarations))
+	for _, declaration := range declarations {
+		factory, ok := hostmiddleware.Lookup(declaration.Name)
+		if declaration.Plugin != "" {
+			var err error
+			if factory, err = hostmiddleware.Open(hh.MiddlewarePluginDir, declaration.Plugin); err != nil {
+				return fmt.Errorf("middleware %s: %w", declaration.Name, err)
+			}
+		} else if !ok {
+			return fmt.Errorf("middleware %s is not registered, expected one of %v", declaration.Name, hostmiddleware.Names())
+		}
+
+		wrap, err := factory(declaration.Config)
+		if err != nil {
+			return fmt.Errorf("middleware %s: %w", declaration.Name, err)
+		}
+		if wrap == nil {
+			return fmt.Errorf("middleware %s: the factory returned no middleware", declaration.Name)
+		}
+		wraps = append(wraps, scopeMiddleware(wrap, declaration.Paths))
+	}
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.middlewares = nil
+	if len(wraps) > 0 {
+		hh.middlewares = func(next http.Handler) http.Handler {
+			for _, wrap := range slices.Backward(wraps) {
+				next = wrap(next)
+			}
+			return next
+		}
+	}
+
+	return nil
+}
+
+// scopeMiddleware runs the middleware for the requests of the paths only,
+// for every request when there are none.
+func scopeMiddleware(wrap func(http.Handler) http.Handler, paths []string) func(http.Handler) http.Handler {
+	if len(paths) == 0 {
+		return wrap
+	}
+	return func(next http.Handler) http.Handler {
+		wrapped := wrap(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.ContainsFunc(paths, func(path string) bool { return strings.HasPrefix(r.URL.Path, path) }) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
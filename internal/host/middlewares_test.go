@@ -0,0 +1,101 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/page"
+	"github.com/kdex-tech/host-manager/pkg/hostmiddleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func init() {
+	// host-test-trace appends its config to the X-Trace header of the
+	// responses, recording the order the middlewares ran in.
+	hostmiddleware.Register("host-test-trace", func(config json.RawMessage) (func(http.Handler) http.Handler, error) {
+		var mark string
+		if err := json.Unmarshal(config, &mark); err != nil {
+			return nil, err
+		}
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Trace", mark)
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+	})
+}
+
+func TestParseMiddlewares(t *testing.T) {
+	declarations, err := ParseMiddlewares(nil)
+	require.NoError(t, err)
+	assert.Nil(t, declarations)
+
+	declarations, err = ParseMiddlewares(map[string]string{
+		MiddlewaresAnnotation: `[{"name": "b", "order": 20}, {"name": "a", "order": 10, "paths": ["/shop/"]}, {"name": "c", "order": 20, "plugin": "c.so"}]`,
+	})
+	require.NoError(t, err)
+	require.Len(t, declarations, 3)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{declarations[0].Name, declarations[1].Name, declarations[2].Name})
+	assert.Equal(t, []string{"/shop/"}, declarations[0].Paths)
+
+	for _, value := range []string{
+		`not json`,
+		`[{"order": 1}]`,
+		`[{"name": "a", "paths": ["shop"]}]`,
+	} {
+		_, err := ParseMiddlewares(map[string]string{MiddlewaresAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHostHandler_Middlewares(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.Pages.Set(page.PageHandler{
+		Name: "home",
+		Page: &kdexv1alpha1.KDexPageBindingSpec{
+			Label: "Home",
+			Paths: kdexv1alpha1.Paths{BasePath: "/home"},
+		},
+		MainTemplate: `<html><head>[[ .Theme ]]</head><body>home</body></html>`,
+	})
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Shop",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	declarations, err := ParseMiddlewares(map[string]string{
+		MiddlewaresAnnotation: `[
+			{"name": "host-test-trace", "order": 20, "config": "inner"},
+			{"name": "host-test-trace", "order": 10, "config": "outer"},
+			{"name": "host-test-trace", "order": 30, "config": "scoped", "paths": ["/-/"]}
+		]`,
+	})
+	require.NoError(t, err)
+	require.NoError(t, hh.SetMiddlewares(declarations))
+
+	trace := func(path string) []string {
+		rr := httptest.NewRecorder()
+		hh.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Header().Values("X-Trace")
+	}
+
+	assert.Equal(t, []string{"outer", "inner"}, trace("/home/"))
+	assert.Equal(t, []string{"outer", "inner", "scoped"}, trace("/-/healthz"))
+
+	require.NoError(t, hh.SetMiddlewares(nil))
+	assert.Empty(t, trace("/home/"))
+
+	assert.ErrorContains(t, hh.SetMiddlewares([]MiddlewareDeclaration{{Name: "missing"}}), "not registered")
+	assert.ErrorContains(t, hh.SetMiddlewares([]MiddlewareDeclaration{{Name: "host-test-trace", Config: json.RawMessage(`1`)}}), "host-test-trace")
+	assert.ErrorContains(t, hh.SetMiddlewares([]MiddlewareDeclaration{{Name: "plugin", Plugin: "plugin.so"}}), "no plugin directory")
+}
@@ -0,0 +1,123 @@
+package host
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// MockHeader is set on mocked responses to the name of the function.
+	MockHeader = "X-KDex-Mock"
+	// MockStatusHeader selects which declared response of the operation is
+	// mocked. The lowest declared 2xx response is used by default.
+	MockStatusHeader = "X-KDex-Mock-Status"
+)
+
+// mockHandler answers the operations of a function which is not ready yet
+// with responses built from the examples and schemas of its spec.
+func (hh *HostHandler) mockHandler(fn *kdexv1alpha1.KDexFunction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router, err := hh.contractRouter(fn)
+		if err != nil {
+			hh.log.Error(err, "invalid function contract", "function", fn.Name)
+			http.Error(w, "function contract is invalid", http.StatusInternalServerError)
+			return
+		}
+
+		// Spec paths have no trailing slash.
+		lookup := *r
+		lookup.URL = &url.URL{Path: strings.TrimSuffix(r.URL.Path, "/"), RawQuery: r.URL.RawQuery}
+		if lookup.URL.Path == "" {
+			lookup.URL.Path = "/"
+		}
+
+		route, _, err := router.FindRoute(&lookup)
+		if err != nil {
+			if pathDeclared(router, &lookup) {
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+
+		status, response := mockResponse(route.Operation, r.Header.Get(MockStatusHeader))
+
+		w.Header().Set(MockHeader, fn.Name)
+
+		if response == nil || len(response.Content) == 0 {
+			w.WriteHeader(status)
+			return
+		}
+
+		contentType := "application/json"
+		if response.Content.Get(contentType) == nil {
+			contentType = slices.Sorted(maps.Keys(response.Content))[0]
+		}
+		value := mockValue(response.Content.Get(contentType))
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		if s, ok := value.(string); ok && !strings.Contains(contentType, "json") {
+			_, _ = w.Write([]byte(s))
+			return
+		}
+		if err := json.NewEncoder(w).Encode(value); err != nil {
+			hh.log.Error(err, "failed to encode mock response", "function", fn.Name)
+		}
+	})
+}
+
+// mockResponse picks the response of the operation to mock: the requested
+// status when the operation declares it, otherwise the lowest 2xx, otherwise
+// the default response.
+func mockResponse(op *openapi.Operation, requested string) (int, *openapi.Response) {
+	if op.Responses == nil {
+		return http.StatusOK, nil
+	}
+
+	if code, err := strconv.Atoi(requested); err == nil {
+		if ref := op.Responses.Value(requested); ref != nil && ref.Value != nil {
+			return code, ref.Value
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(op.Responses.Map())) {
+		code, err := strconv.Atoi(key)
+		if err != nil || code < 200 || code > 299 {
+			continue
+		}
+		if ref := op.Responses.Value(key); ref != nil {
+			return code, ref.Value
+		}
+	}
+
+	if ref := op.Responses.Default(); ref != nil {
+		return http.StatusOK, ref.Value
+	}
+
+	return http.StatusOK, nil
+}
+
+// mockValue returns the example of the media type, the first of its named
+// examples, or a value generated from its schema.
+func mockValue(mediaType *openapi.MediaType) any {
+	if mediaType.Example != nil {
+		return mediaType.Example
+	}
+	for _, name := range slices.Sorted(maps.Keys(mediaType.Examples)) {
+		if ref := mediaType.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return ref.Value.Value
+		}
+	}
+	return ko.GenerateExample(mediaType.Schema)
+}
@@ -0,0 +1,134 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_MockFunctions(t *testing.T) {
+	item := openapi.NewObjectSchema().
+		WithProperty("id", openapi.NewUUIDSchema()).
+		WithProperty("count", openapi.NewIntegerSchema())
+
+	created := openapi.NewResponse().WithDescription("created").WithJSONSchema(item)
+	created.Content.Get("application/json").Examples = openapi.Examples{
+		"basic": {Value: openapi.NewExample(map[string]any{"id": "example"})},
+	}
+
+	api := ko.OpenAPI{
+		BasePath: "/api/items",
+		Paths: map[string]ko.PathItem{
+			"/api/items/{id}": {
+				Get: &openapi.Operation{
+					OperationID: "get-item",
+					Parameters:  openapi.Parameters{ko.PathParam("id", "")},
+					Responses: openapi.NewResponses(
+						openapi.WithStatus(200, &openapi.ResponseRef{
+							Value: openapi.NewResponse().WithDescription("item").WithJSONSchema(item),
+						}),
+						openapi.WithStatus(404, &openapi.ResponseRef{
+							Value: openapi.NewResponse().WithDescription("missing"),
+						}),
+					),
+				},
+			},
+			"/api/items": {
+				Post: &openapi.Operation{
+					OperationID: "create-item",
+					Responses:   openapi.NewResponses(openapi.WithStatus(201, &openapi.ResponseRef{Value: created})),
+				},
+			},
+		},
+	}
+
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "items"
+	fn.Generation = 1
+	fn.Spec.API = *api.ToKDexAPI()
+	fn.Status.State = kdexv1alpha1.KDexFunctionStateBuildValid
+
+	tests := []struct {
+		name          string
+		mockFunctions bool
+		method        string
+		target        string
+		mockStatus    string
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:          "generated from schema",
+			mockFunctions: true,
+			method:        http.MethodGet,
+			target:        "/api/items/a",
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"count":0,"id":"00000000-0000-0000-0000-000000000000"}`,
+		},
+		{
+			name:          "named example",
+			mockFunctions: true,
+			method:        http.MethodPost,
+			target:        "/api/items",
+			wantStatus:    http.StatusCreated,
+			wantBody:      `{"id":"example"}`,
+		},
+		{
+			name:          "requested status",
+			mockFunctions: true,
+			method:        http.MethodGet,
+			target:        "/api/items/a",
+			mockStatus:    "404",
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "undeclared method",
+			mockFunctions: true,
+			method:        http.MethodDelete,
+			target:        "/api/items/a",
+			wantStatus:    http.StatusMethodNotAllowed,
+		},
+		{
+			name:          "mocking disabled",
+			mockFunctions: false,
+			method:        http.MethodGet,
+			target:        "/api/items/a",
+			wantStatus:    http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheManager, _ := cache.NewCacheManager("", "foo", nil)
+			hh := NewHostHandler(nil, "test-host", "default", logr.Discard(), cacheManager)
+			hh.MockFunctions = tt.mockFunctions
+			hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+				DefaultLang: "en",
+				BrandName:   "KDex",
+			}, nil, 0, nil, nil, nil, "", nil, []kdexv1alpha1.KDexFunction{fn}, &auth.Exchanger{}, &auth.Config{}, "http")
+
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.mockStatus != "" {
+				r.Header.Set(MockStatusHeader, tt.mockStatus)
+			}
+			w := httptest.NewRecorder()
+			hh.Mux.ServeHTTP(w, r)
+
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+				assert.Equal(t, "items", w.Header().Get(MockHeader))
+			}
+		})
+	}
+}
@@ -74,6 +74,10 @@ func (hh *HostHandler) BuildMenuEntries(
 }
 
 func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
+	if personalization := hh.personalize(r); personalization != nil {
+		r = r.WithContext(withPersonalization(r.Context(), personalization))
+	}
+
 	if hh.applyCachingHeaders(w, r, []kdexv1alpha1.SecurityRequirement{{"authenticated": {}}}, hh.reconcileTime) {
 		return
 	}
@@ -84,8 +88,8 @@ func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
 	defaultLang := hh.defaultLanguage
 	translations := hh.Translations
 	reconcileTime := hh.reconcileTime
-	brandName := hh.host.BrandName
-	org := hh.host.Organization
+	brand := hh.brandForLocked(r)
+	brandName, org := hh.brandOf(withBrand(map[string]any{}, brand))
 
 	var pageHandler *page.PageHandler
 	for _, ph := range hh.Pages.List() {
@@ -100,16 +104,29 @@ func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "page not found", http.StatusNotFound)
 		return
 	}
+	observePage(r.Context(), pageHandler.Name)
 
 	l, err := kdexhttp.GetLang(r, defaultLang, translations.Languages())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	observeLang(r.Context(), l)
 
 	navCache := hh.cacheManager.GetCache("nav", cache.CacheOptions{})
 	userHash := hh.getUserHash(r)
 	cacheKey := fmt.Sprintf("%s:%s:%s:%s", navKey, basePath, l.String(), userHash)
+	loc, _ := visitorTimeZone(r)
+	if loc != nil {
+		cacheKey += ":" + loc.String()
+	}
+	if brand != nil {
+		cacheKey += ":brand=" + brand.Domain
+	}
+	personalization := personalizationFrom(r.Context())
+	if personalization != nil {
+		cacheKey += ":p=" + personalization.hash
+	}
 
 	rendered, ok, isCurrent, err := navCache.Get(r.Context(), cacheKey)
 	if err == nil && ok {
@@ -128,14 +145,19 @@ func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
 		go func() {
 			bgCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 			defer cancel()
+			if personalization != nil {
+				bgCtx = withPersonalization(bgCtx, personalization)
+			}
 
 			newRender, err := hh.performNavigationRender(
 				bgCtx,
 				l,
+				loc,
 				pageHandler,
 				navKey,
 				translations,
 				defaultLang,
+				brand,
 				brandName,
 				org,
 				reconcileTime,
@@ -152,10 +174,12 @@ func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
 	rendered, err = hh.performNavigationRender(
 		r.Context(),
 		l,
+		loc,
 		pageHandler,
 		navKey,
 		translations,
 		defaultLang,
+		brand,
 		brandName,
 		org,
 		reconcileTime,
@@ -179,10 +203,12 @@ func (hh *HostHandler) NavigationGet(w http.ResponseWriter, r *http.Request) {
 func (hh *HostHandler) performNavigationRender(
 	ctx context.Context,
 	l language.Tag,
+	loc *time.Location,
 	pageHandler *page.PageHandler,
 	navKey string,
 	translations Translations,
 	defaultLang string,
+	brand *Brand,
 	brandName string,
 	org string,
 	reconcileTime time.Time,
@@ -206,10 +232,20 @@ func (hh *HostHandler) performNavigationRender(
 	}
 
 	authContext, _ := auth.GetAuthContext(ctx)
-	extra := map[string]any{}
+	if loc == nil {
+		loc = time.UTC
+	}
+	extra := map[string]any{
+		"Format":   NewFormatter(l, loc),
+		"TimeZone": loc,
+	}
 	if authContext != nil {
 		extra["Identity"] = authContext
 	}
+	withBrand(extra, brand)
+	if personalization := personalizationFrom(ctx); personalization != nil {
+		extra["Personalization"] = personalization.Data
+	}
 
 	renderer := render.Renderer{
 		BasePath:        pageHandler.Page.BasePath,
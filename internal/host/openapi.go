@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 )
 
@@ -36,3 +38,17 @@ func (hh *HostHandler) OpenAPIGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// SystemOpenAPI returns the OpenAPI of the system endpoints every host serves,
+// from which the clients of pkg/hostclient are generated.
+func SystemOpenAPI() *openapi.T {
+	hh := NewHostHandler(nil, "host", "", logr.Discard(), nil)
+	registeredPaths := map[string]ko.PathInfo{}
+
+	hh.mu.Lock()
+	hh.muxWithDefaultsLocked(registeredPaths)
+	hh.mu.Unlock()
+
+	builder := ko.Builder{TypesToInclude: []ko.PathType{ko.SystemPathType}}
+	return builder.BuildOpenAPI("/", hh.Name, registeredPaths, ko.Filter{})
+}
@@ -0,0 +1,196 @@
+package host
+
+import (
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+)
+
+// preflightMaxAge is how long, in seconds, the browsers may cache the answer
+// to a CORS preflight.
+const preflightMaxAge = 600
+
+// optionsMethods are the methods probed on the mux to answer OPTIONS requests.
+var optionsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// withHeadAndOptions answers the OPTIONS requests of the paths registered on
+// the mux with the methods they allow, and the CORS preflights of the origins
+// of the domains of the host with its CORS headers. The paths registered
+// without a method, e.g. those of the functions, answer OPTIONS themselves.
+// HEAD requests are served by the GET handlers, without a body.
+func withHeadAndOptions(mux *http.ServeMux, domains []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			mux.ServeHTTP(&headResponseWriter{ResponseWriter: w}, r)
+			return
+		case http.MethodOptions:
+		default:
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		methods := allowedMethods(mux, r)
+		if len(methods) == 0 {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		allow := strings.Join(methods, ", ")
+
+		w.Header().Set("Allow", allow)
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" && allowedOrigin(origin, domains) {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Allow-Methods", allow)
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(preflightMaxAge))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedMethods returns the methods the mux serves on the path of r, HEAD
+// along with GET, and OPTIONS when it serves any.
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	methods := []string{}
+	for _, method := range optionsMethods {
+		probe := *r
+		probe.Method = method
+		if _, pattern := mux.Handler(&probe); pattern == "" {
+			continue
+		}
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	return append(methods, http.MethodOptions)
+}
+
+// allowedOrigin reports whether the host of the origin is one of the domains,
+// a domain of the form *.example.com matching its subdomains.
+func allowedOrigin(origin string, domains []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	hostname := strings.ToLower(u.Hostname())
+
+	return slices.ContainsFunc(domains, func(domain string) bool {
+		domain = strings.ToLower(domain)
+		if suffix, ok := strings.CutPrefix(domain, "*"); ok {
+			return strings.HasSuffix(hostname, suffix) && len(hostname) > len(suffix)
+		}
+		return hostname == domain
+	})
+}
+
+// headResponseWriter drops the body of the responses to HEAD requests.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// registerHeadAndOptions documents the HEAD and OPTIONS operations served for
+// the page and system paths which do not document their own. HEAD mirrors GET
+// without the content of its responses and OPTIONS, answering the CORS
+// preflights, is public.
+func registerHeadAndOptions(registeredPaths map[string]ko.PathInfo) {
+	for path, info := range registeredPaths {
+		if info.Type != ko.PagePathType && info.Type != ko.SystemPathType {
+			continue
+		}
+
+		paths := maps.Clone(info.API.Paths)
+		for pattern, item := range paths {
+			var first *openapi.Operation
+			for _, method := range optionsMethods {
+				if first = item.GetOperation(method); first != nil {
+					break
+				}
+			}
+			if first == nil {
+				continue
+			}
+			baseID := first.OperationID
+			for _, method := range optionsMethods {
+				baseID = strings.TrimSuffix(baseID, "-"+strings.ToLower(method))
+			}
+
+			if item.Get != nil && item.Head == nil {
+				item.Head = headOperation(item.Get, strings.TrimSuffix(item.Get.OperationID, "-get")+"-head")
+			}
+			if item.Options == nil {
+				item.Options = optionsOperation(first, baseID+"-options")
+			}
+			paths[pattern] = item
+		}
+		info.API.Paths = paths
+		registeredPaths[path] = info
+	}
+}
+
+func headOperation(get *openapi.Operation, operationID string) *openapi.Operation {
+	head := *get
+	head.Description = "HEAD of " + get.Description
+	head.OperationID = operationID
+	head.RequestBody = nil
+	head.Summary = get.Summary + " (headers)"
+	if get.Responses != nil {
+		head.Responses = openapi.NewResponsesWithCapacity(get.Responses.Len())
+		for status, ref := range get.Responses.Map() {
+			if ref.Ref == "" && ref.Value != nil {
+				response := *ref.Value
+				response.Content = nil
+				ref = &openapi.ResponseRef{Value: &response}
+			}
+			head.Responses.Set(status, ref)
+		}
+	}
+	return &head
+}
+
+func optionsOperation(op *openapi.Operation, operationID string) *openapi.Operation {
+	parameters := openapi.Parameters{}
+	for _, p := range op.Parameters {
+		if p.Value != nil && p.Value.In == openapi.ParameterInPath {
+			parameters = append(parameters, p)
+		}
+	}
+
+	return &openapi.Operation{
+		Description: "OPTIONS lists the allowed methods in Allow and answers the CORS preflights of the domains of the host",
+		OperationID: operationID,
+		Parameters:  parameters,
+		Responses: openapi.NewResponses(
+			openapi.WithName("204", &openapi.Response{Description: new("Allowed methods and CORS headers")}),
+		),
+		Security: &openapi.SecurityRequirements{},
+		Summary:  "Allowed methods",
+		Tags:     op.Tags,
+	}
+}
@@ -0,0 +1,94 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_headAndOptions(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		Routing:     kdexv1alpha1.Routing{Domains: []string{"shop.example.com", "*.example.org"}},
+	}, nil, 0, nil, nil, nil, "", nil, nil, nil, nil, "http")
+
+	serve := func(method string, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+
+	get := serve(http.MethodGet, "/-/capabilities", nil)
+	require.Equal(t, http.StatusOK, get.Code)
+	require.NotEmpty(t, get.Body.String())
+
+	head := serve(http.MethodHead, "/-/capabilities", nil)
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "application/json", head.Header().Get("Content-Type"))
+	assert.Empty(t, head.Body.String(), "HEAD has no body")
+
+	options := serve(http.MethodOptions, "/-/capabilities", nil)
+	assert.Equal(t, http.StatusNoContent, options.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", options.Header().Get("Allow"))
+	assert.Empty(t, options.Header().Get("Access-Control-Allow-Origin"))
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{name: "domain", origin: "https://shop.example.com", want: true},
+		{name: "wildcard domain", origin: "https://cdn.example.org", want: true},
+		{name: "wildcard parent", origin: "https://example.org"},
+		{name: "foreign", origin: "https://evil.example.net"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(http.MethodOptions, "/-/capabilities", http.Header{
+				"Access-Control-Request-Headers": {"authorization"},
+				"Access-Control-Request-Method":  {http.MethodGet},
+				"Origin":                         {tt.origin},
+			})
+			require.Equal(t, http.StatusNoContent, w.Code)
+			if !tt.want {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				return
+			}
+			assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, "authorization", w.Header().Get("Access-Control-Allow-Headers"))
+			assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "Origin", w.Header().Get("Vary"))
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodOptions, "/-/unknown", nil).Code)
+
+	hh.mu.RLock()
+	item := hh.registeredPaths["/-/capabilities"].API.Paths["/-/capabilities"]
+	hh.mu.RUnlock()
+	require.NotNil(t, item.Head)
+	assert.Equal(t, "capabilities-head", item.Head.OperationID)
+	assert.Nil(t, item.Head.Responses.Value("200").Value.Content)
+	assert.NotNil(t, item.Get.Responses.Value("200").Value.Content, "GET keeps its content")
+	require.NotNil(t, item.Options)
+	assert.Equal(t, "capabilities-options", item.Options.OperationID)
+	assert.Empty(t, *item.Options.Security, "preflights are public")
+
+	resource, _, requirements := hh.authzRequirements(http.MethodOptions, "/-/capabilities")
+	assert.Equal(t, "backends", resource)
+	assert.Empty(t, requirements)
+}
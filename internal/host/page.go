@@ -16,7 +16,17 @@ func (hh *HostHandler) pageHandlerFunc(
 	ph page.PageHandler,
 	translations *Translations,
 ) func(w http.ResponseWriter, r *http.Request) {
+	loaders, err := ParseDataLoaders(ph.Annotations)
+	if err != nil {
+		hh.log.Error(err, "ignoring the data loaders of the page", "page", ph.Name)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		variant := hh.resolveThemeVariant(w, r)
+		if variant != "" {
+			r = r.WithContext(withThemeVariant(r.Context(), variant))
+		}
+
 		shouldReturn := hh.handleAuth(
 			r,
 			w,
@@ -28,6 +38,11 @@ func (hh *HostHandler) pageHandlerFunc(
 			return
 		}
 
+		personalization := hh.personalize(r)
+		if personalization != nil {
+			r = r.WithContext(withPersonalization(r.Context(), personalization))
+		}
+
 		if hh.applyCachingHeaders(w, r, hh.pageRequirements(&ph), hh.reconcileTime) {
 			return
 		}
@@ -37,9 +52,49 @@ func (hh *HostHandler) pageHandlerFunc(
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		observeLang(r.Context(), l)
 
+		// Pages are rendered and cached per time zone for the visitors which
+		// negotiated one, per variant of the theme experiment, per brand of
+		// the domain, and per personalization context.
+		extra := map[string]any{}
 		pageCache := hh.cacheManager.GetCache("page", cache.CacheOptions{})
 		cacheKey := fmt.Sprintf("%s:%s", ph.Name, l.String())
+		if loc, _ := visitorTimeZone(r); loc != nil {
+			extra["TimeZone"] = loc
+			cacheKey += ":" + loc.String()
+		}
+		if variant != "" {
+			extra["ThemeVariant"] = variant
+			cacheKey += ":theme=" + variant
+		}
+		if brand := hh.brandFor(r); brand != nil {
+			extra["Brand"] = brand
+			cacheKey += ":brand=" + brand.Domain
+		}
+		if personalization != nil {
+			extra["Personalization"] = personalization.Data
+			cacheKey += ":p=" + personalization.hash
+		}
+
+		// Pages with data loaders are rendered on every request, their data
+		// is cached per loader instead.
+		if len(loaders) > 0 {
+			extra["Data"] = hh.loadData(r.Context(), ph.Name, loaders, l)
+
+			rendered, err := hh.L10nRender(ph, nil, l, extra, translations)
+			if err != nil {
+				hh.log.Error(err, "failed to render page", "page", ph.Name, "language", l)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !hh.verifyIntegrity(w, ph.Name, l, rendered, false) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			hh.serveRendered(w, l, ph.Name, rendered)
+			return
+		}
 
 		rendered, ok, isCurrent, err := pageCache.Get(r.Context(), cacheKey)
 		if err != nil {
@@ -56,7 +111,7 @@ func (hh *HostHandler) pageHandlerFunc(
 					bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 					defer cancel()
 
-					newRender, err := hh.L10nRender(p, nil, lang, map[string]any{}, trans)
+					newRender, err := hh.L10nRender(p, nil, lang, extra, trans)
 					if err == nil {
 						_ = pageCache.Set(bgCtx, cacheKey, newRender)
 					} else {
@@ -66,12 +121,16 @@ func (hh *HostHandler) pageHandlerFunc(
 			}
 
 			// Serve the cached content (Current or Stale)
+			if !hh.verifyIntegrity(w, ph.Name, l, rendered, len(extra) == 0) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
 			hh.serveRendered(w, l, ph.Name, rendered)
 			return
 		}
 
 		// 2. Cache Miss: Synchronous Render
-		rendered, err = hh.L10nRender(ph, nil, l, map[string]any{}, translations)
+		rendered, err = hh.L10nRender(ph, nil, l, extra, translations)
 		if err != nil {
 			hh.log.Error(err, "failed to render page", "page", ph.Name, "language", l)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -83,6 +142,10 @@ func (hh *HostHandler) pageHandlerFunc(
 			hh.log.Error(err, "failed to set cache", "page", ph.Name, "language", l)
 		}
 
+		if !hh.verifyIntegrity(w, ph.Name, l, rendered, len(extra) == 0) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
 		hh.serveRendered(w, l, ph.Name, rendered)
 	}
 }
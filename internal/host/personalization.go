@@ -0,0 +1,453 @@
+package host
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PersonalizationAnnotation holds, on a host, the JSON encoded
+	// Personalization of its visitors, e.g.
+	// {"providers": [{"name": "user", "type": "claims", "config": {"claims": ["email"]}},
+	// {"name": "geo", "type": "geo", "consent": "functional"}], "redact": ["user.email"]}.
+	PersonalizationAnnotation = "kdex.dev/personalization"
+	// ConsentCookie holds the comma separated categories of the cookies and
+	// the processing the visitor consented to, e.g. "functional,analytics".
+	ConsentCookie = "kdex_consent"
+
+	// PersonalizationClaims exposes claims of the visitor, config
+	// {"claims": ["email", "roles"]}, nothing for anonymous visitors.
+	PersonalizationClaims = "claims"
+	// PersonalizationConsent exposes the categories of ConsentCookie as a
+	// set, e.g. {"analytics": true}.
+	PersonalizationConsent = "consent"
+	// PersonalizationFlags exposes the feature flags of the visitor, config
+	// {"flags": {"newCheckout": 20}} with the percentage of the visitors each
+	// flag is on for. The visitors are bucketed by subject, so anonymous
+	// visitors only get the flags which are on for everybody.
+	PersonalizationFlags = "flags"
+	// PersonalizationFunction exposes the result of an operation of a
+	// function called with the identity of the visitor, config a DataLoader.
+	PersonalizationFunction = "function"
+	// PersonalizationGeo exposes the country of the visitor, e.g.
+	// {"country": "FR"}, from the first of the headers of config
+	// {"headers": ["CF-IPCountry"]} set by the CDN or the load balancer.
+	PersonalizationGeo = "geo"
+
+	personalizationCacheClass = "personalization"
+	maxPersonalizationTTL     = time.Hour
+)
+
+// defaultGeoHeaders are the country headers of the common CDNs and load
+// balancers.
+var defaultGeoHeaders = []string{"CF-IPCountry", "CloudFront-Viewer-Country", "X-Country-Code", "X-Client-Geo-Country"}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Personalization assembles, for each request, the personalization context
+// of the visitor from its providers. The context is exposed to the templates
+// of the pages and the navigations as .Extra.Personalization, and by
+// /-/bootstrap.
+type Personalization struct {
+	Providers []PersonalizationProvider `json:"providers"`
+	// Redact are the dotted paths of the context which are removed before it
+	// is exposed, e.g. "user.email".
+	Redact []string `json:"redact,omitempty"`
+
+	provide []personalizeFunc
+}
+
+// PersonalizationProvider contributes its data to the context under its name.
+type PersonalizationProvider struct {
+	// Config is the configuration of the type of provider.
+	Config json.RawMessage `json:"config,omitempty"`
+	// Consent is the category of ConsentCookie the visitor must have
+	// consented to for the provider to run.
+	Consent string `json:"consent,omitempty"`
+	Name    string `json:"name"`
+	// TTL is how long the data of an authenticated visitor is reused, it is
+	// not cached when unset. It is capped at 1h.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// Type is one of PersonalizationClaims, PersonalizationConsent,
+	// PersonalizationFlags, PersonalizationFunction or PersonalizationGeo.
+	Type string `json:"type"`
+}
+
+// personalizeFunc returns the data of a provider for the request, nil when it has
+// none.
+type personalizeFunc func(hh *HostHandler, r *http.Request) (any, error)
+
+// personalizationProviders are the types of providers by name. Each parses
+// the configuration of a provider.
+var personalizationProviders = map[string]func(config json.RawMessage) (personalizeFunc, error){
+	PersonalizationClaims:   claimsProvider,
+	PersonalizationConsent:  consentProvider,
+	PersonalizationFlags:    flagsProvider,
+	PersonalizationFunction: functionProvider,
+	PersonalizationGeo:      geoProvider,
+}
+
+// ParsePersonalization returns the personalization of the annotations of a
+// host, nil when PersonalizationAnnotation is not set.
+func ParsePersonalization(annotations map[string]string) (*Personalization, error) {
+	value := annotations[PersonalizationAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	personalization := &Personalization{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(personalization); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", PersonalizationAnnotation, err)
+	}
+
+	seen := map[string]bool{}
+	for _, provider := range personalization.Providers {
+		if provider.Name == "" || strings.Contains(provider.Name, ".") || seen[provider.Name] {
+			return nil, fmt.Errorf("invalid %s annotation: invalid or duplicate provider name %q", PersonalizationAnnotation, provider.Name)
+		}
+		seen[provider.Name] = true
+
+		parse, ok := personalizationProviders[provider.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s annotation: provider %s has unknown type %q, expected one of %v", PersonalizationAnnotation, provider.Name, provider.Type, slices.Sorted(maps.Keys(personalizationProviders)))
+		}
+		if provider.TTL != nil && provider.TTL.Duration < 0 {
+			return nil, fmt.Errorf("invalid %s annotation: ttl of provider %s must not be negative", PersonalizationAnnotation, provider.Name)
+		}
+
+		provide, err := parse(provider.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: provider %s: %w", PersonalizationAnnotation, provider.Name, err)
+		}
+		personalization.provide = append(personalization.provide, provide)
+	}
+
+	return personalization, nil
+}
+
+// SetPersonalization replaces the personalization of the visitors of the
+// host, nil ends it.
+func (hh *HostHandler) SetPersonalization(personalization *Personalization) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	hh.personalization = personalization
+}
+
+// personalizationContext is the personalization context of a request.
+type personalizationContext struct {
+	Data map[string]any
+	// hash identifies the data, the renders are cached per hash.
+	hash string
+}
+
+type personalizationKey struct{}
+
+// personalize assembles the personalization context of the visitor, nil when
+// the host has no personalization. The providers which fail are logged and
+// left out.
+func (hh *HostHandler) personalize(r *http.Request) *personalizationContext {
+	hh.mu.RLock()
+	personalization := hh.personalization
+	hh.mu.RUnlock()
+
+	if personalization == nil {
+		return nil
+	}
+
+	consent := visitorConsent(r)
+	identity := hh.getUserHash(r)
+	data := map[string]any{}
+
+	for i, provider := range personalization.Providers {
+		if provider.Consent != "" && !consent[provider.Consent] {
+			continue
+		}
+
+		value, err := hh.runPersonalizationProvider(r, provider, personalization.provide[i], identity)
+		if err != nil {
+			hh.log.Error(err, "personalization provider failed", "provider", provider.Name, "type", provider.Type)
+			continue
+		}
+		if value != nil {
+			data[provider.Name] = value
+		}
+	}
+
+	// The data is copied so that redacting it leaves the claims of the
+	// request untouched.
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		data = map[string]any{}
+		err = json.Unmarshal(encoded, &data)
+	}
+	if err != nil {
+		hh.log.Error(err, "invalid personalization context")
+		data = map[string]any{}
+	}
+	for _, path := range personalization.Redact {
+		redact(data, strings.Split(path, "."))
+	}
+
+	encoded, _ = json.Marshal(data)
+	sum := sha256.Sum256(encoded)
+	return &personalizationContext{Data: data, hash: hex.EncodeToString(sum[:8])}
+}
+
+// runPersonalizationProvider returns the data of the provider, cached per
+// authenticated visitor for its TTL.
+func (hh *HostHandler) runPersonalizationProvider(
+	r *http.Request,
+	provider PersonalizationProvider,
+	provide personalizeFunc,
+	identity string,
+) (any, error) {
+	if provider.TTL == nil || provider.TTL.Duration == 0 || identity == "anon" {
+		return provide(hh, r)
+	}
+
+	personalizationCache := hh.cacheManager.GetCache(personalizationCacheClass, cache.CacheOptions{TTL: new(maxPersonalizationTTL)})
+	cacheKey := fmt.Sprintf("%s:%s", provider.Name, identity)
+
+	if value, ok, isCurrent, err := personalizationCache.Get(r.Context(), cacheKey); err != nil {
+		hh.log.Error(err, "failed to get from cache", "provider", provider.Name)
+	} else if ok && isCurrent {
+		entry := &dataLoaderEntry{}
+		if err := json.Unmarshal([]byte(value), entry); err == nil && time.Now().Before(entry.Expires) {
+			return decodeData(entry.Data), nil
+		}
+	}
+
+	value, err := provide(hh, r)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(value)
+	if err == nil {
+		var entry []byte
+		entry, err = json.Marshal(dataLoaderEntry{
+			Data:    raw,
+			Expires: time.Now().Add(min(provider.TTL.Duration, maxPersonalizationTTL)),
+		})
+		if err == nil {
+			err = personalizationCache.Set(r.Context(), cacheKey, string(entry))
+		}
+	}
+	if err != nil {
+		hh.log.Error(err, "failed to set cache", "provider", provider.Name)
+	}
+
+	return value, nil
+}
+
+func claimsProvider(config json.RawMessage) (personalizeFunc, error) {
+	var spec struct {
+		Claims []string `json:"claims"`
+	}
+	if err := unmarshalConfig(config, &spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Claims) == 0 {
+		return nil, fmt.Errorf("claims are required")
+	}
+
+	return func(hh *HostHandler, r *http.Request) (any, error) {
+		authContext, ok := auth.GetAuthContext(r.Context())
+		if !ok {
+			return nil, nil
+		}
+		claims := map[string]any{}
+		for _, claim := range spec.Claims {
+			if value, ok := authContext[claim]; ok {
+				claims[claim] = value
+			}
+		}
+		return claims, nil
+	}, nil
+}
+
+func consentProvider(config json.RawMessage) (personalizeFunc, error) {
+	if err := unmarshalConfig(config, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	return func(hh *HostHandler, r *http.Request) (any, error) {
+		return visitorConsent(r), nil
+	}, nil
+}
+
+func flagsProvider(config json.RawMessage) (personalizeFunc, error) {
+	var spec struct {
+		Flags map[string]int `json:"flags"`
+	}
+	if err := unmarshalConfig(config, &spec); err != nil {
+		return nil, err
+	}
+	for name, percent := range spec.Flags {
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("flag %s must be on for 0 to 100 percent of the visitors", name)
+		}
+	}
+
+	return func(hh *HostHandler, r *http.Request) (any, error) {
+		subject := ""
+		if authContext, ok := auth.GetAuthContext(r.Context()); ok {
+			subject, _ = authContext["sub"].(string)
+		}
+
+		flags := make(map[string]any, len(spec.Flags))
+		for name, percent := range spec.Flags {
+			flags[name] = percent == 100 || (subject != "" && flagBucket(name, subject) < percent)
+		}
+		return flags, nil
+	}, nil
+}
+
+func functionProvider(config json.RawMessage) (personalizeFunc, error) {
+	loader := DataLoader{}
+	if err := unmarshalConfig(config, &loader); err != nil {
+		return nil, err
+	}
+	if loader.Function == "" || loader.Operation == "" {
+		return nil, fmt.Errorf("a function and an operation are required")
+	}
+	if loader.TTL != nil {
+		return nil, fmt.Errorf("the ttl is set on the provider")
+	}
+
+	return func(hh *HostHandler, r *http.Request) (any, error) {
+		ctx := r.Context()
+		// The proxy of the function adds the cookies and the headers to the
+		// claims it signs.
+		if authContext, ok := auth.GetAuthContext(ctx); ok {
+			ctx = auth.SetAuthContext(ctx, maps.Clone(authContext))
+		}
+
+		raw, err := hh.callDataLoader(ctx, loader, r.Header.Get("Accept-Language"))
+		if err != nil {
+			if loader.Fallback != nil {
+				hh.log.Error(err, "personalization function failed, using its fallback", "function", loader.Function, "operation", loader.Operation)
+				return decodeData(loader.Fallback), nil
+			}
+			return nil, err
+		}
+		return decodeData(raw), nil
+	}, nil
+}
+
+func geoProvider(config json.RawMessage) (personalizeFunc, error) {
+	var spec struct {
+		Headers []string `json:"headers"`
+	}
+	if err := unmarshalConfig(config, &spec); err != nil {
+		return nil, err
+	}
+	headers := spec.Headers
+	if len(headers) == 0 {
+		headers = defaultGeoHeaders
+	}
+
+	return func(hh *HostHandler, r *http.Request) (any, error) {
+		for _, header := range headers {
+			if country := strings.ToUpper(strings.TrimSpace(r.Header.Get(header))); countryCode.MatchString(country) {
+				return map[string]any{"country": country}, nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// unmarshalConfig decodes the configuration of a provider, rejecting unknown
+// fields. An empty configuration is the zero value.
+func unmarshalConfig(config json.RawMessage, v any) error {
+	if len(config) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(config)))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// flagBucket returns the bucket, 0 to 99, of the subject for the flag.
+func flagBucket(flag string, subject string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(flag + ":" + subject))
+	return int(h.Sum32() % 100)
+}
+
+// visitorConsent returns the categories of ConsentCookie.
+func visitorConsent(r *http.Request) map[string]bool {
+	consent := map[string]bool{}
+	cookie, err := r.Cookie(ConsentCookie)
+	if err != nil {
+		return consent
+	}
+	for category := range strings.SplitSeq(cookie.Value, ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			consent[category] = true
+		}
+	}
+	return consent
+}
+
+// redact removes the value at the path of the data.
+func redact(data map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(data, path[0])
+		return
+	}
+	if child, ok := data[path[0]].(map[string]any); ok {
+		redact(child, path[1:])
+	}
+}
+
+// Bootstrap is what the scripts of the pages need to start for the visitor.
+type Bootstrap struct {
+	// Personalization is the personalization context of the visitor, empty
+	// when the host has no personalization.
+	Personalization map[string]any `json:"personalization"`
+	TimeZone        string         `json:"timeZone"`
+}
+
+// BootstrapGet serves the bootstrap of the visitor.
+func (hh *HostHandler) BootstrapGet(w http.ResponseWriter, r *http.Request) {
+	bootstrap := Bootstrap{Personalization: map[string]any{}, TimeZone: time.UTC.String()}
+	if personalization := hh.personalize(r); personalization != nil {
+		bootstrap.Personalization = personalization.Data
+	}
+	if loc, _ := visitorTimeZone(r); loc != nil {
+		bootstrap.TimeZone = loc.String()
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bootstrap); err != nil {
+		hh.log.Error(err, "failed to encode bootstrap")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func withPersonalization(ctx context.Context, personalization *personalizationContext) context.Context {
+	return context.WithValue(ctx, personalizationKey{}, personalization)
+}
+
+func personalizationFrom(ctx context.Context) *personalizationContext {
+	personalization, _ := ctx.Value(personalizationKey{}).(*personalizationContext)
+	return personalization
+}
@@ -0,0 +1,157 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePersonalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "valid",
+			value: `{"providers": [
+				{"name": "user", "type": "claims", "config": {"claims": ["email"]}},
+				{"name": "geo", "type": "geo", "consent": "functional"},
+				{"name": "flags", "type": "flags", "config": {"flags": {"newCheckout": 20}}},
+				{"name": "profile", "type": "function", "ttl": "5m", "config": {"function": "profiles", "operation": "get-profile"}}
+			]}`,
+			want: 4,
+		},
+		{
+			name:    "unknown type",
+			value:   `{"providers": [{"name": "weather", "type": "weather"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			value:   `{"providers": [{"name": "geo", "type": "geo"}, {"name": "geo", "type": "consent"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid config",
+			value:   `{"providers": [{"name": "flags", "type": "flags", "config": {"flags": {"newCheckout": 120}}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing claims",
+			value:   `{"providers": [{"name": "user", "type": "claims"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePersonalization(map[string]string{PersonalizationAnnotation: tt.value})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == 0 {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Len(t, got.Providers, tt.want)
+		})
+	}
+}
+
+func TestHostHandler_personalize(t *testing.T) {
+	personalization, err := ParsePersonalization(map[string]string{PersonalizationAnnotation: `{
+		"providers": [
+			{"name": "user", "type": "claims", "config": {"claims": ["email", "address"]}},
+			{"name": "geo", "type": "geo", "consent": "functional"},
+			{"name": "consent", "type": "consent"},
+			{"name": "flags", "type": "flags", "config": {"flags": {"everybody": 100, "nobody": 0}}}
+		],
+		"redact": ["user.address.street"]
+	}`})
+	require.NoError(t, err)
+
+	hh := &HostHandler{log: logr.Discard()}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Nil(t, hh.personalize(r), "no personalization")
+
+	hh.SetPersonalization(personalization)
+
+	anonymous := hh.personalize(r)
+	require.NotNil(t, anonymous)
+	assert.Equal(t, map[string]any{
+		"consent": map[string]any{},
+		"flags":   map[string]any{"everybody": true, "nobody": false},
+	}, anonymous.Data)
+
+	claims := auth.AuthContext{
+		"sub":     "jane",
+		"email":   "jane@example.com",
+		"address": map[string]any{"city": "Paris", "street": "Rue de Rivoli"},
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(auth.SetAuthContext(r.Context(), claims))
+	r.Header.Set("CF-IPCountry", "fr")
+	r.AddCookie(&http.Cookie{Name: ConsentCookie, Value: "functional, analytics"})
+
+	visitor := hh.personalize(r)
+	require.NotNil(t, visitor)
+	assert.Equal(t, map[string]any{
+		"consent": map[string]any{"analytics": true, "functional": true},
+		"flags":   map[string]any{"everybody": true, "nobody": false},
+		"geo":     map[string]any{"country": "FR"},
+		"user":    map[string]any{"email": "jane@example.com", "address": map[string]any{"city": "Paris"}},
+	}, visitor.Data)
+	assert.Equal(t, "Rue de Rivoli", claims["address"].(map[string]any)["street"], "the claims are not redacted")
+	assert.NotEqual(t, anonymous.hash, visitor.hash)
+}
+
+func TestFlagBucket(t *testing.T) {
+	assert.Equal(t, flagBucket("newCheckout", "jane"), flagBucket("newCheckout", "jane"), "the buckets are stable")
+
+	on := 0
+	for i := range 1000 {
+		if flagBucket("newCheckout", fmt.Sprintf("visitor-%d", i)) < 20 {
+			on++
+		}
+	}
+	assert.InDelta(t, 200, on, 60)
+}
+
+func TestHostHandler_BootstrapGet(t *testing.T) {
+	personalization, err := ParsePersonalization(map[string]string{PersonalizationAnnotation: `{
+		"providers": [{"name": "geo", "type": "geo", "config": {"headers": ["X-Geo"]}}]
+	}`})
+	require.NoError(t, err)
+
+	hh := &HostHandler{log: logr.Discard()}
+	hh.SetPersonalization(personalization)
+
+	r := httptest.NewRequest(http.MethodGet, "/-/bootstrap", nil)
+	r.Header.Set("X-Geo", "CA")
+	r.Header.Set(TimeZoneHeader, "America/Toronto")
+	w := httptest.NewRecorder()
+	hh.BootstrapGet(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+
+	bootstrap := Bootstrap{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&bootstrap))
+	assert.Equal(t, Bootstrap{
+		Personalization: map[string]any{"geo": map[string]any{"country": "CA"}},
+		TimeZone:        "America/Toronto",
+	}, bootstrap)
+}
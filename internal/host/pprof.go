@@ -0,0 +1,103 @@
+package host
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ProfilingAnnotation enables, on a host, the profiling endpoints under
+// /-/admin/pprof/ with "true". The block and mutex profiles are only sampled
+// while it is enabled.
+const ProfilingAnnotation = "kdex.dev/profiling"
+
+// profilingHosts counts the hosts of the process with profiling enabled. The
+// sampling rates of the block and mutex profiles are process wide, so they are
+// set while at least one host profiles rather than by each host.
+var profilingHosts struct {
+	sync.Mutex
+	count int
+}
+
+// sampleProfiles counts a host in, or out, of profilingHosts, sampling the
+// block and mutex profiles from the first host in until the last one out.
+func sampleProfiles(enabled bool) {
+	profilingHosts.Lock()
+	defer profilingHosts.Unlock()
+
+	if enabled {
+		profilingHosts.count++
+		if profilingHosts.count == 1 {
+			runtime.SetBlockProfileRate(1)
+			runtime.SetMutexProfileFraction(1)
+		}
+		return
+	}
+
+	if profilingHosts.count == 0 {
+		return
+	}
+	profilingHosts.count--
+	if profilingHosts.count == 0 {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	}
+}
+
+// ParseProfiling returns whether the annotations of a host enable the
+// profiling endpoints.
+func ParseProfiling(annotations map[string]string) (bool, error) {
+	value := annotations[ProfilingAnnotation]
+	if value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", ProfilingAnnotation, err)
+	}
+	return enabled, nil
+}
+
+// SetProfiling enables the profiling endpoints of the host, and the sampling
+// of the block and mutex profiles while any host of the process profiles. The
+// endpoints are registered when the mux is rebuilt.
+func (hh *HostHandler) SetProfiling(enabled bool) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if hh.profiling == enabled {
+		return
+	}
+	hh.profiling = enabled
+
+	sampleProfiles(enabled)
+	hh.log.Info("profiling endpoints toggled", "enabled", enabled)
+}
+
+// PprofGet serves the profiles of net/http/pprof to the holders of the admin
+// entitlement of the host, the index of the profiles without a profile name.
+func (hh *HostHandler) PprofGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch name := r.PathValue("profile"); name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
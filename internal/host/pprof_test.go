@@ -0,0 +1,94 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfiling(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{name: "not set"},
+		{name: "enabled", value: "true", want: true},
+		{name: "disabled", value: "false"},
+		{name: "invalid", value: "on-demand", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProfiling(map[string]string{ProfilingAnnotation: tt.value})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHostHandler_pprof(t *testing.T) {
+	hh := &HostHandler{
+		Name:        "pprof-test",
+		authChecker: auth.NewAuthorizationChecker(nil, logr.Discard()),
+		authConfig:  &auth.Config{ActivePair: &keys.KeyPair{}},
+		log:         logr.Discard(),
+	}
+
+	serve := func(target string, entitlements ...any) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		hh.pprofHandler(mux, map[string]ko.PathInfo{})
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if len(entitlements) > 0 {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": entitlements}))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/", "hosts:pprof-test:read", "hosts:pprof-test:write").Code, "not enabled")
+
+	hh.SetProfiling(true)
+	defer hh.SetProfiling(false)
+	assert.Equal(t, 1, runtime.SetMutexProfileFraction(-1), "the mutex profile is sampled")
+
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/").Code, "anonymous")
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/", "hosts:other:read", "hosts:other:write").Code, "entitled to another host")
+
+	w := serve("/-/admin/pprof/", "hosts:pprof-test:read", "hosts:pprof-test:write")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine")
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = serve("/-/admin/pprof/goroutine?debug=1", "hosts:pprof-test:read", "hosts:pprof-test:write")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine profile")
+
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/unknown", "hosts:pprof-test:read", "hosts:pprof-test:write").Code)
+
+	other := &HostHandler{Name: "other", log: logr.Discard()}
+	other.SetProfiling(true)
+	hh.SetProfiling(false)
+	assert.Equal(t, 1, runtime.SetMutexProfileFraction(-1), "the mutex profile is sampled while another host profiles")
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/", "hosts:pprof-test:read", "hosts:pprof-test:write").Code)
+
+	other.SetProfiling(false)
+	assert.Zero(t, runtime.SetMutexProfileFraction(-1), "the mutex profile is no longer sampled")
+
+	hh.SetProfiling(true)
+	hh.authConfig = nil
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/pprof/", "hosts:pprof-test:read", "hosts:pprof-test:write").Code, "authentication disabled")
+}
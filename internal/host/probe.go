@@ -0,0 +1,347 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ProbesAnnotation holds, on a page binding or a function, the JSON
+	// encoded probes the host runs against it, e.g.
+	// [{"name": "home", "expectContent": "Welcome", "interval": "30s"},
+	// {"name": "health", "url": "/api/orders/healthz", "expectStatus": 204}].
+	ProbesAnnotation = "kdex.dev/probes"
+	// ProbeHeader is set on the requests of the probes, so that they can be
+	// told from the traffic of the visitors.
+	ProbeHeader = "X-Kdex-Probe"
+	// MonitoredCondition is True on a host while the probes of its page
+	// bindings and functions are up, False once one is down.
+	MonitoredCondition = "Monitored"
+
+	reasonProbeDown     = "ProbeDown"
+	reasonProbesPending = "ProbesPending"
+	reasonProbesUp      = "ProbesUp"
+
+	defaultProbeInterval = time.Minute
+	defaultProbeTimeout  = 10 * time.Second
+	maxProbeBody         = 1 << 20
+	minProbeInterval     = 10 * time.Second
+)
+
+// Probe is a synthetic request the host sends from inside the cluster at an
+// interval, and the response it expects.
+type Probe struct {
+	// ExpectContent is a text the body of the response must contain.
+	ExpectContent string `json:"expectContent,omitempty"`
+	// ExpectStatus is the status of the response, 200 by default.
+	ExpectStatus int `json:"expectStatus,omitempty"`
+	// Interval is the time between two requests, 1m by default and at least
+	// 10s.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Method is GET by default.
+	Method string `json:"method,omitempty"`
+	Name   string `json:"name"`
+	// Owner is the kind and the name of the page binding or the function
+	// declaring the probe, e.g. "KDexPageBinding/home".
+	Owner string `json:"-"`
+	// Timeout of the request, 10s by default and at most the interval.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// URL is a path served by the host, or an absolute URL. It is the base
+	// path of the page binding or the function by default.
+	URL string `json:"url,omitempty"`
+}
+
+// ProbeResult is the latest result of a probe.
+type ProbeResult struct {
+	Checked time.Time     `json:"checked"`
+	Latency time.Duration `json:"latency"`
+	Message string        `json:"message,omitempty"`
+	Up      bool          `json:"up"`
+}
+
+// ParseProbes returns the probes of the annotations of a page binding or a
+// function, with their defaults, nil when ProbesAnnotation is not set.
+func ParseProbes(annotations map[string]string, basePath string) ([]Probe, error) {
+	value := annotations[ProbesAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	probes := []Probe{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&probes); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ProbesAnnotation, err)
+	}
+
+	seen := map[string]bool{}
+	for i := range probes {
+		probe := &probes[i]
+		if probe.Name == "" || seen[probe.Name] {
+			return nil, fmt.Errorf("invalid %s annotation: invalid or duplicate probe name %q", ProbesAnnotation, probe.Name)
+		}
+		seen[probe.Name] = true
+
+		if probe.URL == "" {
+			probe.URL = basePath
+		}
+		if target, err := url.Parse(probe.URL); err != nil ||
+			(!strings.HasPrefix(probe.URL, "/") && ((target.Scheme != "http" && target.Scheme != "https") || target.Host == "")) {
+			return nil, fmt.Errorf("invalid %s annotation: probe %s must have a path or an http(s) URL, got %q", ProbesAnnotation, probe.Name, probe.URL)
+		}
+
+		probe.Method = strings.ToUpper(probe.Method)
+		if probe.Method == "" {
+			probe.Method = http.MethodGet
+		}
+		if probe.ExpectStatus == 0 {
+			probe.ExpectStatus = http.StatusOK
+		}
+		if http.StatusText(probe.ExpectStatus) == "" {
+			return nil, fmt.Errorf("invalid %s annotation: probe %s expects unknown status %d", ProbesAnnotation, probe.Name, probe.ExpectStatus)
+		}
+
+		if probe.Interval == nil {
+			probe.Interval = &metav1.Duration{Duration: defaultProbeInterval}
+		}
+		if probe.Interval.Duration < minProbeInterval {
+			return nil, fmt.Errorf("invalid %s annotation: interval of probe %s must be at least %s", ProbesAnnotation, probe.Name, minProbeInterval)
+		}
+		if probe.Timeout == nil {
+			probe.Timeout = &metav1.Duration{Duration: min(defaultProbeTimeout, probe.Interval.Duration)}
+		}
+		if probe.Timeout.Duration <= 0 || probe.Timeout.Duration > probe.Interval.Duration {
+			return nil, fmt.Errorf("invalid %s annotation: timeout of probe %s must be positive and at most its interval", ProbesAnnotation, probe.Name)
+		}
+	}
+
+	return probes, nil
+}
+
+// SetProbes replaces the probes the host runs, none stops them. Changing the
+// probes restarts them.
+func (hh *HostHandler) SetProbes(probes []Probe) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if len(probes) == 0 && len(hh.probes) == 0 {
+		return
+	}
+	if reflect.DeepEqual(probes, hh.probes) {
+		return
+	}
+	if hh.probeCancel != nil {
+		hh.probeCancel()
+		hh.probeCancel = nil
+	}
+	hh.probes = probes
+
+	hh.probeMu.Lock()
+	hh.probeResults = map[string]ProbeResult{}
+	hh.probeMu.Unlock()
+	probeUpGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+	probeDurationGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hh.probeCancel = cancel
+
+	if len(probes) == 0 {
+		go hh.updateMonitored(ctx)
+		return
+	}
+	for _, probe := range probes {
+		go hh.runProbe(ctx, probe)
+	}
+}
+
+func (hh *HostHandler) runProbe(ctx context.Context, probe Probe) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		result := hh.checkProbe(ctx, probe)
+		if ctx.Err() != nil {
+			return
+		}
+		hh.recordProbe(ctx, probe, result)
+		timer.Reset(probe.Interval.Duration)
+	}
+}
+
+// checkProbe sends the request of the probe. Paths are served by the mux of
+// the host, URLs are requested over the network.
+func (hh *HostHandler) checkProbe(ctx context.Context, probe Probe) ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, probe.Timeout.Duration)
+	defer cancel()
+
+	start := time.Now()
+	status, body, err := hh.sendProbe(ctx, probe)
+	result := ProbeResult{Checked: start, Latency: time.Since(start)}
+
+	switch {
+	case err != nil:
+		result.Message = err.Error()
+	case status != probe.ExpectStatus:
+		result.Message = fmt.Sprintf("%s %s returned %d, expected %d", probe.Method, probe.URL, status, probe.ExpectStatus)
+	case probe.ExpectContent != "" && !bytes.Contains(body, []byte(probe.ExpectContent)):
+		result.Message = fmt.Sprintf("%s %s does not contain %q", probe.Method, probe.URL, probe.ExpectContent)
+	default:
+		result.Up = true
+	}
+
+	return result
+}
+
+func (hh *HostHandler) sendProbe(ctx context.Context, probe Probe) (int, []byte, error) {
+	if strings.HasPrefix(probe.URL, "/") {
+		hh.mu.RLock()
+		mux := hh.Mux
+		hh.mu.RUnlock()
+		if mux == nil {
+			return 0, nil, fmt.Errorf("the host is not ready")
+		}
+
+		r := httptest.NewRequestWithContext(ctx, probe.Method, probe.URL, nil)
+		r.Header.Set(ProbeHeader, probe.Name)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if err := ctx.Err(); err != nil {
+			return 0, nil, fmt.Errorf("%s %s: %w", probe.Method, probe.URL, err)
+		}
+		return w.Code, w.Body.Bytes(), nil
+	}
+
+	r, err := http.NewRequestWithContext(ctx, probe.Method, probe.URL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.Header.Set(ProbeHeader, probe.Name)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// recordProbe exports the result of the probe and updates the Monitored
+// condition of the host when the probe went up or down.
+func (hh *HostHandler) recordProbe(ctx context.Context, probe Probe, result ProbeResult) {
+	up := 0.0
+	if result.Up {
+		up = 1
+	}
+	probeUpGauge.WithLabelValues(hh.Name, probe.Owner, probe.Name).Set(up)
+	probeDurationGauge.WithLabelValues(hh.Name, probe.Owner, probe.Name).Set(result.Latency.Seconds())
+
+	key := probe.Owner + "/" + probe.Name
+	hh.probeMu.Lock()
+	previous, seen := hh.probeResults[key]
+	hh.probeResults[key] = result
+	hh.probeMu.Unlock()
+
+	if seen && previous.Up == result.Up {
+		return
+	}
+	if !result.Up {
+		hh.log.Info("probe down", "owner", probe.Owner, "probe", probe.Name, "message", result.Message)
+	} else if seen {
+		hh.log.Info("probe up", "owner", probe.Owner, "probe", probe.Name)
+	}
+	hh.updateMonitored(ctx)
+}
+
+// monitoredCondition returns the Monitored condition of the results of the
+// probes, nil when the host has no probes.
+func (hh *HostHandler) monitoredCondition() *metav1.Condition {
+	hh.mu.RLock()
+	probes := hh.probes
+	hh.mu.RUnlock()
+
+	if len(probes) == 0 {
+		return nil
+	}
+
+	hh.probeMu.Lock()
+	defer hh.probeMu.Unlock()
+
+	down := []string{}
+	pending := 0
+	for _, probe := range probes {
+		result, ok := hh.probeResults[probe.Owner+"/"+probe.Name]
+		switch {
+		case !ok:
+			pending++
+		case !result.Up:
+			down = append(down, fmt.Sprintf("probe %s of %s: %s", probe.Name, probe.Owner, result.Message))
+		}
+	}
+	slices.Sort(down)
+
+	switch {
+	case len(down) > 0:
+		return &metav1.Condition{Type: MonitoredCondition, Status: metav1.ConditionFalse, Reason: reasonProbeDown, Message: strings.Join(down, "; ")}
+	case pending > 0:
+		return &metav1.Condition{Type: MonitoredCondition, Status: metav1.ConditionUnknown, Reason: reasonProbesPending, Message: fmt.Sprintf("%d of %d probes pending", pending, len(probes))}
+	default:
+		return &metav1.Condition{Type: MonitoredCondition, Status: metav1.ConditionTrue, Reason: reasonProbesUp, Message: fmt.Sprintf("%d probes up", len(probes))}
+	}
+}
+
+// updateMonitored sets the Monitored condition of the host from the results
+// of its probes, and removes it when it has none.
+func (hh *HostHandler) updateMonitored(ctx context.Context) {
+	if hh.client == nil {
+		return
+	}
+
+	condition := hh.monitoredCondition()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		internalHost := &kdexv1alpha1.KDexInternalHost{}
+		if err := hh.client.Get(ctx, client.ObjectKey{Name: hh.Name, Namespace: hh.Namespace}, internalHost); err != nil {
+			return err
+		}
+
+		changed := false
+		if condition == nil {
+			changed = meta.RemoveStatusCondition(&internalHost.Status.Conditions, MonitoredCondition)
+		} else {
+			condition.ObservedGeneration = internalHost.Generation
+			changed = meta.SetStatusCondition(&internalHost.Status.Conditions, *condition)
+		}
+		if !changed {
+			return nil
+		}
+		return hh.client.Status().Update(ctx, internalHost)
+	})
+	if err != nil && ctx.Err() == nil {
+		hh.log.Error(err, "failed to update the monitored condition")
+	}
+}
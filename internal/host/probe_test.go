@@ -0,0 +1,157 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseProbes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []Probe
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "defaults",
+			value: `[{"name": "home"}]`,
+			want: []Probe{{
+				ExpectStatus: http.StatusOK,
+				Interval:     &metav1.Duration{Duration: time.Minute},
+				Method:       http.MethodGet,
+				Name:         "home",
+				Timeout:      &metav1.Duration{Duration: 10 * time.Second},
+				URL:          "/shop",
+			}},
+		},
+		{
+			name:  "absolute URL",
+			value: `[{"name": "health", "url": "https://shop.example.com/healthz", "method": "head", "expectStatus": 204, "interval": "30s", "timeout": "5s"}]`,
+			want: []Probe{{
+				ExpectStatus: http.StatusNoContent,
+				Interval:     &metav1.Duration{Duration: 30 * time.Second},
+				Method:       http.MethodHead,
+				Name:         "health",
+				Timeout:      &metav1.Duration{Duration: 5 * time.Second},
+				URL:          "https://shop.example.com/healthz",
+			}},
+		},
+		{
+			name:    "relative URL",
+			value:   `[{"name": "home", "url": "shop"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			value:   `[{"name": "home"}, {"name": "home", "url": "/"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "short interval",
+			value:   `[{"name": "home", "interval": "1s"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "timeout above interval",
+			value:   `[{"name": "home", "interval": "10s", "timeout": "20s"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown status",
+			value:   `[{"name": "home", "expectStatus": 999}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			value:   `[{"name": "home", "expect": "Welcome"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProbes(map[string]string{ProbesAnnotation: tt.value}, "/shop")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHostHandler_SetProbes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	internalHost := &kdexv1alpha1.KDexInternalHost{ObjectMeta: metav1.ObjectMeta{Name: "probes-test", Namespace: "kdex"}}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(internalHost).
+		WithStatusSubresource(internalHost).
+		Build()
+
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer external.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /shop", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Welcome " + r.Header.Get(ProbeHeader)))
+	})
+
+	hh := &HostHandler{Mux: mux, Name: "probes-test", Namespace: "kdex", client: c, log: logr.Discard()}
+
+	homeProbes, err := ParseProbes(map[string]string{ProbesAnnotation: `[{"name": "home", "expectContent": "Welcome home"}]`}, "/shop")
+	require.NoError(t, err)
+	apiProbes, err := ParseProbes(map[string]string{ProbesAnnotation: `[{"name": "health", "url": "` + external.URL + `/healthz"}]`}, "/api")
+	require.NoError(t, err)
+	homeProbes[0].Owner = "KDexPageBinding/home"
+	apiProbes[0].Owner = "KDexFunction/api"
+
+	monitored := func() *metav1.Condition {
+		current := &kdexv1alpha1.KDexInternalHost{}
+		require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(internalHost), current))
+		return meta.FindStatusCondition(current.Status.Conditions, MonitoredCondition)
+	}
+
+	hh.SetProbes(homeProbes)
+	require.Eventually(t, func() bool {
+		condition := monitored()
+		return condition != nil && condition.Status == metav1.ConditionTrue
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(probeUpGauge.WithLabelValues("probes-test", "KDexPageBinding/home", "home")))
+
+	hh.SetProbes(append(homeProbes, apiProbes...))
+	require.Eventually(t, func() bool {
+		condition := monitored()
+		return condition != nil && condition.Status == metav1.ConditionFalse
+	}, 5*time.Second, 10*time.Millisecond)
+	condition := monitored()
+	assert.Equal(t, reasonProbeDown, condition.Reason)
+	assert.Contains(t, condition.Message, "probe health of KDexFunction/api: GET "+external.URL+"/healthz returned 503, expected 200")
+	assert.Equal(t, 0.0, testutil.ToFloat64(probeUpGauge.WithLabelValues("probes-test", "KDexFunction/api", "health")))
+
+	hh.SetProbes(nil)
+	require.Eventually(t, func() bool {
+		return monitored() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -3,18 +3,22 @@ package host
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/kdex-tech/dmapper"
 	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/breaker"
 	"github.com/kdex-tech/host-manager/internal/sign"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
 )
 
@@ -47,18 +51,27 @@ func (hh *HostHandler) reverseProxyHandler(fn *kdexv1alpha1.KDexFunction, issuer
 		mapper,
 	)
 
+	canary := hh.canaryRouteFor(fn)
+
+	breakerOpts := hh.breakerOptionsFor(fn)
+	cb := hh.breakers.Get(fn.Name, breakerOpts)
+
 	proxy := &httputil.ReverseProxy{
 		Rewrite: func(preq *httputil.ProxyRequest) {
 			hh.log.V(2).Info("PROXY: modifying request", "url", preq.In.URL)
 			// 1. Set Target and Host
-			preq.Out.URL.Scheme = target.Scheme
-			preq.Out.URL.Host = target.Host
-			preq.Out.Host = target.Host // Essential for FaaS routing
+			upstream := target
+			if route := canaryFrom(preq.In.Context()); route != nil {
+				upstream = route.target
+			}
+			preq.Out.URL.Scheme = upstream.Scheme
+			preq.Out.URL.Host = upstream.Host
+			preq.Out.Host = upstream.Host // Essential for FaaS routing
 
 			// 2. Precise Path Joining
 			// Note: We do NOT strip the BasePath because KDex functions are
 			// implemented using the full paths defined in their OpenAPI spec.
-			preq.Out.URL.Path = path.Join(target.Path, preq.In.URL.Path)
+			preq.Out.URL.Path = path.Join(upstream.Path, preq.In.URL.Path)
 			if strings.HasSuffix(preq.In.URL.Path, "/") && !strings.HasSuffix(preq.Out.URL.Path, "/") {
 				preq.Out.URL.Path += "/"
 			}
@@ -99,9 +112,13 @@ func (hh *HostHandler) reverseProxyHandler(fn *kdexv1alpha1.KDexFunction, issuer
 			// 4. Standard Proxy Headers
 			preq.Out.Header.Set("X-Kdex-Forwarded", "true")
 			preq.SetXForwarded()
+			writeDeadlineHeader(preq.In, preq.Out.Header)
 		},
 		ModifyResponse: func(resp *http.Response) error {
 			hh.log.V(2).Info("PROXY: modifying response", "url", resp.Request.URL)
+			if route := canaryFrom(resp.Request.Context()); route != nil {
+				route.stats.observe(resp.StatusCode >= http.StatusInternalServerError)
+			}
 			// 5. Rewrite Set-Cookie Domain
 			// This ensures cookies from the FaaS backend are tied to your proxy domain
 			cookies := resp.Header["Set-Cookie"]
@@ -114,24 +131,49 @@ func (hh *HostHandler) reverseProxyHandler(fn *kdexv1alpha1.KDexFunction, issuer
 			return nil
 		},
 		// TODO: make transport configurable
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   5 * time.Second, // Connection timeout
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			ResponseHeaderTimeout: 15 * time.Second, // Wait for FaaS headers
-			IdleConnTimeout:       90 * time.Second,
+		Transport: &resilientTransport{
+			breaker: cb,
+			budget:  hh.retryBudget(fn.Name),
+			// Each call of the function is a client span of the request,
+			// whose trace context is passed on to the function.
+			// Faults are injected under the breaker and the retries, so that
+			// they see them as failures of the function.
+			next: &faultTransport{
+				function: fn.Name,
+				host:     hh.Name,
+				next: otelhttp.NewTransport(&http.Transport{
+					Proxy: http.ProxyFromEnvironment,
+					DialContext: (&net.Dialer{
+						Timeout:   5 * time.Second, // Connection timeout
+						KeepAlive: 30 * time.Second,
+					}).DialContext,
+					ResponseHeaderTimeout: 15 * time.Second, // Wait for FaaS headers
+					IdleConnTimeout:       90 * time.Second,
+				}, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+					return r.Method + " function " + fn.Name
+				})),
+			},
 		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-			hh.log.Error(err, "PROXY: backend failure", "url", r.URL.String())
+			if errors.Is(err, breaker.ErrOpen) {
+				hh.log.V(1).Info("PROXY: circuit open", "function", fn.Name, "url", r.URL.String())
+				w.Header().Set("Retry-After", strconv.Itoa(int(breakerOpts.OpenTimeout.Seconds())))
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			if route := canaryFrom(r.Context()); route != nil {
+				route.stats.observe(true)
+			}
 
-			code := http.StatusBadGateway
 			if errors.Is(err, context.DeadlineExceeded) {
-				code = http.StatusGatewayTimeout
+				hh.log.V(1).Info("PROXY: deadline exceeded", "function", fn.Name, "url", r.URL.String())
+				serveProblem(w, r, http.StatusGatewayTimeout, fmt.Sprintf("function %s did not respond in time", fn.Name))
+				return
 			}
 
-			http.Error(w, err.Error(), code)
+			hh.log.Error(err, "PROXY: backend failure", "url", r.URL.String())
+			http.Error(w, err.Error(), http.StatusBadGateway)
 		},
 	}
 
@@ -144,6 +186,10 @@ func (hh *HostHandler) reverseProxyHandler(fn *kdexv1alpha1.KDexFunction, issuer
 				code = ew.statusCode
 			}
 
+			if capture := hh.shadowCaptureFor(fn.Name); capture != nil {
+				capture.record(r, functionPattern(r, fn), code, start)
+			}
+
 			// Log the Completion
 			hh.log.V(2).Info("proxy request finished",
 				"function", fn.Name,
@@ -160,16 +206,51 @@ func (hh *HostHandler) reverseProxyHandler(fn *kdexv1alpha1.KDexFunction, issuer
 			"target", target.String(),
 		)
 
+		if canary.pick() {
+			r = r.WithContext(withCanary(r.Context(), canary))
+		}
+
+		op := functionOperation(r, fn)
+
 		if shouldReturn := hh.handleAuth(
 			r,
 			w,
 			"functions",
 			fn.Spec.API.BasePath,
-			functionCallRequirements(r, fn),
+			operationRequirements(op),
 		); shouldReturn {
 			return
 		}
 
+		if timeout := hh.requestTimeout(r, fn, op); timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		retry, err := retryPolicyFor(op)
+		if err != nil {
+			hh.log.Error(err, "ignoring invalid retry hint", "function", fn.Name, "path", r.URL.Path)
+		}
+		if retry != nil {
+			r = r.WithContext(context.WithValue(r.Context(), retryPolicyKey{}, retry))
+		}
+
+		if fault := hh.faultFor(fn.Name, r); fault != nil {
+			r = r.WithContext(withFault(r.Context(), fault))
+		}
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			policy, err := responseCachePolicyFor(op)
+			if err != nil {
+				hh.log.Error(err, "ignoring invalid cache hint", "function", fn.Name, "path", r.URL.Path)
+			}
+			if policy != nil {
+				hh.serveCachedResponse(w, r, fn, policy, proxy)
+				return
+			}
+		}
+
 		// Execute the proxy
 		proxy.ServeHTTP(w, r)
 	})
@@ -0,0 +1,119 @@
+package host
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// PseudoLocale is the language served by hosts in dev mode with every string
+// of the default language pseudo-localized.
+const PseudoLocale = "en-XA"
+
+// pseudoTranslationName is the name the generated translations are merged
+// under, it cannot collide with a resource name.
+const pseudoTranslationName = "/pseudo-locale"
+
+var pseudoAccents = map[rune]rune{
+	'A': 'Å', 'B': 'Ɓ', 'C': 'Ç', 'D': 'Đ', 'E': 'É', 'F': 'Ƒ', 'G': 'Ĝ', 'H': 'Ĥ', 'I': 'Î', 'J': 'Ĵ',
+	'K': 'Ķ', 'L': 'Ļ', 'M': 'Ṁ', 'N': 'Ñ', 'O': 'Ö', 'P': 'Þ', 'Q': 'Ǫ', 'R': 'Ŕ', 'S': 'Š', 'T': 'Ţ',
+	'U': 'Û', 'V': 'Ṽ', 'W': 'Ŵ', 'X': 'Ẋ', 'Y': 'Ý', 'Z': 'Ž',
+	'a': 'å', 'b': 'ƀ', 'c': 'ç', 'd': 'đ', 'e': 'é', 'f': 'ƒ', 'g': 'ĝ', 'h': 'ĥ', 'i': 'î', 'j': 'ĵ',
+	'k': 'ķ', 'l': 'ļ', 'm': 'ṁ', 'n': 'ñ', 'o': 'ö', 'p': 'þ', 'q': 'ǫ', 'r': 'ŕ', 's': 'š', 't': 'ţ',
+	'u': 'û', 'v': 'ṽ', 'w': 'ŵ', 'x': 'ẋ', 'y': 'ý', 'z': 'ž',
+}
+
+// pseudoTranslations returns the translations of the pseudo-locale derived
+// from the keys of the default language.
+func pseudoTranslations(
+	defaultLanguage string,
+	resources map[string]kdexv1alpha1.KDexTranslationSpec,
+) kdexv1alpha1.KDexTranslationSpec {
+	defaultTag := language.Make(defaultLanguage)
+	keysAndValues := map[string]string{}
+	for _, resource := range resources {
+		for _, tr := range resource.Translations {
+			if language.Make(tr.Lang) != defaultTag {
+				continue
+			}
+			for key, value := range tr.KeysAndValues {
+				keysAndValues[key] = pseudoLocalize(value)
+			}
+		}
+	}
+
+	return kdexv1alpha1.KDexTranslationSpec{
+		Translations: []kdexv1alpha1.Translation{
+			{Lang: PseudoLocale, KeysAndValues: keysAndValues},
+		},
+	}
+}
+
+// pseudoLocalize accents the letters of s and pads it by roughly 40% between
+// brackets so that truncated and untranslated strings stand out. Format
+// verbs, {{placeholders}}, HTML tags and entities are kept as is.
+func pseudoLocalize(s string) string {
+	if s == "" {
+		return s
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[")
+	letters := 0
+	for i := 0; i < len(s); {
+		if n := pseudoVerbatim(s[i:]); n > 0 {
+			builder.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if accented, ok := pseudoAccents[r]; ok {
+			builder.WriteRune(accented)
+			letters++
+		} else {
+			builder.WriteRune(r)
+		}
+		i += size
+	}
+
+	if padding := (letters*4 + 9) / 10; padding > 0 {
+		builder.WriteString(" ")
+		builder.WriteString(strings.Repeat("~", padding))
+	}
+	builder.WriteString("]")
+
+	return builder.String()
+}
+
+// pseudoVerbatim returns the length of the format verb, placeholder, tag or
+// entity s starts with, or 0.
+func pseudoVerbatim(s string) int {
+	switch s[0] {
+	case '%':
+		end := 1
+		for end < len(s) && strings.IndexByte("+-# 0123456789.*[]", s[end]) != -1 {
+			end++
+		}
+		if end < len(s) && strings.IndexByte("%vTtbcdoOqxXUeEfFgGsp", s[end]) != -1 {
+			return end + 1
+		}
+	case '{':
+		if strings.HasPrefix(s, "{{") {
+			if end := strings.Index(s, "}}"); end != -1 {
+				return end + 2
+			}
+		}
+	case '<':
+		if end := strings.IndexByte(s, '>'); end != -1 {
+			return end + 1
+		}
+	case '&':
+		if end := strings.IndexByte(s, ';'); end != -1 && !strings.ContainsAny(s[1:end], " \t\n&") {
+			return end + 1
+		}
+	}
+	return 0
+}
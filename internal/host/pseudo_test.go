@@ -0,0 +1,71 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func Test_pseudoLocalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "empty", in: "", want: ""},
+		{name: "letters", in: "Hello", want: "[Ĥéļļö ~~]"},
+		{name: "format verbs", in: "Hi %s, 100%% %[1]d", want: "[Ĥî %s, 100%% %[1]d ~]"},
+		{name: "placeholders", in: "Hi {{a}}", want: "[Ĥî {{a}} ~]"},
+		{name: "markup", in: `<a href="/x">Go</a> &amp; on`, want: `[<a href="/x">Ĝö</a> &amp; öñ ~~]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pseudoLocalize(tt.in))
+		})
+	}
+}
+
+func TestHostHandler_PseudoLocale(t *testing.T) {
+	tests := []struct {
+		name     string
+		devMode  bool
+		wantBody string
+	}{
+		{name: "dev mode", devMode: true, wantBody: `{"greeting":"[Ĥéļļö ~~]"}`},
+		{name: "falls back to the default language", devMode: false, wantBody: `{"greeting":"Hello"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheManager, _ := cache.NewCacheManager("", "foo", nil)
+			hh := NewHostHandler(nil, "test-host", "default", logr.Discard(), cacheManager)
+			hh.translationResources = map[string]kdexv1alpha1.KDexTranslationSpec{
+				"messages": {
+					Translations: []kdexv1alpha1.Translation{
+						{Lang: "en", KeysAndValues: map[string]string{"greeting": "Hello"}},
+					},
+				},
+			}
+			hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+				DefaultLang: "en",
+				BrandName:   "KDex",
+				DevMode:     tt.devMode,
+			}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+			w := httptest.NewRecorder()
+			hh.Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/translation/"+PseudoLocale+"?key=greeting", nil))
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
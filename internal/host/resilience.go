@@ -0,0 +1,202 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/breaker"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// retryHintExtension is the OpenAPI operation extension used by functions
+	// to enable retries of idempotent operations. The value is either the
+	// maximum number of attempts or an object of the form
+	// {"attempts": 3, "backoff": "100ms"}.
+	retryHintExtension = "x-kdex-retry"
+
+	breakerFailureRatioAnnotation = "kdex.dev/circuit-breaker-failure-ratio"
+	breakerMinRequestsAnnotation  = "kdex.dev/circuit-breaker-min-requests"
+	breakerOpenTimeoutAnnotation  = "kdex.dev/circuit-breaker-open-timeout"
+
+	defaultRetryBackoff  = 100 * time.Millisecond
+	maxRetryAttempts     = 5
+	retryBudgetMinPerSec = 10
+	retryBudgetRatio     = 0.2
+)
+
+type retryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+type retryPolicyKey struct{}
+
+// retryPolicyFor reads the retry hint of the operation. A nil policy means
+// failed requests are not retried.
+func retryPolicyFor(op *openapi.Operation) (*retryPolicy, error) {
+	if op == nil || op.Extensions == nil {
+		return nil, nil
+	}
+
+	hint, ok := op.Extensions[retryHintExtension]
+	if !ok || hint == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(hint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s extension: %w", retryHintExtension, err)
+	}
+
+	var spec struct {
+		Attempts int    `json:"attempts"`
+		Backoff  string `json:"backoff"`
+	}
+	if err := json.Unmarshal(raw, &spec.Attempts); err != nil {
+		if err := json.Unmarshal(raw, &spec); err != nil {
+			return nil, fmt.Errorf("invalid %s extension: %w", retryHintExtension, err)
+		}
+	}
+
+	policy := &retryPolicy{
+		Attempts: min(spec.Attempts, maxRetryAttempts),
+		Backoff:  defaultRetryBackoff,
+	}
+	if spec.Backoff != "" {
+		policy.Backoff, err = time.ParseDuration(spec.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s backoff %q: %w", retryHintExtension, spec.Backoff, err)
+		}
+	}
+	if policy.Attempts <= 1 {
+		return nil, nil
+	}
+
+	return policy, nil
+}
+
+// breakerOptionsFor returns the default breaker options overridden by any
+// circuit breaker annotations of the function.
+func (hh *HostHandler) breakerOptionsFor(fn *kdexv1alpha1.KDexFunction) breaker.Options {
+	opts := breaker.DefaultOptions()
+	annotations := fn.GetAnnotations()
+
+	if v, ok := annotations[breakerFailureRatioAnnotation]; ok {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			hh.log.Info("ignoring invalid annotation", "function", fn.Name, "annotation", breakerFailureRatioAnnotation, "value", v)
+		} else {
+			opts.FailureRatio = ratio
+		}
+	}
+
+	if v, ok := annotations[breakerMinRequestsAnnotation]; ok {
+		minRequests, err := strconv.Atoi(v)
+		if err != nil || minRequests < 1 {
+			hh.log.Info("ignoring invalid annotation", "function", fn.Name, "annotation", breakerMinRequestsAnnotation, "value", v)
+		} else {
+			opts.MinRequests = minRequests
+		}
+	}
+
+	if v, ok := annotations[breakerOpenTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			hh.log.Info("ignoring invalid annotation", "function", fn.Name, "annotation", breakerOpenTimeoutAnnotation, "value", v)
+		} else {
+			opts.OpenTimeout = timeout
+		}
+	}
+
+	return opts
+}
+
+func (hh *HostHandler) retryBudget(name string) *breaker.RetryBudget {
+	budget, _ := hh.retryBudgets.LoadOrStore(name, breaker.NewRetryBudget(retryBudgetRatio, retryBudgetMinPerSec))
+	return budget.(*breaker.RetryBudget)
+}
+
+// resilientTransport guards a function's upstream with a circuit breaker and
+// retries idempotent requests within the function's retry budget.
+type resilientTransport struct {
+	breaker *breaker.Breaker
+	budget  *breaker.RetryBudget
+	next    http.RoundTripper
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.budget.Deposit()
+
+	attempts := 1
+	policy, _ := req.Context().Value(retryPolicyKey{}).(*retryPolicy)
+	if policy != nil && isIdempotent(req.Method) && isReplayable(req) {
+		attempts = policy.Attempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		done, err := t.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		failed := err != nil || isGatewayFailure(resp.StatusCode)
+		done(!failed)
+
+		if !failed || attempt >= attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		allowed := t.budget.Withdraw()
+		breaker.ObserveRetry(t.breaker.Name(), allowed)
+		if !allowed {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(policy.Backoff * time.Duration(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func isGatewayFailure(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
@@ -0,0 +1,140 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		extension any
+		want      *retryPolicy
+		wantErr   bool
+	}{
+		{
+			name: "no hint",
+		},
+		{
+			name:      "attempts only",
+			extension: 3,
+			want:      &retryPolicy{Attempts: 3, Backoff: defaultRetryBackoff},
+		},
+		{
+			name:      "object",
+			extension: json.RawMessage(`{"attempts":2,"backoff":"1s"}`),
+			want:      &retryPolicy{Attempts: 2, Backoff: time.Second},
+		},
+		{
+			name:      "capped attempts",
+			extension: 50,
+			want:      &retryPolicy{Attempts: maxRetryAttempts, Backoff: defaultRetryBackoff},
+		},
+		{
+			name:      "single attempt",
+			extension: 1,
+		},
+		{
+			name:      "invalid backoff",
+			extension: json.RawMessage(`{"attempts":2,"backoff":"later"}`),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &openapi.Operation{}
+			if tt.extension != nil {
+				op.Extensions = map[string]any{retryHintExtension: tt.extension}
+			}
+			got, err := retryPolicyFor(op)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResilientTransport(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	newTransport := func() *resilientTransport {
+		return &resilientTransport{
+			breaker: breaker.New("test-transport", breaker.DefaultOptions()),
+			budget:  breaker.NewRetryBudget(retryBudgetRatio, retryBudgetMinPerSec),
+			next:    http.DefaultTransport,
+		}
+	}
+	policy := &retryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	t.Run("retries idempotent requests", func(t *testing.T) {
+		calls = 0
+		req := httptest.NewRequest("GET", upstream.URL, nil)
+		req.RequestURI = ""
+		req = req.WithContext(context.WithValue(req.Context(), retryPolicyKey{}, policy))
+
+		resp, err := newTransport().RoundTrip(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry non idempotent requests", func(t *testing.T) {
+		calls = 0
+		req := httptest.NewRequest("POST", upstream.URL, strings.NewReader("{}"))
+		req.RequestURI = ""
+		req = req.WithContext(context.WithValue(req.Context(), retryPolicyKey{}, policy))
+
+		resp, err := newTransport().RoundTrip(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("rejects while the breaker is open", func(t *testing.T) {
+		calls = 0
+		transport := newTransport()
+		transport.breaker = breaker.New("test-transport-open", breaker.Options{
+			FailureRatio:   0.5,
+			HalfOpenProbes: 1,
+			MinRequests:    1,
+			OpenTimeout:    time.Minute,
+			Window:         time.Minute,
+		})
+
+		req := httptest.NewRequest("GET", upstream.URL, nil)
+		req.RequestURI = ""
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, breaker.StateOpen, transport.breaker.State())
+
+		_, err = transport.RoundTrip(req)
+		assert.ErrorIs(t, err, breaker.ErrOpen)
+		assert.Equal(t, 1, calls)
+	})
+}
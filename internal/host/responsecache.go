@@ -0,0 +1,315 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// cacheHintExtension is the OpenAPI operation extension used by functions
+	// to opt GET operations into host side response caching. The value is
+	// either a duration string (e.g. "5m") or an object of the form
+	// {"ttl": "5m", "vary": ["Accept-Language"]}.
+	cacheHintExtension = "x-kdex-cache"
+
+	maxCachedResponseSize = 1 << 20
+	maxResponseCacheTTL   = 24 * time.Hour
+	responseCacheClass    = "function-response"
+	responseCacheHeader   = "X-Kdex-Cache"
+)
+
+type responseCachePolicy struct {
+	TTL  time.Duration
+	Vary []string
+}
+
+type cachedResponse struct {
+	Body    []byte      `json:"body,omitempty"`
+	Expires time.Time   `json:"expires"`
+	Header  http.Header `json:"header,omitempty"`
+	Stored  time.Time   `json:"stored"`
+	Status  int         `json:"status"`
+}
+
+// responseCachePolicyFor reads the cache hint of the operation. A nil policy
+// means the operation's responses must not be cached.
+func responseCachePolicyFor(op *openapi.Operation) (*responseCachePolicy, error) {
+	if op == nil || op.Extensions == nil {
+		return nil, nil
+	}
+
+	hint, ok := op.Extensions[cacheHintExtension]
+	if !ok || hint == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(hint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s extension: %w", cacheHintExtension, err)
+	}
+
+	var spec struct {
+		TTL  string   `json:"ttl"`
+		Vary []string `json:"vary"`
+	}
+	if err := json.Unmarshal(raw, &spec.TTL); err != nil {
+		if err := json.Unmarshal(raw, &spec); err != nil {
+			return nil, fmt.Errorf("invalid %s extension: %w", cacheHintExtension, err)
+		}
+	}
+
+	ttl, err := time.ParseDuration(spec.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s ttl %q: %w", cacheHintExtension, spec.TTL, err)
+	}
+	if ttl <= 0 {
+		return nil, nil
+	}
+
+	return &responseCachePolicy{
+		TTL:  min(ttl, maxResponseCacheTTL),
+		Vary: spec.Vary,
+	}, nil
+}
+
+// keys returns whether the request headers a response varies on are all part
+// of the cache key of the policy.
+func (p *responseCachePolicy) keys(vary []string) bool {
+	for _, value := range vary {
+		for header := range strings.SplitSeq(value, ",") {
+			header = strings.TrimSpace(header)
+			if header == "" {
+				continue
+			}
+			if header == "*" || !slices.ContainsFunc(p.Vary, func(keyed string) bool {
+				return strings.EqualFold(keyed, header)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (hh *HostHandler) responseCache() cache.Cache {
+	return hh.cacheManager.GetCache(responseCacheClass, cache.CacheOptions{
+		TTL:      new(maxResponseCacheTTL),
+		Uncycled: true,
+	})
+}
+
+// responseCacheKey computes the cache key of the request. Authenticated
+// requests are keyed per user so that personalized responses never leak
+// between users. So are the requests carrying credentials the host does not
+// check, e.g. on hosts without authentication, by their Authorization and
+// Cookie headers since the function may personalize their responses.
+func (hh *HostHandler) responseCacheKey(
+	ctx context.Context,
+	r *http.Request,
+	fn *kdexv1alpha1.KDexFunction,
+	policy *responseCachePolicy,
+) (string, error) {
+	epoch, _, _, err := hh.responseCache().Get(ctx, "epoch:"+fn.Name)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(r.URL.Path)
+	buffer.WriteString("?")
+	buffer.WriteString(r.URL.Query().Encode())
+	for _, header := range policy.Vary {
+		buffer.WriteString("\n")
+		buffer.WriteString(http.CanonicalHeaderKey(header))
+		buffer.WriteString(":")
+		buffer.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	if _, isLoggedIn := auth.GetAuthContext(r.Context()); isLoggedIn {
+		buffer.WriteString("\n")
+		buffer.WriteString(hh.getUserHash(r))
+	} else if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		buffer.WriteString("\nAuthorization:")
+		buffer.WriteString(r.Header.Get("Authorization"))
+		buffer.WriteString("\nCookie:")
+		buffer.WriteString(strings.Join(r.Header.Values("Cookie"), "; "))
+	}
+
+	sum := sha256.Sum256(buffer.Bytes())
+	return fmt.Sprintf("%s:%s:%s", fn.Name, epoch, hex.EncodeToString(sum[:])), nil
+}
+
+// purgeResponseCache invalidates every cached response of the function by
+// rotating its epoch. Stale entries are left to expire on their own.
+func (hh *HostHandler) purgeResponseCache(ctx context.Context, fn *kdexv1alpha1.KDexFunction) error {
+	return hh.responseCache().Set(ctx, "epoch:"+fn.Name, rand.Text())
+}
+
+// serveCachedResponse serves the request from the response cache when
+// possible, otherwise it calls next and stores a cacheable result.
+func (hh *HostHandler) serveCachedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	fn *kdexv1alpha1.KDexFunction,
+	policy *responseCachePolicy,
+	next http.Handler,
+) {
+	requestCacheControl := r.Header.Get("Cache-Control")
+	if strings.Contains(requestCacheControl, "no-store") {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	c := hh.responseCache()
+
+	key, err := hh.responseCacheKey(ctx, r, fn, policy)
+	if err != nil {
+		hh.log.Error(err, "failed to compute response cache key", "function", fn.Name)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !strings.Contains(requestCacheControl, "no-cache") {
+		if entry, ok := hh.lookupCachedResponse(ctx, c, key); ok {
+			for k, v := range entry.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+			w.Header().Set(responseCacheHeader, "HIT")
+			w.WriteHeader(entry.Status)
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(entry.Body)
+			}
+			return
+		}
+	}
+
+	w.Header().Set(responseCacheHeader, "MISS")
+	outer := w.Header().Clone()
+
+	rec := &responseRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+
+	if r.Method != http.MethodGet || rec.status != http.StatusOK || rec.overflow {
+		return
+	}
+
+	// Only the headers of the function are stored, those of the handlers
+	// serving the function are set again on each hit.
+	header := http.Header{}
+	for k, v := range rec.Header() {
+		if !slices.Equal(outer[k], v) {
+			header[k] = slices.Clone(v)
+		}
+	}
+	if header.Get("Set-Cookie") != "" {
+		return
+	}
+	if !policy.keys(header.Values("Vary")) {
+		return
+	}
+	responseCacheControl := header.Get("Cache-Control")
+	if strings.Contains(responseCacheControl, "no-store") {
+		return
+	}
+	if _, isLoggedIn := auth.GetAuthContext(ctx); !isLoggedIn && strings.Contains(responseCacheControl, "private") {
+		return
+	}
+	header.Del(responseCacheHeader)
+
+	now := time.Now()
+	payload, err := json.Marshal(cachedResponse{
+		Body:    rec.body.Bytes(),
+		Expires: now.Add(policy.TTL),
+		Header:  header,
+		Stored:  now,
+		Status:  rec.status,
+	})
+	if err != nil {
+		hh.log.Error(err, "failed to marshal cached response", "function", fn.Name)
+		return
+	}
+
+	if err := c.Set(ctx, key, string(payload)); err != nil {
+		hh.log.Error(err, "failed to store cached response", "function", fn.Name)
+	}
+}
+
+func (hh *HostHandler) lookupCachedResponse(ctx context.Context, c cache.Cache, key string) (*cachedResponse, bool) {
+	raw, found, _, err := c.Get(ctx, key)
+	if err != nil {
+		hh.log.Error(err, "failed to read cached response", "key", key)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	var entry cachedResponse
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		hh.log.Error(err, "failed to unmarshal cached response", "key", key)
+		_ = c.Delete(ctx, key)
+		return nil, false
+	}
+
+	if time.Now().After(entry.Expires) {
+		_ = c.Delete(ctx, key)
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// responseRecorder passes the response through while retaining a copy of the
+// status and body for storage.
+type responseRecorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+	status   int
+}
+
+func (rr *responseRecorder) Flush() {
+	_ = http.NewResponseController(rr.ResponseWriter).Flush()
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	if !rr.overflow {
+		if rr.body.Len()+len(b) > maxCachedResponseSize {
+			rr.overflow = true
+			rr.body.Reset()
+		} else {
+			rr.body.Write(b)
+		}
+	}
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
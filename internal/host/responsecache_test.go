@@ -0,0 +1,234 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestResponseCachePolicyFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		extension any
+		want      *responseCachePolicy
+		wantErr   bool
+	}{
+		{
+			name: "no hint",
+		},
+		{
+			name:      "duration string",
+			extension: "5m",
+			want:      &responseCachePolicy{TTL: 5 * time.Minute},
+		},
+		{
+			name:      "object",
+			extension: json.RawMessage(`{"ttl":"30s","vary":["Accept-Language"]}`),
+			want:      &responseCachePolicy{TTL: 30 * time.Second, Vary: []string{"Accept-Language"}},
+		},
+		{
+			name:      "capped ttl",
+			extension: "720h",
+			want:      &responseCachePolicy{TTL: maxResponseCacheTTL},
+		},
+		{
+			name:      "zero ttl",
+			extension: "0s",
+		},
+		{
+			name:      "invalid ttl",
+			extension: "soon",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &openapi.Operation{}
+			if tt.extension != nil {
+				op.Extensions = map[string]any{cacheHintExtension: tt.extension}
+			}
+			got, err := responseCachePolicyFor(op)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHostHandler_serveCachedResponse(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "foo", nil)
+	hh := NewHostHandler(nil, "test-host", "default", logr.Discard(), cacheManager)
+
+	fn := &kdexv1alpha1.KDexFunction{
+		ObjectMeta: metav1.ObjectMeta{Name: "users"},
+	}
+	policy := &responseCachePolicy{TTL: time.Minute, Vary: []string{"Accept-Language"}}
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(`{"lang":"` + r.Header.Get("Accept-Language") + `"}`))
+	})
+
+	snapshot := "s1"
+	serve := func(lang string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/users?b=2&a=1", nil)
+		req.Header.Set("Accept-Language", lang)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		// A header of the handlers serving the function
+		w.Header().Set("X-Kdex-Snapshot", snapshot)
+		hh.serveCachedResponse(w, req, fn, policy, next)
+		return w
+	}
+
+	w := serve("en")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, 1, calls)
+
+	snapshot = "s2"
+	w = serve("en")
+	assert.Equal(t, "HIT", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "s2", w.Header().Get("X-Kdex-Snapshot"), "the headers of the serving handlers are not stored")
+	assert.Equal(t, `{"lang":"en"}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+
+	// Vary headers are part of the key
+	w = serve("fr")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, 2, calls)
+
+	// Credentials the host does not check are part of the key
+	w = serve("en", "Authorization", "Bearer alice")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, 3, calls)
+	w = serve("en", "Authorization", "Bearer alice")
+	assert.Equal(t, "HIT", w.Header().Get(responseCacheHeader))
+	w = serve("en", "Authorization", "Bearer bob")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	w = serve("en", "Cookie", "session=alice")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, 5, calls)
+
+	// Purging rotates the epoch
+	require.NoError(t, hh.purgeResponseCache(context.Background(), fn))
+	w = serve("en")
+	assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, 6, calls)
+}
+
+func TestHostHandler_serveCachedResponse_NotCacheable(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "foo", nil)
+	hh := NewHostHandler(nil, "test-host", "default", logr.Discard(), cacheManager)
+
+	fn := &kdexv1alpha1.KDexFunction{
+		ObjectMeta: metav1.ObjectMeta{Name: "users"},
+	}
+	policy := &responseCachePolicy{TTL: time.Minute}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "set cookie",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Set-Cookie", "a=b")
+				_, _ = w.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "vary on a header not keyed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Vary", "Accept-Encoding")
+				_, _ = w.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "vary on anything",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Vary", "*")
+				_, _ = w.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "no-store",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "no-store")
+				_, _ = w.Write([]byte("ok"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				tt.handler(w, r)
+			})
+			require.NoError(t, hh.purgeResponseCache(context.Background(), fn))
+
+			for range 2 {
+				w := httptest.NewRecorder()
+				hh.serveCachedResponse(w, httptest.NewRequest("GET", "/v1/users", nil), fn, policy, next)
+				assert.Equal(t, "MISS", w.Header().Get(responseCacheHeader))
+			}
+			assert.Equal(t, 2, calls)
+		})
+	}
+}
+
+func TestHostHandler_cacheHandler(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "foo", nil)
+	hh := NewHostHandler(nil, "test-host", "default", logr.Discard(), cacheManager)
+	fn := kdexv1alpha1.KDexFunction{ObjectMeta: metav1.ObjectMeta{Name: "users"}}
+	fn.Spec.API.BasePath = "/v1/users"
+	hh.functions = []kdexv1alpha1.KDexFunction{fn}
+
+	mux := http.NewServeMux()
+	hh.cacheHandler(mux, map[string]ko.PathInfo{})
+	purge := func(entitlements ...any) int {
+		r := httptest.NewRequest(http.MethodDelete, "/-/cache/functions/users", nil)
+		if len(entitlements) > 0 {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": entitlements}))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, purge(), "authentication disabled")
+
+	hh.authChecker = auth.NewAuthorizationChecker(nil, logr.Discard())
+	hh.authConfig = &auth.Config{ActivePair: &keys.KeyPair{}}
+	assert.Equal(t, http.StatusNotFound, purge(), "anonymous")
+	assert.Equal(t, http.StatusNoContent, purge("functions:/v1/users:read", "functions:/v1/users:write"))
+}
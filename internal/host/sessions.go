@@ -0,0 +1,106 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/kdex-tech/host-manager/internal/auth"
+)
+
+// SessionList is the response of GET /-/admin/sessions.
+type SessionList struct {
+	Sessions []auth.Session `json:"sessions"`
+}
+
+// SessionRevocation is the response of DELETE /-/admin/sessions.
+type SessionRevocation struct {
+	Revoked int `json:"revoked"`
+}
+
+// SessionsGet serves the active refresh token sessions, those of the subject
+// query parameter when set.
+func (hh *HostHandler) SessionsGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	sessions, err := hh.authExchanger.ListSessions(r.Context(), r.URL.Query().Get("subject"))
+	if err != nil {
+		hh.log.Error(err, "failed to list sessions")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	hh.writeSessionsJSON(w, SessionList{Sessions: sessions})
+}
+
+// SessionsDelete revokes the sessions of the subject query parameter.
+func (hh *HostHandler) SessionsDelete(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	subject := r.URL.Query().Get("subject")
+	if subject == "" {
+		http.Error(w, "subject is required", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := hh.authExchanger.RevokeSubjectSessions(r.Context(), subject)
+	if err != nil {
+		hh.log.Error(err, "failed to revoke sessions", "subject", subject)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	hh.log.Info("sessions revoked", "subject", subject, "revoked", revoked)
+	hh.auditSessionRevocation(r, "sessions_revoked", subject, map[string]string{"revoked": strconv.Itoa(revoked)})
+	hh.writeSessionsJSON(w, SessionRevocation{Revoked: revoked})
+}
+
+// SessionDelete revokes the session of the id path value.
+func (hh *HostHandler) SessionDelete(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	id := r.PathValue("id")
+	found, err := hh.authExchanger.RevokeSession(r.Context(), id)
+	if err != nil {
+		hh.log.Error(err, "failed to revoke session", "session", id)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+
+	hh.log.Info("session revoked", "session", id)
+	hh.auditSessionRevocation(r, "session_revoked", "", map[string]string{"session": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditSessionRevocation records, in the audit log of the host, the sessions
+// revoked by the admin of the request.
+func (hh *HostHandler) auditSessionRevocation(r *http.Request, event string, subject string, details map[string]string) {
+	authContext, _ := auth.GetAuthContext(r.Context())
+	actor, _ := authContext.GetSubject()
+	hh.authConfig.Auditor.Record(hh.authConfig.WithClientIP(r), auth.AuditEvent{
+		Actor:    actor,
+		Category: auth.AuditCategoryRevocation,
+		Details:  details,
+		Event:    event,
+		Outcome:  auth.AuditOutcomeSuccess,
+		Subject:  subject,
+	})
+}
+
+func (hh *HostHandler) writeSessionsJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		hh.log.Error(err, "failed to encode sessions")
+	}
+}
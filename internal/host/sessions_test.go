@@ -0,0 +1,116 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_Sessions(t *testing.T) {
+	ctx := context.Background()
+	cacheManager, _ := cache.NewCacheManager("", "shop", new(1*time.Hour))
+	cfg, err := auth.NewConfig(
+		&kdexv1alpha1.Auth{},
+		func() (map[string]auth.AuthClient, error) { return map[string]auth.AuthClient{}, nil },
+		func() (*keys.KeyPairs, error) { return keys.GenerateECDSAKeyPair(), nil },
+		func() (string, string, string, error) { return "", "", "", nil },
+		func() ([]auth.OIDCProvider, string, error) { return nil, "", nil },
+		"shop",
+		"http://shop.example.com",
+		true,
+		cacheManager,
+	)
+	require.NoError(t, err)
+	var audit bytes.Buffer
+	cfg.Auditor = auth.NewAuditor("shop", []auth.AuditCategory{auth.AuditCategoryAccess, auth.AuditCategoryRevocation}, auth.NewStdoutAuditSink(&audit))
+	exchanger, err := auth.NewExchanger(ctx, *cfg, cacheManager, passwordIdentities{})
+	require.NoError(t, err)
+
+	for _, subject := range []string{"alice", "alice", "bob"} {
+		_, err := exchanger.LoginLocal(ctx, subject, "password", "", "", auth.AuthMethodLocal)
+		require.NoError(t, err)
+	}
+
+	hh := &HostHandler{
+		Name:          "shop",
+		authChecker:   auth.NewAuthorizationChecker(nil, logr.Discard()),
+		authConfig:    cfg,
+		authExchanger: exchanger,
+		log:           logr.Discard(),
+	}
+	mux := http.NewServeMux()
+	registeredPaths := map[string]ko.PathInfo{}
+	hh.sessionsHandler(mux, registeredPaths)
+	assert.Contains(t, registeredPaths, "/-/admin/sessions")
+	assert.Contains(t, registeredPaths, "/-/admin/sessions/{id}")
+
+	serve := func(method string, target string, entitlements ...any) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if len(entitlements) > 0 {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": entitlements}))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	list := func(target string) SessionList {
+		w := serve(http.MethodGet, target, "hosts:shop:read", "hosts:shop:write")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var sessions SessionList
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+		return sessions
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/sessions").Code, "anonymous")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/sessions", "hosts:other:read", "hosts:other:write").Code, "entitled to another host")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/-/admin/sessions?subject=alice").Code, "anonymous")
+
+	assert.Len(t, list("/-/admin/sessions").Sessions, 3)
+	aliceSessions := list("/-/admin/sessions?subject=alice").Sessions
+	require.Len(t, aliceSessions, 2)
+	assert.Equal(t, "alice", aliceSessions[0].Subject)
+
+	w := serve(http.MethodDelete, "/-/admin/sessions/"+aliceSessions[0].ID, "hosts:shop:read", "hosts:shop:write")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(http.MethodDelete, "/-/admin/sessions/"+aliceSessions[0].ID, "hosts:shop:read", "hosts:shop:write")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, list("/-/admin/sessions?subject=alice").Sessions, 1)
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodDelete, "/-/admin/sessions", "hosts:shop:read", "hosts:shop:write").Code, "no subject")
+
+	w = serve(http.MethodDelete, "/-/admin/sessions?subject=alice", "hosts:shop:read", "hosts:shop:write")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"revoked":1}`, w.Body.String())
+	assert.Empty(t, list("/-/admin/sessions?subject=alice").Sessions)
+	assert.Len(t, list("/-/admin/sessions?subject=bob").Sessions, 1)
+
+	// The denials and the revocations are audited
+	events := []string{}
+	decoder := json.NewDecoder(&audit)
+	for decoder.More() {
+		var event auth.AuditEvent
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event.Event+"/"+event.Outcome)
+	}
+	assert.Equal(t, []string{
+		"access_denied/failure",
+		"access_denied/failure",
+		"access_denied/failure",
+		"session_revoked/success",
+		"sessions_revoked/success",
+	}, events)
+}
@@ -0,0 +1,685 @@
+package host
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// ShadowHeader is set on the requests of a shadow replay, so that the
+	// target can tell them from live traffic.
+	ShadowHeader = "X-Kdex-Shadow"
+
+	defaultShadowRequests   = 10_000
+	defaultShadowWindow     = 5 * time.Minute
+	maxShadowMultiplier     = 10
+	maxShadowRequests       = 100_000
+	maxShadowWindow         = time.Hour
+	shadowReplayConcurrency = 32
+	shadowReplayTimeout     = 15 * time.Second
+)
+
+// ShadowCaptureRequest starts the capture of the live traffic of a function.
+type ShadowCaptureRequest struct {
+	// MaxRequests caps the requests recorded, 10000 by default and at most
+	// 100000.
+	MaxRequests int `json:"maxRequests,omitempty"`
+	// Window is how long the traffic is recorded, 5m by default and at most
+	// 1h.
+	Window *metav1.Duration `json:"window,omitempty"`
+}
+
+// ShadowReplayRequest replays the captured traffic of a function.
+type ShadowReplayRequest struct {
+	// Multiplier is how many times each recorded request is sent, 1 to 10.
+	Multiplier int `json:"multiplier,omitempty"`
+	// Target is the URL the traffic is replayed against, the URL of the
+	// canary of the function by default. Other targets must be services of
+	// the namespace of the host, e.g. http://orders-v2.shop.svc:8080.
+	Target string `json:"target,omitempty"`
+}
+
+// ShadowStatus is the state of the shadow capture of a function.
+type ShadowStatus struct {
+	Capturing bool          `json:"capturing"`
+	Paths     []ShadowPath  `json:"paths"`
+	Replay    *ShadowReport `json:"replay,omitempty"`
+	Requests  int           `json:"requests"`
+	Started   time.Time     `json:"started"`
+	Until     time.Time     `json:"until"`
+}
+
+// ShadowPath is the traffic of an operation during the capture.
+type ShadowPath struct {
+	// Pattern is the operation, e.g. "GET /api/orders/{id}".
+	Pattern       string  `json:"pattern"`
+	RatePerSecond float64 `json:"ratePerSecond"`
+	Requests      int     `json:"requests"`
+}
+
+// ShadowReport compares the replay of the captured traffic with the live
+// traffic.
+type ShadowReport struct {
+	// Delta is the replay minus the live traffic.
+	Delta    ShadowDelta `json:"delta"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	// Image is the canary image the traffic is replayed against, the replay
+	// then counts in the analysis of the canary.
+	Image      string      `json:"image,omitempty"`
+	Live       ShadowStats `json:"live"`
+	Multiplier int         `json:"multiplier"`
+	Replay     ShadowStats `json:"replay"`
+	Started    time.Time   `json:"started"`
+	Target     string      `json:"target"`
+}
+
+// ShadowStats are the latencies, in milliseconds, and the failures, the
+// responses with a 5xx status, of a traffic.
+type ShadowStats struct {
+	ErrorRatio float64 `json:"errorRatio"`
+	Failures   int64   `json:"failures"`
+	P50        float64 `json:"p50Ms"`
+	P95        float64 `json:"p95Ms"`
+	Requests   int64   `json:"requests"`
+}
+
+// ShadowDelta is the difference between two traffics.
+type ShadowDelta struct {
+	ErrorRatio float64 `json:"errorRatio"`
+	P50        float64 `json:"p50Ms"`
+	P95        float64 `json:"p95Ms"`
+}
+
+// shadowRequest is a request recorded by a shadow capture. Its parameters
+// are anonymized and its body is not recorded.
+type shadowRequest struct {
+	duration time.Duration
+	failed   bool
+	method   string
+	// offset is when the request started, since the start of the capture.
+	offset  time.Duration
+	path    string
+	pattern string
+	query   string
+}
+
+// shadowCapture records the live traffic of a function for a window, to
+// replay it against a staging deployment.
+type shadowCapture struct {
+	cancel          context.CancelFunc
+	limit           int
+	mu              sync.Mutex
+	replayDurations []time.Duration
+	report          *ShadowReport
+	requests        []shadowRequest
+	// salt keys the tokens of the anonymized parameters, they can not be
+	// matched across captures.
+	salt    []byte
+	started time.Time
+	until   time.Time
+}
+
+// shadowCaptureFor returns the capture of the function while it records,
+// nil otherwise.
+func (hh *HostHandler) shadowCaptureFor(name string) *shadowCapture {
+	v, ok := hh.shadows.Load(name)
+	if !ok {
+		return nil
+	}
+	capture := v.(*shadowCapture)
+	if time.Now().After(capture.until) {
+		return nil
+	}
+	return capture
+}
+
+// record adds the request, which started at start and answered the status
+// code, to the capture. Requests which match no operation of the function are
+// not recorded.
+func (c *shadowCapture) record(r *http.Request, pattern string, code int, start time.Time) {
+	if pattern == "" {
+		return
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.until) || len(c.requests) >= c.limit {
+		return
+	}
+
+	c.requests = append(c.requests, shadowRequest{
+		duration: now.Sub(start),
+		failed:   code >= http.StatusInternalServerError,
+		method:   r.Method,
+		offset:   max(start.Sub(c.started), 0),
+		path:     c.anonymizePath(pattern, r.URL.Path),
+		pattern:  pattern,
+		query:    c.anonymizeQuery(r.URL.RawQuery),
+	})
+}
+
+// anonymize replaces the value with a token. A value always gets the same
+// token during a capture, so that the cardinality of the parameters is kept.
+func (c *shadowCapture) anonymize(value string) string {
+	mac := hmac.New(sha256.New, c.salt)
+	_, _ = mac.Write([]byte(value))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// anonymizePath replaces the segments of the path which are parameters of
+// the pattern it matched.
+func (c *shadowCapture) anonymizePath(pattern string, p string) string {
+	_, template, _ := strings.Cut(pattern, " ")
+	templateSegments := strings.Split(template, "/")
+	segments := strings.Split(p, "/")
+
+	for i, segment := range templateSegments {
+		if i >= len(segments) || !strings.HasPrefix(segment, "{") || segment == "{$}" {
+			continue
+		}
+		last := len(segments)
+		if !strings.HasSuffix(segment, "...}") {
+			last = i + 1
+		}
+		for j := i; j < last; j++ {
+			if segments[j] != "" {
+				segments[j] = c.anonymize(segments[j])
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// anonymizeQuery replaces the values of the query, its keys are kept.
+func (c *shadowCapture) anonymizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	for _, vs := range values {
+		for i := range vs {
+			vs[i] = c.anonymize(vs[i])
+		}
+	}
+	return values.Encode()
+}
+
+// status returns the state of the capture, c.mu must be held.
+func (c *shadowCapture) status(now time.Time) ShadowStatus {
+	status := ShadowStatus{
+		Capturing: now.Before(c.until) && len(c.requests) < c.limit,
+		Paths:     []ShadowPath{},
+		Requests:  len(c.requests),
+		Started:   c.started,
+		Until:     c.until,
+	}
+
+	counts := map[string]int{}
+	for _, req := range c.requests {
+		counts[req.pattern]++
+	}
+	end := now
+	if c.until.Before(end) {
+		end = c.until
+	}
+	seconds := max(end.Sub(c.started).Seconds(), 1)
+	for pattern, requests := range counts {
+		status.Paths = append(status.Paths, ShadowPath{
+			Pattern:       pattern,
+			RatePerSecond: float64(requests) / seconds,
+			Requests:      requests,
+		})
+	}
+	slices.SortFunc(status.Paths, func(a, b ShadowPath) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Pattern, b.Pattern))
+	})
+
+	if c.report != nil {
+		report := *c.report
+		durations := slices.Clone(c.replayDurations)
+		slices.Sort(durations)
+		report.Replay.P50 = percentileMillis(durations, 0.5)
+		report.Replay.P95 = percentileMillis(durations, 0.95)
+		report.Replay.ErrorRatio = errorRatio(report.Replay.Requests, report.Replay.Failures)
+		report.Delta = ShadowDelta{
+			ErrorRatio: report.Replay.ErrorRatio - report.Live.ErrorRatio,
+			P50:        report.Replay.P50 - report.Live.P50,
+			P95:        report.Replay.P95 - report.Live.P95,
+		}
+		status.Replay = &report
+	}
+
+	return status
+}
+
+// observe counts a request of the replay.
+func (c *shadowCapture) observe(report *ShadowReport, duration time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.report != report {
+		return
+	}
+	c.replayDurations = append(c.replayDurations, duration)
+	report.Replay.Requests++
+	if failed {
+		report.Replay.Failures++
+	}
+}
+
+// liveStats returns the stats of the recorded requests.
+func liveStats(requests []shadowRequest) ShadowStats {
+	stats := ShadowStats{Requests: int64(len(requests))}
+	durations := make([]time.Duration, 0, len(requests))
+	for _, req := range requests {
+		durations = append(durations, req.duration)
+		if req.failed {
+			stats.Failures++
+		}
+	}
+	slices.Sort(durations)
+	stats.ErrorRatio = errorRatio(stats.Requests, stats.Failures)
+	stats.P50 = percentileMillis(durations, 0.5)
+	stats.P95 = percentileMillis(durations, 0.95)
+	return stats
+}
+
+func errorRatio(requests int64, failures int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(failures) / float64(requests)
+}
+
+// percentileMillis returns the q quantile of the sorted durations in
+// milliseconds.
+func percentileMillis(sorted []time.Duration, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return float64(sorted[int(q*float64(len(sorted)-1))]) / float64(time.Millisecond)
+}
+
+// ShadowStats returns the requests and the failed requests of the replay of
+// the captured traffic of the function against its canary image.
+func (hh *HostHandler) ShadowStats(name string, image string) (requests int64, failures int64) {
+	v, ok := hh.shadows.Load(name)
+	if !ok {
+		return 0, 0
+	}
+	capture := v.(*shadowCapture)
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	if capture.report == nil || capture.report.Image != image {
+		return 0, 0
+	}
+	return capture.report.Replay.Requests, capture.report.Replay.Failures
+}
+
+// replayShadow sends the recorded requests to the target, each multiplier
+// times, at the pace they were recorded.
+func (hh *HostHandler) replayShadow(
+	ctx context.Context,
+	capture *shadowCapture,
+	report *ShadowReport,
+	target *url.URL,
+	requests []shadowRequest,
+) {
+	client := &http.Client{
+		// The replay stays on the allowed target, the redirects it answers
+		// are its responses.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: shadowReplayTimeout,
+	}
+	slots := make(chan struct{}, shadowReplayConcurrency)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, req := range requests {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(req.offset))):
+		}
+
+		for range report.Multiplier {
+			select {
+			case <-ctx.Done():
+				return
+			case slots <- struct{}{}:
+			}
+			wg.Go(func() {
+				defer func() { <-slots }()
+				duration, failed, err := sendShadowRequest(ctx, client, target, req)
+				if err != nil && ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					hh.log.V(1).Info("shadow request failed", "target", target.String(), "err", err.Error())
+				}
+				capture.observe(report, duration, failed)
+			})
+		}
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	if capture.report == report {
+		report.Finished = new(time.Now())
+	}
+}
+
+// sendShadowRequest sends the recorded request to the target. Requests which
+// fail to be sent count as failed.
+func sendShadowRequest(
+	ctx context.Context, client *http.Client, target *url.URL, req shadowRequest,
+) (time.Duration, bool, error) {
+	u := *target
+	u.Path = path.Join(target.Path, req.path)
+	if strings.HasSuffix(req.path, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	u.RawQuery = req.query
+
+	out, err := http.NewRequestWithContext(ctx, req.method, u.String(), nil)
+	if err != nil {
+		return 0, true, err
+	}
+	out.Header.Set(ShadowHeader, "true")
+
+	start := time.Now()
+	resp, err := client.Do(out)
+	if err != nil {
+		return time.Since(start), true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return time.Since(start), resp.StatusCode >= http.StatusInternalServerError, nil
+}
+
+// shadowFunction returns a copy of the function of the request, nil when the
+// request was answered because the function does not exist or the caller
+// may not write it. No caller may when the host has no authentication.
+func (hh *HostHandler) shadowFunction(w http.ResponseWriter, r *http.Request) *kdexv1alpha1.KDexFunction {
+	name := r.PathValue("function")
+
+	hh.mu.RLock()
+	var fn *kdexv1alpha1.KDexFunction
+	for i := range hh.functions {
+		if hh.functions[i].Name == name {
+			fn = hh.functions[i].DeepCopy()
+			break
+		}
+	}
+	hh.mu.RUnlock()
+
+	if fn == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return nil
+	}
+
+	if shouldReturn := hh.handleRequiredAuth(
+		r,
+		w,
+		"functions",
+		fn.Spec.API.BasePath,
+		[]kdexv1alpha1.SecurityRequirement{
+			{
+				"bearer": []string{fmt.Sprintf("functions:%s:write", fn.Spec.API.BasePath)},
+			},
+		},
+	); shouldReturn {
+		return nil
+	}
+
+	return fn
+}
+
+// ShadowCapturePost starts recording the live traffic of the function,
+// replacing its previous capture.
+func (hh *HostHandler) ShadowCapturePost(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	body := ShadowCaptureRequest{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("invalid shadow capture request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	window := defaultShadowWindow
+	if body.Window != nil {
+		window = body.Window.Duration
+	}
+	if window <= 0 || window > maxShadowWindow {
+		http.Error(w, fmt.Sprintf("invalid shadow capture request: the window must be positive and at most %s", maxShadowWindow), http.StatusBadRequest)
+		return
+	}
+	limit := cmp.Or(body.MaxRequests, defaultShadowRequests)
+	if limit < 0 || limit > maxShadowRequests {
+		http.Error(w, fmt.Sprintf("invalid shadow capture request: maxRequests must be at most %d", maxShadowRequests), http.StatusBadRequest)
+		return
+	}
+
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+	now := time.Now()
+	capture := &shadowCapture{
+		limit:   limit,
+		salt:    salt,
+		started: now,
+		until:   now.Add(window),
+	}
+	if previous, loaded := hh.shadows.Swap(fn.Name, capture); loaded {
+		previous.(*shadowCapture).stop()
+	}
+
+	hh.log.Info("shadow capture started", "function", fn.Name, "window", window.String(), "maxRequests", limit)
+
+	capture.mu.Lock()
+	status := capture.status(now)
+	capture.mu.Unlock()
+	hh.writeShadowStatus(w, http.StatusAccepted, status)
+}
+
+// ShadowGet serves the state of the capture of the function and the report
+// of its latest replay.
+func (hh *HostHandler) ShadowGet(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	v, ok := hh.shadows.Load(fn.Name)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	capture := v.(*shadowCapture)
+
+	capture.mu.Lock()
+	status := capture.status(time.Now())
+	capture.mu.Unlock()
+	hh.writeShadowStatus(w, http.StatusOK, status)
+}
+
+// ShadowDelete stops the capture and the replay of the function and discards
+// them.
+func (hh *HostHandler) ShadowDelete(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	if v, loaded := hh.shadows.LoadAndDelete(fn.Name); loaded {
+		v.(*shadowCapture).stop()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ShadowReplayPost replays the captured traffic of the function against the
+// target, once the capture ended. A replay against the canary of the function
+// counts in the analysis of the canary.
+func (hh *HostHandler) ShadowReplayPost(w http.ResponseWriter, r *http.Request) {
+	fn := hh.shadowFunction(w, r)
+	if fn == nil {
+		return
+	}
+
+	body := ShadowReplayRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf("invalid shadow replay request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	multiplier := cmp.Or(body.Multiplier, 1)
+	if multiplier < 1 || multiplier > maxShadowMultiplier {
+		http.Error(w, fmt.Sprintf("invalid shadow replay request: the multiplier must be 1 to %d", maxShadowMultiplier), http.StatusBadRequest)
+		return
+	}
+
+	image := ""
+	if body.Target == "" {
+		body.Target = fn.Status.Attributes[deploy.CanaryURLAttribute]
+		image = fn.Status.Attributes[deploy.CanaryImageAttribute]
+	} else if body.Target == fn.Status.Attributes[deploy.CanaryURLAttribute] {
+		image = fn.Status.Attributes[deploy.CanaryImageAttribute]
+	}
+	if body.Target == "" {
+		http.Error(w, "invalid shadow replay request: a target is required, the function has no canary", http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(body.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, fmt.Sprintf("invalid shadow replay request: invalid target %q", body.Target), http.StatusBadRequest)
+		return
+	}
+	if !hh.shadowTargetAllowed(fn, target) {
+		http.Error(w, fmt.Sprintf("invalid shadow replay request: the target %q is neither the canary of the function nor a service of the namespace %s", body.Target, hh.Namespace), http.StatusBadRequest)
+		return
+	}
+
+	v, ok := hh.shadows.Load(fn.Name)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound)+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	capture := v.(*shadowCapture)
+
+	now := time.Now()
+	capture.mu.Lock()
+	if capture.status(now).Capturing {
+		capture.mu.Unlock()
+		http.Error(w, "the traffic is still being captured", http.StatusConflict)
+		return
+	}
+	if capture.report != nil && capture.report.Finished == nil {
+		capture.mu.Unlock()
+		http.Error(w, "the traffic is already being replayed", http.StatusConflict)
+		return
+	}
+
+	requests := slices.Clone(capture.requests)
+	slices.SortFunc(requests, func(a, b shadowRequest) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+	report := &ShadowReport{
+		Image:      image,
+		Live:       liveStats(requests),
+		Multiplier: multiplier,
+		Started:    now,
+		Target:     target.String(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	capture.cancel = cancel
+	capture.report = report
+	capture.replayDurations = nil
+	status := capture.status(now)
+	capture.mu.Unlock()
+
+	hh.log.Info("shadow replay started", "function", fn.Name, "target", target.String(), "multiplier", multiplier, "requests", len(requests))
+
+	go hh.replayShadow(ctx, capture, report, target, requests)
+
+	hh.writeShadowStatus(w, http.StatusAccepted, status)
+}
+
+// shadowTargetAllowed returns whether the traffic of the function may be
+// replayed against the target: the canary of the function, or a service of the
+// namespace of the host addressed by its cluster DNS name.
+func (hh *HostHandler) shadowTargetAllowed(fn *kdexv1alpha1.KDexFunction, target *url.URL) bool {
+	if canary, err := url.Parse(fn.Status.Attributes[deploy.CanaryURLAttribute]); err == nil && canary.Host != "" && canary.Host == target.Host {
+		return true
+	}
+	if hh.Namespace == "" {
+		return false
+	}
+
+	for _, suffix := range []string{".svc", ".svc.cluster.local"} {
+		service, ok := strings.CutSuffix(target.Hostname(), "."+hh.Namespace+suffix)
+		if ok && service != "" && !strings.Contains(service, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// stop cancels the replay of the capture.
+func (c *shadowCapture) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (hh *HostHandler) writeShadowStatus(w http.ResponseWriter, code int, status ShadowStatus) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		hh.log.Error(err, "failed to encode shadow status")
+	}
+}
@@ -0,0 +1,245 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/deploy"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestShadowCapture_anonymizePath(t *testing.T) {
+	capture := &shadowCapture{salt: []byte("salt")}
+	token := func(value string) string { return capture.anonymize(value) }
+
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    string
+	}{
+		{
+			name:    "no parameters",
+			pattern: "GET /api/orders",
+			path:    "/api/orders",
+			want:    "/api/orders",
+		},
+		{
+			name:    "parameters",
+			pattern: "GET /api/customers/{customer}/orders/{id}",
+			path:    "/api/customers/jane/orders/42",
+			want:    "/api/customers/" + token("jane") + "/orders/" + token("42"),
+		},
+		{
+			name:    "wildcard",
+			pattern: "GET /api/files/{path...}",
+			path:    "/api/files/jane/taxes.pdf",
+			want:    "/api/files/" + token("jane") + "/" + token("taxes.pdf"),
+		},
+		{
+			name:    "trailing slash",
+			pattern: "GET /api/orders/{$}",
+			path:    "/api/orders/",
+			want:    "/api/orders/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, capture.anonymizePath(tt.pattern, tt.path))
+		})
+	}
+
+	assert.Equal(t, "customer="+token("jane")+"&limit="+token("5"), capture.anonymizeQuery("limit=5&customer=jane"))
+	assert.NotEqual(t, token("jane"), (&shadowCapture{salt: []byte("other")}).anonymize("jane"), "the tokens depend on the capture")
+}
+
+func TestHostHandler_shadow(t *testing.T) {
+	var mu sync.Mutex
+	received := []string{}
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Get(ShadowHeader)+" "+r.URL.RequestURI())
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer canary.Close()
+
+	api := ko.OpenAPI{
+		BasePath: "/api/orders",
+		Paths: map[string]ko.PathItem{
+			"/api/orders/{id}": {
+				Get: &openapi.Operation{OperationID: "get-order"},
+			},
+		},
+	}
+
+	fn := kdexv1alpha1.KDexFunction{}
+	fn.Name = "orders"
+	fn.Spec.API = *api.ToKDexAPI()
+	fn.Status.Attributes = map[string]string{
+		deploy.CanaryImageAttribute: "orders:v2",
+		deploy.CanaryURLAttribute:   canary.URL,
+	}
+
+	hh := &HostHandler{
+		Namespace: "shop",
+		functions: []kdexv1alpha1.KDexFunction{fn},
+		log:       logr.Discard(),
+	}
+	mux := http.NewServeMux()
+	hh.shadowHandler(mux, map[string]ko.PathInfo{})
+
+	entitled := true
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if entitled {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": []any{"functions:/api/orders:read", "functions:/api/orders:write"}}))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/shadow/orders", `{"window": "1h"}`).Code, "authentication disabled")
+	hh.authChecker = auth.NewAuthorizationChecker(nil, logr.Discard())
+	hh.authConfig = &auth.Config{ActivePair: &keys.KeyPair{}}
+	entitled = false
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/shadow/orders", `{"window": "1h"}`).Code, "anonymous")
+	entitled = true
+	status := func() ShadowStatus {
+		w := serve(http.MethodGet, "/-/admin/shadow/orders", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		status := ShadowStatus{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+		return status
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/shadow/orders", "").Code, "nothing captured")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/-/admin/shadow/payments", "").Code, "unknown function")
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/-/admin/shadow/orders", `{"window": "2h"}`).Code)
+	require.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/-/admin/shadow/orders", `{"window": "1h"}`).Code)
+
+	capture := hh.shadowCaptureFor("orders")
+	require.NotNil(t, capture)
+	for _, target := range []string{"/api/orders/42?customer=jane", "/api/orders/42", "/api/orders/7", "/api/unknown"} {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		capture.record(r, functionPattern(r, &fn), http.StatusOK, time.Now())
+	}
+
+	captured := status()
+	assert.True(t, captured.Capturing)
+	assert.Equal(t, 3, captured.Requests, "requests matching no operation are not recorded")
+	require.Len(t, captured.Paths, 1)
+	assert.Equal(t, "GET /api/orders/{id}", captured.Paths[0].Pattern)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/-/admin/shadow/orders/replay", "").Code, "still capturing")
+
+	capture.mu.Lock()
+	capture.until = time.Now()
+	capture.mu.Unlock()
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/-/admin/shadow/orders/replay", `{"multiplier": 20}`).Code)
+	for _, target := range []string{"http://example.com", "http://169.254.169.254/latest", "http://orders.other.svc", "http://a.b.shop.svc"} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/-/admin/shadow/orders/replay", `{"target": "`+target+`"}`).Code, target)
+	}
+	require.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/-/admin/shadow/orders/replay", `{"multiplier": 2}`).Code)
+
+	require.Eventually(t, func() bool {
+		return status().Replay.Finished != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	report := status().Replay
+	assert.Equal(t, "orders:v2", report.Image, "the canary is the default target")
+	assert.Equal(t, canary.URL, report.Target)
+	assert.Equal(t, int64(3), report.Live.Requests)
+	assert.Zero(t, report.Live.Failures)
+	assert.Equal(t, int64(6), report.Replay.Requests)
+	assert.Equal(t, int64(4), report.Replay.Failures)
+	assert.InDelta(t, 4.0/6, report.Delta.ErrorRatio, 0.001)
+
+	requests, failures := hh.ShadowStats("orders", "orders:v2")
+	assert.Equal(t, int64(6), requests)
+	assert.Equal(t, int64(4), failures)
+	requests, _ = hh.ShadowStats("orders", "orders:v1")
+	assert.Zero(t, requests, "the replay counts for the canary image only")
+
+	mu.Lock()
+	assert.Len(t, received, 6)
+	for _, uri := range received {
+		assert.True(t, strings.HasPrefix(uri, "true /api/orders/anon-"), uri)
+		assert.NotContains(t, uri, "/api/orders/42")
+		assert.NotContains(t, uri, "customer=jane")
+	}
+	mu.Unlock()
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/-/admin/shadow/orders", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/-/admin/shadow/orders", "").Code)
+}
+
+func TestHostHandler_replayShadowRedirect(t *testing.T) {
+	var redirected atomic.Int64
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer elsewhere.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, elsewhere.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer canary.Close()
+
+	target, err := url.Parse(canary.URL)
+	require.NoError(t, err)
+	report := &ShadowReport{Multiplier: 1}
+	capture := &shadowCapture{report: report}
+
+	hh := &HostHandler{log: logr.Discard()}
+	hh.replayShadow(context.Background(), capture, report, target, []shadowRequest{
+		{method: http.MethodGet, path: "/api/orders/anon-1"},
+	})
+
+	assert.Equal(t, int64(1), report.Replay.Requests)
+	assert.Zero(t, report.Replay.Failures, "the redirect is the response of the target")
+	assert.Zero(t, redirected.Load(), "the redirect is not followed")
+}
+
+func TestHostHandler_shadowTargetAllowed(t *testing.T) {
+	fn := &kdexv1alpha1.KDexFunction{}
+	fn.Status.Attributes = map[string]string{deploy.CanaryURLAttribute: "http://orders-canary.example.com"}
+	hh := &HostHandler{Namespace: "shop"}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "http://orders-canary.example.com/api", want: true},
+		{target: "http://orders-v2.shop.svc:8080", want: true},
+		{target: "https://orders-v2.shop.svc.cluster.local", want: true},
+		{target: "http://orders-v2.other.svc"},
+		{target: "http://evil.orders-v2.shop.svc"},
+		{target: "http://shop.svc"},
+		{target: "http://example.com"},
+		{target: "http://10.0.0.1"},
+	}
+	for _, tt := range tests {
+		target, err := url.Parse(tt.target)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, hh.shadowTargetAllowed(fn, target), tt.target)
+	}
+}
@@ -0,0 +1,455 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SLOsAnnotation holds, on a host, the JSON encoded SLOs of its paths,
+	// e.g. {"objectives": [{"name": "checkout", "paths": ["/checkout", "/api/orders"], "target": 99.9},
+	// {"name": "checkout-latency", "paths": ["/checkout"], "target": 99, "latency": "300ms"}],
+	// "webhook": "https://alerts.example.com/hooks/slo"}.
+	SLOsAnnotation = "kdex.dev/slos"
+
+	// SLOSeverityOK is the severity of the SLOs whose error budget is not at
+	// risk.
+	SLOSeverityOK = "ok"
+	// SLOSeverityWarning is the severity of the SLOs burning their error
+	// budget slowly, over 6h and 30m, or which exhausted it.
+	SLOSeverityWarning = "warning"
+	// SLOSeverityCritical is the severity of the SLOs burning their error
+	// budget fast, over 1h and 5m.
+	SLOSeverityCritical = "critical"
+
+	// The burn rates of the multiwindow alerts, which exhaust a 30 days error
+	// budget in 2 and 5 days.
+	criticalBurnRate = 14.4
+	warningBurnRate  = 6
+
+	defaultSLOWindow      = 30 * 24 * time.Hour
+	maxSLOWindow          = 30 * 24 * time.Hour
+	minSLOWindow          = time.Hour
+	sloEvaluationInterval = time.Minute
+	sloWebhookTimeout     = 10 * time.Second
+)
+
+// sloBurnWindows are the windows the burn rates are computed over, the
+// longest first.
+var sloBurnWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"6h", 6 * time.Hour},
+	{"1h", time.Hour},
+	{"30m", 30 * time.Minute},
+	{"5m", 5 * time.Minute},
+}
+
+var sloName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// SLOs are the service level objectives of the paths of a host.
+type SLOs struct {
+	Objectives []SLO `json:"objectives"`
+	// Webhook receives a JSON encoded SLOAlert when the severity of an SLO
+	// changes.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// SLO is the objective of a class of paths. The requests failing with a 5xx
+// status are bad, or with a latency the ones slower than it.
+type SLO struct {
+	// Latency makes the SLO a latency objective.
+	Latency *metav1.Duration `json:"latency,omitempty"`
+	Name    string           `json:"name"`
+	// Paths are the prefixes of the paths of the class, e.g. "/api/orders"
+	// matches "/api/orders" and "/api/orders/42".
+	Paths []string `json:"paths"`
+	// Target is the percentage of good requests, e.g. 99.9.
+	Target float64 `json:"target"`
+	// Window is the period of the error budget, 720h by default, from 1h to
+	// 720h.
+	Window *metav1.Duration `json:"window,omitempty"`
+}
+
+// SLOReport is the state of the SLOs of the host, as of their latest
+// evaluation.
+type SLOReport struct {
+	Evaluated  time.Time   `json:"evaluated"`
+	Objectives []SLOStatus `json:"objectives"`
+}
+
+// SLOStatus is the state of an SLO over its window.
+type SLOStatus struct {
+	BadRequests uint64 `json:"badRequests"`
+	// BudgetRemaining is the ratio of the error budget left, negative once it
+	// is overspent.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	// BurnRates are the rates the error budget is spent at by window, 1
+	// spending it exactly over the window of the SLO.
+	BurnRates map[string]float64 `json:"burnRates"`
+	Name      string             `json:"name"`
+	Requests  uint64             `json:"requests"`
+	Severity  string             `json:"severity"`
+	Target    float64            `json:"target"`
+	Window    string             `json:"window"`
+}
+
+// SLOAlert is sent to the webhook of the SLOs when the severity of one
+// changes, back to SLOSeverityOK included.
+type SLOAlert struct {
+	Host             string `json:"host"`
+	PreviousSeverity string `json:"previousSeverity"`
+	SLOStatus
+	Time time.Time `json:"time"`
+}
+
+// sloSet tracks the requests of the SLOs of a host.
+type sloSet struct {
+	report   *SLOReport
+	slos     SLOs
+	trackers []*sloTracker
+}
+
+// sloTracker counts the requests of an SLO by minute.
+type sloTracker struct {
+	buckets  []sloBucket
+	mu       sync.Mutex
+	severity string
+}
+
+type sloBucket struct {
+	bad    uint32
+	minute int64
+	total  uint32
+}
+
+// ParseSLOs returns the SLOs of the annotations of a host, with their
+// defaults, nil when SLOsAnnotation is not set.
+func ParseSLOs(annotations map[string]string) (*SLOs, error) {
+	value := annotations[SLOsAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	slos := &SLOs{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(slos); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", SLOsAnnotation, err)
+	}
+
+	if slos.Webhook != "" {
+		if target, err := url.Parse(slos.Webhook); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("invalid %s annotation: webhook must be an http(s) URL, got %q", SLOsAnnotation, slos.Webhook)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range slos.Objectives {
+		slo := &slos.Objectives[i]
+		if !sloName.MatchString(slo.Name) || seen[slo.Name] {
+			return nil, fmt.Errorf("invalid %s annotation: invalid or duplicate objective name %q", SLOsAnnotation, slo.Name)
+		}
+		seen[slo.Name] = true
+
+		if len(slo.Paths) == 0 {
+			return nil, fmt.Errorf("invalid %s annotation: objective %s has no paths", SLOsAnnotation, slo.Name)
+		}
+		for _, path := range slo.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("invalid %s annotation: path %q of objective %s must start with /", SLOsAnnotation, path, slo.Name)
+			}
+		}
+		if slo.Target <= 0 || slo.Target >= 100 {
+			return nil, fmt.Errorf("invalid %s annotation: target of objective %s must be a percentage between 0 and 100 exclusive", SLOsAnnotation, slo.Name)
+		}
+		if slo.Latency != nil && slo.Latency.Duration <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation: latency of objective %s must be positive", SLOsAnnotation, slo.Name)
+		}
+		if slo.Window == nil {
+			slo.Window = &metav1.Duration{Duration: defaultSLOWindow}
+		}
+		if slo.Window.Duration < minSLOWindow || slo.Window.Duration > maxSLOWindow {
+			return nil, fmt.Errorf("invalid %s annotation: window of objective %s must be between %s and %s", SLOsAnnotation, slo.Name, minSLOWindow, maxSLOWindow)
+		}
+	}
+
+	return slos, nil
+}
+
+// SetSLOs replaces the SLOs of the host, nil removes them. Changing the SLOs
+// resets their counts, which start over with the host anyway since they are
+// kept in memory.
+func (hh *HostHandler) SetSLOs(slos *SLOs) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if hh.slos != nil && slos != nil && reflect.DeepEqual(*slos, hh.slos.slos) {
+		return
+	}
+	if hh.sloCancel != nil {
+		hh.sloCancel()
+		hh.sloCancel = nil
+	}
+	sloBurnRateGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+	sloBudgetRemainingGauge.DeletePartialMatch(prometheus.Labels{"host": hh.Name})
+
+	if slos == nil || len(slos.Objectives) == 0 {
+		hh.slos = nil
+		return
+	}
+
+	set := &sloSet{slos: *slos}
+	for _, slo := range slos.Objectives {
+		minutes := int(max(slo.Window.Duration, sloBurnWindows[0].duration) / time.Minute)
+		set.trackers = append(set.trackers, &sloTracker{buckets: make([]sloBucket, minutes), severity: SLOSeverityOK})
+	}
+	hh.slos = set
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hh.sloCancel = cancel
+	go hh.runSLOEvaluations(ctx, set)
+}
+
+func (hh *HostHandler) runSLOEvaluations(ctx context.Context, set *sloSet) {
+	hh.evaluateSLOs(ctx, set, time.Now())
+
+	ticker := time.NewTicker(sloEvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			hh.evaluateSLOs(ctx, set, now)
+		}
+	}
+}
+
+// evaluateSLOs computes the state of the SLOs, exports it and notifies the
+// webhook of the SLOs whose severity changed.
+func (hh *HostHandler) evaluateSLOs(ctx context.Context, set *sloSet, now time.Time) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	report := &SLOReport{Evaluated: now}
+	alerts := []SLOAlert{}
+	for i, slo := range set.slos.Objectives {
+		tracker := set.trackers[i]
+		status := tracker.status(slo, now)
+		report.Objectives = append(report.Objectives, status)
+
+		for window, rate := range status.BurnRates {
+			sloBurnRateGauge.WithLabelValues(hh.Name, slo.Name, window).Set(rate)
+		}
+		sloBudgetRemainingGauge.WithLabelValues(hh.Name, slo.Name).Set(status.BudgetRemaining)
+
+		tracker.mu.Lock()
+		previous := tracker.severity
+		tracker.severity = status.Severity
+		tracker.mu.Unlock()
+		if previous != status.Severity {
+			hh.log.Info("slo severity changed", "slo", slo.Name, "severity", status.Severity, "previous", previous)
+			alerts = append(alerts, SLOAlert{Host: hh.Name, PreviousSeverity: previous, SLOStatus: status, Time: now})
+		}
+	}
+
+	hh.mu.Lock()
+	set.report = report
+	hh.mu.Unlock()
+
+	if set.slos.Webhook == "" {
+		return
+	}
+	for _, alert := range alerts {
+		if err := notifySLOWebhook(ctx, set.slos.Webhook, alert); err != nil && ctx.Err() == nil {
+			hh.log.Error(err, "failed to notify the slo webhook", "slo", alert.Name, "severity", alert.Severity)
+		}
+	}
+}
+
+func notifySLOWebhook(ctx context.Context, webhook string, alert SLOAlert) error {
+	ctx, cancel := context.WithTimeout(ctx, sloWebhookTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("the webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// observeSLOs wraps the response writer of a request of the host to count it
+// in the SLOs of its path once it is served.
+func (hh *HostHandler) observeSLOs(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	hh.mu.RLock()
+	set := hh.slos
+	hh.mu.RUnlock()
+
+	if set == nil {
+		return w, func() {}
+	}
+
+	start := time.Now()
+	sw := &statusResponseWriter{ResponseWriter: w}
+	return sw, func() {
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		set.record(r.URL.Path, status, time.Since(start), time.Now())
+	}
+}
+
+// record counts a request in the SLOs of its path.
+func (s *sloSet) record(path string, status int, latency time.Duration, now time.Time) {
+	for i, slo := range s.slos.Objectives {
+		if !slo.matches(path) {
+			continue
+		}
+
+		bad := status >= http.StatusInternalServerError
+		if slo.Latency != nil {
+			bad = latency > slo.Latency.Duration
+		}
+		s.trackers[i].record(now, bad)
+	}
+}
+
+func (slo SLO) matches(path string) bool {
+	for _, prefix := range slo.Paths {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *sloTracker) record(now time.Time, bad bool) {
+	minute := now.Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := &t.buckets[minute%int64(len(t.buckets))]
+	if bucket.minute != minute {
+		*bucket = sloBucket{minute: minute}
+	}
+	bucket.total++
+	if bad {
+		bucket.bad++
+	}
+}
+
+// counts returns the requests and the bad requests of the window ending now.
+func (t *sloTracker) counts(now time.Time, window time.Duration) (uint64, uint64) {
+	last := now.Unix() / 60
+	minutes := min(int64(window/time.Minute), int64(len(t.buckets)))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total, bad uint64
+	for minute := last - minutes + 1; minute <= last; minute++ {
+		bucket := t.buckets[minute%int64(len(t.buckets))]
+		if bucket.minute == minute {
+			total += uint64(bucket.total)
+			bad += uint64(bucket.bad)
+		}
+	}
+	return total, bad
+}
+
+// status computes the state of the SLO of the tracker.
+func (t *sloTracker) status(slo SLO, now time.Time) SLOStatus {
+	budget := 1 - slo.Target/100
+	burnRate := func(total uint64, bad uint64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(bad) / float64(total) / budget
+	}
+
+	status := SLOStatus{
+		BurnRates: map[string]float64{},
+		Name:      slo.Name,
+		Target:    slo.Target,
+		Window:    slo.Window.Duration.String(),
+	}
+	status.Requests, status.BadRequests = t.counts(now, slo.Window.Duration)
+	status.BudgetRemaining = 1 - burnRate(status.Requests, status.BadRequests)
+	for _, window := range sloBurnWindows {
+		status.BurnRates[window.name] = burnRate(t.counts(now, window.duration))
+	}
+
+	switch {
+	case status.BurnRates["1h"] > criticalBurnRate && status.BurnRates["5m"] > criticalBurnRate:
+		status.Severity = SLOSeverityCritical
+	case status.BurnRates["6h"] > warningBurnRate && status.BurnRates["30m"] > warningBurnRate,
+		status.Requests > 0 && status.BudgetRemaining <= 0:
+		status.Severity = SLOSeverityWarning
+	default:
+		status.Severity = SLOSeverityOK
+	}
+	return status
+}
+
+// SLOGet writes the state of the SLOs of the host as of their latest
+// evaluation.
+func (hh *HostHandler) SLOGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	hh.mu.RLock()
+	set := hh.slos
+	var report *SLOReport
+	if set != nil {
+		report = set.report
+	}
+	hh.mu.RUnlock()
+
+	if set == nil {
+		http.Error(w, "no slo declared", http.StatusNotFound)
+		return
+	}
+	if report == nil {
+		http.Error(w, "slos not evaluated yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		hh.log.Error(err, "failed to encode slo report")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
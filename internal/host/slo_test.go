@@ -0,0 +1,210 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseSLOs(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *SLOs
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "defaults",
+			value: `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "target": 99.9}, {"name": "checkout-latency", "paths": ["/checkout"], "target": 99, "latency": "300ms", "window": "168h"}], "webhook": "https://alerts.example.com/slo"}`,
+			want: &SLOs{
+				Objectives: []SLO{
+					{Name: "checkout", Paths: []string{"/checkout"}, Target: 99.9, Window: &metav1.Duration{Duration: 30 * 24 * time.Hour}},
+					{Latency: &metav1.Duration{Duration: 300 * time.Millisecond}, Name: "checkout-latency", Paths: []string{"/checkout"}, Target: 99, Window: &metav1.Duration{Duration: 168 * time.Hour}},
+				},
+				Webhook: "https://alerts.example.com/slo",
+			},
+		},
+		{
+			name:    "duplicate name",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "target": 99}, {"name": "checkout", "paths": ["/cart"], "target": 99}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no paths",
+			value:   `{"objectives": [{"name": "checkout", "target": 99}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "relative path",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["checkout"], "target": 99}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "target of 100",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "target": 100}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "long window",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "target": 99, "window": "2160h"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid webhook",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "target": 99}], "webhook": "alerts"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			value:   `{"objectives": [{"name": "checkout", "paths": ["/checkout"], "objective": 99}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSLOs(map[string]string{SLOsAnnotation: tt.value})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSLOTracker_status(t *testing.T) {
+	slo := SLO{Name: "checkout", Paths: []string{"/checkout"}, Target: 99, Window: &metav1.Duration{Duration: 24 * time.Hour}}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tracker := &sloTracker{buckets: make([]sloBucket, 24*60)}
+
+	assert.Equal(t, SLOSeverityOK, tracker.status(slo, now).Severity, "no requests")
+
+	for i := range 100 {
+		tracker.record(now.Add(-3*time.Hour), i < 6)
+	}
+	status := tracker.status(slo, now)
+	assert.Equal(t, uint64(100), status.Requests)
+	assert.Equal(t, uint64(6), status.BadRequests)
+	assert.InDelta(t, 6, status.BurnRates["6h"], 0.001)
+	assert.Zero(t, status.BurnRates["1h"])
+	assert.InDelta(t, -5, status.BudgetRemaining, 0.001)
+	assert.Equal(t, SLOSeverityWarning, status.Severity, "the budget is exhausted")
+
+	for i := range 100 {
+		tracker.record(now, i < 20)
+	}
+	status = tracker.status(slo, now)
+	assert.InDelta(t, 20, status.BurnRates["5m"], 0.001)
+	assert.InDelta(t, 20, status.BurnRates["1h"], 0.001)
+	assert.InDelta(t, 13, status.BurnRates["6h"], 0.001)
+	assert.Equal(t, SLOSeverityCritical, status.Severity)
+
+	assert.Zero(t, tracker.status(slo, now.Add(25*time.Hour)).Requests, "the requests leave the window")
+}
+
+func TestHostHandler_SLOs(t *testing.T) {
+	var mu sync.Mutex
+	alerts := []SLOAlert{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := SLOAlert{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	slos, err := ParseSLOs(map[string]string{SLOsAnnotation: `{"objectives": [
+		{"name": "orders", "paths": ["/api/orders"], "target": 99},
+		{"name": "orders-latency", "paths": ["/api/orders"], "target": 90, "latency": "100ms"}
+	], "webhook": "` + webhook.URL + `"}`})
+	require.NoError(t, err)
+
+	hh := &HostHandler{
+		Name:        "slo-test",
+		authChecker: auth.NewAuthorizationChecker(nil, logr.Discard()),
+		authConfig:  &auth.Config{ActivePair: &keys.KeyPair{}},
+		log:         logr.Discard(),
+	}
+	hh.SetSLOs(slos)
+	defer hh.SetSLOs(nil)
+
+	mux := http.NewServeMux()
+	hh.sloHandler(mux, map[string]ko.PathInfo{})
+	get := func() SLOReport {
+		r := httptest.NewRequest(http.MethodGet, "/-/admin/slo", nil)
+		r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": []any{"hosts:slo-test:read", "hosts:slo-test:write"}}))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		report := SLOReport{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+		return report
+	}
+
+	require.Eventually(t, func() bool {
+		hh.mu.RLock()
+		defer hh.mu.RUnlock()
+		return hh.slos.report != nil
+	}, 5*time.Second, 10*time.Millisecond, "the SLOs are evaluated when set")
+
+	serve := func(path string, status int) {
+		w, observed := hh.observeSLOs(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		w.WriteHeader(status)
+		observed()
+	}
+	for range 80 {
+		serve("/api/orders/42", http.StatusOK)
+	}
+	for range 20 {
+		serve("/api/orders", http.StatusBadGateway)
+	}
+	serve("/api/ordersx", http.StatusBadGateway)
+	serve("/checkout", http.StatusBadGateway)
+
+	hh.evaluateSLOs(context.Background(), hh.slos, time.Now())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/admin/slo", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "anonymous")
+
+	report := get()
+	require.Len(t, report.Objectives, 2)
+	orders := report.Objectives[0]
+	assert.Equal(t, uint64(100), orders.Requests, "requests of other paths are not counted")
+	assert.Equal(t, uint64(20), orders.BadRequests)
+	assert.Equal(t, SLOSeverityCritical, orders.Severity)
+	assert.Equal(t, SLOSeverityOK, report.Objectives[1].Severity, "the requests were fast")
+	assert.InDelta(t, 20, testutil.ToFloat64(sloBurnRateGauge.WithLabelValues("slo-test", "orders", "5m")), 0.001)
+	assert.InDelta(t, -19, testutil.ToFloat64(sloBudgetRemainingGauge.WithLabelValues("slo-test", "orders")), 0.001)
+
+	mu.Lock()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "slo-test", alerts[0].Host)
+	assert.Equal(t, "orders", alerts[0].Name)
+	assert.Equal(t, SLOSeverityOK, alerts[0].PreviousSeverity)
+	assert.Equal(t, SLOSeverityCritical, alerts[0].Severity)
+	mu.Unlock()
+
+	hh.evaluateSLOs(context.Background(), hh.slos, time.Now())
+	mu.Lock()
+	assert.Len(t, alerts, 1, "only changes of severity are notified")
+	mu.Unlock()
+}
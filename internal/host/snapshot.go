@@ -0,0 +1,69 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SnapshotHeader stamps every response with the version of the snapshot of the
+// host which served it.
+const SnapshotHeader = "X-KDex-Snapshot"
+
+// Snapshot describes the generation of the content of the host serving the
+// requests, applied by each SetHost, so that the caches of the clients and the
+// debugging of a response can tell which generation served it.
+type Snapshot struct {
+	// Generation is the generation of the host resource of the snapshot.
+	Generation int64  `json:"generation"`
+	Host       string `json:"host"`
+	// ManagerVersion is the version of the host manager serving the snapshot.
+	ManagerVersion string    `json:"managerVersion"`
+	Time           time.Time `json:"time"`
+	// Version increases with each snapshot of the host, from 1. It is 0 until
+	// the host is first set.
+	Version int64 `json:"version"`
+}
+
+// nextSnapshotLocked replaces the snapshot of the host by the next version, of
+// the generation, applied at now.
+func (hh *HostHandler) nextSnapshotLocked(generation int64, now time.Time) {
+	hh.snapshot = Snapshot{
+		Generation: generation,
+		Time:       now,
+		Version:    hh.snapshot.Version + 1,
+	}
+}
+
+// setSnapshotHeader stamps the response with the version of the snapshot.
+func setSnapshotHeader(w http.ResponseWriter, snapshot Snapshot) {
+	w.Header().Set(SnapshotHeader, strconv.FormatInt(snapshot.Version, 10))
+}
+
+// VersionGet serves the snapshot of the host.
+func (hh *HostHandler) VersionGet(w http.ResponseWriter, r *http.Request) {
+	hh.mu.RLock()
+	snapshot := hh.snapshot
+	hh.mu.RUnlock()
+
+	// The snapshot is revalidated by its version, which changes before any
+	// cache of the content of the host should.
+	etag := fmt.Sprintf(`"%d"`, snapshot.Version)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	snapshot.Host = hh.Name
+	snapshot.ManagerVersion = supportVersions().Version
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		hh.log.Error(err, "failed to encode snapshot")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
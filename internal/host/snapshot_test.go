@@ -0,0 +1,62 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_snapshot(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		hh.ServeHTTP(w, r)
+		return w
+	}
+	setHost := func(generation int64) {
+		hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+			DefaultLang: "en",
+			BrandName:   "Shop",
+		}, nil, generation, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+	}
+
+	assert.Equal(t, "0", get("/-/version", nil).Header().Get(SnapshotHeader), "the host is not set yet")
+
+	setHost(3)
+	w := get("/-/version", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(SnapshotHeader))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	snapshot := Snapshot{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&snapshot))
+	assert.Equal(t, int64(1), snapshot.Version)
+	assert.Equal(t, int64(3), snapshot.Generation)
+	assert.Equal(t, "shop", snapshot.Host)
+	assert.False(t, snapshot.Time.IsZero())
+
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, http.StatusNotModified, get("/-/version", http.Header{"If-None-Match": {etag}}).Code)
+
+	setHost(3)
+	assert.Equal(t, "2", get("/-/capabilities", nil).Header().Get(SnapshotHeader), "every response is stamped")
+	assert.Equal(t, "2", get("/-/unknown", nil).Header().Get(SnapshotHeader))
+	w = get("/-/version", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, w.Code, "the version is revalidated")
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&snapshot))
+	assert.Equal(t, int64(2), snapshot.Version)
+}
@@ -0,0 +1,349 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/sniffer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	DefaultSnifferHistorySize = 50
+
+	// ConfigMaps are limited to 1MiB, leave room for the metadata.
+	maxSnifferHistoryBytes = 900 << 10
+)
+
+// SnifferReport is the persisted form of a sniffer analysis result.
+type SnifferReport struct {
+	Function  *kdexv1alpha1.KDexFunction `json:"function"`
+	ID        string                     `json:"id"`
+	Lints     []string                   `json:"lints,omitempty"`
+	Method    string                     `json:"method"`
+	Path      string                     `json:"path"`
+	Timestamp time.Time                  `json:"timestamp"`
+}
+
+// AnalysisResult rebuilds the analysis result the report was made from.
+func (sr *SnifferReport) AnalysisResult() *sniffer.AnalysisResult {
+	return &sniffer.AnalysisResult{
+		Function: sr.Function,
+		Lints:    sr.Lints,
+		OriginalRequest: &http.Request{
+			Method: sr.Method,
+			URL:    &url.URL{Path: sr.Path},
+		},
+	}
+}
+
+// SnifferReportFilter selects persisted reports. Empty fields match every
+// report.
+type SnifferReportFilter struct {
+	Function string
+	// Lint matches reports having a lint containing the value.
+	Lint   string
+	Method string
+	// Path matches reports whose path starts with the value.
+	Path  string
+	Since time.Time
+}
+
+func (f SnifferReportFilter) matches(report SnifferReport) bool {
+	if f.Function != "" && (report.Function == nil || report.Function.Name != f.Function) {
+		return false
+	}
+	if f.Lint != "" && !slices.ContainsFunc(report.Lints, func(lint string) bool {
+		return strings.Contains(lint, f.Lint)
+	}) {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(report.Method, f.Method) {
+		return false
+	}
+	if f.Path != "" && !strings.HasPrefix(report.Path, f.Path) {
+		return false
+	}
+	if !f.Since.IsZero() && report.Timestamp.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// SnifferHistory persists the last analysis results of the sniffer in a
+// ConfigMap so that they can be reviewed after the pod restarts. Each report
+// is stored under its ID and the oldest reports are dropped once the history
+// is full.
+type SnifferHistory struct {
+	client    client.Client
+	log       logr.Logger
+	mu        sync.Mutex
+	name      string
+	namespace string
+	size      int
+}
+
+func NewSnifferHistory(c client.Client, hostName string, namespace string, size int, log logr.Logger) *SnifferHistory {
+	return &SnifferHistory{
+		client:    c,
+		log:       log,
+		name:      fmt.Sprintf("%s-sniffer-history", hostName),
+		namespace: namespace,
+		size:      size,
+	}
+}
+
+// Record persists the analysis result under the given ID.
+func (sh *SnifferHistory) Record(ctx context.Context, id string, result *sniffer.AnalysisResult) error {
+	report := SnifferReport{
+		ID:        id,
+		Lints:     result.Lints,
+		Timestamp: time.Now().UTC(),
+	}
+	if result.OriginalRequest != nil {
+		report.Method = result.OriginalRequest.Method
+		report.Path = result.OriginalRequest.URL.Path
+	}
+	if result.Function != nil {
+		report.Function = &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      result.Function.Name,
+				Namespace: result.Function.Namespace,
+			},
+			Spec: result.Function.Spec,
+		}
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configmap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sh.name,
+				Namespace: sh.namespace,
+			},
+		}
+
+		_, err := ctrl.CreateOrUpdate(ctx, sh.client, configmap, func() error {
+			if configmap.CreationTimestamp.IsZero() {
+				configmap.Labels = make(map[string]string)
+				configmap.Labels["app.kubernetes.io/name"] = "kdex-host"
+				configmap.Labels["kdex.dev/sniffer-history"] = "true"
+			}
+
+			reports := append(sh.decode(configmap), report)
+			slices.SortFunc(reports, func(a, b SnifferReport) int {
+				return b.Timestamp.Compare(a.Timestamp)
+			})
+
+			data := map[string]string{}
+			total := 0
+			for _, r := range reports {
+				if len(data) == sh.size {
+					break
+				}
+				encoded, err := json.Marshal(r)
+				if err != nil {
+					return err
+				}
+				if total+len(r.ID)+len(encoded) > maxSnifferHistoryBytes {
+					break
+				}
+				total += len(r.ID) + len(encoded)
+				data[r.ID] = string(encoded)
+			}
+			configmap.Data = data
+
+			return nil
+		})
+
+		return err
+	})
+}
+
+// Get returns the report stored under the given ID.
+func (sh *SnifferHistory) Get(ctx context.Context, id string) (*SnifferReport, bool, error) {
+	reports, err := sh.load(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, report := range reports {
+		if report.ID == id {
+			return &report, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// List returns the reports matching the filter, newest first.
+func (sh *SnifferHistory) List(ctx context.Context, filter SnifferReportFilter) ([]SnifferReport, error) {
+	reports, err := sh.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(reports, func(report SnifferReport) bool {
+		return !filter.matches(report)
+	}), nil
+}
+
+func (sh *SnifferHistory) load(ctx context.Context) ([]SnifferReport, error) {
+	configmap := &corev1.ConfigMap{}
+	err := sh.client.Get(ctx, client.ObjectKey{Name: sh.name, Namespace: sh.namespace}, configmap)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reports := sh.decode(configmap)
+	slices.SortFunc(reports, func(a, b SnifferReport) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	return reports, nil
+}
+
+func (sh *SnifferHistory) decode(configmap *corev1.ConfigMap) []SnifferReport {
+	reports := make([]SnifferReport, 0, len(configmap.Data))
+	for key, value := range configmap.Data {
+		var report SnifferReport
+		if err := json.Unmarshal([]byte(value), &report); err != nil {
+			sh.log.Error(err, "dropping unreadable sniffer report", "id", key)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// storeAnalysis keeps the analysis result for the inspect dashboard and
+// records it in the sniffer history. The ID of the result is returned.
+func (hh *HostHandler) storeAnalysis(result *sniffer.AnalysisResult) string {
+	id := hh.analysisCache.Store(result)
+
+	if history := hh.snifferHistory; history != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := history.Record(ctx, id, result); err != nil {
+				hh.log.Error(err, "failed to record sniffer report", "id", id)
+			}
+		}()
+	}
+
+	return id
+}
+
+// lookupAnalysis finds an analysis result in memory or, failing that, in the
+// sniffer history.
+func (hh *HostHandler) lookupAnalysis(r *http.Request, id string) (*sniffer.AnalysisResult, bool) {
+	if result, ok := hh.analysisCache.Get(id); ok {
+		return result, true
+	}
+	if hh.snifferHistory == nil {
+		return nil, false
+	}
+
+	report, ok, err := hh.snifferHistory.Get(r.Context(), id)
+	if err != nil {
+		hh.log.Error(err, "failed to read sniffer history", "id", id)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	return report.AnalysisResult(), true
+}
+
+// HistoryHandler lists the persisted sniffer reports. The function, lint,
+// method, path and since query parameters filter the reports and limit bounds
+// their number.
+func (hh *HostHandler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if hh.snifferHistory == nil {
+		http.Error(w, "Sniffer history is disabled.", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := SnifferReportFilter{
+		Function: query.Get("function"),
+		Lint:     query.Get("lint"),
+		Method:   query.Get("method"),
+		Path:     query.Get("path"),
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since %q, must be RFC 3339", since), http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	reports, err := hh.snifferHistory.List(r.Context(), filter)
+	if err != nil {
+		hh.log.Error(err, "failed to list sniffer history")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+
+	type entry struct {
+		Function  string    `json:"function,omitempty"`
+		ID        string    `json:"id"`
+		Inspect   string    `json:"inspect"`
+		Lints     []string  `json:"lints,omitempty"`
+		Method    string    `json:"method"`
+		Path      string    `json:"path"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+
+	entries := make([]entry, 0, len(reports))
+	for _, report := range reports {
+		e := entry{
+			ID:        report.ID,
+			Inspect:   fmt.Sprintf("/-/sniffer/inspect/%s?format=%s", report.ID, inspectFormat(r)),
+			Lints:     report.Lints,
+			Method:    report.Method,
+			Path:      report.Path,
+			Timestamp: report.Timestamp,
+		}
+		if report.Function != nil {
+			e.Function = report.Function.Name
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(map[string]any{"reports": entries}); err != nil {
+		hh.log.Error(err, "failed to encode sniffer history")
+	}
+}
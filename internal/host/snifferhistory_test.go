@@ -0,0 +1,117 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/sniffer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func analysisResult(method string, path string, function string, lints ...string) *sniffer.AnalysisResult {
+	return &sniffer.AnalysisResult{
+		Function: &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: function, Namespace: "foo"},
+		},
+		Lints:           lints,
+		OriginalRequest: httptest.NewRequest(method, path, nil),
+	}
+}
+
+func TestSnifferHistory(t *testing.T) {
+	ctx := context.Background()
+	history := NewSnifferHistory(fake.NewClientBuilder().Build(), "host", "foo", 3, logr.Discard())
+
+	reports, err := history.List(ctx, SnifferReportFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, reports)
+
+	require.NoError(t, history.Record(ctx, "1", analysisResult("GET", "/v1/users", "users")))
+	require.NoError(t, history.Record(ctx, "2", analysisResult("POST", "/v1/users", "users", "Request body is empty")))
+	require.NoError(t, history.Record(ctx, "3", analysisResult("GET", "/v1/orders/1", "orders")))
+	require.NoError(t, history.Record(ctx, "4", analysisResult("DELETE", "/v1/orders/1", "orders")))
+
+	reports, err = history.List(ctx, SnifferReportFilter{})
+	require.NoError(t, err)
+	ids := []string{}
+	for _, report := range reports {
+		ids = append(ids, report.ID)
+	}
+	assert.Equal(t, []string{"4", "3", "2"}, ids, "oldest report is dropped")
+
+	_, ok, err := history.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	report, ok, err := history.Get(ctx, "2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "users", report.Function.Name)
+	assert.Equal(t, "POST", report.AnalysisResult().OriginalRequest.Method)
+	assert.Equal(t, "/v1/users", report.AnalysisResult().OriginalRequest.URL.Path)
+
+	tests := []struct {
+		name   string
+		filter SnifferReportFilter
+		want   int
+	}{
+		{name: "function", filter: SnifferReportFilter{Function: "orders"}, want: 2},
+		{name: "lint", filter: SnifferReportFilter{Lint: "empty"}, want: 1},
+		{name: "method", filter: SnifferReportFilter{Method: "get"}, want: 1},
+		{name: "path", filter: SnifferReportFilter{Path: "/v1/orders"}, want: 2},
+		{name: "since", filter: SnifferReportFilter{Since: time.Now().Add(time.Hour)}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, err := history.List(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Len(t, reports, tt.want)
+		})
+	}
+}
+
+func TestHostHandler_HistoryHandler(t *testing.T) {
+	hh := &HostHandler{
+		analysisCache:  &AnalysisCache{},
+		log:            logr.Discard(),
+		snifferHistory: NewSnifferHistory(fake.NewClientBuilder().Build(), "host", "foo", 10, logr.Discard()),
+	}
+	for i := range 3 {
+		require.NoError(t, hh.snifferHistory.Record(
+			context.Background(), fmt.Sprint(i), analysisResult("GET", fmt.Sprintf("/v1/users/%d", i), "users"),
+		))
+	}
+
+	w := httptest.NewRecorder()
+	hh.HistoryHandler(w, httptest.NewRequest("GET", "/-/sniffer/history?limit=2&path=/v1/users", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Reports []struct {
+			ID      string `json:"id"`
+			Inspect string `json:"inspect"`
+		} `json:"reports"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Len(t, got.Reports, 2)
+	assert.Equal(t, "2", got.Reports[0].ID)
+	assert.Contains(t, got.Reports[0].Inspect, "/-/sniffer/inspect/2")
+
+	w = httptest.NewRecorder()
+	hh.HistoryHandler(w, httptest.NewRequest("GET", "/-/sniffer/history?since=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	result, ok := hh.lookupAnalysis(httptest.NewRequest("GET", "/-/sniffer/inspect/1", nil), "1")
+	require.True(t, ok, "results survive the in-memory cache")
+	assert.Equal(t, "/v1/users/1", result.OriginalRequest.URL.Path)
+}
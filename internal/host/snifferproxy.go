@@ -0,0 +1,90 @@
+package host
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/kdex-tech/host-manager/internal/sniffer"
+)
+
+const maxUpstreamObservedSize = 1 << 20
+
+// proxyToUpstream forwards an unmatched request to the sniffer upstream. The
+// exchange is analyzed before the upstream response is relayed so that the
+// response can point at the analysis.
+func (hh *HostHandler) proxyToUpstream(w http.ResponseWriter, r *http.Request, body []byte) {
+	upstream := hh.SnifferUpstream
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+
+			// Leave compression to the transport so that the observed body is
+			// decoded.
+			pr.Out.Header.Del("Accept-Encoding")
+
+			// Sniffer signals are meant for the host, not the upstream.
+			for k := range pr.Out.Header {
+				if strings.HasPrefix(strings.ToLower(k), "x-kdex-") {
+					pr.Out.Header.Del(k)
+				}
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusSwitchingProtocols ||
+				strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				return nil
+			}
+
+			observed := &sniffer.UpstreamResponse{
+				Header:     resp.Header.Clone(),
+				StatusCode: resp.StatusCode,
+			}
+
+			peek, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamObservedSize+1))
+			if err != nil {
+				return err
+			}
+			if len(peek) > maxUpstreamObservedSize {
+				observed.Truncated = true
+			} else {
+				observed.Body = peek
+			}
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+
+			sniffed := r.Clone(sniffer.WithUpstreamResponse(r.Context(), observed))
+			sniffed.Body = io.NopCloser(bytes.NewReader(body))
+
+			result, err := hh.sniffer.Analyze(sniffed)
+			if err != nil {
+				// The client still gets the upstream response
+				hh.log.Error(err, "failed to analyze upstream exchange", "path", r.URL.Path)
+				return nil
+			}
+			if result == nil || result.Function == nil {
+				return nil
+			}
+
+			id := hh.storeAnalysis(result)
+			resp.Header.Set("X-KDex-Sniffer-Docs", "/-/sniffer/docs")
+			resp.Header.Set("X-KDex-Sniffer-Inspect", fmt.Sprintf("/-/sniffer/inspect/%s?format=%s", id, inspectFormat(r)))
+
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			hh.log.Error(err, "failed to reach sniffer upstream", "upstream", upstream.String(), "path", r.URL.Path)
+			hh.serveError(w, r, http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+		},
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	proxy.ServeHTTP(w, r)
+}
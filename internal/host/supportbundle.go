@@ -0,0 +1,445 @@
+package host
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"time"
+
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	maxConfigChanges = 20
+	maxSupportEvents = 50
+)
+
+// SupportConfig is the effective configuration of a host in a support
+// bundle. It is built field by field, so that no secret, nor any value which
+// may hold one, e.g. the values of the environment or the credentials of the
+// federation peers, is ever copied into it.
+type SupportConfig struct {
+	A11yMode    string             `json:"a11yMode,omitempty"`
+	Auth        *SupportAuthConfig `json:"auth,omitempty"`
+	BrandName   string             `json:"brandName"`
+	Brands      []string           `json:"brands,omitempty"`
+	BudgetMode  string             `json:"budgetMode,omitempty"`
+	DefaultLang string             `json:"defaultLang"`
+	DevMode     bool               `json:"devMode"`
+	Domains     []string           `json:"domains"`
+	// Env are the names of the environment variables of the host, their
+	// values are left out.
+	Env               []string                `json:"env,omitempty"`
+	FaultInjection    bool                    `json:"faultInjection"`
+	FederationPeers   []string                `json:"federationPeers,omitempty"`
+	Functions         []SupportFunctionConfig `json:"functions,omitempty"`
+	IntegrityMode     string                  `json:"integrityMode,omitempty"`
+	LinkCheckInterval string                  `json:"linkCheckInterval,omitempty"`
+	ModulePolicy      string                  `json:"modulePolicy"`
+	Organization      string                  `json:"organization"`
+	Packages          []string                `json:"packages,omitempty"`
+	Paths             []string                `json:"paths,omitempty"`
+	Personalization   []string                `json:"personalization,omitempty"`
+	Probes            []string                `json:"probes,omitempty"`
+	Profiling         bool                    `json:"profiling"`
+	Replicas          *int32                  `json:"replicas,omitempty"`
+	Scheme            string                  `json:"scheme"`
+	ServerImage       string                  `json:"serverImage,omitempty"`
+	SLOs              []string                `json:"slos,omitempty"`
+	StaticImage       string                  `json:"staticImage,omitempty"`
+	ThemeExperiment   string                  `json:"themeExperiment,omitempty"`
+}
+
+// SupportAuthConfig is the authentication of a host in a support bundle.
+type SupportAuthConfig struct {
+	AnonymousEntitlements []string `json:"anonymousEntitlements,omitempty"`
+	CookieName            string   `json:"cookieName,omitempty"`
+	OIDCProviderURL       string   `json:"oidcProviderURL,omitempty"`
+	Scopes                []string `json:"scopes,omitempty"`
+	TokenTTL              string   `json:"tokenTTL,omitempty"`
+}
+
+// SupportFunctionConfig is a function of a host in a support bundle.
+type SupportFunctionConfig struct {
+	BasePath string `json:"basePath"`
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+}
+
+// ConfigChange is a change of the effective configuration of a host by a
+// reconcile.
+type ConfigChange struct {
+	Changes []ConfigDiff `json:"changes"`
+	Time    time.Time    `json:"time"`
+}
+
+// ConfigDiff is the change of a field of the effective configuration. From
+// is unset when the field was added, To when it was removed.
+type ConfigDiff struct {
+	From any    `json:"from,omitempty"`
+	Path string `json:"path"`
+	To   any    `json:"to,omitempty"`
+}
+
+// SupportSnapshot is the state of a host in a support bundle.
+type SupportSnapshot struct {
+	Conditions    []metav1.Condition `json:"conditions"`
+	Events        []SupportEvent     `json:"events"`
+	EventsError   string             `json:"eventsError,omitempty"`
+	Generated     time.Time          `json:"generated"`
+	Host          string             `json:"host"`
+	Namespace     string             `json:"namespace"`
+	ReconcileTime time.Time          `json:"reconcileTime"`
+}
+
+// SupportEvent is an event of a host in a support bundle.
+type SupportEvent struct {
+	Action string    `json:"action,omitempty"`
+	Note   string    `json:"note,omitempty"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+}
+
+// SupportVersions are the versions of the components of the host manager.
+type SupportVersions struct {
+	Dependencies map[string]string `json:"dependencies"`
+	Go           string            `json:"go"`
+	Module       string            `json:"module"`
+	Revision     string            `json:"revision,omitempty"`
+	Version      string            `json:"version"`
+}
+
+// supportConfigLocked builds the effective configuration of the host.
+func (hh *HostHandler) supportConfigLocked() *SupportConfig {
+	config := &SupportConfig{
+		A11yMode:       hh.a11yMode,
+		BudgetMode:     hh.budgetMode,
+		DefaultLang:    hh.defaultLanguage,
+		FaultInjection: hh.faultInjection,
+		IntegrityMode:  hh.integrityMode,
+		Profiling:      hh.profiling,
+		Scheme:         hh.scheme,
+	}
+	if hh.linkCheckInterval > 0 {
+		config.LinkCheckInterval = hh.linkCheckInterval.String()
+	}
+
+	if host := hh.host; host != nil {
+		config.BrandName = host.BrandName
+		config.DevMode = host.DevMode
+		config.Domains = slices.Clone(host.Routing.Domains)
+		config.ModulePolicy = string(host.ModulePolicy)
+		config.Organization = host.Organization
+		config.Replicas = host.Replicas
+		config.ServerImage = host.ServerImage
+		config.StaticImage = host.StaticImage
+		for _, env := range host.Env {
+			config.Env = append(config.Env, env.Name)
+		}
+		if host.Auth != nil {
+			config.Auth = &SupportAuthConfig{
+				AnonymousEntitlements: slices.Clone(host.Auth.AnonymousEntitlements),
+				CookieName:            host.Auth.JWT.CookieName,
+				TokenTTL:              host.Auth.JWT.TokenTTL,
+			}
+			if host.Auth.OIDCProvider != nil {
+				config.Auth.OIDCProviderURL = host.Auth.OIDCProvider.OIDCProviderURL
+				config.Auth.Scopes = slices.Clone(host.Auth.OIDCProvider.Scopes)
+			}
+		}
+	}
+
+	config.Brands = slices.Sorted(maps.Keys(hh.brands))
+	if hh.federation != nil {
+		for _, peer := range hh.federation.Peers {
+			config.FederationPeers = append(config.FederationPeers, peer.Name+"="+peer.URL)
+		}
+	}
+	for _, fn := range hh.functions {
+		config.Functions = append(config.Functions, SupportFunctionConfig{
+			BasePath: fn.Spec.API.BasePath,
+			Name:     fn.Name,
+			URL:      fn.Status.URL,
+		})
+	}
+	for _, ref := range hh.packageReferences {
+		config.Packages = append(config.Packages, ref.Name+"@"+ref.Version)
+	}
+	config.Paths = slices.Sorted(maps.Keys(hh.pathsCollectedInReconcile))
+	if hh.personalization != nil {
+		for _, provider := range hh.personalization.Providers {
+			config.Personalization = append(config.Personalization, provider.Name+"="+provider.Type)
+		}
+	}
+	for _, probe := range hh.probes {
+		config.Probes = append(config.Probes, probe.Owner+"/"+probe.Name)
+	}
+	if hh.slos != nil {
+		for _, slo := range hh.slos.slos.Objectives {
+			config.SLOs = append(config.SLOs, slo.Name)
+		}
+	}
+	if hh.themeExperiment != nil {
+		config.ThemeExperiment = hh.themeExperiment.Name
+	}
+
+	return config
+}
+
+// recordConfigLocked records the changes of the effective configuration of
+// the host since the previous reconcile, keeping the latest ones.
+func (hh *HostHandler) recordConfigLocked(now time.Time) {
+	config := hh.supportConfigLocked()
+	if hh.supportConfig != nil {
+		if changes := diffConfigs(hh.supportConfig, config); len(changes) > 0 {
+			hh.configChanges = append(hh.configChanges, ConfigChange{Changes: changes, Time: now})
+			if len(hh.configChanges) > maxConfigChanges {
+				hh.configChanges = slices.Delete(hh.configChanges, 0, len(hh.configChanges)-maxConfigChanges)
+			}
+		}
+	}
+	hh.supportConfig = config
+}
+
+// diffConfigs returns the fields of the JSON encodings of two configurations
+// which differ, by dotted path. Lists are compared as a whole.
+func diffConfigs(from, to *SupportConfig) []ConfigDiff {
+	flatten := func(config *SupportConfig) map[string]any {
+		fields := map[string]any{}
+		raw, _ := json.Marshal(config)
+		var doc map[string]any
+		_ = json.Unmarshal(raw, &doc)
+		var walk func(prefix string, value map[string]any)
+		walk = func(prefix string, value map[string]any) {
+			for k, v := range value {
+				if nested, ok := v.(map[string]any); ok {
+					walk(prefix+k+".", nested)
+					continue
+				}
+				fields[prefix+k] = v
+			}
+		}
+		walk("", doc)
+		return fields
+	}
+
+	before, after := flatten(from), flatten(to)
+	changes := []ConfigDiff{}
+	paths := maps.Clone(before)
+	maps.Copy(paths, after)
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		if !reflect.DeepEqual(before[path], after[path]) {
+			changes = append(changes, ConfigDiff{From: before[path], Path: path, To: after[path]})
+		}
+	}
+	return changes
+}
+
+// supportEvents returns the latest events of the host, newest first.
+func (hh *HostHandler) supportEvents(ctx context.Context) ([]SupportEvent, error) {
+	if hh.client == nil {
+		return nil, nil
+	}
+
+	var list eventsv1.EventList
+	if err := hh.client.List(ctx, &list, client.InNamespace(hh.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := []SupportEvent{}
+	for _, event := range list.Items {
+		if event.Regarding.Kind != "KDexInternalHost" || event.Regarding.Name != hh.Name {
+			continue
+		}
+		at := event.EventTime.Time
+		if event.Series != nil {
+			at = event.Series.LastObservedTime.Time
+		}
+		if at.IsZero() {
+			at = event.CreationTimestamp.Time
+		}
+		events = append(events, SupportEvent{
+			Action: event.Action,
+			Note:   event.Note,
+			Reason: event.Reason,
+			Time:   at,
+			Type:   event.Type,
+		})
+	}
+	slices.SortFunc(events, func(a, b SupportEvent) int { return b.Time.Compare(a.Time) })
+	if len(events) > maxSupportEvents {
+		events = events[:maxSupportEvents]
+	}
+	return events, nil
+}
+
+// supportVersions returns the versions of the host manager and of its
+// dependencies.
+func supportVersions() SupportVersions {
+	versions := SupportVersions{Dependencies: map[string]string{}, Go: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return versions
+	}
+	versions.Module = info.Main.Path
+	versions.Version = info.Main.Version
+	for _, dep := range info.Deps {
+		versions.Dependencies[dep.Path] = dep.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			versions.Revision = setting.Value
+		}
+	}
+	return versions
+}
+
+// SupportBundleGet serves a gzipped tar of the effective configuration of
+// the host and its latest changes, the state of the host, its conditions and
+// latest events, the versions of its components and its goroutine and heap
+// profiles, to attach to a support ticket.
+func (hh *HostHandler) SupportBundleGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	now := time.Now()
+	hh.mu.RLock()
+	config := hh.supportConfigLocked()
+	changes := slices.Clone(hh.configChanges)
+	snapshot := SupportSnapshot{
+		Generated:     now,
+		Host:          hh.Name,
+		Namespace:     hh.Namespace,
+		ReconcileTime: hh.reconcileTime,
+	}
+	if hh.conditions != nil {
+		snapshot.Conditions = slices.Clone(*hh.conditions)
+	}
+	hh.mu.RUnlock()
+
+	events, err := hh.supportEvents(r.Context())
+	if err != nil {
+		hh.log.Error(err, "failed to collect the events of the support bundle")
+		snapshot.EventsError = err.Error()
+	}
+	snapshot.Events = events
+
+	files := []struct {
+		name  string
+		value any
+	}{
+		{name: "config.json", value: config},
+		{name: "config-changes.json", value: changes},
+		{name: "snapshot.json", value: snapshot},
+		{name: "versions.json", value: supportVersions()},
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Mode: 0o644, ModTime: now, Name: name, Size: int64(len(data))}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.value, "", "  ")
+		if err == nil {
+			err = add(file.name, data)
+		}
+		if err != nil {
+			hh.log.Error(err, "failed to write the support bundle", "file", file.name)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, profile := range []struct {
+		debug int
+		file  string
+		name  string
+	}{
+		{debug: 1, file: "profiles/goroutine.txt", name: "goroutine"},
+		{debug: 0, file: "profiles/heap.pb.gz", name: "heap"},
+	} {
+		var data bytes.Buffer
+		err := pprof.Lookup(profile.name).WriteTo(&data, profile.debug)
+		if err == nil {
+			err = add(profile.file, data.Bytes())
+		}
+		if err != nil {
+			hh.log.Error(err, "failed to write the support bundle", "file", profile.file)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		hh.log.Error(err, "failed to write the support bundle")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		hh.log.Error(err, "failed to write the support bundle")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	hh.log.Info("support bundle generated", "bytes", buf.Len())
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-support-%s.tar.gz", hh.Name, now.UTC().Format("20060102T150405Z"))))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Content-Type", "application/gzip")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// SupportConfigReport is the effective configuration of a host and its
+// latest changes.
+type SupportConfigReport struct {
+	Changes []ConfigChange `json:"changes"`
+	Config  *SupportConfig `json:"config"`
+}
+
+// SupportConfigGet serves the effective configuration of the host and its
+// changes by the latest reconciles, oldest first.
+func (hh *HostHandler) SupportConfigGet(w http.ResponseWriter, r *http.Request) {
+	if shouldReturn := hh.handleAdminAuth(r, w); shouldReturn {
+		return
+	}
+
+	hh.mu.RLock()
+	report := SupportConfigReport{
+		Changes: slices.Clone(hh.configChanges),
+		Config:  hh.supportConfigLocked(),
+	}
+	hh.mu.RUnlock()
+	if report.Changes == nil {
+		report.Changes = []ConfigChange{}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		hh.log.Error(err, "failed to encode support config")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,165 @@
+package host
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	from := &SupportConfig{
+		Auth:        &SupportAuthConfig{TokenTTL: "1h"},
+		BrandName:   "Shop",
+		Domains:     []string{"shop.example.com"},
+		ServerImage: "host:v1",
+	}
+	to := &SupportConfig{
+		Auth:           &SupportAuthConfig{TokenTTL: "2h"},
+		BrandName:      "Shop",
+		Domains:        []string{"shop.example.com", "www.shop.example.com"},
+		FaultInjection: true,
+	}
+
+	assert.Equal(t, []ConfigDiff{
+		{From: "1h", Path: "auth.tokenTTL", To: "2h"},
+		{From: []any{"shop.example.com"}, Path: "domains", To: []any{"shop.example.com", "www.shop.example.com"}},
+		{From: false, Path: "faultInjection", To: true},
+		{From: "host:v1", Path: "serverImage"},
+	}, diffConfigs(from, to))
+	assert.Empty(t, diffConfigs(to, to))
+}
+
+func TestHostHandler_supportBundle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, eventsv1.AddToScheme(scheme))
+
+	now := time.Now().Truncate(time.Microsecond)
+	event := func(name string, host string, at time.Time) *eventsv1.Event {
+		return &eventsv1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Action:     "Reconcile",
+			EventTime:  metav1.NewMicroTime(at),
+			Note:       name,
+			Reason:     "Reconciled",
+			Regarding:  corev1.ObjectReference{Kind: "KDexInternalHost", Name: host, Namespace: "default"},
+			Type:       corev1.EventTypeNormal,
+		}
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			event("older", "support-test", now.Add(-time.Hour)),
+			event("newer", "support-test", now),
+			event("other", "other-host", now),
+		).
+		Build()
+
+	hh := &HostHandler{Name: "support-test", Namespace: "default", client: c, log: logr.Discard()}
+	hh.conditions = &[]metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Reconciled"}}
+	hh.host = &kdexv1alpha1.KDexHostSpec{
+		Auth: &kdexv1alpha1.Auth{
+			JWT: kdexv1alpha1.JWT{TokenTTL: "1h"},
+		},
+		BrandName: "Shop",
+	}
+	hh.host.Env = []corev1.EnvVar{{Name: "API_TOKEN", Value: "s3cr3t-env"}}
+	hh.federation = &Federation{Peers: []FederationPeer{{ClientID: "m2m", ClientSecret: "s3cr3t-peer", Name: "blog", URL: "https://blog.example.com"}}}
+	hh.recordConfigLocked(now)
+	hh.host.BrandName = "Shop & Co"
+	hh.faultInjection = true
+	hh.recordConfigLocked(now)
+	hh.recordConfigLocked(now)
+
+	mux := http.NewServeMux()
+	hh.supportHandler(mux, map[string]ko.PathInfo{})
+
+	serve := func(target string, entitlements ...any) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if len(entitlements) > 0 {
+			r = r.WithContext(auth.SetAuthContext(r.Context(), auth.AuthContext{"entitlements": entitlements}))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/config").Code, "authentication disabled")
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/support-bundle").Code, "authentication disabled")
+
+	hh.authChecker = auth.NewAuthorizationChecker(nil, logr.Discard())
+	hh.authConfig = &auth.Config{ActivePair: &keys.KeyPair{}}
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/config").Code, "anonymous")
+	assert.Equal(t, http.StatusNotFound, serve("/-/admin/support-bundle", "hosts:other:read", "hosts:other:write").Code, "entitled to another host")
+
+	w := serve("/-/admin/config", "hosts:support-test:read", "hosts:support-test:write")
+	require.Equal(t, http.StatusOK, w.Code)
+	report := SupportConfigReport{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	require.Len(t, report.Changes, 1, "only changes are recorded")
+	assert.Equal(t, []ConfigDiff{
+		{From: "Shop", Path: "brandName", To: "Shop & Co"},
+		{From: false, Path: "faultInjection", To: true},
+	}, report.Changes[0].Changes)
+	assert.Equal(t, []string{"API_TOKEN"}, report.Config.Env)
+	assert.Equal(t, []string{"blog=https://blog.example.com"}, report.Config.FederationPeers)
+
+	w = serve("/-/admin/support-bundle", "hosts:support-test:read", "hosts:support-test:write")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "support-test-support-")
+
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		files[header.Name], err = io.ReadAll(tr)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, files, 6)
+	for name, data := range files {
+		assert.NotEmpty(t, data, name)
+		assert.NotContains(t, string(data), "s3cr3t", name)
+	}
+
+	snapshot := SupportSnapshot{}
+	require.NoError(t, json.Unmarshal(files["snapshot.json"], &snapshot))
+	assert.Equal(t, "support-test", snapshot.Host)
+	require.Len(t, snapshot.Conditions, 1)
+	require.Len(t, snapshot.Events, 2, "only the events of the host")
+	assert.Equal(t, "newer", snapshot.Events[0].Note)
+	assert.Equal(t, "older", snapshot.Events[1].Note)
+
+	changes := []ConfigChange{}
+	require.NoError(t, json.Unmarshal(files["config-changes.json"], &changes))
+	assert.Len(t, changes, 1)
+
+	versions := SupportVersions{}
+	require.NoError(t, json.Unmarshal(files["versions.json"], &versions))
+	assert.NotEmpty(t, versions.Go)
+	assert.Contains(t, string(files["profiles/goroutine.txt"]), "goroutine profile")
+}
@@ -0,0 +1,128 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+const (
+	// timeoutHintExtension is the OpenAPI operation extension used by
+	// functions to bound how long a request may take. The value is a duration
+	// string (e.g. "10s"). "0s" removes the deadline, e.g. for streaming
+	// operations.
+	timeoutHintExtension = "x-kdex-timeout"
+
+	requestTimeoutAnnotation = "kdex.dev/request-timeout"
+
+	// deadlineHeader carries the remaining request budget in milliseconds so
+	// that backends can stop working once the host has given up.
+	deadlineHeader = "X-Kdex-Deadline-Ms"
+
+	defaultRequestTimeout = 30 * time.Second
+	maxRequestTimeout     = 5 * time.Minute
+)
+
+type problem struct {
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Status   int    `json:"status"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+}
+
+// timeoutFor reads the timeout hint of the operation. The boolean reports
+// whether the operation has a hint at all.
+func timeoutFor(op *openapi.Operation) (time.Duration, bool, error) {
+	if op == nil || op.Extensions == nil {
+		return 0, false, nil
+	}
+
+	hint, ok := op.Extensions[timeoutHintExtension]
+	if !ok || hint == nil {
+		return 0, false, nil
+	}
+
+	raw, err := json.Marshal(hint)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s extension: %w", timeoutHintExtension, err)
+	}
+
+	var spec string
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return 0, false, fmt.Errorf("invalid %s extension: %w", timeoutHintExtension, err)
+	}
+
+	timeout, err := time.ParseDuration(spec)
+	if err != nil || timeout < 0 {
+		return 0, false, fmt.Errorf("invalid %s duration %q", timeoutHintExtension, spec)
+	}
+
+	return timeout, true, nil
+}
+
+// requestTimeout returns how long the request may take. The operation hint
+// wins over the function annotation which wins over the default, and a
+// deadline received from an upstream hop is never extended. Zero means the
+// request has no deadline.
+func (hh *HostHandler) requestTimeout(r *http.Request, fn *kdexv1alpha1.KDexFunction, op *openapi.Operation) time.Duration {
+	timeout := defaultRequestTimeout
+
+	if v, ok := fn.GetAnnotations()[requestTimeoutAnnotation]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			hh.log.Info("ignoring invalid annotation", "function", fn.Name, "annotation", requestTimeoutAnnotation, "value", v)
+		} else {
+			timeout = d
+		}
+	}
+
+	hint, ok, err := timeoutFor(op)
+	if err != nil {
+		hh.log.Error(err, "ignoring invalid timeout hint", "function", fn.Name, "path", r.URL.Path)
+	} else if ok {
+		timeout = hint
+	}
+
+	timeout = min(timeout, maxRequestTimeout)
+
+	if v := r.Header.Get(deadlineHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && ms > 0 {
+			inbound := time.Duration(ms) * time.Millisecond
+			if timeout == 0 || inbound < timeout {
+				timeout = inbound
+			}
+		}
+	}
+
+	return timeout
+}
+
+// writeDeadlineHeader tells the backend how much of the request budget is
+// left.
+func writeDeadlineHeader(in *http.Request, out http.Header) {
+	out.Del(deadlineHeader)
+	if deadline, ok := in.Context().Deadline(); ok {
+		out.Set(deadlineHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10))
+	}
+}
+
+// serveProblem writes an RFC 9457 problem details response.
+func serveProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Status:   status,
+		Title:    http.StatusText(status),
+		Type:     "about:blank",
+	})
+}
@@ -0,0 +1,131 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_requestTimeout(t *testing.T) {
+	hh := &HostHandler{log: logr.Discard()}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		extension   any
+		inbound     string
+		want        time.Duration
+	}{
+		{
+			name: "default",
+			want: defaultRequestTimeout,
+		},
+		{
+			name:        "annotation",
+			annotations: map[string]string{requestTimeoutAnnotation: "10s"},
+			want:        10 * time.Second,
+		},
+		{
+			name:        "hint wins over annotation",
+			annotations: map[string]string{requestTimeoutAnnotation: "10s"},
+			extension:   "2s",
+			want:        2 * time.Second,
+		},
+		{
+			name:      "hint disables the deadline",
+			extension: "0s",
+			want:      0,
+		},
+		{
+			name:      "capped",
+			extension: "1h",
+			want:      maxRequestTimeout,
+		},
+		{
+			name:        "invalid values are ignored",
+			annotations: map[string]string{requestTimeoutAnnotation: "soon"},
+			extension:   "later",
+			want:        defaultRequestTimeout,
+		},
+		{
+			name:    "inbound deadline is not extended",
+			inbound: "1500",
+			want:    1500 * time.Millisecond,
+		},
+		{
+			name:      "inbound deadline applies without a local deadline",
+			extension: "0s",
+			inbound:   "1500",
+			want:      1500 * time.Millisecond,
+		},
+		{
+			name:    "longer inbound deadline is ignored",
+			inbound: "600000",
+			want:    defaultRequestTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := &kdexv1alpha1.KDexFunction{
+				ObjectMeta: metav1.ObjectMeta{Name: "users", Annotations: tt.annotations},
+			}
+			op := &openapi.Operation{}
+			if tt.extension != nil {
+				op.Extensions = map[string]any{timeoutHintExtension: tt.extension}
+			}
+			req := httptest.NewRequest("GET", "/v1/users", nil)
+			if tt.inbound != "" {
+				req.Header.Set(deadlineHeader, tt.inbound)
+			}
+
+			assert.Equal(t, tt.want, hh.requestTimeout(req, fn, op))
+		})
+	}
+}
+
+func TestWriteDeadlineHeader(t *testing.T) {
+	out := http.Header{}
+	out.Set(deadlineHeader, "999999")
+
+	req := httptest.NewRequest("GET", "/v1/users", nil)
+	writeDeadlineHeader(req, out)
+	assert.Empty(t, out.Get(deadlineHeader))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	writeDeadlineHeader(req.WithContext(ctx), out)
+
+	remaining, err := strconv.ParseInt(out.Get(deadlineHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Greater(t, remaining, int64(0))
+	assert.LessOrEqual(t, remaining, int64(2000))
+}
+
+func TestServeProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveProblem(w, httptest.NewRequest("GET", "/v1/users", nil), http.StatusGatewayTimeout, "too slow")
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var got problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, problem{
+		Detail:   "too slow",
+		Instance: "/v1/users",
+		Status:   http.StatusGatewayTimeout,
+		Title:    "Gateway Timeout",
+		Type:     "about:blank",
+	}, got)
+}
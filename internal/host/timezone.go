@@ -0,0 +1,113 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// TimeZoneCookie holds the IANA time zone negotiated with the visitor
+	// through the time zone endpoint.
+	TimeZoneCookie = "kdex_tz"
+	// TimeZoneHeader carries the IANA time zone of the visitor on a request.
+	// It takes precedence over TimeZoneCookie.
+	TimeZoneHeader = "Time-Zone"
+
+	timeZoneCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// Sources of the time zone reported by the time zone endpoint.
+const (
+	TimeZoneSourceCookie  = "cookie"
+	TimeZoneSourceDefault = "default"
+	TimeZoneSourceHeader  = "header"
+)
+
+// TimeZone is the time zone negotiated with the visitor.
+type TimeZone struct {
+	Source   string `json:"source"`
+	TimeZone string `json:"timeZone"`
+}
+
+// loadTimeZone returns the location of the IANA time zone. The local time
+// zone of the server is not one of them.
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// visitorTimeZone returns the time zone of the visitor from TimeZoneHeader
+// or TimeZoneCookie, or nil when the visitor has none. Invalid time zones
+// are ignored.
+func visitorTimeZone(r *http.Request) (*time.Location, string) {
+	if loc, err := loadTimeZone(r.Header.Get(TimeZoneHeader)); err == nil {
+		return loc, TimeZoneSourceHeader
+	}
+	if cookie, err := r.Cookie(TimeZoneCookie); err == nil {
+		if loc, err := loadTimeZone(cookie.Value); err == nil {
+			return loc, TimeZoneSourceCookie
+		}
+	}
+	return nil, TimeZoneSourceDefault
+}
+
+// TimeZoneGet reports the time zone pages are rendered in for the visitor.
+func (hh *HostHandler) TimeZoneGet(w http.ResponseWriter, r *http.Request) {
+	loc, source := visitorTimeZone(r)
+	if loc == nil {
+		loc = time.UTC
+	}
+	hh.writeTimeZone(w, TimeZone{Source: source, TimeZone: loc.String()})
+}
+
+// TimeZonePost stores the time zone of the visitor, usually the one of its
+// browser, in TimeZoneCookie. An empty time zone removes it.
+func (hh *HostHandler) TimeZonePost(w http.ResponseWriter, r *http.Request) {
+	body := TimeZone{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid time zone request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     TimeZoneCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   hh.isSecure(),
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if body.TimeZone == "" {
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		hh.writeTimeZone(w, TimeZone{Source: TimeZoneSourceDefault, TimeZone: time.UTC.String()})
+		return
+	}
+
+	loc, err := loadTimeZone(body.TimeZone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cookie.MaxAge = timeZoneCookieMaxAge
+	cookie.Value = loc.String()
+	http.SetCookie(w, cookie)
+	hh.writeTimeZone(w, TimeZone{Source: TimeZoneSourceCookie, TimeZone: loc.String()})
+}
+
+func (hh *HostHandler) writeTimeZone(w http.ResponseWriter, tz TimeZone) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tz); err != nil {
+		hh.log.Error(err, "failed to encode time zone")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
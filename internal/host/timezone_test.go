@@ -0,0 +1,74 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_visitorTimeZone(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	loc, source := visitorTimeZone(r)
+	assert.Nil(t, loc)
+	assert.Equal(t, TimeZoneSourceDefault, source)
+
+	r.AddCookie(&http.Cookie{Name: TimeZoneCookie, Value: "Europe/Paris"})
+	loc, source = visitorTimeZone(r)
+	require.NotNil(t, loc)
+	assert.Equal(t, "Europe/Paris", loc.String())
+	assert.Equal(t, TimeZoneSourceCookie, source)
+
+	r.Header.Set(TimeZoneHeader, "America/Toronto")
+	loc, source = visitorTimeZone(r)
+	require.NotNil(t, loc)
+	assert.Equal(t, "America/Toronto", loc.String())
+	assert.Equal(t, TimeZoneSourceHeader, source)
+
+	r.Header.Set(TimeZoneHeader, "Local")
+	loc, _ = visitorTimeZone(r)
+	assert.Equal(t, "Europe/Paris", loc.String())
+}
+
+func TestTimeZonePost(t *testing.T) {
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		hh.TimeZonePost(rec, httptest.NewRequest(http.MethodPost, "/-/timezone", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"timeZone":"Asia/Tokyo"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, TimeZoneCookie, cookies[0].Name)
+	assert.Equal(t, "Asia/Tokyo", cookies[0].Value)
+	assert.Equal(t, timeZoneCookieMaxAge, cookies[0].MaxAge)
+
+	tz := TimeZone{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tz))
+	assert.Equal(t, TimeZone{Source: TimeZoneSourceCookie, TimeZone: "Asia/Tokyo"}, tz)
+
+	rec = post(`{"timeZone":""}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, rec.Result().Cookies(), 1)
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"timeZone":"Mars/Olympus"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"timeZone":"Local"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`Asia/Tokyo`).Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/-/timezone", nil)
+	req.AddCookie(&http.Cookie{Name: TimeZoneCookie, Value: "Asia/Tokyo"})
+	hh.TimeZoneGet(rec, req)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tz))
+	assert.Equal(t, TimeZone{Source: TimeZoneSourceCookie, TimeZone: "Asia/Tokyo"}, tz)
+}
@@ -0,0 +1,45 @@
+package host
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// nameSpan names the server span of the request after the pattern of the mux
+// it is routed to, e.g. "GET /{l10n}/shop", so that the spans of each page and
+// system path are grouped whatever the values of its parameters.
+func (hh *HostHandler) nameSpan(mux *http.ServeMux, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() {
+		return
+	}
+
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return
+	}
+
+	name, route := SpanName(r.Method, pattern)
+	span.SetName(name)
+	span.SetAttributes(
+		semconv.HTTPRoute(route),
+		attribute.String("kdex.host", hh.Name),
+	)
+}
+
+// SpanName returns the name of the server span of a request of the method
+// routed to the pattern, and the route of the pattern, its path.
+func SpanName(method string, pattern string) (string, string) {
+	if pattern == "" {
+		return method, ""
+	}
+	patternMethod, route, found := strings.Cut(pattern, " ")
+	if !found {
+		patternMethod, route = method, pattern
+	}
+	return patternMethod + " " + route, route
+}
@@ -0,0 +1,63 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestHostHandler_NameSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cacheManager, _ := cache.NewCacheManager("", "portal", nil)
+	hh := NewHostHandler(nil, "portal", "kdex", logr.Discard(), cacheManager)
+	hh.SetHost(context.Background(), &kdexv1alpha1.KDexHostSpec{
+		DefaultLang: "en",
+		BrandName:   "Portal",
+	}, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "http")
+
+	handler := otelhttp.NewHandler(hh, "kdex-web",
+		otelhttp.WithTracerProvider(provider),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			name, _ := SpanName(r.Method, r.Pattern)
+			return name
+		}),
+	)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/-/openapi?type=system", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /-/openapi", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("http.route", "/-/openapi"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("kdex.host", "portal"))
+}
+
+func TestSpanName(t *testing.T) {
+	name, route := SpanName("GET", "")
+	assert.Equal(t, "GET", name)
+	assert.Empty(t, route)
+
+	name, route = SpanName("POST", "POST /-/token")
+	assert.Equal(t, "POST /-/token", name)
+	assert.Equal(t, "/-/token", route)
+
+	name, route = SpanName("PUT", "/v1/invoices/")
+	assert.Equal(t, "PUT /v1/invoices/", name)
+	assert.Equal(t, "/v1/invoices/", route)
+}
@@ -3,7 +3,9 @@ package host
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 
 	kdexhttp "github.com/kdex-tech/host-manager/internal/http"
@@ -20,23 +22,119 @@ func NewTranslations(defaultLanguage string, translations map[string]kdexv1alpha
 	}
 
 	keys := []string{}
+	translated := map[string]map[string]bool{}
 	for name, translation := range translations {
 		for _, tr := range translation.Translations {
+			tag := language.Make(tr.Lang).String()
+			if translated[tag] == nil {
+				translated[tag] = map[string]bool{}
+			}
 			for key, value := range tr.KeysAndValues {
 				if err := catalogBuilder.SetString(language.Make(tr.Lang), key, value); err != nil {
 					return nil, fmt.Errorf("failed to set translation %s %s %s %s", name, tr.Lang, key, value)
 				}
 				keys = append(keys, key)
+				translated[tag][key] = true
 			}
 		}
 	}
 
 	return &Translations{
-		catalog: catalogBuilder,
-		keys:    keys,
+		catalog:         catalogBuilder,
+		defaultLanguage: language.Make(defaultLanguage).String(),
+		keys:            keys,
+		translated:      translated,
 	}, nil
 }
 
+// TranslationReport is the completeness of the translations of a host
+// relative to its default language.
+type TranslationReport struct {
+	DefaultLanguage string             `json:"defaultLanguage"`
+	Keys            int                `json:"keys"`
+	Languages       []LanguageCoverage `json:"languages"`
+}
+
+// LanguageCoverage is the completeness of the translations of one language.
+type LanguageCoverage struct {
+	Coverage    float64  `json:"coverage"`
+	Lang        string   `json:"lang"`
+	Missing     int      `json:"missing"`
+	MissingKeys []string `json:"missingKeys,omitempty"`
+	Translated  int      `json:"translated"`
+	// Violations are the values breaking the glossary or the translation
+	// memory.
+	Violations []TranslationViolation `json:"violations,omitempty"`
+}
+
+// Missing returns the sorted keys translated in the default language but not
+// in lang.
+func (t *Translations) Missing(lang language.Tag) []string {
+	missing := []string{}
+	translated := t.translated[lang.String()]
+	for key := range t.translated[t.defaultLanguage] {
+		if !translated[key] {
+			missing = append(missing, key)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// Report returns the completeness of every language, including the default
+// one, ordered by language tag.
+func (t *Translations) Report() TranslationReport {
+	report := TranslationReport{
+		DefaultLanguage: t.defaultLanguage,
+		Keys:            len(t.translated[t.defaultLanguage]),
+		Languages:       []LanguageCoverage{},
+	}
+
+	langs := slices.Collect(maps.Keys(t.translated))
+	if !slices.Contains(langs, t.defaultLanguage) {
+		langs = append(langs, t.defaultLanguage)
+	}
+	slices.Sort(langs)
+
+	for _, lang := range langs {
+		missing := t.Missing(language.Make(lang))
+		coverage := LanguageCoverage{
+			Coverage:    1,
+			Lang:        lang,
+			Missing:     len(missing),
+			MissingKeys: missing,
+			Translated:  report.Keys - len(missing),
+		}
+		if report.Keys > 0 {
+			coverage.Coverage = float64(coverage.Translated) / float64(report.Keys)
+		}
+		for _, violation := range t.violations {
+			if violation.Lang == lang {
+				coverage.Violations = append(coverage.Violations, violation)
+			}
+		}
+		report.Languages = append(report.Languages, coverage)
+	}
+
+	return report
+}
+
+// TranslationReportGet returns the completeness report of the translations.
+func (hh *HostHandler) TranslationReportGet(w http.ResponseWriter, r *http.Request) {
+	if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
+		return
+	}
+
+	hh.mu.RLock()
+	report := hh.Translations.Report()
+	hh.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (hh *HostHandler) TranslationGet(w http.ResponseWriter, r *http.Request) {
 	if hh.applyCachingHeaders(w, r, nil, hh.reconcileTime) {
 		return
@@ -50,6 +148,7 @@ func (hh *HostHandler) TranslationGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	observeLang(r.Context(), l)
 
 	// Get all the keys and values for the given language
 	keys := hh.Translations.Keys()
@@ -59,6 +158,13 @@ func (hh *HostHandler) TranslationGet(w http.ResponseWriter, r *http.Request) {
 	if len(keyParams) > 0 {
 		keys = keyParams
 	}
+	if queryParams.Get("missing") == "true" {
+		missing := hh.Translations.Missing(l)
+		if len(keyParams) > 0 {
+			missing = slices.DeleteFunc(missing, func(key string) bool { return !slices.Contains(keyParams, key) })
+		}
+		keys = missing
+	}
 
 	keysAndValues := map[string]string{}
 	printer := hh.messagePrinter(&hh.Translations, l)
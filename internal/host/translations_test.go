@@ -0,0 +1,99 @@
+package host
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestTranslations_Report(t *testing.T) {
+	translations, err := NewTranslations("en", map[string]kdexv1alpha1.KDexTranslationSpec{
+		"messages": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"greeting": "Hello", "farewell": "Bye", "title": "Home"}},
+				{Lang: "fr", KeysAndValues: map[string]string{"greeting": "Bonjour"}},
+				{Lang: "de", KeysAndValues: map[string]string{"greeting": "Hallo", "farewell": "Tschüss", "title": "Start"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"farewell", "title"}, translations.Missing(language.French))
+	assert.Empty(t, translations.Missing(language.German))
+
+	report := translations.Report()
+	assert.Equal(t, "en", report.DefaultLanguage)
+	assert.Equal(t, 3, report.Keys)
+	assert.Equal(t, []LanguageCoverage{
+		{Coverage: 1, Lang: "de", Missing: 0, MissingKeys: []string{}, Translated: 3},
+		{Coverage: 1, Lang: "en", Missing: 0, MissingKeys: []string{}, Translated: 3},
+		{Coverage: 1.0 / 3, Lang: "fr", Missing: 2, MissingKeys: []string{"farewell", "title"}, Translated: 1},
+	}, report.Languages)
+}
+
+func TestHostHandler_TranslationGetMissing(t *testing.T) {
+	translations, err := NewTranslations("en", map[string]kdexv1alpha1.KDexTranslationSpec{
+		"messages": {
+			Translations: []kdexv1alpha1.Translation{
+				{Lang: "en", KeysAndValues: map[string]string{"greeting": "Hello", "farewell": "Bye"}},
+				{Lang: "fr", KeysAndValues: map[string]string{"greeting": "Bonjour"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	hh := &HostHandler{
+		Translations:    *translations,
+		authConfig:      &auth.Config{},
+		defaultLanguage: "en",
+		log:             logr.Discard(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /-/translation/{l10n}", hh.TranslationGet)
+	mux.HandleFunc("GET /-/translation-report", hh.TranslationReportGet)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{name: "all keys", target: "/-/translation/fr", want: []string{"farewell", "greeting"}},
+		{name: "missing keys", target: "/-/translation/fr?missing=true", want: []string{"farewell"}},
+		{name: "missing filtered keys", target: "/-/translation/fr?missing=true&key=greeting", want: []string{}},
+		{name: "complete language", target: "/-/translation/en?missing=true", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			got := map[string]string{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.ElementsMatch(t, tt.want, slices.Collect(maps.Keys(got)))
+		})
+	}
+
+	t.Run("report", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/translation-report", nil))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var report TranslationReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		require.Len(t, report.Languages, 2)
+		assert.Equal(t, "fr", report.Languages[1].Lang)
+		assert.Equal(t, []string{"farewell"}, report.Languages[1].MissingKeys)
+	})
+}
@@ -3,13 +3,17 @@ package host
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/breaker"
 	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/kdex-tech/host-manager/internal/graphql"
 	"github.com/kdex-tech/host-manager/internal/host/ico"
+	"github.com/kdex-tech/host-manager/internal/mime"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	"github.com/kdex-tech/host-manager/internal/page"
 	"github.com/kdex-tech/host-manager/internal/sniffer"
@@ -26,53 +30,110 @@ const (
 	data-navigation-endpoint="/-/navigation/{name}/{l10n}/{basePathMinusLeadingSlash...}"
 	data-openapi-endpoint="/-/openapi"
 	data-page-basepath="%s"
+	data-path-capabilities="/-/capabilities"
 	data-path-check="/-/check"
+	data-path-format="/-/format/{l10n}"
 	data-path-login="/-/login"
 	data-path-logout="/-/logout"
 	data-path-patternpath="%s"
 	data-path-state="/-/state"
+	data-path-timezone="/-/timezone"
 	data-path-separator="/-/"
 	data-path-translations="/-/translations/{l10n}"
+	data-path-version="/-/version"
 	/>
 	`
 )
 
 type HostHandler struct {
-	Mux          *http.ServeMux
-	Name         string
-	Namespace    string
-	Pages        *page.PageStore
-	Translations Translations
-
+	GraphQL                       bool
+	MiddlewarePluginDir           string
+	MockFunctions                 bool
+	Mux                           *http.ServeMux
+	Name                          string
+	Namespace                     string
+	Pages                         *page.PageStore
+	SnifferHistorySize            int
+	SnifferSchemaConflictStrategy sniffer.SchemaConflictStrategy
+	SnifferUpstream               *url.URL
+	SnifferWriteWindow            time.Duration
+	Translations                  Translations
+
+	a11yAudits    sync.Map
+	a11yMode      string
+	acmeSolvers   []ACMESolver
 	analysisCache *AnalysisCache
+	archive       *Archive
+	archiveMu     sync.Mutex
+	archived      sync.Map
 	authChecker   interface {
 		CalculateRequirements(string, string, []kdexv1alpha1.SecurityRequirement) ([]kdexv1alpha1.SecurityRequirement, error)
 		CheckAccess(context.Context, string, string, []kdexv1alpha1.SecurityRequirement) (bool, error)
 	}
 	authConfig                *auth.Config
+	authzRoutes               *http.ServeMux
 	authExchanger             *auth.Exchanger
+	brands                    map[string]*Brand
+	breakers                  *breaker.Registry
+	budgetMode                string
 	cacheManager              cache.CacheManager
+	canaries                  sync.Map
+	changePassword            string
 	client                    client.Client
 	conditions                *[]metav1.Condition
+	configChanges             []ConfigChange
+	contractRouters           sync.Map
 	defaultLanguage           string
 	favicon                   *ico.Ico
+	faultInjection            bool
+	faults                    sync.Map
+	federatedPeers            map[string]*federatedPeer
+	federation                *Federation
+	federationCancel          context.CancelFunc
 	functions                 []kdexv1alpha1.KDexFunction
+	glossaries                map[string]kdexv1alpha1.KDexTranslationSpec
+	graphqlSchema             *graphql.Schema
 	host                      *kdexv1alpha1.KDexHostSpec
 	importmap                 string
+	integrityManifests        []IntegrityManifest
+	integrityMode             string
+	linkCheckCancel           context.CancelFunc
+	linkCheckInterval         time.Duration
+	linkReport                *LinkReport
 	log                       logr.Logger
+	machineTranslations       map[string]bool
+	mediaTypes                *mime.Registry
+	middlewares               func(http.Handler) http.Handler
 	mu                        sync.RWMutex
 	openapiBuilder            ko.Builder
 	packageReferences         []kdexv1alpha1.PackageReference
 	pathsCollectedInReconcile map[string]ko.PathInfo
+	personalization           *Personalization
+	probeCancel               context.CancelFunc
+	probeMu                   sync.Mutex
+	probeResults              map[string]ProbeResult
+	probes                    []Probe
+	profiling                 bool
 	reconcileTime             time.Time
 	registeredPaths           map[string]ko.PathInfo
+	retryBudgets              sync.Map
 	scheme                    string
 	scripts                   []kdexv1alpha1.ScriptDef
+	securityTxt               *SecurityTxt
+	shadows                   sync.Map
+	snapshot                  Snapshot
+	sloCancel                 context.CancelFunc
+	slos                      *sloSet
 	sniffer                   interface {
 		Analyze(*http.Request) (*sniffer.AnalysisResult, error)
 		DocsHandler(http.ResponseWriter, *http.Request)
 	}
+	snifferHistory       *SnifferHistory
+	snifferQueue         *sniffer.WriteQueue
+	supportConfig        *SupportConfig
 	themeAssets          []kdexv1alpha1.Asset
+	themeExperiment      *themeExperiment
+	translationMemories  map[string]kdexv1alpha1.KDexTranslationSpec
 	translationResources map[string]kdexv1alpha1.KDexTranslationSpec
 	utilityPages         map[kdexv1alpha1.KDexUtilityPageType]page.PageHandler
 }
@@ -88,23 +149,34 @@ const (
 
 func NewHostHandler(c client.Client, name string, namespace string, log logr.Logger, cacheManager cache.CacheManager) *HostHandler {
 	hh := &HostHandler{
-		Mux:          nil,
-		Name:         name,
-		Namespace:    namespace,
-		Pages:        nil,
-		Translations: Translations{},
+		GraphQL:                       false,
+		MiddlewarePluginDir:           "",
+		MockFunctions:                 false,
+		Mux:                           nil,
+		Name:                          name,
+		Namespace:                     namespace,
+		Pages:                         nil,
+		SnifferHistorySize:            DefaultSnifferHistorySize,
+		SnifferSchemaConflictStrategy: sniffer.SchemaConflictPreferNewest,
+		SnifferUpstream:               nil,
+		SnifferWriteWindow:            sniffer.DefaultWriteWindow,
+		Translations:                  Translations{},
 
 		analysisCache:             NewAnalysisCache(),
 		authConfig:                nil,
 		authExchanger:             nil,
+		breakers:                  &breaker.Registry{},
 		cacheManager:              cacheManager,
 		client:                    c,
 		defaultLanguage:           "en",
 		favicon:                   nil,
 		functions:                 []kdexv1alpha1.KDexFunction{},
+		glossaries:                map[string]kdexv1alpha1.KDexTranslationSpec{},
+		graphqlSchema:             nil,
 		host:                      nil,
 		importmap:                 "",
 		log:                       log,
+		machineTranslations:       map[string]bool{},
 		packageReferences:         []kdexv1alpha1.PackageReference{},
 		pathsCollectedInReconcile: map[string]ko.PathInfo{},
 		reconcileTime:             time.Now(),
@@ -112,6 +184,7 @@ func NewHostHandler(c client.Client, name string, namespace string, log logr.Log
 		scheme:                    "",
 		scripts:                   []kdexv1alpha1.ScriptDef{},
 		themeAssets:               []kdexv1alpha1.Asset{},
+		translationMemories:       map[string]kdexv1alpha1.KDexTranslationSpec{},
 		translationResources:      map[string]kdexv1alpha1.KDexTranslationSpec{},
 		utilityPages:              map[kdexv1alpha1.KDexUtilityPageType]page.PageHandler{},
 	}
@@ -132,8 +205,12 @@ func NewHostHandler(c client.Client, name string, namespace string, log logr.Log
 }
 
 type Translations struct {
-	catalog *catalog.Builder
-	keys    []string
+	catalog         *catalog.Builder
+	defaultLanguage string
+	keys            []string
+	// translated holds the keys translated in each language tag.
+	translated map[string]map[string]bool
+	violations []TranslationViolation
 }
 
 func (t *Translations) Catalog() *catalog.Builder {
@@ -0,0 +1,177 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ChangePasswordAnnotation holds, on a host, the page where its users
+	// change their password, an https URL or a path of the host. Browsers and
+	// password managers are sent there from /.well-known/change-password.
+	ChangePasswordAnnotation = "kdex.dev/change-password"
+	// SecurityTxtAnnotation holds, on a host, the JSON encoded SecurityTxt
+	// generating its /.well-known/security.txt.
+	SecurityTxtAnnotation = "kdex.dev/security-txt"
+
+	defaultSecurityTxtExpiresInDays = 180
+)
+
+// SecurityTxt holds the fields of the RFC 9116 security.txt of a host which
+// are not derived from its spec. Canonical is generated from the domains of
+// the host, Preferred-Languages from its languages and Expires from
+// ExpiresInDays.
+type SecurityTxt struct {
+	Acknowledgments string   `json:"acknowledgments,omitempty"`
+	Contact         []string `json:"contact"`
+	Encryption      string   `json:"encryption,omitempty"`
+	// ExpiresInDays is how far in the future the security.txt served expires,
+	// 180 days when unset.
+	ExpiresInDays int    `json:"expiresInDays,omitempty"`
+	Hiring        string `json:"hiring,omitempty"`
+	Policy        string `json:"policy,omitempty"`
+}
+
+// ParseSecurityTxt returns the security.txt of the annotations of a host,
+// nil when SecurityTxtAnnotation is not set.
+func ParseSecurityTxt(annotations map[string]string) (*SecurityTxt, error) {
+	value := annotations[SecurityTxtAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	securityTxt := &SecurityTxt{}
+	if err := json.Unmarshal([]byte(value), securityTxt); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", SecurityTxtAnnotation, err)
+	}
+
+	if len(securityTxt.Contact) == 0 {
+		return nil, fmt.Errorf("invalid %s annotation: at least one contact is required", SecurityTxtAnnotation)
+	}
+	for _, contact := range securityTxt.Contact {
+		u, err := url.Parse(contact)
+		if err != nil || (u.Scheme != "mailto" && u.Scheme != "tel" && u.Scheme != "https") || strings.ContainsAny(contact, "\r\n") {
+			return nil, fmt.Errorf("invalid %s annotation: contact %q is not a mailto:, tel: or https: URI", SecurityTxtAnnotation, contact)
+		}
+	}
+	for _, field := range securityTxt.urlFields() {
+		if field.value != "" && !isHTTPSURL(field.value) {
+			return nil, fmt.Errorf("invalid %s annotation: %s %q is not an https URL", SecurityTxtAnnotation, strings.ToLower(field.name), field.value)
+		}
+	}
+	if securityTxt.ExpiresInDays < 0 || securityTxt.ExpiresInDays > 365 {
+		return nil, fmt.Errorf("invalid %s annotation: expiresInDays %d is not from 1 to 365", SecurityTxtAnnotation, securityTxt.ExpiresInDays)
+	}
+	if securityTxt.ExpiresInDays == 0 {
+		securityTxt.ExpiresInDays = defaultSecurityTxtExpiresInDays
+	}
+
+	return securityTxt, nil
+}
+
+type securityTxtField struct {
+	name  string
+	value string
+}
+
+// urlFields returns the optional URL fields of the security.txt, in order.
+func (s *SecurityTxt) urlFields() []securityTxtField {
+	return []securityTxtField{
+		{"Acknowledgments", s.Acknowledgments},
+		{"Encryption", s.Encryption},
+		{"Hiring", s.Hiring},
+		{"Policy", s.Policy},
+	}
+}
+
+// ParseChangePassword returns the change password page of the annotations of
+// a host, empty when ChangePasswordAnnotation is not set.
+func ParseChangePassword(annotations map[string]string) (string, error) {
+	value := annotations[ChangePasswordAnnotation]
+	if value == "" {
+		return "", nil
+	}
+
+	if !isHTTPSURL(value) && (!strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//")) {
+		return "", fmt.Errorf("invalid %s annotation %q, expected an https URL or a path", ChangePasswordAnnotation, value)
+	}
+	return value, nil
+}
+
+func isHTTPSURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme == "https" && u.Host != "" && !strings.ContainsAny(value, "\r\n")
+}
+
+// SetWellKnown replaces the security.txt and the change password page of the
+// host. Their well-known paths are not served when nil or empty.
+func (hh *HostHandler) SetWellKnown(securityTxt *SecurityTxt, changePassword string) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.securityTxt = securityTxt
+	hh.changePassword = changePassword
+}
+
+// ChangePasswordGet redirects to the page where the users change their
+// password.
+func (hh *HostHandler) ChangePasswordGet(w http.ResponseWriter, r *http.Request) {
+	hh.mu.RLock()
+	changePassword := hh.changePassword
+	hh.mu.RUnlock()
+
+	if changePassword == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, changePassword, http.StatusFound)
+}
+
+// SecurityTxtGet serves the RFC 9116 security.txt of the host.
+func (hh *HostHandler) SecurityTxtGet(w http.ResponseWriter, r *http.Request) {
+	hh.mu.RLock()
+	securityTxt := hh.securityTxt
+	organization := hh.getOrganization()
+	scheme := hh.scheme
+	domains := []string{}
+	if hh.host != nil {
+		domains = hh.host.Routing.Domains
+	}
+	languages := hh.availableLanguages(&hh.Translations)
+	if len(languages) == 0 {
+		languages = []string{hh.defaultLanguage}
+	}
+	hh.mu.RUnlock()
+
+	if securityTxt == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body strings.Builder
+	if organization != "" {
+		fmt.Fprintf(&body, "# Security contacts of %s\n", organization)
+	}
+	for _, contact := range securityTxt.Contact {
+		fmt.Fprintf(&body, "Contact: %s\n", contact)
+	}
+	expires := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, securityTxt.ExpiresInDays)
+	fmt.Fprintf(&body, "Expires: %s\n", expires.Format(time.RFC3339))
+	for _, field := range securityTxt.urlFields() {
+		if field.value != "" {
+			fmt.Fprintf(&body, "%s: %s\n", field.name, field.value)
+		}
+	}
+	for _, domain := range domains {
+		fmt.Fprintf(&body, "Canonical: %s://%s/.well-known/security.txt\n", scheme, domain)
+	}
+	fmt.Fprintf(&body, "Preferred-Languages: %s\n", strings.Join(languages, ", "))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(body.String()))
+}
@@ -0,0 +1,109 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func TestParseSecurityTxt(t *testing.T) {
+	securityTxt, err := ParseSecurityTxt(nil)
+	require.NoError(t, err)
+	assert.Nil(t, securityTxt)
+
+	securityTxt, err = ParseSecurityTxt(map[string]string{
+		SecurityTxtAnnotation: `{"contact":["mailto:security@example.com"],"policy":"https://example.com/security"}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mailto:security@example.com"}, securityTxt.Contact)
+	assert.Equal(t, defaultSecurityTxtExpiresInDays, securityTxt.ExpiresInDays)
+
+	for _, value := range []string{
+		`not json`,
+		`{"contact":[]}`,
+		`{"contact":["security@example.com"]}`,
+		`{"contact":["http://example.com/security"]}`,
+		`{"contact":["mailto:security@example.com"],"policy":"/security"}`,
+		`{"contact":["mailto:security@example.com"],"expiresInDays":400}`,
+	} {
+		_, err := ParseSecurityTxt(map[string]string{SecurityTxtAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseChangePassword(t *testing.T) {
+	changePassword, err := ParseChangePassword(nil)
+	require.NoError(t, err)
+	assert.Empty(t, changePassword)
+
+	for _, value := range []string{"/account/password", "https://id.example.com/account/password"} {
+		changePassword, err = ParseChangePassword(map[string]string{ChangePasswordAnnotation: value})
+		require.NoError(t, err)
+		assert.Equal(t, value, changePassword)
+	}
+
+	for _, value := range []string{"account/password", "//evil.example.com", "http://id.example.com"} {
+		_, err = ParseChangePassword(map[string]string{ChangePasswordAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHostHandler_WellKnown(t *testing.T) {
+	cacheManager, _ := cache.NewCacheManager("", "shop", nil)
+	hh := NewHostHandler(nil, "shop", "kdex", logr.Discard(), cacheManager)
+	spec := &kdexv1alpha1.KDexHostSpec{
+		DefaultLang:  "en",
+		BrandName:    "Shop",
+		Organization: "Example Inc.",
+		OpenAPI: kdexv1alpha1.OpenAPI{
+			TypesToInclude: []kdexv1alpha1.TypeToInclude{kdexv1alpha1.TypeSYSTEM},
+		},
+		Routing: kdexv1alpha1.Routing{Domains: []string{"shop.example.com"}},
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		hh.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	hh.SetHost(context.Background(), spec, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "https")
+	assert.Equal(t, http.StatusNotFound, serve("/.well-known/security.txt").Code)
+	assert.Equal(t, http.StatusNotFound, serve("/.well-known/change-password").Code)
+
+	securityTxt, err := ParseSecurityTxt(map[string]string{
+		SecurityTxtAnnotation: `{"contact":["mailto:security@example.com","https://example.com/report"],"policy":"https://example.com/security","expiresInDays":30}`,
+	})
+	require.NoError(t, err)
+	hh.SetWellKnown(securityTxt, "/account/password")
+	hh.SetHost(context.Background(), spec, nil, 0, nil, nil, nil, "", nil, nil, &auth.Exchanger{}, &auth.Config{}, "https")
+
+	rr := serve("/.well-known/security.txt")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	body := rr.Body.String()
+	assert.Contains(t, body, "# Security contacts of Example Inc.\n")
+	assert.Contains(t, body, "Contact: mailto:security@example.com\nContact: https://example.com/report\nExpires: ")
+	assert.Contains(t, body, "Policy: https://example.com/security\n")
+	assert.Contains(t, body, "Canonical: https://shop.example.com/.well-known/security.txt\n")
+	assert.Contains(t, body, "Preferred-Languages: en\n")
+
+	rr = serve("/.well-known/change-password")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/account/password", rr.Header().Get("Location"))
+
+	rr = serve("/-/openapi?type=system")
+	require.Equal(t, http.StatusOK, rr.Code)
+	doc := map[string]any{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Contains(t, doc["paths"], "/.well-known/security.txt")
+	assert.Contains(t, doc["paths"], "/.well-known/change-password")
+}
@@ -0,0 +1,384 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	XLIFFNamespace = "urn:oasis:names:tc:xliff:document:2.0"
+	XLIFFVersion   = "2.0"
+	// XLIFFLangLabel is set on the translations holding the imported XLIFF
+	// deliveries of a language.
+	XLIFFLangLabel = "kdex.dev/xliff-lang"
+
+	// maxXLIFFKeys is the most keys a translation resource may hold.
+	maxXLIFFKeys         = 256
+	maxXLIFFRequestBytes = 10 << 20
+)
+
+// Kinds of XLIFFConflict. The units in conflict are not imported.
+const (
+	// XLIFFConflictModified is a unit whose key is already translated
+	// differently by a translation which was not imported from XLIFF.
+	XLIFFConflictModified = "modified"
+	// XLIFFConflictSource is a unit translated from a source which is no
+	// longer the value of the key in the default language.
+	XLIFFConflictSource = "source"
+	// XLIFFConflictUnknown is a unit whose key does not exist in the default
+	// language.
+	XLIFFConflictUnknown = "unknown"
+	// XLIFFConflictUntranslated is a unit without a target.
+	XLIFFConflictUntranslated = "untranslated"
+)
+
+// XLIFFConflict is a unit of an XLIFF delivery which was not imported.
+type XLIFFConflict struct {
+	Current   string `json:"current,omitempty"`
+	Delivered string `json:"delivered,omitempty"`
+	Key       string `json:"key"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+}
+
+// XLIFFImportReport is the outcome of the import of an XLIFF delivery.
+type XLIFFImportReport struct {
+	Conflicts []XLIFFConflict `json:"conflicts"`
+	DryRun    bool            `json:"dryRun,omitempty"`
+	Imported  int             `json:"imported"`
+	Lang      string          `json:"lang"`
+	Resources []string        `json:"resources,omitempty"`
+}
+
+type xliffDocument struct {
+	XMLName xml.Name    `xml:"urn:oasis:names:tc:xliff:document:2.0 xliff"`
+	Version string      `xml:"version,attr"`
+	SrcLang string      `xml:"srcLang,attr"`
+	TrgLang string      `xml:"trgLang,attr,omitempty"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	ID    string      `xml:"id,attr"`
+	Units []xliffUnit `xml:"unit"`
+}
+
+// xliffUnit carries the key in its name, keys are not always valid ids.
+type xliffUnit struct {
+	ID       string         `xml:"id,attr"`
+	Name     string         `xml:"name,attr,omitempty"`
+	Segments []xliffSegment `xml:"segment"`
+}
+
+type xliffSegment struct {
+	State  string  `xml:"state,attr,omitempty"`
+	Source string  `xml:"source"`
+	Target *string `xml:"target,omitempty"`
+}
+
+// TranslationExportGet returns the keys of the default language with their
+// translation in the language of the lang query parameter as XLIFF 2.0.
+func (hh *HostHandler) TranslationExportGet(w http.ResponseWriter, r *http.Request) {
+	tag, err := language.Parse(r.URL.Query().Get("lang"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid lang: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if shouldReturn := hh.handleAuth(
+		r,
+		w,
+		"translations",
+		tag.String(),
+		[]kdexv1alpha1.SecurityRequirement{
+			{
+				"bearer": []string{fmt.Sprintf("translations:%s:read", tag)},
+			},
+		},
+	); shouldReturn {
+		return
+	}
+
+	hh.mu.RLock()
+	doc := xliffExport(hh.Name, hh.defaultLanguage, tag, hh.translationResources, r.URL.Query().Get("missing") == "true")
+	hh.mu.RUnlock()
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s.%s.xlf", hh.Name, tag)))
+	w.Header().Set("Content-Type", "application/xliff+xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(out)
+}
+
+// TranslationImportPost validates an XLIFF 2.0 delivery and merges its
+// translated units into the translations imported for its target language.
+// Units in conflict are reported and skipped. With dryRun=true nothing is
+// written. Hosts without authentication accept no import.
+func (hh *HostHandler) TranslationImportPost(w http.ResponseWriter, r *http.Request) {
+	doc := &xliffDocument{}
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxXLIFFRequestBytes)).Decode(doc); err != nil {
+		http.Error(w, fmt.Sprintf("invalid XLIFF: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hh.mu.RLock()
+	tag, accepted, conflicts, err := xliffReview(hh.Name, hh.defaultLanguage, doc, hh.translationResources)
+	hh.mu.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if shouldReturn := hh.handleRequiredAuth(
+		r,
+		w,
+		"translations",
+		tag.String(),
+		[]kdexv1alpha1.SecurityRequirement{
+			{
+				"bearer": []string{fmt.Sprintf("translations:%s:write", tag)},
+			},
+		},
+	); shouldReturn {
+		return
+	}
+
+	report := XLIFFImportReport{
+		Conflicts: conflicts,
+		DryRun:    r.URL.Query().Get("dryRun") == "true",
+		Imported:  len(accepted),
+		Lang:      tag.String(),
+	}
+
+	if !report.DryRun && len(accepted) > 0 {
+		report.Resources, err = hh.mergeXLIFF(r.Context(), tag, accepted)
+		if err != nil {
+			hh.log.Error(err, "failed to import XLIFF", "lang", tag.String())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// mergeXLIFF writes the keys and values into the translations imported from
+// XLIFF for the language, split in resources of at most maxXLIFFKeys keys.
+// It returns the names of the resources.
+func (hh *HostHandler) mergeXLIFF(ctx context.Context, tag language.Tag, keysAndValues map[string]string) ([]string, error) {
+	labels := map[string]string{
+		"app.kubernetes.io/name": "kdex-host",
+		"kdex.dev/host":          hh.Name,
+		XLIFFLangLabel:           strings.ToLower(tag.String()),
+	}
+
+	list := &kdexv1alpha1.KDexInternalTranslationList{}
+	if err := hh.client.List(ctx, list, client.InNamespace(hh.Namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+
+	merged := map[string]string{}
+	existing := map[string]*kdexv1alpha1.KDexInternalTranslation{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		existing[item.Name] = item
+		for _, tr := range item.Spec.Translations {
+			maps.Copy(merged, tr.KeysAndValues)
+		}
+	}
+	maps.Copy(merged, keysAndValues)
+
+	names := []string{}
+	for chunk := range slices.Chunk(slices.Sorted(maps.Keys(merged)), maxXLIFFKeys) {
+		translation := &kdexv1alpha1.KDexInternalTranslation{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s%s-%d", xliffResourcePrefix(hh.Name), strings.ToLower(tag.String()), len(names)),
+				Namespace: hh.Namespace,
+			},
+		}
+
+		if _, err := controllerutil.CreateOrUpdate(ctx, hh.client, translation, func() error {
+			if translation.Labels == nil {
+				translation.Labels = map[string]string{}
+			}
+			maps.Copy(translation.Labels, labels)
+
+			values := make(map[string]string, len(chunk))
+			for _, key := range chunk {
+				values[key] = merged[key]
+			}
+			translation.Spec.HostRef.Name = hh.Name
+			translation.Spec.Translations = []kdexv1alpha1.Translation{{Lang: tag.String(), KeysAndValues: values}}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		names = append(names, translation.Name)
+		delete(existing, translation.Name)
+	}
+
+	// Fewer resources are needed when keys were removed from the chunks.
+	for _, name := range slices.Sorted(maps.Keys(existing)) {
+		if err := hh.client.Delete(ctx, existing[name]); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// xliffExport returns the XLIFF document of the keys of the default language
+// and, when translated, their value in the language. With missingOnly only
+// the keys without translation are exported.
+func xliffExport(
+	hostName string,
+	defaultLanguage string,
+	tag language.Tag,
+	resources map[string]kdexv1alpha1.KDexTranslationSpec,
+	missingOnly bool,
+) *xliffDocument {
+	defaultTag := language.Make(defaultLanguage).String()
+	values := byLanguage(resources)
+	sources := values[defaultTag]
+	targets := values[tag.String()]
+
+	file := xliffFile{ID: hostName, Units: []xliffUnit{}}
+	for _, key := range slices.Sorted(maps.Keys(sources)) {
+		segment := xliffSegment{Source: sources[key], State: "initial"}
+		if target, ok := targets[key]; ok {
+			if missingOnly {
+				continue
+			}
+			segment.State = "translated"
+			segment.Target = &target
+		}
+		file.Units = append(file.Units, xliffUnit{
+			ID:       fmt.Sprintf("u%d", len(file.Units)+1),
+			Name:     key,
+			Segments: []xliffSegment{segment},
+		})
+	}
+
+	return &xliffDocument{
+		Version: XLIFFVersion,
+		SrcLang: defaultTag,
+		TrgLang: tag.String(),
+		Files:   []xliffFile{file},
+	}
+}
+
+// xliffReview validates the XLIFF document against the translations of the
+// host. It returns the target language, the translated units which can be
+// imported and the units in conflict.
+func xliffReview(
+	hostName string,
+	defaultLanguage string,
+	doc *xliffDocument,
+	resources map[string]kdexv1alpha1.KDexTranslationSpec,
+) (language.Tag, map[string]string, []XLIFFConflict, error) {
+	if doc.Version != XLIFFVersion {
+		return language.Und, nil, nil, fmt.Errorf("unsupported XLIFF version %q, expected %q", doc.Version, XLIFFVersion)
+	}
+
+	defaultTag := language.Make(defaultLanguage)
+	srcLang, err := language.Parse(doc.SrcLang)
+	if err != nil {
+		return language.Und, nil, nil, fmt.Errorf("invalid srcLang: %w", err)
+	}
+	if srcLang != defaultTag {
+		return language.Und, nil, nil, fmt.Errorf("srcLang %q is not the default language %q", doc.SrcLang, defaultTag)
+	}
+
+	tag, err := language.Parse(doc.TrgLang)
+	if err != nil {
+		return language.Und, nil, nil, fmt.Errorf("invalid trgLang: %w", err)
+	}
+	if tag == defaultTag {
+		return language.Und, nil, nil, fmt.Errorf("trgLang %q is the default language", doc.TrgLang)
+	}
+
+	// Translations previously imported from XLIFF are replaced, the others
+	// are left to their authors.
+	sources := byLanguage(resources)[defaultTag.String()]
+	authored := map[string]kdexv1alpha1.KDexTranslationSpec{}
+	for name, resource := range resources {
+		if !strings.HasPrefix(name, xliffResourcePrefix(hostName)) {
+			authored[name] = resource
+		}
+	}
+	current := byLanguage(authored)[tag.String()]
+
+	accepted := map[string]string{}
+	conflicts := []XLIFFConflict{}
+	for _, file := range doc.Files {
+		for _, unit := range file.Units {
+			key := unit.Name
+			if key == "" {
+				key = unit.ID
+			}
+
+			var source, target strings.Builder
+			translated := len(unit.Segments) > 0
+			for _, segment := range unit.Segments {
+				source.WriteString(segment.Source)
+				if segment.Target == nil {
+					translated = false
+					continue
+				}
+				target.WriteString(*segment.Target)
+			}
+
+			conflict := XLIFFConflict{Delivered: target.String(), Key: key}
+			expected, known := sources[key]
+			switch {
+			case !known:
+				conflict.Kind = XLIFFConflictUnknown
+				conflict.Message = "key does not exist in the default language"
+			case source.String() != expected:
+				conflict.Current = expected
+				conflict.Kind = XLIFFConflictSource
+				conflict.Message = "source differs from the value of the key in the default language"
+			case !translated || target.Len() == 0:
+				conflict.Kind = XLIFFConflictUntranslated
+				conflict.Message = "unit has no target"
+			case current[key] != "" && current[key] != target.String():
+				conflict.Current = current[key]
+				conflict.Kind = XLIFFConflictModified
+				conflict.Message = "key is already translated differently"
+			default:
+				accepted[key] = target.String()
+				continue
+			}
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return tag, accepted, conflicts, nil
+}
+
+// xliffResourcePrefix prefixes the names of the translations imported from
+// XLIFF for the host.
+func xliffResourcePrefix(hostName string) string {
+	return hostName + "-xliff-"
+}
@@ -0,0 +1,205 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal/auth"
+	"github.com/kdex-tech/host-manager/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var xliffResources = map[string]kdexv1alpha1.KDexTranslationSpec{
+	"messages": {
+		Translations: []kdexv1alpha1.Translation{
+			{Lang: "en", KeysAndValues: map[string]string{
+				"cart":     "Your cart",
+				"checkout": "Check out",
+				"signin":   "Sign in",
+			}},
+			{Lang: "fr", KeysAndValues: map[string]string{
+				"signin": "Connexion",
+			}},
+		},
+	},
+}
+
+func Test_xliffExport(t *testing.T) {
+	doc := xliffExport("shop", "en", language.French, xliffResources, false)
+
+	out, err := xml.Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="fr">`)
+	assert.Contains(t, string(out), `<unit id="u3" name="signin"><segment state="translated"><source>Sign in</source><target>Connexion</target></segment></unit>`)
+	assert.Contains(t, string(out), `<unit id="u1" name="cart"><segment state="initial"><source>Your cart</source></segment></unit>`)
+
+	parsed := &xliffDocument{}
+	require.NoError(t, xml.Unmarshal(out, parsed))
+	assert.Equal(t, doc.Files, parsed.Files)
+
+	missing := xliffExport("shop", "en", language.French, xliffResources, true)
+	require.Len(t, missing.Files[0].Units, 2)
+	assert.Equal(t, "cart", missing.Files[0].Units[0].Name)
+	assert.Equal(t, "checkout", missing.Files[0].Units[1].Name)
+}
+
+func Test_xliffReview(t *testing.T) {
+	delivery := func(srcLang, trgLang string, units ...xliffUnit) *xliffDocument {
+		return &xliffDocument{
+			Version: XLIFFVersion,
+			SrcLang: srcLang,
+			TrgLang: trgLang,
+			Files:   []xliffFile{{ID: "shop", Units: units}},
+		}
+	}
+	unit := func(key, source string, target *string) xliffUnit {
+		return xliffUnit{ID: key, Name: key, Segments: []xliffSegment{{Source: source, Target: target}}}
+	}
+
+	t.Run("invalid documents are rejected", func(t *testing.T) {
+		doc := delivery("en", "fr")
+		doc.Version = "1.2"
+		_, _, _, err := xliffReview("shop", "en", doc, xliffResources)
+		assert.ErrorContains(t, err, "unsupported XLIFF version")
+
+		_, _, _, err = xliffReview("shop", "en", delivery("de", "fr"), xliffResources)
+		assert.ErrorContains(t, err, "is not the default language")
+
+		_, _, _, err = xliffReview("shop", "en", delivery("en", ""), xliffResources)
+		assert.ErrorContains(t, err, "invalid trgLang")
+
+		_, _, _, err = xliffReview("shop", "en", delivery("en", "en"), xliffResources)
+		assert.ErrorContains(t, err, "is the default language")
+	})
+
+	t.Run("conflicts are reported and skipped", func(t *testing.T) {
+		tag, accepted, conflicts, err := xliffReview("shop", "en", delivery("en", "fr",
+			unit("cart", "Your cart", new("Votre panier")),
+			unit("checkout", "Checkout", new("Paiement")),
+			unit("signin", "Sign in", new("Se connecter")),
+			unit("signout", "Sign out", new("Déconnexion")),
+			xliffUnit{ID: "u5", Name: "cart", Segments: []xliffSegment{{Source: "Your cart"}}},
+		), xliffResources)
+		require.NoError(t, err)
+
+		assert.Equal(t, language.French, tag)
+		assert.Equal(t, map[string]string{"cart": "Votre panier"}, accepted)
+		assert.Equal(t, []XLIFFConflict{
+			{Current: "Check out", Delivered: "Paiement", Key: "checkout", Kind: XLIFFConflictSource, Message: "source differs from the value of the key in the default language"},
+			{Current: "Connexion", Delivered: "Se connecter", Key: "signin", Kind: XLIFFConflictModified, Message: "key is already translated differently"},
+			{Delivered: "Déconnexion", Key: "signout", Kind: XLIFFConflictUnknown, Message: "key does not exist in the default language"},
+			{Key: "cart", Kind: XLIFFConflictUntranslated, Message: "unit has no target"},
+		}, conflicts)
+	})
+
+	t.Run("previous imports are replaced", func(t *testing.T) {
+		resources := map[string]kdexv1alpha1.KDexTranslationSpec{
+			"messages": xliffResources["messages"],
+			"shop-xliff-fr-0": {
+				Translations: []kdexv1alpha1.Translation{
+					{Lang: "fr", KeysAndValues: map[string]string{"cart": "Votre chariot"}},
+				},
+			},
+		}
+
+		_, accepted, conflicts, err := xliffReview("shop", "en", delivery("en", "fr",
+			unit("cart", "Your cart", new("Votre panier")),
+		), resources)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"cart": "Votre panier"}, accepted)
+		assert.Empty(t, conflicts)
+	})
+}
+
+func TestTranslationImportPost(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	hh := NewHostHandler(c, "shop", "kdex", logr.Discard(), nil)
+	hh.translationResources = maps.Clone(xliffResources)
+
+	var units strings.Builder
+	for i := range maxXLIFFKeys + 2 {
+		key := fmt.Sprintf("key%03d", i)
+		hh.translationResources[key] = kdexv1alpha1.KDexTranslationSpec{
+			Translations: []kdexv1alpha1.Translation{{Lang: "en", KeysAndValues: map[string]string{key: key}}},
+		}
+		fmt.Fprintf(&units, `<unit id="u%d" name="%s"><segment><source>%s</source><target>%s-de</target></segment></unit>`, i, key, key, key)
+	}
+
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="de">
+  <file id="shop">` + units.String() + `
+    <unit id="x" name="unknown"><segment><source>Unknown</source><target>Unbekannt</target></segment></unit>
+  </file>
+</xliff>`
+
+	post := func(query string, entitlements ...any) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/-/admin/translations/import"+query, strings.NewReader(body))
+		if len(entitlements) > 0 {
+			req = req.WithContext(auth.SetAuthContext(req.Context(), auth.AuthContext{"entitlements": entitlements}))
+		}
+		rec := httptest.NewRecorder()
+		hh.TranslationImportPost(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, post("", "translations:de:read", "translations:de:write").Code, "authentication disabled")
+
+	hh.authChecker = auth.NewAuthorizationChecker(nil, logr.Discard())
+	hh.authConfig = &auth.Config{ActivePair: &keys.KeyPair{}}
+	assert.Equal(t, http.StatusNotFound, post("").Code, "anonymous")
+
+	list := &kdexv1alpha1.KDexInternalTranslationList{}
+	require.NoError(t, c.List(context.Background(), list))
+	assert.Empty(t, list.Items)
+
+	rec := post("?dryRun=true", "translations:de:read", "translations:de:write")
+	require.Equal(t, http.StatusOK, rec.Code)
+	report := XLIFFImportReport{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, maxXLIFFKeys+2, report.Imported)
+	assert.Empty(t, report.Resources)
+	require.Len(t, report.Conflicts, 1)
+	assert.Equal(t, XLIFFConflictUnknown, report.Conflicts[0].Kind)
+
+	require.NoError(t, c.List(context.Background(), list))
+	assert.Empty(t, list.Items)
+
+	rec = post("", "translations:de:read", "translations:de:write")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, []string{"shop-xliff-de-0", "shop-xliff-de-1"}, report.Resources)
+
+	require.NoError(t, c.List(context.Background(), list, client.MatchingLabels{XLIFFLangLabel: "de"}))
+	require.Len(t, list.Items, 2)
+	for _, item := range list.Items {
+		assert.Equal(t, "shop", item.Spec.HostRef.Name)
+		require.Len(t, item.Spec.Translations, 1)
+		assert.Equal(t, "de", item.Spec.Translations[0].Lang)
+	}
+	assert.Len(t, list.Items[0].Spec.Translations[0].KeysAndValues, maxXLIFFKeys)
+	assert.Equal(t, "key000-de", list.Items[0].Spec.Translations[0].KeysAndValues["key000"])
+	assert.Len(t, list.Items[1].Spec.Translations[0].KeysAndValues, 2)
+
+	req := httptest.NewRequest(http.MethodPost, "/-/admin/translations/import", strings.NewReader(`<xliff version="2.0"/>`))
+	rec = httptest.NewRecorder()
+	hh.TranslationImportPost(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
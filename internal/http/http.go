@@ -195,3 +195,17 @@ func ValidatePattern(pattern string, r *http.Request) (err error) {
 
 	return nil
 }
+
+// CheckPattern returns an error when the pattern path is not a valid
+// net/http pattern.
+func CheckPattern(pattern string) (err error) {
+	// http.NewServeMux().HandleFunc panics if the pattern is invalid.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid pattern path %q: %v", pattern, r)
+		}
+	}()
+
+	http.NewServeMux().HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {})
+	return nil
+}
@@ -151,6 +151,22 @@ func GenerateRSAKeyPair() *KeyPairs {
 	return instance
 }
 
+// GenerateECDSAKeyPEM generates a new P-256 private key for the jwt-keys
+// secrets, PKCS8 PEM encoded.
+func GenerateECDSAKeyPEM() ([]byte, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
 // LoadKeyFromPEM loads a private key from a PEM encoded private key.
 func LoadKeyFromPEM(privateKeyPEM []byte) (*KeyPair, error) {
 	block, _ := pem.Decode(privateKeyPEM)
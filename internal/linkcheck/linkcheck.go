@@ -0,0 +1,167 @@
+// Package linkcheck validates rendered pages: the well-formedness of their
+// HTML, their duplicate ids, and the internal links and assets they refer to.
+package linkcheck
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	RuleBrokenLink      = "broken-link"
+	RuleDuplicateID     = "duplicate-id"
+	RuleStrayEndTag     = "stray-end-tag"
+	RuleUnclosedElement = "unclosed-element"
+)
+
+// Issue is a problem of a page.
+type Issue struct {
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
+	Target  string `json:"target"`
+}
+
+// Summary returns the rules of the issues with their count, e.g.
+// "broken-link:2,duplicate-id:1".
+func Summary(issues []Issue) string {
+	counts := map[string]int{}
+	for _, issue := range issues {
+		counts[issue.Rule]++
+	}
+	pairs := make([]string, 0, len(counts))
+	for _, rule := range slices.Sorted(maps.Keys(counts)) {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", rule, counts[rule]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Suppressed reports whether the issue is suppressed by one of the entries,
+// which are rules or path.Match patterns of targets.
+func Suppressed(issue Issue, entries []string) bool {
+	for _, entry := range entries {
+		if entry == issue.Rule {
+			return true
+		}
+		if ok, _ := path.Match(entry, issue.Target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// optionalEndTags are the elements whose end tag may be omitted.
+var optionalEndTags = map[string]bool{
+	"body": true, "caption": true, "colgroup": true, "dd": true, "dt": true, "head": true, "html": true,
+	"li": true, "optgroup": true, "option": true, "p": true, "rb": true, "rp": true, "rt": true,
+	"tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "tr": true,
+}
+
+// linkAttributes are the attributes of the elements referring to pages or
+// assets.
+var linkAttributes = map[string]string{
+	"a": "href", "area": "href", "audio": "src", "embed": "src", "iframe": "src", "img": "src",
+	"link": "href", "script": "src", "source": "src", "track": "src", "video": "src",
+}
+
+// Validate returns the well-formedness and duplicate id issues of the
+// document, and the links and assets it refers to in document order.
+func Validate(document string) ([]Issue, []string, error) {
+	issues := []Issue{}
+	ids := map[string]int{}
+	links := []string{}
+	seen := map[string]bool{}
+	stack := []string{}
+
+	z := html.NewTokenizer(strings.NewReader(document))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				return nil, nil, fmt.Errorf("failed to tokenize document: %w", err)
+			}
+			break
+		}
+
+		token := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for _, a := range token.Attr {
+				if a.Key == "id" && a.Val != "" {
+					ids[a.Val]++
+				}
+				if a.Key == linkAttributes[token.Data] && a.Val != "" && !seen[a.Val] {
+					seen[a.Val] = true
+					links = append(links, a.Val)
+				}
+			}
+			if tt == html.StartTagToken && !voidElements[token.Data] {
+				stack = append(stack, token.Data)
+			}
+		case html.EndTagToken:
+			i := len(stack) - 1
+			for i >= 0 && stack[i] != token.Data {
+				i--
+			}
+			if i < 0 {
+				if !voidElements[token.Data] {
+					issues = append(issues, Issue{Message: fmt.Sprintf("The end tag </%s> closes no element", token.Data), Rule: RuleStrayEndTag, Target: token.Data})
+				}
+				continue
+			}
+			for _, name := range stack[i+1:] {
+				if !optionalEndTags[name] {
+					issues = append(issues, Issue{Message: fmt.Sprintf("The element is closed by </%s>", token.Data), Rule: RuleUnclosedElement, Target: name})
+				}
+			}
+			stack = stack[:i]
+		}
+	}
+
+	for _, name := range stack {
+		if !optionalEndTags[name] {
+			issues = append(issues, Issue{Message: "The element is not closed", Rule: RuleUnclosedElement, Target: name})
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(ids)) {
+		if count := ids[id]; count > 1 {
+			issues = append(issues, Issue{Message: fmt.Sprintf("The id is used by %d elements", count), Rule: RuleDuplicateID, Target: "#" + id})
+		}
+	}
+
+	return issues, links, nil
+}
+
+// Internal resolves the link against the URL of the page it is found on. It
+// returns the request URI of the link, false when the link is external, a
+// fragment of the page or not fetched over http.
+func Internal(base *url.URL, link string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	if u.Host != "" || u.Opaque != "" {
+		return "", false
+	}
+	if u.Path == "" && u.RawQuery == "" {
+		return "", false
+	}
+	resolved := base.ResolveReference(u)
+	resolved.Fragment = ""
+	return resolved.RequestURI(), true
+}
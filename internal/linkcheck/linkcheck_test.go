@@ -0,0 +1,67 @@
+package linkcheck
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	issues, links, err := Validate(`<!DOCTYPE html>
+<html lang="en">
+<head><title>Home</title><link rel="stylesheet" href="/theme.css"><script src="/app.js"></script></head>
+<body>
+<ul><li><a href="/about">About</a><li><a href="#top">Top</a></ul>
+<p>Intro<p>More
+<div id="main"><span id="main">text</div>
+<svg><path d="M0 0"/></svg>
+<img src="/logo.png"><img src="/logo.png">
+</section>
+<main>
+</body>
+</html>`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/theme.css", "/app.js", "/about", "#top", "/logo.png"}, links)
+	assert.Equal(t, []Issue{
+		{Message: "The element is closed by </div>", Rule: RuleUnclosedElement, Target: "span"},
+		{Message: "The end tag </section> closes no element", Rule: RuleStrayEndTag, Target: "section"},
+		{Message: "The element is closed by </body>", Rule: RuleUnclosedElement, Target: "main"},
+		{Message: "The id is used by 2 elements", Rule: RuleDuplicateID, Target: "#main"},
+	}, issues)
+	assert.Equal(t, "duplicate-id:1,stray-end-tag:1,unclosed-element:2", Summary(issues))
+
+	issues, _, err = Validate(`<html><body><div>`)
+	require.NoError(t, err)
+	assert.Equal(t, []Issue{{Message: "The element is not closed", Rule: RuleUnclosedElement, Target: "div"}}, issues)
+}
+
+func TestSuppressed(t *testing.T) {
+	issue := Issue{Rule: RuleBrokenLink, Target: "/legacy/about"}
+	assert.True(t, Suppressed(issue, []string{RuleBrokenLink}))
+	assert.True(t, Suppressed(issue, []string{RuleDuplicateID, "/legacy/*"}))
+	assert.False(t, Suppressed(issue, []string{RuleDuplicateID, "/legacy"}))
+	assert.False(t, Suppressed(issue, nil))
+}
+
+func TestInternal(t *testing.T) {
+	base := &url.URL{Path: "/fr/docs/guide"}
+	for link, want := range map[string]string{
+		"/about":                  "/about",
+		"setup?step=2#install":    "/fr/docs/setup?step=2",
+		"../blog/":                "/fr/blog/",
+		"http:/relative":          "/relative",
+		"/search?q=a%20b":         "/search?q=a%20b",
+		"  /trimmed  ":            "/trimmed",
+		"https://example.com/x":   "",
+		"//cdn.example.com/a.js":  "",
+		"#top":                    "",
+		"mailto:team@example.com": "",
+		"javascript:void(0)":      "",
+	} {
+		target, ok := Internal(base, link)
+		assert.Equal(t, want != "", ok, link)
+		assert.Equal(t, want, target, link)
+	}
+}
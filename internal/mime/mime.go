@@ -7,13 +7,15 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 )
 
+// sniffLimit is how many bytes of the content the detection looks at.
+const sniffLimit = 3072
+
 func Detect(rc io.Reader) (*mimetype.MIME, io.Reader, error) {
 	// If it's already a bufio.Reader, don't wrap it again
 	br, ok := rc.(*bufio.Reader)
 	if !ok {
 		br = bufio.NewReader(rc)
 	}
-	sniffLimit := 3072
 	peekedBytes, err := br.Peek(sniffLimit)
 	if err != nil && err != io.EOF {
 		return nil, nil, err
@@ -0,0 +1,123 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	stdmime "mime"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// MediaType is a media type the generic detection does not know or
+// misclassifies, detected by the extension of a file name or by the magic
+// bytes its content starts with.
+type MediaType struct {
+	// Extensions are the file name extensions of the media type, e.g. ".acd".
+	Extensions []string `json:"extensions,omitempty"`
+	// Magic are the hex encoded prefixes of the content of the media type,
+	// e.g. "4b4458", any of which identifies it.
+	Magic []string `json:"magic,omitempty"`
+	// Type is the canonical media type, e.g. "application/vnd.kdex.drawing".
+	Type string `json:"type"`
+}
+
+// Registry detects the media types registered with it before the generic
+// detection. A nil registry only detects with the generic detection.
+type Registry struct {
+	extensions map[string]string
+	magic      []registeredMagic
+}
+
+type registeredMagic struct {
+	prefix    []byte
+	mediaType string
+}
+
+// NewRegistry returns the registry of the media types. Magic bytes are tried
+// longest first, so that a more specific prefix wins over a shorter one.
+func NewRegistry(mediaTypes []MediaType) (*Registry, error) {
+	r := &Registry{extensions: map[string]string{}}
+	for _, mt := range mediaTypes {
+		mediaType, _, err := stdmime.ParseMediaType(mt.Type)
+		if err != nil || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("invalid media type %q", mt.Type)
+		}
+		if len(mt.Extensions) == 0 && len(mt.Magic) == 0 {
+			return nil, fmt.Errorf("media type %s has neither extensions nor magic bytes", mediaType)
+		}
+
+		for _, extension := range mt.Extensions {
+			extension = strings.ToLower(extension)
+			if len(extension) < 2 || !strings.HasPrefix(extension, ".") || strings.ContainsAny(extension[1:], "./") {
+				return nil, fmt.Errorf("invalid extension %q of media type %s, expected e.g. .ext", extension, mediaType)
+			}
+			if other, ok := r.extensions[extension]; ok && other != mediaType {
+				return nil, fmt.Errorf("extension %s is registered for media types %s and %s", extension, other, mediaType)
+			}
+			r.extensions[extension] = mediaType
+		}
+
+		for _, magic := range mt.Magic {
+			prefix, err := hex.DecodeString(strings.ReplaceAll(magic, " ", ""))
+			if err != nil || len(prefix) == 0 {
+				return nil, fmt.Errorf("invalid magic %q of media type %s, expected hex encoded bytes", magic, mediaType)
+			}
+			if len(prefix) > sniffLimit {
+				return nil, fmt.Errorf("magic %q of media type %s is longer than %d bytes", magic, mediaType, sniffLimit)
+			}
+			r.magic = append(r.magic, registeredMagic{prefix: prefix, mediaType: mediaType})
+		}
+	}
+
+	slices.SortStableFunc(r.magic, func(a, b registeredMagic) int { return len(b.prefix) - len(a.prefix) })
+
+	return r, nil
+}
+
+// Detect returns the media type of the content of rc, and a reader of the
+// whole content.
+func (r *Registry) Detect(rc io.Reader) (string, io.Reader, error) {
+	return r.DetectFile("", rc)
+}
+
+// DetectFile returns the media type of the file named name, by its extension
+// when registered, or else of its content, and a reader of the whole content.
+func (r *Registry) DetectFile(name string, rc io.Reader) (string, io.Reader, error) {
+	if mediaType := r.TypeByExtension(name); mediaType != "" {
+		return mediaType, rc, nil
+	}
+
+	br, ok := rc.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(rc)
+	}
+	peekedBytes, err := br.Peek(sniffLimit)
+	if err != nil && err != io.EOF {
+		return "", nil, err
+	}
+
+	if r != nil {
+		for _, m := range r.magic {
+			if bytes.HasPrefix(peekedBytes, m.prefix) {
+				return m.mediaType, br, nil
+			}
+		}
+	}
+
+	return mimetype.Detect(peekedBytes).String(), br, nil
+}
+
+// TypeByExtension returns the registered media type of the extension of the
+// file named name, "" when it is not registered.
+func (r *Registry) TypeByExtension(name string) string {
+	if r == nil || name == "" {
+		return ""
+	}
+	return r.extensions[strings.ToLower(path.Ext(name))]
+}
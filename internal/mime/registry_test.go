@@ -0,0 +1,87 @@
+package mime
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name       string
+		mediaTypes []MediaType
+		wantErr    string
+	}{
+		{name: "empty"},
+		{
+			name:       "valid",
+			mediaTypes: []MediaType{{Extensions: []string{".ACD"}, Magic: []string{"4b 44 58"}, Type: "application/vnd.kdex.drawing"}},
+		},
+		{name: "invalid type", mediaTypes: []MediaType{{Extensions: []string{".acd"}, Type: "drawing"}}, wantErr: "invalid media type"},
+		{name: "nothing to detect", mediaTypes: []MediaType{{Type: "application/vnd.kdex.drawing"}}, wantErr: "neither extensions nor magic"},
+		{name: "invalid extension", mediaTypes: []MediaType{{Extensions: []string{"acd"}, Type: "application/vnd.kdex.drawing"}}, wantErr: "invalid extension"},
+		{name: "invalid magic", mediaTypes: []MediaType{{Magic: []string{"KDX"}, Type: "application/vnd.kdex.drawing"}}, wantErr: "invalid magic"},
+		{
+			name: "extension of two types",
+			mediaTypes: []MediaType{
+				{Extensions: []string{".acd"}, Type: "application/vnd.kdex.drawing"},
+				{Extensions: []string{".acd"}, Type: "application/vnd.kdex.model"},
+			},
+			wantErr: "is registered for media types",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.mediaTypes)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRegistry_DetectFile(t *testing.T) {
+	registry, err := NewRegistry([]MediaType{
+		{Extensions: []string{".acd"}, Magic: []string{"4b4458"}, Type: "application/vnd.kdex.drawing"},
+		// A zip archive the generic detection would report as application/zip
+		{Magic: []string{"504b0304", "504b03044b445a"}, Type: "application/vnd.kdex.bundle+zip"},
+		{Magic: []string{"504b030414"}, Type: "application/vnd.kdex.archive"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "by extension", file: "plan.ACD", content: "anything", want: "application/vnd.kdex.drawing"},
+		{name: "by magic", content: "KDX\x00\x01", want: "application/vnd.kdex.drawing"},
+		{name: "longest magic first", content: "PK\x03\x04KDZ", want: "application/vnd.kdex.bundle+zip"},
+		{name: "longer magic of another type", content: "PK\x03\x04\x14\x00", want: "application/vnd.kdex.archive"},
+		{name: "generic detection", file: "notes.txt", content: "hello world", want: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rc, err := registry.DetectFile(tt.file, strings.NewReader(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			content, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(content), "the whole content is still read")
+		})
+	}
+
+	var none *Registry
+	got, _, err := none.Detect(strings.NewReader(`{"foo":"bar"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", got)
+	assert.Empty(t, none.TypeByExtension("plan.acd"))
+}
@@ -0,0 +1,342 @@
+package openapi
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+)
+
+// Change is a difference between two versions of an API. Breaking changes
+// break the clients of the previous version.
+type Change struct {
+	Breaking bool   `json:"breaking"`
+	Message  string `json:"message"`
+	Target   string `json:"target"`
+}
+
+func (c Change) String() string {
+	return c.Target + ": " + c.Message
+}
+
+// direction is where a schema is used. Narrowing the schemas of requests and
+// widening the schemas of responses break clients.
+type direction int
+
+const (
+	request direction = 1 << iota
+	response
+)
+
+var methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+// Diff returns the changes from the previous to the next version of an API,
+// ordered by target. Refs are compared by name, the schemas they refer to
+// are compared as schemas of the API.
+func Diff(previous, next *OpenAPI) []Change {
+	changes := []Change{}
+
+	for _, p := range slices.Sorted(maps.Keys(previous.Paths)) {
+		nextItem, ok := next.Paths[p]
+		if !ok {
+			changes = append(changes, Change{Breaking: true, Message: "path removed", Target: p})
+			continue
+		}
+		changes = append(changes, diffPathItem(p, previous.Paths[p], nextItem)...)
+	}
+	for _, p := range slices.Sorted(maps.Keys(next.Paths)) {
+		if _, ok := previous.Paths[p]; !ok {
+			changes = append(changes, Change{Message: "path added", Target: p})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(previous.Schemas)) {
+		target := "#/components/schemas/" + name
+		nextSchema, ok := next.Schemas[name]
+		if !ok {
+			changes = append(changes, Change{Breaking: true, Message: "schema removed", Target: target})
+			continue
+		}
+		// Named schemas may be used by requests and responses alike.
+		changes = append(changes, diffSchema(target, previous.Schemas[name], nextSchema, request|response, 0)...)
+	}
+	for _, name := range slices.Sorted(maps.Keys(next.Schemas)) {
+		if _, ok := previous.Schemas[name]; !ok {
+			changes = append(changes, Change{Message: "schema added", Target: "#/components/schemas/" + name})
+		}
+	}
+
+	slices.SortStableFunc(changes, func(a, b Change) int {
+		return cmp.Compare(a.Target, b.Target)
+	})
+	return changes
+}
+
+// Breaking returns the breaking changes.
+func Breaking(changes []Change) []Change {
+	return slices.DeleteFunc(slices.Clone(changes), func(c Change) bool { return !c.Breaking })
+}
+
+func operations(item PathItem) map[string]*openapi.Operation {
+	ops := map[string]*openapi.Operation{}
+	for method, op := range map[string]*openapi.Operation{
+		"CONNECT": item.Connect, "DELETE": item.Delete, "GET": item.Get, "HEAD": item.Head, "OPTIONS": item.Options,
+		"PATCH": item.Patch, "POST": item.Post, "PUT": item.Put, "TRACE": item.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+func diffPathItem(p string, previous, next PathItem) []Change {
+	changes := []Change{}
+	previousOps, nextOps := operations(previous), operations(next)
+
+	for _, method := range methods {
+		target := method + " " + p
+		previousOp, wasOp := previousOps[method]
+		nextOp, isOp := nextOps[method]
+		switch {
+		case wasOp && !isOp:
+			changes = append(changes, Change{Breaking: true, Message: "operation removed", Target: target})
+		case !wasOp && isOp:
+			changes = append(changes, Change{Message: "operation added", Target: target})
+		case wasOp && isOp:
+			changes = append(changes, diffParameters(target, parameters(previous, previousOp), parameters(next, nextOp))...)
+			changes = append(changes, diffRequestBody(target, previousOp.RequestBody, nextOp.RequestBody)...)
+			changes = append(changes, diffResponses(target, previousOp.Responses, nextOp.Responses)...)
+		}
+	}
+	return changes
+}
+
+// parameters returns the parameters of the operation, including those of
+// its path, by location and name.
+func parameters(item PathItem, op *openapi.Operation) map[string]*openapi.Parameter {
+	params := map[string]*openapi.Parameter{}
+	for i := range item.Parameters {
+		params[item.Parameters[i].In+" "+item.Parameters[i].Name] = &item.Parameters[i]
+	}
+	for _, ref := range op.Parameters {
+		if ref != nil && ref.Value != nil {
+			params[ref.Value.In+" "+ref.Value.Name] = ref.Value
+		}
+	}
+	return params
+}
+
+func diffParameters(target string, previous, next map[string]*openapi.Parameter) []Change {
+	changes := []Change{}
+	for _, key := range slices.Sorted(maps.Keys(next)) {
+		param := next[key]
+		previousParam, ok := previous[key]
+		switch {
+		case !ok && param.Required:
+			changes = append(changes, Change{Breaking: true, Message: fmt.Sprintf("required %s parameter %s added", param.In, param.Name), Target: target})
+		case !ok:
+			changes = append(changes, Change{Message: fmt.Sprintf("%s parameter %s added", param.In, param.Name), Target: target})
+		default:
+			if param.Required && !previousParam.Required {
+				changes = append(changes, Change{Breaking: true, Message: fmt.Sprintf("%s parameter %s made required", param.In, param.Name), Target: target})
+			}
+			changes = append(changes, diffSchema(target+" "+param.In+" "+param.Name, previousParam.Schema, param.Schema, request, 0)...)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := next[key]; !ok {
+			changes = append(changes, Change{Message: fmt.Sprintf("%s parameter %s removed", previous[key].In, previous[key].Name), Target: target})
+		}
+	}
+	return changes
+}
+
+func diffRequestBody(target string, previous, next *openapi.RequestBodyRef) []Change {
+	if previous == nil || previous.Value == nil {
+		if next != nil && next.Value != nil && next.Value.Required {
+			return []Change{{Breaking: true, Message: "required request body added", Target: target}}
+		}
+		return nil
+	}
+	if next == nil || next.Value == nil {
+		return []Change{{Message: "request body removed", Target: target}}
+	}
+
+	changes := []Change{}
+	if next.Value.Required && !previous.Value.Required {
+		changes = append(changes, Change{Breaking: true, Message: "request body made required", Target: target})
+	}
+	changes = append(changes, diffContent(target+" request", previous.Value.Content, next.Value.Content, request)...)
+	return changes
+}
+
+func diffResponses(target string, previous, next *openapi.Responses) []Change {
+	changes := []Change{}
+	previousMap, nextMap := previous.Map(), next.Map()
+	for _, status := range slices.Sorted(maps.Keys(previousMap)) {
+		previousResponse := previousMap[status]
+		nextResponse, ok := nextMap[status]
+		if !ok || nextResponse == nil || nextResponse.Value == nil {
+			// Clients rely on the successful responses, not on the errors.
+			success := strings.HasPrefix(status, "2") || status == "default"
+			changes = append(changes, Change{Breaking: success, Message: fmt.Sprintf("response %s removed", status), Target: target})
+			continue
+		}
+		if previousResponse == nil || previousResponse.Value == nil {
+			continue
+		}
+		changes = append(changes, diffContent(target+" response "+status, previousResponse.Value.Content, nextResponse.Value.Content, response)...)
+	}
+	for _, status := range slices.Sorted(maps.Keys(nextMap)) {
+		if _, ok := previousMap[status]; !ok {
+			changes = append(changes, Change{Message: fmt.Sprintf("response %s added", status), Target: target})
+		}
+	}
+	return changes
+}
+
+func diffContent(target string, previous, next openapi.Content, dir direction) []Change {
+	changes := []Change{}
+	for _, mediaType := range slices.Sorted(maps.Keys(previous)) {
+		nextMedia, ok := next[mediaType]
+		if !ok {
+			changes = append(changes, Change{Breaking: true, Message: fmt.Sprintf("media type %s removed", mediaType), Target: target})
+			continue
+		}
+		if previous[mediaType] == nil || nextMedia == nil {
+			continue
+		}
+		changes = append(changes, diffSchema(target+" "+mediaType, previous[mediaType].Schema, nextMedia.Schema, dir, 0)...)
+	}
+	return changes
+}
+
+// diffSchema returns the breaking changes of a schema used in the direction.
+func diffSchema(target string, previous, next *openapi.SchemaRef, dir direction, depth int) []Change {
+	if previous == nil || next == nil || depth > maxExampleDepth {
+		return nil
+	}
+	if previous.Ref != "" || next.Ref != "" {
+		if previous.Ref != next.Ref {
+			return []Change{{Breaking: true, Message: fmt.Sprintf("schema changed from %q to %q", previous.Ref, next.Ref), Target: target}}
+		}
+		return nil
+	}
+	p, n := previous.Value, next.Value
+	if p == nil || n == nil {
+		return nil
+	}
+
+	changes := []Change{}
+	breaking := func(format string, args ...any) {
+		changes = append(changes, Change{Breaking: true, Message: fmt.Sprintf(format, args...), Target: target})
+	}
+
+	if p.Type != nil && !slices.Equal(p.Type.Slice(), n.Type.Slice()) {
+		for _, typ := range p.Type.Slice() {
+			if dir&request != 0 && !n.Type.Permits(typ) {
+				breaking("type %s no longer accepted", typ)
+			}
+		}
+		for _, typ := range n.Type.Slice() {
+			if dir&response != 0 && !p.Type.Includes(typ) {
+				breaking("type %s may be returned", typ)
+			}
+		}
+	}
+	if p.Format != n.Format && p.Format != "" {
+		breaking("format changed from %q to %q", p.Format, n.Format)
+	}
+
+	if dir&request != 0 {
+		if len(n.Enum) > 0 {
+			for _, v := range p.Enum {
+				if !containsValue(n.Enum, v) {
+					breaking("enum value %v removed", v)
+				}
+			}
+			if len(p.Enum) == 0 {
+				breaking("enum added")
+			}
+		}
+		if n.Pattern != "" && n.Pattern != p.Pattern {
+			breaking("pattern changed to %q", n.Pattern)
+		}
+		if n.MinLength > p.MinLength {
+			breaking("minLength raised to %d", n.MinLength)
+		}
+		if tighter(p.MaxLength, n.MaxLength) {
+			breaking("maxLength lowered to %d", *n.MaxLength)
+		}
+		if n.MinItems > p.MinItems {
+			breaking("minItems raised to %d", n.MinItems)
+		}
+		if tighter(p.MaxItems, n.MaxItems) {
+			breaking("maxItems lowered to %d", *n.MaxItems)
+		}
+		if n.Min != nil && (p.Min == nil || *n.Min > *p.Min) {
+			breaking("minimum raised to %v", *n.Min)
+		}
+		if n.Max != nil && (p.Max == nil || *n.Max < *p.Max) {
+			breaking("maximum lowered to %v", *n.Max)
+		}
+		for _, name := range n.Required {
+			if !slices.Contains(p.Required, name) {
+				breaking("property %s made required", name)
+			}
+		}
+	}
+	if dir&response != 0 {
+		if len(p.Enum) > 0 {
+			for _, v := range n.Enum {
+				if !containsValue(p.Enum, v) {
+					breaking("enum value %v added", v)
+				}
+			}
+			if len(n.Enum) == 0 {
+				breaking("enum removed")
+			}
+		}
+		for _, name := range p.Required {
+			if !slices.Contains(n.Required, name) {
+				breaking("property %s no longer required", name)
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(p.Properties)) {
+		nextProperty, ok := n.Properties[name]
+		if !ok {
+			breaking("property %s removed", name)
+			continue
+		}
+		changes = append(changes, diffSchema(target+"."+name, p.Properties[name], nextProperty, dir, depth+1)...)
+	}
+	changes = append(changes, diffSchema(target+"[]", p.Items, n.Items, dir, depth+1)...)
+
+	return changes
+}
+
+func containsValue(values []any, v any) bool {
+	return slices.ContainsFunc(values, func(candidate any) bool {
+		return reflect.DeepEqual(candidate, v)
+	})
+}
+
+func tighter(previous, next *uint64) bool {
+	return next != nil && (previous == nil || *next < *previous)
+}
+
+// Summary returns the changes separated by semicolons.
+func Summary(changes []Change) string {
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func userAPI() *OpenAPI {
+	user := openapi.NewObjectSchema().
+		WithProperty("name", openapi.NewStringSchema()).
+		WithProperty("role", openapi.NewStringSchema().WithEnum("admin", "member"))
+	user.Required = []string{"name"}
+
+	responses := openapi.NewResponses(openapi.WithStatus(200, &openapi.ResponseRef{
+		Value: openapi.NewResponse().WithJSONSchemaRef(openapi.NewSchemaRef("#/components/schemas/User", nil)),
+	}))
+
+	return &OpenAPI{
+		BasePath: "/v1/users",
+		Paths: map[string]PathItem{
+			"/v1/users/{id}": {
+				Get: &openapi.Operation{
+					Parameters: openapi.Parameters{PathParam("id", "")},
+					Responses:  responses,
+				},
+				Put: &openapi.Operation{
+					Parameters:  openapi.Parameters{PathParam("id", ""), QueryParam("dryRun", "")},
+					RequestBody: &openapi.RequestBodyRef{Value: openapi.NewRequestBody().WithJSONSchema(user)},
+					Responses:   responses,
+				},
+			},
+			"/v1/users/{id}/avatar": {
+				Get: &openapi.Operation{Responses: responses},
+			},
+		},
+		Schemas: map[string]*openapi.SchemaRef{"User": openapi.NewSchemaRef("", user)},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	assert.Empty(t, Diff(userAPI(), userAPI()))
+
+	next := userAPI()
+	delete(next.Paths, "/v1/users/{id}/avatar")
+	next.Paths["/v1/users"] = PathItem{Get: &openapi.Operation{}}
+	put := next.Paths["/v1/users/{id}"].Put
+	put.Parameters[1].Value.Required = true
+	body := put.RequestBody.Value.Content["application/json"].Schema.Value
+	body.Properties["name"].Value.WithMaxLength(10)
+	body.Required = []string{"name", "role"}
+	next.Schemas["User"].Value.Properties["role"].Value.Enum = []any{"admin", "member", "guest"}
+	next.Schemas["Group"] = openapi.NewSchemaRef("", openapi.NewObjectSchema())
+
+	// The request body and the component share the schema.
+	assert.Equal(t, []Change{
+		{Message: "schema added", Target: "#/components/schemas/Group"},
+		{Breaking: true, Message: "property role made required", Target: "#/components/schemas/User"},
+		{Breaking: true, Message: "maxLength lowered to 10", Target: "#/components/schemas/User.name"},
+		{Breaking: true, Message: "enum value guest added", Target: "#/components/schemas/User.role"},
+		{Message: "path added", Target: "/v1/users"},
+		{Breaking: true, Message: "path removed", Target: "/v1/users/{id}/avatar"},
+		{Breaking: true, Message: "query parameter dryRun made required", Target: "PUT /v1/users/{id}"},
+		{Breaking: true, Message: "property role made required", Target: "PUT /v1/users/{id} request application/json"},
+		{Breaking: true, Message: "maxLength lowered to 10", Target: "PUT /v1/users/{id} request application/json.name"},
+	}, Diff(userAPI(), next))
+}
+
+func TestDiff_Operations(t *testing.T) {
+	next := userAPI()
+	item := next.Paths["/v1/users/{id}"]
+	item.Put = nil
+	item.Delete = &openapi.Operation{}
+	item.Get.Responses = openapi.NewResponses(openapi.WithStatus(200, &openapi.ResponseRef{
+		Value: openapi.NewResponse().WithJSONSchemaRef(openapi.NewSchemaRef("#/components/schemas/Member", nil)),
+	}))
+	next.Paths["/v1/users/{id}"] = item
+
+	changes := Diff(userAPI(), next)
+	assert.Equal(t, []Change{
+		{Message: "operation added", Target: "DELETE /v1/users/{id}"},
+		{Breaking: true, Message: `schema changed from "#/components/schemas/User" to "#/components/schemas/Member"`, Target: "GET /v1/users/{id} response 200 application/json"},
+		{Breaking: true, Message: "operation removed", Target: "PUT /v1/users/{id}"},
+	}, changes)
+	assert.Len(t, Breaking(changes), 2)
+	assert.Contains(t, Summary(Breaking(changes)), "PUT /v1/users/{id}: operation removed")
+}
+
+func TestDiff_Widening(t *testing.T) {
+	previous := &OpenAPI{Schemas: map[string]*openapi.SchemaRef{
+		"Count": openapi.NewSchemaRef("", openapi.NewIntegerSchema().WithMin(0).WithMax(100)),
+	}}
+	next := &OpenAPI{Schemas: map[string]*openapi.SchemaRef{
+		"Count": openapi.NewSchemaRef("", openapi.NewIntegerSchema().WithMin(1).WithMax(1000)),
+	}}
+	assert.Equal(t, []Change{
+		{Breaking: true, Message: "minimum raised to 1", Target: "#/components/schemas/Count"},
+	}, Diff(previous, next))
+
+	next.Schemas["Count"].Value.Type = &openapi.Types{openapi.TypeString}
+	assert.Equal(t, []Change{
+		{Breaking: true, Message: "type integer no longer accepted", Target: "#/components/schemas/Count"},
+		{Breaking: true, Message: "type string may be returned", Target: "#/components/schemas/Count"},
+		{Breaking: true, Message: "minimum raised to 1", Target: "#/components/schemas/Count"},
+	}, Diff(previous, next))
+}
@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"maps"
+	"slices"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxExampleDepth bounds the generation of recursive schemas.
+const maxExampleDepth = 8
+
+// GenerateExample returns a value conforming to the schema. Examples,
+// defaults and enums declared by the schema are preferred, other values are
+// derived from the type and format. Refs must already be resolved.
+func GenerateExample(ref *openapi.SchemaRef) any {
+	return generateExample(ref, 0)
+}
+
+func generateExample(ref *openapi.SchemaRef, depth int) any {
+	if ref == nil || ref.Value == nil || depth > maxExampleDepth {
+		return nil
+	}
+	s := ref.Value
+
+	switch {
+	case s.Example != nil:
+		return s.Example
+	case s.Default != nil:
+		return s.Default
+	case len(s.Enum) > 0:
+		return s.Enum[0]
+	case len(s.AllOf) > 0:
+		merged := map[string]any{}
+		for _, sub := range s.AllOf {
+			if obj, ok := generateExample(sub, depth+1).(map[string]any); ok {
+				maps.Copy(merged, obj)
+			}
+		}
+		if s.Properties != nil {
+			maps.Copy(merged, generateProperties(s, depth))
+		}
+		return merged
+	case len(s.OneOf) > 0:
+		return generateExample(s.OneOf[0], depth+1)
+	case len(s.AnyOf) > 0:
+		return generateExample(s.AnyOf[0], depth+1)
+	}
+
+	switch {
+	case s.Type.Is(openapi.TypeArray):
+		if s.Items == nil {
+			return []any{}
+		}
+		return []any{generateExample(s.Items, depth+1)}
+	case s.Type.Is(openapi.TypeBoolean):
+		return true
+	case s.Type.Is(openapi.TypeInteger):
+		if s.Min != nil {
+			return int64(*s.Min)
+		}
+		return int64(0)
+	case s.Type.Is(openapi.TypeNumber):
+		if s.Min != nil {
+			return *s.Min
+		}
+		return float64(0)
+	case s.Type.Is(openapi.TypeString):
+		return exampleString(s.Format)
+	case s.Type.Is(openapi.TypeObject) || s.Properties != nil:
+		return generateProperties(s, depth)
+	}
+
+	return nil
+}
+
+func generateProperties(s *openapi.Schema, depth int) map[string]any {
+	obj := map[string]any{}
+	for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+		obj[name] = generateExample(s.Properties[name], depth+1)
+	}
+	return obj
+}
+
+func exampleString(format string) string {
+	switch format {
+	case "date":
+		return "1970-01-01"
+	case "date-time":
+		return "1970-01-01T00:00:00Z"
+	case "email":
+		return "user@example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "uri", "url":
+		return "https://example.com"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateExample(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema *openapi.Schema
+		want   any
+	}{
+		{
+			name:   "enum",
+			schema: openapi.NewStringSchema().WithEnum("a", "b"),
+			want:   "a",
+		},
+		{
+			name: "object",
+			schema: openapi.NewObjectSchema().
+				WithProperty("count", openapi.NewIntegerSchema().WithMin(3)).
+				WithProperty("created", openapi.NewDateTimeSchema()).
+				WithProperty("tags", openapi.NewArraySchema().WithItems(openapi.NewStringSchema())).
+				WithProperty("valid", openapi.NewBoolSchema()),
+			want: map[string]any{
+				"count":   int64(3),
+				"created": "1970-01-01T00:00:00Z",
+				"tags":    []any{"string"},
+				"valid":   true,
+			},
+		},
+		{
+			name: "all of",
+			schema: openapi.NewAllOfSchema(
+				openapi.NewObjectSchema().WithProperty("id", openapi.NewUUIDSchema()),
+				openapi.NewObjectSchema().WithProperty("score", openapi.NewFloat64Schema()),
+			),
+			want: map[string]any{
+				"id":    "00000000-0000-0000-0000-000000000000",
+				"score": float64(0),
+			},
+		},
+		{
+			name:   "one of",
+			schema: openapi.NewOneOfSchema(openapi.NewInt64Schema(), openapi.NewStringSchema()),
+			want:   int64(0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GenerateExample(tt.schema.NewRef()))
+		})
+	}
+
+	t.Run("example wins", func(t *testing.T) {
+		schema := openapi.NewObjectSchema().WithProperty("id", openapi.NewStringSchema())
+		schema.Example = map[string]any{"id": "abc"}
+		assert.Equal(t, map[string]any{"id": "abc"}, GenerateExample(schema.NewRef()))
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		node := openapi.NewObjectSchema()
+		node.WithProperty("name", openapi.NewStringSchema())
+		node.Properties["child"] = node.NewRef()
+		assert.NotPanics(t, func() { GenerateExample(node.NewRef()) })
+	})
+}
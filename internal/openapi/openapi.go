@@ -2,13 +2,16 @@ package openapi
 
 import (
 	"crypto/rand"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"maps"
 	"net/http"
 	"net/url"
 	"path"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	openapi "github.com/getkin/kin-openapi/openapi3"
@@ -23,6 +26,9 @@ const (
 	SystemPathType   PathType = "SYSTEM"
 )
 
+// Version is the version of the OpenAPI specification of the documents built.
+const Version = "3.0.0"
+
 var wildcardRegex = regexp.MustCompile(`\.\.\.\}`)
 
 type Builder struct {
@@ -74,7 +80,7 @@ func (b *Builder) buildOpenAPI(
 			Title:       fmt.Sprintf("KDex Host - %s", name),
 			Version:     "1.0.0",
 		},
-		OpenAPI: "3.0.0",
+		OpenAPI: Version,
 		Paths:   &openapi.Paths{},
 		Servers: openapi.Servers{
 			&openapi.Server{
@@ -622,6 +628,67 @@ func InferSchema(val any) *openapi.SchemaRef {
 	return schema.NewRef()
 }
 
+// InferXMLSchema parses an XML document and infers an object schema for its
+// root element. Element and attribute names are carried in the xml metadata
+// of the schema so the document round trips.
+func InferXMLSchema(r io.Reader) (*openapi.SchemaRef, error) {
+	decoder := xml.NewDecoder(r)
+
+	prefixes := map[string]string{}
+	var root *xmlNode
+	stack := []*xmlNode{}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					prefixes[attr.Value] = attr.Name.Local
+					continue
+				}
+				if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					continue
+				}
+				node.attrs = append(node.attrs, attr)
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element found in XML document")
+	}
+
+	schema := inferXMLNode(root, prefixes)
+	if schema.Value.XML == nil {
+		schema.Value.XML = &openapi.XML{}
+	}
+	schema.Value.XML.Name = root.name.Local
+
+	return schema, nil
+}
+
 func MergeOperations(dest, src *OpenAPI) {
 	for srcPath, srcItem := range src.Paths {
 		destItem, ok := dest.Paths[srcPath]
@@ -756,6 +823,30 @@ func (o *PathItem) SetOperation(method string, op *openapi.Operation) {
 	}
 }
 
+func (o *PathItem) GetOperation(method string) *openapi.Operation {
+	switch method {
+	case "CONNECT":
+		return o.Connect
+	case "DELETE":
+		return o.Delete
+	case "GET":
+		return o.Get
+	case "HEAD":
+		return o.Head
+	case "OPTIONS":
+		return o.Options
+	case "PATCH":
+		return o.Patch
+	case "POST":
+		return o.Post
+	case "PUT":
+		return o.Put
+	case "TRACE":
+		return o.Trace
+	}
+	return nil
+}
+
 type PathType string
 
 func QueryParam(name string, description string) *openapi.ParameterRef {
@@ -785,6 +876,86 @@ func WildcardPathParam(name string, description string) *openapi.ParameterRef {
 	}
 }
 
+type xmlNode struct {
+	attrs    []xml.Attr
+	children []*xmlNode
+	name     xml.Name
+	text     strings.Builder
+}
+
+func inferXMLNode(node *xmlNode, prefixes map[string]string) *openapi.SchemaRef {
+	text := strings.TrimSpace(node.text.String())
+
+	var schema *openapi.Schema
+	if len(node.attrs) == 0 && len(node.children) == 0 {
+		schema = inferXMLScalar(text)
+	} else {
+		schema = openapi.NewObjectSchema()
+
+		for _, attr := range node.attrs {
+			property := inferXMLScalar(attr.Value)
+			property.XML = &openapi.XML{
+				Attribute: true,
+				Namespace: attr.Name.Space,
+				Prefix:    prefixes[attr.Name.Space],
+			}
+			schema.Properties[attr.Name.Local] = property.NewRef()
+		}
+
+		counts := map[string]int{}
+		for _, child := range node.children {
+			counts[child.name.Local]++
+		}
+
+		for _, child := range node.children {
+			if _, ok := schema.Properties[child.name.Local]; ok {
+				continue
+			}
+
+			// Infer the type from the first occurrence
+			property := inferXMLNode(child, prefixes)
+			if counts[child.name.Local] > 1 {
+				if property.Value.XML == nil {
+					property.Value.XML = &openapi.XML{}
+				}
+				property.Value.XML.Name = child.name.Local
+
+				array := openapi.NewArraySchema()
+				array.Items = property
+				property = array.NewRef()
+			}
+			schema.Properties[child.name.Local] = property
+		}
+
+		if len(node.children) == 0 && text != "" {
+			schema.Properties["value"] = inferXMLScalar(text).NewRef()
+		}
+	}
+
+	if node.name.Space != "" {
+		if schema.XML == nil {
+			schema.XML = &openapi.XML{}
+		}
+		schema.XML.Namespace = node.name.Space
+		schema.XML.Prefix = prefixes[node.name.Space]
+	}
+
+	return schema.NewRef()
+}
+
+func inferXMLScalar(text string) *openapi.Schema {
+	if text == "true" || text == "false" {
+		return openapi.NewBoolSchema()
+	}
+	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return openapi.NewIntegerSchema()
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return openapi.NewFloat64Schema()
+	}
+	return openapi.NewStringSchema()
+}
+
 func matchFilter(routePath string, info PathInfo, filter Filter) bool {
 	if len(filter.Paths) > 0 && !slices.Contains(filter.Paths, routePath) {
 		return false
@@ -6,6 +6,7 @@ import (
 )
 
 type PageHandler struct {
+	Annotations       map[string]string
 	Content           map[string]PackedContent
 	Footer            string
 	Header            string
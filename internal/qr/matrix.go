@@ -0,0 +1,293 @@
+package qr
+
+// matrix is the modules of a code being drawn, and which of them belong to
+// the function patterns rather than to the codewords.
+type matrix struct {
+	function [][]bool
+	modules  [][]bool
+	version  int
+}
+
+func newMatrix(version int) *matrix {
+	size := 17 + 4*version
+	m := &matrix{
+		function: make([][]bool, size),
+		modules:  make([][]bool, size),
+		version:  version,
+	}
+	for i := range size {
+		m.function[i] = make([]bool, size)
+		m.modules[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *matrix) size() int {
+	return len(m.modules)
+}
+
+func (m *matrix) setFunction(row int, col int, dark bool) {
+	m.modules[row][col] = dark
+	m.function[row][col] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns, the
+// version information, and reserves the modules of the format information.
+func (m *matrix) drawFunctionPatterns() {
+	size := m.size()
+
+	for i := range size {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	m.drawFinder(3, 3)
+	m.drawFinder(3, size-4)
+	m.drawFinder(size-4, 3)
+
+	positions := alignmentPositions[m.version]
+	last := len(positions) - 1
+	for i, row := range positions {
+		for j, col := range positions {
+			// The corners of the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			m.drawAlignment(row, col)
+		}
+	}
+
+	m.drawFormatBits(0)
+	m.drawVersion()
+}
+
+// drawFinder draws the finder pattern centered on the module, with its
+// separator.
+func (m *matrix) drawFinder(row int, col int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			y, x := row+dy, col+dx
+			if y < 0 || y >= m.size() || x < 0 || x >= m.size() {
+				continue
+			}
+			distance := max(abs(dx), abs(dy))
+			m.setFunction(y, x, distance != 2 && distance != 4)
+		}
+	}
+}
+
+func (m *matrix) drawAlignment(row int, col int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.setFunction(row+dy, col+dx, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information of the medium
+// error correction level and the mask, and the dark module.
+func (m *matrix) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+	size := m.size()
+
+	for i := range 6 {
+		m.setFunction(i, 8, bit(i))
+	}
+	m.setFunction(7, 8, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(8, 14-i, bit(i))
+	}
+
+	for i := range 8 {
+		m.setFunction(8, size-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(size-15+i, 8, bit(i))
+	}
+	m.setFunction(size-8, 8, true)
+}
+
+// formatBits returns the 15 bits of the format information of the medium
+// error correction level, 00, and the mask.
+func formatBits(mask int) int {
+	data := mask
+	remainder := data
+	for range 10 {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	return (data<<10 | remainder) ^ 0x5412
+}
+
+// drawVersion draws both copies of the version information of the versions
+// from 7.
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+
+	bits := versionBits(m.version)
+	for i := range 18 {
+		dark := (bits>>i)&1 == 1
+		a, b := m.size()-11+i%3, i/3
+		m.setFunction(b, a, dark)
+		m.setFunction(a, b, dark)
+	}
+}
+
+// versionBits returns the 18 bits of the version information.
+func versionBits(version int) int {
+	remainder := version
+	for range 12 {
+		remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+	}
+	return version<<12 | remainder
+}
+
+// drawCodewords draws the bits of the codewords in the zigzag of pairs of
+// columns, from the bottom right, around the function patterns.
+func (m *matrix) drawCodewords(codewords []byte) {
+	size := m.size()
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range size {
+			for j := range 2 {
+				col := right - j
+				upward := (right+1)&2 == 0
+				row := vert
+				if upward {
+					row = size - 1 - vert
+				}
+				if m.function[row][col] || i >= 8*len(codewords) {
+					continue
+				}
+				m.modules[row][col] = (codewords[i/8]>>(7-i%8))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the modules of the codewords selected by the mask,
+// undoing a previous application of the same mask.
+func (m *matrix) applyMask(mask int) {
+	for row := range m.size() {
+		for col := range m.size() {
+			if !m.function[row][col] && masked(mask, row, col) {
+				m.modules[row][col] = !m.modules[row][col]
+			}
+		}
+	}
+}
+
+func masked(mask int, row int, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// penalty scores the masked modules by the four rules of the standard, the
+// lowest scoring mask being the easiest to read.
+func (m *matrix) penalty() int {
+	size := m.size()
+	at := func(transpose bool) func(int, int) bool {
+		if transpose {
+			return func(i int, j int) bool { return m.modules[j][i] }
+		}
+		return func(i int, j int) bool { return m.modules[i][j] }
+	}
+
+	penalty := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		module := at(transpose)
+		for i := range size {
+			// Runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= size; j++ {
+				if j < size && module(i, j) == module(i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// Finder like patterns with four light modules on a side
+			for j := 0; j+len(finderLike) <= size; j++ {
+				matches := true
+				for k, dark := range finderLike {
+					if module(i, j+k) != dark {
+						matches = false
+						break
+					}
+				}
+				if matches && (lightRun(module, size, i, j-4, j) || lightRun(module, size, i, j+7, j+11)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for row := range size {
+		for col := range size {
+			if m.modules[row][col] {
+				dark++
+			}
+			// Blocks of 2x2 modules of the same color
+			if row > 0 && col > 0 {
+				c := m.modules[row][col]
+				if c == m.modules[row-1][col] && c == m.modules[row][col-1] && c == m.modules[row-1][col-1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Imbalance of the dark and light modules
+	percent := dark * 100 / (size * size)
+	penalty += abs(percent-50) / 5 * 10
+
+	return penalty
+}
+
+// lightRun reports whether the modules from to until of the line are light,
+// those beyond the code counting as light.
+func lightRun(module func(int, int) bool, size int, line int, from int, until int) bool {
+	for j := max(from, 0); j < min(until, size); j++ {
+		if module(line, j) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,246 @@
+// Package qr encodes short texts, e.g. the otpauth URIs enrolled by the
+// authenticator apps, as QR codes (ISO/IEC 18004) rendered in SVG.
+package qr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxVersion is the largest version encoded, 57x57 modules, holding 213 bytes
+// at the medium error correction level.
+const maxVersion = 10
+
+// quietZone is the width, in modules, of the light border around the code.
+const quietZone = 4
+
+// blocks describes the error correction of a version at the medium level: the
+// error correction codewords of each block and the data codewords of the
+// blocks of its two groups.
+type blocks struct {
+	ecc    int
+	group1 [2]int
+	group2 [2]int
+}
+
+var mediumBlocks = [maxVersion + 1]blocks{
+	1:  {ecc: 10, group1: [2]int{1, 16}},
+	2:  {ecc: 16, group1: [2]int{1, 28}},
+	3:  {ecc: 26, group1: [2]int{1, 44}},
+	4:  {ecc: 18, group1: [2]int{2, 32}},
+	5:  {ecc: 24, group1: [2]int{2, 43}},
+	6:  {ecc: 16, group1: [2]int{4, 27}},
+	7:  {ecc: 18, group1: [2]int{4, 31}},
+	8:  {ecc: 22, group1: [2]int{2, 38}, group2: [2]int{2, 39}},
+	9:  {ecc: 22, group1: [2]int{3, 36}, group2: [2]int{2, 37}},
+	10: {ecc: 26, group1: [2]int{4, 43}, group2: [2]int{1, 44}},
+}
+
+var alignmentPositions = [maxVersion + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+func (b blocks) dataCodewords() int {
+	return b.group1[0]*b.group1[1] + b.group2[0]*b.group2[1]
+}
+
+// Code is a QR code, its modules by row then column, true for the dark ones.
+type Code struct {
+	Modules [][]bool
+	Version int
+}
+
+// Size returns the number of modules of a side of the code.
+func (c *Code) Size() int {
+	return len(c.Modules)
+}
+
+// Encode returns the QR code of the text in byte mode, at the medium error
+// correction level, of the smallest version holding it.
+func Encode(text string) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+countBits(v)+8*len(text) <= 8*mediumBlocks[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("text of %d bytes is too long for a QR code of version %d", len(text), maxVersion)
+	}
+
+	m := newMatrix(version)
+	m.drawFunctionPatterns()
+	m.drawCodewords(interleave(version, dataCodewords(version, []byte(text))))
+
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask)
+	}
+	m.applyMask(best)
+	m.drawFormatBits(best)
+
+	return &Code{Modules: m.modules, Version: version}, nil
+}
+
+// SVG returns the SVG image of the code, scale pixels per module, with its
+// quiet zone.
+func (c *Code) SVG(scale int) string {
+	side := c.Size() + 2*quietZone
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, side*scale, side*scale, side, side)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, side, side)
+	for y, row := range c.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+
+	return b.String()
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// dataCodewords returns the data codewords of the text: the byte mode
+// indicator, the length, the bytes, the terminator and the padding.
+func dataCodewords(version int, text []byte) []byte {
+	capacity := 8 * mediumBlocks[version].dataCodewords()
+
+	bits := &bitBuffer{}
+	bits.append(0b0100, 4)
+	bits.append(len(text), countBits(version))
+	for _, c := range text {
+		bits.append(int(c), 8)
+	}
+	bits.append(0, min(4, capacity-bits.len()))
+	bits.append(0, (8-bits.len()%8)%8)
+	for pad := 0xEC; bits.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	return bits.bytes()
+}
+
+// interleave returns the final sequence of the codewords: the data codewords
+// of the blocks, then their error correction codewords, interleaved.
+func interleave(version int, data []byte) []byte {
+	b := mediumBlocks[version]
+	divisor := reedSolomonDivisor(b.ecc)
+
+	var dataBlocks, eccBlocks [][]byte
+	for _, group := range [][2]int{b.group1, b.group2} {
+		for range group[0] {
+			block := data[:group[1]]
+			data = data[group[1]:]
+			dataBlocks = append(dataBlocks, block)
+			eccBlocks = append(eccBlocks, reedSolomonRemainder(block, divisor))
+		}
+	}
+
+	result := []byte{}
+	for i := range b.group1[1] + min(b.group2[0], 1) {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := range b.ecc {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+type bitBuffer struct {
+	bits []bool
+}
+
+func (b *bitBuffer) append(value int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, (value>>i)&1 == 1)
+	}
+}
+
+func (b *bitBuffer) len() int {
+	return len(b.bits)
+}
+
+func (b *bitBuffer) bytes() []byte {
+	result := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			result[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return result
+}
+
+// reedSolomonDivisor returns the generator polynomial of the degree, its
+// coefficients from the highest power down, the leading 1 omitted.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords of the data.
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply returns the product of x and y in GF(2^8) modulo
+// x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
@@ -0,0 +1,172 @@
+package qr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// The codewords of HELLO WORLD in version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	assert.Equal(t, 0b101010000010010, formatBits(0))
+	assert.Equal(t, 0b101101101001011, formatBits(3))
+	assert.Equal(t, 0b000111110010010100, versionBits(7))
+	assert.Equal(t, 0b001010010011010011, versionBits(10))
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		version int
+		wantErr bool
+	}{
+		{name: "short", text: "kdex", version: 1},
+		{name: "remainder bits", text: strings.Repeat("k", 50), version: 4},
+		{name: "version information", text: strings.Repeat("k", 110), version: 7},
+		{
+			name:    "otpauth uri",
+			text:    "otpauth://totp/Shop:alice%40example.com?algorithm=SHA1&digits=6&issuer=Shop&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+			version: 8,
+		},
+		{name: "longest", text: strings.Repeat("x", 213), version: 10},
+		{name: "too long", text: strings.Repeat("x", 214), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.text)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, code.Version)
+			assert.Equal(t, 17+4*tt.version, code.Size())
+			assert.Equal(t, tt.text, readBack(t, code))
+		})
+	}
+}
+
+func TestCode_SVG(t *testing.T) {
+	code, err := Encode("kdex")
+	require.NoError(t, err)
+
+	svg := code.SVG(4)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="116" height="116" viewBox="0 0 29 29"`))
+	// The top left module of the finder pattern, past the quiet zone
+	assert.Contains(t, svg, "M4,4h1v1h-1z")
+	assert.True(t, strings.HasSuffix(svg, `"/></svg>`))
+}
+
+// readBack reads the text of the code: the mask of its format information,
+// the codewords of its unmasked modules, and the bytes of their data.
+func readBack(t *testing.T, code *Code) string {
+	t.Helper()
+
+	m := newMatrix(code.Version)
+	m.drawFunctionPatterns()
+
+	format := 0
+	for i := range 6 {
+		format |= bitOf(code.Modules[i][8]) << i
+	}
+	format |= bitOf(code.Modules[7][8])<<6 | bitOf(code.Modules[8][8])<<7 | bitOf(code.Modules[8][7])<<8
+	for i := 9; i < 15; i++ {
+		format |= bitOf(code.Modules[8][14-i]) << i
+	}
+	mask := -1
+	for candidate := range 8 {
+		if formatBits(candidate) == format {
+			mask = candidate
+		}
+	}
+	require.GreaterOrEqual(t, mask, 0, "format information of the medium level")
+
+	size := code.Size()
+	bits := &bitBuffer{}
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range size {
+			for j := range 2 {
+				col := right - j
+				row := vert
+				if (right+1)&2 == 0 {
+					row = size - 1 - vert
+				}
+				if !m.function[row][col] {
+					bits.bits = append(bits.bits, code.Modules[row][col] != masked(mask, row, col))
+				}
+			}
+		}
+	}
+	codewords := bits.bytes()
+
+	// Deinterleave the data codewords of the blocks
+	b := mediumBlocks[code.Version]
+	var blockLengths []int
+	for _, group := range [][2]int{b.group1, b.group2} {
+		for range group[0] {
+			blockLengths = append(blockLengths, group[1])
+		}
+	}
+	remainderBits := 0
+	if code.Version >= 2 && code.Version <= 6 {
+		remainderBits = 7
+	}
+	require.Len(t, bits.bits, 8*(b.dataCodewords()+b.ecc*len(blockLengths))+remainderBits, "modules of the codewords")
+	dataBlocks := make([][]byte, len(blockLengths))
+	i := 0
+	for k := range b.group1[1] + 1 {
+		for block, length := range blockLengths {
+			if k < length {
+				dataBlocks[block] = append(dataBlocks[block], codewords[i])
+				i++
+			}
+		}
+	}
+	var data []byte
+	for block, d := range dataBlocks {
+		ecc := codewords[b.dataCodewords()+block:]
+		for k := range b.ecc {
+			assert.Equal(t, reedSolomonRemainder(d, reedSolomonDivisor(b.ecc))[k], ecc[k*len(dataBlocks)], "error correction codeword %d of block %d", k, block)
+		}
+		data = append(data, d...)
+	}
+
+	require.Equal(t, byte(0b0100), data[0]>>4, "byte mode")
+	stream := &bitBuffer{}
+	for _, c := range data {
+		stream.append(int(c), 8)
+	}
+	read := func(from int, n int) int {
+		value := 0
+		for _, bit := range stream.bits[from : from+n] {
+			value = value<<1 | bitOf(bit)
+		}
+		return value
+	}
+	length := read(4, countBits(code.Version))
+	text := make([]byte, length)
+	for k := range text {
+		text[k] = byte(read(4+countBits(code.Version)+8*k, 8))
+	}
+	return string(text)
+}
+
+func bitOf(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
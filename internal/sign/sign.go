@@ -15,6 +15,7 @@ import (
 
 type Signer struct {
 	audience   string
+	audiences  []string
 	duration   time.Duration
 	issuer     string
 	privateKey *crypto.Signer
@@ -56,19 +57,35 @@ func NewSigner(
 	}, nil
 }
 
+// AddAudiences adds, to the audience of the signer, audiences of the tokens
+// signed without an aud claim: those of the other hosts sharing the sessions
+// of the host.
+func (s *Signer) AddAudiences(audiences ...string) {
+	s.audiences = append(s.audiences, audiences...)
+}
+
 // Sign creates a signed JWT derived from the inbound claims.
 func (s *Signer) Sign(signingContext jwt.MapClaims) (string, error) {
+	return s.SignFor(signingContext, s.duration)
+}
+
+// Audience returns the audience of the signer, that of the host.
+func (s *Signer) Audience() string {
+	return s.audience
+}
+
+// SignFor creates a signed JWT derived from the inbound claims, expiring after
+// duration instead of the duration of the signer.
+func (s *Signer) SignFor(signingContext jwt.MapClaims, duration time.Duration) (string, error) {
 	sub, err := signingContext.GetSubject()
 	if err != nil {
 		return "", fmt.Errorf("failed to get subject from claims: %w", err)
 	}
 
 	aud, err := signingContext.GetAudience()
-	if err != nil {
+	if err != nil || len(aud) == 0 {
 		// If aud is not a string array or string, or not present, we use default
-		aud = []string{s.audience}
-	} else if len(aud) == 0 {
-		aud = []string{s.audience}
+		aud = append([]string{s.audience}, s.audiences...)
 	}
 
 	outboundClaims := jwt.MapClaims{
@@ -76,13 +93,21 @@ func (s *Signer) Sign(signingContext jwt.MapClaims) (string, error) {
 		"sub": sub,
 		"iss": s.issuer,
 		"aud": aud,
-		"exp": time.Now().Add(s.duration).Unix(),
+		"exp": time.Now().Add(duration).Unix(),
 		"iat": time.Now().Unix(),
 		"jti": rand.Text(),
 	}
 
 	// custom claims
 
+	if act, ok := signingContext["act"]; ok {
+		outboundClaims["act"] = act
+	}
+
+	if amr, ok := signingContext["amr"]; ok {
+		outboundClaims["amr"] = amr
+	}
+
 	if email, ok := signingContext["email"]; ok {
 		outboundClaims["email"] = email
 	}
@@ -140,10 +165,16 @@ func (s *Signer) Sign(signingContext jwt.MapClaims) (string, error) {
 		maps.Copy(outboundClaims, extra)
 	}
 
+	return SignClaims(*s.privateKey, s.kid, outboundClaims)
+}
+
+// SignClaims creates a JWT of the claims signed by the private key, whose
+// type decides the signing algorithm.
+func SignClaims(privateKey crypto.Signer, kid string, claims jwt.MapClaims) (string, error) {
 	var method jwt.SigningMethod
 
 	// Check the public key type to decide the signing algorithm
-	switch (*s.privateKey).Public().(type) {
+	switch privateKey.Public().(type) {
 	case *rsa.PublicKey:
 		method = jwt.SigningMethodRS256
 	case *ecdsa.PublicKey:
@@ -152,9 +183,9 @@ func (s *Signer) Sign(signingContext jwt.MapClaims) (string, error) {
 		return "", fmt.Errorf("unsupported signer type")
 	}
 
-	token := jwt.NewWithClaims(method, outboundClaims)
+	token := jwt.NewWithClaims(method, claims)
 	token.Header["alg"] = method.Alg()
-	token.Header["kid"] = s.kid
+	token.Header["kid"] = kid
 	token.Header["typ"] = "JWT"
-	return token.SignedString(*s.privateKey)
+	return token.SignedString(privateKey)
 }
@@ -5,10 +5,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/kdex-tech/dmapper"
 	"github.com/kdex-tech/host-manager/internal/keys"
 	"github.com/kdex-tech/host-manager/internal/sign"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewSigner(t *testing.T) {
@@ -115,3 +117,24 @@ L51w6mkJ5U6GWpH1eZsXgKm0ZZJKEPsN9wYKe2LXT/WPpa5AwGzo7BLm
 		})
 	}
 }
+
+func TestSigner_AddAudiences(t *testing.T) {
+	kp := keys.GenerateECDSAKeyPair().ActiveKey()
+	s, err := sign.NewSigner("https://shop.example.com", time.Hour, "https://shop.example.com", &kp.Private, kp.KeyId, nil)
+	require.NoError(t, err)
+	s.AddAudiences("https://support.example.com")
+
+	audience := func(signingContext jwt.MapClaims) jwt.ClaimStrings {
+		token, err := s.Sign(signingContext)
+		require.NoError(t, err)
+		claims := jwt.MapClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+		require.NoError(t, err)
+		aud, err := claims.GetAudience()
+		require.NoError(t, err)
+		return aud
+	}
+
+	assert.Equal(t, jwt.ClaimStrings{"https://shop.example.com", "https://support.example.com"}, audience(jwt.MapClaims{"sub": "jane"}))
+	assert.Equal(t, jwt.ClaimStrings{"https://api.example.com"}, audience(jwt.MapClaims{"aud": "https://api.example.com", "sub": "jane"}))
+}
@@ -0,0 +1,170 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+)
+
+// SchemaConflictStrategy decides what happens when a sniffed schema differs
+// from the schema of the same name already held by the function.
+type SchemaConflictStrategy string
+
+const (
+	// SchemaConflictFail rejects the analysis.
+	SchemaConflictFail SchemaConflictStrategy = "fail"
+	// SchemaConflictKeep keeps the existing schema and stores the new one
+	// under a key with a ":conflict:" suffix.
+	SchemaConflictKeep SchemaConflictStrategy = "keep"
+	// SchemaConflictMerge deep merges compatible schemas. Incompatible
+	// schemas are kept as with SchemaConflictKeep.
+	SchemaConflictMerge SchemaConflictStrategy = "merge"
+	// SchemaConflictPreferExisting discards the new schema.
+	SchemaConflictPreferExisting SchemaConflictStrategy = "prefer-existing"
+	// SchemaConflictPreferNewest replaces the existing schema.
+	SchemaConflictPreferNewest SchemaConflictStrategy = "prefer-newest"
+)
+
+var schemaConflictStrategies = []SchemaConflictStrategy{
+	SchemaConflictFail,
+	SchemaConflictKeep,
+	SchemaConflictMerge,
+	SchemaConflictPreferExisting,
+	SchemaConflictPreferNewest,
+}
+
+// ParseSchemaConflictStrategy validates a strategy name. The empty string
+// yields SchemaConflictPreferNewest.
+func ParseSchemaConflictStrategy(value string) (SchemaConflictStrategy, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return SchemaConflictPreferNewest, nil
+	}
+
+	strategy := SchemaConflictStrategy(value)
+	if !slices.Contains(schemaConflictStrategies, strategy) {
+		return "", fmt.Errorf("unknown schema conflict strategy %q, must be one of %v", value, schemaConflictStrategies)
+	}
+
+	return strategy, nil
+}
+
+// SchemaConflictError is returned when the fail strategy meets conflicting
+// schemas.
+type SchemaConflictError struct {
+	Schemas []string
+}
+
+func (e *SchemaConflictError) Error() string {
+	return fmt.Sprintf(
+		"conflicting schemas %s: set X-KDex-Function-Schema-Conflict-Strategy to resolve them",
+		strings.Join(e.Schemas, ", "),
+	)
+}
+
+// schemaConflictStrategy returns the strategy requested by the request,
+// falling back to the one configured on the sniffer.
+func (s *RequestSniffer) schemaConflictStrategy(r *http.Request) (SchemaConflictStrategy, error) {
+	if header := r.Header.Get("X-KDex-Function-Schema-Conflict-Strategy"); header != "" {
+		return ParseSchemaConflictStrategy(header)
+	}
+
+	// Deprecated in favor of X-KDex-Function-Schema-Conflict-Strategy: keep
+	if r.Header.Get("X-KDex-Function-Keep-Schema-Conflict") == TRUE {
+		return SchemaConflictKeep, nil
+	}
+
+	return ParseSchemaConflictStrategy(string(s.SchemaConflictStrategy))
+}
+
+func schemasEqual(a, b *openapi.SchemaRef) bool {
+	aBytes, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
+
+// mergeSchemas deep merges two observations of a schema into one that
+// accepts both. Observations are compatible when their types agree, where
+// integer widens to number. Properties seen in only one observation become
+// optional.
+func mergeSchemas(existing, incoming *openapi.SchemaRef) (*openapi.SchemaRef, bool) {
+	if existing == nil {
+		return incoming, true
+	}
+	if incoming == nil {
+		return existing, true
+	}
+	if existing.Ref != "" || incoming.Ref != "" {
+		return existing, existing.Ref == incoming.Ref
+	}
+	if existing.Value == nil {
+		return incoming, true
+	}
+	if incoming.Value == nil {
+		return existing, true
+	}
+
+	a, b := existing.Value, incoming.Value
+	merged := *a
+
+	switch {
+	case a.Type == nil:
+		merged.Type = b.Type
+	case b.Type == nil, slices.Equal(*a.Type, *b.Type):
+	case isNumeric(a.Type) && isNumeric(b.Type):
+		merged.Type = &openapi.Types{openapi.TypeNumber}
+	default:
+		return nil, false
+	}
+
+	if merged.Format == "" {
+		merged.Format = b.Format
+	}
+	merged.Nullable = a.Nullable || b.Nullable
+
+	if a.Items != nil || b.Items != nil {
+		items, ok := mergeSchemas(a.Items, b.Items)
+		if !ok {
+			return nil, false
+		}
+		merged.Items = items
+	}
+
+	if len(a.Properties) > 0 || len(b.Properties) > 0 {
+		merged.Properties = openapi.Schemas{}
+		for name, property := range a.Properties {
+			merged.Properties[name] = property
+		}
+		for name, property := range b.Properties {
+			mergedProperty, ok := mergeSchemas(merged.Properties[name], property)
+			if !ok {
+				return nil, false
+			}
+			merged.Properties[name] = mergedProperty
+		}
+
+		merged.Required = nil
+		for _, name := range a.Required {
+			if slices.Contains(b.Required, name) {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+	}
+
+	return merged.NewRef(), true
+}
+
+func isNumeric(types *openapi.Types) bool {
+	return len(*types) == 1 && (types.Is(openapi.TypeInteger) || types.Is(openapi.TypeNumber))
+}
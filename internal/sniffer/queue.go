@@ -0,0 +1,144 @@
+package sniffer
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	DefaultWriteWindow = 2 * time.Second
+
+	writeTimeout = 10 * time.Second
+)
+
+// WriteQueue writes sniffed functions outside of the request path. The
+// observations of a function made within the window are coalesced into a
+// single CreateOrUpdate of the latest one. Failed writes are retried with
+// backoff until a newer observation replaces them.
+type WriteQueue struct {
+	client   client.Client
+	hostName string
+	log      logr.Logger
+	mu       sync.Mutex
+	pending  map[types.NamespacedName]*kdexv1alpha1.KDexFunction
+	queue    workqueue.TypedRateLimitingInterface[types.NamespacedName]
+	window   time.Duration
+}
+
+// NewWriteQueue creates a queue and starts its worker.
+func NewWriteQueue(c client.Client, hostName string, window time.Duration, log logr.Logger) *WriteQueue {
+	wq := &WriteQueue{
+		client:   c,
+		hostName: hostName,
+		log:      log,
+		pending:  map[types.NamespacedName]*kdexv1alpha1.KDexFunction{},
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[types.NamespacedName](),
+			workqueue.TypedRateLimitingQueueConfig[types.NamespacedName]{Name: "sniffer"},
+		),
+		window: window,
+	}
+
+	go wq.run()
+
+	return wq
+}
+
+// Add schedules the write of the function. It replaces any pending
+// observation of the same function.
+func (wq *WriteQueue) Add(fn *kdexv1alpha1.KDexFunction) {
+	key := client.ObjectKeyFromObject(fn)
+
+	wq.mu.Lock()
+	wq.pending[key] = fn.DeepCopy()
+	wq.mu.Unlock()
+
+	// The delaying queue keeps the earliest deadline of a key so the window
+	// starts with the first observation.
+	wq.queue.AddAfter(key, wq.window)
+}
+
+// Pending returns the observations which have not been written yet.
+func (wq *WriteQueue) Pending() []kdexv1alpha1.KDexFunction {
+	wq.mu.Lock()
+	defer wq.mu.Unlock()
+
+	pending := make([]kdexv1alpha1.KDexFunction, 0, len(wq.pending))
+	for _, fn := range wq.pending {
+		pending = append(pending, *fn.DeepCopy())
+	}
+	return pending
+}
+
+func (wq *WriteQueue) run() {
+	for wq.processNext() {
+	}
+}
+
+func (wq *WriteQueue) processNext() bool {
+	key, shutdown := wq.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer wq.queue.Done(key)
+
+	wq.mu.Lock()
+	fn, ok := wq.pending[key]
+	wq.mu.Unlock()
+	if !ok {
+		wq.queue.Forget(key)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	op, err := writeFunction(ctx, wq.client, wq.hostName, fn)
+	if err != nil {
+		wq.log.Error(err, "failed to write sniffed function, retrying", "function", key)
+		wq.queue.AddRateLimited(key)
+		return true
+	}
+
+	wq.log.V(2).Info("wrote sniffed function", "function", key, "op", op)
+
+	wq.mu.Lock()
+	// A newer observation arrived while writing, it is already queued.
+	if wq.pending[key] == fn {
+		delete(wq.pending, key)
+	}
+	wq.mu.Unlock()
+
+	wq.queue.Forget(key)
+	return true
+}
+
+// functions returns the known functions with the pending observations
+// applied so that consecutive observations build on each other before they
+// are written.
+func (s *RequestSniffer) functions() []kdexv1alpha1.KDexFunction {
+	if s.Queue == nil {
+		return s.Functions
+	}
+
+	functions := slices.Clone(s.Functions)
+	for _, fn := range s.Queue.Pending() {
+		idx := slices.IndexFunc(functions, func(f kdexv1alpha1.KDexFunction) bool {
+			return f.Name == fn.Name && f.Namespace == fn.Namespace
+		})
+		if idx == -1 {
+			functions = append(functions, fn)
+			continue
+		}
+		functions[idx].Spec = fn.Spec
+	}
+	return functions
+}
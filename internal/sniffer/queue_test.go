@@ -0,0 +1,66 @@
+package sniffer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestWriteQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	var writes atomic.Int32
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			writes.Add(1)
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			writes.Add(1)
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+
+	wq := NewWriteQueue(c, "host", 50*time.Millisecond, logr.Discard())
+
+	fn := func(basePath string) *kdexv1alpha1.KDexFunction {
+		return &kdexv1alpha1.KDexFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "foo"},
+			Spec: kdexv1alpha1.KDexFunctionSpec{
+				API: kdexv1alpha1.API{BasePath: basePath},
+			},
+		}
+	}
+
+	wq.Add(fn("/v1/users"))
+	wq.Add(fn("/v2/users"))
+	wq.Add(fn("/v3/users"))
+
+	s := &RequestSniffer{Queue: wq}
+	functions := s.functions()
+	require.Len(t, functions, 1)
+	assert.Equal(t, "/v3/users", functions[0].Spec.API.BasePath, "pending observations are visible to the sniffer")
+
+	written := &kdexv1alpha1.KDexFunction{}
+	require.Eventually(t, func() bool {
+		return c.Get(context.Background(), client.ObjectKey{Name: "users", Namespace: "foo"}, written) == nil &&
+			len(wq.Pending()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int32(1), writes.Load(), "observations are coalesced")
+	assert.Equal(t, "/v3/users", written.Spec.API.BasePath)
+	assert.Equal(t, "host", written.Spec.HostRef.Name)
+	assert.Equal(t, "host", written.Labels["kdex.dev/instance"])
+}
@@ -8,10 +8,11 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gabriel-vasile/mimetype"
 	openapi "github.com/getkin/kin-openapi/openapi3"
 	kh "github.com/kdex-tech/host-manager/internal/http"
 	"github.com/kdex-tech/host-manager/internal/mime"
@@ -22,6 +23,7 @@ import (
 	"kdex.dev/crds/linter"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -43,7 +45,7 @@ The KDex Request Sniffer automatically generates or updates KDexFunction resourc
 - **X-KDex-Function-Comprehensive-Mode**: Set to "true" to enable Comprehensive API Modelling. This automatically generates a full suite of CRUD operations (GET, POST, PUT, PATCH, DELETE) for both collection and resource paths based on the pattern path.
 - **X-KDex-Function-Deprecated**: Set to "true" to mark the operation as deprecated.
 - **X-KDex-Function-Description**: Sets the OpenAPI operation description.
-- **X-KDex-Function-Keep-Schema-Conflict**: Tells OpenAPI to keep conflicting under a special no-conflict key. Diagnostic feature.
+- **X-KDex-Function-Keep-Schema-Conflict**: Deprecated, same as "X-KDex-Function-Schema-Conflict-Strategy: keep".
 - **X-KDex-Function-Name**: Specifies the name for the generated KDexFunction CR (standard Kubernetes naming rules apply).
 - **X-KDex-Function-Operation-ID**: Sets a specific operationId in OpenAPI.
 - **X-KDex-Function-Overwrite-Operation**: Set to "true" to overwrite an operation which is an exact match. Normally this would be rejected for satefy.
@@ -51,8 +53,15 @@ The KDex Request Sniffer automatically generates or updates KDexFunction resourc
   - Must start with "/"
   - Must NOT contain a method (e.g. use "/users/{id}" not "GET /users/{id}")
   - Variables are supported: "{name}", "{path...}"
+- **X-KDex-Function-Proto-Descriptor**: A reference (e.g. a URL) to a protobuf descriptor set describing the messages of a protobuf or gRPC-web operation. It is attached to the operation as the "x-kdex-proto-descriptor" extension.
 - **X-KDex-Function-Request-Schema-Ref**: Sets the OpenAPI operation request body schema reference. (e.g. "Foo", "#/components/schemas/Foo" or a URL to an external schema)
 - **X-KDex-Function-Response-Schema-Ref**: Sets the OpenAPI operation response schema reference. (e.g. "Foo", "#/components/schemas/Foo" or a URL to an external schema)
+- **X-KDex-Function-Schema-Conflict-Strategy**: Decides what happens when an inferred schema differs from the existing schema of the same name. Defaults to the host manager's "--sniffer-schema-conflict-strategy" (itself "prefer-newest"). Identical schemas never conflict.
+  - "prefer-newest": replace the existing schema
+  - "prefer-existing": discard the inferred schema
+  - "merge": deep merge the schemas when their types agree (integer widens to number, properties seen in only one become optional), otherwise behave like "keep"
+  - "keep": keep the existing schema and store the inferred one under a "<name>:conflict:<suffix>" key. Diagnostic feature.
+  - "fail": reject the request with 409 Conflict naming the conflicting schemas
 - **X-KDex-Function-Security**: If present, the sniffer signals that the route requires authentication. It adds security requirements matching the semicolon deliminted (';') scheme names in the value and injects a "401 Unauthorized" response. Scopes can be included with the scheme name by appending a equal sign ('=') and a pipe delimited list or scopes. (e.g. "X-KDex-Function-Security: bearer=users:read|users:write;apiKey")
 - **X-KDex-Function-Summary**: Sets the OpenAPI operation summary.
 - **X-KDex-Function-Tags**: Comma-separated list of tags for the OpenAPI operation.
@@ -63,18 +72,46 @@ The KDex Request Sniffer automatically generates or updates KDexFunction resourc
 - **Content-Type**:
   - "application/json": The sniffer peeks at the body and infers a basic schema (types: string, number, boolean, object, array).
   - "application/x-www-form-urlencoded": The sniffer parses form fields and adds them as properties in the request body schema.
+  - "application/grpc-web", "application/grpc", "application/x-protobuf" (and related protobuf types): The body is documented as a binary string (base64 "byte" for "application/grpc-web-text") and the operation is marked with an "x-kdex-protocol" extension naming the wire protocol.
+  - "application/xml", "text/xml" (and "+xml" variants): The sniffer parses the document and infers an object schema for the root element. Attributes, namespaces and repeated elements are captured in the schema's xml metadata.
+
+### Proxy Mode
+
+When the host manager is started with an upstream origin (the "--sniffer-upstream" flag or the "SNIFFER_UPSTREAM" env var), unmatched requests are forwarded to that origin and its response is relayed to the client. The sniffer then documents the operation from the actual exchange:
+
+- The response is keyed by the upstream status code instead of "200".
+- The response schema is inferred from the upstream body (JSON, XML, protobuf or text) rather than from the Accept header, and small bodies are recorded as the response example.
+- The upstream response carries an "X-KDex-Sniffer-Inspect" header linking to the analysis.
+- Bodies larger than 1MB are relayed but not inferred.
+
+### Writes
+
+Generated KDexFunction resources are written in the background so that the request is answered without waiting for the Kubernetes API. Observations of the same function made within a short window (2s by default, set with the "--sniffer-write-window" flag or the "SNIFFER_WRITE_WINDOW" env var, 0 writes synchronously) build on each other and are written once. Failed writes are retried with backoff.
+
+### History
+
+Analysis results are kept in a "<host>-sniffer-history" ConfigMap so that they remain available after the host manager restarts. Only the most recent results are kept (50 by default, set with the "--sniffer-history-size" flag or the "SNIFFER_HISTORY_SIZE" env var, 0 disables the history).
+
+- "GET /-/sniffer/history" lists the results newest first, each with a link to its inspect page.
+- The "function", "method", "path" (prefix), "lint" (substring) and "since" (RFC 3339) query parameters filter the results and "limit" bounds their number.
 
 ### Query Parameters
 
 - Multi-value parameters (e.g., "?id=1&id=2") are detected and documented as "array" types in OpenAPI with "Explode: true".
 
 ---
-*Note: The sniffer only processes non-internal paths (paths not starting with "/-/") that result in a 404.*
+*Note: The sniffer only processes non-internal paths (paths not starting with "/-/") that result in a 404. Well-known paths (starting with "/.well-known/") are never sniffed.*
 `
 	TRUE = "true"
+
+	protocolGRPC        = "grpc"
+	protocolGRPCWeb     = "grpc-web"
+	protocolGRPCWebText = "grpc-web-text"
+	protocolProtobuf    = "protobuf"
 )
 
 var jsonMimeRegex = regexp.MustCompile(`^application\/(.*\+)?json(;.*)?$`)
+var xmlMimeRegex = regexp.MustCompile(`^(application|text)\/(.*\+)?xml(;.*)?$`)
 var urlSchemeRegex regexp.Regexp = *regexp.MustCompile("^https?://.*")
 
 type AnalysisResult struct {
@@ -84,15 +121,18 @@ type AnalysisResult struct {
 }
 
 type RequestSniffer struct {
-	BasePathRegex   regexp.Regexp
-	Client          client.Client
-	Functions       []kdexv1alpha1.KDexFunction
-	HostName        string
-	ItemPathRegex   regexp.Regexp
-	Namespace       string
-	OpenAPIBuilder  ko.Builder
-	ReconcileTime   time.Time
-	SecuritySchemes *openapi.SecuritySchemes
+	BasePathRegex          regexp.Regexp
+	Client                 client.Client
+	Functions              []kdexv1alpha1.KDexFunction
+	HostName               string
+	ItemPathRegex          regexp.Regexp
+	MediaTypes             *mime.Registry
+	Namespace              string
+	OpenAPIBuilder         ko.Builder
+	Queue                  *WriteQueue
+	ReconcileTime          time.Time
+	SchemaConflictStrategy SchemaConflictStrategy
+	SecuritySchemes        *openapi.SecuritySchemes
 }
 
 func (s *RequestSniffer) Analyze(r *http.Request) (*AnalysisResult, error) {
@@ -106,6 +146,37 @@ func (s *RequestSniffer) Analyze(r *http.Request) (*AnalysisResult, error) {
 		return nil, nil
 	}
 
+	log := logf.FromContext(r.Context())
+
+	if s.Queue != nil {
+		s.Queue.Add(fnMutated)
+
+		log.V(2).Info(
+			"queued sniffed function",
+			"fnMutated", fnMutated,
+		)
+
+		return res, nil
+	}
+
+	op, err := writeFunction(context.Background(), s.Client, s.HostName, fnMutated)
+
+	log.V(2).Info(
+		"sniffed function",
+		"fnMutated", fnMutated,
+		"op", op,
+		"err", err,
+	)
+
+	return res, err
+}
+
+func writeFunction(
+	ctx context.Context,
+	c client.Client,
+	hostName string,
+	fnMutated *kdexv1alpha1.KDexFunction,
+) (controllerutil.OperationResult, error) {
 	fn := &kdexv1alpha1.KDexFunction{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fnMutated.Name,
@@ -113,39 +184,28 @@ func (s *RequestSniffer) Analyze(r *http.Request) (*AnalysisResult, error) {
 		},
 	}
 
-	op, err := ctrl.CreateOrUpdate(
-		context.Background(), s.Client, fn,
+	return ctrl.CreateOrUpdate(
+		ctx, c, fn,
 		func() error {
 			if fn.CreationTimestamp.IsZero() {
 				fn.Annotations = make(map[string]string)
 				fn.Labels = make(map[string]string)
 
 				fn.Labels["app.kubernetes.io/name"] = "kdex-host"
-				fn.Labels["kdex.dev/instance"] = s.HostName
+				fn.Labels["kdex.dev/instance"] = hostName
 			}
 
 			fn.Spec = fnMutated.Spec
 
 			if fn.CreationTimestamp.IsZero() {
 				fn.Spec.HostRef = v1.LocalObjectReference{
-					Name: s.HostName,
+					Name: hostName,
 				}
 			}
 
 			return nil
 		},
 	)
-
-	log := logf.FromContext(r.Context())
-
-	log.V(2).Info(
-		"sniffed function",
-		"fnMutated", fnMutated,
-		"op", op,
-		"err", err,
-	)
-
-	return res, err
 }
 
 func (s *RequestSniffer) DocsHandler(w http.ResponseWriter, r *http.Request) {
@@ -193,6 +253,19 @@ func (s *RequestSniffer) analyze(r *http.Request) (*AnalysisResult, error) {
 		if r.Header.Get("X-KDex-Function-Security") != "" {
 			res.Lints = append(res.Lints, "[inference] Detected 'X-KDex-Function-Security' header; secured endpoint inferred.")
 		}
+		if protocol := protobufProtocol(r.Header.Get("Content-Type")); protocol != "" {
+			res.Lints = append(res.Lints, fmt.Sprintf("[inference] Detected %s body; message schema is opaque unless 'X-KDex-Function-Proto-Descriptor' is set.", protocol))
+		}
+		if upstream := upstreamResponseFrom(r.Context()); upstream != nil {
+			switch {
+			case upstream.Truncated:
+				res.Lints = append(res.Lints, "[inference] Upstream response body was too large to observe; response schema not inferred.")
+			case upstream.StatusCode >= 400:
+				res.Lints = append(res.Lints, fmt.Sprintf("[inference] Upstream responded with %d; no successful response was observed.", upstream.StatusCode))
+			default:
+				res.Lints = append(res.Lints, fmt.Sprintf("[inference] Response schema inferred from the upstream %d response.", upstream.StatusCode))
+			}
+		}
 		if len(r.URL.Query()) > 0 {
 			res.Lints = append(res.Lints, fmt.Sprintf("[inference] Detected %d query parameters.", len(r.URL.Query())))
 		}
@@ -304,8 +377,41 @@ func (s *RequestSniffer) mergeAPIIntoFunction(
 	in map[string]*openapi.PathItem,
 	schemas map[string]*openapi.SchemaRef,
 	overwriteOperation bool,
-	keepConflictedSchemas bool,
-) {
+	strategy SchemaConflictStrategy,
+) error {
+	// Resolve schemas first so that a failed merge leaves out untouched
+	fnSchemas := out.Spec.API.GetSchemas()
+	conflicts := []string{}
+
+	for key, schemaRef := range schemas {
+		existing, found := fnSchemas[key]
+		if !found || schemasEqual(existing, schemaRef) {
+			fnSchemas[key] = schemaRef
+			continue
+		}
+
+		switch strategy {
+		case SchemaConflictFail:
+			conflicts = append(conflicts, key)
+		case SchemaConflictKeep:
+			fnSchemas[key+":conflict:"+rand.Text()[0:4]] = schemaRef
+		case SchemaConflictMerge:
+			if merged, ok := mergeSchemas(existing, schemaRef); ok {
+				fnSchemas[key] = merged
+			} else {
+				fnSchemas[key+":conflict:"+rand.Text()[0:4]] = schemaRef
+			}
+		case SchemaConflictPreferExisting:
+		default:
+			fnSchemas[key] = schemaRef
+		}
+	}
+
+	if len(conflicts) > 0 {
+		slices.Sort(conflicts)
+		return &SchemaConflictError{Schemas: conflicts}
+	}
+
 	if out.Spec.API.Paths == nil {
 		out.Spec.API.Paths = map[string]kdexv1alpha1.PathItem{}
 	}
@@ -359,19 +465,9 @@ func (s *RequestSniffer) mergeAPIIntoFunction(
 		out.Spec.API.Paths[inPath] = outItem
 	}
 
-	// Merge schemas
-	fnSchemas := out.Spec.API.GetSchemas()
-
-	for key, schemaRef := range schemas {
-		_, found := fnSchemas[key]
-		if found && keepConflictedSchemas {
-			key = key + ":conflict:" + rand.Text()[0:4]
-		}
-
-		fnSchemas[key] = schemaRef
-	}
-
 	out.Spec.API.SetSchemas(fnSchemas)
+
+	return nil
 }
 
 // nolint:gocyclo
@@ -484,6 +580,13 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 		}
 	}
 
+	if descriptor := r.Header.Get("X-KDex-Function-Proto-Descriptor"); descriptor != "" {
+		if op.Extensions == nil {
+			op.Extensions = map[string]any{}
+		}
+		op.Extensions["x-kdex-proto-descriptor"] = descriptor
+	}
+
 	// Process Request signals
 	switch r.Method {
 	case http.MethodPost, http.MethodPut, http.MethodPatch:
@@ -498,14 +601,11 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 			if !requestSchemaIsExternal {
 				if contentType == "" {
 					var err error
-					var mt *mimetype.MIME
-					mt, body, err = mime.Detect(body)
+					contentType, body, err = s.MediaTypes.Detect(body)
 
 					if err != nil {
 						return nil, nil, err
 					}
-
-					contentType = mt.String()
 				}
 
 				switch contentType {
@@ -573,14 +673,11 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 
 							if partContentType == "" || partContentType == "application/octet-stream" {
 								var err error
-								var mt *mimetype.MIME
-								mt, _, err = mime.Detect(part)
+								partContentType, _, err = s.MediaTypes.DetectFile(part.FileName(), part)
 
 								if err != nil {
 									return nil, nil, err
 								}
-
-								partContentType = mt.String()
 							}
 
 							encoding[fieldName] = &openapi.Encoding{
@@ -613,6 +710,27 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 						schema = ko.InferSchema(data).Value
 					}
 				}
+
+				if protocol := protobufProtocol(contentType); protocol != "" {
+					schema.Type = &openapi.Types{openapi.TypeString}
+					schema.Format = "binary"
+					if protocol == protocolGRPCWebText {
+						schema.Format = "byte"
+					}
+					if op.Extensions == nil {
+						op.Extensions = map[string]any{}
+					}
+					op.Extensions["x-kdex-protocol"] = protocol
+				}
+
+				if isXML(contentType) {
+					xmlSchema, err := ko.InferXMLSchema(body)
+					if err != nil {
+						return nil, nil, err
+					}
+
+					schema = xmlSchema.Value
+				}
 			}
 
 			schema.Description = "Inferred from request body"
@@ -665,9 +783,48 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 
 	resp := openapi.NewResponse().WithDescription("Successful response")
 	accept := r.Header.Get("Accept")
+	status := "200"
+	upstream := upstreamResponseFrom(r.Context())
+
+	if upstream != nil {
+		status = strconv.Itoa(upstream.StatusCode)
+		if text := http.StatusText(upstream.StatusCode); text != "" {
+			resp.WithDescription(text)
+		}
+	}
 
 	if r.Method == "HEAD" || r.Method == "CONNECT" {
 		resp.Content = openapi.NewContent()
+	} else if upstream != nil {
+		mediaType, media, err := inferUpstreamContent(upstream, s.MediaTypes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if media != nil {
+			if responseSchemaRef != "" {
+				schemaName, err := ko.ExtractSchemaName(responseSchemaRef)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				if responseSchemaIsExternal {
+					schemas[schemaName] = &openapi.SchemaRef{
+						Ref: responseSchemaRef,
+					}
+				} else {
+					schemas[schemaName] = media.Schema
+				}
+
+				media.Schema = &openapi.SchemaRef{
+					Ref: responseSchemaRef,
+				}
+			}
+
+			content := openapi.NewContent()
+			content[mediaType] = media
+			resp.Content = content
+		}
 	} else if accept != "" {
 		content := openapi.NewContent()
 
@@ -696,8 +853,22 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 			if mediaType == "" || mediaType == "*/*" {
 				continue
 			}
+			mediaSchemaRef := schemaRef
+			if mediaSchemaRef == nil {
+				if protocol := protobufProtocol(mediaType); protocol != "" {
+					mediaSchemaRef = &openapi.SchemaRef{
+						Value: &openapi.Schema{
+							Format: "binary",
+							Type:   &openapi.Types{openapi.TypeString},
+						},
+					}
+					if protocol == protocolGRPCWebText {
+						mediaSchemaRef.Value.Format = "byte"
+					}
+				}
+			}
 			content[mediaType] = &openapi.MediaType{
-				Schema: schemaRef,
+				Schema: mediaSchemaRef,
 			}
 		}
 
@@ -706,7 +877,7 @@ func (s *RequestSniffer) parseRequestIntoAPI(
 		}
 	}
 
-	op.Responses.Set("200", &openapi.ResponseRef{
+	op.Responses.Set(status, &openapi.ResponseRef{
 		Value: resp,
 	})
 
@@ -915,8 +1086,8 @@ func (s *RequestSniffer) generateResourceOperations(resourcePath string, item *o
 // Basic criteria: non-HTML GET/POST requests that are not found
 // (This is called when HostHandler hits a 404)
 func (s *RequestSniffer) sniff(r *http.Request) (*kdexv1alpha1.KDexFunction, error) {
-	// Skip internal paths
-	if strings.HasPrefix(r.URL.Path, "/-/") {
+	// Skip internal and well-known paths, e.g. the ACME HTTP-01 challenges
+	if strings.HasPrefix(r.URL.Path, "/-/") || strings.HasPrefix(r.URL.Path, "/.well-known/") {
 		return nil, nil
 	}
 
@@ -932,7 +1103,7 @@ func (s *RequestSniffer) sniff(r *http.Request) (*kdexv1alpha1.KDexFunction, err
 	operationId := ko.GenerateOperationID(patternName, method, r.Header.Get("X-KDex-Function-Operation-ID"))
 
 	// Check if a KDexFunction already exists for this path/method to avoid duplicates
-	existing, exactMatch := s.matchExisting(s.Functions, functionName, basePath, patternPath, method, operationId)
+	existing, exactMatch := s.matchExisting(s.functions(), functionName, basePath, patternPath, method, operationId)
 	if existing != nil && !existing.Spec.Metadata.AutoGenerated {
 		return existing, fmt.Errorf("the function %s/%s can no longer be targeted for autogeneration: .spec.metadata.autoGenerated=false", existing.Name, existing.Namespace)
 	}
@@ -944,6 +1115,11 @@ func (s *RequestSniffer) sniff(r *http.Request) (*kdexv1alpha1.KDexFunction, err
 		functionName = existing.Name
 	}
 
+	strategy, err := s.schemaConflictStrategy(r)
+	if err != nil {
+		return nil, err
+	}
+
 	pathItems, schemas, err := s.parseRequestIntoAPI(r, functionName, patternPath, operationId)
 
 	if err != nil {
@@ -983,12 +1159,14 @@ func (s *RequestSniffer) sniff(r *http.Request) (*kdexv1alpha1.KDexFunction, err
 		})
 	}
 
-	s.mergeAPIIntoFunction(
+	if err := s.mergeAPIIntoFunction(
 		fn,
 		pathItems,
 		schemas,
 		r.Header.Get("X-KDex-Function-Overwrite-Operation") != TRUE,
-		r.Header.Get("X-KDex-Function-Keep-Schema-Conflict") == TRUE)
+		strategy); err != nil {
+		return existing, err
+	}
 
 	return fn, nil
 }
@@ -1021,6 +1199,29 @@ func isJSON(mimeType string) bool {
 	return jsonMimeRegex.MatchString(strings.ToLower(mimeType))
 }
 
+func isXML(mimeType string) bool {
+	return xmlMimeRegex.MatchString(strings.ToLower(mimeType))
+}
+
+// protobufProtocol returns the wire protocol of a protobuf based media type,
+// or an empty string when the media type is not protobuf based.
+func protobufProtocol(mimeType string) string {
+	mediaType := strings.TrimSpace(strings.Split(strings.ToLower(mimeType), ";")[0])
+
+	switch mediaType {
+	case "application/grpc", "application/grpc+proto":
+		return protocolGRPC
+	case "application/grpc-web", "application/grpc-web+proto":
+		return protocolGRPCWeb
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		return protocolGRPCWebText
+	case "application/protobuf", "application/x-protobuf", "application/vnd.google.protobuf":
+		return protocolProtobuf
+	}
+
+	return ""
+}
+
 func setOp(item *openapi.PathItem, method string, op *openapi.Operation) {
 	switch kh.MethodFromString(method) {
 	case kh.Connect:
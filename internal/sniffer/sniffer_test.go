@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/mime"
 	ko "github.com/kdex-tech/host-manager/internal/openapi"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -316,12 +317,13 @@ func TestRequestSniffer_mergeAPIIntoFunction(t *testing.T) {
 	}
 
 	tests := []struct {
-		name          string
-		out           *kdexv1alpha1.KDexFunction
-		paths         map[string]*openapi.PathItem
-		schemas       map[string]*openapi.SchemaRef
-		keepConflicts bool
-		assertions    func(t *testing.T, fn *kdexv1alpha1.KDexFunction)
+		name       string
+		out        *kdexv1alpha1.KDexFunction
+		paths      map[string]*openapi.PathItem
+		schemas    map[string]*openapi.SchemaRef
+		strategy   SchemaConflictStrategy
+		wantErr    bool
+		assertions func(t *testing.T, fn *kdexv1alpha1.KDexFunction)
 	}{
 		{
 			name:       "no op",
@@ -511,7 +513,7 @@ func TestRequestSniffer_mergeAPIIntoFunction(t *testing.T) {
 					},
 				},
 			},
-			keepConflicts: true,
+			strategy: SchemaConflictKeep,
 			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
 				schemas := fn.Spec.API.GetSchemas()
 
@@ -530,6 +532,236 @@ func TestRequestSniffer_mergeAPIIntoFunction(t *testing.T) {
 				assert.Equal(t, "Conflicting User", found)
 			},
 		},
+		{
+			name: "identical schema is not a conflict",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Type: &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Type: &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			strategy: SchemaConflictKeep,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				assert.Equal(t, 1, len(fn.Spec.API.Schemas))
+			},
+		},
+		{
+			name: "prefer existing schema",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"id":   openapi.NewIntegerSchema().NewRef(),
+										"name": openapi.NewStringSchema().NewRef(),
+									},
+									Required: []string{"id", "name"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Properties: openapi.Schemas{
+							"email": openapi.NewStringSchema().NewRef(),
+						},
+						Required: []string{"email"},
+						Type:     &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			strategy: SchemaConflictPreferExisting,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				schemas := fn.Spec.API.GetSchemas()
+				assert.Equal(t, 1, len(schemas))
+				assert.Equal(t, []string{"id", "name"}, schemas["User"].Value.Required)
+			},
+		},
+		{
+			name: "prefer newest schema",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"id":   openapi.NewIntegerSchema().NewRef(),
+										"name": openapi.NewStringSchema().NewRef(),
+									},
+									Required: []string{"id", "name"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Properties: openapi.Schemas{
+							"email": openapi.NewStringSchema().NewRef(),
+						},
+						Required: []string{"email"},
+						Type:     &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			strategy: SchemaConflictPreferNewest,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				schemas := fn.Spec.API.GetSchemas()
+				assert.Equal(t, 1, len(schemas))
+				assert.Equal(t, []string{"email"}, schemas["User"].Value.Required)
+			},
+		},
+		{
+			name: "merge compatible schemas",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"id":   openapi.NewIntegerSchema().NewRef(),
+										"name": openapi.NewStringSchema().NewRef(),
+									},
+									Required: []string{"id", "name"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Properties: openapi.Schemas{
+							"email": openapi.NewStringSchema().NewRef(),
+							"id":    openapi.NewFloat64Schema().NewRef(),
+						},
+						Required: []string{"email", "id"},
+						Type:     &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			strategy: SchemaConflictMerge,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				schemas := fn.Spec.API.GetSchemas()
+				assert.Equal(t, 1, len(schemas))
+
+				user := schemas["User"].Value
+				assert.Equal(t, []string{"id"}, user.Required)
+				assert.Len(t, user.Properties, 3)
+				assert.Equal(t, &openapi.Types{openapi.TypeNumber}, user.Properties["id"].Value.Type)
+				assert.Equal(t, &openapi.Types{openapi.TypeString}, user.Properties["email"].Value.Type)
+			},
+		},
+		{
+			name: "merge incompatible schemas keeps both",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"id":   openapi.NewIntegerSchema().NewRef(),
+										"name": openapi.NewStringSchema().NewRef(),
+									},
+									Required: []string{"id", "name"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Properties: openapi.Schemas{
+							"id": openapi.NewStringSchema().NewRef(),
+						},
+						Required: []string{"id"},
+						Type:     &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			strategy: SchemaConflictMerge,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				schemas := fn.Spec.API.GetSchemas()
+				assert.Equal(t, 2, len(schemas))
+				assert.Equal(t, &openapi.Types{openapi.TypeInteger}, schemas["User"].Value.Properties["id"].Value.Type)
+			},
+		},
+		{
+			name: "fail on conflicting schema",
+			out: &kdexv1alpha1.KDexFunction{
+				Spec: kdexv1alpha1.KDexFunctionSpec{
+					API: kdexv1alpha1.API{
+						Schemas: rawM(map[string]*openapi.SchemaRef{
+							"User": {
+								Value: &openapi.Schema{
+									Properties: openapi.Schemas{
+										"id":   openapi.NewIntegerSchema().NewRef(),
+										"name": openapi.NewStringSchema().NewRef(),
+									},
+									Required: []string{"id", "name"},
+									Type:     &openapi.Types{openapi.TypeObject},
+								},
+							},
+						}),
+					},
+				},
+			},
+			schemas: map[string]*openapi.SchemaRef{
+				"User": {
+					Value: &openapi.Schema{
+						Properties: openapi.Schemas{
+							"id": openapi.NewStringSchema().NewRef(),
+						},
+						Required: []string{"id"},
+						Type:     &openapi.Types{openapi.TypeObject},
+					},
+				},
+			},
+			paths: map[string]*openapi.PathItem{
+				"/users": {
+					Get: &openapi.Operation{
+						Description: "GET /users",
+					},
+				},
+			},
+			strategy: SchemaConflictFail,
+			wantErr:  true,
+			assertions: func(t *testing.T, fn *kdexv1alpha1.KDexFunction) {
+				assert.Empty(t, fn.Spec.API.Paths)
+				assert.Equal(t, 1, len(fn.Spec.API.GetSchemas()))
+			},
+		},
 		{
 			name: "add trace to existing",
 			out: &kdexv1alpha1.KDexFunction{
@@ -570,7 +802,12 @@ func TestRequestSniffer_mergeAPIIntoFunction(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// TODO: pass overwriteOperation bool and test it...
-			s.mergeAPIIntoFunction(tt.out, tt.paths, tt.schemas, true, tt.keepConflicts)
+			err := s.mergeAPIIntoFunction(tt.out, tt.paths, tt.schemas, true, tt.strategy)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 			tt.assertions(t, tt.out)
 		})
 	}
@@ -972,6 +1209,174 @@ func TestRequestSniffer_parseRequestIntoAPI(t *testing.T) {
 				assert.Equal(t, &expected, content.Schema.Value)
 			},
 		},
+		{
+			name: "application\\xml body schema",
+			r: func() *http.Request {
+				body := `<?xml version="1.0"?>
+<order id="42" xmlns:ex="http://example.com/ns">
+	<customer>Jane</customer>
+	<paid>true</paid>
+	<item sku="A1">2</item>
+	<item sku="B2">1</item>
+	<ex:note>fragile</ex:note>
+</order>`
+				r := httptest.NewRequest("POST", "/test", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/xml")
+				return r
+			}(),
+			assertions: func(t *testing.T, op map[string]*openapi.PathItem, schemas map[string]*openapi.SchemaRef, err error) {
+				expected := openapi.Schema{
+					Description: "Inferred from request body",
+					Type:        &openapi.Types{openapi.TypeObject},
+					Properties: openapi.Schemas{
+						"id": &openapi.SchemaRef{
+							Value: &openapi.Schema{
+								Type: &openapi.Types{openapi.TypeInteger},
+								XML:  &openapi.XML{Attribute: true},
+							},
+						},
+						"customer": &openapi.SchemaRef{
+							Value: &openapi.Schema{
+								Type: &openapi.Types{openapi.TypeString},
+							},
+						},
+						"paid": &openapi.SchemaRef{
+							Value: &openapi.Schema{
+								Type: &openapi.Types{openapi.TypeBoolean},
+							},
+						},
+						"item": &openapi.SchemaRef{
+							Value: &openapi.Schema{
+								Type: &openapi.Types{openapi.TypeArray},
+								Items: &openapi.SchemaRef{
+									Value: &openapi.Schema{
+										Type: &openapi.Types{openapi.TypeObject},
+										Properties: openapi.Schemas{
+											"sku": &openapi.SchemaRef{
+												Value: &openapi.Schema{
+													Type: &openapi.Types{openapi.TypeString},
+													XML:  &openapi.XML{Attribute: true},
+												},
+											},
+											"value": &openapi.SchemaRef{
+												Value: &openapi.Schema{
+													Type: &openapi.Types{openapi.TypeInteger},
+												},
+											},
+										},
+										XML: &openapi.XML{Name: "item"},
+									},
+								},
+							},
+						},
+						"note": &openapi.SchemaRef{
+							Value: &openapi.Schema{
+								Type: &openapi.Types{openapi.TypeString},
+								XML:  &openapi.XML{Namespace: "http://example.com/ns", Prefix: "ex"},
+							},
+						},
+					},
+					XML: &openapi.XML{Name: "order"},
+				}
+
+				assert.Nil(t, err)
+				assert.NotNil(t, op)
+				item, ok := op["/test"]
+				assert.True(t, ok)
+				assert.NotNil(t, item.Post.RequestBody)
+				content := item.Post.RequestBody.Value.Content["application/xml"]
+				assert.NotNil(t, content)
+				assert.Equal(t, &expected, content.Schema.Value)
+			},
+		},
+		{
+			name: "application\\grpc-web body with descriptor",
+			r: func() *http.Request {
+				r := httptest.NewRequest("POST", "/test", bytes.NewReader([]byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01}))
+				r.Header.Set("Accept", "application/grpc-web-text")
+				r.Header.Set("Content-Type", "application/grpc-web+proto")
+				r.Header.Set("X-KDex-Function-Proto-Descriptor", "https://example.com/descriptors/greeter.binpb")
+				return r
+			}(),
+			assertions: func(t *testing.T, op map[string]*openapi.PathItem, schemas map[string]*openapi.SchemaRef, err error) {
+				assert.Nil(t, err)
+				item, ok := op["/test"]
+				assert.True(t, ok)
+				assert.Equal(t, "grpc-web", item.Post.Extensions["x-kdex-protocol"])
+				assert.Equal(t, "https://example.com/descriptors/greeter.binpb", item.Post.Extensions["x-kdex-proto-descriptor"])
+
+				content := item.Post.RequestBody.Value.Content["application/grpc-web+proto"]
+				assert.NotNil(t, content)
+				assert.Equal(t, &openapi.Types{openapi.TypeString}, content.Schema.Value.Type)
+				assert.Equal(t, "binary", content.Schema.Value.Format)
+
+				response := item.Post.Responses.Value("200").Value.Content["application/grpc-web-text"]
+				assert.NotNil(t, response)
+				assert.Equal(t, "byte", response.Schema.Value.Format)
+			},
+		},
+		{
+			name: "malformed text\\xml body",
+			r: func() *http.Request {
+				r := httptest.NewRequest("POST", "/test", strings.NewReader(`<order><id>1</order>`))
+				r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+				return r
+			}(),
+			assertions: func(t *testing.T, op map[string]*openapi.PathItem, schemas map[string]*openapi.SchemaRef, err error) {
+				assert.NotNil(t, err)
+			},
+		},
+		{
+			name: "GET /test with upstream response",
+			r: func() *http.Request {
+				r := httptest.NewRequest("GET", "/test", http.NoBody)
+				r.Header.Set("Accept", "text/html")
+				return r.WithContext(WithUpstreamResponse(r.Context(), &UpstreamResponse{
+					Body:       []byte(`{"id":1,"name":"foo"}`),
+					Header:     http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+					StatusCode: http.StatusOK,
+				}))
+			}(),
+			assertions: func(t *testing.T, op map[string]*openapi.PathItem, schemas map[string]*openapi.SchemaRef, err error) {
+				assert.Nil(t, err)
+				item, ok := op["/test"]
+				assert.True(t, ok)
+
+				response := item.Get.Responses.Value("200").Value
+				assert.Equal(t, "OK", *response.Description)
+				assert.Nil(t, response.Content["text/html"])
+
+				content := response.Content["application/json"]
+				assert.NotNil(t, content)
+				assert.Equal(t, &openapi.Types{openapi.TypeObject}, content.Schema.Value.Type)
+				assert.Equal(t, &openapi.Types{openapi.TypeNumber}, content.Schema.Value.Properties["id"].Value.Type)
+				assert.Equal(t, &openapi.Types{openapi.TypeString}, content.Schema.Value.Properties["name"].Value.Type)
+				assert.Equal(t, map[string]any{"id": float64(1), "name": "foo"}, content.Example)
+			},
+		},
+		{
+			name: "GET /test with upstream error and response schema ref",
+			r: func() *http.Request {
+				r := httptest.NewRequest("GET", "/test", http.NoBody)
+				r.Header.Set("X-KDex-Function-Response-Schema-Ref", "Problem")
+				return r.WithContext(WithUpstreamResponse(r.Context(), &UpstreamResponse{
+					Body:       []byte(`<problem><status>404</status></problem>`),
+					Header:     http.Header{"Content-Type": []string{"application/problem+xml"}},
+					StatusCode: http.StatusNotFound,
+				}))
+			}(),
+			assertions: func(t *testing.T, op map[string]*openapi.PathItem, schemas map[string]*openapi.SchemaRef, err error) {
+				assert.Nil(t, err)
+				item, ok := op["/test"]
+				assert.True(t, ok)
+				assert.Nil(t, item.Get.Responses.Value("200"))
+
+				content := item.Get.Responses.Value("404").Value.Content["application/problem+xml"]
+				assert.NotNil(t, content)
+				assert.Equal(t, "#/components/schemas/Problem", content.Schema.Ref)
+				assert.Equal(t, "problem", schemas["Problem"].Value.XML.Name)
+			},
+		},
 		{
 			name: "auto detect mutlipart\\form-data and schema",
 			r: func() *http.Request {
@@ -1313,6 +1718,51 @@ func TestRequestSniffer_parseRequestIntoAPI(t *testing.T) {
 	}
 }
 
+func TestRequestSniffer_parseRequestIntoAPI_mediaTypes(t *testing.T) {
+	registry, err := mime.NewRegistry([]mime.MediaType{
+		{Extensions: []string{".acd"}, Magic: []string{"41434d45"}, Type: "application/vnd.acme.drawing"},
+	})
+	assert.Nil(t, err)
+	s := &RequestSniffer{
+		HostName:   "test-host",
+		MediaTypes: registry,
+	}
+
+	parse := func(r *http.Request) map[string]*openapi.PathItem {
+		items, _, err := s.parseRequestIntoAPI(r, "test", r.URL.Path, "test-op")
+		assert.Nil(t, err)
+		return items
+	}
+
+	// A body without a content type, by its magic bytes
+	r := httptest.NewRequest("POST", "/drawings", strings.NewReader("ACME\x00\x01drawing"))
+	items := parse(r)
+	assert.NotNil(t, items["/drawings"].Post.RequestBody.Value.Content["application/vnd.acme.drawing"])
+
+	// An uploaded file, by its extension
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("drawing", "plan.acd")
+	_, _ = part.Write([]byte("PK\x03\x04 not a zip"))
+	_ = writer.Close()
+	r = httptest.NewRequest("POST", "/drawings", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	items = parse(r)
+	content := items["/drawings"].Post.RequestBody.Value.Content["multipart/form-data"]
+	assert.NotNil(t, content)
+	assert.Equal(t, "application/vnd.acme.drawing", content.Encoding["drawing"].ContentType)
+
+	// An upstream response without a content type, by its magic bytes
+	r = httptest.NewRequest("GET", "/drawings/1", http.NoBody)
+	r = r.WithContext(WithUpstreamResponse(r.Context(), &UpstreamResponse{
+		Body:       []byte("ACME\x00\x01drawing"),
+		Header:     http.Header{},
+		StatusCode: http.StatusOK,
+	}))
+	items = parse(r)
+	assert.NotNil(t, items["/drawings/1"].Get.Responses.Value("200").Value.Content["application/vnd.acme.drawing"])
+}
+
 func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.T) {
 	fn := &kdexv1alpha1.KDexFunction{}
 
@@ -1342,7 +1792,7 @@ func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.
 		patternPath,
 		operationId)
 	assert.NoError(t, err)
-	s.mergeAPIIntoFunction(fn, paths, schemas, true, false)
+	assert.NoError(t, s.mergeAPIIntoFunction(fn, paths, schemas, true, SchemaConflictPreferNewest))
 
 	expected := &kdexv1alpha1.KDexFunction{
 		Spec: kdexv1alpha1.KDexFunctionSpec{
@@ -1446,7 +1896,7 @@ func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.
 		patternPath,
 		operationId)
 	assert.NoError(t, err)
-	s.mergeAPIIntoFunction(fn, paths, schemas, true, false)
+	assert.NoError(t, s.mergeAPIIntoFunction(fn, paths, schemas, true, SchemaConflictPreferNewest))
 
 	item, ok := expected.Spec.API.Paths["/v2/users/{id}"]
 	assert.True(t, ok)
@@ -1505,7 +1955,7 @@ func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.
 		patternPath,
 		operationId)
 	assert.NoError(t, err)
-	s.mergeAPIIntoFunction(fn, paths, schemas, true, false)
+	assert.NoError(t, s.mergeAPIIntoFunction(fn, paths, schemas, true, SchemaConflictPreferNewest))
 
 	item, ok = expected.Spec.API.Paths["/v2/users/{id}"]
 	assert.True(t, ok)
@@ -1562,7 +2012,7 @@ func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.
 		patternPath,
 		operationId)
 	assert.NoError(t, err)
-	s.mergeAPIIntoFunction(fn, paths, schemas, true, false)
+	assert.NoError(t, s.mergeAPIIntoFunction(fn, paths, schemas, true, SchemaConflictPreferNewest))
 
 	item, ok = expected.Spec.API.Paths["/v2/users/{id}"]
 	assert.True(t, ok)
@@ -1615,7 +2065,7 @@ func TestRequestSniffer_parseRequestIntoAPI_and_mergeAPIIntoFunction(t *testing.
 		patternPath,
 		operationId)
 	assert.NoError(t, err)
-	s.mergeAPIIntoFunction(fn, paths, schemas, true, false)
+	assert.NoError(t, s.mergeAPIIntoFunction(fn, paths, schemas, true, SchemaConflictPreferNewest))
 
 	item, ok = expected.Spec.API.Paths["/v2/users/{id}"]
 	assert.True(t, ok)
@@ -1723,6 +2173,11 @@ func TestRequestSniffer_sniff_A(t *testing.T) {
 			r:    httptest.NewRequest("GET", "/-/internal", http.NoBody),
 			want: nil,
 		},
+		{
+			name: "GET /.well-known/acme-challenge/abc",
+			r:    httptest.NewRequest("GET", "/.well-known/acme-challenge/abc", http.NoBody),
+			want: nil,
+		},
 		{
 			name: "GET /v1/foo",
 			r:    httptest.NewRequest("GET", "/v1/foo", http.NoBody),
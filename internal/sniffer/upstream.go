@@ -0,0 +1,102 @@
+package sniffer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/mime"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+)
+
+// maxExampleSize is the largest upstream body recorded as a response example.
+const maxExampleSize = 16 << 10
+
+// UpstreamResponse is a response observed from the upstream origin while the
+// sniffer runs in proxy mode.
+type UpstreamResponse struct {
+	Body       []byte
+	Header     http.Header
+	StatusCode int
+	// Truncated is set when the body was too large to be observed.
+	Truncated bool
+}
+
+type upstreamResponseKey struct{}
+
+// WithUpstreamResponse attaches the observed upstream response to the context
+// of a request so that its response schema is inferred from the actual
+// response rather than the Accept header.
+func WithUpstreamResponse(ctx context.Context, resp *UpstreamResponse) context.Context {
+	return context.WithValue(ctx, upstreamResponseKey{}, resp)
+}
+
+func upstreamResponseFrom(ctx context.Context) *UpstreamResponse {
+	resp, _ := ctx.Value(upstreamResponseKey{}).(*UpstreamResponse)
+	return resp
+}
+
+// inferUpstreamContent infers the media type, schema and example of an
+// observed upstream response body, detecting its media type with the
+// registered media types when it has no content type. A nil media type means
+// nothing could be inferred.
+func inferUpstreamContent(resp *UpstreamResponse, mediaTypes *mime.Registry) (string, *openapi.MediaType, error) {
+	if resp.Truncated || len(resp.Body) == 0 {
+		return "", nil, nil
+	}
+
+	contentType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if contentType == "" {
+		mt, _, err := mediaTypes.Detect(bytes.NewReader(resp.Body))
+		if err != nil {
+			return "", nil, err
+		}
+		contentType = strings.TrimSpace(strings.Split(mt, ";")[0])
+	}
+
+	var schema *openapi.Schema
+	var example any
+
+	switch {
+	case isJSON(contentType):
+		var data any
+		if err := json.Unmarshal(resp.Body, &data); err != nil {
+			return "", nil, err
+		}
+		schema = ko.InferSchema(data).Value
+		example = data
+	case isXML(contentType):
+		xmlSchema, err := ko.InferXMLSchema(bytes.NewReader(resp.Body))
+		if err != nil {
+			return "", nil, err
+		}
+		schema = xmlSchema.Value
+		example = string(resp.Body)
+	case protobufProtocol(contentType) != "":
+		schema = openapi.NewStringSchema()
+		schema.Format = "binary"
+		if protobufProtocol(contentType) == protocolGRPCWebText {
+			schema.Format = "byte"
+		}
+	case strings.HasPrefix(contentType, "text/"):
+		schema = openapi.NewStringSchema()
+		example = string(resp.Body)
+	default:
+		schema = openapi.NewStringSchema()
+		schema.Format = "binary"
+	}
+
+	schema.Description = "Inferred from upstream response body"
+
+	media := &openapi.MediaType{
+		Schema: schema.NewRef(),
+	}
+	if example != nil && len(resp.Body) <= maxExampleSize {
+		media.Example = example
+	}
+
+	return contentType, media, nil
+}
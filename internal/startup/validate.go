@@ -0,0 +1,233 @@
+// Package startup validates the configuration of the manager before it
+// starts.
+package startup
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	k8s_runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"kdex.dev/crds/configuration"
+
+	"github.com/kdex-tech/host-manager/internal/sniffer"
+	"github.com/kdex-tech/host-manager/internal/web/middleware"
+)
+
+// Config is the configuration of the manager from its flags and environment,
+// validated as a whole before the manager starts so that every problem is
+// reported at once.
+type Config struct {
+	AccessLogFormat     string
+	AccessLogSampleRate float64
+	CacheAddr           string
+	ConfigFile          string
+	// ConfigFileSet is whether --config-file was given, a missing default
+	// configuration file is not an error.
+	ConfigFileSet                 bool
+	ControllerNamespace           string
+	FocalHost                     string
+	MetricsAddr                   string
+	MetricsCertKey                string
+	MetricsCertName               string
+	MetricsCertPath               string
+	MiddlewarePluginDir           string
+	OTLPEndpoint                  string
+	PprofAddr                     string
+	ProbeAddr                     string
+	RequeueDelaySeconds           int
+	SnifferHistorySize            int
+	SnifferSchemaConflictStrategy string
+	SnifferUpstream               string
+	SnifferWriteWindow            time.Duration
+	WebhookCertKey                string
+	WebhookCertName               string
+	WebhookCertPath               string
+	WebserverAddr                 string
+}
+
+// Validate returns the configuration file of the manager, and every problem of
+// its startup configuration joined in a single error.
+func (c *Config) Validate(scheme *k8s_runtime.Scheme) (configuration.NexusConfiguration, error) {
+	errs := []error{}
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.FocalHost == "" {
+		invalid("--focal-host is required: set it to the name of the KDexHost this instance serves")
+	}
+	if c.ControllerNamespace == "" {
+		invalid("the namespace of the controller is unknown: run in a pod with a service account, or set the POD_NAMESPACE env var")
+	}
+
+	conf, err := loadConfiguration(c.ConfigFile, c.ConfigFileSet, scheme)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, validateConfiguration(c.ConfigFile, conf)...)
+	}
+
+	addresses := map[string]string{}
+	bindAddress := func(flag string, address string) {
+		if err := validateBindAddress(address); err != nil {
+			invalid("--%s %q is invalid: %w", flag, address, err)
+			return
+		}
+		_, port, _ := net.SplitHostPort(address)
+		if port == "0" {
+			return
+		}
+		if other, ok := addresses[port]; ok {
+			invalid("--%s %q uses the port of --%s", flag, address, other)
+			return
+		}
+		addresses[port] = flag
+	}
+	bindAddress("webserver-bind-address", c.WebserverAddr)
+	bindAddress("health-probe-bind-address", c.ProbeAddr)
+	if c.MetricsAddr != "0" {
+		bindAddress("metrics-bind-address", c.MetricsAddr)
+	}
+	if c.PprofAddr != "" {
+		bindAddress("pprof-bind-address", c.PprofAddr)
+	}
+
+	if _, err := middleware.ParseAccessLogFormat(c.AccessLogFormat); err != nil {
+		invalid("--access-log-format: %w", err)
+	}
+	if c.AccessLogSampleRate < 0 || c.AccessLogSampleRate > 1 {
+		invalid("--access-log-sample-rate %v is invalid: expected a value from 0 to 1", c.AccessLogSampleRate)
+	}
+	if c.CacheAddr != "" {
+		if _, _, err := net.SplitHostPort(c.CacheAddr); err != nil {
+			invalid("--cache-address %q is invalid: expected host:port, %w", c.CacheAddr, err)
+		}
+	}
+	if c.MiddlewarePluginDir != "" {
+		if info, err := os.Stat(c.MiddlewarePluginDir); err != nil || !info.IsDir() {
+			invalid("--middleware-plugin-dir %q is not a directory: create it or leave the flag empty to disable the plugins", c.MiddlewarePluginDir)
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("--otlp-endpoint %q is invalid: expected a URL like http://otel-collector:4317", c.OTLPEndpoint)
+		}
+	}
+	if c.RequeueDelaySeconds <= 0 {
+		invalid("--requeue-delay-seconds %d is invalid: expected a positive number of seconds", c.RequeueDelaySeconds)
+	}
+	if c.SnifferHistorySize < 0 {
+		invalid("--sniffer-history-size %d is invalid: expected 0, which disables the history, or more", c.SnifferHistorySize)
+	}
+	if _, err := sniffer.ParseSchemaConflictStrategy(c.SnifferSchemaConflictStrategy); err != nil {
+		invalid("--sniffer-schema-conflict-strategy: %w", err)
+	}
+	if c.SnifferUpstream != "" {
+		if u, err := url.Parse(c.SnifferUpstream); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("--sniffer-upstream %q is invalid: expected an origin like https://api.example.com", c.SnifferUpstream)
+		}
+	}
+	if c.SnifferWriteWindow < 0 {
+		invalid("--sniffer-write-window %s is invalid: expected 0, which writes synchronously, or more", c.SnifferWriteWindow)
+	}
+
+	certificate := func(flag string, dir string, names ...string) {
+		if dir == "" {
+			return
+		}
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				invalid("--%s %q has no %s: %w", flag, dir, name, err)
+			}
+		}
+	}
+	certificate("metrics-cert-path", c.MetricsCertPath, c.MetricsCertName, c.MetricsCertKey)
+	certificate("webhook-cert-path", c.WebhookCertPath, c.WebhookCertName, c.WebhookCertKey)
+
+	return conf, errors.Join(errs...)
+}
+
+// loadConfiguration loads the configuration file, strictly so that misspelled
+// fields are reported instead of ignored.
+func loadConfiguration(configFile string, required bool, scheme *k8s_runtime.Scheme) (conf configuration.NexusConfiguration, err error) {
+	in, err := os.ReadFile(configFile)
+	switch {
+	case os.IsNotExist(err) && !required:
+	case err != nil:
+		return conf, fmt.Errorf("--config-file %q cannot be read: %w", configFile, err)
+	default:
+		gvk := configuration.GroupVersion.WithKind("NexusConfiguration")
+		decoder := serializer.NewCodecFactory(scheme, serializer.EnableStrict).UniversalDeserializer()
+		if _, _, err := decoder.Decode(in, &gvk, &configuration.NexusConfiguration{}); err != nil {
+			return conf, fmt.Errorf("--config-file %q is invalid: %w", configFile, err)
+		}
+	}
+
+	// The configuration package panics on the errors it finds.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("--config-file %q is invalid: %v", configFile, r)
+		}
+	}()
+	return configuration.LoadConfiguration(configFile, scheme), nil
+}
+
+// validateConfiguration returns the problems of the values of the
+// configuration file, defaults included.
+func validateConfiguration(configFile string, conf configuration.NexusConfiguration) []error {
+	errs := []error{}
+	required := func(field string, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("--config-file %q: %s is required", configFile, field))
+		}
+	}
+	required("backendDefault.serverImage", conf.BackendDefault.ServerImage)
+	required("defaultImageRegistry.host", conf.DefaultImageRegistry.Host)
+	required("defaultNpmRegistry.host", conf.DefaultNpmRegistry.Host)
+	required("packageBuilder.image", conf.PackageBuilder.Image)
+
+	credentials := func(field string, registry configuration.Registry) {
+		if (registry.AuthData.Username == "") != (registry.AuthData.Password == "") {
+			errs = append(errs, fmt.Errorf("--config-file %q: %s.authData needs both a username and a password", configFile, field))
+		}
+	}
+	credentials("defaultImageRegistry", conf.DefaultImageRegistry)
+	credentials("defaultNpmRegistry", conf.DefaultNpmRegistry)
+
+	return errs
+}
+
+// validateBindAddress returns why an address is not one a server can bind to.
+func validateBindAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("expected [host]:port, %w", err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("expected a port from 0 to 65535")
+	}
+	return nil
+}
+
+// Report formats the problems of a startup configuration, one per line.
+func Report(err error) string {
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+
+	report := strings.Builder{}
+	fmt.Fprintf(&report, "the configuration has %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(&report, "  - %s\n", strings.ReplaceAll(problem.Error(), "\n", "\n    "))
+	}
+	return report.String()
+}
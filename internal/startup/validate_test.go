@@ -0,0 +1,158 @@
+package startup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"kdex.dev/crds/configuration"
+)
+
+func validConfig(t *testing.T) Config {
+	return Config{
+		ConfigFile:          filepath.Join(t.TempDir(), "config.yaml"),
+		ControllerNamespace: "kdex",
+		FocalHost:           "shop",
+		MetricsAddr:         "0",
+		ProbeAddr:           ":8081",
+		RequeueDelaySeconds: 15,
+		WebserverAddr:       ":8090",
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, configuration.AddToScheme(scheme))
+
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(t *testing.T, c *Config)
+		wantErrs []string
+	}{
+		{
+			name:   "defaults",
+			mutate: func(t *testing.T, c *Config) {},
+		},
+		{
+			name: "configuration file",
+			mutate: func(t *testing.T, c *Config) {
+				c.ConfigFile = writeConfig(t, "backendDefault:\n  serverImage: static:v1\ndefaultImageRegistry:\n  host: registry:5000\n")
+				c.ConfigFileSet = true
+			},
+		},
+		{
+			name: "missing focal host and namespace",
+			mutate: func(t *testing.T, c *Config) {
+				c.ControllerNamespace = ""
+				c.FocalHost = ""
+			},
+			wantErrs: []string{"--focal-host is required", "POD_NAMESPACE"},
+		},
+		{
+			name: "missing configuration file",
+			mutate: func(t *testing.T, c *Config) {
+				c.ConfigFileSet = true
+			},
+			wantErrs: []string{"cannot be read"},
+		},
+		{
+			name: "unknown field in configuration file",
+			mutate: func(t *testing.T, c *Config) {
+				c.ConfigFile = writeConfig(t, "backendDefault:\n  serverImag: static:v1\n")
+			},
+			wantErrs: []string{`unknown field "backendDefault.serverImag"`},
+		},
+		{
+			name: "cross field constraints of the configuration file",
+			mutate: func(t *testing.T, c *Config) {
+				c.ConfigFile = writeConfig(t, "packageBuilder:\n  image: \"\"\ndefaultNpmRegistry:\n  host: npm\n  authData:\n    username: joe\n")
+			},
+			wantErrs: []string{"packageBuilder.image is required", "defaultNpmRegistry.authData needs both"},
+		},
+		{
+			name: "invalid addresses",
+			mutate: func(t *testing.T, c *Config) {
+				c.CacheAddr = "valkey"
+				c.MetricsAddr = ":8081"
+				c.PprofAddr = "localhost:99999"
+				c.WebserverAddr = "8090"
+			},
+			wantErrs: []string{
+				"--cache-address",
+				"--metrics-bind-address \":8081\" uses the port of --health-probe-bind-address",
+				"--pprof-bind-address",
+				"--webserver-bind-address",
+			},
+		},
+		{
+			name: "invalid values",
+			mutate: func(t *testing.T, c *Config) {
+				c.AccessLogFormat = "xml"
+				c.AccessLogSampleRate = 2
+				c.MetricsCertPath = t.TempDir()
+				c.MetricsCertName = "tls.crt"
+				c.MiddlewarePluginDir = filepath.Join(t.TempDir(), "plugins")
+				c.OTLPEndpoint = "otel-collector"
+				c.RequeueDelaySeconds = 0
+				c.SnifferHistorySize = -1
+				c.SnifferSchemaConflictStrategy = "newest"
+				c.SnifferUpstream = "/api"
+				c.SnifferWriteWindow = -1
+			},
+			wantErrs: []string{
+				"--access-log-format",
+				"--access-log-sample-rate",
+				"--metrics-cert-path",
+				"--middleware-plugin-dir",
+				"--otlp-endpoint",
+				"--requeue-delay-seconds",
+				"--sniffer-history-size",
+				"--sniffer-schema-conflict-strategy",
+				"--sniffer-upstream",
+				"--sniffer-write-window",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig(t)
+			tt.mutate(t, &c)
+			conf, err := c.Validate(scheme)
+			if len(tt.wantErrs) == 0 {
+				require.NoError(t, err)
+				assert.NotEmpty(t, conf.BackendDefault.ServerImage)
+				return
+			}
+			require.Error(t, err)
+			report := Report(err)
+			for _, want := range tt.wantErrs {
+				assert.Contains(t, report, want)
+			}
+			assert.Equal(t, len(strings.Split(err.Error(), "\n")), strings.Count(report, "\n  - "), report)
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	c := validConfig(t)
+	c.FocalHost = ""
+	c.RequeueDelaySeconds = 0
+	scheme := runtime.NewScheme()
+	require.NoError(t, configuration.AddToScheme(scheme))
+	_, err := c.Validate(scheme)
+
+	report := Report(err)
+	assert.True(t, strings.HasPrefix(report, "the configuration has 2 problem(s):\n"), report)
+	assert.Contains(t, report, "  - --focal-host is required")
+	assert.Contains(t, report, "  - --requeue-delay-seconds 0 is invalid")
+}
@@ -0,0 +1,360 @@
+package themebuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	// FontsAnnotation holds, on a theme with SCSS sources, the JSON encoded
+	// list of Font families to self host. The families are downloaded and
+	// subset to the languages of the host at build time, and the @font-face
+	// rules of the compiled stylesheets are rewritten to serve them from the
+	// asset image.
+	FontsAnnotation = "kdex.dev/theme-fonts"
+
+	// PreloadAttribute is the theme status attribute of the font files to
+	// preload, as comma separated paths relative to the asset image.
+	PreloadAttribute = "build.preload"
+
+	fontsContainer = "font-subsetter"
+	googleFontsURL = "https://fonts.googleapis.com/css2"
+)
+
+// fontsScript downloads the faces of the fonts, subsets them to the unicode
+// ranges of the host into ${WORKDIR}/fonts and writes their @font-face rules
+// to ${WORKDIR}/fonts.css.
+const fontsScript = `set -e
+
+pip install --quiet --disable-pip-version-check --root-user-action=ignore fonttools brotli
+
+mkdir -p ${WORKDIR}/fonts
+
+python3 - <<'EOF'
+import json, os, re, sys, urllib.parse, urllib.request
+from fontTools import subset
+
+workdir = os.environ["WORKDIR"]
+unicodes = os.environ.get("FONT_UNICODES", "*")
+
+def fail(message):
+    with open("/dev/termination-log", "w") as f:
+        f.write(message)
+    sys.exit(message)
+
+def fetch(url):
+    request = urllib.request.Request(url, headers={"User-Agent": "kdex-theme-build"})
+    with urllib.request.urlopen(request, timeout=60) as response:
+        return response.read()
+
+def matches(block, face):
+    style = re.search(r"font-style:\s*([a-z]+)", block)
+    if (style.group(1) if style else "normal") != face["style"]:
+        return False
+    weight = re.search(r"font-weight:\s*(\d+)(?:\s+(\d+))?", block)
+    if not weight:
+        return face["weight"] == 400
+    low = int(weight.group(1))
+    high = int(weight.group(2) or low)
+    return low <= face["weight"] <= high
+
+stylesheets = {}
+rules = []
+for face in json.loads(os.environ["FONTS"]):
+    if face["url"] not in stylesheets:
+        try:
+            stylesheets[face["url"]] = fetch(face["url"]).decode()
+        except Exception as e:
+            fail("failed to download %s: %s" % (face["url"], e))
+
+    src = None
+    for block in re.findall(r"@font-face\s*{([^}]*)}", stylesheets[face["url"]]):
+        if matches(block, face):
+            src = re.search(r"url\(\s*['\"]?([^'\")]+)", block)
+            break
+    if src is None:
+        fail("%s has no %s %d face in %s" % (face["family"], face["style"], face["weight"], face["url"]))
+
+    original = os.path.join(workdir, face["file"] + ".orig")
+    try:
+        with open(original, "wb") as f:
+            f.write(fetch(urllib.parse.urljoin(face["url"], src.group(1))))
+    except Exception as e:
+        fail("failed to download %s: %s" % (src.group(1), e))
+
+    subset.main([
+        original,
+        "--output-file=" + os.path.join(workdir, face["file"]),
+        "--flavor=woff2",
+        "--layout-features=*",
+        "--unicodes=" + unicodes,
+    ])
+    os.remove(original)
+
+    rule = '@font-face{font-family:"%s";font-style:%s;font-weight:%d;font-display:%s;src:url(%s) format("woff2")' % (
+        face["family"], face["style"], face["weight"], face["display"], face["file"])
+    if unicodes != "*":
+        rule += ";unicode-range:" + unicodes
+    rules.append(rule + "}")
+
+with open(os.path.join(workdir, "fonts.css"), "w") as f:
+    f.write("".join(rules))
+EOF
+`
+
+// rewriteFontsScript replaces, in the compiled stylesheets using the fonts,
+// the imports of font CDNs and the @font-face rules of the fonts with the
+// rules of the self hosted faces.
+const rewriteFontsScript = `
+if [ -f ${WORKDIR}/fonts.css ]; then
+  mkdir -p dist/fonts
+  cp ${WORKDIR}/fonts/*.woff2 dist/fonts/
+
+  node - <<'EOF'
+const fs = require('fs');
+
+const families = [...new Set(JSON.parse(process.env.FONTS).map(f => f.family.toLowerCase()))];
+const faces = fs.readFileSync(process.env.WORKDIR + '/fonts.css', 'utf8');
+
+for (const file of fs.readdirSync('dist').filter(f => f.endsWith('.css'))) {
+  let css = fs.readFileSync('dist/' + file, 'utf8');
+  if (!families.some(family => css.toLowerCase().includes(family))) {
+    continue;
+  }
+
+  const head = css.match(/^(\uFEFF|@charset\s+"[^"]*";)?/)[0];
+  css = css.slice(head.length)
+    .replace(/@import\s+(url\()?\s*["']?https?:\/\/fonts\.(googleapis|gstatic|bunny)\.[^;]*;/g, '')
+    .replace(/@font-face\s*{[^}]*}/g, rule => {
+      const family = rule.match(/font-family\s*:\s*["']?([^;"'}]+)/);
+      return family && families.includes(family[1].trim().toLowerCase()) ? '' : rule;
+    });
+
+  fs.writeFileSync('dist/' + file, head + faces + css);
+}
+EOF
+fi
+`
+
+var (
+	fontFamilyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ]*$`)
+	fontDisplays      = []string{"auto", "block", "fallback", "optional", "swap"}
+	fontStyles        = []string{"normal", "italic"}
+)
+
+// Font is a font family served from the asset image of a theme.
+type Font struct {
+	// Display is the font-display of the faces, swap by default.
+	Display string `json:"display,omitempty"`
+	Family  string `json:"family"`
+	// Preload adds preload hints for the faces of the family to the pages.
+	Preload bool `json:"preload,omitempty"`
+	// Styles are normal and/or italic, normal by default.
+	Styles []string `json:"styles,omitempty"`
+	// URL is the stylesheet declaring the faces of the family, Google Fonts by
+	// default. It is only downloaded at build time.
+	URL string `json:"url,omitempty"`
+	// Weights default to 400.
+	Weights []int `json:"weights,omitempty"`
+}
+
+// fontFace is a weight and style of a font, subset into File.
+type fontFace struct {
+	Display string `json:"display"`
+	Family  string `json:"family"`
+	File    string `json:"file"`
+	Style   string `json:"style"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+}
+
+// ParseFonts returns the fonts of the annotations of a theme, with their
+// defaults, nil when FontsAnnotation is not set.
+func ParseFonts(annotations map[string]string) ([]Font, error) {
+	value := annotations[FontsAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	fonts := []Font{}
+	if err := json.Unmarshal([]byte(value), &fonts); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", FontsAnnotation, err)
+	}
+
+	seen := map[string]bool{}
+	for i := range fonts {
+		font := &fonts[i]
+		if !fontFamilyPattern.MatchString(font.Family) || seen[strings.ToLower(font.Family)] {
+			return nil, fmt.Errorf("invalid %s annotation: invalid or duplicate family %q", FontsAnnotation, font.Family)
+		}
+		seen[strings.ToLower(font.Family)] = true
+
+		if font.Display == "" {
+			font.Display = "swap"
+		}
+		if !slices.Contains(fontDisplays, font.Display) {
+			return nil, fmt.Errorf("invalid %s annotation: invalid display %q of %s", FontsAnnotation, font.Display, font.Family)
+		}
+
+		if len(font.Styles) == 0 {
+			font.Styles = []string{"normal"}
+		}
+		for _, style := range font.Styles {
+			if !slices.Contains(fontStyles, style) {
+				return nil, fmt.Errorf("invalid %s annotation: invalid style %q of %s", FontsAnnotation, style, font.Family)
+			}
+		}
+		slices.SortFunc(font.Styles, func(a, b string) int {
+			return slices.Index(fontStyles, a) - slices.Index(fontStyles, b)
+		})
+		font.Styles = slices.Compact(font.Styles)
+
+		if len(font.Weights) == 0 {
+			font.Weights = []int{400}
+		}
+		for _, weight := range font.Weights {
+			if weight < 1 || weight > 1000 {
+				return nil, fmt.Errorf("invalid %s annotation: invalid weight %d of %s", FontsAnnotation, weight, font.Family)
+			}
+		}
+		slices.Sort(font.Weights)
+		font.Weights = slices.Compact(font.Weights)
+
+		if font.URL != "" {
+			if u, err := url.Parse(font.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+				return nil, fmt.Errorf("invalid %s annotation: invalid url %q of %s", FontsAnnotation, font.URL, font.Family)
+			}
+		}
+	}
+
+	return fonts, nil
+}
+
+// stylesheet returns the URL of the stylesheet declaring the faces of the
+// font.
+func (f *Font) stylesheet() string {
+	if f.URL != "" {
+		return f.URL
+	}
+
+	tuples := []string{}
+	for _, style := range f.Styles {
+		italic := 0
+		if style == "italic" {
+			italic = 1
+		}
+		for _, weight := range f.Weights {
+			tuples = append(tuples, fmt.Sprintf("%d,%d", italic, weight))
+		}
+	}
+	return fmt.Sprintf("%s?family=%s:ital,wght@%s", googleFontsURL, url.QueryEscape(f.Family), strings.Join(tuples, ";"))
+}
+
+func (f *Font) faces() []fontFace {
+	slug := strings.ToLower(strings.ReplaceAll(f.Family, " ", "-"))
+	faces := []fontFace{}
+	for _, style := range f.Styles {
+		for _, weight := range f.Weights {
+			faces = append(faces, fontFace{
+				Display: f.Display,
+				Family:  f.Family,
+				File:    fmt.Sprintf("fonts/%s-%d-%s.woff2", slug, weight, style),
+				Style:   style,
+				URL:     f.stylesheet(),
+				Weight:  weight,
+			})
+		}
+	}
+	return faces
+}
+
+func fontFaces(fonts []Font) []fontFace {
+	faces := []fontFace{}
+	for _, font := range fonts {
+		faces = append(faces, font.faces()...)
+	}
+	return faces
+}
+
+// PreloadFiles returns the files of the faces of the fonts to preload.
+func PreloadFiles(fonts []Font) []string {
+	files := []string{}
+	for _, font := range fonts {
+		if !font.Preload {
+			continue
+		}
+		for _, face := range font.faces() {
+			files = append(files, face.File)
+		}
+	}
+	return files
+}
+
+// unicodeRanges are the ranges of the scripts of the languages of a host,
+// after the subsets of Google Fonts.
+var unicodeRanges = map[string]string{
+	"Latn":      "U+0000-00FF,U+0131,U+0152-0153,U+02BB-02BC,U+02C6,U+02DA,U+02DC,U+0304,U+0308,U+0329,U+2000-206F,U+20AC,U+2122,U+2191,U+2193,U+2212,U+2215,U+FEFF,U+FFFD",
+	"latin-ext": "U+0100-02BA,U+02BD-02C5,U+02C7-02CC,U+02CE-02D7,U+02DD-02FF,U+1D00-1DBF,U+1E00-1E9F,U+1EF2-1EFF,U+2020,U+20A0-20AB,U+20AD-20C0,U+2113,U+2C60-2C7F,U+A720-A7FF",
+	"vi":        "U+0102-0103,U+0110-0111,U+0128-0129,U+0168-0169,U+01A0-01A1,U+01AF-01B0,U+0300-0301,U+0303-0304,U+0308-0309,U+0323,U+0329,U+1EA0-1EF9,U+20AB",
+	"Arab":      "U+0600-06FF,U+0750-077F,U+0870-088E,U+0890-0891,U+0897-08E1,U+08E3-08FF,U+200C-200E,U+2010-2011,U+204F,U+2E41,U+FB50-FDFF,U+FE70-FE74,U+FE76-FEFC",
+	"Cyrl":      "U+0301,U+0400-045F,U+0460-052F,U+1C80-1C8A,U+20B4,U+2116,U+2DE0-2DFF,U+A640-A69F,U+FE2E-FE2F",
+	"Deva":      "U+0900-097F,U+1CD0-1CF9,U+200C-200D,U+20A8,U+20B9,U+20F0,U+25CC,U+A830-A839,U+A8E0-A8FF",
+	"Grek":      "U+0370-0377,U+037A-037F,U+0384-038A,U+038C,U+038E-03A1,U+03A3-03FF,U+1F00-1FFF",
+	"Hebr":      "U+0307-0308,U+0590-05FF,U+200C-2010,U+20AA,U+25CC,U+FB1D-FB4F",
+	"Thai":      "U+02D7,U+0303,U+0331,U+0E01-0E5B,U+200C-200D,U+25CC",
+	"Hani":      "U+3000-303F,U+3400-4DBF,U+4E00-9FFF,U+F900-FAFF,U+FF00-FFEF",
+	"Kana":      "U+3040-30FF,U+31F0-31FF",
+	"Hang":      "U+1100-11FF,U+3130-318F,U+AC00-D7AF",
+}
+
+// latinLanguages are covered by the basic latin subset, other languages in
+// the latin script need latin-ext.
+var latinLanguages = []string{"ca", "da", "de", "en", "es", "fi", "fr", "ga", "id", "is", "it", "ms", "nb", "nl", "nn", "no", "pt", "sv"}
+
+// UnicodeRanges returns the unicode ranges covering the languages, "*" (no
+// subsetting) when the script of one of them is not known. The basic latin
+// range is always included for digits and punctuation.
+func UnicodeRanges(langs []string) string {
+	subsets := []string{"Latn"}
+	for _, lang := range langs {
+		if lang == "" {
+			continue
+		}
+		tag := language.Make(lang)
+		base, _ := tag.Base()
+		script, _ := tag.Script()
+
+		switch script.String() {
+		case "Latn":
+			switch {
+			case base.String() == "vi":
+				subsets = append(subsets, "latin-ext", "vi")
+			case !slices.Contains(latinLanguages, base.String()):
+				subsets = append(subsets, "latin-ext")
+			}
+		case "Hans", "Hant":
+			subsets = append(subsets, "Hani")
+		case "Jpan":
+			subsets = append(subsets, "Hani", "Kana")
+		case "Kore":
+			subsets = append(subsets, "Hani", "Hang")
+		default:
+			if _, ok := unicodeRanges[script.String()]; !ok {
+				return "*"
+			}
+			subsets = append(subsets, script.String())
+		}
+	}
+
+	ranges := []string{}
+	for _, subset := range slices.Compact(slices.Sorted(slices.Values(subsets))) {
+		ranges = append(ranges, unicodeRanges[subset])
+	}
+	return strings.Join(ranges, ",")
+}
@@ -0,0 +1,147 @@
+package themebuild
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseFonts(t *testing.T) {
+	fonts, err := ParseFonts(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, fonts)
+
+	fonts, err = ParseFonts(map[string]string{
+		FontsAnnotation: `[{"family":"Inter","weights":[700,400,700],"styles":["italic","normal"],"preload":true},{"family":"Fira Code","url":"https://cdn.example.com/fira.css"}]`,
+	})
+	require.NoError(t, err)
+	require.Len(t, fonts, 2)
+	assert.Equal(t, Font{Display: "swap", Family: "Inter", Preload: true, Styles: []string{"normal", "italic"}, Weights: []int{400, 700}}, fonts[0])
+	assert.Equal(t, []string{"normal"}, fonts[1].Styles)
+	assert.Equal(t, []int{400}, fonts[1].Weights)
+
+	assert.Equal(t, "https://fonts.googleapis.com/css2?family=Inter:ital,wght@0,400;0,700;1,400;1,700", fonts[0].stylesheet())
+	assert.Equal(t, "https://cdn.example.com/fira.css", fonts[1].stylesheet())
+
+	assert.Equal(t, []string{
+		"fonts/inter-400-normal.woff2",
+		"fonts/inter-700-normal.woff2",
+		"fonts/inter-400-italic.woff2",
+		"fonts/inter-700-italic.woff2",
+	}, PreloadFiles(fonts))
+
+	for _, value := range []string{
+		`{}`,
+		`[{"family":""}]`,
+		`[{"family":"Inter\"}"}]`,
+		`[{"family":"Inter"},{"family":"inter"}]`,
+		`[{"family":"Inter","display":"eventually"}]`,
+		`[{"family":"Inter","styles":["oblique"]}]`,
+		`[{"family":"Inter","weights":[0]}]`,
+		`[{"family":"Inter","url":"http://fonts.example.com/inter.css"}]`,
+	} {
+		_, err := ParseFonts(map[string]string{FontsAnnotation: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestUnicodeRanges(t *testing.T) {
+	latin := unicodeRanges["Latn"]
+
+	assert.Equal(t, latin, UnicodeRanges(nil))
+	assert.Equal(t, latin, UnicodeRanges([]string{"en", "fr-CA", "de", ""}))
+	assert.Equal(t, latin+","+unicodeRanges["latin-ext"], UnicodeRanges([]string{"en", "pl"}))
+	assert.Equal(t, unicodeRanges["Cyrl"]+","+latin, UnicodeRanges([]string{"ru", "en"}))
+	assert.Contains(t, UnicodeRanges([]string{"vi"}), unicodeRanges["vi"])
+	assert.Contains(t, UnicodeRanges([]string{"ja"}), unicodeRanges["Kana"])
+	assert.Equal(t, "*", UnicodeRanges([]string{"en", "am"}))
+}
+
+func TestGetOrCreateJobWithFonts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	host := &kdexv1alpha1.KDexInternalHost{}
+	host.Name = "shop"
+	host.Namespace = "kdex"
+	host.UID = "uid"
+
+	theme := &kdexv1alpha1.KDexTheme{}
+	theme.Name = "brand"
+	theme.Namespace = "kdex"
+
+	sources := &corev1.ConfigMap{Data: map[string]string{"main.scss": "body { font-family: Inter; }"}}
+
+	fonts, err := ParseFonts(map[string]string{FontsAnnotation: `[{"family":"Inter","weights":[400,700],"preload":true}]`})
+	require.NoError(t, err)
+
+	builder := ThemeBuild{
+		Client:           fake.NewClientBuilder().WithScheme(scheme).Build(),
+		BuilderImage:     "node:25-alpine",
+		FontBuilderImage: "python:3.13-alpine",
+		Fonts:            fonts,
+		ImageRegistry:    kdexv1alpha1.Registry{Host: "registry.example.com"},
+		Log:              logr.Discard(),
+		PackageBuilder:   &configuration.PackageBuilder{Image: "kdex/packager:1"},
+		Scheme:           scheme,
+		Unicodes:         UnicodeRanges([]string{"en"}),
+	}
+
+	checksum := builder.Checksum(sources)
+	assert.NotEqual(t, SourcesChecksum(sources), checksum)
+	languages := builder
+	languages.Unicodes = UnicodeRanges([]string{"en", "ru"})
+	assert.NotEqual(t, checksum, languages.Checksum(sources))
+
+	job, err := builder.GetOrCreateJob(context.Background(), host, theme, sources)
+	require.NoError(t, err)
+	assert.Equal(t, "shop-theme-brand-"+checksum, job.Name)
+
+	spec := job.Spec.Template.Spec
+	require.Len(t, spec.InitContainers, 2)
+	assert.Equal(t, fontsContainer, spec.InitContainers[0].Name)
+	assert.Equal(t, "python:3.13-alpine", spec.InitContainers[0].Image)
+	assert.Equal(t, compilerContainer, spec.InitContainers[1].Name)
+	assert.Contains(t, spec.InitContainers[1].Env, corev1.EnvVar{Name: "FONT_UNICODES", Value: builder.Unicodes})
+
+	var faces []fontFace
+	for _, env := range spec.InitContainers[0].Env {
+		if env.Name == "FONTS" {
+			require.NoError(t, json.Unmarshal([]byte(env.Value), &faces))
+		}
+	}
+	require.Len(t, faces, 2)
+	assert.Equal(t, fontFace{
+		Display: "swap",
+		Family:  "Inter",
+		File:    "fonts/inter-700-normal.woff2",
+		Style:   "normal",
+		URL:     "https://fonts.googleapis.com/css2?family=Inter:ital,wght@0,400;0,700",
+		Weight:  700,
+	}, faces[1])
+
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{"kdex.dev/generation": checksum}
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  compilerContainer,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "abc  fonts/inter-400-normal.woff2\ndef  main.css\n"}},
+	}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  packagerContainer,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "sha256:fff\n"}},
+	}}
+	result := builder.Harvest(host, theme, pod)
+	require.NotNil(t, result)
+	assert.Equal(t, []string{"fonts/inter-400-normal.woff2"}, result.Preload)
+}
@@ -0,0 +1,457 @@
+package themebuild
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/kdex-tech/host-manager/internal"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SourcesAnnotation names, on a theme, the ConfigMap holding its SCSS
+	// sources. The ConfigMap is looked up in the namespace of the theme, or in
+	// the namespace of the controller for cluster themes. Partials (files
+	// starting with "_") are only imported, a postcss.config.js runs PostCSS
+	// over the compiled stylesheets and any other file is copied as is.
+	SourcesAnnotation = "kdex.dev/theme-sources"
+
+	// ImageAttribute is the theme status attribute of the compiled asset
+	// image, pinned to its digest.
+	ImageAttribute = "build.image"
+	// DigestsAttribute is the theme status attribute of the digests of the
+	// compiled files, as comma separated file=sha256:digest pairs.
+	DigestsAttribute = "build.digests"
+	// SourcesAttribute is the theme status attribute of the checksum of the
+	// sources the image was compiled from.
+	SourcesAttribute = "build.sources"
+
+	// JobApp is the app label of the jobs compiling themes.
+	JobApp = "theme-build"
+
+	compilerContainer = "theme-compiler"
+	packagerContainer = "packager"
+	sourcesVolume     = "theme-sources"
+)
+
+// compileScript compiles the SCSS sources into ${WORKDIR}/dist, adds the
+// subset fonts, and records the digests of the compiled files in the
+// termination message.
+const compileScript = `set -e
+
+mkdir -p ${WORKDIR}/src ${WORKDIR}/dist
+cp -L /sources/* ${WORKDIR}/src/
+
+cd ${WORKDIR}
+
+cat > package.json <<'EOF'
+{
+  "name": "theme",
+  "private": true,
+  "devDependencies": {
+    "autoprefixer": "^10.4.21",
+    "postcss": "^8.5.6",
+    "postcss-cli": "^11.0.1",
+    "sass": "^1.93.2"
+  }
+}
+EOF
+
+npm install
+
+npx sass --no-source-map --style=compressed src:dist
+
+if [ -f src/postcss.config.js ]; then
+  cp src/postcss.config.js postcss.config.js
+  npx postcss "dist/*.css" --replace
+fi
+
+for f in src/*; do
+  case "$(basename "$f")" in
+    *.scss|*.sass|postcss.config.js) ;;
+    *) cp "$f" dist/ ;;
+  esac
+done
+
+` + rewriteFontsScript + `
+cd dist
+find . -type f | sed 's|^\./||' | sort | xargs sha256sum > /dev/termination-log
+`
+
+// ThemeBuild compiles the SCSS sources of themes into an asset image served
+// as the static image of their backend.
+type ThemeBuild struct {
+	client.Client
+	BuilderImage      string
+	FontBuilderImage  string
+	Fonts             []Font
+	ImagePullSecrets  []corev1.LocalObjectReference
+	ImageRegistry     kdexv1alpha1.Registry
+	Log               logr.Logger
+	NPMSecretRef      *corev1.LocalObjectReference
+	PackageBuilder    *configuration.PackageBuilder
+	Scheme            *runtime.Scheme
+	ServiceAccountRef corev1.LocalObjectReference
+	// Unicodes are the ranges the fonts are subset to.
+	Unicodes string
+}
+
+// Result is the output of a successful theme build.
+type Result struct {
+	Digests map[string]string
+	Image   string
+	Preload []string
+}
+
+// SourcesChecksum returns a checksum of the sources of a theme, which
+// changes whenever one of them does.
+func SourcesChecksum(sources *corev1.ConfigMap) string {
+	hash := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(sources.Data)) {
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, sources.Data[key])
+	}
+	for _, key := range slices.Sorted(maps.Keys(sources.BinaryData)) {
+		fmt.Fprintf(hash, "%s\x00", key)
+		hash.Write(sources.BinaryData[key])
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// Checksum returns a checksum of the sources and the fonts of a theme. It is
+// the checksum of the sources for themes without fonts.
+func (b *ThemeBuild) Checksum(sources *corev1.ConfigMap) string {
+	checksum := SourcesChecksum(sources)
+	if len(b.Fonts) == 0 {
+		return checksum
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", checksum, b.Unicodes)
+	_ = json.NewEncoder(hash).Encode(b.Fonts)
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// ParseDigests reads the sha256sum output of the compiler.
+func ParseDigests(message string) map[string]string {
+	digests := map[string]string{}
+	for line := range strings.Lines(message) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		digests[strings.TrimPrefix(fields[1], "*")] = "sha256:" + fields[0]
+	}
+	return digests
+}
+
+// FormatDigests encodes the digests as DigestsAttribute.
+func FormatDigests(digests map[string]string) string {
+	pairs := make([]string, 0, len(digests))
+	for _, file := range slices.Sorted(maps.Keys(digests)) {
+		pairs = append(pairs, file+"="+digests[file])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Name returns the name of the build objects of the theme for the host. It
+// tells namespaced and cluster themes of the same name apart.
+func Name(host string, theme client.Object) string {
+	kind := "theme"
+	if theme.GetNamespace() == "" {
+		kind = "clustertheme"
+	}
+	return fmt.Sprintf("%s-%s-%s", host, kind, theme.GetName())
+}
+
+// JobLabels returns the labels of the build objects of the theme.
+func JobLabels(theme client.Object) map[string]string {
+	kind := "theme"
+	if theme.GetNamespace() == "" {
+		kind = "clustertheme"
+	}
+	return map[string]string{
+		"app":        JobApp,
+		"theme":      truncate(theme.GetName(), 63),
+		"theme-kind": kind,
+	}
+}
+
+// ImageRepository returns the repository of the compiled images of the theme.
+func (b *ThemeBuild) ImageRepository(host string, theme client.Object) string {
+	return fmt.Sprintf("%s/%s", b.ImageRegistry.Host, Name(host, theme))
+}
+
+// GetOrCreateJob runs a job compiling the sources of the theme, once per
+// checksum of its sources. The sources are copied in a ConfigMap of the same
+// name owned by the host, next to the job.
+func (b *ThemeBuild) GetOrCreateJob(
+	ctx context.Context,
+	owner client.Object,
+	theme client.Object,
+	sources *corev1.ConfigMap,
+) (*batchv1.Job, error) {
+	name := Name(owner.GetName(), theme)
+	checksum := b.Checksum(sources)
+	jobName := fmt.Sprintf("%s-%s", truncate(name, 63-len(checksum)-1), checksum)
+
+	job := &batchv1.Job{}
+	err := b.Get(ctx, client.ObjectKey{Namespace: owner.GetNamespace(), Name: jobName}, job)
+	if err == nil {
+		return job, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: owner.GetNamespace(),
+		},
+	}
+	if _, err := ctrl.CreateOrUpdate(ctx, b.Client, configMap, func() error {
+		configMap.Labels = JobLabels(theme)
+		configMap.Labels["kdex.dev/generation"] = checksum
+		configMap.Data = maps.Clone(sources.Data)
+		configMap.BinaryData = maps.Clone(sources.BinaryData)
+		return ctrl.SetControllerReference(owner, configMap, b.Scheme)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to copy theme sources: %w", err)
+	}
+
+	job = b.job(owner, theme, jobName, checksum)
+
+	if err := ctrl.SetControllerReference(owner, job, b.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to create theme build job: %w", err)
+	}
+
+	if err := b.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create theme build job: %w", err)
+	}
+
+	return job, nil
+}
+
+func (b *ThemeBuild) job(owner client.Object, theme client.Object, jobName string, checksum string) *batchv1.Job {
+	volumes := []corev1.Volume{
+		{
+			Name: internal.SHARED_VOLUME,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		{
+			Name: sourcesVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: jobName,
+					},
+				},
+			},
+		},
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      internal.SHARED_VOLUME,
+			MountPath: internal.WORKDIR,
+		},
+		{
+			Name:      sourcesVolume,
+			MountPath: "/sources",
+			ReadOnly:  true,
+		},
+	}
+
+	imagePullSecret := ""
+	if len(b.ImagePullSecrets) > 0 {
+		imagePullSecret = b.ImagePullSecrets[0].Name
+		volumes = append(volumes, corev1.Volume{
+			Name: imagePullSecret,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: imagePullSecret,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      imagePullSecret,
+			MountPath: "/var/run/secrets/image-pull-secrets/" + imagePullSecret,
+			ReadOnly:  true,
+		})
+	}
+
+	if b.NPMSecretRef != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: "npmrc",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: b.NPMSecretRef.Name,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "npmrc",
+			MountPath: internal.WORKDIR + "/.npmrc",
+			SubPath:   ".npmrc",
+			ReadOnly:  true,
+		})
+	}
+
+	env := []corev1.EnvVar{
+		{
+			Name:  "IMAGE_URL",
+			Value: fmt.Sprintf("%s:%s", b.ImageRepository(owner.GetName(), theme), checksum),
+		},
+		{
+			Name:  "PACKAGING_DIR",
+			Value: internal.WORKDIR + "/dist",
+		},
+		{
+			Name:  "WORKDIR",
+			Value: internal.WORKDIR,
+		},
+	}
+
+	if imagePullSecret != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "IMAGE_PULL_SECRET",
+			Value: "/var/run/secrets/image-pull-secrets/" + imagePullSecret + "/.dockerconfigjson",
+		})
+	}
+
+	if b.ImageRegistry.Insecure {
+		env = append(env, corev1.EnvVar{
+			Name:  "ORAS_ARGS",
+			Value: "--plain-http",
+		})
+	}
+
+	initContainers := []corev1.Container{}
+	if len(b.Fonts) > 0 {
+		faces, _ := json.Marshal(fontFaces(b.Fonts))
+		env = append(env, corev1.EnvVar{
+			Name:  "FONTS",
+			Value: string(faces),
+		}, corev1.EnvVar{
+			Name:  "FONT_UNICODES",
+			Value: b.Unicodes,
+		})
+		initContainers = append(initContainers, corev1.Container{
+			Name: fontsContainer,
+
+			Command:      []string{"sh", "-c", fontsScript},
+			Env:          env,
+			Image:        b.FontBuilderImage,
+			VolumeMounts: volumeMounts,
+		})
+	}
+	initContainers = append(initContainers, corev1.Container{
+		Name: compilerContainer,
+
+		Command:      []string{"sh", "-c", compileScript},
+		Env:          env,
+		Image:        b.BuilderImage,
+		VolumeMounts: volumeMounts,
+	})
+
+	labels := JobLabels(theme)
+	labels["kdex.dev/generation"] = checksum
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: owner.GetNamespace(),
+			Labels:    labels,
+			Annotations: map[string]string{
+				"kdex.dev/generation": checksum,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: new(int32(3)),
+			Completions:  new(int32(1)),
+			Parallelism:  new(int32(1)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"kdex.dev/generation": checksum,
+					},
+				},
+				Spec: corev1.PodSpec{
+					AutomountServiceAccountToken: new(true),
+					Containers: []corev1.Container{
+						{
+							Name: packagerContainer,
+
+							Command:         []string{"package_image"},
+							Env:             env,
+							Image:           b.PackageBuilder.Image,
+							ImagePullPolicy: b.PackageBuilder.ImagePullPolicy,
+							VolumeMounts:    volumeMounts,
+						},
+					},
+					ImagePullSecrets:   b.ImagePullSecrets,
+					InitContainers:     initContainers,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: b.ServiceAccountRef.Name,
+					Volumes:            volumes,
+				},
+			},
+		},
+	}
+}
+
+// Harvest returns the result of the succeeded job from the termination
+// messages of its pod, nil while they are not available.
+func (b *ThemeBuild) Harvest(owner client.Object, theme client.Object, pod *corev1.Pod) *Result {
+	var digest, digests string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == packagerContainer && status.State.Terminated != nil {
+			digest = strings.TrimSpace(status.State.Terminated.Message)
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name == compilerContainer && status.State.Terminated != nil {
+			digests = status.State.Terminated.Message
+		}
+	}
+	if digest == "" || digests == "" {
+		return nil
+	}
+
+	result := &Result{
+		Digests: ParseDigests(digests),
+		Image: fmt.Sprintf(
+			"%s:%s@%s", b.ImageRepository(owner.GetName(), theme), pod.Annotations["kdex.dev/generation"], digest,
+		),
+	}
+	for _, file := range PreloadFiles(b.Fonts) {
+		if _, ok := result.Digests[file]; ok {
+			result.Preload = append(result.Preload, file)
+		}
+	}
+	return result
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.TrimRight(s[:n], "-.")
+}
@@ -0,0 +1,108 @@
+package themebuild
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSourcesChecksum(t *testing.T) {
+	sources := &corev1.ConfigMap{Data: map[string]string{"main.scss": "@use 'variables';", "_variables.scss": "$brand: #e30;"}}
+	checksum := SourcesChecksum(sources)
+	assert.Len(t, checksum, 12)
+	assert.Equal(t, checksum, SourcesChecksum(sources.DeepCopy()))
+
+	sources.Data["_variables.scss"] = "$brand: #03e;"
+	assert.NotEqual(t, checksum, SourcesChecksum(sources))
+
+	sources.BinaryData = map[string][]byte{"logo.png": {0x89, 0x50}}
+	assert.NotEqual(t, checksum, SourcesChecksum(sources))
+}
+
+func TestDigests(t *testing.T) {
+	digests := ParseDigests("abc123  main.css\ndef456 *print.css\n\n")
+	assert.Equal(t, map[string]string{"main.css": "sha256:abc123", "print.css": "sha256:def456"}, digests)
+	assert.Equal(t, "main.css=sha256:abc123,print.css=sha256:def456", FormatDigests(digests))
+}
+
+func TestGetOrCreateJob(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, kdexv1alpha1.AddToScheme(scheme))
+
+	host := &kdexv1alpha1.KDexInternalHost{}
+	host.Name = "shop"
+	host.Namespace = "kdex"
+	host.UID = "uid"
+
+	theme := &kdexv1alpha1.KDexClusterTheme{}
+	theme.Name = "brand"
+
+	sources := &corev1.ConfigMap{Data: map[string]string{"main.scss": "body { color: red; }"}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	builder := ThemeBuild{
+		Client:         c,
+		BuilderImage:   "node:25-alpine",
+		ImageRegistry:  kdexv1alpha1.Registry{Host: "registry.example.com", Insecure: true},
+		Log:            logr.Discard(),
+		PackageBuilder: &configuration.PackageBuilder{Image: "kdex/packager:1"},
+		Scheme:         scheme,
+	}
+
+	job, err := builder.GetOrCreateJob(context.Background(), host, theme, sources)
+	require.NoError(t, err)
+
+	checksum := SourcesChecksum(sources)
+	assert.Equal(t, "shop-clustertheme-brand-"+checksum, job.Name)
+	assert.Equal(t, "kdex", job.Namespace)
+	assert.Equal(t, "clustertheme", job.Labels["theme-kind"])
+	assert.Equal(t, checksum, job.Labels["kdex.dev/generation"])
+
+	spec := job.Spec.Template.Spec
+	require.Len(t, spec.InitContainers, 1)
+	assert.Equal(t, "node:25-alpine", spec.InitContainers[0].Image)
+	assert.Equal(t, "kdex/packager:1", spec.Containers[0].Image)
+	assert.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "IMAGE_URL", Value: "registry.example.com/shop-clustertheme-brand:" + checksum})
+	assert.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "ORAS_ARGS", Value: "--plain-http"})
+
+	configMap := &corev1.ConfigMap{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "kdex", Name: job.Name}, configMap))
+	assert.Equal(t, sources.Data, configMap.Data)
+
+	again, err := builder.GetOrCreateJob(context.Background(), host, theme, sources)
+	require.NoError(t, err)
+	assert.Equal(t, job.Name, again.Name)
+
+	jobs := &batchv1.JobList{}
+	require.NoError(t, c.List(context.Background(), jobs))
+	assert.Len(t, jobs.Items, 1)
+
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{"kdex.dev/generation": checksum}
+	assert.Nil(t, builder.Harvest(host, theme, pod))
+
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  compilerContainer,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "abc123  main.css\n"}},
+	}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  packagerContainer,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "sha256:fff\n"}},
+	}}
+	result := builder.Harvest(host, theme, pod)
+	require.NotNil(t, result)
+	assert.Equal(t, "registry.example.com/shop-clustertheme-brand:"+checksum+"@sha256:fff", result.Image)
+	assert.Equal(t, map[string]string{"main.css": "sha256:abc123"}, result.Digests)
+}
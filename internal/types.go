@@ -20,3 +20,21 @@ var KPackImageGVK = schema.GroupVersionKind{
 	Version: "v1alpha2",
 	Kind:    "Image",
 }
+
+var TektonPipelineRunGVK = schema.GroupVersionKind{
+	Group:   "tekton.dev",
+	Version: "v1",
+	Kind:    "PipelineRun",
+}
+
+var OpenFaaSFunctionGVK = schema.GroupVersionKind{
+	Group:   "openfaas.com",
+	Version: "v1",
+	Kind:    "Function",
+}
+
+var TraefikMiddlewareGVK = schema.GroupVersionKind{
+	Group:   "traefik.io",
+	Version: "v1alpha1",
+	Kind:    "Middleware",
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The formats of the access log.
+const (
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatOff      = "off"
+)
+
+// AccessLog writes a line for each request served: its method, path, status,
+// size, latency, the subject of its identity and its trace ID. The lines of
+// AccessLogFormatCommon and AccessLogFormatCombined end with the latency in
+// milliseconds and the trace ID, "-" without one.
+type AccessLog struct {
+	// Exclude are the prefixes of the paths of the requests not logged, e.g.
+	// "/-/healthz".
+	Exclude []string
+	// Format is one of AccessLogFormatJSON, AccessLogFormatCommon or
+	// AccessLogFormatCombined.
+	Format string
+	// SampleRate is the share of the requests logged, from 0 to 1. The
+	// requests failing with a server error are always logged.
+	SampleRate float64
+	// Writer receives the lines.
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+// ParseAccessLogFormat returns the format, empty for AccessLogFormatOff.
+func ParseAccessLogFormat(format string) (string, error) {
+	switch format {
+	case "", AccessLogFormatOff:
+		return "", nil
+	case AccessLogFormatCombined, AccessLogFormatCommon, AccessLogFormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid access log format %q, expected json, common, combined or off", format)
+}
+
+// ParseAccessLogExclude returns the comma separated path prefixes.
+func ParseAccessLogExclude(value string) []string {
+	exclude := []string{}
+	for prefix := range strings.SplitSeq(value, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			exclude = append(exclude, prefix)
+		}
+	}
+	return exclude
+}
+
+type accessLogEntryKey struct{}
+
+type accessLogEntry struct {
+	subject string
+}
+
+// SetAccessLogSubject records the subject of the identity of the request in
+// its access log line. Handlers call it once the request is authenticated.
+func SetAccessLogSubject(ctx context.Context, subject string) {
+	if entry, ok := ctx.Value(accessLogEntryKey{}).(*accessLogEntry); ok {
+		entry.subject = subject
+	}
+}
+
+// WithAccessLog logs the requests served by the handler, unless the access
+// log is nil or off.
+func WithAccessLog(accessLog *AccessLog) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if accessLog == nil || accessLog.Format == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range accessLog.Exclude {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			start := time.Now()
+			entry := &accessLogEntry{}
+			aw := &accessLogResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), accessLogEntryKey{}, entry)))
+
+			if aw.status == 0 {
+				aw.status = http.StatusOK
+			}
+			if aw.status < http.StatusInternalServerError && accessLog.SampleRate < 1 && rand.Float64() >= accessLog.SampleRate {
+				return
+			}
+			accessLog.write(r, aw, entry.subject, start)
+		})
+	}
+}
+
+func (a *AccessLog) write(r *http.Request, aw *accessLogResponseWriter, subject string, start time.Time) {
+	var line []byte
+	traceID := ""
+	if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+		traceID = spanContext.TraceID().String()
+	}
+
+	switch a.Format {
+	case AccessLogFormatJSON:
+		line, _ = json.Marshal(map[string]any{
+			"bytes":      aw.bytes,
+			"durationMs": float64(time.Since(start).Microseconds()) / 1000,
+			"host":       r.Host,
+			"method":     r.Method,
+			"path":       r.URL.RequestURI(),
+			"protocol":   r.Proto,
+			"referer":    r.Referer(),
+			"remote":     remoteHost(r),
+			"status":     aw.status,
+			"time":       start.UTC().Format(time.RFC3339Nano),
+			"traceId":    traceID,
+			"user":       subject,
+			"userAgent":  r.UserAgent(),
+		})
+	default:
+		line = fmt.Appendf(nil, "%s - %s [%s] %q %d %d",
+			remoteHost(r),
+			dash(subject),
+			start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+			aw.status,
+			aw.bytes,
+		)
+		if a.Format == AccessLogFormatCombined {
+			line = fmt.Appendf(line, " %q %q", dash(r.Referer()), dash(r.UserAgent()))
+		}
+		// The latency in milliseconds and the trace ID follow the fields of
+		// the format.
+		line = fmt.Appendf(line, " %.3f %s", float64(time.Since(start).Microseconds())/1000, dash(traceID))
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = a.Writer.Write(line)
+}
+
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// accessLogResponseWriter records the status and the size of a response.
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	bytes  int
+	status int
+}
+
+func (w *accessLogResponseWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface.
+func (w *accessLogResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection (needed for WebSockets)
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("underlying ResponseWriter does not support Hijacker")
+}
+
+func (w *accessLogResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
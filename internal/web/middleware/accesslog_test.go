@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func accessLogged(t *testing.T, accessLog *AccessLog, r *http.Request, status int) string {
+	var out bytes.Buffer
+	accessLog.Writer = &out
+	handler := WithAccessLog(accessLog)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetAccessLogSubject(r.Context(), "jane")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	return out.String()
+}
+
+func TestParseAccessLogFormat(t *testing.T) {
+	format, err := ParseAccessLogFormat("off")
+	require.NoError(t, err)
+	assert.Empty(t, format)
+
+	format, err = ParseAccessLogFormat("combined")
+	require.NoError(t, err)
+	assert.Equal(t, AccessLogFormatCombined, format)
+
+	_, err = ParseAccessLogFormat("apache")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"/-/healthz", "/static"}, ParseAccessLogExclude(" /-/healthz, ,/static"))
+}
+
+func TestWithAccessLog(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	r := httptest.NewRequest("GET", "/shop?page=2", nil)
+	r.Header.Set("User-Agent", "curl/8")
+	r = r.WithContext(trace.ContextWithSpanContext(r.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	})))
+
+	line := accessLogged(t, &AccessLog{Format: AccessLogFormatJSON, SampleRate: 1}, r, http.StatusCreated)
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(line), &entry))
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/shop?page=2", entry["path"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Equal(t, "jane", entry["user"])
+	assert.Equal(t, traceID.String(), entry["traceId"])
+	assert.Contains(t, entry, "durationMs")
+
+	line = accessLogged(t, &AccessLog{Format: AccessLogFormatCommon, SampleRate: 1}, r, http.StatusOK)
+	assert.Regexp(t, `^192\.0\.2\.1 - jane \[[^]]+\] "GET /shop\?page=2 HTTP/1\.1" 200 5 [0-9.]+ `+traceID.String()+"\n$", line)
+
+	line = accessLogged(t, &AccessLog{Format: AccessLogFormatCombined, SampleRate: 1}, r, http.StatusOK)
+	assert.Contains(t, line, `200 5 "-" "curl/8" `)
+
+	// Excluded paths are not logged, nor the requests left out by sampling
+	// unless they failed.
+	assert.Empty(t, accessLogged(t, &AccessLog{Format: AccessLogFormatCommon, SampleRate: 1, Exclude: []string{"/sh"}}, r, http.StatusOK))
+	assert.Empty(t, accessLogged(t, &AccessLog{Format: AccessLogFormatCommon, SampleRate: 0}, r, http.StatusOK))
+	assert.True(t, strings.HasPrefix(accessLogged(t, &AccessLog{Format: AccessLogFormatCommon, SampleRate: 0}, r, http.StatusBadGateway), "192.0.2.1"))
+
+	// An access log which is off leaves the handler as is.
+	assert.Empty(t, accessLogged(t, &AccessLog{}, r, http.StatusOK))
+}
@@ -5,20 +5,30 @@ import (
 
 	"github.com/kdex-tech/host-manager/internal/host"
 	"github.com/kdex-tech/host-manager/internal/web/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func New(address string, hostHandler *host.HostHandler) *http.Server {
+func New(address string, hostHandler *host.HostHandler, accessLog *middleware.AccessLog) *http.Server {
 	handler := middleware.WithLogger(
 		logf.Log.WithName("server"),
 	)(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			hostHandler.ServeHTTP(w, r)
-		}),
+		middleware.WithAccessLog(accessLog)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hostHandler.ServeHTTP(w, r)
+			}),
+		),
 	)
 
 	return &http.Server{
-		Addr:    address,
-		Handler: handler,
+		Addr: address,
+		// The spans of the requests are renamed after the paths they are routed
+		// to by the host.
+		Handler: otelhttp.NewHandler(handler, "kdex-web", otelhttp.WithSpanNameFormatter(
+			func(_ string, r *http.Request) string {
+				name, _ := host.SpanName(r.Method, r.Pattern)
+				return name
+			},
+		)),
 	}
 }
@@ -0,0 +1,85 @@
+package v1alpha1
+
+import (
+	"context"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var backendlog = logf.Log.WithName("backend-resource")
+
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexapp,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexapps,verbs=create;update,versions=v1alpha1,name=mkdexapp-v1alpha1.kdex.dev,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexclusterapp,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexclusterapps,verbs=create;update,versions=v1alpha1,name=mkdexclusterapp-v1alpha1.kdex.dev,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexscriptlibrary,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexscriptlibraries,verbs=create;update,versions=v1alpha1,name=mkdexscriptlibrary-v1alpha1.kdex.dev,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexclusterscriptlibrary,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexclusterscriptlibraries,verbs=create;update,versions=v1alpha1,name=mkdexclusterscriptlibrary-v1alpha1.kdex.dev,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdextheme,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexthemes,verbs=create;update,versions=v1alpha1,name=mkdextheme-v1alpha1.kdex.dev,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexclustertheme,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexclusterthemes,verbs=create;update,versions=v1alpha1,name=mkdexclustertheme-v1alpha1.kdex.dev,admissionReviewVersions=v1
+
+// SetupBackendWebhooksWithManager registers the webhooks defaulting the
+// backends of the apps, script libraries and themes in the manager. The
+// backend of the hosts is defaulted by the webhook of KDexInternalHost.
+func SetupBackendWebhooksWithManager(mgr ctrl.Manager, defaults configuration.BackendDefault) error {
+	if err := setupBackendWebhook(mgr, &kdexv1alpha1.KDexApp{}, defaults, func(o *kdexv1alpha1.KDexApp) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	}); err != nil {
+		return err
+	}
+	if err := setupBackendWebhook(mgr, &kdexv1alpha1.KDexClusterApp{}, defaults, func(o *kdexv1alpha1.KDexClusterApp) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	}); err != nil {
+		return err
+	}
+	if err := setupBackendWebhook(mgr, &kdexv1alpha1.KDexScriptLibrary{}, defaults, func(o *kdexv1alpha1.KDexScriptLibrary) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	}); err != nil {
+		return err
+	}
+	if err := setupBackendWebhook(mgr, &kdexv1alpha1.KDexClusterScriptLibrary{}, defaults, func(o *kdexv1alpha1.KDexClusterScriptLibrary) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	}); err != nil {
+		return err
+	}
+	if err := setupBackendWebhook(mgr, &kdexv1alpha1.KDexTheme{}, defaults, func(o *kdexv1alpha1.KDexTheme) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	}); err != nil {
+		return err
+	}
+	return setupBackendWebhook(mgr, &kdexv1alpha1.KDexClusterTheme{}, defaults, func(o *kdexv1alpha1.KDexClusterTheme) *kdexv1alpha1.Backend {
+		return &o.Spec.Backend
+	})
+}
+
+func setupBackendWebhook[T client.Object](mgr ctrl.Manager, obj T, defaults configuration.BackendDefault, backend func(T) *kdexv1alpha1.Backend) error {
+	return ctrl.NewWebhookManagedBy(mgr, obj).
+		WithDefaulter(&BackendDefaulter[T]{Backend: backend, Defaults: defaults}).
+		Complete()
+}
+
+// BackendDefaulter sets the fields of the backend of the resources left
+// unset to the defaults of the configuration, so that their specs stay
+// minimal while their diffs show the values actually deployed. Resources
+// without a backend, i.e. with neither a static image nor a server image of
+// their own, are left as is.
+type BackendDefaulter[T client.Object] struct {
+	Backend  func(T) *kdexv1alpha1.Backend
+	Defaults configuration.BackendDefault
+}
+
+var _ admission.Defaulter[*kdexv1alpha1.KDexApp] = &BackendDefaulter[*kdexv1alpha1.KDexApp]{}
+
+// Default defaults the backend of the resource.
+func (d *BackendDefaulter[T]) Default(_ context.Context, obj T) error {
+	backend := d.Backend(obj)
+	if !backend.IsConfigured(d.Defaults.ServerImage) {
+		return nil
+	}
+	backendlog.V(1).Info("default", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+	child.DefaultBackend(backend, &d.Defaults)
+	return nil
+}
@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+)
+
+func TestBackendDefaulter(t *testing.T) {
+	defaults := configuration.BackendDefault{ServerImage: "kdex/server:1", ServerImagePullPolicy: corev1.PullIfNotPresent}
+	defaults.Deployment.Replicas = new(int32(2))
+	defaulter := &BackendDefaulter[*kdexv1alpha1.KDexApp]{
+		Backend:  func(o *kdexv1alpha1.KDexApp) *kdexv1alpha1.Backend { return &o.Spec.Backend },
+		Defaults: defaults,
+	}
+
+	app := &kdexv1alpha1.KDexApp{}
+	require.NoError(t, defaulter.Default(context.Background(), app))
+	assert.Equal(t, kdexv1alpha1.Backend{}, app.Spec.Backend, "no backend")
+
+	app.Spec.StaticImage = "shop/app:1"
+	require.NoError(t, defaulter.Default(context.Background(), app))
+	assert.Equal(t, corev1.PullIfNotPresent, app.Spec.ServerImagePullPolicy)
+	assert.Equal(t, int32(2), *app.Spec.Replicas)
+}
+
+func TestKDexInternalHostDefaulter(t *testing.T) {
+	defaulter := &KDexInternalHostDefaulter{Defaults: configuration.BackendDefault{ServerImage: "kdex/server:1"}}
+
+	host := internalHost("/-/host")
+	host.Spec.Routing.Domains = []string{"shop.example"}
+	require.NoError(t, defaulter.Default(context.Background(), host))
+	assert.Empty(t, host.Spec.Env, "no backend")
+
+	host.Spec.ServerImage = "shop/server:1"
+	require.NoError(t, defaulter.Default(context.Background(), host))
+	assert.Equal(t, []corev1.EnvVar{child.CORSDomains([]string{"shop.example"})}, host.Spec.Env)
+
+	host.Spec.Routing.Domains = []string{"shop.example", "www.shop.example"}
+	require.NoError(t, defaulter.Default(context.Background(), host))
+	assert.Equal(t, []corev1.EnvVar{child.CORSDomains(host.Spec.Routing.Domains)}, host.Spec.Env)
+}
@@ -0,0 +1,158 @@
+// Package v1alpha1 holds the admission webhooks of the kdex.dev/v1alpha1
+// resources.
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	kh "github.com/kdex-tech/host-manager/internal/http"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/linter"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var kdexfunctionlog = logf.Log.WithName("kdexfunction-resource")
+
+// SetupKDexFunctionWebhookWithManager registers the webhook validating
+// KDexFunctions in the manager.
+func SetupKDexFunctionWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &kdexv1alpha1.KDexFunction{}).
+		WithValidator(&KDexFunctionValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kdex-dev-v1alpha1-kdexfunction,mutating=false,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexfunctions,verbs=create;update,versions=v1alpha1,name=vkdexfunction-v1alpha1.kdex.dev,admissionReviewVersions=v1
+
+// KDexFunctionValidator rejects KDexFunctions whose API is not a valid
+// OpenAPI fragment before they reach the reconciler: invalid refs, operation
+// ids used twice in the host, and malformed pattern paths. Lints of the
+// vacuum linter are errors when their severity is error, warnings
+// otherwise.
+type KDexFunctionValidator struct {
+	Client client.Client
+}
+
+var _ admission.Validator[*kdexv1alpha1.KDexFunction] = &KDexFunctionValidator{}
+
+// ValidateCreate validates the function on creation.
+func (v *KDexFunctionValidator) ValidateCreate(ctx context.Context, fn *kdexv1alpha1.KDexFunction) (admission.Warnings, error) {
+	kdexfunctionlog.V(1).Info("validate create", "name", fn.Name)
+	return v.validate(ctx, fn)
+}
+
+// ValidateUpdate validates the function on update.
+func (v *KDexFunctionValidator) ValidateUpdate(ctx context.Context, _, fn *kdexv1alpha1.KDexFunction) (admission.Warnings, error) {
+	kdexfunctionlog.V(1).Info("validate update", "name", fn.Name)
+	return v.validate(ctx, fn)
+}
+
+// ValidateDelete accepts every deletion.
+func (v *KDexFunctionValidator) ValidateDelete(context.Context, *kdexv1alpha1.KDexFunction) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *KDexFunctionValidator) validate(ctx context.Context, fn *kdexv1alpha1.KDexFunction) (admission.Warnings, error) {
+	others := []kdexv1alpha1.KDexFunction{}
+	if v.Client != nil {
+		list := &kdexv1alpha1.KDexFunctionList{}
+		if err := v.Client.List(ctx, list, client.InNamespace(fn.Namespace)); err != nil {
+			return nil, fmt.Errorf("failed to list functions: %w", err)
+		}
+		for _, other := range list.Items {
+			if other.Name != fn.Name && other.Spec.HostRef.Name == fn.Spec.HostRef.Name {
+				others = append(others, other)
+			}
+		}
+	}
+	return ValidateFunction(ctx, fn, others)
+}
+
+// ValidateFunction validates the API of the function against the other
+// functions of its host.
+func ValidateFunction(ctx context.Context, fn *kdexv1alpha1.KDexFunction, others []kdexv1alpha1.KDexFunction) (admission.Warnings, error) {
+	errs := []error{}
+
+	basePath := fn.Spec.API.BasePath
+	itemPathRegex := fn.Spec.API.ItemPathRegex()
+	for _, patternPath := range slices.Sorted(maps.Keys(fn.Spec.API.Paths)) {
+		if !itemPathRegex.MatchString(patternPath) || !strings.HasPrefix(patternPath, basePath) {
+			errs = append(errs, fmt.Errorf("path %q must start with the base path %q", patternPath, basePath))
+			continue
+		}
+		if err := kh.CheckPattern(patternPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	builder := ko.Builder{TypesToInclude: []ko.PathType{ko.FunctionPathType}}
+	spec, err := json.Marshal(builder.BuildOneOff("http://localhost", fn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI spec: %w", err)
+	}
+
+	// Loading resolves the refs, failing on those which do not resolve.
+	doc, err := openapi.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	owners := map[string]string{}
+	for _, other := range others {
+		for _, id := range operationIDs(&other.Spec.API) {
+			owners[id] = other.Name
+		}
+	}
+	for _, id := range operationIDs(&fn.Spec.API) {
+		if owner, ok := owners[id]; ok {
+			errs = append(errs, fmt.Errorf("operationId %q is already used by function %s", id, owner))
+		}
+	}
+
+	warnings := admission.Warnings{}
+	results, err := linter.LintSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lint OpenAPI spec: %w", err)
+	}
+	for _, result := range results {
+		lint := fmt.Sprintf("[%s] %s (%s)", result.RuleId, result.Message, result.Path)
+		if result.RuleSeverity == "error" {
+			errs = append(errs, errors.New(lint))
+		} else {
+			warnings = append(warnings, lint)
+		}
+	}
+
+	return warnings, errors.Join(errs...)
+}
+
+// operationIDs returns the operation ids declared by the API.
+func operationIDs(api *kdexv1alpha1.API) []string {
+	ids := []string{}
+	for _, item := range ko.FromKDexAPI(api).Paths {
+		for _, op := range []*openapi.Operation{
+			item.Connect, item.Delete, item.Get, item.Head, item.Options, item.Patch, item.Post, item.Put, item.Trace,
+		} {
+			if op != nil && op.OperationID != "" {
+				ids = append(ids, op.OperationID)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,62 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	openapi "github.com/getkin/kin-openapi/openapi3"
+	ko "github.com/kdex-tech/host-manager/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func function(name string, path string, operationID string, schemaRef string) *kdexv1alpha1.KDexFunction {
+	get := &openapi.Operation{
+		Description: "Returns the user.",
+		OperationID: operationID,
+		Parameters:  openapi.Parameters{ko.PathParam("id", "The id of the user.")},
+		Responses: openapi.NewResponses(openapi.WithStatus(200, &openapi.ResponseRef{
+			Value: openapi.NewResponse().
+				WithDescription("The user.").
+				WithJSONSchemaRef(openapi.NewSchemaRef(schemaRef, nil)),
+		})),
+		Summary: "Get a user",
+		Tags:    []string{"users"},
+	}
+	item := kdexv1alpha1.PathItem{}
+	item.SetGet(get)
+
+	fn := &kdexv1alpha1.KDexFunction{}
+	fn.Name = name
+	fn.Namespace = "ns"
+	fn.Spec.HostRef.Name = "shop"
+	fn.Spec.API = kdexv1alpha1.API{
+		BasePath: "/v1/users",
+		Paths:    map[string]kdexv1alpha1.PathItem{path: item},
+	}
+	fn.Spec.API.SetSchemas(map[string]*openapi.SchemaRef{
+		"User": openapi.NewSchemaRef("", openapi.NewObjectSchema().WithProperty("name", openapi.NewStringSchema())),
+	})
+	return fn
+}
+
+func TestValidateFunction(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := ValidateFunction(ctx, function("users", "/v1/users/{id}", "getUser", "#/components/schemas/User"), nil)
+	require.NoError(t, err)
+
+	_, err = ValidateFunction(ctx, function("users", "/v1/users/{id}", "getUser", "#/components/schemas/Missing"), nil)
+	assert.ErrorContains(t, err, "Missing")
+
+	_, err = ValidateFunction(ctx, function("users", "/v2/users/{id}", "getUser", "#/components/schemas/User"), nil)
+	assert.ErrorContains(t, err, `must start with the base path "/v1/users"`)
+
+	_, err = ValidateFunction(ctx, function("users", "/v1/users/{id", "getUser", "#/components/schemas/User"), nil)
+	assert.ErrorContains(t, err, "invalid pattern path")
+
+	others := []kdexv1alpha1.KDexFunction{*function("accounts", "/v1/users/{id}", "getUser", "#/components/schemas/User")}
+	_, err = ValidateFunction(ctx, function("users", "/v1/users/{id}", "getUser", "#/components/schemas/User"), others)
+	assert.ErrorContains(t, err, `operationId "getUser" is already used by function accounts`)
+}
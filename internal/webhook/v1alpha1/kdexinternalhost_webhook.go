@@ -0,0 +1,94 @@
+package v1alpha1
+
+import (
+	"context"
+
+	"github.com/kdex-tech/host-manager/internal/child"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	"kdex.dev/crds/configuration"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var kdexinternalhostlog = logf.Log.WithName("kdexinternalhost-resource")
+
+// SetupKDexInternalHostWebhookWithManager registers the webhooks defaulting
+// and validating KDexInternalHosts in the manager.
+func SetupKDexInternalHostWebhookWithManager(mgr ctrl.Manager, defaults configuration.BackendDefault) error {
+	return ctrl.NewWebhookManagedBy(mgr, &kdexv1alpha1.KDexInternalHost{}).
+		WithDefaulter(&KDexInternalHostDefaulter{Defaults: defaults}).
+		WithValidator(&KDexInternalHostValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-kdex-dev-v1alpha1-kdexinternalhost,mutating=true,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexinternalhosts,verbs=create;update,versions=v1alpha1,name=mkdexinternalhost-v1alpha1.kdex.dev,admissionReviewVersions=v1
+
+// KDexInternalHostDefaulter defaults the backend of KDexInternalHosts like
+// BackendDefaulter, and sets its CORS_DOMAINS env var to the domains of the
+// host.
+type KDexInternalHostDefaulter struct {
+	Defaults configuration.BackendDefault
+}
+
+var _ admission.Defaulter[*kdexv1alpha1.KDexInternalHost] = &KDexInternalHostDefaulter{}
+
+// Default defaults the backend of the host.
+func (d *KDexInternalHostDefaulter) Default(_ context.Context, internalHost *kdexv1alpha1.KDexInternalHost) error {
+	if !internalHost.Spec.IsConfigured(d.Defaults.ServerImage) {
+		return nil
+	}
+	kdexinternalhostlog.V(1).Info("default", "name", internalHost.Name)
+	child.DefaultBackend(&internalHost.Spec.Backend, &d.Defaults)
+	internalHost.Spec.Env = child.SetEnv(internalHost.Spec.Env, child.CORSDomains(internalHost.Spec.Routing.Domains))
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-kdex-dev-v1alpha1-kdexinternalhost,mutating=false,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexinternalhosts,verbs=create;update,versions=v1alpha1,name=vkdexinternalhost-v1alpha1.kdex.dev,admissionReviewVersions=v1
+
+// KDexInternalHostValidator rejects KDexInternalHosts whose backend ingress
+// path is already used by one of their pages or functions.
+type KDexInternalHostValidator struct {
+	Client client.Client
+}
+
+var _ admission.Validator[*kdexv1alpha1.KDexInternalHost] = &KDexInternalHostValidator{}
+
+// ValidateCreate validates the host on creation.
+func (v *KDexInternalHostValidator) ValidateCreate(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost) (admission.Warnings, error) {
+	kdexinternalhostlog.V(1).Info("validate create", "name", internalHost.Name)
+	return nil, v.validate(ctx, internalHost)
+}
+
+// ValidateUpdate validates the host on update.
+func (v *KDexInternalHostValidator) ValidateUpdate(ctx context.Context, previous, internalHost *kdexv1alpha1.KDexInternalHost) (admission.Warnings, error) {
+	kdexinternalhostlog.V(1).Info("validate update", "name", internalHost.Name)
+	// Only changes of the ingress path may introduce a conflict.
+	if previous.Spec.IngressPath == internalHost.Spec.IngressPath {
+		return nil, nil
+	}
+	return nil, v.validate(ctx, internalHost)
+}
+
+// ValidateDelete accepts every deletion.
+func (v *KDexInternalHostValidator) ValidateDelete(context.Context, *kdexv1alpha1.KDexInternalHost) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *KDexInternalHostValidator) validate(ctx context.Context, internalHost *kdexv1alpha1.KDexInternalHost) error {
+	if v.Client == nil || internalHost.Spec.IngressPath == "" {
+		return nil
+	}
+
+	bindings, err := listPageBindings(ctx, v.Client, internalHost.Namespace, internalHost.Name)
+	if err != nil {
+		return err
+	}
+	functions, err := listFunctions(ctx, v.Client, internalHost.Namespace, internalHost.Name)
+	if err != nil {
+		return err
+	}
+
+	return ValidateHostPaths(internalHost, bindings, functions)
+}
@@ -0,0 +1,114 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var kdexpagebindinglog = logf.Log.WithName("kdexpagebinding-resource")
+
+// SetupKDexPageBindingWebhookWithManager registers the webhook validating
+// KDexPageBindings in the manager.
+func SetupKDexPageBindingWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &kdexv1alpha1.KDexPageBinding{}).
+		WithValidator(&KDexPageBindingValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kdex-dev-v1alpha1-kdexpagebinding,mutating=false,failurePolicy=fail,sideEffects=None,groups=kdex.dev,resources=kdexpagebindings,verbs=create;update,versions=v1alpha1,name=vkdexpagebinding-v1alpha1.kdex.dev,admissionReviewVersions=v1
+
+// KDexPageBindingValidator rejects KDexPageBindings whose paths are already
+// used in their host, which the reconciler of the host would otherwise only
+// report as a hard error after the apply.
+type KDexPageBindingValidator struct {
+	Client client.Client
+}
+
+var _ admission.Validator[*kdexv1alpha1.KDexPageBinding] = &KDexPageBindingValidator{}
+
+// ValidateCreate validates the page binding on creation.
+func (v *KDexPageBindingValidator) ValidateCreate(ctx context.Context, binding *kdexv1alpha1.KDexPageBinding) (admission.Warnings, error) {
+	kdexpagebindinglog.V(1).Info("validate create", "name", binding.Name)
+	return nil, v.validate(ctx, binding)
+}
+
+// ValidateUpdate validates the page binding on update.
+func (v *KDexPageBindingValidator) ValidateUpdate(ctx context.Context, _, binding *kdexv1alpha1.KDexPageBinding) (admission.Warnings, error) {
+	kdexpagebindinglog.V(1).Info("validate update", "name", binding.Name)
+	return nil, v.validate(ctx, binding)
+}
+
+// ValidateDelete accepts every deletion.
+func (v *KDexPageBindingValidator) ValidateDelete(context.Context, *kdexv1alpha1.KDexPageBinding) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *KDexPageBindingValidator) validate(ctx context.Context, binding *kdexv1alpha1.KDexPageBinding) error {
+	if v.Client == nil {
+		return ValidatePagePaths(binding, nil, nil, nil)
+	}
+
+	hostName := binding.Spec.HostRef.Name
+	internalHost := &kdexv1alpha1.KDexInternalHost{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Namespace: binding.Namespace, Name: hostName}, internalHost); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get host %s: %w", hostName, err)
+		}
+		internalHost = nil
+	}
+
+	bindings, err := listPageBindings(ctx, v.Client, binding.Namespace, hostName)
+	if err != nil {
+		return err
+	}
+	others := []kdexv1alpha1.KDexPageBinding{}
+	for _, other := range bindings {
+		if other.Name != binding.Name {
+			others = append(others, other)
+		}
+	}
+
+	functions, err := listFunctions(ctx, v.Client, binding.Namespace, hostName)
+	if err != nil {
+		return err
+	}
+
+	return ValidatePagePaths(binding, internalHost, others, functions)
+}
+
+// listPageBindings returns the page bindings of the host.
+func listPageBindings(ctx context.Context, c client.Client, namespace string, hostName string) ([]kdexv1alpha1.KDexPageBinding, error) {
+	list := &kdexv1alpha1.KDexPageBindingList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list page bindings: %w", err)
+	}
+	bindings := []kdexv1alpha1.KDexPageBinding{}
+	for _, binding := range list.Items {
+		if binding.Spec.HostRef.Name == hostName {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings, nil
+}
+
+// listFunctions returns the functions of the host.
+func listFunctions(ctx context.Context, c client.Client, namespace string, hostName string) ([]kdexv1alpha1.KDexFunction, error) {
+	list := &kdexv1alpha1.KDexFunctionList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list functions: %w", err)
+	}
+	functions := []kdexv1alpha1.KDexFunction{}
+	for _, function := range list.Items {
+		if function.Spec.HostRef.Name == hostName {
+			functions = append(functions, function)
+		}
+	}
+	return functions, nil
+}
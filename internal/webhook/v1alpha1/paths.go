@@ -0,0 +1,88 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+// hostPaths are the paths claimed in a host by its backend, its pages and its
+// functions, by the kind and name of their owner.
+type hostPaths map[string]string
+
+func (p hostPaths) claim(path string, kind string, namespace string, name string) {
+	if path != "" {
+		p[path] = fmt.Sprintf("%s %s/%s", kind, namespace, name)
+	}
+}
+
+func (p hostPaths) claimHost(internalHost *kdexv1alpha1.KDexInternalHost) {
+	p.claim(internalHost.Spec.IngressPath, "KDexInternalHost", internalHost.Namespace, internalHost.Name)
+}
+
+func (p hostPaths) claimPages(bindings []kdexv1alpha1.KDexPageBinding) {
+	for _, binding := range bindings {
+		p.claim(binding.Spec.BasePath, "KDexPageBinding", binding.Namespace, binding.Name)
+		p.claim(binding.Spec.PatternPath, "KDexPageBinding", binding.Namespace, binding.Name)
+	}
+}
+
+func (p hostPaths) claimFunctions(functions []kdexv1alpha1.KDexFunction) {
+	for _, function := range functions {
+		for _, routePath := range slices.Sorted(maps.Keys(function.Spec.API.Paths)) {
+			p.claim(routePath, "KDexFunction", function.Namespace, function.Name)
+		}
+	}
+}
+
+// check returns an error for each of the paths already claimed.
+func (p hostPaths) check(kind string, namespace string, name string, paths ...string) error {
+	errs := []error{}
+	for _, path := range paths {
+		if owner, ok := p[path]; ok && path != "" {
+			errs = append(errs, fmt.Errorf(
+				"duplicated path %s of %s %s/%s, already used by %s, paths must be unique across backends and pages",
+				path, kind, namespace, name, owner,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidatePagePaths validates that the paths of the page binding are not
+// used by the backend of its host, by the other page bindings of the host or
+// by its functions. The host is nil when it does not exist yet.
+func ValidatePagePaths(
+	binding *kdexv1alpha1.KDexPageBinding,
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	others []kdexv1alpha1.KDexPageBinding,
+	functions []kdexv1alpha1.KDexFunction,
+) error {
+	if binding.Spec.PatternPath != "" && binding.Spec.PatternPath == binding.Spec.BasePath {
+		return fmt.Errorf("duplicated path %s of KDexPageBinding %s/%s, patternPath must differ from basePath", binding.Spec.PatternPath, binding.Namespace, binding.Name)
+	}
+
+	claimed := hostPaths{}
+	if internalHost != nil {
+		claimed.claimHost(internalHost)
+	}
+	claimed.claimPages(others)
+	claimed.claimFunctions(functions)
+	return claimed.check("KDexPageBinding", binding.Namespace, binding.Name, binding.Spec.BasePath, binding.Spec.PatternPath)
+}
+
+// ValidateHostPaths validates that the ingress path of the backend of the
+// host is not used by its page bindings or by its functions.
+func ValidateHostPaths(
+	internalHost *kdexv1alpha1.KDexInternalHost,
+	bindings []kdexv1alpha1.KDexPageBinding,
+	functions []kdexv1alpha1.KDexFunction,
+) error {
+	claimed := hostPaths{}
+	claimed.claimPages(bindings)
+	claimed.claimFunctions(functions)
+	return claimed.check("KDexInternalHost", internalHost.Namespace, internalHost.Name, internalHost.Spec.IngressPath)
+}
@@ -0,0 +1,61 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kdexv1alpha1 "kdex.dev/crds/api/v1alpha1"
+)
+
+func binding(name string, basePath string, patternPath string) kdexv1alpha1.KDexPageBinding {
+	b := kdexv1alpha1.KDexPageBinding{}
+	b.Name = name
+	b.Namespace = "ns"
+	b.Spec.HostRef.Name = "shop"
+	b.Spec.BasePath = basePath
+	b.Spec.PatternPath = patternPath
+	return b
+}
+
+func internalHost(ingressPath string) *kdexv1alpha1.KDexInternalHost {
+	h := &kdexv1alpha1.KDexInternalHost{}
+	h.Name = "shop"
+	h.Namespace = "ns"
+	h.Spec.IngressPath = ingressPath
+	return h
+}
+
+func TestValidatePagePaths(t *testing.T) {
+	others := []kdexv1alpha1.KDexPageBinding{binding("home", "/home", ""), binding("products", "/products", "/products/{id}")}
+	functions := []kdexv1alpha1.KDexFunction{*function("users", "/v1/users/{id}", "getUser", "#/components/schemas/User")}
+
+	page := binding("about", "/about", "/about/{section}")
+	require.NoError(t, ValidatePagePaths(&page, internalHost("/_host"), others, functions))
+	require.NoError(t, ValidatePagePaths(&page, nil, nil, nil))
+
+	page = binding("about", "/home", "")
+	assert.EqualError(t, ValidatePagePaths(&page, internalHost("/_host"), others, functions),
+		"duplicated path /home of KDexPageBinding ns/about, already used by KDexPageBinding ns/home, paths must be unique across backends and pages")
+
+	page = binding("about", "/about", "/products/{id}")
+	assert.ErrorContains(t, ValidatePagePaths(&page, internalHost("/_host"), others, functions), "already used by KDexPageBinding ns/products")
+
+	page = binding("about", "/_host", "")
+	assert.ErrorContains(t, ValidatePagePaths(&page, internalHost("/_host"), others, functions), "already used by KDexInternalHost ns/shop")
+
+	page = binding("about", "/v1/users/{id}", "")
+	assert.ErrorContains(t, ValidatePagePaths(&page, internalHost("/_host"), others, functions), "already used by KDexFunction ns/users")
+
+	page = binding("about", "/about", "/about")
+	assert.ErrorContains(t, ValidatePagePaths(&page, nil, nil, nil), "patternPath must differ from basePath")
+}
+
+func TestValidateHostPaths(t *testing.T) {
+	bindings := []kdexv1alpha1.KDexPageBinding{binding("home", "/home", "")}
+
+	require.NoError(t, ValidateHostPaths(internalHost("/_host"), bindings, nil))
+	require.NoError(t, ValidateHostPaths(internalHost(""), bindings, nil))
+	assert.EqualError(t, ValidateHostPaths(internalHost("/home"), bindings, nil),
+		"duplicated path /home of KDexInternalHost ns/shop, already used by KDexPageBinding ns/home, paths must be unique across backends and pages")
+}
@@ -0,0 +1,384 @@
+// Package hostclient is the client of the system endpoints every host serves
+// under /-/, e.g. /-/state, /-/translation and /-/navigation, for the
+// services calling a host. Its methods are generated from the OpenAPI of the
+// host, as is the TypeScript client of hostclient.ts.
+//
+// It depends on nothing else of the host manager and its API is kept stable
+// so that the services written in Go may import it.
+package hostclient
+
+//go:generate go run ./internal/gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetry retries the requests 3 times, backing off from 100ms up to 5s.
+var DefaultRetry = Retry{
+	MaxAttempts: 4,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// Retry is the policy retrying the requests failing with a network error or
+// answered 429, 502, 503 or 504. Only the requests answered 429 are retried
+// when their method is not idempotent.
+type Retry struct {
+	// MaxAttempts is the number of attempts of a request, 1 disables the
+	// retries.
+	MaxAttempts int
+	// MinBackoff is the backoff of the first retry, doubled at each retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the backoff, and the Retry-After of the responses.
+	MaxBackoff time.Duration
+}
+
+// TokenSource returns the bearer token of the requests, "" for the anonymous
+// ones.
+type TokenSource func(ctx context.Context) (string, error)
+
+// Error is the error of the requests answered with a status other than 2xx.
+type Error struct {
+	Body       []byte
+	Method     string
+	Path       string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	message := strings.TrimSpace(string(e.Body))
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), message)
+}
+
+// Client calls the system endpoints of a host.
+type Client struct {
+	baseURL     *url.URL
+	httpClient  *http.Client
+	retry       Retry
+	sleep       func(ctx context.Context, d time.Duration) error
+	tokenSource TokenSource
+	userAgent   string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client of the requests, http.DefaultClient by
+// default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetry sets the retry policy of the requests, DefaultRetry by default.
+func WithRetry(retry Retry) Option {
+	return func(c *Client) {
+		c.retry = retry
+	}
+}
+
+// WithToken authenticates the requests with the bearer token.
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithTokenSource authenticates the requests with the bearer tokens of the
+// source, e.g. the token of the request a service is answering.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = source
+	}
+}
+
+// WithClientCredentials authenticates the requests with the tokens the host
+// issues to the client at /-/token, renewed before they expire.
+func WithClientCredentials(clientID string, clientSecret string, scopes ...string) Option {
+	return func(c *Client) {
+		credentials := &clientCredentials{
+			client:       c,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       scopes,
+		}
+		c.tokenSource = credentials.token
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns the client of the host at the base URL, e.g.
+// "http://kdex-web.shop.svc".
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q, expected an http or https URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetry,
+		sleep:      sleep,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// do sends the request and decodes its response into out: the raw body when
+// out is a *string, its JSON otherwise.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode the body of %s %s: %w", method, path, err)
+		}
+	}
+
+	response, err := c.send(ctx, method, path, query, payload)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if raw, ok := out.(*string); ok {
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		*raw = string(data)
+		return nil
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// send sends the request, retrying it per the retry policy, and returns its
+// 2xx response.
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, payload []byte) (*http.Response, error) {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	token := ""
+	if c.tokenSource != nil {
+		var err error
+		if token, err = c.tokenSource(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get the token of %s %s: %w", method, path, err)
+		}
+	}
+
+	backoff := c.retry.MinBackoff
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", "application/json, text/html;q=0.9")
+		if payload != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		if c.userAgent != "" {
+			request.Header.Set("User-Agent", c.userAgent)
+		}
+
+		response, err := c.httpClient.Do(request)
+		last := attempt >= c.retry.MaxAttempts || ctx.Err() != nil
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if last || !idempotent(method) {
+				return nil, err
+			}
+		case response.StatusCode >= 200 && response.StatusCode < 300:
+			return response, nil
+		default:
+			data, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+			_ = response.Body.Close()
+			if last || !retryable(method, response.StatusCode) {
+				return nil, &Error{Body: data, Method: method, Path: path, StatusCode: response.StatusCode}
+			}
+			wait = retryAfter(response.Header.Get("Retry-After"))
+		}
+
+		if wait == 0 && backoff > 0 {
+			// Full jitter spreads the retries of the clients failing together.
+			wait = rand.N(backoff) + 1
+		}
+		if c.retry.MaxBackoff > 0 {
+			wait = min(wait, c.retry.MaxBackoff)
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if c.retry.MaxBackoff > 0 {
+			backoff = min(backoff, c.retry.MaxBackoff)
+		}
+	}
+}
+
+// escapeSegments escapes the segments of a path parameter spanning several
+// segments, e.g. the base path of GetNavigation.
+func escapeSegments(value string) string {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	}
+	return false
+}
+
+func retryable(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+// retryAfter returns the delay of a Retry-After header, in seconds or an HTTP
+// date, 0 when it is not set or invalid.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// clientCredentials is the token source of WithClientCredentials.
+type clientCredentials struct {
+	client       *Client
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu      sync.Mutex
+	expires time.Time
+	value   string
+}
+
+func (cc *clientCredentials) token(ctx context.Context) (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.value != "" && time.Now().Before(cc.expires) {
+		return cc.value, nil
+	}
+
+	form := url.Values{
+		"client_id":     {cc.clientID},
+		"client_secret": {cc.clientSecret},
+		"grant_type":    {"client_credentials"},
+	}
+	if len(cc.scopes) > 0 {
+		form.Set("scope", strings.Join(cc.scopes, " "))
+	}
+
+	request, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, cc.client.baseURL.JoinPath("/-/token").String(), strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := cc.client.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", &Error{Body: data, Method: http.MethodPost, Path: "/-/token", StatusCode: response.StatusCode}
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response, expected an access_token")
+	}
+
+	cc.value = token.AccessToken
+	// Renew the token a little before it expires.
+	cc.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+	return cc.value, nil
+}
@@ -0,0 +1,175 @@
+package hostclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient returns the client of the handler, recording the waits of its
+// retries rather than sleeping.
+func newClient(t *testing.T, handler http.HandlerFunc, options ...Option) (*Client, *[]time.Duration) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL+"/", options...)
+	require.NoError(t, err)
+
+	waits := &[]time.Duration{}
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return c, waits
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("kdex-web.shop.svc")
+	assert.Error(t, err)
+
+	_, err = New("http://kdex-web.shop.svc")
+	assert.NoError(t, err)
+}
+
+func TestClient_Retry(t *testing.T) {
+	attempts := 0
+	c, waits := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]any{"source": "header", "timeZone": "Europe/Paris"})
+		}
+	})
+
+	tz, err := c.GetTimezone(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Paris", tz.TimeZone)
+	assert.Equal(t, 3, attempts)
+	require.Len(t, *waits, 2)
+	assert.LessOrEqual(t, (*waits)[0], DefaultRetry.MinBackoff+1)
+	assert.Equal(t, 2*time.Second, (*waits)[1], "Retry-After is honoured")
+}
+
+func TestClient_RetryGivesUp(t *testing.T) {
+	attempts := 0
+	c, waits := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}, WithRetry(Retry{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Second}))
+
+	_, err := c.GetHealthz(context.Background())
+	hostErr := &Error{}
+	require.True(t, errors.As(err, &hostErr))
+	assert.Equal(t, http.StatusServiceUnavailable, hostErr.StatusCode)
+	assert.Equal(t, "busy\n", string(hostErr.Body))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, *waits, "Retry-After is capped")
+}
+
+func TestClient_NoRetry(t *testing.T) {
+	for name, tc := range map[string]struct {
+		status int
+		call   func(c *Client) error
+	}{
+		"not found": {
+			status: http.StatusNotFound,
+			call: func(c *Client) error {
+				_, err := c.GetSchema(context.Background(), "User")
+				return err
+			},
+		},
+		"post unavailable": {
+			status: http.StatusServiceUnavailable,
+			call: func(c *Client) error {
+				_, err := c.PostTimezone(context.Background(), &PostTimezoneRequest{TimeZone: "UTC"})
+				return err
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			c, _ := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.WriteHeader(tc.status)
+			})
+
+			err := tc.call(c)
+			hostErr := &Error{}
+			require.True(t, errors.As(err, &hostErr))
+			assert.Equal(t, tc.status, hostErr.StatusCode)
+			assert.Equal(t, 1, attempts)
+		})
+	}
+}
+
+func TestClient_Requests(t *testing.T) {
+	var got *http.Request
+	var body map[string]any
+	c, _ := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.EscapedPath() == "/-/navigation/main/fr/shop/a%20b" {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<nav></nav>"))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}, WithToken("t0k3n"), WithUserAgent("orders/1.0"))
+
+	_, err := c.GetTranslation(context.Background(), "fr", &GetTranslationParams{Key: []string{"a", "b"}, Missing: "true"})
+	require.NoError(t, err)
+	assert.Equal(t, "/-/translation/fr", got.URL.Path)
+	assert.Equal(t, []string{"a", "b"}, got.URL.Query()["key"])
+	assert.Equal(t, "true", got.URL.Query().Get("missing"))
+	assert.Equal(t, "Bearer t0k3n", got.Header.Get("Authorization"))
+	assert.Equal(t, "orders/1.0", got.Header.Get("User-Agent"))
+
+	html, err := c.GetNavigation(context.Background(), "main", "fr", "shop/a b")
+	require.NoError(t, err)
+	assert.Equal(t, "<nav></nav>", html)
+
+	_, err = c.PostTimezone(context.Background(), &PostTimezoneRequest{TimeZone: "Europe/Paris"})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, map[string]any{"timeZone": "Europe/Paris"}, body)
+}
+
+func TestClient_ClientCredentials(t *testing.T) {
+	issued := 0
+	var authorization string
+	c, _ := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/-/token" {
+			issued++
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			assert.Equal(t, "orders", r.FormValue("client_id"))
+			assert.Equal(t, "s3cr3t", r.FormValue("client_secret"))
+			assert.Equal(t, "openid profile", r.FormValue("scope"))
+			_, _ = w.Write([]byte(`{"access_token": "t0k3n", "expires_in": 3600}`))
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{}`))
+	}, WithClientCredentials("orders", "s3cr3t", "openid", "profile"))
+
+	for range 2 {
+		_, err := c.GetHealthz(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "Bearer t0k3n", authorization)
+	assert.Equal(t, 1, issued, "the token is reused until it expires")
+}
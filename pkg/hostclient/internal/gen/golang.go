@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+)
+
+type goStruct struct {
+	Doc    string
+	Fields []goField
+	Name   string
+}
+
+type goField struct {
+	Doc  string
+	JSON string
+	Name string
+	Type string
+}
+
+// goTypes collects the struct types of the schemas of the operations.
+type goTypes struct {
+	structs []goStruct
+}
+
+// typeOf returns the Go type of the schema, declaring the struct types of its
+// objects after the name, documented by doc.
+func (t *goTypes) typeOf(s *schema, name string, doc string) string {
+	switch s.Type {
+	case "array":
+		return "[]" + t.typeOf(s.Items, singular(name), "an item of "+doc)
+	case "boolean":
+		return "bool"
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "object":
+		if len(s.Properties) == 0 {
+			return "map[string]any"
+		}
+		// The struct is declared before the structs of its fields.
+		index := len(t.structs)
+		t.structs = append(t.structs, goStruct{Doc: name + " is " + doc + ".", Name: name})
+		fields := []goField{}
+		for _, p := range s.Properties {
+			field := goField{
+				JSON: p.Name,
+				Name: goName(p.Name),
+			}
+			field.Type = t.typeOf(p.Schema, name+field.Name, "the "+p.Name+" of "+name)
+			if len(p.Schema.Enum) > 0 {
+				field.Doc = "One of " + list(p.Schema.Enum) + "."
+			}
+			fields = append(fields, field)
+		}
+		t.structs[index].Fields = fields
+		return name
+	default:
+		return "string"
+	}
+}
+
+func generateGo(ops []operation) ([]byte, error) {
+	types := &goTypes{}
+	methods := strings.Builder{}
+
+	for _, o := range ops {
+		args := []string{"ctx context.Context"}
+		for _, p := range o.PathParams {
+			if !token.IsIdentifier(p.Name) {
+				return nil, fmt.Errorf("the path parameter %s of %s is not a Go identifier", p.Name, o.Path)
+			}
+			args = append(args, p.Name+" string")
+		}
+
+		query := "nil"
+		queryCode := ""
+		if len(o.QueryParams) > 0 {
+			st := goStruct{
+				Doc:  fmt.Sprintf("%sParams are the query parameters of %s.", o.Name, o.Name),
+				Name: o.Name + "Params",
+			}
+			code := strings.Builder{}
+			code.WriteString("\tquery := url.Values{}\n\tif params != nil {\n")
+			for _, p := range o.QueryParams {
+				field := goField{Doc: p.Doc, Name: goName(p.Name), Type: "string"}
+				if p.Array {
+					field.Type = "[]string"
+					fmt.Fprintf(&code, "\t\tif len(params.%s) > 0 {\n\t\t\tquery[%q] = params.%s\n\t\t}\n", field.Name, p.Name, field.Name)
+				} else {
+					fmt.Fprintf(&code, "\t\tif params.%s != \"\" {\n\t\t\tquery.Set(%q, params.%s)\n\t\t}\n", field.Name, p.Name, field.Name)
+				}
+				st.Fields = append(st.Fields, field)
+			}
+			code.WriteString("\t}\n")
+			types.structs = append(types.structs, st)
+			args = append(args, "params *"+st.Name)
+			query = "query"
+			queryCode = code.String()
+		}
+
+		body := "nil"
+		if o.Request != nil {
+			args = append(args, "body *"+types.typeOf(o.Request, o.Name+"Request", "the body of "+o.Name))
+			body = "body"
+		}
+
+		var result, zero, declare, out string
+		switch {
+		case o.HTML:
+			result, zero, declare, out = "string", `""`, "\tvar out string\n", "&out"
+		case o.Response.Type == "object" && len(o.Response.Properties) > 0:
+			name := types.typeOf(o.Response, o.Name+"Response", "the response of "+o.Name)
+			result, zero, declare, out = "*"+name, "nil", "\tout := &"+name+"{}\n", "out"
+		default:
+			result = types.typeOf(o.Response, o.Name+"Response", "the response of "+o.Name)
+			zero, declare, out = "nil", "\tvar out "+result+"\n", "&out"
+		}
+
+		fmt.Fprintf(&methods, "\n// %s calls %s %s.\n", o.Name, o.Method, o.Path)
+		if o.Doc != "" {
+			methods.WriteString("//\n" + wrap(o.Doc, ""))
+		}
+		fmt.Fprintf(&methods, "func (c *Client) %s(%s) (%s, error) {\n", o.Name, strings.Join(args, ", "), result)
+		methods.WriteString(queryCode)
+		methods.WriteString(declare)
+		fmt.Fprintf(&methods, "\tif err := c.do(ctx, http.Method%s, %s, %s, %s, %s); err != nil {\n",
+			goName(strings.ToLower(o.Method)), goPath(o), query, body, out)
+		fmt.Fprintf(&methods, "\t\treturn %s, err\n\t}\n", zero)
+		methods.WriteString("\treturn out, nil\n}\n")
+	}
+
+	source := strings.Builder{}
+	source.WriteString("// Code generated by go run ./internal/gen. DO NOT EDIT.\n\npackage hostclient\n\n")
+	source.WriteString("import (\n\t\"context\"\n\t\"net/http\"\n\t\"net/url\"\n)\n")
+	for _, st := range types.structs {
+		source.WriteString("\n")
+		if st.Doc != "" {
+			source.WriteString(wrap(st.Doc, ""))
+		}
+		fmt.Fprintf(&source, "type %s struct {\n", st.Name)
+		for _, field := range st.Fields {
+			if field.Doc != "" {
+				source.WriteString(wrap(field.Doc, "\t"))
+			}
+			if field.JSON != "" {
+				fmt.Fprintf(&source, "\t%s %s `json:\"%s,omitempty\"`\n", field.Name, field.Type, field.JSON)
+			} else {
+				fmt.Fprintf(&source, "\t%s %s\n", field.Name, field.Type)
+			}
+		}
+		source.WriteString("}\n")
+	}
+	source.WriteString(methods.String())
+
+	formatted, err := format.Source([]byte(source.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the Go client: %w\n%s", err, source.String())
+	}
+	return formatted, nil
+}
+
+// goPath returns the Go expression of the path of the operation.
+func goPath(o operation) string {
+	parts := []string{}
+	rest := o.Path
+	for _, p := range o.PathParams {
+		before, after, _ := strings.Cut(rest, "{"+p.Name+"}")
+		if before != "" {
+			parts = append(parts, fmt.Sprintf("%q", before))
+		}
+		if p.Reserved {
+			parts = append(parts, "escapeSegments("+p.Name+")")
+		} else {
+			parts = append(parts, "url.PathEscape("+p.Name+")")
+		}
+		rest = after
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, "+")
+}
+
+// list returns the values as "a, b or c".
+func list(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
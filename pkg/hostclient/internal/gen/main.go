@@ -0,0 +1,265 @@
+// Command gen generates the Go and TypeScript clients of pkg/hostclient from
+// the OpenAPI of the system endpoints of the hosts. It runs in the directory
+// of pkg/hostclient through go generate.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/kdex-tech/host-manager/internal/host"
+)
+
+// operations are the ids of the system operations the clients call. The
+// endpoints serving the browsers, e.g. /-/login, or the operators, e.g.
+// /-/admin/, are left out.
+var operations = []string{
+	"bootstrap-get",
+	"format-get",
+	"healthz-get",
+	"navigation-get",
+	"openapi-get",
+	"schema-get",
+	"state-get",
+	"timezone-get",
+	"timezone-post",
+	"translation-get",
+	"translation-report-get",
+}
+
+const (
+	goFile = "zz_generated.client.go"
+	tsFile = "hostclient.ts"
+)
+
+func main() {
+	files, err := generate(host.SystemOpenAPI())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// generate returns the sources of the clients, by file name.
+func generate(spec *openapi3.T) (map[string][]byte, error) {
+	ops, err := model(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	goSource, err := generateGo(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		goFile: goSource,
+		tsFile: generateTS(ops),
+	}, nil
+}
+
+// operation is a system operation, as called by the clients.
+type operation struct {
+	Doc         string
+	Method      string
+	Name        string
+	Path        string
+	PathParams  []parameter
+	QueryParams []parameter
+	Request     *schema
+	Response    *schema
+	// HTML responses are returned as is rather than decoded.
+	HTML bool
+}
+
+type parameter struct {
+	Array    bool
+	Doc      string
+	Name     string
+	Reserved bool
+}
+
+// schema is the subset of the JSON schemas the system operations use.
+type schema struct {
+	Enum       []string
+	Items      *schema
+	Properties []property
+	Type       string
+}
+
+type property struct {
+	Name   string
+	Schema *schema
+}
+
+func model(spec *openapi3.T) ([]operation, error) {
+	ops := []operation{}
+	served := map[string]bool{}
+
+	for _, path := range spec.Paths.InMatchingOrder() {
+		item := spec.Paths.Value(path)
+		itemOps := item.Operations()
+		methods := make([]string, 0, len(itemOps))
+		for method := range itemOps {
+			methods = append(methods, method)
+		}
+		slices.Sort(methods)
+
+		for _, method := range methods {
+			op := itemOps[method]
+			if !slices.Contains(operations, op.OperationID) {
+				continue
+			}
+			served[op.OperationID] = true
+
+			o := operation{
+				Doc:    item.Description,
+				Method: method,
+				Name:   goName(strings.ToLower(method) + "-" + strings.TrimSuffix(op.OperationID, "-"+strings.ToLower(method))),
+				Path:   path,
+			}
+			if len(itemOps) > 1 {
+				o.Doc = op.Description
+			}
+			if o.Doc != "" && !strings.HasSuffix(o.Doc, ".") {
+				o.Doc += "."
+			}
+
+			for _, ref := range op.Parameters {
+				p := ref.Value
+				param := parameter{
+					Array:    p.Schema != nil && p.Schema.Value.Type.Is(openapi3.TypeArray),
+					Doc:      p.Description,
+					Name:     p.Name,
+					Reserved: p.AllowReserved,
+				}
+				switch p.In {
+				case openapi3.ParameterInPath:
+					o.PathParams = append(o.PathParams, param)
+				case openapi3.ParameterInQuery:
+					o.QueryParams = append(o.QueryParams, param)
+				}
+			}
+			slices.SortFunc(o.PathParams, func(a, b parameter) int {
+				return strings.Index(path, "{"+a.Name+"}") - strings.Index(path, "{"+b.Name+"}")
+			})
+
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				if media := op.RequestBody.Value.Content.Get("application/json"); media != nil && media.Schema != nil {
+					o.Request = toSchema(media.Schema.Value)
+				}
+			}
+
+			response := op.Responses.Status(200)
+			if response == nil || response.Value == nil {
+				return nil, fmt.Errorf("the operation %s has no 200 response", op.OperationID)
+			}
+			if media := response.Value.Content.Get("application/json"); media != nil && media.Schema != nil {
+				o.Response = toSchema(media.Schema.Value)
+			} else if response.Value.Content.Get("text/html") != nil {
+				o.HTML = true
+			} else {
+				return nil, fmt.Errorf("the operation %s has no JSON or HTML response", op.OperationID)
+			}
+
+			ops = append(ops, o)
+		}
+	}
+
+	for _, id := range operations {
+		if !served[id] {
+			return nil, fmt.Errorf("the operation %s is not served by the hosts", id)
+		}
+	}
+
+	slices.SortFunc(ops, func(a, b operation) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return ops, nil
+}
+
+func toSchema(s *openapi3.Schema) *schema {
+	out := &schema{}
+	switch {
+	case s.Type.Is(openapi3.TypeArray):
+		out.Type = openapi3.TypeArray
+		out.Items = &schema{Type: openapi3.TypeString}
+		if s.Items != nil && s.Items.Value != nil {
+			out.Items = toSchema(s.Items.Value)
+		}
+	case s.Type.Is(openapi3.TypeObject):
+		out.Type = openapi3.TypeObject
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			out.Properties = append(out.Properties, property{Name: name, Schema: toSchema(s.Properties[name].Value)})
+		}
+	case s.Type.Is(openapi3.TypeBoolean), s.Type.Is(openapi3.TypeInteger), s.Type.Is(openapi3.TypeNumber):
+		out.Type = s.Type.Slice()[0]
+	default:
+		out.Type = openapi3.TypeString
+		for _, value := range s.Enum {
+			out.Enum = append(out.Enum, fmt.Sprint(value))
+		}
+	}
+	return out
+}
+
+var initialisms = map[string]string{
+	"id":      "ID",
+	"json":    "JSON",
+	"openapi": "OpenAPI",
+	"url":     "URL",
+}
+
+// goName returns the exported Go name of a name made of words separated by
+// dashes or in camel case, e.g. "translation-report" or "missingKeys".
+func goName(name string) string {
+	b := strings.Builder{}
+	for word := range strings.SplitSeq(name, "-") {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// lowerName returns the lower camel case form of a Go name, e.g. "getState".
+func lowerName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// singular returns the name of the items of an array property.
+func singular(name string) string {
+	return strings.TrimSuffix(name, "s")
+}
+
+// wrap returns the text as comment lines of at most 80 columns.
+func wrap(text string, indent string) string {
+	b := strings.Builder{}
+	line := indent + "//"
+	for word := range strings.FieldsSeq(text) {
+		if len(line)+1+len(word) > 80 && line != indent+"//" {
+			b.WriteString(line + "\n")
+			line = indent + "//"
+		}
+		line += " " + word
+	}
+	if line != indent+"//" {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
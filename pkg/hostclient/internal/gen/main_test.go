@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kdex-tech/host-manager/internal/host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_UpToDate(t *testing.T) {
+	files, err := generate(host.SystemOpenAPI())
+	require.NoError(t, err)
+
+	for name, data := range files {
+		current, err := os.ReadFile(filepath.Join("..", "..", name))
+		require.NoError(t, err)
+		assert.Equal(t, string(data), string(current), "%s is out of date, run go generate ./pkg/hostclient/", name)
+	}
+}
+
+func TestGenerate_MissingOperation(t *testing.T) {
+	spec := host.SystemOpenAPI()
+	spec.Paths.Delete("/-/state")
+
+	_, err := generate(spec)
+	assert.ErrorContains(t, err, "state-get")
+}
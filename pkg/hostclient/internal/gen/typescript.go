@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tsRuntime is the hand written part of the TypeScript client, the
+// counterpart of client.go.
+const tsRuntime = `// The client of the system endpoints every host serves under /-/, e.g.
+// /-/state, /-/translation and /-/navigation.
+
+export interface Retry {
+  // The number of attempts of a request, 1 disables the retries.
+  maxAttempts: number;
+  // The backoff of the first retry in milliseconds, doubled at each retry.
+  minBackoff: number;
+  // Caps the backoff, and the Retry-After of the responses, in milliseconds.
+  maxBackoff: number;
+}
+
+// Retries the requests 3 times, backing off from 100ms up to 5s.
+export const defaultRetry: Retry = { maxAttempts: 4, minBackoff: 100, maxBackoff: 5000 };
+
+// Returns the bearer token of the requests, undefined for the anonymous ones.
+export type TokenSource = () => string | undefined | Promise<string | undefined>;
+
+export interface HostClientOptions {
+  fetch?: typeof fetch;
+  retry?: Retry;
+  token?: string | TokenSource;
+}
+
+// The error of the requests answered with a status other than 2xx.
+export class HostClientError extends Error {
+  constructor(
+    readonly method: string,
+    readonly path: string,
+    readonly status: number,
+    readonly body: string,
+  ) {
+    super(` + "`${method} ${path}: ${status} ${body.trim().slice(0, 200)}`" + `);
+    this.name = 'HostClientError';
+  }
+}
+
+const idempotent = ['DELETE', 'GET', 'HEAD', 'OPTIONS', 'PUT'];
+
+// Only the requests answered 429 are retried when their method is not
+// idempotent.
+function retryable(method: string, status: number): boolean {
+  if (status === 429) {
+    return true;
+  }
+  return [502, 503, 504].includes(status) && idempotent.includes(method);
+}
+
+function retryAfter(value: string | null): number {
+  if (!value) {
+    return 0;
+  }
+  const seconds = Number(value);
+  if (Number.isInteger(seconds) && seconds > 0) {
+    return seconds * 1000;
+  }
+  const date = Date.parse(value);
+  return Number.isNaN(date) ? 0 : Math.max(date - Date.now(), 0);
+}
+
+function escapeSegments(value: string): string {
+  return value.split('/').map(encodeURIComponent).join('/');
+}
+
+// Calls the system endpoints of a host, retrying the requests failing with a
+// network error or answered 429, 502, 503 or 504.
+export class HostClient {
+  private readonly baseUrl: string;
+  private readonly fetch: typeof fetch;
+  private readonly retry: Retry;
+  private readonly token?: string | TokenSource;
+
+  // baseUrl is the URL of the host, '' for the host serving the page.
+  constructor(baseUrl = '', options: HostClientOptions = {}) {
+    this.baseUrl = baseUrl.replace(/\/$/, '');
+    this.fetch = options.fetch ?? globalThis.fetch.bind(globalThis);
+    this.retry = options.retry ?? defaultRetry;
+    this.token = options.token;
+  }
+
+  private async request<T>(
+    method: string,
+    path: string,
+    query?: URLSearchParams,
+    body?: unknown,
+    html = false,
+  ): Promise<T> {
+    const headers: Record<string, string> = { Accept: 'application/json, text/html;q=0.9' };
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+    const token = typeof this.token === 'function' ? await this.token() : this.token;
+    if (token) {
+      headers.Authorization = ` + "`Bearer ${token}`" + `;
+    }
+    const search = query?.toString();
+    const url = this.baseUrl + path + (search ? ` + "`?${search}`" + ` : '');
+
+    let backoff = this.retry.minBackoff;
+    for (let attempt = 1; ; attempt++) {
+      const last = attempt >= Math.max(this.retry.maxAttempts, 1);
+
+      let response: Response | undefined;
+      try {
+        response = await this.fetch(url, {
+          body: body === undefined ? undefined : JSON.stringify(body),
+          credentials: 'same-origin',
+          headers,
+          method,
+        });
+      } catch (error) {
+        if (last || !idempotent.includes(method)) {
+          throw error;
+        }
+      }
+
+      let wait = 0;
+      if (response?.ok) {
+        return (html ? await response.text() : await response.json()) as T;
+      }
+      if (response) {
+        const text = await response.text();
+        if (last || !retryable(method, response.status)) {
+          throw new HostClientError(method, path, response.status, text);
+        }
+        wait = retryAfter(response.headers.get('Retry-After'));
+      }
+
+      if (wait === 0 && backoff > 0) {
+        // Full jitter spreads the retries of the clients failing together.
+        wait = Math.random() * backoff + 1;
+      }
+      if (this.retry.maxBackoff > 0) {
+        wait = Math.min(wait, this.retry.maxBackoff);
+      }
+      await new Promise((resolve) => setTimeout(resolve, wait));
+      backoff *= 2;
+      if (this.retry.maxBackoff > 0) {
+        backoff = Math.min(backoff, this.retry.maxBackoff);
+      }
+    }
+  }
+`
+
+type tsInterface struct {
+	Doc    string
+	Fields []tsField
+	Name   string
+}
+
+type tsField struct {
+	Doc  string
+	Name string
+	Type string
+}
+
+// tsTypes collects the interfaces of the schemas of the operations.
+type tsTypes struct {
+	interfaces []tsInterface
+}
+
+// typeOf returns the TypeScript type of the schema, declaring the interfaces
+// of its objects after the name, documented by doc.
+func (t *tsTypes) typeOf(s *schema, name string, doc string) string {
+	switch s.Type {
+	case "array":
+		item := t.typeOf(s.Items, singular(name), "an item of "+doc)
+		if strings.Contains(item, " ") {
+			return "(" + item + ")[]"
+		}
+		return item + "[]"
+	case "boolean":
+		return "boolean"
+	case "integer", "number":
+		return "number"
+	case "object":
+		if len(s.Properties) == 0 {
+			return "Record<string, unknown>"
+		}
+		index := len(t.interfaces)
+		t.interfaces = append(t.interfaces, tsInterface{Doc: name + " is " + doc + ".", Name: name})
+		fields := []tsField{}
+		for _, p := range s.Properties {
+			fields = append(fields, tsField{
+				Name: p.Name,
+				Type: t.typeOf(p.Schema, name+goName(p.Name), "the "+p.Name+" of "+name),
+			})
+		}
+		t.interfaces[index].Fields = fields
+		return name
+	default:
+		if len(s.Enum) > 0 {
+			values := make([]string, 0, len(s.Enum))
+			for _, value := range s.Enum {
+				values = append(values, "'"+value+"'")
+			}
+			return strings.Join(values, " | ")
+		}
+		return "string"
+	}
+}
+
+func generateTS(ops []operation) []byte {
+	types := &tsTypes{}
+	methods := strings.Builder{}
+
+	for _, o := range ops {
+		args := []string{}
+		for _, p := range o.PathParams {
+			args = append(args, p.Name+": string")
+		}
+
+		query := "undefined"
+		queryCode := ""
+		if len(o.QueryParams) > 0 {
+			it := tsInterface{
+				Doc:  fmt.Sprintf("%sParams are the query parameters of %s.", o.Name, lowerName(o.Name)),
+				Name: o.Name + "Params",
+			}
+			code := strings.Builder{}
+			code.WriteString("    const query = new URLSearchParams();\n")
+			for _, p := range o.QueryParams {
+				field := tsField{Doc: p.Doc, Name: p.Name, Type: "string"}
+				if p.Array {
+					field.Type = "string[]"
+					fmt.Fprintf(&code, "    for (const value of params?.%s ?? []) {\n      query.append('%s', value);\n    }\n", p.Name, p.Name)
+				} else {
+					fmt.Fprintf(&code, "    if (params?.%s) {\n      query.set('%s', params.%s);\n    }\n", p.Name, p.Name, p.Name)
+				}
+				it.Fields = append(it.Fields, field)
+			}
+			types.interfaces = append(types.interfaces, it)
+			args = append(args, "params?: "+it.Name)
+			query = "query"
+			queryCode = code.String()
+		}
+
+		body := ""
+		if o.Request != nil {
+			args = append(args, "body: "+types.typeOf(o.Request, o.Name+"Request", "the body of "+lowerName(o.Name)))
+			body = ", body"
+		}
+
+		result := "string"
+		if !o.HTML {
+			result = types.typeOf(o.Response, o.Name+"Response", "the response of "+lowerName(o.Name))
+		}
+
+		call := fmt.Sprintf("this.request('%s', %s, %s%s)", o.Method, tsPath(o), query, body)
+		if o.HTML {
+			call = fmt.Sprintf("this.request('%s', %s, %s, undefined, true)", o.Method, tsPath(o), query)
+		} else if body == "" && query == "undefined" {
+			call = fmt.Sprintf("this.request('%s', %s)", o.Method, tsPath(o))
+		}
+
+		methods.WriteString("\n")
+		if o.Doc != "" {
+			methods.WriteString(wrap(o.Doc, "  "))
+		}
+		fmt.Fprintf(&methods, "  // %s %s\n", o.Method, o.Path)
+		fmt.Fprintf(&methods, "  %s(%s): Promise<%s> {\n", lowerName(o.Name), strings.Join(args, ", "), result)
+		methods.WriteString(queryCode)
+		fmt.Fprintf(&methods, "    return %s;\n  }\n", call)
+	}
+
+	source := strings.Builder{}
+	source.WriteString("// Code generated by go run ./internal/gen. DO NOT EDIT.\n\n")
+	source.WriteString(tsRuntime)
+	source.WriteString(methods.String())
+	source.WriteString("}\n")
+	for _, it := range types.interfaces {
+		source.WriteString("\n")
+		source.WriteString(wrap(it.Doc, ""))
+		fmt.Fprintf(&source, "export interface %s {\n", it.Name)
+		for _, field := range it.Fields {
+			if field.Doc != "" {
+				source.WriteString(wrap(field.Doc, "  "))
+			}
+			fmt.Fprintf(&source, "  %s?: %s;\n", field.Name, field.Type)
+		}
+		source.WriteString("}\n")
+	}
+	return []byte(source.String())
+}
+
+// tsPath returns the TypeScript expression of the path of the operation.
+func tsPath(o operation) string {
+	if len(o.PathParams) == 0 {
+		return "'" + o.Path + "'"
+	}
+	path := o.Path
+	for _, p := range o.PathParams {
+		escape := "encodeURIComponent"
+		if p.Reserved {
+			escape = "escapeSegments"
+		}
+		path = strings.Replace(path, "{"+p.Name+"}", "${"+escape+"("+p.Name+")}", 1)
+	}
+	return "`" + path + "`"
+}
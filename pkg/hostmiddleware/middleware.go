@@ -0,0 +1,113 @@
+// Package hostmiddleware lets platform teams add their own request/response
+// middlewares to the hosts, e.g. custom headers or tenant resolution, without
+// forking the host manager. The hosts declare the middlewares they run, in
+// order and scoped to paths, in their kdex.dev/middlewares annotation.
+//
+// A middleware is either compiled in, registered by the init function of a
+// package imported by the host manager binary:
+//
+//	func init() {
+//		hostmiddleware.Register("tenant", func(config json.RawMessage) (func(http.Handler) http.Handler, error) {
+//			...
+//		})
+//	}
+//
+// or loaded from a Go plugin of the plugin directory of the host manager,
+// built with go build -buildmode=plugin by the same toolchain and with the
+// same dependencies as the host manager, and exporting a Middleware function
+// of the Factory signature.
+//
+// It depends on nothing else of the host manager and its API is kept stable.
+package hostmiddleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"sync"
+)
+
+// PluginSymbol is the name of the Factory the Go plugins export.
+const PluginSymbol = "Middleware"
+
+// Factory returns the middleware configured by the config of its declaration,
+// null when the declaration has none. The middleware wraps the handler of the
+// host for each request, so the state it keeps across requests belongs in the
+// closure of the factory.
+type Factory func(config json.RawMessage) (func(http.Handler) http.Handler, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes the factory available under the name. It panics when the
+// name is registered twice or the factory is nil, as registering is done by
+// init functions.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("hostmiddleware: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("hostmiddleware: Register called twice for middleware " + name)
+	}
+	factories[name] = factory
+}
+
+// Lookup returns the factory registered under the name.
+func Lookup(name string) (Factory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	factory, ok := factories[name]
+	return factory, ok
+}
+
+// Names returns the sorted names of the registered factories.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open returns the Factory exported by the Go plugin file of the directory.
+// The file is a base name, so that the plugins loaded are only those the
+// directory holds. A plugin is loaded once per process.
+func Open(dir string, file string) (Factory, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("plugin %s: no plugin directory is configured", file)
+	}
+	if file == "" || file != filepath.Base(file) || file == "." || file == ".." {
+		return nil, fmt.Errorf("plugin %q: expected the name of a file of the plugin directory", file)
+	}
+
+	p, err := plugin.Open(filepath.Join(dir, file))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", file, err)
+	}
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", file, err)
+	}
+
+	switch factory := symbol.(type) {
+	case func(json.RawMessage) (func(http.Handler) http.Handler, error):
+		return factory, nil
+	case *Factory:
+		return *factory, nil
+	default:
+		return nil, fmt.Errorf("plugin %s: %s is a %T, expected a %T", file, PluginSymbol, symbol, Factory(nil))
+	}
+}
@@ -0,0 +1,41 @@
+package hostmiddleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	factory := func(config json.RawMessage) (func(http.Handler) http.Handler, error) {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	Register("register-test", factory)
+	got, ok := Lookup("register-test")
+	require.True(t, ok)
+	assert.NotNil(t, got)
+	assert.Contains(t, Names(), "register-test")
+
+	assert.Panics(t, func() { Register("register-test", factory) })
+	assert.Panics(t, func() { Register("register-test-nil", nil) })
+
+	_, ok = Lookup("missing")
+	assert.False(t, ok)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open("", "headers.so")
+	assert.ErrorContains(t, err, "no plugin directory")
+
+	for _, file := range []string{"", "../headers.so", "/plugins/headers.so", ".."} {
+		_, err = Open(t.TempDir(), file)
+		assert.ErrorContains(t, err, "expected the name of a file", file)
+	}
+
+	_, err = Open(t.TempDir(), "missing.so")
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package jwtverify_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kdex-tech/host-manager/pkg/jwtverify"
+)
+
+// A backend verifies the sessions of the host it is deployed by.
+func ExampleVerifier_Middleware() {
+	verifier := jwtverify.NewVerifier("https://shop.example.com", "https://shop.example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /-/orders/", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := jwtverify.ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !claims.HasEntitlement("orders:read") {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "the orders of %s", claims.Subject)
+	})
+
+	log.Fatal(http.ListenAndServe(":8080", verifier.Middleware(mux)))
+}
+
+// A function deployed by a host finds its keys in its env.
+func ExampleNewVerifierFromEnv() {
+	verifier, err := jwtverify.NewVerifierFromEnv("")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwtverify.TokenFromRequest(r, jwtverify.DefaultCookieName)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		claims, err := verifier.Verify(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "hello %s", claims.Subject)
+	})
+}
@@ -0,0 +1,197 @@
+package jwtverify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinRefresh bounds how often a KeySet fetches its JWKS again for
+	// a token signed by a key it is not known to have.
+	DefaultMinRefresh = 30 * time.Second
+	// DefaultTTL is how long a KeySet trusts the keys it fetched.
+	DefaultTTL = 10 * time.Minute
+
+	fetchTimeout = 10 * time.Second
+)
+
+// JWK represents a JSON Web Key.
+type JWK struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA fields
+	E string `json:"e,omitempty"`
+	N string `json:"n,omitempty"`
+	// ECDSA fields
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet represents a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey returns the RSA or ECDSA public key of the JWK.
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("invalid coordinates for curve %s", jwk.Crv)
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// FetchKeys returns the signing keys of the JWKS at the URL by their key ID.
+func FetchKeys(ctx context.Context, client *http.Client, jwksURL string) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys at %s: %w", jwksURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the keys at %s: %s", jwksURL, resp.Status)
+	}
+
+	set := JWKSet{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid keys at %s: %w", jwksURL, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q at %s: %w", jwk.Kid, jwksURL, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// KeySet caches the keys of a JWKS. They are fetched again once their TTL
+// has passed, or when a token is signed by an unknown key so that the
+// rotations of the keys are followed. The keys known keep verifying the
+// tokens while the JWKS cannot be fetched.
+type KeySet struct {
+	Client *http.Client
+	// MinRefresh bounds how often the JWKS is fetched for unknown keys,
+	// DefaultMinRefresh when zero.
+	MinRefresh time.Duration
+	// TTL is how long the keys fetched are trusted, DefaultTTL when zero.
+	TTL time.Duration
+	URL string
+
+	mu      sync.Mutex
+	fetched time.Time
+	keys    map[string]crypto.PublicKey
+}
+
+// NewKeySet returns the cache of the keys of the JWKS at the URL.
+func NewKeySet(jwksURL string) *KeySet {
+	return &KeySet{
+		Client: &http.Client{Timeout: fetchTimeout},
+		URL:    jwksURL,
+	}
+}
+
+// Key returns the key of the key ID.
+func (k *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	minRefresh, ttl := DefaultMinRefresh, DefaultTTL
+	if k.MinRefresh > 0 {
+		minRefresh = k.MinRefresh
+	}
+	if k.TTL > 0 {
+		ttl = k.TTL
+	}
+
+	if k.keys != nil {
+		if key, ok := k.keys[kid]; ok && time.Since(k.fetched) < ttl {
+			return key, nil
+		}
+		if time.Since(k.fetched) < minRefresh {
+			return k.key(kid)
+		}
+	}
+
+	keys, err := FetchKeys(ctx, k.Client, k.URL)
+	if err != nil {
+		if k.keys != nil {
+			// Keep verifying with the keys known until the JWKS is back.
+			return k.key(kid)
+		}
+		return nil, err
+	}
+	k.fetched, k.keys = time.Now(), keys
+	return k.key(kid)
+}
+
+func (k *KeySet) key(kid string) (crypto.PublicKey, error) {
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("the keys at %s have no key %q", k.URL, kid)
+}
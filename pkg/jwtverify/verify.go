@@ -0,0 +1,198 @@
+// Package jwtverify verifies, in the backends and the functions of a host,
+// the tokens the host mints, the way the host does: against the keys it
+// publishes at /.well-known/jwks.json, checking their issuer, audience and
+// expiry, and decoding their claims.
+//
+// It depends on nothing else of the host manager and its API is kept stable
+// so that the backends written in Go may import it.
+package jwtverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultCookieName is the cookie holding the token of the sessions of
+	// the hosts, unless their configuration names another.
+	DefaultCookieName = "auth_token"
+
+	// The env of the functions deployed by a host locating its keys.
+	IssuerEnv  = "ISSUER"
+	JWKSURLEnv = "JWKS_URL"
+)
+
+// ValidMethods are the signing methods of the keys of the hosts, those of
+// the tokens they mint.
+var ValidMethods = []string{
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+}
+
+// Claims are the claims of the tokens minted by the hosts. The claims mapped
+// by the claim mappings of a host are left out.
+type Claims struct {
+	jwt.RegisteredClaims
+
+	AuthMethod   string   `json:"auth_method,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	Entitlements []string `json:"entitlements,omitempty"`
+	GrantType    string   `json:"grant_type,omitempty"`
+	IdP          string   `json:"idp,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	Scope        string   `json:"scope,omitempty"`
+}
+
+// Scopes returns the space separated scopes of the token.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasEntitlement reports whether the token carries the entitlement, e.g.
+// "backends:/-/orders/:read".
+func (c *Claims) HasEntitlement(entitlement string) bool {
+	return slices.Contains(c.Entitlements, entitlement)
+}
+
+// HasRole reports whether the subject of the token has the role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// Verifier verifies the tokens of an issuer.
+type Verifier struct {
+	// Audience, when set, must be among the audiences of the tokens.
+	Audience string
+	// Issuer must be the issuer of the tokens.
+	Issuer string
+	Keys   *KeySet
+	// Leeway is the clock skew tolerated on the times of the tokens.
+	Leeway time.Duration
+}
+
+// NewVerifier returns the verifier of the tokens of the issuer, e.g.
+// "https://shop.example.com", whose keys are at /.well-known/jwks.json.
+func NewVerifier(issuer string, audience string) *Verifier {
+	issuer = strings.TrimSuffix(issuer, "/")
+	return &Verifier{
+		Audience: audience,
+		Issuer:   issuer,
+		Keys:     NewKeySet(issuer + "/.well-known/jwks.json"),
+	}
+}
+
+// NewVerifierFromEnv returns the verifier of the tokens of the host, from
+// the ISSUER and JWKS_URL env the host sets on the functions it deploys.
+func NewVerifierFromEnv(audience string) (*Verifier, error) {
+	issuer := os.Getenv(IssuerEnv)
+	if issuer == "" {
+		return nil, fmt.Errorf("%s is not set", IssuerEnv)
+	}
+
+	verifier := NewVerifier(issuer, audience)
+	if jwksURL := os.Getenv(JWKSURLEnv); jwksURL != "" {
+		verifier.Keys = NewKeySet(jwksURL)
+	}
+	return verifier, nil
+}
+
+// Verify returns the claims of the token once its signature, issuer,
+// audience and expiry are verified.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithValidMethods(ValidMethods),
+	}
+	if v.Audience != "" {
+		options = append(options, jwt.WithAudience(v.Audience))
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.Keys.Key(ctx, kid)
+	}, options...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ErrNoToken is returned by TokenFromRequest for the anonymous requests.
+var ErrNoToken = errors.New("no token")
+
+// TokenFromRequest returns the bearer token of the Authorization header of
+// the request, else the token of the cookie.
+func TokenFromRequest(r *http.Request, cookieName string) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+			return "", fmt.Errorf("invalid Authorization header, expected a bearer token")
+		}
+		return token, nil
+	}
+
+	if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	return "", ErrNoToken
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims of the request verified by
+// Middleware, false for the anonymous requests.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// ContextWithClaims returns the context holding the claims, e.g. for the
+// tests of the handlers behind Middleware.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Middleware verifies the token of the requests, in their Authorization
+// header or in the cookie of DefaultCookieName, and passes its claims on in
+// their context. The requests without a token pass on anonymous, those with
+// an invalid one are answered 401.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return v.MiddlewareWithCookie(DefaultCookieName)(next)
+}
+
+// MiddlewareWithCookie is Middleware for the hosts naming another cookie.
+func (v *Verifier) MiddlewareWithCookie(cookieName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := TokenFromRequest(r, cookieName)
+			if errors.Is(err, ErrNoToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package jwtverify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issuer serves the JWKS of its key and signs its tokens.
+type issuer struct {
+	*httptest.Server
+	fetches int
+	key     *ecdsa.PrivateKey
+	kid     string
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	i := &issuer{key: key, kid: "k1"}
+	i.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.fetches++
+		point, _ := i.key.PublicKey.Bytes()
+		coords := point[1:]
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			Alg: "ES256",
+			Crv: "P-256",
+			Kid: i.kid,
+			Kty: "EC",
+			Use: "sig",
+			X:   base64.RawURLEncoding.EncodeToString(coords[:len(coords)/2]),
+			Y:   base64.RawURLEncoding.EncodeToString(coords[len(coords)/2:]),
+		}}})
+	}))
+	t.Cleanup(i.Close)
+	return i
+}
+
+func (i *issuer) token(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (i *issuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"aud":          []string{i.URL},
+		"email":        "jane@example.com",
+		"entitlements": []string{"backends:/-/orders/:read"},
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"iss":          i.URL,
+		"roles":        []string{"buyer"},
+		"scope":        "openid email",
+		"sub":          "jane",
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	i := newIssuer(t)
+	v := NewVerifier(i.URL+"/", i.URL)
+
+	claims, err := v.Verify(context.Background(), i.token(t, i.claims()))
+	require.NoError(t, err)
+	assert.Equal(t, "jane", claims.Subject)
+	assert.Equal(t, "jane@example.com", claims.Email)
+	assert.True(t, claims.HasEntitlement("backends:/-/orders/:read"))
+	assert.True(t, claims.HasRole("buyer"))
+	assert.Equal(t, []string{"openid", "email"}, claims.Scopes())
+
+	_, err = v.Verify(context.Background(), i.token(t, i.claims()))
+	require.NoError(t, err)
+	assert.Equal(t, 1, i.fetches, "keys are cached")
+
+	for name, mutate := range map[string]func(jwt.MapClaims){
+		"other issuer":   func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+		"other audience": func(c jwt.MapClaims) { c["aud"] = []string{"https://other.example.com"} },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+	} {
+		claims := i.claims()
+		mutate(claims)
+		_, err := v.Verify(context.Background(), i.token(t, claims))
+		assert.Error(t, err, name)
+	}
+
+	// A token of a key the issuer does not publish.
+	other := newIssuer(t)
+	_, err = v.Verify(context.Background(), other.token(t, i.claims()))
+	assert.Error(t, err)
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	i := newIssuer(t)
+	keys := NewKeySet(i.URL)
+	keys.MinRefresh = time.Nanosecond
+
+	_, err := keys.Key(context.Background(), "k1")
+	require.NoError(t, err)
+
+	rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	i.key, i.kid = rotated, "k2"
+
+	key, err := keys.Key(context.Background(), "k2")
+	require.NoError(t, err)
+	assert.True(t, rotated.PublicKey.Equal(key))
+	assert.Equal(t, 2, i.fetches)
+
+	// The keys known keep verifying while the JWKS is down.
+	i.Close()
+	_, err = keys.Key(context.Background(), "k2")
+	assert.NoError(t, err)
+}
+
+func TestNewVerifierFromEnv(t *testing.T) {
+	t.Setenv(IssuerEnv, "")
+	_, err := NewVerifierFromEnv("")
+	assert.Error(t, err)
+
+	t.Setenv(IssuerEnv, "https://shop.example.com")
+	t.Setenv(JWKSURLEnv, "http://kdex-web.shop.svc/.well-known/jwks.json")
+	v, err := NewVerifierFromEnv("")
+	require.NoError(t, err)
+	assert.Equal(t, "https://shop.example.com", v.Issuer)
+	assert.Equal(t, "http://kdex-web.shop.svc/.well-known/jwks.json", v.Keys.URL)
+}
+
+func TestVerifier_Middleware(t *testing.T) {
+	i := newIssuer(t)
+	v := NewVerifier(i.URL, "")
+
+	var got *Claims
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+	}))
+	serve := func(r *http.Request) int {
+		got = nil
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, http.StatusOK, serve(r))
+	assert.Nil(t, got)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+i.token(t, i.claims()))
+	assert.Equal(t, http.StatusOK, serve(r))
+	require.NotNil(t, got)
+	assert.Equal(t, "jane", got.Subject)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: i.token(t, i.claims())})
+	assert.Equal(t, http.StatusOK, serve(r))
+	require.NotNil(t, got)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, serve(r))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Basic amFuZTpzZWNyZXQ=")
+	assert.Equal(t, http.StatusUnauthorized, serve(r))
+}